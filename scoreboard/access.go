@@ -0,0 +1,86 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/PurpleSec/logx"
+)
+
+const requestHeader = "X-Request-ID"
+
+type requestKey struct{}
+
+// track wraps the Handler to give each request an ID, count the response status codes
+// and log each request. The ID is taken from the "X-Request-ID" header if it is valid,
+// so requests can be followed through a proxy, and is returned in the same header.
+func (s *Scoreboard) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			n  = time.Now()
+			v  = &recorder{ResponseWriter: w}
+			id = r.Header.Get(requestHeader)
+		)
+		if !validRequest(id) {
+			var b [12]byte
+			rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		w.Header().Set(requestHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestKey{}, id))
+		h.ServeHTTP(v, r)
+		if v.code == 0 {
+			v.code = http.StatusOK
+		}
+		s.stats.status(v.code)
+		a, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			a = r.RemoteAddr
+		}
+		l := logx.Info
+		if v.code >= 500 {
+			l = logx.Warning
+		}
+		s.web.request(r).fields(l, r.Method+" "+r.URL.Path, map[string]interface{}{
+			"ip":       a,
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"status":   v.code,
+			"duration": time.Since(n).Round(time.Microsecond).String(),
+		})
+	})
+}
+func validRequest(s string) bool {
+	if len(s) == 0 || len(s) > 128 {
+		return false
+	}
+	for i := range s {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,589 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const adminBody = 1 << 16
+
+type admin struct {
+	Token     string    `json:"token"`
+	Auth      staff     `json:"auth"`
+	Presenter presenter `json:"presenter"`
+	Confirm   confirm   `json:"confirm"`
+	Tickets   bool      `json:"tickets"`
+}
+type control struct {
+	Action   string  `json:"action"`
+	Duration string  `json:"duration"`
+	Name     string  `json:"name"`
+	Game     uint64  `json:"game"`
+	At       int64   `json:"at"`
+	End      int64   `json:"end"`
+	Position int64   `json:"position"`
+	Speed    float64 `json:"speed"`
+}
+
+// console is the data of the admin page, which only lists the parts of the Scoreboard
+// that are enabled. The page holds no secrets, the admin token is entered in the page
+// and sent with each admin API request.
+type console struct {
+	Games   []string
+	Twitter bool
+	SSO     bool
+}
+type bulletin struct {
+	Action     string `json:"action"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+	Duration   string `json:"duration"`
+	Name       string `json:"name"`
+	ID         uint64 `json:"id"`
+	Ticker     bool   `json:"ticker"`
+	Fullscreen bool   `json:"fullscreen"`
+}
+type adjustment struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	Name   string `json:"name"`
+	ID     uint64 `json:"id"`
+	Game   uint64 `json:"game"`
+	Team   uint64 `json:"team"`
+	Points int64  `json:"points"`
+}
+
+func (s *Scoreboard) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Requests relayed by another node of the cluster were already authorized by
+		// that node and are not relayed again.
+		if _, ok := r.Context().Value(clusterKey{}).(string); ok {
+			h(w, r)
+			return
+		}
+		if !s.permitted(r, false, scope(r)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scoreboard"`)
+			fail(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			s.log.request(r).Warning(`Rejected unauthorized admin request from "%s" to "%s"!`, r.RemoteAddr, r.URL.Path)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if len(s.replica) > 0 && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			refuse(w, codeReadOnly, "replicas are read-only, changes must be made on the primary", http.StatusForbidden)
+			return
+		}
+		// Destructive requests are held before they are relayed, so the other nodes
+		// only receive them once they are approved.
+		if s.guard(w, r, h) {
+			return
+		}
+		s.perform(w, r, h)
+	}
+}
+
+// perform handles the authorized admin request, relaying changes to the other nodes
+// of the cluster.
+func (s *Scoreboard) perform(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	if s.cluster != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.cluster.relay(w, r, h)
+		return
+	}
+	h(w, r)
+}
+func (s *Scoreboard) authorized(r *http.Request, q bool) bool {
+	if len(s.token) == 0 {
+		return false
+	}
+	v := credential(r, q)
+	if len(v) > 0 && subtle.ConstantTimeCompare([]byte(v), []byte(s.token)) == 1 {
+		return true
+	}
+	if s.signin == nil {
+		return false
+	}
+	u, p, ok := r.BasicAuth()
+	if !ok {
+		u, p = "", v
+	}
+	n, ok := s.signin.authenticate(r.Context(), u, p)
+	if ok {
+		s.log.request(r).Debug(`Staff "%s" signed in from "%s".`, n, r.RemoteAddr)
+	}
+	return ok
+}
+func (s *Scoreboard) httpReplay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Replays())
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c control
+	if !s.control(w, r, &c) {
+		return
+	}
+	if c.Game == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	if c.Speed < 0 {
+		fail(w, "speed cannot be less than zero", http.StatusBadRequest)
+		return
+	}
+	var err error
+	switch strings.ToLower(c.Action) {
+	case "start":
+		if len(c.Duration) > 0 {
+			d, x := time.ParseDuration(c.Duration)
+			if x != nil || d <= 0 {
+				fail(w, "duration must be a positive duration", http.StatusBadRequest)
+				return
+			}
+			var b, e time.Time
+			if b, e, err = s.store.Span(r.Context(), c.Game); err == nil && e.After(b) {
+				c.Speed = float64(e.Sub(b)) / float64(d)
+			}
+		}
+		if err != nil {
+			break
+		}
+		if c.Speed == 0 {
+			c.Speed = 1
+		}
+		err = s.Replay(r.Context(), c.Game, s.store, c.Speed)
+	case "pause":
+		err = s.Pause(c.Game, true, c.Speed)
+	case "resume":
+		err = s.Pause(c.Game, false, c.Speed)
+	case "seek":
+		err = s.Seek(c.Game, time.UnixMilli(c.Position))
+	case "stop":
+		err = s.Stop(c.Game)
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fail(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" performed replay action "%s" on Game %s.`, r.RemoteAddr, c.Action, strconv.FormatUint(c.Game, 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Replays())
+}
+func (s *Scoreboard) httpFreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Frozen())
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c control
+	if !s.control(w, r, &c) {
+		return
+	}
+	switch strings.ToLower(c.Action) {
+	case "freeze":
+		var t time.Time
+		if c.At > 0 {
+			t = time.UnixMilli(c.At)
+		}
+		s.Freeze(c.Game, t)
+	case "unfreeze":
+		var d time.Duration
+		if len(c.Duration) > 0 {
+			var err error
+			if d, err = time.ParseDuration(c.Duration); err != nil || d < 0 {
+				fail(w, "duration must be a positive duration", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.Unfreeze(c.Game, d); err != nil {
+			refuse(w, codeFrozen, err.Error(), http.StatusConflict)
+			return
+		}
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" performed freeze action "%s" on Game %s.`, r.RemoteAddr, c.Action, strconv.FormatUint(c.Game, 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Frozen())
+}
+func (s *Scoreboard) httpTwitter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c control
+		if !s.control(w, r, &c) {
+			return
+		}
+		var err error
+		switch strings.ToLower(c.Action) {
+		case "pause":
+			err = s.PauseTwitter()
+		case "resume":
+			err = s.ResumeTwitter()
+		default:
+			fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			fail(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.log.request(r).Info(`Admin "%s" performed Twitter action "%s".`, r.RemoteAddr, c.Action)
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Rules    map[string]uint64 `json:"rules"`
+		Received uint64            `json:"received"`
+		Filtered uint64            `json:"filtered"`
+		Held     uint32            `json:"held"`
+		Paused   bool              `json:"paused"`
+	}{
+		s.stats.filters(), atomic.LoadUint64(&s.stats.received), atomic.LoadUint64(&s.stats.filtered),
+		atomic.LoadUint32(&s.stats.held), atomic.LoadUint32(&s.stats.paused) == 1,
+	})
+}
+func (s *Scoreboard) httpClock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c control
+	if !s.control(w, r, &c) {
+		return
+	}
+	m := s.Manager
+	if len(c.Name) > 0 {
+		if m = s.games[strings.ToLower(c.Name)]; m == nil {
+			fail(w, `game "`+c.Name+`" does not exist`, http.StatusNotFound)
+			return
+		}
+	}
+	var (
+		d   time.Duration
+		err error
+	)
+	if len(c.Duration) > 0 {
+		if d, err = time.ParseDuration(c.Duration); err != nil {
+			fail(w, "duration must be a valid duration", http.StatusBadRequest)
+			return
+		}
+	}
+	switch strings.ToLower(c.Action) {
+	case "set":
+		var b, e time.Time
+		if c.At > 0 {
+			b = time.UnixMilli(c.At)
+		}
+		switch {
+		case c.End > 0:
+			e = time.UnixMilli(c.End)
+		case d > 0 && b.IsZero():
+			b = time.Now()
+			fallthrough
+		case d > 0:
+			e = b.Add(d)
+		}
+		if b.IsZero() && e.IsZero() {
+			fail(w, "a start time, end time or duration is required", http.StatusBadRequest)
+			return
+		}
+		err = m.Clock(c.Game, b, e)
+	case "clear":
+		err = m.Clock(c.Game, time.Time{}, time.Time{})
+	case "pause":
+		err = m.Suspend(c.Game, true)
+	case "resume":
+		err = m.Suspend(c.Game, false)
+	case "extend":
+		if d == 0 {
+			fail(w, "a duration is required", http.StatusBadRequest)
+			return
+		}
+		err = m.Extend(c.Game, d)
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	switch {
+	case err == game.ErrLocked:
+		refuse(w, codeLocked, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		fail(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" performed clock action "%s" on Game %s.`, r.RemoteAddr, c.Action, strconv.FormatUint(c.Game, 10))
+	v, _ := m.Countdown(c.Game)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+func (s *Scoreboard) httpAdjust(w http.ResponseWriter, r *http.Request) {
+	var (
+		c adjustment
+		m = s.Manager
+	)
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if n := q.Get("name"); len(n) > 0 {
+			if m = s.games[strings.ToLower(n)]; m == nil {
+				fail(w, `game "`+n+`" does not exist`, http.StatusNotFound)
+				return
+			}
+		}
+		g, _ := strconv.ParseUint(q.Get("game"), 10, 64)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Adjustments(g))
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(c.Name) > 0 {
+		if m = s.games[strings.ToLower(c.Name)]; m == nil {
+			fail(w, `game "`+c.Name+`" does not exist`, http.StatusNotFound)
+			return
+		}
+	}
+	var (
+		a   game.Adjustment
+		err error
+	)
+	switch strings.ToLower(c.Action) {
+	case "", "add":
+		if v, ok := m.Standings(c.Game); ok && !v.Has(c.Team) {
+			fail(w, "team "+strconv.FormatUint(c.Team, 10)+" is not in game "+strconv.FormatUint(c.Game, 10), http.StatusNotFound)
+			return
+		}
+		a, err = m.Adjust(c.Game, c.Team, c.Points, c.Reason, r.RemoteAddr)
+	case "revert":
+		a, err = m.Revert(c.ID, r.RemoteAddr)
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	switch {
+	case err == game.ErrLocked:
+		refuse(w, codeLocked, err.Error(), http.StatusConflict)
+		return
+	case err != nil && strings.EqualFold(c.Action, "revert"):
+		fail(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		fail(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+func (s *Scoreboard) httpConsole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	c := console{Games: make([]string, 0, len(s.games)), Twitter: s.rotate != nil}
+	_, c.SSO = s.signin.(*provider)
+	for n := range s.games {
+		c.Games = append(c.Games, n)
+	}
+	sort.Strings(c.Games)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := s.render(w, r, "admin.html", strings.Join(c.Games, ",")+"|"+strconv.FormatBool(c.Twitter)+"|"+strconv.FormatBool(c.SSO), c); err != nil {
+		s.log.request(r).Error("Unable to render the admin page: %s!", err.Error())
+	}
+}
+func (s *Scoreboard) httpTweets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c struct {
+			Action string `json:"action"`
+			ID     uint64 `json:"id,string"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+			fail(w, "request body is not valid JSON", http.StatusBadRequest)
+			return
+		}
+		if !strings.EqualFold(c.Action, "remove") {
+			fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+			return
+		}
+		if c.ID == 0 {
+			fail(w, "a valid Tweet ID is required", http.StatusBadRequest)
+			return
+		}
+		// Every Manager is sent the same Tweets, so the Tweet is removed from each of
+		// them.
+		s.Retract(c.ID)
+		for _, m := range s.games {
+			m.Retract(c.ID)
+		}
+		s.log.request(r).Info(`Admin "%s" removed Tweet ID %d from the ticker.`, r.RemoteAddr, c.ID)
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Tweets())
+}
+func (s *Scoreboard) httpAnnounce(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Announcements())
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c bulletin
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	m := []*game.Manager{s.Manager}
+	if len(c.Name) > 0 {
+		g, ok := s.games[strings.ToLower(c.Name)]
+		if !ok {
+			fail(w, `game "`+c.Name+`" does not exist`, http.StatusNotFound)
+			return
+		}
+		m = []*game.Manager{g}
+	} else {
+		for _, g := range s.games {
+			m = append(m, g)
+		}
+	}
+	switch strings.ToLower(c.Action) {
+	case "", "post":
+	case "withdraw":
+		// Announcement IDs are different on each node of the cluster, so relayed
+		// requests only withdraw every Announcement.
+		if _, ok := r.Context().Value(clusterKey{}).(string); ok && c.ID > 0 {
+			return
+		}
+		var ok bool
+		for _, g := range m {
+			if g.Withdraw(c.ID) {
+				ok = true
+			}
+		}
+		if !ok && c.ID > 0 {
+			fail(w, "announcement "+strconv.FormatUint(c.ID, 10)+" is not shown", http.StatusNotFound)
+			return
+		}
+		s.log.request(r).Info(`Admin "%s" withdrew announcement %d.`, r.RemoteAddr, c.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Announcements())
+		return
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	if c.Text = strings.TrimSpace(c.Text); len(c.Text) == 0 {
+		fail(w, "announcement text is required", http.StatusBadRequest)
+		return
+	}
+	d := time.Minute
+	if len(c.Duration) > 0 {
+		var err error
+		if d, err = time.ParseDuration(c.Duration); err != nil || d <= 0 {
+			fail(w, "duration must be a positive duration", http.StatusBadRequest)
+			return
+		}
+	}
+	a := game.Announcement{
+		Until:      time.Now().Add(d),
+		Title:      strings.TrimSpace(c.Title),
+		Text:       c.Text,
+		Ticker:     c.Ticker,
+		Fullscreen: c.Fullscreen,
+	}
+	for i, g := range m {
+		if i == 0 {
+			a = g.Post(a)
+			continue
+		}
+		g.Post(a)
+	}
+	s.log.request(r).Info(`Admin "%s" posted announcement %d for %s.`, r.RemoteAddr, a.ID, d.String())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// Announcements returns the Announcements shown on the main source and every game,
+// ordered by ID. An Announcement posted to every game is only listed once.
+func (s *Scoreboard) Announcements() []game.Announcement {
+	var (
+		r = s.Manager.Announcements()
+		k = make(map[uint64]struct{}, len(r))
+	)
+	for i := range r {
+		k[r[i].ID] = struct{}{}
+	}
+	for _, m := range s.games {
+		for _, a := range m.Announcements() {
+			if _, ok := k[a.ID]; ok {
+				continue
+			}
+			k[a.ID] = struct{}{}
+			r = append(r, a)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	return r
+}
+func (s *Scoreboard) control(w http.ResponseWriter, r *http.Request, c *control) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
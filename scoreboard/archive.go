@@ -0,0 +1,397 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// archiveOut is the default path of the archive bundle.
+const archiveOut = "archive.tar.gz"
+
+// archived lists the contents of an archive bundle, written to "manifest.json".
+type archived struct {
+	Created time.Time `json:"created"`
+	Version string    `json:"version"`
+	Files   []string  `json:"files"`
+	Games   []uint64  `json:"games"`
+}
+
+// bundle is an archive bundle that is being written.
+type bundle struct {
+	w *tar.Writer
+	t time.Time
+	m archived
+}
+
+// archive writes the history of the Games to a single gzip compressed tar file, for
+// the records and statistics after the event. The bundle has the score and event
+// tables of the history store, and the SQLite database itself, with the final
+// standings, event log and ticker of each Game and the audit lines of the log file.
+// API keys are never added. A Game ID of zero archives every Game in the history.
+func (c *config) archive(g uint64, o string) error {
+	if len(c.History.Source) == 0 {
+		return &errval{s: "archiving requires a history source"}
+	}
+	if len(o) == 0 {
+		o = archiveOut
+	}
+	h, err := newHistory(c.History, time.Duration(c.Timeout)*time.Second, logx.NOP)
+	if err != nil {
+		return err
+	}
+	defer h.close()
+	f, err := os.OpenFile(o, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return &errval{s: `unable to create archive "` + o + `"`, e: err}
+	}
+	var (
+		z = gzip.NewWriter(f)
+		b = &bundle{w: tar.NewWriter(z), t: time.Now().UTC(), m: archived{Version: version, Files: []string{}}}
+	)
+	b.m.Created = b.t
+	if err = c.pack(context.Background(), h, b, g); err == nil {
+		if err = b.w.Close(); err == nil {
+			err = z.Close()
+		}
+	}
+	if x := f.Close(); err == nil {
+		err = x
+	}
+	if err != nil {
+		os.Remove(o)
+		return &errval{s: `unable to write archive "` + o + `"`, e: err}
+	}
+	os.Stdout.WriteString("Archived " + strconv.Itoa(len(b.m.Games)) + " Games and " + strconv.Itoa(len(b.m.Files)) + " files to \"" + o + "\".\n")
+	return nil
+}
+func (c *config) pack(x context.Context, h *history, b *bundle, g uint64) error {
+	v, err := h.games(x, g)
+	if err != nil {
+		return err
+	}
+	if len(v) == 0 {
+		return &errval{s: "the history has no games to archive"}
+	}
+	if b.m.Games = v; h.sqlite {
+		if err = h.copy(x, b); err != nil {
+			return err
+		}
+	}
+	for _, t := range [...]string{"scores", "events", "checks"} {
+		if err = h.dump(x, b, t, g); err != nil {
+			return err
+		}
+	}
+	for _, i := range v {
+		if err = h.pack(x, b, i); err != nil {
+			return err
+		}
+	}
+	if len(c.Log.File) > 0 {
+		if err = b.audit(c.Log.File, c.Log.Files); err != nil {
+			return err
+		}
+	} else {
+		os.Stderr.WriteString("Warning: no log file is set, the audit log is not archived.\n")
+	}
+	d, err := json.MarshalIndent(b.m, "", "    ")
+	if err != nil {
+		return err
+	}
+	return b.add("manifest.json", d)
+}
+
+// add writes the file to the bundle.
+func (b *bundle) add(n string, d []byte) error {
+	if err := b.w.WriteHeader(&tar.Header{Name: n, Mode: 0640, Size: int64(len(d)), ModTime: b.t, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := b.w.Write(d); err != nil {
+		return err
+	}
+	b.m.Files = append(b.m.Files, n)
+	return nil
+}
+func (b *bundle) json(n string, v interface{}) error {
+	d, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return b.add(n, append(d, '\n'))
+}
+
+// games returns the IDs of the Games in the history, or only the supplied Game if it
+// is in the history.
+func (h *history) games(x context.Context, g uint64) ([]uint64, error) {
+	q := "SELECT game FROM scores UNION SELECT game FROM events ORDER BY game"
+	if g > 0 {
+		q = "SELECT game FROM scores WHERE game = " + h.binds[0] + " UNION SELECT game FROM events WHERE game = " + h.binds[1] + " ORDER BY game"
+	}
+	var a []interface{}
+	if g > 0 {
+		a = []interface{}{int64(g), int64(g)}
+	}
+	r, err := h.db.QueryContext(x, q, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var o []uint64
+	for r.Next() {
+		var i int64
+		if err = r.Scan(&i); err != nil {
+			return nil, err
+		}
+		o = append(o, uint64(i))
+	}
+	return o, r.Err()
+}
+
+// copy adds a copy of the SQLite history database, without the API keys.
+func (h *history) copy(x context.Context, b *bundle) error {
+	d, err := os.MkdirTemp("", "scoreboard-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "history.db")
+	if _, err = h.db.ExecContext(x, "VACUUM INTO ?", p); err != nil {
+		return &errval{s: "unable to copy the history database", e: err}
+	}
+	v, err := sql.Open("sqlite", p)
+	if err != nil {
+		return &errval{s: "unable to open the history database copy", e: err}
+	}
+	if _, err = v.ExecContext(x, "DELETE FROM api_keys"); err == nil {
+		_, err = v.ExecContext(x, "VACUUM")
+	}
+	if v.Close(); err != nil {
+		return &errval{s: "unable to remove the API keys from the history database copy", e: err}
+	}
+	f, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return b.add("history.db", f)
+}
+
+// dump adds the history table as a CSV file, with the column names as the header.
+func (h *history) dump(x context.Context, b *bundle, t string, g uint64) error {
+	var (
+		q = "SELECT * FROM " + t
+		a []interface{}
+	)
+	if g > 0 {
+		q, a = q+" WHERE game = "+h.binds[0], []interface{}{int64(g)}
+	}
+	r, err := h.db.QueryContext(x, q, a...)
+	if err != nil {
+		return &errval{s: `unable to read the history table "` + t + `"`, e: err}
+	}
+	defer r.Close()
+	n, err := r.Columns()
+	if err != nil {
+		return err
+	}
+	var (
+		o bytes.Buffer
+		w = csv.NewWriter(&o)
+		v = make([]sql.NullString, len(n))
+		p = make([]interface{}, len(n))
+		l = make([]string, len(n))
+	)
+	for i := range v {
+		p[i] = &v[i]
+	}
+	w.Write(n)
+	for r.Next() {
+		if err = r.Scan(p...); err != nil {
+			return err
+		}
+		for i := range v {
+			l[i] = v[i].String
+		}
+		w.Write(l)
+	}
+	if err = r.Err(); err != nil {
+		return err
+	}
+	if w.Flush(); w.Error() != nil {
+		return w.Error()
+	}
+	return b.add("history/"+t+".csv", o.Bytes())
+}
+
+// pack adds the final standings, event log and ticker of the Game. The final standings
+// are the last recorded score of each team.
+func (h *history) pack(x context.Context, b *bundle, g uint64) error {
+	e, err := h.journal(x, g, b.t)
+	if err != nil {
+		return &errval{s: "unable to read the events of Game " + strconv.FormatUint(g, 10), e: err}
+	}
+	v, err := h.final(x, g)
+	if err != nil {
+		return &errval{s: "unable to read the standings of Game " + strconv.FormatUint(g, 10), e: err}
+	}
+	var (
+		p = "games/" + strconv.FormatUint(g, 10) + "/"
+		t = make([]logged, 0, len(e))
+	)
+	for i := range e {
+		if len(v.Game) == 0 && len(e[i].Data) > 0 {
+			var c struct {
+				Game string `json:"game"`
+			}
+			if json.Unmarshal(e[i].Data, &c) == nil {
+				v.Game = c.Game
+			}
+		}
+		// Score, attack and stale Source changes are never added to the ticker.
+		switch e[i].Kind {
+		case "score", "attack", "source_stale":
+		default:
+			t = append(t, logged{Time: e[i].Time, Kind: e[i].Kind, Text: e[i].Text, TeamID: e[i].TeamID})
+		}
+	}
+	if err = b.json(p+"events.json", journalExport{Exported: b.t, Game: v.Game, GameID: g, Events: e}); err != nil {
+		return err
+	}
+	if err = b.json(p+"ticker.json", t); err != nil {
+		return err
+	}
+	if err = b.json(p+"standings.json", v); err != nil {
+		return err
+	}
+	var (
+		o bytes.Buffer
+		w = csv.NewWriter(&o)
+	)
+	w.Write([]string{"rank", "team_id", "team", "score", "health"})
+	for _, s := range v.Teams {
+		w.Write([]string{
+			strconv.FormatInt(s.Rank, 10), strconv.FormatUint(s.ID, 10), s.Name,
+			strconv.FormatInt(s.Score, 10), strconv.FormatInt(s.Health, 10),
+		})
+	}
+	if w.Flush(); w.Error() != nil {
+		return w.Error()
+	}
+	return b.add(p+"standings.csv", o.Bytes())
+}
+
+// final returns the last recorded standings of the Game, ordered by rank.
+func (h *history) final(x context.Context, g uint64) (game.Snapshot, error) {
+	v := game.Snapshot{GameID: g, Teams: make([]game.Standing, 0)}
+	r, err := h.db.QueryContext(x,
+		"SELECT team, name, score, health, rank, time FROM scores AS s WHERE game = "+h.binds[0]+" AND time = "+
+			"(SELECT MAX(time) FROM scores AS n WHERE n.game = s.game AND n.team = s.team) ORDER BY rank, team", int64(g),
+	)
+	if err != nil {
+		return v, err
+	}
+	defer r.Close()
+	for r.Next() {
+		var (
+			s game.Standing
+			t int64
+		)
+		if err = r.Scan(&s.ID, &s.Name, &s.Score, &s.Health, &s.Rank, &t); err != nil {
+			return v, err
+		}
+		if n := time.UnixMilli(t).UTC(); n.After(v.Time) {
+			v.Time = n
+		}
+		v.Teams = append(v.Teams, s)
+	}
+	return v, r.Err()
+}
+
+// audit adds the admin and approval lines of the log file, and its rotated files, as
+// "audit.log", the oldest first. Missing files are skipped.
+func (b *bundle) audit(p string, k int) error {
+	var o bytes.Buffer
+	for i := k; i >= 0; i-- {
+		n := p
+		if i > 0 {
+			n = p + "." + strconv.Itoa(i)
+		}
+		f, err := os.Open(n)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return &errval{s: `unable to read log file "` + n + `"`, e: err}
+		}
+		s := bufio.NewScanner(f)
+		s.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for s.Scan() {
+			if l := s.Text(); audited(l) {
+				o.WriteString(l)
+				o.WriteByte('\n')
+			}
+		}
+		if f.Close(); s.Err() != nil {
+			return &errval{s: `unable to read log file "` + n + `"`, e: s.Err()}
+		}
+	}
+	return b.add("audit.log", o.Bytes())
+}
+
+// audited returns true if the log line, in the console or JSON format, was written by
+// the approvals or by an admin request.
+func audited(l string) bool {
+	if strings.HasPrefix(l, "{") {
+		var e entry
+		if json.Unmarshal([]byte(l), &e) != nil {
+			return false
+		}
+		return e.Component == "audit" || strings.HasPrefix(e.Message, `Admin "`)
+	}
+	i := strings.IndexByte(l, ']')
+	if i < 0 {
+		return false
+	}
+	v := l[i+1:]
+	j := strings.Index(v, ": ")
+	if j < 0 {
+		return false
+	}
+	c := strings.TrimSpace(v[:j])
+	if k := strings.IndexByte(c, ' '); k >= 0 {
+		c = c[:k]
+	}
+	if k := strings.LastIndexByte(c, '/'); k >= 0 {
+		c = c[k+1:]
+	}
+	return c == "audit" || strings.HasPrefix(v[j+2:], `Admin "`)
+}
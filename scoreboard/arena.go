@@ -0,0 +1,225 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+type arena struct {
+	Sort   *ranking `json:"sort,omitempty"`
+	Name   string   `json:"name"`
+	Source source   `json:"source"`
+	Tick   int      `json:"tick"`
+}
+
+func (a *arena) verify(t int) error {
+	if len(a.Name) == 0 {
+		return &errval{s: "game names cannot be empty"}
+	}
+	if a.Name = strings.ToLower(a.Name); strings.Trim(a.Name, "abcdefghijklmnopqrstuvwxyz0123456789-_") != "" {
+		return &errval{s: `game name "` + a.Name + `" can only contain letters, numbers, dashes and underscores`}
+	}
+	if len(a.Source.Type) == 0 {
+		return &errval{s: `game "` + a.Name + `" requires a source`}
+	}
+	if a.Tick < 0 {
+		return &errval{s: `game "` + a.Name + `" tick ` + strconv.Itoa(a.Tick) + " cannot be less than zero"}
+	}
+	if a.Tick == 0 {
+		a.Tick = t
+	}
+	if v := a.Source.interval(a.Tick); v <= 0 {
+		return &errval{s: `game "` + a.Name + `" source interval ` + strconv.Itoa(v) + " cannot be less than or equal to zero"}
+	}
+	if v := a.Source.watchdog(); v < 0 {
+		return &errval{s: `game "` + a.Name + `" source watchdog ` + strconv.Itoa(v) + " cannot be less than zero"}
+	}
+	if _, _, err := a.Source.skew(); err != nil {
+		return &errval{s: `game "` + a.Name + `" has an invalid source skew`, e: err}
+	}
+	if _, err := a.Source.lanes(); err != nil {
+		return &errval{s: `game "` + a.Name + `" has an invalid source lane`, e: err}
+	}
+	if a.Sort != nil {
+		return a.Sort.verify()
+	}
+	return nil
+}
+func (s *Scoreboard) arenas(c *config, t time.Duration) error {
+	if len(c.Games) == 0 {
+		return nil
+	}
+	s.games = make(map[string]*game.Manager, len(c.Games))
+	s.routes = make(map[string]string, len(c.Games))
+	for i := range c.Games {
+		if _, ok := s.games[c.Games[i].Name]; ok {
+			return &errval{s: `game name "` + c.Games[i].Name + `" is used more than once`}
+		}
+		m, err := game.New(c.Games[i].Source.Type, c.Games[i].Source.raw, c.Assets, time.Duration(c.Games[i].Source.interval(c.Games[i].Tick))*time.Second, t, s.log.with("game."+c.Games[i].Name))
+		if err != nil {
+			return &errval{s: `unable to setup game "` + c.Games[i].Name + `"`, e: err}
+		}
+		if err = m.Proxy(c.proxy(c.Games[i].Source)); err != nil {
+			return &errval{s: `invalid proxy config for game "` + c.Games[i].Name + `"`, e: err}
+		}
+		m.Breaker(c.Retry.Attempts, c.Retry.Threshold, time.Duration(c.Retry.Cooldown)*time.Second)
+		m.Workers(c.Workers)
+		m.Milestone(c.milestone())
+		m.Limit(c.Memory.Tweets, c.Memory.Events)
+		m.TeamLimit(c.Memory.Teams)
+		m.Divisions(c.Divisions)
+		m.Effects(c.Effects.kinds())
+		m.Pacing(c.Pacing.Rate, c.Pacing.Collapse)
+		m.Locate(s.locate)
+		m.Warnings(c.Clock.warnings())
+		m.Breaks(c.Clock.breaks())
+		m.Adapt(c.Clock.pacing())
+		m.Watchdog(time.Duration(c.Games[i].Source.watchdog()) * time.Second)
+		a, d, _ := c.Games[i].Source.skew()
+		m.Correct(a, d)
+		l, _ := c.Games[i].Source.lanes()
+		m.Lanes(l)
+		m.Chaos(c.Debug.rates())
+		o := c.Sort
+		if c.Games[i].Sort != nil {
+			o = *c.Games[i].Sort
+		}
+		if err = m.Order(o.Keys, o.Ties == "split"); err != nil {
+			return &errval{s: `unable to set the sort policy of game "` + c.Games[i].Name + `"`, e: err}
+		}
+		if err = m.Anonymize(c.Anonymize); err != nil {
+			return &errval{s: `unable to set the anonymize mode of game "` + c.Games[i].Name + `"`, e: err}
+		}
+		if s.album != nil {
+			m.Logos(s.album.resolve)
+		}
+		if c.Finale.Enabled {
+			if m.Finale(true, c.Finale.Freeze); c.Finale.Podium {
+				m.Hook(s.curtain(c.Games[i].Name))
+			}
+		}
+		if len(s.hooks) > 0 {
+			m.Hook(s.dispatch)
+		}
+		for _, d := range s.digests {
+			if d.Game == c.Games[i].Name {
+				d.attach(m)
+			}
+		}
+		if len(s.execs) > 0 {
+			m.Hook(s.execute)
+		}
+		if s.script != nil {
+			m.Announce(s.script.change)
+		}
+		if s.mqtt != nil {
+			m.Hook(s.mqtt.change)
+			m.Watch(s.mqtt.snapshot)
+		}
+		if s.bus != nil {
+			m.Hook(s.bus.change)
+			m.Listen(s.bus.message)
+		}
+		if s.streams != nil {
+			s.streams.attach(m)
+		}
+		if s.trace != nil {
+			m.Trace(s.trace.trace(c.Games[i].Name))
+		}
+		if s.report != nil {
+			m.Report(s.report.game(c.Games[i].Name))
+		}
+		if s.cluster != nil {
+			m.Leader(s.cluster.leading)
+			if err = m.Share(s.cluster.store(c.Games[i].Name), time.Duration(c.State.Interval)*time.Second); err != nil {
+				return &errval{s: `unable to restore the state of game "` + c.Games[i].Name + `"`, e: err}
+			}
+		}
+		s.games[c.Games[i].Name], s.routes[c.Games[i].Name] = m, c.Games[i].Name
+		s.log.Debug(`Added game "%s" using the "%s" source.`, c.Games[i].Name, c.Games[i].Source.Type)
+	}
+	return nil
+}
+
+// arena returns the Manager of the game that the named display route shows.
+func (s *Scoreboard) arena(n string) *game.Manager {
+	s.swap.RLock()
+	v, ok := s.routes[strings.ToLower(n)]
+	s.swap.RUnlock()
+	if !ok {
+		return nil
+	}
+	return s.games[v]
+}
+func (s *Scoreboard) httpSwitch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c struct {
+		Route string `json:"route"`
+		Game  string `json:"game"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	c.Route, c.Game = strings.ToLower(c.Route), strings.ToLower(c.Game)
+	m, ok := s.games[c.Game]
+	if !ok {
+		fail(w, `game "`+c.Game+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	s.swap.Lock()
+	o, ok := s.routes[c.Route]
+	if ok {
+		s.routes[c.Route] = c.Game
+	}
+	s.swap.Unlock()
+	if !ok {
+		fail(w, `route "`+c.Route+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	if o != c.Game {
+		p := s.games[o]
+		p.Transition(current(p))
+	}
+	s.log.request(r).Info(`Admin "%s" switched route "%s" from game "%s" to game "%s".`, r.RemoteAddr, c.Route, o, c.Game)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"route": c.Route, "game": c.Game, "id": current(m)})
+}
+
+// current returns the ID of the Game a named game route shows, which is the first
+// active Game of the route source.
+func current(m *game.Manager) uint64 {
+	for i := range m.Games {
+		if m.Games[i].Active() {
+			return m.Games[i].ID
+		}
+	}
+	if len(m.Games) > 0 {
+		return m.Games[0].ID
+	}
+	return 0
+}
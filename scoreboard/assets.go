@@ -0,0 +1,264 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// assetMax is the largest file that is kept in memory, larger files are served from
+// the file system without compression.
+const assetMax = 16 << 20
+
+// assetHash is the length of the content hash added to asset file names.
+const assetHash = 12
+
+type asset struct {
+	mod    time.Time
+	data   []byte
+	gzip   []byte
+	brotli []byte
+	hash   string
+	size   int64
+	seen   int64
+}
+type assets struct {
+	version uint64
+	evicted uint64
+	fs      fs.FS
+	files   map[string]*asset
+	used    int64
+	limit   int64
+	lock    sync.Mutex
+}
+
+// compressible returns true if the file type is worth compressing, which excludes image
+// formats that are already compressed.
+func compressible(n string) bool {
+	switch strings.ToLower(path.Ext(n)) {
+	case ".js", ".css", ".html", ".htm", ".svg", ".json", ".txt", ".map", ".ttf", ".otf", ".eot", ".ico", ".xml":
+		return true
+	}
+	return false
+}
+
+// hashed returns the name of the file without the content hash, if the name has one,
+// such as "script/scoreboard.js" for "script/scoreboard.0123456789ab.js".
+func hashed(n string) (string, string, bool) {
+	var (
+		d, f = path.Split(n)
+		e    = path.Ext(f)
+		b    = strings.TrimSuffix(f, e)
+		i    = strings.LastIndexByte(b, '.')
+	)
+	if i < 0 || len(b)-i-1 != assetHash {
+		return n, "", false
+	}
+	if _, err := hex.DecodeString(b[i+1:]); err != nil {
+		return n, "", false
+	}
+	return d + b[:i] + e, b[i+1:], true
+}
+
+// get returns the asset with the name, which is loaded again if the file has changed.
+// A nil asset without an error is returned for directories and files too large to be
+// kept in memory.
+func (a *assets) get(n string) (*asset, error) {
+	f, err := a.fs.Open(n)
+	if err != nil {
+		return nil, err
+	}
+	i, err := f.Stat()
+	if err != nil || i.IsDir() || i.Size() > assetMax {
+		f.Close()
+		return nil, err
+	}
+	a.lock.Lock()
+	p, ok := a.files[n]
+	if ok && p.size == i.Size() && p.mod.Equal(i.ModTime()) {
+		p.seen = time.Now().UnixNano()
+		a.lock.Unlock()
+		f.Close()
+		return p, nil
+	}
+	a.lock.Unlock()
+	b, err := io.ReadAll(f)
+	if f.Close(); err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	v := &asset{mod: i.ModTime(), data: b, hash: hex.EncodeToString(h[:])[:assetHash], size: i.Size(), seen: time.Now().UnixNano()}
+	// Files compressed ahead of time, such as with "brotli -k" or "gzip -k", are used
+	// instead of compressing the file here, which is also the only way to serve Brotli
+	// as there is no Brotli encoder in the standard library.
+	if c, err := fs.ReadFile(a.fs, n+".br"); err == nil {
+		v.brotli = c
+	}
+	if c, err := fs.ReadFile(a.fs, n+".gz"); err == nil {
+		v.gzip = c
+	} else if compressible(n) && len(b) >= compressMin {
+		var o bytes.Buffer
+		z, _ := gzip.NewWriterLevel(&o, gzip.BestCompression)
+		z.Write(b)
+		if z.Close(); o.Len() < len(b) {
+			v.gzip = o.Bytes()
+		}
+	}
+	// Changed files change the links in the rendered pages, so the version is used to
+	// render them again.
+	if ok && p.hash != v.hash {
+		atomic.AddUint64(&a.version, 1)
+	}
+	a.lock.Lock()
+	if o, ok := a.files[n]; ok {
+		a.used -= o.cost()
+	}
+	a.files[n], a.used = v, a.used+v.cost()
+	a.evict(n)
+	a.lock.Unlock()
+	return v, nil
+}
+func (a *asset) cost() int64 {
+	return int64(len(a.data) + len(a.gzip) + len(a.brotli))
+}
+
+// evict removes the least recently used files, other than the named file, until the
+// files kept in memory are under the limit. Removed files are loaded again when they
+// are next requested. The lock must be held when this is called.
+func (a *assets) evict(n string) {
+	for a.limit > 0 && a.used > a.limit {
+		var (
+			k string
+			o *asset
+		)
+		for x, v := range a.files {
+			if x != n && (o == nil || v.seen < o.seen) {
+				k, o = x, v
+			}
+		}
+		if o == nil {
+			return
+		}
+		delete(a.files, k)
+		a.used -= o.cost()
+		atomic.AddUint64(&a.evicted, 1)
+	}
+}
+
+// cached returns the amount of bytes of the files kept in memory and the amount of files
+// removed to keep under the limit.
+func (a *assets) cached() (int64, uint64) {
+	a.lock.Lock()
+	n := a.used
+	a.lock.Unlock()
+	return n, atomic.LoadUint64(&a.evicted)
+}
+
+// path returns the name of the file with its content hash, which is used in templates
+// so browsers can cache the file forever and still get a changed file straight away.
+func (a *assets) path(n string) string {
+	v, err := a.get(n)
+	if err != nil || v == nil {
+		return n
+	}
+	e := path.Ext(n)
+	return strings.TrimSuffix(n, e) + "." + v.hash + e
+}
+
+// accepts returns true if the Accept-Encoding header includes the encoding without a
+// zero quality value.
+func accepts(h, e string) bool {
+	for _, v := range strings.Split(h, ",") {
+		t := strings.TrimSpace(v)
+		q := ""
+		if i := strings.IndexByte(t, ';'); i >= 0 {
+			t, q = strings.TrimSpace(t[:i]), strings.ReplaceAll(t[i+1:], " ", "")
+		}
+		if strings.EqualFold(t, e) {
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
+}
+
+// httpStatic serves the static files of the scoreboard. Files requested with their
+// content hash are cached by browsers forever, and other files are checked with their
+// ETag each time they are used. Files are sent compressed with Brotli or gzip when
+// the browser supports it.
+func (s *Scoreboard) httpStatic(w http.ResponseWriter, r *http.Request) {
+	var (
+		k      bool
+		n      = strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		v, err = s.static.get(n)
+	)
+	if err != nil {
+		if x, t, ok := hashed(n); ok {
+			// A file requested with an old hash is sent with the current content, but it
+			// is not cached forever.
+			if v, err = s.static.get(x); err == nil {
+				n, r.URL.Path, k = x, "/"+x, v != nil && v.hash == t
+			}
+		}
+	}
+	if err != nil || v == nil {
+		s.fs.ServeHTTP(w, r)
+		return
+	}
+	t := `"` + v.hash + `"`
+	w.Header().Set("ETag", t)
+	w.Header().Set("Vary", "Accept-Encoding")
+	if k {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if m := r.Header.Get("If-None-Match"); len(m) > 0 && strings.Contains(m, t) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c := mime.TypeByExtension(path.Ext(n))
+	if len(c) == 0 {
+		c = http.DetectContentType(v.data)
+	}
+	w.Header().Set("Content-Type", c)
+	b, e := v.data, r.Header.Get("Accept-Encoding")
+	switch {
+	case v.brotli != nil && accepts(e, "br"):
+		b = v.brotli
+		w.Header().Set("Content-Encoding", "br")
+	case v.gzip != nil && accepts(e, "gzip"):
+		b = v.gzip
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if r.Method != http.MethodHead {
+		w.Write(b)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// positions is the place of teams on the attack map, by team name or ID. Each position
+// is the horizontal and vertical place of the team, between zero and one, from the top
+// left corner of the map.
+type positions map[string][2]float64
+
+func (p positions) verify() error {
+	for k, v := range p {
+		if len(k) == 0 {
+			return &errval{s: "team position names cannot be empty"}
+		}
+		if v[0] < 0 || v[0] > 1 || v[1] < 0 || v[1] > 1 {
+			return &errval{s: `team "` + k + `" position must be between 0 and 1`}
+		}
+	}
+	return nil
+}
+
+// find returns the position of the team by the team ID or name.
+func (p positions) find(i uint64, n string) ([2]float64, bool) {
+	if v, ok := p[strconv.FormatUint(i, 10)]; ok {
+		return v, true
+	}
+	for k, v := range p {
+		if strings.EqualFold(k, n) {
+			return v, true
+		}
+	}
+	return [2]float64{}, false
+}
+
+// locate returns the attack map position of a team, which is used by every Game.
+func (s *Scoreboard) locate(i uint64, n string) (float64, float64, bool) {
+	s.swap.RLock()
+	v, ok := s.places.find(i, n)
+	s.swap.RUnlock()
+	return v[0], v[1], ok
+}
+
+// httpAttacks returns the attack map positions of the teams in the Game. The attacks
+// are sent to the displays of the Game as "attack" changes.
+func (s *Scoreboard) httpAttacks(w http.ResponseWriter, r *http.Request) {
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	v, ok := m.Chart(g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if m.Anonymous() && !s.permitted(r, true, scopeScores) {
+		t := make([]uint64, len(v.Teams))
+		for i := range v.Teams {
+			t[i] = v.Teams[i].ID
+		}
+		p, o := m.Pseudonyms(t), make([]game.Node, len(v.Teams))
+		for i := range v.Teams {
+			o[i] = v.Teams[i]
+			o[i].Name = p[v.Teams[i].ID]
+		}
+		v.Teams = o
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+// httpAttackMap returns the attack map view of the Game in the path, which is a Game ID
+// or the name of a named game, or the current Game if the path is empty. The view shows
+// the attacks sent to the displays of the Game.
+func (s *Scoreboard) httpAttackMap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		v uint64
+		o string
+		n = strings.Trim(strings.TrimPrefix(r.URL.Path, "/attacks"), "/")
+	)
+	switch x, err := strconv.ParseUint(n, 10, 64); {
+	case len(n) == 0:
+		v = current(s.Manager)
+	case err == nil:
+		v = x
+	default:
+		if m := s.arena(n); m != nil {
+			v, o = current(m), strings.ToLower(n)
+		}
+	}
+	if v == 0 {
+		http.Error(w, "game does not exist or is not active", http.StatusNotFound)
+		return
+	}
+	l := s.language(r)
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", l)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	d := &display{Game: v, Route: o, Lang: l, Zone: s.timezone(r).String(), Text: s.locales[l], Access: accessible(r)}
+	if err := s.render(w, r, "attacks.html", d.key(), d); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.web.request(r).Error(`Error during request from "%s": %s!`, r.RemoteAddr, err.Error())
+	}
+}
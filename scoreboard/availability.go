@@ -0,0 +1,223 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// availability is the percentage of time that the services of each team were up, as
+// recorded in the history store. The teams are sorted by their SLA, the highest first,
+// and the Services of each team are in the same order as the service names. Services
+// that a team does not have are -1.
+type availability struct {
+	Services []string     `json:"services"`
+	Teams    []*available `json:"teams"`
+	Game     uint64       `json:"game"`
+}
+
+// late is the service checks of each Game that were sampled after the Game was frozen,
+// by team and service. They are taken out of the availability shown to public clients
+// until the Game is unfrozen, as the store only keeps the totals of each service.
+type late struct {
+	sync.Mutex
+	at     map[uint64]time.Time
+	checks map[uint64]map[uint64]map[string][2]int64
+}
+type available struct {
+	Name     string    `json:"name"`
+	Services []float64 `json:"services"`
+	ID       uint64    `json:"id"`
+	SLA      float64   `json:"sla"`
+	up       int64
+	total    int64
+}
+
+func percent(u, t int64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return math.Round(float64(u)*1000/float64(t)) / 10
+}
+
+// monitor records the Checks in the history store, and keeps the Checks sampled after
+// the freeze of a frozen Game.
+func (s *Scoreboard) monitor(c game.Checks) {
+	s.store.checks(c)
+	f, ok := held(s.Manager, c.GameID)
+	s.late.Lock()
+	if !ok || c.Time.Before(f) {
+		delete(s.late.at, c.GameID)
+		delete(s.late.checks, c.GameID)
+		s.late.Unlock()
+		return
+	}
+	if s.late.at == nil {
+		s.late.at, s.late.checks = make(map[uint64]time.Time), make(map[uint64]map[uint64]map[string][2]int64)
+	}
+	v := s.late.checks[c.GameID]
+	if v == nil || !s.late.at[c.GameID].Equal(f) {
+		v, s.late.at[c.GameID] = make(map[uint64]map[string][2]int64), f
+		s.late.checks[c.GameID] = v
+	}
+	for _, k := range c.Services {
+		if v[k.Team] == nil {
+			v[k.Team] = make(map[string][2]int64)
+		}
+		o := v[k.Team][k.Service]
+		v[k.Team][k.Service] = [2]int64{o[0] + k.Up, o[1] + k.Total}
+	}
+	s.late.Unlock()
+}
+
+// frozen returns the checks sampled since the freeze of the Game, or nil if the Game
+// is not frozen.
+func (s *Scoreboard) frozen(g uint64) map[uint64]map[string][2]int64 {
+	f, ok := held(s.Manager, g)
+	if !ok {
+		return nil
+	}
+	s.late.Lock()
+	defer s.late.Unlock()
+	if !s.late.at[g].Equal(f) {
+		return map[uint64]map[string][2]int64{}
+	}
+	r := make(map[uint64]map[string][2]int64, len(s.late.checks[g]))
+	for t, v := range s.late.checks[g] {
+		r[t] = make(map[string][2]int64, len(v))
+		for n, c := range v {
+			r[t][n] = c
+		}
+	}
+	return r
+}
+func (h *history) checks(c game.Checks) {
+	h.push(sample{checks: c.Services, time: c.Time.UnixMilli(), game: c.GameID})
+}
+
+// availability returns the availability of the Game. The checks in l, by team and
+// service, are taken out of the totals of the store, which is used to show the
+// availability of a frozen Game at the time of the freeze.
+func (h *history) availability(x context.Context, g uint64, l map[uint64]map[string][2]int64) (*availability, error) {
+	r, err := h.db.QueryContext(x, h.report, int64(g))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var (
+		v = make(map[uint64]map[string][2]int64)
+		k = make(map[string]struct{})
+		a = &availability{Game: g, Services: make([]string, 0), Teams: make([]*available, 0)}
+		m = make(map[uint64]*available)
+	)
+	for r.Next() {
+		var (
+			t    uint64
+			c, n string
+			u, z int64
+		)
+		if err = r.Scan(&t, &c, &n, &u, &z); err != nil {
+			return nil, err
+		}
+		if v, ok := l[t][c]; ok {
+			u, z = u-v[0], z-v[1]
+		}
+		if z <= 0 {
+			continue
+		}
+		o, ok := m[t]
+		if !ok {
+			o = &available{ID: t}
+			m[t], v[t] = o, make(map[string][2]int64)
+			a.Teams = append(a.Teams, o)
+		}
+		o.Name, o.up, o.total = n, o.up+u, o.total+z
+		v[t][c], k[c] = [2]int64{u, z}, struct{}{}
+	}
+	if err = r.Err(); err != nil {
+		return nil, err
+	}
+	for n := range k {
+		a.Services = append(a.Services, n)
+	}
+	sort.Strings(a.Services)
+	for _, o := range a.Teams {
+		o.SLA, o.Services = percent(o.up, o.total), make([]float64, len(a.Services))
+		for i, n := range a.Services {
+			if c, ok := v[o.ID][n]; ok {
+				o.Services[i] = percent(c[0], c[1])
+			} else {
+				o.Services[i] = -1
+			}
+		}
+	}
+	sort.SliceStable(a.Teams, func(i, j int) bool {
+		if a.Teams[i].SLA != a.Teams[j].SLA {
+			return a.Teams[i].SLA > a.Teams[j].SLA
+		}
+		return a.Teams[i].Name < a.Teams[j].Name
+	})
+	return a, nil
+}
+
+// httpAvailability returns the availability leaderboard of the Game, which is the SLA
+// of each team and service since the history store started recording the Game.
+func (s *Scoreboard) httpAvailability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	g, err := strconv.ParseUint(r.URL.Query().Get("game"), 10, 64)
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	// The availability of a frozen Game is shown as it was at the time of the freeze,
+	// unless the request has the admin token.
+	var l map[uint64]map[string][2]int64
+	if !s.permitted(r, true, scopeScores) {
+		l = s.frozen(g)
+	}
+	a, err := s.store.availability(r.Context(), g, l)
+	if err != nil {
+		fail(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log.request(r).Error(`Error reading availability for "%s": %s!`, r.RemoteAddr, err.Error())
+		return
+	}
+	if s.Anonymous() && !s.permitted(r, true, scopeScores) {
+		v := make([]uint64, len(a.Teams))
+		for i := range a.Teams {
+			v[i] = a.Teams[i].ID
+		}
+		p := s.Pseudonyms(v)
+		for i := range a.Teams {
+			a.Teams[i].Name = p[a.Teams[i].ID]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(a)
+}
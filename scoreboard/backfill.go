@@ -0,0 +1,293 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// backfill adds the records in each file to the history store, so Games that ran before
+// the Scoreboard was recording, or during an outage, can be replayed and graphed. Files
+// ending in ".csv" are score dumps and any other files are event logs exported by the
+// "/api/v1/export/events.json" endpoint. The Game ID replaces the ID in the files.
+func (c *config) backfill(g uint64, f []string) error {
+	if len(c.History.Source) == 0 {
+		return &errval{s: "importing requires a history source"}
+	}
+	if len(f) == 0 {
+		return &errval{s: "no files to import"}
+	}
+	t := time.Duration(c.Timeout) * time.Second
+	h, err := newHistory(c.History, t, logx.NOP)
+	if err != nil {
+		return err
+	}
+	defer h.close()
+	for _, n := range f {
+		var (
+			i uint64
+			r []sample
+		)
+		if strings.EqualFold(filepath.Ext(n), ".csv") {
+			i, r, err = tabulate(n, g)
+		} else {
+			i, r, err = chronicle(n, g)
+		}
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			return &errval{s: `file "` + n + `" does not have a game ID, one is required`}
+		}
+		x, y := context.WithTimeout(context.Background(), t*time.Duration(1+len(r)/historyBatch))
+		e, s, k, err := h.backfill(x, i, r)
+		if y(); err != nil {
+			return &errval{s: `unable to import file "` + n + `"`, e: err}
+		}
+		os.Stdout.WriteString("Imported " + strconv.Itoa(e) + " events and " + strconv.Itoa(s) + " scores from \"" + n +
+			"\" to Game " + strconv.FormatUint(i, 10) + ", skipped " + strconv.Itoa(k) + " already recorded.\n")
+	}
+	return nil
+}
+
+// backfill writes the samples of the Game in a single transaction, skipping any event
+// or score that is already recorded. This function returns the number of events and
+// scores written and the number of records skipped.
+func (h *history) backfill(x context.Context, g uint64, r []sample) (int, int, int, error) {
+	t, err := h.db.BeginTx(x, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var e, s, k int
+	for i := range r {
+		if r[i].teams == nil {
+			var n int64
+			if err = t.QueryRowContext(x, h.recorded, int64(g), r[i].time, r[i].kind, r[i].text).Scan(&n); err != nil {
+				break
+			}
+			if n > 0 {
+				k++
+				continue
+			}
+			if _, err = t.ExecContext(x, h.events, int64(g), int64(r[i].team), r[i].kind, r[i].text, string(r[i].data), r[i].time); err != nil {
+				break
+			}
+			e++
+			continue
+		}
+		for _, v := range r[i].teams {
+			var n int64
+			if err = t.QueryRowContext(x, h.sampled, int64(g), int64(v.ID), r[i].time).Scan(&n); err != nil {
+				break
+			}
+			if n > 0 {
+				k++
+				continue
+			}
+			if _, err = t.ExecContext(x, h.scores, int64(g), int64(v.ID), v.Name, v.Score, v.Health, v.Rank, r[i].time); err != nil {
+				break
+			}
+			s++
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Rollback()
+		return 0, 0, 0, err
+	}
+	return e, s, k, t.Commit()
+}
+
+// chronicle reads an exported event log. The scores of the teams are rebuilt from the
+// data of the score and adjustment events, which are missing from logs exported while
+// team names were anonymized.
+func chronicle(n string, g uint64) (uint64, []sample, error) {
+	b, err := os.ReadFile(n)
+	if err != nil {
+		return 0, nil, &errval{s: `cannot read file "` + n + `"`, e: err}
+	}
+	var v journalExport
+	if err = json.Unmarshal(b, &v); err != nil {
+		return 0, nil, &errval{s: `cannot parse event log "` + n + `"`, e: err}
+	}
+	if g == 0 {
+		g = v.GameID
+	}
+	var (
+		r = make([]sample, 0, len(v.Events))
+		p = make(map[uint64]game.Standing)
+		q = -1
+	)
+	sort.SliceStable(v.Events, func(i, j int) bool { return v.Events[i].Time.Before(v.Events[j].Time) })
+	for _, e := range v.Events {
+		r = append(r, sample{data: e.Data, kind: e.Kind, text: e.Text, time: e.Time.UnixMilli(), team: e.TeamID})
+		if (e.Kind != "score" && e.Kind != "adjustment") || len(e.Data) == 0 {
+			continue
+		}
+		var c struct {
+			Team   string `json:"team"`
+			TeamID uint64 `json:"team_id"`
+			New    int64  `json:"new"`
+		}
+		if json.Unmarshal(e.Data, &c) != nil || c.TeamID == 0 {
+			continue
+		}
+		p[c.TeamID] = game.Standing{ID: c.TeamID, Name: c.Team, Score: c.New}
+		// Every team that scored in the same update has the same time, so only the
+		// standings after the last of them are kept.
+		if s := (sample{teams: ranked(p), time: e.Time.UnixMilli()}); q >= 0 && r[q].time == s.time {
+			r[q] = s
+		} else {
+			q, r = len(r), append(r, s)
+		}
+	}
+	return g, r, nil
+}
+
+// tabulate reads a CSV score dump, such as the scores table of a scoring engine database.
+// The first row names the columns, which are "time" (RFC3339 or Unix milliseconds),
+// "team_id", "team" and "score", and optionally "health", "rank" and "game". Rows with
+// the same time are the standings at that time and are ranked by score if the dump
+// does not have a rank.
+func tabulate(n string, g uint64) (uint64, []sample, error) {
+	f, err := os.Open(n)
+	if err != nil {
+		return 0, nil, &errval{s: `cannot read file "` + n + `"`, e: err}
+	}
+	defer f.Close()
+	var (
+		c = csv.NewReader(f)
+		k = make(map[string]int)
+	)
+	h, err := c.Read()
+	if err != nil {
+		return 0, nil, &errval{s: `cannot read score dump "` + n + `"`, e: err}
+	}
+	for i := range h {
+		k[strings.ToLower(strings.TrimSpace(h[i]))] = i + 1
+	}
+	for _, v := range [...]string{"time", "team_id", "score"} {
+		if k[v] == 0 {
+			return 0, nil, &errval{s: `score dump "` + n + `" is missing the "` + v + `" column`}
+		}
+	}
+	var (
+		r []sample
+		t = make(map[int64]int)
+		o bool
+	)
+	for l := 2; ; l++ {
+		v, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, &errval{s: `cannot read score dump "` + n + `"`, e: err}
+		}
+		get := func(s string) string {
+			if i := k[s]; i > 0 && i <= len(v) {
+				return strings.TrimSpace(v[i-1])
+			}
+			return ""
+		}
+		var (
+			e error
+			d int64
+			s game.Standing
+		)
+		if x := get("time"); len(x) > 0 && strings.Trim(x, "0123456789") == "" {
+			d, e = strconv.ParseInt(x, 10, 64)
+		} else {
+			var z time.Time
+			z, e = time.Parse(time.RFC3339, x)
+			d = z.UnixMilli()
+		}
+		if e == nil {
+			s.ID, e = strconv.ParseUint(get("team_id"), 10, 64)
+		}
+		if e == nil {
+			s.Score, e = strconv.ParseInt(get("score"), 10, 64)
+		}
+		if x := get("health"); e == nil && len(x) > 0 {
+			s.Health, e = strconv.ParseInt(x, 10, 64)
+		}
+		if x := get("rank"); e == nil && len(x) > 0 {
+			s.Rank, e = strconv.ParseInt(x, 10, 64)
+		}
+		if x := get("game"); e == nil && len(x) > 0 && g == 0 {
+			g, e = strconv.ParseUint(x, 10, 64)
+		}
+		if e != nil {
+			return 0, nil, &errval{s: `score dump "` + n + `" line ` + strconv.Itoa(l) + " is not valid", e: e}
+		}
+		if s.Name = get("team"); len(s.Name) == 0 {
+			s.Name = "Team " + strconv.FormatUint(s.ID, 10)
+		}
+		o = o || s.Rank > 0
+		i, ok := t[d]
+		if !ok {
+			i, t[d] = len(r), len(r)
+			r = append(r, sample{time: d, teams: make([]game.Standing, 0, 1)})
+		}
+		r[i].teams = append(r[i].teams, s)
+	}
+	if !o {
+		for i := range r {
+			p := make(map[uint64]game.Standing, len(r[i].teams))
+			for _, s := range r[i].teams {
+				p[s.ID] = s
+			}
+			r[i].teams = ranked(p)
+		}
+	}
+	return g, r, nil
+}
+
+// ranked returns the standings of the teams sorted by score, with teams that have the
+// same score sharing a rank.
+func ranked(p map[uint64]game.Standing) []game.Standing {
+	o := make([]game.Standing, 0, len(p))
+	for _, v := range p {
+		o = append(o, v)
+	}
+	sort.SliceStable(o, func(i, j int) bool {
+		if o[i].Score != o[j].Score {
+			return o[i].Score > o[j].Score
+		}
+		return o[i].ID < o[j].ID
+	})
+	for i := range o {
+		if o[i].Rank = int64(i + 1); i > 0 && o[i].Score == o[i-1].Score {
+			o[i].Rank = o[i-1].Rank
+		}
+	}
+	return o
+}
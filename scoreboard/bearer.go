@@ -0,0 +1,386 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// bearerAPI is the Twitter API used by app-only streams.
+const bearerAPI = "https://api.twitter.com"
+
+// bearerTag is the tag of the filtered stream rule added by the Scoreboard, rules with
+// other tags are not changed.
+const bearerTag = "scoreboard"
+
+// bearerFields is the query of the filtered stream, which asks for the users, images
+// and retweets of each Tweet.
+const bearerFields = "?tweet.fields=lang,attachments,referenced_tweets,author_id" +
+	"&expansions=author_id,attachments.media_keys,referenced_tweets.id,referenced_tweets.id.author_id" +
+	"&user.fields=name,username,profile_image_url&media.fields=type,url"
+
+// Stream is a Twitter stream, which sends Tweets and stream messages on its channel
+// until it is stopped. Messages are the go-twitter message types, such as *twitter.Tweet
+// and *twitter.StreamDisconnect, and errors are sent as *url.Error. The channel is
+// closed if Twitter rejects the stream.
+type Stream interface {
+	Stop()
+	Messages() <-chan interface{}
+}
+
+// account is a stream that uses the user context of the access keys.
+type account struct {
+	s *twitter.Stream
+}
+
+// bearer is a filtered stream that only uses the consumer keys, which is used when the
+// access keys are empty. Stream messages are converted to Tweets, and the stream is
+// reconnected with a backoff when it is closed, like the account stream.
+type bearer struct {
+	c      *http.Client
+	out    chan interface{}
+	done   chan struct{}
+	cancel context.CancelFunc
+	token  string
+}
+type bearerUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Picture  string `json:"profile_image_url"`
+}
+type bearerTweet struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Lang   string `json:"lang"`
+	Author string `json:"author_id"`
+	Attach struct {
+		Media []string `json:"media_keys"`
+	} `json:"attachments"`
+	Refs []struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	} `json:"referenced_tweets"`
+}
+type bearerMessage struct {
+	Data     bearerTweet `json:"data"`
+	Includes struct {
+		Users  []bearerUser  `json:"users"`
+		Tweets []bearerTweet `json:"tweets"`
+		Media  []struct {
+			Key  string `json:"media_key"`
+			Type string `json:"type"`
+			URL  string `json:"url"`
+		} `json:"media"`
+	} `json:"includes"`
+}
+
+// app returns true if only the consumer keys are set, which uses app-only auth.
+func (a *Credentials) app() bool {
+	return len(a.AccessKey) == 0 && len(a.AccessSecret) == 0 && len(a.ConsumerKey) > 0 && len(a.ConsumerSecret) > 0
+}
+
+// usable returns true if the consumer keys and both or none of the access keys are set.
+func (a *Credentials) usable() bool {
+	if len(a.ConsumerKey) == 0 || len(a.ConsumerSecret) == 0 {
+		return false
+	}
+	return (len(a.AccessKey) > 0) == (len(a.AccessSecret) > 0)
+}
+func (a account) Stop() {
+	a.s.Stop()
+}
+func (a account) Messages() <-chan interface{} {
+	return a.s.Messages
+}
+func (b *bearer) Stop() {
+	b.cancel()
+	<-b.done
+}
+func (b *bearer) Messages() <-chan interface{} {
+	return b.out
+}
+
+// rule returns the filtered stream rule for the keywords and languages.
+func (f filter) rule() string {
+	k := make([]string, 0, len(f.Keywords))
+	for _, v := range f.Keywords {
+		if v = strings.TrimSpace(v); len(v) == 0 {
+			continue
+		}
+		if strings.ContainsRune(v, ' ') {
+			v = strconv.Quote(v)
+		}
+		k = append(k, v)
+	}
+	r := "(" + strings.Join(k, " OR ") + ")"
+	if len(f.Language) > 0 {
+		l := make([]string, len(f.Language))
+		for i := range f.Language {
+			l[i] = "lang:" + f.Language[i]
+		}
+		r += " (" + strings.Join(l, " OR ") + ")"
+	}
+	return r
+}
+
+// token exchanges the consumer keys for an app-only bearer token.
+func token(x context.Context, a *Credentials, c *http.Client) (string, error) {
+	r, err := http.NewRequestWithContext(x, http.MethodPost, bearerAPI+"/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	r.SetBasicAuth(url.QueryEscape(a.ConsumerKey), url.QueryEscape(a.ConsumerSecret))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	o, err := c.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer o.Body.Close()
+	if o.StatusCode != http.StatusOK {
+		return "", &errval{s: "token request returned " + o.Status}
+	}
+	var v struct {
+		Type  string `json:"token_type"`
+		Token string `json:"access_token"`
+	}
+	if err = json.NewDecoder(io.LimitReader(o.Body, 1<<16)).Decode(&v); err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(v.Type, "bearer") || len(v.Token) == 0 {
+		return "", &errval{s: `token request returned a "` + v.Type + `" token instead of a bearer token`}
+	}
+	return v.Token, nil
+}
+func (b *bearer) call(x context.Context, m, p string, d interface{}, o interface{}) error {
+	var r io.Reader
+	if d != nil {
+		j, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(j)
+	}
+	q, err := http.NewRequestWithContext(x, m, bearerAPI+p, r)
+	if err != nil {
+		return err
+	}
+	q.Header.Set("Authorization", "Bearer "+b.token)
+	if d != nil {
+		q.Header.Set("Content-Type", "application/json")
+	}
+	v, err := b.c.Do(q)
+	if err != nil {
+		return err
+	}
+	defer v.Body.Close()
+	if v.StatusCode != http.StatusOK && v.StatusCode != http.StatusCreated {
+		return &errval{s: "request to " + p + " returned " + v.Status}
+	}
+	if o == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(v.Body, 1<<20)).Decode(o)
+}
+
+// rules replaces the filtered stream rules added by the Scoreboard with the rule of
+// the filter. A stream shares its rules with every other stream of the app, so the
+// rules of other tags are kept.
+func (b *bearer) rules(x context.Context, f filter) error {
+	var v struct {
+		Data []struct {
+			ID    string `json:"id"`
+			Value string `json:"value"`
+			Tag   string `json:"tag"`
+		} `json:"data"`
+	}
+	if err := b.call(x, http.MethodGet, "/2/tweets/search/stream/rules", nil, &v); err != nil {
+		return err
+	}
+	var (
+		n = f.rule()
+		o []string
+		k bool
+	)
+	for _, r := range v.Data {
+		switch {
+		case r.Tag != bearerTag:
+		case r.Value == n && !k:
+			k = true
+		default:
+			o = append(o, r.ID)
+		}
+	}
+	if len(o) > 0 {
+		d := map[string]interface{}{"delete": map[string][]string{"ids": o}}
+		if err := b.call(x, http.MethodPost, "/2/tweets/search/stream/rules", d, nil); err != nil {
+			return err
+		}
+	}
+	if k {
+		return nil
+	}
+	d := map[string]interface{}{"add": []map[string]string{{"value": n, "tag": bearerTag}}}
+	return b.call(x, http.MethodPost, "/2/tweets/search/stream/rules", d, nil)
+}
+
+// filtered returns a filtered stream that uses app-only auth. The consumer keys are
+// checked by requesting the bearer token, and the rules are set before the stream is
+// started.
+func filtered(a *Credentials, f filter, c *http.Client) (Stream, error) {
+	x, y := context.WithTimeout(context.Background(), time.Minute)
+	defer y()
+	t, err := token(x, a, c)
+	if err != nil {
+		return nil, &errval{s: "cannot authenticate to Twitter", e: err}
+	}
+	b := &bearer{c: c, out: make(chan interface{}), done: make(chan struct{}), token: t}
+	if err = b.rules(x, f); err != nil {
+		return nil, &errval{s: "unable to set the Twitter stream rules", e: err}
+	}
+	z, q := context.WithCancel(context.Background())
+	b.cancel = q
+	go b.run(z)
+	return b, nil
+}
+func (b *bearer) run(x context.Context) {
+	defer func() {
+		close(b.out)
+		close(b.done)
+	}()
+	var (
+		u = bearerAPI + "/2/tweets/search/stream" + bearerFields
+		w time.Duration
+	)
+	for {
+		r, err := http.NewRequestWithContext(x, http.MethodGet, u, nil)
+		if err != nil {
+			return
+		}
+		r.Header.Set("Authorization", "Bearer "+b.token)
+		o, err := b.c.Do(r)
+		if err != nil {
+			if x.Err() == nil {
+				b.send(x, &url.Error{Op: "Get", URL: u, Err: err})
+			}
+			return
+		}
+		switch o.StatusCode {
+		case http.StatusOK:
+			// Streams closed by Twitter are reconnected after a second, so a stream that
+			// is closed right away does not retry in a loop.
+			b.receive(x, o.Body)
+			w = time.Second
+		case http.StatusServiceUnavailable:
+			// Backoff times are the same as the times used by the account stream.
+			if w *= 2; w < time.Second*5 {
+				w = time.Second * 5
+			}
+		case 420, http.StatusTooManyRequests:
+			if w *= 2; w < time.Minute {
+				w = time.Minute
+			}
+		default:
+			o.Body.Close()
+			b.send(x, &url.Error{Op: "Get", URL: u, Err: &errval{s: "stream returned " + o.Status}})
+			return
+		}
+		o.Body.Close()
+		if w > time.Minute*5 {
+			w = time.Minute * 5
+		}
+		select {
+		case <-x.Done():
+			return
+		case <-time.After(w):
+		}
+	}
+}
+func (b *bearer) send(x context.Context, v interface{}) bool {
+	select {
+	case <-x.Done():
+		return false
+	case b.out <- v:
+		return true
+	}
+}
+
+// receive reads the Tweets from the stream until it is closed. Twitter sends an empty
+// line as a keep-alive, which is skipped.
+func (b *bearer) receive(x context.Context, r io.Reader) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for s.Scan() {
+		v := bytes.TrimSpace(s.Bytes())
+		if len(v) == 0 {
+			continue
+		}
+		var m bearerMessage
+		if err := json.Unmarshal(v, &m); err != nil || len(m.Data.ID) == 0 {
+			continue
+		}
+		if !b.send(x, m.tweet()) {
+			return
+		}
+	}
+}
+
+// tweet returns the stream message as a Tweet with the fields used by the Scoreboard.
+func (m *bearerMessage) tweet() *twitter.Tweet {
+	u := make(map[string]*twitter.User, len(m.Includes.Users))
+	for _, v := range m.Includes.Users {
+		u[v.ID] = &twitter.User{Name: v.Name, ScreenName: v.Username, ProfileImageURLHttps: v.Picture}
+	}
+	t := m.Data.tweet(u)
+	for _, k := range m.Data.Attach.Media {
+		for _, v := range m.Includes.Media {
+			if v.Key == k {
+				t.Entities.Media = append(t.Entities.Media, twitter.MediaEntity{Type: v.Type, MediaURLHttps: v.URL})
+			}
+		}
+	}
+	for _, r := range m.Data.Refs {
+		if r.Type != "retweeted" {
+			continue
+		}
+		for _, v := range m.Includes.Tweets {
+			if v.ID == r.ID {
+				t.Retweeted, t.RetweetedStatus = true, v.tweet(u)
+			}
+		}
+	}
+	return t
+}
+func (v bearerTweet) tweet(u map[string]*twitter.User) *twitter.Tweet {
+	n, _ := strconv.ParseInt(v.ID, 10, 64)
+	t := &twitter.Tweet{ID: n, IDStr: v.ID, Text: v.Text, Lang: v.Lang, User: u[v.Author], Entities: new(twitter.Entities)}
+	if t.User == nil {
+		t.User = &twitter.User{ScreenName: v.Author}
+	}
+	return t
+}
@@ -0,0 +1,54 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import "strconv"
+
+// budget is the most memory used by the in-memory buffers, so a Game that runs for days
+// does not slowly use up the memory of the display host. The oldest values are removed
+// once a limit is reached.
+type budget struct {
+	Tweets int `json:"tweets"`
+	Events int `json:"events"`
+	Assets int `json:"assets"`
+	Buffer int `json:"buffer"`
+	Teams  int `json:"teams"`
+}
+
+func (b budget) verify() error {
+	switch {
+	case b.Tweets < 0:
+		return &errval{s: "memory tweets limit " + strconv.Itoa(b.Tweets) + " cannot be less than zero"}
+	case b.Events < 0:
+		return &errval{s: "memory events limit " + strconv.Itoa(b.Events) + " cannot be less than zero"}
+	case b.Assets < 0:
+		return &errval{s: "memory assets limit " + strconv.Itoa(b.Assets) + " cannot be less than zero"}
+	case b.Buffer < 0:
+		return &errval{s: "memory client buffer " + strconv.Itoa(b.Buffer) + " cannot be less than zero"}
+	case b.Teams < 0:
+		return &errval{s: "memory teams limit " + strconv.Itoa(b.Teams) + " cannot be less than zero"}
+	}
+	return nil
+}
+
+// buffer returns the size of the websocket write buffer of each client, in bytes.
+func (b budget) buffer() int {
+	if b.Buffer == 0 {
+		return 1 << 10
+	}
+	return b.Buffer << 10
+}
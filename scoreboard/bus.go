@@ -0,0 +1,389 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	busIdle    = time.Second * 30
+	busBatch   = 64
+	busBuffer  = 1024
+	busBackoff = time.Second * 30
+)
+
+type bus struct {
+	log   logx.Log
+	out   sender
+	queue chan record
+	topic string
+}
+type sink struct {
+	Type     string `json:"type"`
+	Server   string `json:"server"`
+	Topic    string `json:"topic"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Buffer   int    `json:"buffer"`
+}
+type nats struct {
+	url     *url.URL
+	conn    net.Conn
+	read    *bufio.Reader
+	user    string
+	pass    string
+	token   string
+	timeout time.Duration
+}
+type kafka struct {
+	client *http.Client
+	url    string
+	user   string
+	pass   string
+	token  string
+}
+type record struct {
+	subject string
+	key     string
+	body    []byte
+}
+type sender interface {
+	send(context.Context, []record) error
+	close()
+}
+type envelope struct {
+	Data interface{} `json:"data"`
+	Type string      `json:"type"`
+}
+
+func (n *nats) close() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.read = nil, nil
+	}
+}
+func (kafka) close() {}
+func (s sink) verify() error {
+	if len(s.Server) == 0 {
+		return nil
+	}
+	u, err := url.Parse(s.Server)
+	if err != nil {
+		return &errval{s: `bus server "` + s.Server + `" is not valid`, e: err}
+	}
+	switch strings.ToLower(s.Type) {
+	case "nats":
+		switch u.Scheme {
+		case "nats", "tls":
+		default:
+			return &errval{s: `nats server scheme "` + u.Scheme + `" is not supported`}
+		}
+	case "kafka":
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return &errval{s: `kafka proxy scheme "` + u.Scheme + `" is not supported`}
+		}
+	default:
+		return &errval{s: `bus type "` + s.Type + `" is not supported`}
+	}
+	if s.Buffer < 0 {
+		return &errval{s: "bus buffer " + strconv.Itoa(s.Buffer) + " cannot be less than zero"}
+	}
+	return nil
+}
+func (b *bus) push(r record) {
+	select {
+	case b.queue <- r:
+	default:
+		b.log.Warning(`Event bus buffer is full, dropping event for "%s"!`, r.subject)
+	}
+}
+func (b *bus) change(c game.Change) {
+	v, err := json.Marshal(envelope{Type: "change", Data: c})
+	if err != nil {
+		return
+	}
+	b.push(record{
+		key:     strconv.FormatUint(c.GameID, 10),
+		body:    v,
+		subject: b.topic + ".games." + strconv.FormatUint(c.GameID, 10) + ".changes." + c.Kind.String(),
+	})
+}
+func (b *bus) start(x context.Context) {
+	t := time.NewTicker(busIdle)
+	defer func() {
+		t.Stop()
+		b.out.close()
+	}()
+	r := make([]record, 0, busBatch)
+	for {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+			if err := b.out.send(x, nil); err != nil {
+				b.log.Warning("Event bus keepalive failed: %s!", err.Error())
+			}
+			continue
+		case v := <-b.queue:
+			r = append(r[:0], v)
+		}
+	fill:
+		for len(r) < busBatch {
+			select {
+			case v := <-b.queue:
+				r = append(r, v)
+			default:
+				break fill
+			}
+		}
+		if !b.flush(x, r) {
+			return
+		}
+	}
+}
+func (b *bus) message(m game.Message) {
+	v, err := json.Marshal(envelope{Type: "message", Data: m})
+	if err != nil {
+		return
+	}
+	b.push(record{
+		key:     strconv.FormatUint(m.GameID, 10),
+		body:    v,
+		subject: b.topic + ".games." + strconv.FormatUint(m.GameID, 10) + ".messages",
+	})
+}
+func (b *bus) tweet(p posted) {
+	v, err := json.Marshal(envelope{Type: "tweet", Data: p})
+	if err != nil {
+		return
+	}
+	b.push(record{key: "tweets", body: v, subject: b.topic + ".tweets"})
+}
+func (n *nats) pong(c net.Conn) error {
+	for {
+		l, err := n.read.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch l = strings.TrimSpace(l); {
+		case l == "PONG":
+			return nil
+		case l == "PING":
+			if _, err = c.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(l, "-ERR"):
+			return &errval{s: "nats server returned an error: " + strings.Trim(strings.TrimSpace(l[4:]), "'")}
+		}
+	}
+}
+func (b *bus) flush(x context.Context, r []record) bool {
+	for d := time.Second; ; {
+		err := b.out.send(x, r)
+		if err == nil {
+			b.log.Trace("Sent %d events to the event bus.", len(r))
+			return true
+		}
+		b.log.Error("Event bus delivery of %d events failed, retrying in %s: %s!", len(r), d.String(), err.Error())
+		t := time.NewTimer(d)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+		if d *= 2; d > busBackoff {
+			d = busBackoff
+		}
+	}
+}
+func (n *nats) connect(x context.Context) error {
+	h := n.url.Host
+	if len(n.url.Port()) == 0 {
+		h = net.JoinHostPort(n.url.Hostname(), "4222")
+	}
+	c, err := (&net.Dialer{Timeout: n.timeout}).DialContext(x, "tcp", h)
+	if err != nil {
+		return err
+	}
+	c.SetDeadline(time.Now().Add(n.timeout))
+	r := bufio.NewReader(c)
+	l, err := r.ReadString('\n')
+	if err != nil {
+		c.Close()
+		return err
+	}
+	if !strings.HasPrefix(l, "INFO ") {
+		c.Close()
+		return &errval{s: "nats server did not send INFO"}
+	}
+	var i struct {
+		TLS bool `json:"tls_required"`
+	}
+	if err = json.Unmarshal([]byte(l[5:]), &i); err != nil {
+		c.Close()
+		return &errval{s: "nats server sent an invalid INFO", e: err}
+	}
+	if i.TLS || n.url.Scheme == "tls" {
+		t := tls.Client(c, &tls.Config{ServerName: n.url.Hostname()})
+		if err = t.HandshakeContext(x); err != nil {
+			c.Close()
+			return err
+		}
+		c, r = t, bufio.NewReader(t)
+	}
+	v, _ := json.Marshal(map[string]interface{}{
+		"name":       "scoreboard",
+		"lang":       "go",
+		"version":    version,
+		"verbose":    false,
+		"pedantic":   false,
+		"protocol":   1,
+		"user":       n.user,
+		"pass":       n.pass,
+		"auth_token": n.token,
+	})
+	if _, err = c.Write(append(append([]byte("CONNECT "), v...), "\r\nPING\r\n"...)); err != nil {
+		c.Close()
+		return err
+	}
+	n.conn, n.read = c, r
+	if err = n.pong(c); err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+func newBus(s sink, t time.Duration, c *http.Client, l logx.Log) *bus {
+	b := &bus{log: l, topic: strings.Trim(s.Topic, "./")}
+	if len(b.topic) == 0 {
+		b.topic = "scoreboard"
+	}
+	if s.Buffer > 0 {
+		b.queue = make(chan record, s.Buffer)
+	} else {
+		b.queue = make(chan record, busBuffer)
+	}
+	u, _ := url.Parse(s.Server)
+	if strings.EqualFold(s.Type, "kafka") {
+		b.out = &kafka{
+			url:    strings.TrimRight(s.Server, "/") + "/topics/" + url.PathEscape(b.topic),
+			user:   s.Username,
+			pass:   s.Password,
+			token:  s.Token,
+			client: c,
+		}
+		return b
+	}
+	b.out = &nats{url: u, user: s.Username, pass: s.Password, token: s.Token, timeout: t}
+	return b
+}
+func (n *nats) send(x context.Context, r []record) error {
+	if n.conn == nil {
+		if err := n.connect(x); err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	for i := range r {
+		b.WriteString("PUB " + r[i].subject + " " + strconv.Itoa(len(r[i].body)) + "\r\n")
+		b.Write(r[i].body)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("PING\r\n")
+	c := n.conn
+	c.SetDeadline(time.Now().Add(n.timeout))
+	if _, err := c.Write(b.Bytes()); err != nil {
+		n.close()
+		return err
+	}
+	if err := n.pong(c); err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+func (k *kafka) send(x context.Context, r []record) error {
+	if len(r) == 0 {
+		return nil
+	}
+	type value struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	v := struct {
+		Records []value `json:"records"`
+	}{Records: make([]value, len(r))}
+	for i := range r {
+		v.Records[i] = value{Key: r[i].key, Value: r[i].body}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	q, err := http.NewRequestWithContext(x, http.MethodPost, k.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	q.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	q.Header.Set("User-Agent", "Scorebot-Scoreboard")
+	q.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	if len(k.token) > 0 {
+		q.Header.Set("Authorization", "Bearer "+k.token)
+	} else if len(k.user) > 0 {
+		q.SetBasicAuth(k.user, k.pass)
+	}
+	o, err := k.client.Do(q)
+	if err != nil {
+		return err
+	}
+	defer o.Body.Close()
+	if o.StatusCode >= 300 {
+		return &errval{s: "kafka proxy returned status code " + strconv.Itoa(o.StatusCode)}
+	}
+	var p struct {
+		Offsets []struct {
+			Error string `json:"error"`
+			Code  *int   `json:"error_code"`
+		} `json:"offsets"`
+	}
+	if err = json.NewDecoder(io.LimitReader(o.Body, 1<<20)).Decode(&p); err != nil {
+		return &errval{s: "kafka proxy returned an invalid response", e: err}
+	}
+	for i := range p.Offsets {
+		if p.Offsets[i].Code != nil {
+			return &errval{s: "kafka proxy rejected a record: " + p.Offsets[i].Error}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"strings"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// channel is a separate area of the display that is sent the Tweets containing any of
+// the keywords or hashtags, instead of the Twitter tab.
+type channel struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+}
+type channels []channel
+
+func (c channels) verify() error {
+	for i := range c {
+		if len(c[i].Name) == 0 {
+			return &errval{s: "twitter channel name cannot be empty"}
+		}
+		for x := range c[i].Name {
+			switch v := c[i].Name[x]; {
+			case v >= 'a' && v <= 'z', v >= '0' && v <= '9', v == '_':
+			default:
+				return &errval{s: `twitter channel name "` + c[i].Name + `" can only contain lowercase letters, numbers and underscores`}
+			}
+		}
+		if len(c[i].Keywords) == 0 {
+			return &errval{s: `twitter channel "` + c[i].Name + `" needs at least one keyword`}
+		}
+		for x := 0; x < i; x++ {
+			if c[x].Name == c[i].Name {
+				return &errval{s: `twitter channel "` + c[i].Name + `" is listed more than once`}
+			}
+		}
+	}
+	return nil
+}
+
+// route returns the name of the first channel with a keyword in the Tweet, or an empty
+// string if the Tweet is shown in the Twitter tab.
+func (c channels) route(t *twitter.Tweet) string {
+	if len(c) == 0 {
+		return ""
+	}
+	v := strings.ToLower(t.Text)
+	if t.RetweetedStatus != nil {
+		v += " " + strings.ToLower(t.RetweetedStatus.Text)
+	}
+	for i := range c {
+		for _, k := range c[i].Keywords {
+			if w := strings.ToLower(strings.TrimSpace(k)); len(w) > 0 && strings.Contains(v, w) {
+				return c[i].Name
+			}
+		}
+	}
+	return ""
+}
+
+// names returns the names of the channels, in the order they are shown.
+func (c channels) names() []string {
+	if len(c) == 0 {
+		return nil
+	}
+	r := make([]string, len(c))
+	for i := range c {
+		r[i] = c[i].Name
+	}
+	return r
+}
@@ -0,0 +1,271 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package client
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The kinds of Events sent by the Scoreboard, which match the event types used by the
+// scoring engine and the Scoreboard itself.
+const (
+	Message Kind = iota
+	Popup
+	Effect
+	Window
+	Change
+	Transition
+	Clock
+	Status
+	Sources
+	Control
+)
+
+// Kind is the type of an Event.
+type Kind uint8
+
+// Event is a message sent by the Scoreboard that is not part of the board, such as a
+// ticker message, a popup, the game clock or the status of the data sources. Events are
+// kept until the Scoreboard removes them.
+type Event struct {
+	Data   map[string]string
+	ID     string
+	Kind   Kind
+	Remove bool
+
+	n uint64
+}
+
+// Update is a single change to the board, as sent by the Scoreboard over the WebSocket.
+// Updates are applied to the board by the Client, so they are only needed to follow the
+// exact changes made.
+type Update struct {
+	Value  string            `json:"value,omitempty"`
+	Data   map[string]string `json:"data"`
+	ID     string            `json:"id"`
+	Name   string            `json:"name,omitempty"`
+	Class  string            `json:"class,omitempty"`
+	Event  bool              `json:"event"`
+	Remove bool              `json:"remove"`
+}
+
+// Element is a single item on the board, such as a team, a host or the score of a team.
+// The ID of an Element contains the ID of its parent Element, followed by a dash and the
+// name of the Element, such as "team-1-name".
+type Element struct {
+	Style map[string]string
+	ID    string
+	Text  string
+	Class string
+
+	n uint64
+}
+type board struct {
+	elements map[string]*Element
+	events   map[string]*Event
+	prev     map[string]*Event
+	next     uint64
+}
+
+func (k Kind) String() string {
+	switch k {
+	case Message:
+		return "message"
+	case Popup:
+		return "popup"
+	case Effect:
+		return "effect"
+	case Window:
+		return "window"
+	case Change:
+		return "change"
+	case Transition:
+		return "transition"
+	case Clock:
+		return "clock"
+	case Status:
+		return "status"
+	case Sources:
+		return "sources"
+	case Control:
+		return "control"
+	}
+	return "kind(" + strconv.FormatUint(uint64(k), 10) + ")"
+}
+func newBoard() *board {
+	return &board{elements: make(map[string]*Element), events: make(map[string]*Event)}
+}
+func (e *Element) copy() Element {
+	v := *e
+	if e.Style != nil {
+		v.Style = make(map[string]string, len(e.Style))
+		for k, s := range e.Style {
+			v.Style[k] = s
+		}
+	}
+	return v
+}
+
+// Parent returns the ID of the parent Element, or an empty string if the Element is at
+// the top of the board.
+func (e Element) Parent() string {
+	if i := strings.LastIndexByte(e.ID, '-'); i > 0 {
+		return e.ID[:i]
+	}
+	return ""
+}
+
+// Has returns true if the Element has the supplied class.
+func (e Element) Has(c string) bool {
+	for _, v := range strings.Fields(e.Class) {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+func (e *Event) same(o *Event) bool {
+	if o == nil || len(e.Data) != len(o.Data) {
+		return false
+	}
+	for k, v := range e.Data {
+		if s, ok := o.Data[k]; !ok || s != v {
+			return false
+		}
+	}
+	return true
+}
+
+// event applies the Update as an Event and returns it. The returned Event is nil if it
+// did not change.
+func (b *board) event(u *Update) *Event {
+	k, err := strconv.ParseUint(u.Value, 10, 8)
+	if err != nil {
+		return nil
+	}
+	// Control commands are only sent once and are never removed, so they are not kept.
+	if Kind(k) == Control {
+		return &Event{ID: u.ID, Kind: Control, Data: u.Data}
+	}
+	var (
+		n = u.Value + "-" + u.ID
+		o = b.events[n]
+	)
+	if o == nil {
+		o = b.prev[n]
+	}
+	if u.Remove {
+		if o == nil {
+			return nil
+		}
+		delete(b.prev, n)
+		delete(b.events, n)
+		return &Event{ID: u.ID, Kind: Kind(k), Data: o.Data, Remove: true}
+	}
+	e := &Event{ID: u.ID, Kind: Kind(k), Data: u.Data}
+	if e.same(o) {
+		b.events[n] = o
+		return nil
+	}
+	if o != nil {
+		e.n = o.n
+	} else {
+		b.next++
+		e.n = b.next
+	}
+	b.events[n] = e
+	return e
+}
+
+// reset clears the board before the Scoreboard sends the whole board again after the
+// Client reconnects. The Events are kept until then, so Events that were already seen
+// before the reconnect are not returned again.
+func (b *board) reset() {
+	if len(b.prev) == 0 {
+		b.prev = b.events
+	} else {
+		for k, v := range b.events {
+			b.prev[k] = v
+		}
+	}
+	b.elements, b.events = make(map[string]*Element), make(map[string]*Event)
+}
+
+// apply applies the Update to the Element it targets, the same as the board shown in a
+// browser. Removing an Element also removes all of its children.
+func (b *board) apply(u *Update) {
+	if len(u.ID) == 0 {
+		return
+	}
+	if u.Remove {
+		delete(b.elements, u.ID)
+		p := u.ID + "-"
+		for k := range b.elements {
+			if strings.HasPrefix(k, p) {
+				delete(b.elements, k)
+			}
+		}
+		return
+	}
+	e := b.elements[u.ID]
+	if e == nil {
+		b.next++
+		e = &Element{ID: u.ID, n: b.next}
+		b.elements[u.ID] = e
+	}
+	if len(u.Class) > 0 {
+		e.Class = strings.Join(strings.Fields(u.Class), " ")
+	}
+	switch {
+	case len(u.Value) == 0:
+	case len(u.Name) == 0:
+		e.Text = u.Value
+	case u.Name != "class":
+		if e.Style == nil {
+			e.Style = make(map[string]string)
+		}
+		e.Style[u.Name] = u.Value
+	case u.Value[0] == '-':
+		c := strings.Fields(e.Class)
+		l := c[:0]
+		for _, v := range c {
+			if v != u.Value[1:] {
+				l = append(l, v)
+			}
+		}
+		e.Class = strings.Join(l, " ")
+	default:
+		if v := strings.TrimPrefix(u.Value, "+"); !e.Has(v) {
+			e.Class = strings.TrimSpace(e.Class + " " + v)
+		}
+	}
+}
+
+// children returns a copy of the Elements that are directly under the parent ID, in the
+// order that they were added to the board.
+func (b *board) children(p string) []Element {
+	var r []Element
+	for _, e := range b.elements {
+		if e.Parent() == p {
+			r = append(r, e.copy())
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].n < r[j].n })
+	return r
+}
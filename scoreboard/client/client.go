@@ -0,0 +1,404 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package client is a Go client for the Scoreboard, which keeps a copy of the board of a
+// Game up to date over the same WebSocket used by the browser, so secondary displays and
+// bots do not have to implement the update protocol.
+//
+//	c, err := client.New("https://scoreboard.example.com", 1)
+//	if err != nil {
+//		panic(err)
+//	}
+//	c.OnEvent(func(e client.Event) {
+//		if e.Kind == client.Message && !e.Remove {
+//			fmt.Println(e.Data["text"])
+//		}
+//	})
+//	c.Run(context.Background())
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	retryMin = time.Second
+	retryMax = time.Minute
+	timeout  = time.Second * 10
+)
+
+// limit is the largest message that the Client reads from the Scoreboard.
+const limit = 32 << 20
+
+// ErrRejected is returned when the Scoreboard closes the connection before sending the
+// board, which happens when the Game ID is not valid or the Game is not being tracked.
+var ErrRejected = errors.New("game was rejected by the scoreboard")
+
+// ErrGap is returned when a message from the Scoreboard was missed, which is found by a
+// gap in the sequence numbers of the messages. Run connects again to get the board.
+var ErrGap = errors.New("missed a message from the scoreboard")
+
+// Client keeps a copy of the board of a single Game on a Scoreboard. The board is kept up
+// to date by the Run function, which reconnects if the connection is lost. Functions that
+// read the board are safe to call from any goroutine.
+type Client struct {
+	HTTP   *http.Client
+	Dialer *websocket.Dialer
+
+	board *board
+	base  *url.URL
+
+	update []func([]Update)
+	event  []func(Event)
+	lost   []func(error)
+
+	token string
+	route string
+
+	game uint64
+	lock sync.RWMutex
+
+	connected bool
+}
+
+// Standings is the response of the standings API of the Scoreboard.
+type Standings struct {
+	Division  string   `json:"division,omitempty"`
+	Divisions []string `json:"divisions"`
+	game.Snapshot
+}
+
+// New returns a Client for the Game ID on the Scoreboard at the supplied URL, such as
+// "https://scoreboard.example.com". The URL may contain a path if the Scoreboard is
+// served under a prefix.
+func New(s string, g uint64) (*Client, error) {
+	if g == 0 {
+		return nil, errors.New("a valid game ID is required")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.New(`scoreboard URL "` + s + `" is not valid: ` + err.Error())
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, errors.New(`scoreboard URL scheme "` + u.Scheme + `" is not supported`)
+	}
+	if len(u.Host) == 0 {
+		return nil, errors.New(`scoreboard URL "` + s + `" is missing a host`)
+	}
+	u.Path, u.RawQuery, u.Fragment = strings.TrimSuffix(u.Path, "/"), "", ""
+	return &Client{
+		HTTP:   &http.Client{Timeout: timeout},
+		Dialer: &websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: timeout},
+		base:   u,
+		game:   g,
+		board:  newBoard(),
+	}, nil
+}
+
+// Route sets the name of the extra game on the Scoreboard to connect to, which is the
+// same as the name in the "/w/<name>" URL used by the browser. This function must be
+// called before Run.
+func (c *Client) Route(n string) {
+	c.route = strings.Trim(n, "/")
+}
+
+// Token sets the admin token used to connect, which shows the Client the same board as
+// the staff view, including the status of the data sources and the live standings of a
+// frozen Game. This function must be called before Run.
+func (c *Client) Token(t string) {
+	c.token = t
+}
+
+// OnUpdate adds a function that is called with every list of Updates sent by the
+// Scoreboard, after they were applied to the board. The Updates include Events.
+// Functions are called in order from the Run goroutine and should not block.
+func (c *Client) OnUpdate(f func([]Update)) {
+	if f != nil {
+		c.lock.Lock()
+		c.update = append(c.update, f)
+		c.lock.Unlock()
+	}
+}
+
+// OnEvent adds a function that is called for every new, changed or removed Event. Events
+// that are sent again after a reconnect are not repeated. Functions are called in order
+// from the Run goroutine and should not block.
+func (c *Client) OnEvent(f func(Event)) {
+	if f != nil {
+		c.lock.Lock()
+		c.event = append(c.event, f)
+		c.lock.Unlock()
+	}
+}
+
+// OnDisconnect adds a function that is called with the error when the connection to the
+// Scoreboard is lost or could not be made. The board is kept until the Client is able to
+// reconnect.
+func (c *Client) OnDisconnect(f func(error)) {
+	if f != nil {
+		c.lock.Lock()
+		c.lost = append(c.lost, f)
+		c.lock.Unlock()
+	}
+}
+
+// Connected returns true if the Client is connected and has received the board.
+func (c *Client) Connected() bool {
+	c.lock.RLock()
+	r := c.connected
+	c.lock.RUnlock()
+	return r
+}
+
+// Element returns a copy of the Element with the supplied ID, such as "game-status-name",
+// and true if it is on the board.
+func (c *Client) Element(i string) (Element, bool) {
+	c.lock.RLock()
+	e, ok := c.board.elements[i]
+	var r Element
+	if ok {
+		r = e.copy()
+	}
+	c.lock.RUnlock()
+	return r, ok
+}
+
+// Text returns the text of the Element with the supplied ID, or an empty string if it is
+// not on the board.
+func (c *Client) Text(i string) string {
+	c.lock.RLock()
+	var r string
+	if e, ok := c.board.elements[i]; ok {
+		r = e.Text
+	}
+	c.lock.RUnlock()
+	return r
+}
+
+// Children returns a copy of the Elements directly under the Element with the supplied
+// ID, in the order they were added to the board. An empty ID returns the Elements at
+// the top of the board.
+func (c *Client) Children(i string) []Element {
+	c.lock.RLock()
+	r := c.board.children(i)
+	c.lock.RUnlock()
+	return r
+}
+
+// Events returns a copy of the current Events, in the order they were first sent.
+func (c *Client) Events() []Event {
+	c.lock.RLock()
+	r := make([]Event, 0, len(c.board.events))
+	for _, e := range c.board.events {
+		r = append(r, *e)
+	}
+	c.lock.RUnlock()
+	sort.Slice(r, func(i, j int) bool { return r[i].n < r[j].n })
+	return r
+}
+
+// Run connects to the Scoreboard and keeps the board up to date until the context is
+// cancelled. Lost connections are retried with an increasing delay of up to a minute.
+// This function blocks and returns the error of the context once it is cancelled.
+func (c *Client) Run(x context.Context) error {
+	for w := retryMin; ; {
+		ok, err := c.pull(x)
+		if x.Err() != nil {
+			return x.Err()
+		}
+		if ok {
+			w = retryMin
+		}
+		c.lock.Lock()
+		c.connected = false
+		l := c.lost
+		c.lock.Unlock()
+		for i := range l {
+			l[i](err)
+		}
+		t := time.NewTimer(w)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return x.Err()
+		case <-t.C:
+		}
+		if w *= 2; w > retryMax {
+			w = retryMax
+		}
+	}
+}
+
+// Standings returns the current standings of the Game from the standings API, limited
+// to the division if it is not empty.
+func (c *Client) Standings(x context.Context, division string) (*Standings, error) {
+	q := url.Values{"game": []string{strconv.FormatUint(c.game, 10)}}
+	if len(c.route) > 0 {
+		q.Set("name", c.route)
+	}
+	if len(division) > 0 {
+		q.Set("division", division)
+	}
+	var s Standings
+	if err := c.get(x, "/api/v1/standings", q, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// pull connects to the Scoreboard and applies each list of Updates until the connection
+// is closed. The returned boolean is true if the board was received.
+func (c *Client) pull(x context.Context) (bool, error) {
+	u := *c.base
+	switch u.Path += "/w"; u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	if len(c.route) > 0 {
+		u.Path += "/" + c.route
+	}
+	var h http.Header
+	if len(c.token) > 0 {
+		h = http.Header{"Authorization": []string{"Bearer " + c.token}}
+	}
+	n, _, err := c.Dialer.DialContext(x, u.String(), h)
+	if err != nil {
+		return false, err
+	}
+	d := make(chan struct{})
+	defer close(d)
+	go func() {
+		select {
+		case <-x.Done():
+		case <-d:
+		}
+		n.Close()
+	}()
+	n.SetReadLimit(limit)
+	if err = n.WriteJSON(map[string]uint64{"game": c.game, "version": game.Protocol}); err != nil {
+		return false, err
+	}
+	var q uint64
+	for f := true; ; f = false {
+		var m message
+		if err = n.ReadJSON(&m); err != nil {
+			if f {
+				return false, ErrRejected
+			}
+			return true, err
+		}
+		// Messages without a sequence number are from older Scoreboards and are
+		// applied in the order read.
+		if m.Seq != nil {
+			if !f && *m.Seq < q {
+				continue
+			}
+			if !f && *m.Seq > q+1 {
+				return true, ErrGap
+			}
+			q = *m.Seq
+		}
+		c.receive(m.Updates, f)
+	}
+}
+
+// message is a WebSocket message from the Scoreboard. Scoreboards older than the
+// current protocol send the Updates as an array instead of in an object.
+type message struct {
+	Seq     *uint64  `json:"seq"`
+	Updates []Update `json:"updates"`
+	Version int      `json:"version"`
+}
+
+func (m *message) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		m.Version = game.ProtocolLegacy
+		return json.Unmarshal(b, &m.Updates)
+	}
+	type envelope message
+	return json.Unmarshal(b, (*envelope)(m))
+}
+
+// receive applies the Updates to the board and calls the added functions. If first is
+// true, the Updates are the whole board sent after connecting.
+func (c *Client) receive(l []Update, first bool) {
+	var e []Event
+	c.lock.Lock()
+	if first {
+		c.board.reset()
+		c.connected = true
+	}
+	for i := range l {
+		if !l[i].Event {
+			c.board.apply(&l[i])
+			continue
+		}
+		if v := c.board.event(&l[i]); v != nil {
+			e = append(e, *v)
+		}
+	}
+	a, b := c.update, c.event
+	c.lock.Unlock()
+	for i := range a {
+		a[i](l)
+	}
+	for _, v := range e {
+		for i := range b {
+			b[i](v)
+		}
+	}
+}
+func (c *Client) get(x context.Context, p string, q url.Values, v interface{}) error {
+	u := *c.base
+	u.Path, u.RawQuery = u.Path+p, q.Encode()
+	r, err := http.NewRequestWithContext(x, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if len(c.token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	o, err := c.HTTP.Do(r)
+	if err != nil {
+		return err
+	}
+	defer o.Body.Close()
+	if o.StatusCode != http.StatusOK {
+		return errors.New(`request "` + u.String() + `" returned status code ` + strconv.Itoa(o.StatusCode))
+	}
+	return json.NewDecoder(o.Body).Decode(v)
+}
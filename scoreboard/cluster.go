@@ -0,0 +1,338 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PurpleSec/logx"
+)
+
+const (
+	clusterRetry = time.Second * 5
+	clusterLease = time.Second * 15
+)
+
+// renew and resign are run by Redis as a script, so the leader lease is only extended
+// or removed by the node that holds it.
+const (
+	renew  = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`
+	resign = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+)
+
+type localKey struct{}
+type clusterKey struct{}
+type clustering struct {
+	Server string `json:"server"`
+	Prefix string `json:"prefix"`
+	Node   string `json:"node,omitempty"`
+}
+
+// cluster shares the Game state of the Scoreboard with the other nodes using Redis,
+// so a node that is started or restarted shows the last state right away, and sends
+// each admin change to every node, so all displays stay the same. One node is elected
+// as the leader, which is the only node that polls the sources and reads the Twitter
+// stream.
+type cluster struct {
+	log     logx.Log
+	db      *redis
+	handler http.Handler
+	until   time.Time
+	notify  []func(bool)
+	node    string
+	prefix  string
+	leader  uint32
+}
+
+// shared is the Store of a Game Manager in the cluster. The main Game is saved under
+// the "<prefix>:state" key and each extra game under "<prefix>:state:<name>".
+type shared struct {
+	c   *cluster
+	key string
+}
+
+// relayed is an admin request that was made to one node and is run again on the other
+// nodes of the cluster.
+type relayed struct {
+	Node   string `json:"node"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Body   []byte `json:"body,omitempty"`
+}
+
+// discard is a ResponseWriter for relayed requests, which only keeps the status code.
+type discard struct {
+	h    http.Header
+	code int
+}
+
+func (c clustering) verify() error {
+	if len(c.Server) == 0 {
+		return nil
+	}
+	if _, err := newRedis(c.Server, time.Second); err != nil {
+		return err
+	}
+	return nil
+}
+func (d *discard) Header() http.Header {
+	if d.h == nil {
+		d.h = make(http.Header)
+	}
+	return d.h
+}
+func (d *discard) WriteHeader(c int) {
+	if d.code == 0 {
+		d.code = c
+	}
+}
+func (d *discard) Write(b []byte) (int, error) {
+	if d.code == 0 {
+		d.code = http.StatusOK
+	}
+	return len(b), nil
+}
+func (s shared) String() string {
+	return s.c.db.String() + "/" + s.key
+}
+
+// Load returns the Game state saved by the leader of the cluster.
+func (s shared) Load() ([]byte, error) {
+	v, err := s.c.db.do(context.Background(), "GET", s.key)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, _ := v.(string)
+	return []byte(b), nil
+}
+
+// Save replaces the shared Game state. Only the leader saves the state.
+func (s shared) Save(b []byte) error {
+	_, err := s.c.db.do(context.Background(), "SET", s.key, string(b))
+	return err
+}
+
+// store returns the Store of the named game, or the main Game if the name is empty.
+func (c *cluster) store(n string) shared {
+	if len(n) == 0 {
+		return shared{c: c, key: c.prefix + ":state"}
+	}
+	return shared{c: c, key: c.prefix + ":state:" + n}
+}
+func (c *cluster) leading() bool {
+	return atomic.LoadUint32(&c.leader) == 1
+}
+
+// leading returns true if the Scoreboard is the cluster leader or is not clustered, so
+// scheduled posts are only sent once by the cluster.
+func (s *Scoreboard) leading() bool {
+	return s.cluster == nil || s.cluster.leading()
+}
+
+// elect tries to take or extend the leader lease every third of the lease time. A
+// leader that cannot reach Redis stays the leader until its lease has expired, as no
+// other node can take the lease before then.
+func (c *cluster) elect(x context.Context) {
+	t := time.NewTicker(clusterLease / 3)
+	defer t.Stop()
+	for {
+		c.campaign(x)
+		select {
+		case <-x.Done():
+			c.abdicate()
+			return
+		case <-t.C:
+		}
+	}
+}
+func (c *cluster) campaign(x context.Context) {
+	var (
+		k   = c.prefix + ":leader"
+		l   = strconv.FormatInt(int64(clusterLease/time.Millisecond), 10)
+		n   = time.Now()
+		v   interface{}
+		err error
+	)
+	if c.leading() {
+		v, err = c.db.do(x, "EVAL", renew, "1", k, c.node, l)
+	} else {
+		v, err = c.db.do(x, "SET", k, c.node, "NX", "PX", l)
+	}
+	switch {
+	case err != nil:
+		if x.Err() != nil {
+			return
+		}
+		if c.leading() && n.Before(c.until) {
+			c.log.Warning("Cannot renew the leader lease, which expires at %s: %s!", c.until.Format(time.RFC3339), err.Error())
+			return
+		}
+		c.log.Error("Cannot reach the cluster to elect a leader: %s!", err.Error())
+		c.elected(false)
+	case v == "OK" || v == int64(1):
+		c.until = n.Add(clusterLease)
+		c.elected(true)
+	default:
+		c.elected(false)
+	}
+}
+
+// abdicate removes the leader lease when the node is stopped, so another node can
+// become the leader right away.
+func (c *cluster) abdicate() {
+	if !c.leading() {
+		return
+	}
+	x, f := context.WithTimeout(context.Background(), c.db.timeout)
+	c.db.do(x, "EVAL", resign, "1", c.prefix+":leader", c.node)
+	f()
+	c.elected(false)
+}
+func (c *cluster) elected(v bool) {
+	var n uint32
+	if v {
+		n = 1
+	}
+	if atomic.SwapUint32(&c.leader, n) == n {
+		return
+	}
+	if v {
+		c.log.Info(`Node "%s" is now the cluster leader.`, c.node)
+	} else {
+		c.log.Warning(`Node "%s" is no longer the cluster leader.`, c.node)
+	}
+	for i := range c.notify {
+		c.notify[i](v)
+	}
+}
+func (c *cluster) start(x context.Context) {
+	for {
+		if err := c.db.subscribe(x, c.prefix+":admin", func(b []byte) { c.receive(x, b) }); err != nil {
+			c.log.Warning("Cluster subscription failed, retrying in %s: %s!", clusterRetry.String(), err.Error())
+		}
+		t := time.NewTimer(clusterRetry)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+func newCluster(v clustering, t time.Duration, l logx.Log) (*cluster, error) {
+	r, err := newRedis(v.Server, t)
+	if err != nil {
+		return nil, err
+	}
+	c := &cluster{log: l, db: r, node: v.Node, prefix: strings.Trim(v.Prefix, ":")}
+	if len(c.prefix) == 0 {
+		c.prefix = "scoreboard"
+	}
+	if len(c.node) == 0 {
+		var b [4]byte
+		rand.Read(b[:])
+		h, _ := os.Hostname()
+		c.node = h + "-" + hex.EncodeToString(b[:])
+	}
+	return c, nil
+}
+
+// relay runs the admin handler and, if it succeeded, publishes the request so the
+// other nodes of the cluster run it too.
+func (c *cluster) relay(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, logoLimit))
+	if err != nil {
+		fail(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var (
+		k bool
+		v = &recorder{ResponseWriter: w}
+	)
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	if h(v, r.WithContext(context.WithValue(r.Context(), localKey{}, &k))); v.code >= 300 || k {
+		return
+	}
+	c.publish(r.Context(), relayed{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Type:   r.Header.Get("Content-Type"),
+		Body:   b,
+	})
+}
+
+// local marks the admin request as one that is not relayed to the other nodes of the
+// cluster, as the handler shares what the other nodes need itself.
+func local(r *http.Request) {
+	if v, ok := r.Context().Value(localKey{}).(*bool); ok {
+		*v = true
+	}
+}
+
+// publish sends the admin request to the other nodes of the cluster.
+func (c *cluster) publish(x context.Context, v relayed) {
+	v.Node = c.node
+	m, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if _, err = c.db.do(x, "PUBLISH", c.prefix+":admin", string(m)); err != nil {
+		c.log.Error(`Unable to send admin request "%s" to the cluster: %s!`, v.Path, err.Error())
+	}
+}
+func (c *cluster) receive(x context.Context, b []byte) {
+	var v relayed
+	if err := json.Unmarshal(b, &v); err != nil {
+		c.log.Warning("Received an invalid cluster message: %s!", err.Error())
+		return
+	}
+	if v.Node == c.node {
+		return
+	}
+	u := v.Path
+	if len(v.Query) > 0 {
+		u += "?" + v.Query
+	}
+	r, err := http.NewRequestWithContext(context.WithValue(x, clusterKey{}, v.Node), v.Method, u, bytes.NewReader(v.Body))
+	if err != nil {
+		c.log.Warning(`Received an invalid admin request from node "%s": %s!`, v.Node, err.Error())
+		return
+	}
+	if r.RemoteAddr = "cluster:" + v.Node; len(v.Type) > 0 {
+		r.Header.Set("Content-Type", v.Type)
+	}
+	var d discard
+	if c.handler.ServeHTTP(&d, r); d.code >= 300 {
+		c.log.Warning(`Admin request "%s %s" from node "%s" failed with status code %d!`, v.Method, v.Path, v.Node, d.code)
+		return
+	}
+	c.log.Debug(`Applied admin request "%s %s" from node "%s".`, v.Method, v.Path, v.Node)
+}
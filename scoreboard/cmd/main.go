@@ -24,7 +24,7 @@ import (
 )
 
 func main() {
-	s, err := scoreboard.Cmdline()
+	s, err := scoreboard.Cmdline(nil)
 	if err == flag.ErrHelp {
 		os.Exit(2)
 	}
@@ -17,25 +17,38 @@
 package scoreboard
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/PurpleSec/logx"
+	"github.com/BurntSushi/toml"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"gopkg.in/yaml.v3"
 )
 
 var version = "unknown"
 
+// defaultMilestone is the score milestone interval used when the config does not set one.
+const defaultMilestone = 1000
+
 const defaults = `{
     "log": {
         "file": "scoreboard.log",
-        "level": 2
+        "format": "console",
+        "level": 2,
+        "max_size": 0,
+        "max_files": 5
     },
     "tick": 5,
     "assets": "",
     "listen": "0.0.0.0:8080",
+    "proxy": "",
+    "no_proxy": "",
     "twitter": {
         "filter": {
             "language": [
@@ -50,6 +63,12 @@ const defaults = `{
             "banned_words": []
         },
         "expire": 45,
+        "timeouts": {
+            "dial": 10,
+            "tls": 10,
+            "header": 30,
+            "stall": 90
+        },
         "auth": {
             "access_key": "",
             "consumer_key": "",
@@ -58,9 +77,736 @@ const defaults = `{
         }
     },
     "timeout": 10,
-    "scorebot": "http://scorebot"
+    "workers": 4,
+    "milestone": 1000,
+    "stale": 60,
+    "retry": {
+        "attempts": 3,
+        "threshold": 5,
+        "cooldown": 30
+    },
+    "source": {
+        "type": "scorebot",
+        "url": "http://scorebot"
+    },
+    "webhooks": [],
+    "digests": [],
+    "fallback": {
+        "enabled": false,
+        "file": "",
+        "bucket": "",
+        "interval": 30
+    },
+    "publish": {
+        "enabled": false,
+        "bucket": "",
+        "interval": 60
+    },
+    "exec": [],
+    "script": {
+        "file": ""
+    },
+    "mqtt": {
+        "server": "",
+        "client_id": "",
+        "prefix": "scoreboard",
+        "qos": 0,
+        "keepalive": 60
+    },
+    "bus": {
+        "type": "nats",
+        "server": "",
+        "topic": "scoreboard",
+        "buffer": 1024
+    },
+    "history": {
+        "type": "sqlite",
+        "source": "",
+        "retention": {
+            "raw": 0,
+            "keep": 0,
+            "rollup": 60,
+            "interval": 300
+        }
+    },
+    "tracing": {
+        "endpoint": "",
+        "service": "scoreboard"
+    },
+    "grpc": {
+        "listen": ""
+    },
+    "debug": {
+        "enabled": false,
+        "listen": "localhost:6060"
+    },
+    "sentry": {
+        "dsn": "",
+        "environment": "",
+        "errors": false
+    },
+    "state": {
+        "file": "",
+        "interval": 30
+    },
+    "cluster": {
+        "server": "",
+        "prefix": "scoreboard"
+    },
+    "replication": {
+        "primary": "",
+        "token": ""
+    },
+    "admin": {
+        "token": "",
+        "tickets": false,
+        "presenter": {
+            "views": [],
+            "reveal": 30
+        },
+        "confirm": {
+            "approvers": {},
+            "timeout": 300
+        },
+        "auth": {
+            "type": ""
+        }
+    },
+    "security": {
+        "policy": "",
+        "referrer": "strict-origin-when-cross-origin",
+        "frames": [
+            "/podium",
+            "/attacks"
+        ],
+        "ancestors": [
+            "*"
+        ],
+        "hsts": 31536000,
+        "disabled": false
+    },
+    "server": {
+        "routes": {
+            "/api/v1/admin/logos": 4194304
+        },
+        "body": 1048576,
+        "headers": 32768,
+        "header_timeout": 0,
+        "idle_timeout": 0,
+        "connections": 0,
+        "per_address": 0
+    },
+    "public": {
+        "rate": 60,
+        "burst": 10,
+        "max_age": 15
+    },
+    "secrets": {
+        "type": "",
+        "server": "",
+        "region": ""
+    },
+    "freeze": "",
+    "delay": 0,
+    "finale": {
+        "enabled": false,
+        "freeze": false,
+        "podium": false
+    },
+    "fixture": {
+        "record": "",
+        "replay": "",
+        "start": "",
+        "speed": 1
+    },
+    "games": [],
+    "tenants": [],
+    "divisions": {},
+    "handles": {},
+    "positions": {},
+    "teams": "",
+    "anonymize": "",
+    "logos": {
+        "dir": "",
+        "size": 256
+    },
+    "qr": {
+        "url": "",
+        "widget": false
+    },
+    "memory": {
+        "tweets": 50,
+        "events": 10,
+        "assets": 64,
+        "buffer": 1,
+        "teams": 256
+    },
+    "locale": "en",
+    "timezone": "UTC",
+    "clock": {
+        "start": "",
+        "end": "",
+        "warnings": [
+            30,
+            10,
+            5,
+            1
+        ],
+        "breaks": [],
+        "adaptive": {
+            "final": 0,
+            "fast": 0,
+            "slow": 0
+        }
+    },
+    "lobby": {
+        "enabled": false,
+        "title": "",
+        "image": "",
+        "rotate": 15,
+        "slides": []
+    },
+    "profiles": {},
+    "themes": {
+        "schedule": []
+    },
+    "sponsors": {
+        "enabled": false,
+        "region": "bottom",
+        "rotate": 10,
+        "list": []
+    },
+    "effects": {},
+    "pacing": {
+        "rate": 0,
+        "collapse": false
+    },
+    "sort": {
+        "keys": [
+            "score"
+        ],
+        "ties": "shared"
+    },
+    "watch": false
 }
 `
+const example = `# Scorebot Scoreboard example config.
+#
+# This file can be used as a YAML config with "-c scoreboard.yaml". Every value is
+# shown with its default. Any value can also be set with a "SCOREBOARD_" environment
+# variable or the "-set" command line option.
+
+log:
+  # Log file path, logs are always written to the console.
+  file: scoreboard.log
+  # Logging level, from 0 (trace) to 5 (fatal).
+  level: 2
+  # Log format, "console" or "json".
+  format: console
+  # Rotate the log file after this many megabytes, zero to disable, and keep this
+  # many rotated files.
+  max_size: 0
+  max_files: 5
+
+# Seconds between each source poll.
+tick: 5
+# Seconds before a source or client request times out.
+timeout: 10
+# Maximum number of concurrent source requests.
+workers: 4
+# Score interval used for milestone changes, zero to disable.
+milestone: 1000
+# Seconds since the last finished update before the scoreboard is not ready, zero
+# to disable.
+stale: 60
+# Secondary assets override URL.
+assets: ""
+# Address and port to listen on.
+listen: 0.0.0.0:8080
+# TLS certificate and key file paths, both are needed to use TLS.
+cert: ""
+key: ""
+# HTML override directory, with "public" and "template" directories.
+dir: ""
+# Reload this file when it is changed.
+watch: false
+
+# Source retry and circuit breaker settings.
+retry:
+  # Attempts for each failed source request.
+  attempts: 3
+  # Failed updates in a row before the source is paused.
+  threshold: 5
+  # Seconds to pause the source for.
+  cooldown: 30
+
+# Scoring engine source, the "type" selects the source and any other values are
+# passed to it. Types are "scorebot", "ctfd", "json" and "simulator".
+source:
+  type: scorebot
+  url: http://scorebot
+  # Fetch schedule of the Games, by Game ID or "attack_defense" and "jeopardy", with the
+  # seconds between fetches and the seconds a fetch can take. Higher priorities are
+  # fetched first when every worker is busy.
+  # lanes:
+  #   attack_defense:
+  #     priority: 10
+  #   jeopardy:
+  #     interval: 30
+  #     deadline: 20
+
+twitter:
+  filter:
+    # Tweet languages and keywords, both are needed to show Tweets.
+    language: [en]
+    keywords: [pvj, ctf]
+    # Only show Tweets from these users, empty for all users.
+    only_users: []
+    # Hide Tweets from these users or with these words.
+    blocked_users: []
+    banned_words: []
+    # Confidence from 0 to 1 needed to show Tweets without a language from Twitter,
+    # which are checked against the languages here. Zero does not check them.
+    detect: 0
+    # Files or URLs with more words to hide, one word on each line, for each Tweet
+    # language or "*" for every language. Files are reloaded when changed.
+    # wordlists:
+    #   "*": /etc/scoreboard/words.txt
+    #   en: https://example.com/words-en.txt
+  # Tweets with any of the keywords or hashtags of a channel are shown in their own
+  # area of the display instead of the Twitter tab. The first matching channel is used.
+  # channels:
+  #   - name: hints
+  #     keywords: ["#hints"]
+  #   - name: social
+  #     keywords: ["#social"]
+  # Seconds that each Tweet is shown for.
+  expire: 45
+  # More Twitter API keys used when the stream is rate limited or the keys in use are
+  # rejected, and the seconds before keys that failed are used again.
+  # failover:
+  #   - access_key: ""
+  #     consumer_key: ""
+  #     access_secret: ""
+  #     consumer_secret: ""
+  # cooldown: 900
+  # Most characters of Tweet text shown, longer Tweets are cut. Zero shows all of it.
+  truncate: 0
+  # Seconds to wait to connect, for the TLS handshake and for the response headers,
+  # and the seconds without any stream data, including keep-alives, before reconnecting.
+  timeouts:
+    dial: 10
+    tls: 10
+    header: 30
+    stall: 90
+  # Twitter API keys, both consumer keys are needed to show Tweets. Leave the access
+  # keys empty to use app-only auth with the filtered stream.
+  auth:
+    access_key: ""
+    consumer_key: ""
+    access_secret: ""
+    consumer_secret: ""
+
+# Webhooks sent for each change, with an optional HMAC secret and event list. The
+# "template" is a Go template that writes the request body in place of the change JSON.
+webhooks: []
+#  - url: http://example.com/hook
+#    secret: ""
+#    events: [rank, first_blood]
+#    template: '{"content": {{json .Text}}}'
+
+# Standings digests posted to Discord or Slack webhooks every "every" minutes, with the
+# "top" teams (10 at most) as text or as a snapshot image. "game" is the name of a game
+# in "games", empty for the main source. Slack images need the public "link" of the
+# Scoreboard, as they are loaded from the snapshot endpoint. The "template" is a Go
+# template that writes the JSON payload of each post in place of the default message.
+digests: []
+#  - url: https://discord.com/api/webhooks/<id>/<token>
+#    type: discord
+#    every: 15
+#    top: 10
+#    image: true
+#  - url: https://hooks.slack.com/services/<path>
+#    type: slack
+#    every: 30
+#    division: college
+#    image: true
+#    link: https://scoreboard.example.com
+
+# Static standings page rendered every "interval" seconds and served at "/static-board",
+# so displays can be pointed at it if the live board stops updating. The page is also
+# written to "file" and uploaded to the "bucket" ("s3://<bucket>/<key>" or the URL of an
+# S3 compatible store) with the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables.
+fallback:
+  enabled: false
+  file: ""
+  bucket: ""
+  # region: us-east-1
+  interval: 30
+
+# Publisher that uploads the standings JSON, snapshot image and export files of the
+# current game and every named game to the "bucket" every "interval" seconds, so the
+# public can be sent to a CDN instead of the venue uplink.
+publish:
+  enabled: false
+  bucket: ""
+  # region: us-east-1
+  interval: 60
+
+# External commands run with the change or Tweet as JSON on stdin, with an optional
+# event list, timeout in seconds (Default 10) and limit of commands running at once.
+exec: []
+#  - command: /usr/local/bin/on-score
+#    args: []
+#    events: [first_blood, tweet, game_end]
+#    timeout: 10
+#    limit: 1
+
+# Starlark script with "filter" and "announce" functions, reloaded when changed.
+script:
+  file: ""
+
+# MQTT broker to publish changes and standings to, empty to disable.
+mqtt:
+  server: ""
+  client_id: ""
+  prefix: scoreboard
+  qos: 0
+  keepalive: 60
+
+# NATS or Kafka event bus to stream changes to, empty to disable.
+bus:
+  type: nats
+  server: ""
+  topic: scoreboard
+  buffer: 1024
+
+# Score history database, "sqlite" or "postgres", empty to disable.
+history:
+  type: sqlite
+  source: ""
+  # Seconds to keep every score sample for, older samples are rolled up to the last
+  # sample of each team in every "rollup" seconds. Scores and events older than
+  # "keep" seconds are removed. Zero keeps them forever.
+  retention:
+    raw: 0
+    keep: 0
+    rollup: 60
+    interval: 300
+
+# OpenTelemetry collector OTLP/HTTP traces URL, such as Jaeger or Tempo, empty to
+# disable. Headers are added to each request, for collectors that need auth.
+tracing:
+  endpoint: ""
+  service: scoreboard
+  headers: {}
+
+# Address to serve the gRPC API on, empty to disable. The gRPC server uses the TLS
+# certificate and key, which are required.
+grpc:
+  listen: ""
+
+# Debug server with pprof, a goroutine dump and the internal state, keep it bound to
+# localhost unless it is behind a firewall.
+debug:
+  enabled: false
+  listen: localhost:6060
+
+# Sentry DSN to report recovered panics to, empty to disable. Logged errors are also
+# reported if "errors" is true.
+sentry:
+  dsn: ""
+  environment: ""
+  errors: false
+
+# File to save the Game state to and the seconds between each save.
+state:
+  file: ""
+  interval: 30
+
+# Redis server to share the Game state and admin changes with other nodes, empty to
+# disable. The leader saves the state after every update and the state file is not used.
+cluster:
+  server: ""
+  prefix: scoreboard
+
+# Replication of the Game state to read-only replicas. The token enables the replication
+# endpoint on a primary, and a replica connects to the "primary" URL with the same token.
+replication:
+  primary: ""
+  token: ""
+
+# Bearer token for the admin API, empty to disable.
+admin:
+  token: ""
+  # Any value can be read from a file instead by adding "_file" to the name.
+  # token_file: /run/secrets/admin_token
+  # Only open staff WebSockets with a signed ticket from "/api/v1/ticket" or the token in
+  # the Authorization header, so the admin token in a display URL cannot be used to join
+  # the staff channel by anyone who sees the WebSocket URL on the venue network.
+  tickets: false
+  # Board tabs or pages the "/presenter" page switches the displays between, in order,
+  # and the seconds the unfreeze animation started from it takes.
+  presenter:
+    views: []
+    #  - overview
+    #  - /podium
+    reveal: 30
+  # Score adjustments, game switches and unfreezing are held until a second moderator
+  # approves them with their own token within "timeout" seconds, when any approvers are
+  # set. Approvers are listed by name, which is written to the audit log.
+  confirm:
+    approvers: {}
+    #  alice: <token>
+    timeout: 300
+  # Staff sign in backend, checked with the admin token, which is still required. Empty
+  # only accepts the admin token, "tokens" accepts the named tokens, "htpasswd" checks the
+  # users of an Apache htpasswd file ("-m" or "-s" hashes), "ldap" binds to the directory
+  # as the DN with "{user}" replaced and "oidc" signs in with an OpenID Connect provider at
+  # "/admin/login". Allow limits the LDAP and OIDC users by user name, email or group.
+  auth:
+    type: ""
+    # tokens:
+    #   alice: <token>
+    # file: /etc/scoreboard/htpasswd
+    # server: ldaps://ldap.example.com
+    # dn: "uid={user},ou=people,dc=example,dc=com"
+    # issuer: https://sso.example.com
+    # client_id: scoreboard
+    # client_secret: <secret>
+    # redirect_url: https://scoreboard.example.com/admin/callback
+    # allow: []
+
+# Security headers sent with every response. An empty policy uses the default Content
+# Security Policy, where "{nonce}" is replaced with the nonce given to the inline scripts
+# of each page. Only the "frames" paths can be framed, by the "ancestors" sources, so the
+# widgets can be embedded in stream overlays. HSTS is only sent when TLS is used.
+security:
+  policy: ""
+  referrer: strict-origin-when-cross-origin
+  frames:
+    - /podium
+    - /attacks
+  ancestors:
+    - "*"
+  hsts: 31536000
+  disabled: false
+
+# Limits of the HTTP server. Request bodies are limited to the "routes" limit of the
+# longest matching path prefix, or "body" if none match, in bytes. The header timeout is
+# the seconds a client has to send the request headers, and the idle timeout is the
+# seconds a keep-alive connection is kept open, both using "timeout" when zero. The
+# connection limits close new connections once there are "connections" open, or
+# "per_address" open from one address, and are disabled when zero. Venues often put
+# every display behind one address, so keep "per_address" above the display count.
+server:
+  routes:
+    /api/v1/admin/logos: 4194304
+  body: 1048576
+  headers: 32768
+  header_timeout: 0
+  idle_timeout: 0
+  connections: 0
+  per_address: 0
+
+# Limits of the public scoreboard at "/api/v1/public/scoreboard" for outside sites and
+# bots. Each address can make "burst" requests at once and "rate" requests a minute
+# after that, and the response is cached by clients and CDNs for "max_age" seconds.
+public:
+  rate: 60
+  burst: 10
+  max_age: 15
+
+# Secrets manager for "secret:<path>#<key>" values, "vault" or "aws", empty to disable.
+secrets:
+  type: ""
+  server: ""
+  region: ""
+
+# Time to freeze the display at (RFC3339), empty for no freeze.
+freeze: ""
+# Seconds to delay the public display by, requires history.
+delay: 0
+
+# Lock the final standings of each game once its game clock ends. Source updates after
+# the end are not shown and score adjustments and clock changes are refused until an
+# admin unlocks the game. "freeze" also freezes the display at the end time and
+# "podium" pins the podium view of the game when it ends.
+finale:
+  enabled: false
+  freeze: false
+  podium: false
+
+# Record the source responses to a fixture file, or play back a recorded fixture
+# instead of requesting the source. The start time (RFC3339) skips to that point
+# of the recording and the speed is the playback speed.
+fixture:
+  record: ""
+  replay: ""
+  start: ""
+  speed: 1
+
+# Additional Games, each with their own source and route.
+games: []
+#  - name: round2
+#    tick: 5
+#    source:
+#      type: ctfd
+#      url: https://ctfd.example.com
+
+# Independent scoreboards served under "/e/<name>/", each with its own config file.
+tenants: []
+#  - name: finals
+#    config: /etc/scoreboard/finals.yaml
+
+# Team divisions, by team name or ID.
+divisions: {}
+#  Alpha: Gold
+
+# Team Twitter handles, by team name or ID, shown on the team pages.
+handles: {}
+#  Alpha: "@alpha_team"
+
+# Team places on the attack map, by team name or ID, as [x, y] between 0 and 1.
+positions: {}
+#  Alpha: [0.2, 0.5]
+
+# Team metadata file, made by "scoreboard teams import" or the admin API, with the
+# display names, logos, divisions and countries merged with the source teams.
+teams: ""
+
+# Hide public team names, "number" or "codename", empty to show names.
+anonymize: ""
+
+# Team logo cache directory, empty to use the source logos.
+logos:
+  dir: ""
+  # Maximum logo width and height, in pixels.
+  size: 256
+
+# Public scoreboard URL for the "/qr.png" QR code, empty to use the request host, and
+# if the QR code is shown in the corner of the scoreboard.
+qr:
+  url: ""
+  widget: false
+
+# Memory limits, the oldest values are removed once a limit is reached.
+memory:
+  # Most Tweets shown at once.
+  tweets: 50
+  # Most ticker events kept for each Game.
+  events: 10
+  # Static files kept in memory, in megabytes, zero for no limit.
+  assets: 64
+  # WebSocket write buffer of each client, in kilobytes.
+  buffer: 1
+  # Most teams in each Game, a Game with more teams is not shown.
+  teams: 256
+
+# Default display language, used when the browser does not ask for a supported one.
+locale: en
+
+# Time zone (IANA name) that times are shown in, unless the viewer selects another.
+timezone: UTC
+
+# Game clock start and end times (RFC3339) and warning times, in minutes.
+clock:
+  start: ""
+  end: ""
+  warnings: [30, 10, 5, 1]
+  # Scheduled breaks (RFC3339), such as lunch.
+  breaks: []
+  #  - start: "2023-03-04T12:00:00Z"
+  #    end: "2023-03-04T13:00:00Z"
+  # Adaptive tick, in seconds, used in the "final" minutes of the clock and during
+  # breaks or while the clock is paused. Zero keeps the tick.
+  adaptive:
+    final: 0
+    fast: 0
+    slow: 0
+
+# Pre-game lobby shown until the clock start time, with a countdown, the slides shown in
+# turn every "rotate" seconds and the ticker. Displays switch to the scoreboard at the
+# start time. Images are paths on the Scoreboard or http(s) URLs.
+lobby:
+  enabled: false
+  title: ""
+  image: ""
+  rotate: 15
+  slides: []
+  #  - title: Rules
+  #    text: No attacking the scoring infrastructure.
+  #  - image: /image/credit/corporate/gigamon.png
+
+# Named display layouts, selected with "?profile=<name>" or assigned to the "?client=<name>"
+# of a display. Widgets not listed are hidden (all are shown if empty), the rotation is
+# the tabs cycled through every "interval" seconds, the resolution ("sd", "hd", "fhd" or
+# "uhd") scales the board and the theme is the stylesheet "style/theme/<theme>.css". The
+# pace sets the speed of the scrolling text and the length of the animations (1 is the
+# normal speed) and the seconds each standings tab is shown, zero for the normal pace.
+profiles: {}
+#  lobby:
+#    resolution: uhd
+#    theme: light
+#    widgets: [title, clock, ticker, sponsors, qr]
+#    rotation: [overview, matrix, beacons]
+#    interval: 20
+#    clients: [lobby-tv]
+#    pace:
+#      ticker: 0.5
+#      animation: 2
+#      flip: 30
+
+# Theme schedule of the displays. At each time of day ("HH:MM" in the timezone) every
+# display switches to the theme without reloading, until the next time. An empty theme
+# is the theme of the display profile. The admin API can set a theme that overrides it.
+themes:
+  schedule: []
+  #  - at: "07:00"
+  #    theme: light
+  #  - at: "19:00"
+  #    theme: dark
+
+# Sponsor carousel shown in a region of the displays ("top", "bottom", "left" or "right").
+# Each sponsor is shown for "rotate" seconds, as often as its weight, and only between
+# its optional start and end times (RFC3339).
+sponsors:
+  enabled: false
+  region: bottom
+  rotate: 10
+  list: []
+  #  - name: Gigamon
+  #    image: /image/credit/corporate/gigamon.png
+  #    link: https://www.gigamon.com/
+  #    weight: 3
+  #    start: "2023-03-04T20:00:00Z"
+  #    end: "2023-03-04T21:00:00Z"
+
+# Sounds and animations played by the displays for each change kind. Sounds are played
+# from "/sound/<sound>.mp3", such as a file in the override directory, and animations
+# are shown for "duration" seconds.
+effects: {}
+#  first_blood:
+#    sound: first-blood
+#    animation: flash
+#    duration: 3
+#  first_place:
+#    animation: shake
+#    duration: 2
+
+# Most changes added to the ticker of each game each minute, zero for no limit, with
+# the changes over the limit shown as a single summary. Collapse merges the changes of
+# the same kind and team found in one update, such as "Team 1: 5 services down".
+pacing:
+  rate: 0
+  collapse: false
+
+# Team sort keys, in order, and how tied teams are ranked ("shared" or "split").
+sort:
+  keys: [score]
+  ties: shared
+`
+
 const usage = `Scorebot Scoreboard v2.5
 
 Leaving any of the required Twitter options empty in command
@@ -69,16 +815,33 @@ Required Twitter options: 'Consumer Key and Secret', 'Access Key and Secret',
 'Twitter Keywords' and 'Twitter Language'.
 
 Usage of scoreboard:
-  -c <file>                 Scorebot configuration file path.
+  scoreboard [options]          Run the Scoreboard.
+  scoreboard validate [options] Check the config and exit, non-zero if any problems are found.
+  scoreboard defaults           Print a commented example YAML config and exit.
+  scoreboard import [options] <file...> Add event logs or score dumps to the history and exit.
+  scoreboard teams import [options] <file...> Add team metadata CSV files to the teams file and exit.
+  scoreboard archive [options]  Write the history, standings, events and audit log to a bundle and exit.
+  scoreboard loadtest -url <url> [loadtest options] Connect many WebSocket clients and report the results.
+
+Options:
+  -c <file>                 Scorebot configuration file path (JSON, YAML or TOML).
   -d                        Print default configuration and exit.
   -V                        Print version string and exit.
-  -sbe <url>                Scorebot core address or URL (Required without "-c").
+  -sbe <url>                Scorebot core address or URL (Required without "-c", "-ctfd" or "-simulate").
+  -ctfd <url>               CTFd address or URL, used as the source instead of Scorebot.
+  -ctfd-token <token>       CTFd API access token.
+  -ctfd-name <name>         CTFd Game display name (Default "CTFd").
+  -simulate <seed>          Show simulated Games generated from the non-zero seed, used instead of Scorebot.
   -assets <dir>             Scoreboard secondary assets override URL.
   -dir <directory>          Scoreboard HTML override directory path.
   -log <file>               Scoreboard log file path.
   -log-level <number [0-5]> Scoreboard logging level (Default 2).
+  -log-format <format>      Scoreboard log format, "console" or "json" (Default "console").
   -tick <seconds>           Scorebot poll tate, in seconds (Default 5).
   -timeout <seconds>        Scoreboard request timeout, in seconds (Default 10).
+  -workers <number>         Maximum concurrent source requests (Default 4).
+  -milestone <points>       Score milestone interval, zero to disable (Default 1000).
+  -stale <seconds>          Seconds without an update before not ready (Default 60).
   -bind <socket>            Address and port to listen on (Default "0.0.0.0:8080").
   -cert <file>              Path to TLS certificate file.
   -key <file>               Path to TLS key file.
@@ -92,6 +855,59 @@ Usage of scoreboard:
   -tw-block-words <list>    Twitter blocked words (Comma separated).
   -tw-block-user <list>     Twitter blocked Usernames (Comma separated).
   -tw-only-users <list>     Twitter whitelisted Usernames (Comma separated).
+  -webhook <url>            Webhook URL to send game events to.
+  -webhook-secret <secret>  Webhook HMAC signing secret.
+  -webhook-events <list>    Webhook event types to send (Comma separated, Default all).
+  -exec <command>           Command to run with each game event as JSON on stdin.
+  -exec-events <list>       Exec event types to run the command for (Comma separated, Default all).
+  -script <file>            Starlark script file with Tweet filter and announcement rules.
+  -mqtt <url>               MQTT server URL to publish game events to.
+  -mqtt-prefix <topic>      MQTT topic prefix (Default "scoreboard").
+  -nats <url>               NATS server URL to stream game events to.
+  -kafka <url>              Kafka REST Proxy URL to stream game events to.
+  -bus-topic <topic>        Event bus topic or subject prefix (Default "scoreboard").
+  -history <file>           SQLite database file to record score history to.
+  -otlp <url>               OpenTelemetry OTLP/HTTP traces URL to send update spans to.
+  -grpc <socket>            Address and port to serve the gRPC API on (Requires TLS).
+  -debug                    Start the pprof and debug state server.
+  -debug-bind <socket>      Debug server address and port (Default "localhost:6060").
+  -sentry <dsn>             Sentry DSN to report recovered panics to.
+  -state <file>             File to save and restore the Game state from.
+  -cluster <url>            Redis server URL to share the Game state and admin changes with.
+  -primary <url>            Primary Scoreboard URL to replicate the Game state from.
+  -replica-token <token>    Token required to replicate from this or the primary Scoreboard.
+  -admin-token <token>      Bearer token required to use the admin API.
+  -freeze <time>            Time to freeze the scoreboard display at (RFC3339).
+  -delay <seconds>          Public display delay, in seconds (Requires history).
+  -record <file>            Record the source responses to the fixture file.
+  -replay <file>            Play back the fixture file instead of requesting the source.
+  -sort <list>              Team sort keys, in order (Comma separated, Default "score").
+  -anonymize <mode>         Hide public team names ("number" or "codename").
+  -logos <dir>              Directory to cache and serve team logos from.
+  -teams <file>             Team metadata file, read at startup and written by "teams import".
+  -qr-url <url>             Public scoreboard URL to use in the QR code.
+  -qr                       Show the QR code in the corner of the scoreboard.
+  -locale <lang>            Default display language (Default "en").
+  -timezone <zone>          Display time zone, such as "America/New_York" (Default "UTC").
+  -end <time>               Game clock end time (RFC3339).
+  -proxy <url>              Proxy URL for outbound HTTP requests (http, https or socks5).
+  -no-proxy <list>          Hosts that are not sent through the proxy (Comma separated).
+  -watch                    Reload the config file when it is changed.
+  -set <name=value>         Override a config value, such as "tick=10" (Repeatable).
+  -check                    Validate only, also request the sources and check the Twitter keys.
+  -game <id>                Import only, the Game ID to add the records to (Default the ID in the file).
+                            Archive only, the only Game ID to archive (Default every Game).
+  -out <file>               Archive only, the bundle file to write (Default "archive.tar.gz").
+
+Loadtest Options:
+  -url <url>                Scoreboard URL to connect to, such as "wss://scoreboard.example.com".
+  -clients <number>         Number of WebSocket clients to connect (Default 1000).
+  -game <id>                Game ID the clients show (Default 1).
+  -name <name>              Name of the extra game the clients connect to.
+  -duration <seconds>       Length of the test, in seconds (Default 60).
+  -ramp <seconds>           Seconds to spread the first connections over (Default 30).
+  -churn <rate>             Share of clients that reload the page each minute (Default 0.02).
+  -timeout <seconds>        Connection timeout, in seconds (Default 10).
 
 Copyright (C) 2020 - 2023 iDigitalFlame
 
@@ -111,39 +927,146 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 `
 
 type log struct {
-	File  string `json:"file,omitempty"`
-	Level int    `json:"level"`
+	File   string `json:"file,omitempty"`
+	Format string `json:"format,omitempty"`
+	Level  int    `json:"level"`
+	Size   int    `json:"max_size,omitempty"`
+	Files  int    `json:"max_files,omitempty"`
 }
-type creds struct {
+
+// Credentials are the OAuth keys used to access the Twitter API. The access keys can
+// be left empty to use app-only auth with the filtered stream.
+type Credentials struct {
 	AccessKey      string `json:"access_key"`
 	ConsumerKey    string `json:"consumer_key"`
 	AccessSecret   string `json:"access_secret"`
 	ConsumerSecret string `json:"consumer_secret"`
 }
+type retry struct {
+	Attempts  int `json:"attempts"`
+	Threshold int `json:"threshold"`
+	Cooldown  int `json:"cooldown"`
+}
+type source struct {
+	Type string `json:"type"`
+	raw  json.RawMessage
+}
 type tweets struct {
-	Credentials creds  `json:"auth"`
-	Filter      filter `json:"filter"`
-	Expire      int    `json:"expire"`
+	Credentials Credentials   `json:"auth"`
+	Failover    []Credentials `json:"failover,omitempty"`
+	Filter      filter        `json:"filter"`
+	Channels    channels      `json:"channels,omitempty"`
+	Timeouts    deadline      `json:"timeouts"`
+	Expire      int           `json:"expire"`
+	Truncate    int           `json:"truncate,omitempty"`
+	Cooldown    int           `json:"cooldown,omitempty"`
+}
+type ranking struct {
+	Keys []string `json:"keys"`
+	Ties string   `json:"ties"`
+}
+type brackets map[string]string
+type schedule struct {
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Breaks   []recess `json:"breaks,omitempty"`
+	Warnings []int    `json:"warnings"`
+	Adaptive adaptive `json:"adaptive,omitempty"`
+}
+type recess struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+type adaptive struct {
+	Final int `json:"final"`
+	Fast  int `json:"fast"`
+	Slow  int `json:"slow"`
+}
+type state struct {
+	File     string `json:"file"`
+	Interval int    `json:"interval"`
+}
+type fixture struct {
+	Record string  `json:"record,omitempty"`
+	Replay string  `json:"replay,omitempty"`
+	Start  string  `json:"start,omitempty"`
+	Speed  float64 `json:"speed,omitempty"`
 }
 type config struct {
-	Scorebot  string `json:"scorebot"`
-	Key       string `json:"key,omitempty"`
-	Cert      string `json:"cert,omitempty"`
-	Directory string `json:"dir,omitempty"`
-	Assets    string `json:"assets"`
-	Listen    string `json:"listen"`
-	Log       log    `json:"log,omitempty"`
-	Twitter   tweets `json:"twitter,omitempty"`
-	Timeout   int    `json:"timeout"`
-	Tick      int    `json:"tick"`
+	Scorebot  string     `json:"scorebot"`
+	Key       string     `json:"key,omitempty"`
+	Cert      string     `json:"cert,omitempty"`
+	Directory string     `json:"dir,omitempty"`
+	Assets    string     `json:"assets"`
+	Listen    string     `json:"listen"`
+	Proxy     string     `json:"proxy,omitempty"`
+	NoProxy   string     `json:"no_proxy,omitempty"`
+	Log       log        `json:"log,omitempty"`
+	Retry     retry      `json:"retry,omitempty"`
+	Source    source     `json:"source,omitempty"`
+	Twitter   tweets     `json:"twitter,omitempty"`
+	Webhooks  []hook     `json:"webhooks,omitempty"`
+	Digests   []digest   `json:"digests,omitempty"`
+	Fallback  backup     `json:"fallback,omitempty"`
+	Publish   outlet     `json:"publish,omitempty"`
+	Exec      []command  `json:"exec,omitempty"`
+	Script    scripting  `json:"script,omitempty"`
+	MQTT      broker     `json:"mqtt,omitempty"`
+	Bus       sink       `json:"bus,omitempty"`
+	History   database   `json:"history,omitempty"`
+	Tracing   telemetry  `json:"tracing,omitempty"`
+	RPC       gateway    `json:"grpc,omitempty"`
+	Debug     debugger   `json:"debug,omitempty"`
+	Sentry    reporting  `json:"sentry,omitempty"`
+	State     state      `json:"state,omitempty"`
+	Cluster   clustering `json:"cluster,omitempty"`
+	Replicate mirroring  `json:"replication,omitempty"`
+	Admin     admin      `json:"admin,omitempty"`
+	Security  shield     `json:"security,omitempty"`
+	Server    serving    `json:"server,omitempty"`
+	Public    exposure   `json:"public,omitempty"`
+	Secrets   keystore   `json:"secrets,omitempty"`
+	Freeze    string     `json:"freeze,omitempty"`
+	Delay     int        `json:"delay,omitempty"`
+	Finale    closing    `json:"finale,omitempty"`
+	Fixture   fixture    `json:"fixture,omitempty"`
+	Games     []arena    `json:"games,omitempty"`
+	Tenants   []tenant   `json:"tenants,omitempty"`
+	Divisions brackets   `json:"divisions,omitempty"`
+	Handles   handles    `json:"handles,omitempty"`
+	Positions positions  `json:"positions,omitempty"`
+	Teams     string     `json:"teams,omitempty"`
+	Sort      ranking    `json:"sort,omitempty"`
+	Anonymize string     `json:"anonymize,omitempty"`
+	Logos     avatars    `json:"logos,omitempty"`
+	QR        qrcode     `json:"qr,omitempty"`
+	Memory    budget     `json:"memory,omitempty"`
+	Locale    string     `json:"locale"`
+	Timezone  string     `json:"timezone"`
+	Clock     schedule   `json:"clock,omitempty"`
+	Lobby     lobby      `json:"lobby,omitempty"`
+	Profiles  profiles   `json:"profiles,omitempty"`
+	Themes    shades     `json:"themes,omitempty"`
+	Sponsors  sponsors   `json:"sponsors,omitempty"`
+	Effects   effects    `json:"effects,omitempty"`
+	Pacing    pacing     `json:"pacing,omitempty"`
+	Timeout   int        `json:"timeout"`
+	Workers   int        `json:"workers"`
+	Milestone *int64     `json:"milestone,omitempty"`
+	Stale     int        `json:"stale"`
+	Tick      int        `json:"tick"`
+	Watch     bool       `json:"watch"`
+	dial      Dialer
 	twitter   bool
 }
 type filter struct {
-	Language     []string `json:"language"`
-	Keywords     []string `json:"keywords"`
-	OnlyUsers    []string `json:"only_users"`
-	BlockedUsers []string `json:"blocked_users"`
-	BlockedWords []string `json:"banned_words"`
+	Language     []string          `json:"language"`
+	Keywords     []string          `json:"keywords"`
+	OnlyUsers    []string          `json:"only_users"`
+	BlockedUsers []string          `json:"blocked_users"`
+	BlockedWords []string          `json:"banned_words"`
+	Wordlists    map[string]string `json:"wordlists,omitempty"`
+	Detect       float64           `json:"detect,omitempty"`
 }
 
 func split(s string) []string {
@@ -162,9 +1085,260 @@ func (e errval) Error() string {
 	}
 	return e.s + ": " + e.e.Error()
 }
+func (s *source) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	s.Type, s.raw = v.Type, append(s.raw[:0], b...)
+	return nil
+}
+func (s source) MarshalJSON() ([]byte, error) {
+	if len(s.raw) == 0 {
+		return []byte(`{"type":` + strconv.Quote(s.Type) + `}`), nil
+	}
+	return s.raw, nil
+}
+
+// interval returns the time between update ticks for the supplied source, in seconds.
+// The "interval" value in the source block replaces the supplied tick.
+func (s source) interval(t int) int {
+	var v struct {
+		Interval int `json:"interval"`
+	}
+	if len(s.raw) > 0 {
+		json.Unmarshal(s.raw, &v)
+	}
+	if v.Interval != 0 {
+		return v.Interval
+	}
+	return t
+}
+
+// watchdog returns the seconds that a running Game can go without changes from the
+// source before the source is restarted, from the "watchdog" value in the source block.
+func (s source) watchdog() int {
+	var v struct {
+		Watchdog int `json:"watchdog"`
+	}
+	if len(s.raw) > 0 {
+		json.Unmarshal(s.raw, &v)
+	}
+	return v.Watchdog
+}
+
+// skew returns the clock skew correction of the source from the "skew" value in the
+// source block, which is "auto" to use the measured skew or a fixed duration.
+func (s source) skew() (bool, time.Duration, error) {
+	var v struct {
+		Skew string `json:"skew"`
+	}
+	if len(s.raw) > 0 {
+		json.Unmarshal(s.raw, &v)
+	}
+	switch {
+	case len(v.Skew) == 0:
+		return false, 0, nil
+	case strings.EqualFold(v.Skew, "auto"):
+		return true, 0, nil
+	}
+	d, err := time.ParseDuration(v.Skew)
+	if err != nil {
+		return false, 0, &errval{s: `source skew "` + v.Skew + `" must be "auto" or a duration`}
+	}
+	return false, d, nil
+}
+
+// lanes returns the schedules of the Games of the source, from the "lanes" value in the
+// source block, by Game ID or by the "attack_defense" and "jeopardy" Game classes. The
+// interval and deadline are in seconds.
+func (s source) lanes() (map[string]game.Lane, error) {
+	var v struct {
+		Lanes map[string]struct {
+			Interval int `json:"interval"`
+			Deadline int `json:"deadline"`
+			Priority int `json:"priority"`
+		} `json:"lanes"`
+	}
+	if len(s.raw) > 0 {
+		if err := json.Unmarshal(s.raw, &v); err != nil {
+			return nil, &errval{s: "source lanes are invalid", e: err}
+		}
+	}
+	if len(v.Lanes) == 0 {
+		return nil, nil
+	}
+	r := make(map[string]game.Lane, len(v.Lanes))
+	for k, l := range v.Lanes {
+		if n := strings.ToLower(k); n == game.LaneAttackDefense || n == game.LaneJeopardy {
+			k = n
+		} else if _, err := strconv.ParseUint(k, 10, 64); err != nil {
+			return nil, &errval{s: `source lane "` + k + `" must be "attack_defense", "jeopardy" or a game ID`}
+		}
+		if l.Interval < 0 || l.Deadline < 0 {
+			return nil, &errval{s: `source lane "` + k + `" interval and deadline cannot be less than zero`}
+		}
+		r[k] = game.Lane{Interval: time.Duration(l.Interval) * time.Second, Deadline: time.Duration(l.Deadline) * time.Second, Priority: l.Priority}
+	}
+	return r, nil
+}
+
+// proxy returns the proxy URL and bypass list for the supplied source. The "proxy" and
+// "no_proxy" values in the source block replace the global values.
+func (c *config) proxy(s source) (string, string) {
+	var v struct {
+		Proxy   string `json:"proxy"`
+		NoProxy string `json:"no_proxy"`
+	}
+	if len(s.raw) > 0 {
+		json.Unmarshal(s.raw, &v)
+	}
+	if len(v.Proxy) == 0 {
+		v.Proxy = c.Proxy
+	}
+	if len(v.NoProxy) == 0 {
+		v.NoProxy = c.NoProxy
+	}
+	return v.Proxy, v.NoProxy
+}
+
+// speed returns the playback speed of the fixture, which is real time if not set.
+func (f fixture) speed() float64 {
+	if f.Speed == 0 {
+		return 1
+	}
+	return f.Speed
+}
+
+// decode parses the config file data using the format that matches the file extension.
+// YAML and TOML files are converted to JSON first, so every format uses the same names
+// as the JSON config. Any "<name>_file" values are replaced with the contents of the
+// file as the "<name>" value.
+func decode(f string, b []byte, c *config) error {
+	var (
+		v   interface{}
+		n   string
+		err error
+	)
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".yml", ".yaml":
+		n, err = "YAML", yaml.Unmarshal(b, &v)
+	case ".toml":
+		n, err = "TOML", toml.Unmarshal(b, &v)
+	default:
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		n, err = "JSON", d.Decode(&v)
+	}
+	if err != nil {
+		return &errval{s: "cannot parse " + n + ` from file "` + f + `"`, e: err}
+	}
+	if err = files(v); err != nil {
+		return &errval{s: `cannot read secret files from "` + f + `"`, e: err}
+	}
+	if b, err = json.Marshal(v); err == nil {
+		err = json.Unmarshal(b, c)
+	}
+	if err != nil {
+		return &errval{s: "cannot parse " + n + ` from file "` + f + `"`, e: err}
+	}
+	return nil
+}
 func (e errval) Unwrap() error {
 	return e.e
 }
+func (r *ranking) verify() error {
+	switch r.Ties = strings.ToLower(r.Ties); r.Ties {
+	case "", "shared", "split":
+		return nil
+	}
+	return &errval{s: `sort ties "` + r.Ties + `" must be "shared" or "split"`}
+}
+func (s *schedule) verify() error {
+	var b, e time.Time
+	if len(s.Start) > 0 {
+		var err error
+		if b, err = time.Parse(time.RFC3339, s.Start); err != nil {
+			return &errval{s: `clock start time "` + s.Start + `" is not a valid RFC3339 time`, e: err}
+		}
+	}
+	if len(s.End) > 0 {
+		var err error
+		if e, err = time.Parse(time.RFC3339, s.End); err != nil {
+			return &errval{s: `clock end time "` + s.End + `" is not a valid RFC3339 time`, e: err}
+		}
+	}
+	if !b.IsZero() && !e.IsZero() && !e.After(b) {
+		return &errval{s: "clock end time must be after the start time"}
+	}
+	for _, v := range s.Warnings {
+		if v <= 0 {
+			return &errval{s: "clock warning " + strconv.Itoa(v) + " must be greater than zero"}
+		}
+	}
+	for _, v := range s.Breaks {
+		a, err := time.Parse(time.RFC3339, v.Start)
+		if err != nil {
+			return &errval{s: `clock break start time "` + v.Start + `" is not a valid RFC3339 time`, e: err}
+		}
+		z, err := time.Parse(time.RFC3339, v.End)
+		if err != nil {
+			return &errval{s: `clock break end time "` + v.End + `" is not a valid RFC3339 time`, e: err}
+		}
+		if !z.After(a) {
+			return &errval{s: "clock break end time must be after the start time"}
+		}
+	}
+	if s.Adaptive.Final < 0 || s.Adaptive.Fast < 0 || s.Adaptive.Slow < 0 {
+		return &errval{s: "clock adaptive values cannot be less than zero"}
+	}
+	if (s.Adaptive.Final > 0) != (s.Adaptive.Fast > 0) {
+		return &errval{s: "clock adaptive final and fast values must be set together"}
+	}
+	return nil
+}
+func (s schedule) times() (time.Time, time.Time) {
+	var b, e time.Time
+	if len(s.Start) > 0 {
+		b, _ = time.Parse(time.RFC3339, s.Start)
+	}
+	if len(s.End) > 0 {
+		e, _ = time.Parse(time.RFC3339, s.End)
+	}
+	return b, e
+}
+func (s schedule) breaks() []game.Break {
+	o := make([]game.Break, len(s.Breaks))
+	for i := range s.Breaks {
+		o[i].Start, _ = time.Parse(time.RFC3339, s.Breaks[i].Start)
+		o[i].End, _ = time.Parse(time.RFC3339, s.Breaks[i].End)
+	}
+	return o
+}
+
+// pacing returns the final duration of the clock and the fast and slow ticks used by
+// the adaptive update interval.
+func (s schedule) pacing() (time.Duration, time.Duration, time.Duration) {
+	return time.Duration(s.Adaptive.Final) * time.Minute, time.Duration(s.Adaptive.Fast) * time.Second, time.Duration(s.Adaptive.Slow) * time.Second
+}
+func (s schedule) warnings() []time.Duration {
+	o := make([]time.Duration, len(s.Warnings))
+	for i := range s.Warnings {
+		o[i] = time.Duration(s.Warnings[i]) * time.Minute
+	}
+	return o
+}
+
+// milestone returns the score milestone interval, which is the default of 1000 points
+// when it is not set, so milestones are only disabled by setting it to zero.
+func (c *config) milestone() int64 {
+	if c.Milestone == nil {
+		return defaultMilestone
+	}
+	return *c.Milestone
+}
 func (c *config) verify() error {
 	if c.Tick <= 0 {
 		return &errval{s: "tick " + strconv.Itoa(c.Tick) + " cannot be less than or equal to zero"}
@@ -172,8 +1346,260 @@ func (c *config) verify() error {
 	if c.Timeout <= 0 {
 		return &errval{s: "timeout " + strconv.Itoa(c.Timeout) + " cannot be less than or equal to zero"}
 	}
-	if c.Log.Level < int(logx.Trace) || c.Log.Level > int(logx.Fatal) {
-		return &errval{s: "log level " + strconv.Itoa(c.Tick) + "  must be between zero and five"}
+	if err := c.Log.verify(); err != nil {
+		return err
+	}
+	// Replicas receive the Games from their primary, so they do not need a source.
+	if len(c.Replicate.Primary) > 0 {
+		if len(c.Source.Type) == 0 && len(c.Scorebot) == 0 {
+			c.Source.Type = "replica"
+		}
+		for i := range c.Games {
+			if len(c.Games[i].Source.Type) == 0 {
+				c.Games[i].Source.Type = "replica"
+			}
+		}
+	}
+	if len(c.Source.Type) == 0 {
+		if len(c.Scorebot) == 0 {
+			return &errval{s: "a Scorebot URL or source is required"}
+		}
+		c.Source.Type, c.Source.raw = "scorebot", json.RawMessage(`{"url":`+strconv.Quote(c.Scorebot)+`}`)
+	}
+	if _, err := game.Proxy(c.proxy(c.Source)); err != nil {
+		return &errval{s: "invalid proxy config", e: err}
+	}
+	if v := c.Source.interval(c.Tick); v <= 0 {
+		return &errval{s: "source interval " + strconv.Itoa(v) + " cannot be less than or equal to zero"}
+	}
+	if v := c.Source.watchdog(); v < 0 {
+		return &errval{s: "source watchdog " + strconv.Itoa(v) + " cannot be less than zero"}
+	}
+	if _, _, err := c.Source.skew(); err != nil {
+		return err
+	}
+	if _, err := c.Source.lanes(); err != nil {
+		return err
+	}
+	for i := range c.Games {
+		if _, err := game.Proxy(c.proxy(c.Games[i].Source)); err != nil {
+			return &errval{s: `invalid proxy config for game "` + c.Games[i].Name + `"`, e: err}
+		}
+		if _, err := c.Games[i].Source.lanes(); err != nil {
+			return &errval{s: `invalid source lanes for game "` + c.Games[i].Name + `"`, e: err}
+		}
+	}
+	if c.Milestone != nil && *c.Milestone < 0 {
+		return &errval{s: "milestone " + strconv.FormatInt(*c.Milestone, 10) + " cannot be less than zero"}
+	}
+	if c.Stale < 0 {
+		return &errval{s: "stale " + strconv.Itoa(c.Stale) + " cannot be less than zero"}
+	}
+	if len(c.Freeze) > 0 {
+		if _, err := time.Parse(time.RFC3339, c.Freeze); err != nil {
+			return &errval{s: `freeze time "` + c.Freeze + `" is not a valid RFC3339 time`, e: err}
+		}
+	}
+	if c.Delay < 0 {
+		return &errval{s: "delay " + strconv.Itoa(c.Delay) + " cannot be less than zero"}
+	}
+	if c.Delay > 0 && len(c.History.Source) == 0 {
+		return &errval{s: "a display delay requires a history source"}
+	}
+	if c.Delay > 0 && c.History.Retention.Raw > 0 && c.History.Retention.Raw <= c.Delay {
+		return &errval{s: "history retention raw must be greater than the display delay"}
+	}
+	if len(c.Fixture.Record) > 0 && len(c.Fixture.Replay) > 0 {
+		return &errval{s: "a fixture cannot be recorded and replayed at the same time"}
+	}
+	if c.Fixture.Speed < 0 {
+		return &errval{s: "fixture speed " + strconv.FormatFloat(c.Fixture.Speed, 'f', -1, 64) + " cannot be less than zero"}
+	}
+	if len(c.Fixture.Start) > 0 {
+		if _, err := time.Parse(time.RFC3339, c.Fixture.Start); err != nil {
+			return &errval{s: `fixture start time "` + c.Fixture.Start + `" is not a valid RFC3339 time`, e: err}
+		}
+	}
+	if c.State.Interval < 0 {
+		return &errval{s: "state interval " + strconv.Itoa(c.State.Interval) + " cannot be less than zero"}
+	}
+	if c.Workers < 0 {
+		return &errval{s: "workers " + strconv.Itoa(c.Workers) + " cannot be less than zero"}
+	}
+	if c.Retry.Attempts < 0 || c.Retry.Threshold < 0 || c.Retry.Cooldown < 0 {
+		return &errval{s: "retry values cannot be less than zero"}
+	}
+	if err := c.Secrets.verify(); err != nil {
+		return err
+	}
+	for i := range c.Webhooks {
+		if err := c.Webhooks[i].verify(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Exec {
+		if err := c.Exec[i].verify(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Tenants {
+		if err := c.Tenants[i].verify(); err != nil {
+			return err
+		}
+	}
+	if err := c.Script.verify(); err != nil {
+		return err
+	}
+	if err := c.Cluster.verify(); err != nil {
+		return err
+	}
+	if len(c.Cluster.Server) > 0 && len(c.State.File) > 0 {
+		return &errval{s: "state file cannot be used with a cluster, the state is saved in the cluster"}
+	}
+	if err := c.Replicate.verify(); err != nil {
+		return err
+	}
+	if err := c.Admin.Presenter.verify(); err != nil {
+		return err
+	}
+	if err := c.Admin.Confirm.verify(c.Admin.Token); err != nil {
+		return err
+	}
+	if err := c.Admin.Auth.verify(c.Admin.Token); err != nil {
+		return err
+	}
+	if c.Admin.Tickets && len(c.Admin.Token) == 0 {
+		return &errval{s: "admin tickets require the admin token to be set"}
+	}
+	if err := c.Security.verify(); err != nil {
+		return err
+	}
+	if err := c.Server.verify(); err != nil {
+		return err
+	}
+	if err := c.Public.verify(); err != nil {
+		return err
+	}
+	if err := c.Finale.verify(); err != nil {
+		return err
+	}
+	if len(c.Replicate.Primary) > 0 && (len(c.Cluster.Server) > 0 || len(c.State.File) > 0) {
+		return &errval{s: "a replica cannot use a cluster or state file, the state is sent by the primary"}
+	}
+	if err := c.Clock.verify(); err != nil {
+		return err
+	}
+	if err := c.Logos.verify(); err != nil {
+		return err
+	}
+	if err := c.QR.verify(); err != nil {
+		return err
+	}
+	if err := c.Memory.verify(); err != nil {
+		return err
+	}
+	if err := c.Twitter.Filter.verify(); err != nil {
+		return err
+	}
+	if err := c.Twitter.Channels.verify(); err != nil {
+		return err
+	}
+	if c.Twitter.Cooldown < 0 {
+		return &errval{s: "twitter cooldown " + strconv.Itoa(c.Twitter.Cooldown) + " cannot be less than zero"}
+	}
+	for i, v := range c.Twitter.Failover {
+		if !v.usable() {
+			return &errval{s: "twitter failover credentials " + strconv.Itoa(i+1) + " need both consumer keys and both or none of the access keys"}
+		}
+	}
+	if c.Twitter.Truncate < 0 {
+		return &errval{s: "twitter truncate " + strconv.Itoa(c.Twitter.Truncate) + " cannot be less than zero"}
+	}
+	if len(c.Locale) == 0 {
+		c.Locale = fallback
+	}
+	if len(c.Timezone) == 0 {
+		c.Timezone = "UTC"
+	}
+	if _, err := zone(c.Timezone); err != nil {
+		return err
+	}
+	if err := c.Handles.verify(); err != nil {
+		return err
+	}
+	if err := c.Positions.verify(); err != nil {
+		return err
+	}
+	if err := c.Lobby.verify(); err != nil {
+		return err
+	}
+	if err := c.Profiles.verify(); err != nil {
+		return err
+	}
+	if err := c.Themes.verify(); err != nil {
+		return err
+	}
+	if err := c.Fallback.verify(); err != nil {
+		return err
+	}
+	if err := c.Publish.verify(); err != nil {
+		return err
+	}
+	if err := c.Sponsors.verify(); err != nil {
+		return err
+	}
+	if err := c.Effects.verify(); err != nil {
+		return err
+	}
+	if err := c.Pacing.verify(); err != nil {
+		return err
+	}
+	if err := c.Sort.verify(); err != nil {
+		return err
+	}
+	for i := range c.Games {
+		if err := c.Games[i].verify(c.Tick); err != nil {
+			return err
+		}
+	}
+	for i := range c.Digests {
+		if err := c.Digests[i].verify(); err != nil {
+			return err
+		}
+		if len(c.Digests[i].Game) == 0 {
+			continue
+		}
+		c.Digests[i].Game = strings.ToLower(c.Digests[i].Game)
+		var ok bool
+		for x := range c.Games {
+			if ok = c.Games[x].Name == c.Digests[i].Game; ok {
+				break
+			}
+		}
+		if !ok {
+			return &errval{s: `digest "` + c.Digests[i].URL + `" game "` + c.Digests[i].Game + `" is not in "games"`}
+		}
+	}
+	if err := c.History.verify(); err != nil {
+		return err
+	}
+	if err := c.Bus.verify(); err != nil {
+		return err
+	}
+	if err := c.Tracing.verify(); err != nil {
+		return err
+	}
+	if err := c.RPC.verify(c); err != nil {
+		return err
+	}
+	if err := c.Debug.verify(); err != nil {
+		return err
+	}
+	if err := c.Sentry.verify(); err != nil {
+		return err
+	}
+	if err := c.MQTT.verify(); err != nil {
+		return err
 	}
 	if len(c.Listen) == 0 {
 		c.Listen = "0.0.0.0:8080"
@@ -181,15 +1607,16 @@ func (c *config) verify() error {
 	if c.twitter = true; len(c.Twitter.Filter.Language) == 0 || len(c.Twitter.Filter.Keywords) == 0 {
 		c.twitter = false
 	}
-	if len(c.Twitter.Credentials.AccessKey) == 0 || len(c.Twitter.Credentials.AccessSecret) == 0 {
-		c.twitter = false
-	}
-	if len(c.Twitter.Credentials.ConsumerKey) == 0 || len(c.Twitter.Credentials.ConsumerSecret) == 0 {
+	// Credentials without access keys use app-only auth.
+	if !c.Twitter.Credentials.usable() {
 		c.twitter = false
 	}
 	if c.twitter && c.Twitter.Expire <= 0 {
 		return &errval{s: "tweet expire time " + strconv.Itoa(c.Timeout) + " cannot be less than or equal to zero"}
 	}
+	if d := c.Twitter.Timeouts; d.Dial < 0 || d.TLS < 0 || d.Header < 0 || d.Stall < 0 {
+		return &errval{s: "twitter timeouts cannot be less than zero"}
+	}
 	return nil
 }
 
@@ -197,28 +1624,70 @@ func (c *config) verify() error {
 // parameters. This function will attempt to load the specified config file (if any) and fill in
 // the proper settings. This function returns an error if any issues occur. If both returns are nil
 // this means that the defaults are being printed and to bail out with a success status.
-func Cmdline() (*Scoreboard, error) {
+//
+// The Dialer replaces the Twitter API for every Twitter stream of the Scoreboard, such as
+// the Dial function of a FakeTwitter in tests. A nil Dialer uses the Twitter API.
+func Cmdline(d Dialer) (*Scoreboard, error) {
 	var (
 		c                     config
 		args                  = flag.NewFlagSet("Scorebot Scoreboard", flag.ExitOnError)
-		d, ver                bool
+		dv, ver               bool
 		twbWords, twoUsers    string
 		s, twk, twl, twbUsers string
+		ctfd, ctfdToken       string
+		ctfdName              string
+		simulate, milestone   int64
+		hookURL, hookSecret   string
+		hookEvents            string
+		execCommand           string
+		execEvents            string
+		mqttServer, mqttTopic string
+		nats, kafka, busTopic string
+		order, out            string
+		sets                  values
+		check                 bool
+		id                    uint64
+		a, cmd                = os.Args[1:], ""
 	)
+	if len(a) > 0 && (a[0] == "validate" || a[0] == "defaults" || a[0] == "import" || a[0] == "archive") {
+		cmd, a = a[0], a[1:]
+	}
+	if len(a) > 0 && a[0] == "loadtest" {
+		return nil, loadtest(a[1:])
+	}
+	if len(a) > 0 && a[0] == "teams" {
+		if len(a) < 2 || a[1] != "import" {
+			os.Stdout.WriteString(usage)
+			return nil, flag.ErrHelp
+		}
+		cmd, a = "teams", a[2:]
+	}
+	if cmd == "defaults" {
+		os.Stdout.WriteString(example)
+		return nil, nil
+	}
 	args.Usage = func() {
 		os.Stdout.WriteString(usage)
 		os.Exit(2)
 	}
 	args.StringVar(&s, "c", "", "")
-	args.BoolVar(&d, "d", false, "")
+	args.BoolVar(&dv, "d", false, "")
 	args.BoolVar(&ver, "V", false, "")
 	args.StringVar(&c.Scorebot, "sbe", "", "")
+	args.StringVar(&ctfd, "ctfd", "", "")
+	args.StringVar(&ctfdToken, "ctfd-token", "", "")
+	args.StringVar(&ctfdName, "ctfd-name", "", "")
+	args.Int64Var(&simulate, "simulate", 0, "")
 	args.StringVar(&c.Assets, "assets", "", "")
 	args.StringVar(&c.Directory, "dir", "", "")
 	args.StringVar(&c.Log.File, "log", "", "")
 	args.IntVar(&c.Log.Level, "log-level", 2, "")
+	args.StringVar(&c.Log.Format, "log-format", "console", "")
 	args.IntVar(&c.Tick, "tick", 5, "")
 	args.IntVar(&c.Timeout, "timeout", 10, "")
+	args.IntVar(&c.Workers, "workers", 4, "")
+	args.Int64Var(&milestone, "milestone", defaultMilestone, "")
+	args.IntVar(&c.Stale, "stale", 60, "")
 	args.StringVar(&c.Listen, "bind", "0.0.0.0:8080", "")
 	args.StringVar(&c.Key, "key", "", "")
 	args.StringVar(&c.Cert, "cert", "", "")
@@ -232,8 +1701,50 @@ func Cmdline() (*Scoreboard, error) {
 	args.StringVar(&twbWords, "tw-block-words", "", "")
 	args.StringVar(&twbUsers, "tw-block-user", "", "")
 	args.StringVar(&twoUsers, "tw-only-users", "", "")
+	args.StringVar(&hookURL, "webhook", "", "")
+	args.StringVar(&hookSecret, "webhook-secret", "", "")
+	args.StringVar(&hookEvents, "webhook-events", "", "")
+	args.StringVar(&execCommand, "exec", "", "")
+	args.StringVar(&execEvents, "exec-events", "", "")
+	args.StringVar(&c.Script.File, "script", "", "")
+	args.StringVar(&mqttServer, "mqtt", "", "")
+	args.StringVar(&mqttTopic, "mqtt-prefix", "scoreboard", "")
+	args.StringVar(&nats, "nats", "", "")
+	args.StringVar(&kafka, "kafka", "", "")
+	args.StringVar(&busTopic, "bus-topic", "scoreboard", "")
+	args.StringVar(&c.History.Source, "history", "", "")
+	args.StringVar(&c.Tracing.Endpoint, "otlp", "", "")
+	args.StringVar(&c.RPC.Listen, "grpc", "", "")
+	args.BoolVar(&c.Debug.Enabled, "debug", false, "")
+	args.StringVar(&c.Debug.Listen, "debug-bind", "localhost:6060", "")
+	args.StringVar(&c.Sentry.DSN, "sentry", "", "")
+	args.StringVar(&c.State.File, "state", "", "")
+	args.StringVar(&c.Cluster.Server, "cluster", "", "")
+	args.StringVar(&c.Replicate.Primary, "primary", "", "")
+	args.StringVar(&c.Replicate.Token, "replica-token", "", "")
+	args.StringVar(&c.Admin.Token, "admin-token", "", "")
+	args.StringVar(&c.Freeze, "freeze", "", "")
+	args.IntVar(&c.Delay, "delay", 0, "")
+	args.StringVar(&c.Fixture.Record, "record", "", "")
+	args.StringVar(&c.Fixture.Replay, "replay", "", "")
+	args.StringVar(&order, "sort", "", "")
+	args.StringVar(&c.Anonymize, "anonymize", "", "")
+	args.StringVar(&c.Logos.Dir, "logos", "", "")
+	args.StringVar(&c.Teams, "teams", "", "")
+	args.StringVar(&c.QR.URL, "qr-url", "", "")
+	args.BoolVar(&c.QR.Widget, "qr", false, "")
+	args.StringVar(&c.Locale, "locale", fallback, "")
+	args.StringVar(&c.Timezone, "timezone", "UTC", "")
+	args.StringVar(&c.Clock.End, "end", "", "")
+	args.StringVar(&c.Proxy, "proxy", "", "")
+	args.StringVar(&c.NoProxy, "no-proxy", "", "")
+	args.BoolVar(&c.Watch, "watch", false, "")
+	args.Var(&sets, "set", "")
+	args.BoolVar(&check, "check", false, "")
+	args.Uint64Var(&id, "game", 0, "")
+	args.StringVar(&out, "out", "", "")
 
-	if err := args.Parse(os.Args[1:]); err != nil {
+	if err := args.Parse(a); err != nil {
 		os.Stdout.WriteString(usage)
 		return nil, flag.ErrHelp
 	}
@@ -241,25 +1752,80 @@ func Cmdline() (*Scoreboard, error) {
 		os.Stdout.WriteString("Scorebot Scoreboard: " + version + "\n")
 		return nil, nil
 	}
-	if d {
+	if dv {
 		os.Stdout.WriteString(defaults)
 		return nil, nil
 	}
-	if len(s) == 0 && len(c.Scorebot) == 0 {
+	if cmd != "import" && cmd != "teams" && cmd != "archive" && len(s) == 0 && len(c.Scorebot) == 0 && len(ctfd) == 0 && simulate == 0 && len(sets) == 0 && !environ() {
 		os.Stdout.WriteString(usage)
 		return nil, flag.ErrHelp
 	}
 	c.Twitter.Filter.OnlyUsers = split(twoUsers)
 	c.Twitter.Filter.Language, c.Twitter.Filter.Keywords = split(twl), split(twk)
 	c.Twitter.Filter.BlockedUsers, c.Twitter.Filter.BlockedWords = split(twbUsers), split(twbWords)
-	if len(s) > 0 {
-		b, err := os.ReadFile(s)
-		if err != nil {
-			return nil, &errval{s: `cannot read file "` + s + `"`, e: err}
+	if len(ctfd) > 0 {
+		c.Source.Type = "ctfd"
+		c.Source.raw, _ = json.Marshal(map[string]string{"type": "ctfd", "url": ctfd, "token": ctfdToken, "name": ctfdName})
+	}
+	if simulate != 0 {
+		c.Source.Type = "simulator"
+		c.Source.raw, _ = json.Marshal(map[string]interface{}{"type": "simulator", "seed": simulate})
+	}
+	if len(hookURL) > 0 {
+		c.Webhooks = append(c.Webhooks, hook{URL: hookURL, Secret: hookSecret, Events: split(hookEvents)})
+	}
+	if len(execCommand) > 0 {
+		c.Exec = append(c.Exec, command{Command: execCommand, Events: split(execEvents)})
+	}
+	c.MQTT.Server, c.MQTT.Prefix = mqttServer, mqttTopic
+	c.Milestone = &milestone
+	c.Sort.Keys = split(order)
+	c.Clock.Warnings = []int{30, 10, 5, 1}
+	c.History.Type, c.State.Interval = "sqlite", 30
+	c.Twitter.Timeouts = deadline{Dial: 10, TLS: 10, Header: 30, Stall: 90}
+	c.Log.Files = 5
+	c.Memory = budget{Tweets: 50, Events: 10, Assets: 64, Buffer: 1, Teams: 256}
+	if c.Bus.Topic = busTopic; len(kafka) > 0 {
+		c.Bus.Type, c.Bus.Server = "kafka", kafka
+	} else {
+		c.Bus.Type, c.Bus.Server = "nats", nats
+	}
+	// The command line values are kept so they can be read again under the config
+	// file values when the config is reloaded.
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, &errval{s: "cannot save the command line config", e: err}
+	}
+	if c, err = load(b, s, sets); err != nil {
+		return nil, err
+	}
+	if cmd == "import" {
+		return nil, c.backfill(id, args.Args())
+	}
+	if cmd == "teams" {
+		return nil, c.enroll(args.Args())
+	}
+	if cmd == "archive" {
+		return nil, c.archive(id, out)
+	}
+	if cmd == "validate" {
+		r := c.validate(check)
+		for i := range r {
+			os.Stderr.WriteString("Error: " + r[i] + "!\n")
 		}
-		if err := json.Unmarshal(b, &c); err != nil {
-			return nil, &errval{s: `cannot parse JSON from file "` + s + `"`, e: err}
+		if len(r) > 0 {
+			return nil, &errval{s: "config is not valid"}
 		}
+		os.Stdout.WriteString("Config is valid.\n")
+		return nil, nil
+	}
+	w := c.copy()
+	w.dial = d
+	v, err := w.New()
+	if err != nil {
+		return nil, err
 	}
-	return c.New()
+	v.file, v.base, v.sets, v.conf = s, b, sets, c
+	v.revise("start", 0)
+	return v, nil
 }
@@ -0,0 +1,323 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PurpleSec/logx"
+)
+
+// heldMax is the most destructive admin requests waiting for approval at once, so a
+// leaked admin token cannot fill the memory with held requests.
+const heldMax = 64
+
+// confirm is the two person rule for destructive admin requests, such as score
+// adjustments. When approvers are set, these requests are held until an approver sends
+// their own token to approve it within the timeout in seconds.
+type confirm struct {
+	Approvers map[string]string `json:"approvers,omitempty"`
+	Timeout   int               `json:"timeout,omitempty"`
+}
+
+// approvals is the destructive admin requests waiting for approval. Requests are held
+// by the node that received them, so they must be approved on the same node.
+type approvals struct {
+	log     *journal
+	held    map[string]*approval
+	tokens  map[string]string
+	timeout time.Duration
+	lock    sync.Mutex
+}
+type approval struct {
+	Since   time.Time `json:"since"`
+	Expires time.Time `json:"expires"`
+	ID      string    `json:"id"`
+	Action  string    `json:"action"`
+	Path    string    `json:"path"`
+	Address string    `json:"address"`
+	Body    string    `json:"body"`
+
+	h      http.HandlerFunc
+	method string
+	kind   string
+	query  string
+}
+
+func (c confirm) verify(t string) error {
+	if len(c.Approvers) == 0 {
+		return nil
+	}
+	if len(t) == 0 {
+		return &errval{s: "admin approvers require the admin token to be set"}
+	}
+	if c.Timeout < 0 {
+		return &errval{s: "admin confirm timeout " + strconv.Itoa(c.Timeout) + " cannot be less than zero"}
+	}
+	k := make(map[string]string, len(c.Approvers))
+	for n, v := range c.Approvers {
+		if len(n) == 0 || len(v) == 0 {
+			return &errval{s: `admin approver "` + n + `" must have a name and token`}
+		}
+		// An approver using the admin token could approve their own requests, which
+		// defeats the second person.
+		if v == t {
+			return &errval{s: `admin approver "` + n + `" cannot use the admin token`}
+		}
+		if o, ok := k[v]; ok {
+			return &errval{s: `admin approvers "` + o + `" and "` + n + `" cannot use the same token`}
+		}
+		k[v] = n
+	}
+	return nil
+}
+func newApprovals(c confirm, l *journal) *approvals {
+	if len(c.Approvers) == 0 {
+		return nil
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 300
+	}
+	return &approvals{log: l, held: make(map[string]*approval), tokens: c.Approvers, timeout: time.Duration(c.Timeout) * time.Second}
+}
+
+// approver returns the name of the approver with the token in the request, or an empty
+// string if the token is not an approver token.
+func (a *approvals) approver(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) <= 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+	var n string
+	for k, v := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(h[7:]), []byte(v)) == 1 {
+			n = k
+		}
+	}
+	return n
+}
+
+// expire removes the requests that were not approved in time. This must be called with
+// the lock held.
+func (a *approvals) expire(n time.Time) {
+	for k, v := range a.held {
+		if v.Expires.After(n) {
+			continue
+		}
+		delete(a.held, k)
+		a.log.fields(logx.Warning, "Destructive admin request expired without approval.", map[string]interface{}{
+			"id": v.ID, "action": v.Action, "path": v.Path, "requester": v.Address,
+		})
+	}
+}
+
+// hold keeps the destructive request until it is approved and returns its ID to the
+// requester with a 202 status.
+func (a *approvals) hold(w http.ResponseWriter, r *http.Request, n string, b []byte, h http.HandlerFunc) {
+	var i [8]byte
+	rand.Read(i[:])
+	t := time.Now()
+	v := &approval{
+		h:       h,
+		ID:      hex.EncodeToString(i[:]),
+		Body:    string(b),
+		Path:    r.URL.Path,
+		kind:    r.Header.Get("Content-Type"),
+		query:   r.URL.RawQuery,
+		Since:   t.UTC(),
+		Action:  n,
+		method:  r.Method,
+		Address: r.RemoteAddr,
+		Expires: t.Add(a.timeout).UTC(),
+	}
+	a.lock.Lock()
+	if a.expire(t); len(a.held) >= heldMax {
+		a.lock.Unlock()
+		fail(w, "too many admin requests are waiting for approval", http.StatusTooManyRequests)
+		return
+	}
+	a.held[v.ID] = v
+	a.lock.Unlock()
+	a.log.request(r).fields(logx.Info, "Destructive admin request is waiting for approval.", map[string]interface{}{
+		"id": v.ID, "action": n, "path": v.Path, "requester": v.Address, "body": v.Body,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(v)
+}
+
+// list returns the requests waiting for approval, oldest first.
+func (a *approvals) list() []approval {
+	n := time.Now()
+	a.lock.Lock()
+	a.expire(n)
+	r := make([]approval, 0, len(a.held))
+	for _, v := range a.held {
+		r = append(r, *v)
+	}
+	a.lock.Unlock()
+	sort.Slice(r, func(i, j int) bool { return r[i].Since.Before(r[j].Since) })
+	return r
+}
+
+// take removes and returns the request with the ID, or nil if it does not exist or has
+// expired.
+func (a *approvals) take(i string) *approval {
+	a.lock.Lock()
+	a.expire(time.Now())
+	v := a.held[i]
+	delete(a.held, i)
+	a.lock.Unlock()
+	return v
+}
+
+// destructive returns the action of the admin request path if it needs approval.
+// Adjustments and game switches always change the scores shown, and unfreezing reveals
+// the hidden standings.
+func destructive(p string) string {
+	switch {
+	case strings.HasSuffix(p, "/api/v1/admin/adjustments"):
+		return "adjust"
+	case strings.HasSuffix(p, "/api/v1/admin/game/switch"):
+		return "switch"
+	case strings.HasSuffix(p, "/api/v1/admin/freeze"), strings.HasSuffix(p, "/api/v1/admin/presenter"):
+		return "unfreeze"
+	case strings.HasSuffix(p, "/api/v1/admin/finale"):
+		return "unlock"
+	}
+	return ""
+}
+
+// guard holds the request if it is destructive and approvers are set, and returns true
+// if the request was held. The body is read to check the action, and is replaced so the
+// handler can read it again.
+func (s *Scoreboard) guard(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) bool {
+	if s.pending == nil || r.Method != http.MethodPost {
+		return false
+	}
+	n := destructive(r.URL.Path)
+	if len(n) == 0 {
+		return false
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, adminBody))
+	if err != nil {
+		fail(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	// Only the unfreeze action of the freeze and presenter endpoints is destructive, a
+	// body that is not valid is rejected by the handler.
+	if n == "unfreeze" {
+		var c control
+		if json.Unmarshal(b, &c) != nil || !strings.EqualFold(c.Action, "unfreeze") {
+			return false
+		}
+	}
+	s.pending.hold(w, r, n, b, h)
+	return true
+}
+func (s *Scoreboard) httpApprovals(w http.ResponseWriter, r *http.Request) {
+	var (
+		a = s.pending.approver(r)
+		o = s.authorized(r, false)
+	)
+	if len(a) == 0 && !o {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scoreboard"`)
+		fail(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		s.log.request(r).Warning(`Rejected unauthorized approval request from "%s"!`, r.RemoteAddr)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.pending.list())
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c struct {
+		Action string `json:"action"`
+		ID     string `json:"id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	switch c.Action = strings.ToLower(c.Action); c.Action {
+	case "approve":
+		// Only an approver can approve, so the admin who sent the request cannot also
+		// approve it.
+		if len(a) == 0 {
+			fail(w, "an approver token is required to approve", http.StatusForbidden)
+			return
+		}
+	case "reject":
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	v := s.pending.take(c.ID)
+	if v == nil {
+		fail(w, `request "`+c.ID+`" is not waiting for approval`, http.StatusNotFound)
+		return
+	}
+	if len(a) == 0 {
+		a = "admin"
+	}
+	l := s.pending.log.request(r)
+	if c.Action == "reject" {
+		l.fields(logx.Info, "Destructive admin request was rejected.", map[string]interface{}{
+			"id": v.ID, "action": v.Action, "path": v.Path, "requester": v.Address, "rejected_by": a, "address": r.RemoteAddr,
+		})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	u := v.Path
+	if len(v.query) > 0 {
+		u += "?" + v.query
+	}
+	q, err := http.NewRequestWithContext(r.Context(), v.method, u, strings.NewReader(v.Body))
+	if err != nil {
+		fail(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The request is handled as the admin who sent it, so the handler logs and records
+	// the requester, and the response of the action is returned to the approver.
+	if q.RemoteAddr = v.Address; len(v.kind) > 0 {
+		q.Header.Set("Content-Type", v.kind)
+	}
+	d := &recorder{ResponseWriter: w}
+	s.perform(d, q, v.h)
+	l.fields(logx.Info, "Destructive admin request was approved.", map[string]interface{}{
+		"id": v.ID, "action": v.Action, "path": v.Path, "requester": v.Address, "approved_by": a, "address": r.RemoteAddr,
+		"status": d.code,
+	})
+}
@@ -0,0 +1,183 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+type chaos struct {
+	Drop      float64 `json:"drop,omitempty"`
+	Malformed float64 `json:"malformed,omitempty"`
+	Stall     float64 `json:"stall,omitempty"`
+	Slow      float64 `json:"slow,omitempty"`
+	Delay     int     `json:"delay,omitempty"`
+}
+type debugger struct {
+	Listen  string `json:"listen"`
+	Chaos   chaos  `json:"chaos"`
+	Enabled bool   `json:"enabled"`
+}
+type queue struct {
+	Name   string `json:"name"`
+	Length int    `json:"length"`
+	Size   int    `json:"size"`
+}
+type memory struct {
+	Alloc   uint64 `json:"alloc"`
+	Heap    uint64 `json:"heap_inuse"`
+	Objects uint64 `json:"heap_objects"`
+	System  uint64 `json:"sys"`
+	GC      uint32 `json:"num_gc"`
+}
+type inspection struct {
+	Time       time.Time             `json:"time"`
+	Games      map[string]game.State `json:"games"`
+	Queues     []queue               `json:"queues"`
+	Memory     memory                `json:"memory"`
+	Goroutines int                   `json:"goroutines"`
+}
+
+func (d debugger) verify() error {
+	if !d.Enabled {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(d.Listen); err != nil {
+		return &errval{s: `debug listen address "` + d.Listen + `" is not valid`, e: err}
+	}
+	return d.Chaos.verify()
+}
+func (c chaos) verify() error {
+	for _, v := range [...]struct {
+		n string
+		r float64
+	}{{"drop", c.Drop}, {"malformed", c.Malformed}, {"stall", c.Stall}, {"slow", c.Slow}} {
+		if v.r < 0 || v.r > 1 {
+			return &errval{s: "debug chaos " + v.n + " " + strconv.FormatFloat(v.r, 'f', -1, 64) + " must be between zero and one"}
+		}
+	}
+	if c.Delay < 0 {
+		return &errval{s: "debug chaos delay " + strconv.Itoa(c.Delay) + " cannot be less than zero"}
+	}
+	return nil
+}
+
+// rates returns the simulated failures injected into the Games. Chaos testing is only
+// used when the debug server is enabled, so it cannot be left on by a stray config
+// value. A slow client is held for 5 seconds if no delay is set.
+func (d debugger) rates() game.Chaos {
+	if !d.Enabled {
+		return game.Chaos{}
+	}
+	c := game.Chaos{
+		Drop:      d.Chaos.Drop,
+		Malformed: d.Chaos.Malformed,
+		Stall:     d.Chaos.Stall,
+		Slow:      d.Chaos.Slow,
+		Delay:     time.Duration(d.Chaos.Delay) * time.Second,
+	}
+	if c.Slow > 0 && c.Delay == 0 {
+		c.Delay = time.Second * 5
+	}
+	return c
+}
+
+// inspector returns the debug server, which has the pprof handlers, a goroutine dump
+// and the internal state of the Scoreboard. The debug server is kept separate from
+// the public server so it is not reachable unless it is bound to a public address.
+func (s *Scoreboard) inspector(d debugger, t time.Duration) *http.Server {
+	m := http.NewServeMux()
+	m.HandleFunc("/debug/pprof/", pprof.Index)
+	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	m.HandleFunc("/debug/goroutines", s.httpGoroutines)
+	m.HandleFunc("/debug/state", s.httpState)
+	m.HandleFunc("/debug/lifecycle", s.httpLifecycle)
+	s.Inspect()
+	for _, v := range s.games {
+		v.Inspect()
+	}
+	// The profile and trace handlers run for 30 seconds by default, so the write
+	// timeout cannot be the request timeout.
+	return &http.Server{
+		Addr:              d.Listen,
+		Handler:           m,
+		ErrorLog:          s.log.with("debug").logger(),
+		ReadTimeout:       t,
+		IdleTimeout:       t,
+		ReadHeaderTimeout: t,
+	}
+}
+func (s *Scoreboard) httpState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	v := inspection{
+		Time:       time.Now().UTC(),
+		Games:      map[string]game.State{"": s.State()},
+		Queues:     []queue{},
+		Memory:     memory{Alloc: m.Alloc, Heap: m.HeapInuse, Objects: m.HeapObjects, System: m.Sys, GC: m.NumGC},
+		Goroutines: runtime.NumGoroutine(),
+	}
+	for k, g := range s.games {
+		v.Games[k] = g.State()
+	}
+	for i := range s.hooks {
+		v.Queues = append(v.Queues, queue{Name: "webhook:" + s.hooks[i].url, Length: len(s.hooks[i].queue), Size: cap(s.hooks[i].queue)})
+	}
+	for i := range s.execs {
+		v.Queues = append(v.Queues, queue{Name: "exec:" + s.execs[i].name, Length: len(s.execs[i].queue), Size: cap(s.execs[i].queue)})
+	}
+	if s.mqtt != nil {
+		v.Queues = append(v.Queues, queue{Name: "mqtt", Length: len(s.mqtt.queue), Size: cap(s.mqtt.queue)})
+	}
+	if s.bus != nil {
+		v.Queues = append(v.Queues, queue{Name: "bus", Length: len(s.bus.queue), Size: cap(s.bus.queue)})
+	}
+	if s.store != nil {
+		v.Queues = append(v.Queues, queue{Name: "history", Length: len(s.store.queue), Size: cap(s.store.queue)})
+	}
+	if s.trace != nil {
+		v.Queues = append(v.Queues, queue{Name: "tracing", Length: len(s.trace.queue), Size: cap(s.trace.queue)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+func (s *Scoreboard) httpGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
@@ -0,0 +1,153 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"strings"
+	"unicode"
+)
+
+// common is the most used words of each language detected from the words of the text.
+// Words used by more than one language count for each of them, so only the difference
+// between the best and the next best language is used.
+var common = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "of", "to", "in", "that", "it", "for", "with", "you", "this", "on", "be", "have", "not", "what", "we", "they", "at", "but", "my", "your", "just", "will", "from", "all", "so", "can", "our", "has", "about"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "du", "ein", "eine", "zu", "mit", "auf", "den", "dem", "sie", "wir", "es", "für", "von", "sich", "auch", "wie", "noch", "aber", "bei", "heute", "sind", "mein", "hat"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "un", "una", "es", "por", "con", "para", "no", "lo", "se", "del", "al", "como", "más", "pero", "su", "muy", "está", "hoy", "yo", "este", "esta"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "que", "qui", "en", "pas", "pour", "dans", "sur", "avec", "je", "vous", "nous", "il", "elle", "ce", "cette", "du", "au", "mais", "très", "sont"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "em", "um", "uma", "é", "não", "para", "com", "do", "da", "dos", "das", "por", "no", "na", "mais", "mas", "eu", "você", "muito", "está", "isso", "hoje", "foi"},
+	"it": {"il", "lo", "la", "gli", "le", "di", "che", "e", "è", "un", "una", "per", "non", "con", "del", "della", "sono", "ma", "anche", "questo", "questa", "molto", "oggi", "io", "nel", "alla"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "met", "voor", "zijn", "ik", "je", "we", "maar", "ook", "wat", "nog", "bij", "naar", "heeft", "deze", "dit", "vandaag"},
+}
+
+// scripts is the language detected from text mostly written in a script that is only
+// used by one main language.
+var scripts = []struct {
+	t *unicode.RangeTable
+	n string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+}
+
+// detect returns the language of the text and the confidence from zero to one. An empty
+// language is returned if the language cannot be detected. Mentions, hashtags and links
+// are not used. About half of the words in most sentences are common words, so the
+// confidence is twice the share of words that the best language has over the next best
+// language, up to one.
+func detect(s string) (string, float64) {
+	var (
+		w []string
+		c = make(map[string]int, len(scripts))
+		k int
+	)
+	for _, v := range strings.Fields(strings.ToLower(s)) {
+		if v[0] == '@' || v[0] == '#' || strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			continue
+		}
+		for _, r := range v {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			k++
+			for i := range scripts {
+				if unicode.Is(scripts[i].t, r) {
+					c[scripts[i].n]++
+					break
+				}
+			}
+		}
+		w = append(w, strings.FieldsFunc(v, func(r rune) bool { return !unicode.IsLetter(r) })...)
+	}
+	if k == 0 {
+		return "", 0
+	}
+	// Japanese is written with Han characters too, so any kana marks the text as
+	// Japanese.
+	if c["ja"] > 0 {
+		c["ja"] += c["zh"]
+		delete(c, "zh")
+	}
+	for n, v := range c {
+		if v*2 > k {
+			return n, float64(v) / float64(k)
+		}
+	}
+	if len(w) == 0 {
+		return "", 0
+	}
+	var (
+		b    string
+		x, y int
+	)
+	for n, l := range common {
+		var v int
+		for i := range w {
+			for z := range l {
+				if w[i] == l[z] {
+					v++
+					break
+				}
+			}
+		}
+		switch {
+		case v > x:
+			b, x, y = n, v, x
+		case v > y:
+			y = v
+		}
+	}
+	if x == 0 {
+		return "", 0
+	}
+	if r := float64(x-y) * 2 / float64(len(w)); r < 1 {
+		return b, r
+	}
+	return b, 1
+}
+
+// language returns true if the Tweet is in one of the filter languages. Tweets that
+// Twitter did not tag with a language are detected here, and only pass if one of the
+// filter languages is detected with at least the detect confidence.
+func (f filter) language(l, s string) bool {
+	if len(f.Language) == 0 {
+		return true
+	}
+	if len(l) == 0 || l == "und" {
+		n, r := detect(s)
+		if r < f.Detect {
+			return false
+		}
+		l = n
+	}
+	if i := strings.IndexByte(l, '-'); i > 0 {
+		l = l[:i]
+	}
+	for i := range f.Language {
+		if strings.EqualFold(f.Language[i], l) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// digestName is the widest team name in a text digest, longer names are cut.
+const digestName = 24
+
+// digest is a channel that is posted the standings of each Game every few minutes,
+// apart from the real time event webhooks. The Game is the name of a game in "games",
+// or empty for the main source. The Template, if set, is a Go template that writes the
+// JSON payload of each post, such as a Discord embed, in place of the default message.
+type digest struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	Game     string `json:"game,omitempty"`
+	Division string `json:"division,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Template string `json:"template,omitempty"`
+	Every    int    `json:"every"`
+	Top      int    `json:"top,omitempty"`
+	Image    bool   `json:"image,omitempty"`
+}
+type poster struct {
+	log      logx.Log
+	client   *http.Client
+	games    *game.Manager
+	zone     func() *time.Location
+	leader   func() bool
+	posted   map[uint64]time.Time
+	template *template.Template
+	lock     sync.Mutex
+	digest
+}
+
+// headline is the data of a digest template. The Title and Table are the parts of the
+// default message, and the Image is the link to the snapshot image of the standings if
+// the public link of the Scoreboard is set.
+type headline struct {
+	Time     time.Time
+	Game     string
+	Division string
+	Title    string
+	Table    string
+	Image    string
+	Teams    []game.Standing
+}
+
+func (d digest) verify() error {
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return &errval{s: `digest URL "` + d.URL + `" is not valid`}
+	}
+	switch d.Type {
+	case "discord", "slack":
+	default:
+		return &errval{s: `digest "` + d.URL + `" type "` + d.Type + `" must be "discord" or "slack"`}
+	}
+	if d.Every < 1 {
+		return &errval{s: `digest "` + d.URL + `" every ` + strconv.Itoa(d.Every) + " must be at least one minute"}
+	}
+	if d.Top < 0 || d.Top > snapRows {
+		return &errval{s: `digest "` + d.URL + `" top ` + strconv.Itoa(d.Top) + " must be between 1 and " + strconv.Itoa(snapRows)}
+	}
+	// Slack webhooks cannot upload files, so the image is linked from the snapshot
+	// endpoint of the Scoreboard instead.
+	if d.Image && d.Type == "slack" {
+		if u, err := url.Parse(d.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return &errval{s: `digest "` + d.URL + `" needs the public "link" of the Scoreboard to show images on Slack`}
+		}
+	}
+	if len(d.Template) > 0 {
+		e := headline{Game: "Example", Teams: []game.Standing{{Name: "Example", ID: 1, Rank: 1}}}
+		t, err := phrase(d.URL, d.Template, e)
+		if err != nil {
+			return &errval{s: `digest "` + d.URL + `" template is not valid`, e: err}
+		}
+		// Discord and Slack only accept JSON payloads, so a template that does not
+		// write JSON is refused now instead of on every post.
+		if b, _ := word(t, e); !json.Valid(b) {
+			return &errval{s: `digest "` + d.URL + `" template does not write a JSON payload`}
+		}
+	}
+	return nil
+}
+func newPoster(d digest, c *http.Client, l logx.Log) *poster {
+	if d.Top == 0 {
+		d.Top = snapRows
+	}
+	d.Link = strings.TrimRight(d.Link, "/")
+	p := &poster{log: l, client: c, digest: d, posted: make(map[uint64]time.Time)}
+	if len(d.Template) > 0 {
+		// The template was checked when the config was loaded.
+		p.template, _ = phrase(d.URL, d.Template, nil)
+	}
+	return p
+}
+
+// attach adds the Manager of the digest Game. The Watch function keeps the active Games
+// subscribed and gives the IDs of the Games to post.
+func (p *poster) attach(m *game.Manager) {
+	p.games = m
+	m.Watch(p.watch)
+}
+func (p *poster) watch(v game.Snapshot) {
+	p.lock.Lock()
+	if _, ok := p.posted[v.GameID]; !ok {
+		p.posted[v.GameID] = time.Time{}
+	}
+	p.lock.Unlock()
+}
+func (p *poster) start(x context.Context) {
+	t := time.NewTicker(time.Duration(p.Every) * time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+			if p.leader != nil && !p.leader() {
+				continue
+			}
+			p.post(x)
+		}
+	}
+}
+
+// post sends the standings of each Game to the channel. The standings shown on the
+// display are used, so a frozen Game does not leak its live standings, and Games with
+// standings that have not changed since the last digest are skipped.
+func (p *poster) post(x context.Context) {
+	p.lock.Lock()
+	g := make([]uint64, 0, len(p.posted))
+	for i := range p.posted {
+		g = append(g, i)
+	}
+	p.lock.Unlock()
+	sort.Slice(g, func(i, j int) bool { return g[i] < g[j] })
+	for _, i := range g {
+		v, ok := p.games.Displayed(i)
+		if !ok {
+			continue
+		}
+		if v = p.games.Mask(v); len(p.Division) > 0 {
+			v = v.Division(p.Division)
+		}
+		p.lock.Lock()
+		s := p.posted[i].Equal(v.Time)
+		p.lock.Unlock()
+		if s || len(v.Teams) == 0 {
+			continue
+		}
+		if err := p.send(x, v); err != nil {
+			p.log.Error(`Digest "%s" for Game %d failed: %s!`, p.URL, i, err.Error())
+			continue
+		}
+		p.lock.Lock()
+		p.posted[i] = v.Time
+		p.lock.Unlock()
+		p.log.Trace(`Posted the standings of Game %d to digest "%s".`, i, p.URL)
+	}
+}
+func (p *poster) send(x context.Context, v game.Snapshot) error {
+	var (
+		b bytes.Buffer
+		c = "application/json"
+		h = p.title(v)
+		t []byte
+	)
+	if p.template != nil {
+		var err error
+		if t, err = word(p.template, p.headline(v, h)); err != nil {
+			return err
+		}
+	}
+	switch {
+	case p.Type == "discord" && p.Image:
+		w := multipart.NewWriter(&b)
+		if t == nil {
+			t, _ = json.Marshal(map[string]string{"content": h})
+		}
+		w.WriteField("payload_json", string(t))
+		f, err := w.CreateFormFile("files[0]", "standings.png")
+		if err != nil {
+			return err
+		}
+		if err = png.Encode(f, render(v, p.Top, p.zone())); err != nil {
+			return err
+		}
+		w.Close()
+		c = w.FormDataContentType()
+	case t != nil:
+		b.Write(t)
+	case p.Type == "discord":
+		json.NewEncoder(&b).Encode(map[string]string{"content": h + "\n" + p.table(v)})
+	case p.Image:
+		json.NewEncoder(&b).Encode(map[string]interface{}{
+			"text": h,
+			"blocks": []map[string]interface{}{
+				{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": h}},
+				{"type": "image", "image_url": p.image(v), "alt_text": v.Game + " standings"},
+			},
+		})
+	default:
+		json.NewEncoder(&b).Encode(map[string]string{"text": h + "\n" + p.table(v)})
+	}
+	r, err := http.NewRequestWithContext(x, http.MethodPost, p.URL, &b)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", c)
+	r.Header.Set("User-Agent", "Scorebot-Scoreboard")
+	o, err := p.client.Do(r)
+	if err != nil {
+		return err
+	}
+	o.Body.Close()
+	if o.StatusCode >= 300 {
+		return &errval{s: "status code " + strconv.Itoa(o.StatusCode) + " returned"}
+	}
+	return nil
+}
+
+// headline returns the data of the digest template for the standings.
+func (p *poster) headline(v game.Snapshot, h string) headline {
+	d := headline{Time: v.Time.In(p.zone()), Game: v.Game, Division: p.Division, Title: h, Table: p.table(v)}
+	if len(p.Link) > 0 {
+		d.Image = p.image(v)
+	}
+	if d.Teams = v.Teams; len(d.Teams) > p.Top {
+		d.Teams = d.Teams[:p.Top]
+	}
+	return d
+}
+
+// title returns the first line of the digest, with the Game name in bold.
+func (p *poster) title(v game.Snapshot) string {
+	n := v.Game
+	if len(p.Division) > 0 {
+		n += " (" + p.Division + ")"
+	}
+	// Discord uses double asterisks for bold text, Slack uses single asterisks.
+	if p.Type == "discord" {
+		n = "**" + n + "**"
+	} else {
+		n = "*" + n + "*"
+	}
+	return n + " standings at " + v.Time.In(p.zone()).Format("15:04 MST")
+}
+
+// table returns the top teams as a code block, so the columns line up in the
+// fixed width font.
+func (p *poster) table(v game.Snapshot) string {
+	var b strings.Builder
+	b.WriteString("```\n")
+	for i := 0; i < len(v.Teams) && i < p.Top; i++ {
+		n := strings.ReplaceAll(v.Teams[i].Name, "`", "'")
+		if utf8.RuneCountInString(n) > digestName {
+			n = string([]rune(n)[:digestName-1]) + "~"
+		}
+		if r := strconv.FormatInt(v.Teams[i].Rank, 10); len(r) < 3 {
+			b.WriteString(strings.Repeat(" ", 3-len(r)) + r)
+		} else {
+			b.WriteString(r)
+		}
+		b.WriteString("  " + n + strings.Repeat(" ", digestName-utf8.RuneCountInString(n)))
+		b.WriteString("  " + strconv.FormatInt(v.Teams[i].Score, 10) + "\n")
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+// image returns the link to the snapshot image of the standings. The time of the
+// standings is added so Slack does not show a cached image of an older digest.
+func (p *poster) image(v game.Snapshot) string {
+	q := url.Values{"game": {strconv.FormatUint(v.GameID, 10)}, "top": {strconv.Itoa(p.Top)}, "t": {strconv.FormatInt(v.Time.Unix(), 10)}}
+	if len(p.Game) > 0 {
+		q.Set("name", p.Game)
+	}
+	if len(p.Division) > 0 {
+		q.Set("division", p.Division)
+	}
+	return p.Link + "/api/v1/snapshot.png?" + q.Encode()
+}
@@ -0,0 +1,182 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// identifyMax is the longest time in seconds that a Display can be asked to show its ID.
+const identifyMax = 300
+
+type screen struct {
+	Name string `json:"name,omitempty"`
+	game.Display
+}
+type directive struct {
+	Name    string `json:"name"`
+	Display uint64 `json:"display"`
+	game.Command
+}
+
+func (c *directive) verify() string {
+	switch c.Action {
+	case game.Reload, game.ClearCache:
+	case game.Identify:
+		if c.Duration < 0 || c.Duration > identifyMax {
+			return "identify duration must be between 0 and " + strconv.Itoa(identifyMax) + " seconds"
+		}
+	case game.Profile:
+		if !slug(c.View) {
+			return `profile "` + c.View + `" is not valid`
+		}
+	case game.Theme:
+		if len(c.View) > 0 && !slug(c.View) {
+			return `theme "` + c.View + `" is not valid`
+		}
+	case game.Pacing:
+		if c.Pace == nil {
+			return "pace is required"
+		}
+		if len(c.View) > 0 && !slug(c.View) {
+			return `profile "` + c.View + `" is not valid`
+		}
+		if v := tempo(*c.Pace); len(v) > 0 {
+			return v
+		}
+	case game.SwitchView:
+		if !view(c.View) {
+			return `view "` + c.View + `" must be a board tab or a page path`
+		}
+	default:
+		return `action "` + c.Action + `" is not valid`
+	}
+	return ""
+}
+
+// view returns true if the view is a board tab, such as "overview" or "game-team-t1", or
+// a page path on the Scoreboard, such as "/podium".
+func view(s string) bool {
+	if len(s) == 0 || len(s) > 128 || strings.HasPrefix(s, "//") {
+		return false
+	}
+	for i := range s {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_':
+		case c == '/' && s[0] == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// command sends the Command to the Display through the Manager of the game it shows.
+func (s *Scoreboard) command(d *screen, c game.Command) bool {
+	m := s.Manager
+	if len(d.Name) > 0 {
+		if m = s.games[d.Name]; m == nil {
+			return false
+		}
+	}
+	return m.Command(d.ID, c)
+}
+
+// screens returns the Displays of the main game and each extra game, ordered by ID.
+func (s *Scoreboard) screens() []screen {
+	var r []screen
+	for _, d := range s.Manager.Displays() {
+		r = append(r, screen{Display: d})
+	}
+	for n, m := range s.games {
+		for _, d := range m.Displays() {
+			r = append(r, screen{Name: n, Display: d})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	return r
+}
+func (s *Scoreboard) httpDisplays(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		v := s.screens()
+		if v == nil {
+			v = []screen{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	// Displays are connected to a single node of the cluster, so Commands relayed by
+	// another node are ignored, as the Display IDs of each node are different.
+	if _, ok := r.Context().Value(clusterKey{}).(string); ok {
+		return
+	}
+	var c directive
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	if c.Action = strings.ToLower(c.Action); len(c.Action) == 0 {
+		fail(w, "action is required", http.StatusBadRequest)
+		return
+	}
+	if v := c.verify(); len(v) > 0 {
+		fail(w, v, http.StatusBadRequest)
+		return
+	}
+	m := []*game.Manager{s.Manager}
+	if len(c.Name) > 0 {
+		g, ok := s.games[strings.ToLower(c.Name)]
+		if !ok {
+			fail(w, `game "`+c.Name+`" does not exist`, http.StatusNotFound)
+			return
+		}
+		m = []*game.Manager{g}
+	} else {
+		for _, g := range s.games {
+			m = append(m, g)
+		}
+	}
+	var ok bool
+	for _, g := range m {
+		if g.Command(c.Display, c.Command) {
+			ok = true
+		}
+	}
+	if !ok {
+		fail(w, "display "+strconv.FormatUint(c.Display, 10)+" is not connected", http.StatusNotFound)
+		return
+	}
+	if c.Display == 0 {
+		s.log.request(r).Info(`Admin "%s" sent the "%s" command to every display.`, r.RemoteAddr, c.Action)
+	} else {
+		s.log.request(r).Info(`Admin "%s" sent the "%s" command to display %d.`, r.RemoteAddr, c.Action, c.Display)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
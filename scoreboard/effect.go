@@ -0,0 +1,69 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"strconv"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// effects maps Change kinds, such as "first_blood", to the sound and animation played
+// by the displays when a Change of that kind is sent.
+type effects map[string]game.Effect
+
+// cue returns true if the sound or animation name only contains lowercase letters,
+// numbers, dashes and underscores, as it is used in file and class names.
+func cue(s string) bool {
+	for i := range s {
+		switch v := s[i]; {
+		case v >= 'a' && v <= 'z', v >= '0' && v <= '9', v == '-', v == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+func (e effects) verify() error {
+	for k, v := range e {
+		if _, ok := game.ParseKind(k); !ok {
+			return &errval{s: `effect kind "` + k + `" is not a valid change kind`}
+		}
+		if !cue(v.Sound) {
+			return &errval{s: `effect sound "` + v.Sound + `" can only contain lowercase letters, numbers, dashes and underscores`}
+		}
+		if !cue(v.Animation) {
+			return &errval{s: `effect animation "` + v.Animation + `" can only contain lowercase letters, numbers, dashes and underscores`}
+		}
+		if v.Duration < 0 {
+			return &errval{s: "effect duration " + strconv.Itoa(v.Duration) + " cannot be less than zero"}
+		}
+	}
+	return nil
+}
+func (e effects) kinds() map[game.Kind]game.Effect {
+	if len(e) == 0 {
+		return nil
+	}
+	r := make(map[game.Kind]game.Effect, len(e))
+	for k, v := range e {
+		if n, ok := game.ParseKind(k); ok {
+			r[n] = v
+		}
+	}
+	return r
+}
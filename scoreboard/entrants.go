@@ -0,0 +1,268 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// columns is the team metadata CSV column names, by each name that is accepted for it.
+var columns = map[string]string{
+	"id":           "id",
+	"team_id":      "id",
+	"name":         "name",
+	"team":         "name",
+	"team_name":    "name",
+	"display":      "display",
+	"display_name": "display",
+	"logo":         "logo",
+	"logo_url":     "logo",
+	"division":     "division",
+	"country":      "country",
+	"affiliation":  "affiliation",
+}
+
+// entrants reads the team metadata file, which is a JSON list of the teams. A missing
+// file is an empty list, as it is created by the first import.
+func entrants(f string) ([]game.Entrant, error) {
+	b, err := os.ReadFile(f)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &errval{s: `cannot read teams file "` + f + `"`, e: err}
+	}
+	var l []game.Entrant
+	if err = json.Unmarshal(b, &l); err != nil {
+		return nil, &errval{s: `cannot parse teams file "` + f + `"`, e: err}
+	}
+	return l, nil
+}
+func enlist(f string, l []game.Entrant) error {
+	b, err := json.MarshalIndent(l, "", "    ")
+	if err == nil {
+		err = os.WriteFile(f, b, 0640)
+	}
+	if err != nil {
+		return &errval{s: `cannot write teams file "` + f + `"`, e: err}
+	}
+	return nil
+}
+
+// tabulateTeams reads the team metadata CSV. The first row names the columns, which
+// are any of "id", "name", "display", "logo", "division", "country" and "affiliation",
+// and each row needs an ID or a name. Empty values are kept as the Source values.
+func tabulateTeams(r io.Reader) ([]game.Entrant, error) {
+	var (
+		c = csv.NewReader(r)
+		k = make(map[string]int)
+	)
+	c.FieldsPerRecord = -1
+	h, err := c.Read()
+	if err != nil {
+		return nil, &errval{s: "cannot read the teams header", e: err}
+	}
+	for i := range h {
+		n := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h[i], "\ufeff"))), " ", "_")
+		if v, ok := columns[n]; ok {
+			k[v] = i + 1
+		}
+	}
+	if k["id"] == 0 && k["name"] == 0 {
+		return nil, &errval{s: `teams are missing the "id" and "name" columns, one is required`}
+	}
+	var o []game.Entrant
+	for l := 2; ; l++ {
+		v, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &errval{s: "cannot read the teams", e: err}
+		}
+		get := func(s string) string {
+			if i := k[s]; i > 0 && i <= len(v) {
+				return strings.TrimSpace(v[i-1])
+			}
+			return ""
+		}
+		e := game.Entrant{Name: get("name"), Display: get("display"), Logo: get("logo"), Division: get("division"), Country: strings.ToUpper(get("country")), Affiliation: get("affiliation")}
+		if x := get("id"); len(x) > 0 {
+			if e.ID, err = strconv.ParseUint(x, 10, 64); err != nil {
+				return nil, &errval{s: "teams line " + strconv.Itoa(l) + ` ID "` + x + `" is not valid`}
+			}
+		}
+		if e.ID == 0 && len(e.Name) == 0 {
+			return nil, &errval{s: "teams line " + strconv.Itoa(l) + " needs an ID or a name"}
+		}
+		if len(e.Logo) > 0 {
+			if u, err := url.Parse(e.Logo); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				return nil, &errval{s: "teams line " + strconv.Itoa(l) + ` logo "` + e.Logo + `" must be an absolute http or https URL`}
+			}
+		}
+		o = append(o, e)
+	}
+	return o, nil
+}
+
+// merge returns the team metadata with the imported teams added. An imported team
+// replaces the values of a team with the same ID, or the same name when either has no
+// ID, and the values it does not set are kept.
+func merge(l, n []game.Entrant) []game.Entrant {
+	o := make([]game.Entrant, len(l), len(l)+len(n))
+	copy(o, l)
+	for _, v := range n {
+		i := -1
+		for x := range o {
+			if (v.ID > 0 && o[x].ID > 0 && v.ID == o[x].ID) || ((v.ID == 0 || o[x].ID == 0) && len(v.Name) > 0 && strings.EqualFold(v.Name, o[x].Name)) {
+				i = x
+				break
+			}
+		}
+		if i == -1 {
+			o = append(o, v)
+			continue
+		}
+		if v.ID > 0 {
+			o[i].ID = v.ID
+		}
+		if len(v.Name) > 0 {
+			o[i].Name = v.Name
+		}
+		if len(v.Display) > 0 {
+			o[i].Display = v.Display
+		}
+		if len(v.Logo) > 0 {
+			o[i].Logo = v.Logo
+		}
+		if len(v.Division) > 0 {
+			o[i].Division = v.Division
+		}
+		if len(v.Country) > 0 {
+			o[i].Country = v.Country
+		}
+		if len(v.Affiliation) > 0 {
+			o[i].Affiliation = v.Affiliation
+		}
+	}
+	return o
+}
+
+// enroll imports the team metadata CSV files into the teams file and exits. This is
+// used by the "teams import" command.
+func (c *config) enroll(f []string) error {
+	if len(c.Teams) == 0 {
+		return &errval{s: "importing teams requires a teams file"}
+	}
+	if len(f) == 0 {
+		return &errval{s: "no files to import"}
+	}
+	l, err := entrants(c.Teams)
+	if err != nil {
+		return err
+	}
+	for _, n := range f {
+		r, err := os.Open(n)
+		if err != nil {
+			return &errval{s: `cannot read file "` + n + `"`, e: err}
+		}
+		v, err := tabulateTeams(r)
+		if r.Close(); err != nil {
+			return &errval{s: `unable to import file "` + n + `"`, e: err}
+		}
+		l = merge(l, v)
+		os.Stdout.WriteString("Imported " + strconv.Itoa(len(v)) + " teams from \"" + n + "\".\n")
+	}
+	if err = enlist(c.Teams, l); err != nil {
+		return err
+	}
+	os.Stdout.WriteString("Saved " + strconv.Itoa(len(l)) + " teams to \"" + c.Teams + "\".\n")
+	return nil
+}
+
+// enter sets the team metadata of every Game.
+func (s *Scoreboard) enter(l []game.Entrant) {
+	s.swap.Lock()
+	s.entrants = l
+	s.swap.Unlock()
+	s.Entrants(l)
+	for _, m := range s.games {
+		m.Entrants(l)
+	}
+}
+
+// httpTeams returns the team metadata, or imports a team metadata CSV, which is merged
+// with the current teams unless the "replace" query value is true. A DELETE removes the
+// team metadata. Changes are saved to the teams file, if one is set.
+func (s *Scoreboard) httpTeams(w http.ResponseWriter, r *http.Request) {
+	var l []game.Entrant
+	switch r.Method {
+	case http.MethodGet:
+		s.swap.RLock()
+		l = s.entrants
+		s.swap.RUnlock()
+		if l == nil {
+			l = []game.Entrant{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l)
+		return
+	case http.MethodPost, http.MethodPut:
+		v, err := tabulateTeams(r.Body)
+		if err != nil {
+			fail(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if x, _ := strconv.ParseBool(r.URL.Query().Get("replace")); x {
+			l = merge(nil, v)
+		} else {
+			s.swap.RLock()
+			l = merge(s.entrants, v)
+			s.swap.RUnlock()
+		}
+	case http.MethodDelete:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.swap.RLock()
+	f := s.enlisted
+	s.swap.RUnlock()
+	if len(f) > 0 {
+		if err := enlist(f, l); err != nil {
+			fail(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			s.log.request(r).Error(`Error saving teams for "%s": %s!`, r.RemoteAddr, err.Error())
+			return
+		}
+	}
+	s.enter(l)
+	s.log.request(r).Info(`Admin "%s" set the team metadata to %d teams.`, r.RemoteAddr, len(l))
+	if l == nil {
+		l = []game.Entrant{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
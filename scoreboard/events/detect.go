@@ -0,0 +1,387 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package events
+
+import (
+	"strconv"
+	"time"
+)
+
+type tally struct {
+	ports   map[uint16]struct{}
+	flags   uint64
+	beacons uint64
+	first   bool
+	planted bool
+}
+
+// Detect returns the Changes between the old and new states of the Game, at the supplied
+// time. A score milestone Change is made each time a team score crosses a multiple of m,
+// zero disables milestones. No Changes are returned if either Game has no teams, such as
+// for the first state of a Game.
+//
+// The first flag captured from each service port is a first blood when the engine reports
+// the flags lost by each Service, otherwise only the first flag of the Game is.
+func Detect(o, n *Game, t time.Time, m int64) []Change {
+	if o == nil || n == nil || len(o.Teams) == 0 || len(n.Teams) == 0 {
+		return nil
+	}
+	var (
+		r     []Change
+		p     = make(map[uint64]*Team, len(o.Teams))
+		names = make(map[uint64]string, len(n.Teams))
+		f, g  = captures(o), captures(n)
+	)
+	for i := range o.Teams {
+		p[o.Teams[i].ID] = &o.Teams[i]
+	}
+	for i := range n.Teams {
+		names[n.Teams[i].ID] = n.Teams[i].Name
+	}
+	for i := range n.Teams {
+		v, ok := p[n.Teams[i].ID]
+		if !ok {
+			continue
+		}
+		e := &n.Teams[i]
+		c := Change{Time: t, Game: n.Name, GameID: n.ID, Team: e.Name, TeamID: e.ID}
+		// Adjustments are not included in the score increase, as they have their own
+		// Changes.
+		if d := (e.Score - e.Bonus) - (v.Score - v.Bonus); d > 0 {
+			c.Kind, c.Old, c.New = ScoreIncrease, v.Score, e.Score
+			c.Text = e.Name + " scored " + strconv.FormatInt(d, 10) + " points"
+			r = append(r, c)
+			if m > 0 && e.Score/m > v.Score/m && e.Score >= m {
+				k := c
+				k.Kind, k.New = Milestone, e.Score/m*m
+				k.Text = e.Name + " reached " + strconv.FormatInt(k.New, 10) + " points"
+				r = append(r, k)
+			}
+		}
+		if x, y := v.Rank, e.Rank; x != y {
+			c.Kind, c.Old, c.New = RankChange, x, y
+			switch {
+			case y == 1 && len(n.Teams) > 1:
+				c.Kind, c.Text = FirstPlace, e.Name+" took first place"
+			case y < x:
+				c.Text = e.Name + " moved up to " + ordinal(y) + " place"
+			default:
+				c.Text = e.Name + " dropped to " + ordinal(y) + " place"
+			}
+			r = append(r, c)
+		}
+		if e.Captured > v.Captured {
+			c.Kind, c.Old, c.New = FlagCapture, int64(v.Captured), int64(e.Captured)
+			if d := e.Captured - v.Captured; d == 1 {
+				c.Text = e.Name + " captured a flag"
+			} else {
+				c.Text = e.Name + " captured " + strconv.FormatUint(uint64(d), 10) + " flags"
+			}
+			// Jeopardy sources already add challenge solves to the ticker and
+			// detect their own first blood.
+			c.Sourced = n.Jeopardy
+			if r = append(r, c); len(g.ports) == 0 && f.flags == 0 && g.flags > 0 && !f.first && !c.Sourced {
+				k := c
+				k.Kind, k.Text, f.first = FirstBlood, "First blood! "+e.Name+" captured the first flag", true
+				r = append(r, k)
+			}
+			c.Sourced = false
+		}
+		r = append(r, services(c, v, e)...)
+		if len(e.Beacons) == 0 && len(v.Beacons) == 0 {
+			continue
+		}
+		s := make(map[uint64]struct{}, len(e.Beacons))
+		for x := range e.Beacons {
+			s[e.Beacons[x].ID] = struct{}{}
+		}
+		for x := range v.Beacons {
+			if _, ok := s[v.Beacons[x].ID]; ok {
+				continue
+			}
+			k := c
+			k.Kind, k.Host, k.Other, k.OtherID = BeaconCleared, v.Beacons[x].Host, named(v.Beacons[x].Team, names), v.Beacons[x].Team
+			k.Text = k.Other + "'s beacon on " + e.Name + " was cleared"
+			r = append(r, k)
+		}
+		s = make(map[uint64]struct{}, len(v.Beacons))
+		for x := range v.Beacons {
+			s[v.Beacons[x].ID] = struct{}{}
+		}
+		for x := range e.Beacons {
+			if _, ok := s[e.Beacons[x].ID]; ok {
+				continue
+			}
+			k := c
+			k.Kind, k.Host, k.Other, k.OtherID = BeaconPlanted, e.Beacons[x].Host, named(e.Beacons[x].Team, names), e.Beacons[x].Team
+			k.Text = k.Other + " planted a beacon on " + e.Name
+			if r = append(r, k, k.attack()); g.beacons == 0 || f.beacons > 0 || f.planted {
+				continue
+			}
+			k.Kind, k.Text, f.planted = FirstBlood, "First blood! "+k.Other+" planted the first beacon on "+e.Name, true
+			r = append(r, k)
+		}
+	}
+	r = append(append(r, firsts(p, n, t, f)...), hills(o, n, t, names)...)
+	return append(append(r, raids(p, n, t)...), solves(o, n, t)...)
+}
+func ordinal(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return s + "th"
+	case n%10 == 1:
+		return s + "st"
+	case n%10 == 2:
+		return s + "nd"
+	case n%10 == 3:
+		return s + "rd"
+	}
+	return s + "th"
+}
+
+// named returns the name of the team with the ID, or "Team <id>" if the team is not
+// in the Game.
+func named(i uint64, names map[uint64]string) string {
+	if n, ok := names[i]; ok && len(n) > 0 {
+		return n
+	}
+	return "Team " + strconv.FormatUint(i, 10)
+}
+func captures(g *Game) *tally {
+	t := tally{ports: make(map[uint16]struct{})}
+	for i := range g.Teams {
+		t.flags += uint64(g.Teams[i].Captured)
+		t.beacons += uint64(len(g.Teams[i].Beacons))
+		for _, h := range g.Teams[i].Hosts {
+			for _, s := range h.Services {
+				if s.Lost > 0 {
+					t.ports[s.Port] = struct{}{}
+				}
+			}
+		}
+	}
+	return &t
+}
+
+// firsts returns the FirstBlood Changes of the service ports that lost their first flag
+// since the last state, which only has the ports that lost a flag in f. Flags do not
+// record the team that captured them, so the attacker is only set when a single team
+// captured flags since the last state.
+func firsts(p map[uint64]*Team, n *Game, t time.Time, f *tally) []Change {
+	if n.Jeopardy {
+		return nil
+	}
+	var (
+		r []Change
+		a *Team
+		k int
+	)
+	for i := range n.Teams {
+		if o, ok := p[n.Teams[i].ID]; ok && n.Teams[i].Captured > o.Captured {
+			a, k = &n.Teams[i], k+1
+		}
+	}
+	if k != 1 {
+		a = nil
+	}
+	for i := range n.Teams {
+		e := &n.Teams[i]
+		if _, ok := p[e.ID]; !ok {
+			continue
+		}
+		for _, h := range e.Hosts {
+			for _, s := range h.Services {
+				if s.Lost == 0 {
+					continue
+				}
+				if _, ok := f.ports[s.Port]; ok {
+					continue
+				}
+				f.ports[s.Port] = struct{}{}
+				var (
+					l = strconv.FormatUint(uint64(s.Port), 10)
+					c = Change{Time: t, Kind: FirstBlood, Game: n.Name, GameID: n.ID, Host: h.Name, Service: s.Port, Other: e.Name, OtherID: e.ID}
+				)
+				if a != nil && a.ID != e.ID {
+					c.Team, c.TeamID = a.Name, a.ID
+					c.Text = "First blood! " + a.Name + " captured the first flag of port " + l + " from " + e.Name
+				} else {
+					c.Text = "First blood! The first flag of port " + l + " was captured from " + e.Name
+				}
+				r = append(r, c)
+			}
+		}
+	}
+	return r
+}
+
+// attack returns the Attack Change of a planted beacon, from the team that planted the
+// beacon to the team that the beacon was planted on.
+func (c Change) attack() Change {
+	v := c
+	v.Kind, v.Team, v.TeamID, v.Other, v.OtherID = Attack, c.Other, c.OtherID, c.Team, c.TeamID
+	v.Text = v.Team + " attacked " + v.Other
+	return v
+}
+func solves(o, n *Game, t time.Time) []Change {
+	var (
+		r []Change
+		s = make(map[uint64]struct{}, len(o.Solves))
+	)
+	for i := range o.Solves {
+		s[o.Solves[i].ID] = struct{}{}
+	}
+	for i := range n.Solves {
+		if _, ok := s[n.Solves[i].ID]; ok {
+			continue
+		}
+		r = append(r, Change{
+			Time:    t,
+			Kind:    FirstBlood,
+			Game:    n.Name,
+			Text:    n.Solves[i].Text,
+			Team:    n.Solves[i].Name,
+			GameID:  n.ID,
+			TeamID:  n.Solves[i].Team,
+			Sourced: true,
+		})
+	}
+	return r
+}
+func services(c Change, o, n *Team) []Change {
+	var (
+		r []Change
+		h = make(map[uint64]*Host, len(o.Hosts))
+	)
+	for i := range o.Hosts {
+		h[o.Hosts[i].ID] = &o.Hosts[i]
+	}
+	for i := range n.Hosts {
+		v, ok := h[n.Hosts[i].ID]
+		if !ok {
+			continue
+		}
+		s := make(map[uint64]State, len(v.Services))
+		for x := range v.Services {
+			s[v.Services[x].ID] = v.Services[x].State
+		}
+		for x := range n.Hosts[i].Services {
+			e := n.Hosts[i].Services[x]
+			p, ok := s[e.ID]
+			if !ok || (p == Down) == (e.State == Down) {
+				continue
+			}
+			k := c
+			k.Host, k.Service, k.Old, k.New = n.Hosts[i].Name, e.Port, int64(p), int64(e.State)
+			l := n.Hosts[i].Name + ":" + strconv.FormatUint(uint64(e.Port), 10)
+			if e.State == Down {
+				k.Kind, k.Text = ServiceDown, c.Team+" service "+l+" is down"
+			} else {
+				k.Kind, k.Text = ServiceUp, c.Team+" service "+l+" is back up"
+			}
+			r = append(r, k)
+		}
+	}
+	return r
+}
+
+// hills returns the Changes of the hills that changed owner since the last state. The
+// team of the Change is the new owner, which is empty if the hill was released, and
+// the other team is the last owner.
+func hills(o, n *Game, t time.Time, names map[uint64]string) []Change {
+	if len(o.Hills) == 0 || len(n.Hills) == 0 {
+		return nil
+	}
+	var (
+		r []Change
+		k = make(map[uint64]uint64, len(o.Hills))
+	)
+	for i := range o.Hills {
+		k[o.Hills[i].ID] = o.Hills[i].Owner
+	}
+	for i := range n.Hills {
+		v, ok := k[n.Hills[i].ID]
+		if !ok || v == n.Hills[i].Owner {
+			continue
+		}
+		c := Change{Time: t, Kind: HillTaken, Game: n.Name, GameID: n.ID, Host: n.Hills[i].Name, TeamID: n.Hills[i].Owner, OtherID: v}
+		if v > 0 {
+			c.Other = named(v, names)
+		}
+		switch {
+		case c.TeamID == 0:
+			c.Text = c.Other + " lost the hill " + c.Host
+		case v == 0:
+			c.Team = named(c.TeamID, names)
+			c.Text = c.Team + " took the hill " + c.Host
+		default:
+			c.Team = named(c.TeamID, names)
+			c.Text = c.Team + " took the hill " + c.Host + " from " + c.Other
+		}
+		r = append(r, c)
+	}
+	return r
+}
+
+// raids returns the Attack Changes of the flags captured since the last state. Flags do
+// not record the team that they were captured from, so the teams are only paired when
+// a single team captured flags or a single team lost flags. The old and new values are
+// the number of flags lost by the attacked team.
+func raids(p map[uint64]*Team, n *Game, t time.Time) []Change {
+	if n.Jeopardy {
+		return nil
+	}
+	var a, v []*Team
+	for i := range n.Teams {
+		o, ok := p[n.Teams[i].ID]
+		if !ok {
+			continue
+		}
+		if n.Teams[i].Captured > o.Captured {
+			a = append(a, &n.Teams[i])
+		}
+		if n.Teams[i].Lost > o.Lost {
+			v = append(v, &n.Teams[i])
+		}
+	}
+	if len(a) == 0 || len(v) == 0 || (len(a) > 1 && len(v) > 1) {
+		return nil
+	}
+	r := make([]Change, 0, len(a)*len(v))
+	for x := range a {
+		for y := range v {
+			if a[x].ID == v[y].ID {
+				continue
+			}
+			r = append(r, Change{
+				Time:    t,
+				Kind:    Attack,
+				Game:    n.Name,
+				Text:    a[x].Name + " captured a flag from " + v[y].Name,
+				Team:    a[x].Name,
+				Other:   v[y].Name,
+				GameID:  n.ID,
+				TeamID:  a[x].ID,
+				OtherID: v[y].ID,
+				Old:     int64(p[v[y].ID].Lost),
+				New:     int64(v[y].Lost),
+			})
+		}
+	}
+	return r
+}
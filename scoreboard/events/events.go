@@ -0,0 +1,232 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package events is the scoring model and event detection of the Scoreboard, without
+// the web server, so custom scoring engines and bots can find the same Changes as the
+// board from their own Game states. It only depends on the standard library.
+//
+//	var last *events.Game
+//	for g := range states {
+//		events.Rank(g)
+//		for _, c := range events.Detect(last, g, time.Now(), 1000) {
+//			fmt.Println(c.Kind, c.Text)
+//		}
+//		last = g
+//	}
+package events
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of Changes that can be detected between two Game states.
+const (
+	ScoreIncrease Kind = iota + 1
+	RankChange
+	ServiceDown
+	ServiceUp
+	FlagCapture
+	BeaconPlanted
+	FirstBlood
+	Milestone
+	FirstPlace
+	ScoreAdjustment
+	ClockWarning
+	BeaconCleared
+	Attack
+	HillTaken
+	GameOver
+	SourceStale
+	Summary
+)
+
+// Kind is the type of a Change.
+type Kind uint8
+
+// Change is a typed event that was detected by comparing two consecutive states of
+// a Game. The Scoreboard sends Changes to the ticker, the connected clients and its
+// hooks.
+type Change struct {
+	Time    time.Time `json:"time"`
+	Game    string    `json:"game"`
+	Team    string    `json:"team"`
+	Host    string    `json:"host,omitempty"`
+	Other   string    `json:"other,omitempty"`
+	Text    string    `json:"text"`
+	GameID  uint64    `json:"game_id"`
+	TeamID  uint64    `json:"team_id"`
+	OtherID uint64    `json:"other_id,omitempty"`
+	Old     int64     `json:"old"`
+	New     int64     `json:"new"`
+	Service uint16    `json:"port,omitempty"`
+	Kind    Kind      `json:"kind"`
+	// Sourced is true if the Source already announced the Change itself, such as the
+	// challenge solves of a jeopardy Game, so it is not added to the ticker again.
+	Sourced bool `json:"-"`
+}
+
+// Standing is the score and rank of a single team in a Snapshot. Delta is the points
+// gained and Movement is the ranks moved up, or down if negative, since the last time
+// the standings changed.
+type Standing struct {
+	Name        string                 `json:"name"`
+	Division    string                 `json:"division,omitempty"`
+	Country     string                 `json:"country,omitempty"`
+	Affiliation string                 `json:"affiliation,omitempty"`
+	Logo        string                 `json:"logo,omitempty"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+	ID          uint64                 `json:"id"`
+	Score       int64                  `json:"score"`
+	Health      int64                  `json:"health"`
+	Rank        int64                  `json:"rank"`
+	Delta       int64                  `json:"delta"`
+	Movement    int64                  `json:"movement"`
+}
+
+// Snapshot contains the standings of all teams in a Game at a point in time. The
+// Scoreboard sends a Snapshot to its hooks each time the standings change.
+type Snapshot struct {
+	Time   time.Time  `json:"time"`
+	Game   string     `json:"game"`
+	Teams  []Standing `json:"teams"`
+	GameID uint64     `json:"game_id"`
+}
+
+func (k Kind) String() string {
+	switch k {
+	case ScoreIncrease:
+		return "score"
+	case RankChange:
+		return "rank"
+	case ServiceDown:
+		return "service_down"
+	case ServiceUp:
+		return "service_up"
+	case FlagCapture:
+		return "flag"
+	case BeaconPlanted:
+		return "beacon"
+	case FirstBlood:
+		return "first_blood"
+	case Milestone:
+		return "milestone"
+	case FirstPlace:
+		return "first_place"
+	case ScoreAdjustment:
+		return "adjustment"
+	case ClockWarning:
+		return "clock"
+	case BeaconCleared:
+		return "beacon_cleared"
+	case Attack:
+		return "attack"
+	case HillTaken:
+		return "hill"
+	case GameOver:
+		return "game_over"
+	case SourceStale:
+		return "source_stale"
+	case Summary:
+		return "summary"
+	}
+	return "unknown"
+}
+
+// ParseKind returns the Kind that matches the supplied name. The boolean will be false
+// if the name does not match any Kind.
+func ParseKind(s string) (Kind, bool) {
+	for k := ScoreIncrease; k <= Summary; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// Highlight returns true if the Kind is a special event that should be highlighted
+// on the scoreboard.
+func (k Kind) Highlight() bool {
+	return k == FirstBlood || k == Milestone || k == FirstPlace
+}
+
+// MarshalJSON returns the Kind name as a JSON string.
+func (k Kind) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + k.String() + `"`), nil
+}
+
+// UnmarshalJSON reads the Kind from its name as a JSON string, so Changes sent by the
+// hooks of the Scoreboard can be read back. Unknown names are read as zero.
+func (k *Kind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	*k, _ = ParseKind(s)
+	return nil
+}
+
+// Division returns a copy of the Snapshot that only contains teams in the supplied
+// division, ranked against each other in the same order. Division names are not case
+// sensitive.
+func (s Snapshot) Division(d string) Snapshot {
+	v := Snapshot{Time: s.Time, Game: s.Game, GameID: s.GameID, Teams: make([]Standing, 0, len(s.Teams))}
+	for i := range s.Teams {
+		if strings.EqualFold(s.Teams[i].Division, d) {
+			v.Teams = append(v.Teams, s.Teams[i])
+		}
+	}
+	var l int64
+	for i := range v.Teams {
+		if r := v.Teams[i].Rank; i > 0 && r == l {
+			v.Teams[i].Rank = v.Teams[i-1].Rank
+		} else {
+			v.Teams[i].Rank, l = int64(i+1), r
+		}
+	}
+	return v
+}
+
+// Has returns true if the team with the supplied ID is in the Snapshot.
+func (s Snapshot) Has(t uint64) bool {
+	for i := range s.Teams {
+		if s.Teams[i].ID == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Divisions returns the sorted names of all the divisions in the Snapshot.
+func (s Snapshot) Divisions() []string {
+	var (
+		o []string
+		n = make(map[string]struct{})
+	)
+	for i := range s.Teams {
+		if len(s.Teams[i].Division) == 0 {
+			continue
+		}
+		if _, ok := n[s.Teams[i].Division]; !ok {
+			n[s.Teams[i].Division] = struct{}{}
+			o = append(o, s.Teams[i].Division)
+		}
+	}
+	sort.Strings(o)
+	return o
+}
@@ -0,0 +1,115 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package events
+
+import "sort"
+
+// States of a Service, which match the service status values sent by Scorebot.
+const (
+	Up State = iota
+	Warning
+	Down
+)
+
+// State is the status of a Service.
+type State uint8
+
+// Game is a state of a Game, as read from a scoring engine. Only the values that
+// Changes are detected from are kept.
+type Game struct {
+	Name   string  `json:"name"`
+	Teams  []Team  `json:"teams"`
+	Hills  []Hill  `json:"hills,omitempty"`
+	Solves []Solve `json:"solves,omitempty"`
+	ID     uint64  `json:"id"`
+	// Jeopardy is true if the Game is a jeopardy Game, where the engine announces the
+	// first blood of each challenge itself and flags are not taken from other teams.
+	Jeopardy bool `json:"jeopardy"`
+}
+
+// Team is a team in a Game. Rank is the place of the team, which can be set with Rank,
+// and Bonus is the part of the Score from adjustments, which is not counted as scored.
+type Team struct {
+	Name     string   `json:"name"`
+	Hosts    []Host   `json:"hosts,omitempty"`
+	Beacons  []Beacon `json:"beacons,omitempty"`
+	ID       uint64   `json:"id"`
+	Score    int64    `json:"score"`
+	Bonus    int64    `json:"bonus,omitempty"`
+	Rank     int64    `json:"rank"`
+	Captured uint32   `json:"captured"`
+	Lost     uint32   `json:"lost"`
+}
+
+// Host is a host of a Team and its Services.
+type Host struct {
+	Name     string    `json:"name"`
+	Services []Service `json:"services"`
+	ID       uint64    `json:"id"`
+}
+
+// Service is a service of a Host. Lost is the flags captured from the service, which
+// is zero if the engine does not report the flags of each service.
+type Service struct {
+	ID    uint64 `json:"id"`
+	Lost  uint32 `json:"lost,omitempty"`
+	Port  uint16 `json:"port"`
+	State State  `json:"status"`
+}
+
+// Beacon is a beacon planted on a host of a Team by the Team with the ID in Team.
+type Beacon struct {
+	Host string `json:"host,omitempty"`
+	ID   uint64 `json:"id"`
+	Team uint64 `json:"team"`
+}
+
+// Hill is a King of the Hill hill and the ID of the Team that owns it, or zero.
+type Hill struct {
+	Name  string `json:"name"`
+	ID    uint64 `json:"id"`
+	Owner uint64 `json:"owner"`
+}
+
+// Solve is a first blood solve that was announced by the engine, such as the first
+// solve of a jeopardy challenge. Solves are detected by their ID, once each.
+type Solve struct {
+	Name string `json:"team_name"`
+	Text string `json:"text"`
+	ID   uint64 `json:"id"`
+	Team uint64 `json:"team"`
+}
+
+// Rank sets the Rank of each Team by Score, highest first. Teams with the same Score
+// share the same Rank.
+func Rank(g *Game) {
+	v := make([]int, len(g.Teams))
+	for i := range v {
+		v[i] = i
+	}
+	sort.SliceStable(v, func(i, j int) bool {
+		if g.Teams[v[i]].Score != g.Teams[v[j]].Score {
+			return g.Teams[v[i]].Score > g.Teams[v[j]].Score
+		}
+		return g.Teams[v[i]].ID < g.Teams[v[j]].ID
+	})
+	for i := range v {
+		if g.Teams[v[i]].Rank = int64(i + 1); i > 0 && g.Teams[v[i-1]].Score == g.Teams[v[i]].Score {
+			g.Teams[v[i]].Rank = g.Teams[v[i-1]].Rank
+		}
+	}
+}
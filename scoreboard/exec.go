@@ -0,0 +1,231 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+const (
+	execQueue   = 128
+	execOutput  = 512
+	execTimeout = 10
+)
+
+const (
+	eventTweet   = "tweet"
+	eventGameEnd = "game_end"
+)
+
+type command struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Events  []string `json:"events,omitempty"`
+	Timeout int      `json:"timeout,omitempty"`
+	Limit   int      `json:"limit,omitempty"`
+}
+type posted struct {
+	Time string `json:"time"`
+	User string `json:"user"`
+	Name string `json:"name"`
+	Text string `json:"text"`
+	ID   uint64 `json:"id"`
+}
+type invocation struct {
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+	Event string      `json:"event"`
+	Game  string      `json:"game,omitempty"`
+	body  []byte
+}
+type runner struct {
+	log     logx.Log
+	queue   chan invocation
+	slots   chan struct{}
+	events  map[string]struct{}
+	name    string
+	args    []string
+	timeout time.Duration
+}
+
+func (c command) verify() error {
+	if len(c.Command) == 0 {
+		return &errval{s: "exec command cannot be empty"}
+	}
+	if c.Timeout < 0 || c.Limit < 0 {
+		return &errval{s: `exec command "` + c.Command + `" timeout and limit cannot be less than zero`}
+	}
+	for i := range c.Events {
+		if c.Events[i] == eventTweet || c.Events[i] == eventGameEnd {
+			continue
+		}
+		if _, ok := game.ParseKind(c.Events[i]); !ok {
+			return &errval{s: `exec command "` + c.Command + `" event type "` + c.Events[i] + `" is not valid`}
+		}
+	}
+	return nil
+}
+
+// ended returns true if the Change is the clock warning sent when the game clock ends,
+// which is the only clock warning without any time remaining.
+func ended(c game.Change) bool {
+	return c.Kind == game.ClockWarning && c.New == 0
+}
+func newRunner(c command, l logx.Log) *runner {
+	r := &runner{
+		log:     l,
+		name:    c.Command,
+		args:    c.Args,
+		queue:   make(chan invocation, execQueue),
+		timeout: time.Duration(c.Timeout) * time.Second,
+	}
+	if r.timeout == 0 {
+		r.timeout = execTimeout * time.Second
+	}
+	if c.Limit <= 0 {
+		r.slots = make(chan struct{}, 1)
+	} else {
+		r.slots = make(chan struct{}, c.Limit)
+	}
+	if len(c.Events) > 0 {
+		r.events = make(map[string]struct{}, len(c.Events))
+		for i := range c.Events {
+			r.events[c.Events[i]] = struct{}{}
+		}
+	}
+	return r
+}
+func (r *runner) send(v invocation) {
+	if r.events != nil {
+		if _, ok := r.events[v.Event]; !ok {
+			return
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.log.Error(`Unable to marshal exec payload for "%s": %s!`, r.name, err.Error())
+		return
+	}
+	v.body = b
+	select {
+	case r.queue <- v:
+	default:
+		r.log.Warning(`Exec command "%s" queue is full, dropping "%s" event!`, r.name, v.Event)
+	}
+}
+
+// execute queues the Change for every exec command. The Change is also sent as a
+// "game_end" event when the game clock ends.
+func (s *Scoreboard) execute(c game.Change) {
+	v := invocation{Time: c.Time, Data: c, Event: c.Kind.String(), Game: c.Game}
+	for i := range s.execs {
+		s.execs[i].send(v)
+	}
+	if !ended(c) {
+		return
+	}
+	v.Event = eventGameEnd
+	for i := range s.execs {
+		s.execs[i].send(v)
+	}
+}
+
+// matched queues the Tweet, which passed the filter, for every exec command and the
+// event bus.
+func (s *Scoreboard) matched(t *twitter.Tweet) {
+	if len(s.execs) == 0 && s.bus == nil {
+		return
+	}
+	p := posted{ID: uint64(t.ID), Time: t.CreatedAt, Text: t.Text}
+	if t.User != nil {
+		p.User, p.Name = t.User.ScreenName, t.User.Name
+	}
+	if s.bus != nil {
+		s.bus.tweet(p)
+	}
+	v := invocation{Time: time.Now(), Data: p, Event: eventTweet}
+	for i := range s.execs {
+		s.execs[i].send(v)
+	}
+}
+func (r *runner) start(x context.Context) {
+	for {
+		select {
+		case <-x.Done():
+			return
+		case v := <-r.queue:
+			// Each command is started once a slot is free, so no more than the limit
+			// of commands run at once and the queue fills up if they are too slow.
+			select {
+			case <-x.Done():
+				return
+			case r.slots <- struct{}{}:
+			}
+			go func() {
+				defer func() { <-r.slots }()
+				r.run(x, v)
+			}()
+		}
+	}
+}
+func (r *runner) run(x context.Context, v invocation) {
+	t, f := context.WithTimeout(x, r.timeout)
+	var (
+		o bytes.Buffer
+		c = exec.CommandContext(t, r.name, r.args...)
+	)
+	c.Stdin, c.Stdout, c.Stderr = bytes.NewReader(v.body), &o, &o
+	c.Env = append(os.Environ(), "SCOREBOARD_EVENT="+v.Event, "SCOREBOARD_GAME="+v.Game)
+	n := time.Now()
+	err := c.Run()
+	if f(); err == nil {
+		r.log.Trace(`Exec command "%s" handled "%s" event in %s.`, r.name, v.Event, time.Since(n).String())
+		return
+	}
+	if t.Err() == context.DeadlineExceeded {
+		r.log.Error(`Exec command "%s" was stopped after running for %s on "%s" event!`, r.name, r.timeout.String(), v.Event)
+		return
+	}
+	if x.Err() != nil {
+		return
+	}
+	r.log.Error(`Exec command "%s" failed on "%s" event: %s!`, r.name, v.Event, failure(err, o.Bytes()))
+}
+
+// failure returns the error of a failed command with the start of its output, which
+// is usually the reason the command failed.
+func failure(err error, b []byte) string {
+	v := strings.TrimSpace(string(b))
+	if len(v) == 0 {
+		return err.Error()
+	}
+	if len(v) > execOutput {
+		v = v[:execOutput] + ".. (" + strconv.Itoa(len(b)) + " bytes)"
+	}
+	return err.Error() + ": " + v
+}
@@ -0,0 +1,172 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+type logged struct {
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Kind   string          `json:"kind"`
+	Text   string          `json:"text"`
+	TeamID uint64          `json:"team_id,omitempty"`
+}
+type journalExport struct {
+	Exported time.Time  `json:"exported"`
+	Frozen   *time.Time `json:"frozen_at,omitempty"`
+	Game     string     `json:"game"`
+	Events   []logged   `json:"events"`
+	GameID   uint64     `json:"game_id"`
+}
+
+// exported returns the Manager and the Game ID of the export request, which selects
+// the current Game of the named game if the "name" value is set without a Game ID.
+func (s *Scoreboard) exported(w http.ResponseWriter, r *http.Request) (*game.Manager, uint64, bool) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, 0, false
+	}
+	var (
+		q      = r.URL.Query()
+		m      = s.Manager
+		g, err = strconv.ParseUint(q.Get("game"), 10, 64)
+	)
+	if n := q.Get("name"); len(n) > 0 {
+		if m = s.arena(n); m == nil {
+			fail(w, `game "`+n+`" does not exist`, http.StatusNotFound)
+			return nil, 0, false
+		}
+		if err != nil || g == 0 {
+			g, err = current(m), nil
+		}
+	}
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return m, g, true
+}
+
+// held returns the time that the display of the Game was frozen at, if it is frozen or
+// being revealed.
+func held(m *game.Manager, g uint64) (time.Time, bool) {
+	var t time.Time
+	for _, h := range m.Frozen() {
+		if h.Frozen && (h.Game == g || (h.Game == 0 && t.IsZero())) {
+			t = h.At
+		}
+	}
+	return t, !t.IsZero()
+}
+
+// httpExportStandings returns the standings of the Game as a CSV file. The standings
+// shown on the display are used, so the standings of a frozen Game are not exported
+// before they are revealed, unless the request has the admin token.
+func (s *Scoreboard) httpExportStandings(w http.ResponseWriter, r *http.Request) {
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	var (
+		a = s.permitted(r, true, scopeScores)
+		v game.Snapshot
+	)
+	if a {
+		v, ok = m.Standings(g)
+	} else {
+		v, ok = m.Displayed(g)
+	}
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if !a {
+		v = m.Mask(v)
+	}
+	if d := r.URL.Query().Get("division"); len(d) > 0 {
+		v = v.Division(d)
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", `attachment; filename="standings-`+strconv.FormatUint(g, 10)+`.csv"`)
+	c := csv.NewWriter(w)
+	c.Write([]string{"rank", "team_id", "team", "division", "score", "health"})
+	for _, t := range v.Teams {
+		c.Write([]string{
+			strconv.FormatInt(t.Rank, 10), strconv.FormatUint(t.ID, 10), t.Name, t.Division,
+			strconv.FormatInt(t.Score, 10), strconv.FormatInt(t.Health, 10),
+		})
+	}
+	if c.Flush(); c.Error() != nil {
+		s.log.request(r).Error(`Error exporting standings for "%s": %s!`, r.RemoteAddr, c.Error().Error())
+	}
+}
+
+// httpExportEvents returns the recorded event log of the Game as a JSON file. Events
+// after the time of a Freeze are not exported until the Game is revealed, unless the
+// request has the admin token.
+func (s *Scoreboard) httpExportEvents(w http.ResponseWriter, r *http.Request) {
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	var (
+		a = s.permitted(r, true, scopeScores)
+		z = s.timezone(r)
+		o = journalExport{Exported: time.Now().UTC(), GameID: g, Events: make([]logged, 0)}
+		e = o.Exported
+	)
+	if f, ok := held(m, g); ok && !a {
+		x := f.In(z)
+		o.Frozen, e = &x, f
+	}
+	if v, ok := m.Displayed(g); ok {
+		o.Game = v.Game
+	}
+	l, err := s.store.journal(r.Context(), g, e)
+	if err != nil {
+		fail(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log.request(r).Error(`Error reading events for "%s": %s!`, r.RemoteAddr, err.Error())
+		return
+	}
+	if !a && m.Anonymous() {
+		// The event data has the real team and host names, so it is not exported.
+		p := replacer(m, g)
+		for i := range l {
+			l[i].Text, l[i].Data = p.Replace(l[i].Text), nil
+		}
+	}
+	// Times are stored in UTC and are only shown in the time zone of the request.
+	for i := range l {
+		l[i].Time = l[i].Time.In(z)
+	}
+	o.Exported, o.Events = o.Exported.In(z), append(o.Events, l...)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", `attachment; filename="events-`+strconv.FormatUint(g, 10)+`.json"`)
+	j := json.NewEncoder(w)
+	j.SetIndent("", "    ")
+	j.Encode(o)
+}
@@ -0,0 +1,148 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cooldown is the default seconds that credentials that were rate limited or rejected
+// are not used again.
+const cooldown = 900
+
+// keyring is the Twitter credentials the stream fails over between. The credentials
+// in use are put on cooldown when the stream is rate limited or the credentials are
+// rejected, and the next credentials that are not on cooldown are used instead.
+type keyring struct {
+	keys  []Credentials
+	until []time.Time
+	wait  time.Duration
+	cur   int
+	lock  sync.Mutex
+}
+
+// limited is a RoundTripper that reports the status code of stream responses that
+// were rate limited or rejected, which the Twitter client otherwise retries or closes
+// the stream on without any error.
+type limited struct {
+	http.RoundTripper
+	c chan<- int
+}
+
+func (l *limited) RoundTrip(r *http.Request) (*http.Response, error) {
+	o, err := l.RoundTripper.RoundTrip(r)
+	if err != nil || (!strings.HasSuffix(r.URL.Path, "/statuses/filter.json") && r.URL.Path != "/2/tweets/search/stream") {
+		return o, err
+	}
+	switch o.StatusCode {
+	case 401, 403, 420, 429:
+		select {
+		case l.c <- o.StatusCode:
+		default:
+		}
+	}
+	return o, err
+}
+func newKeyring(a Credentials, f []Credentials, w int) *keyring {
+	if w == 0 {
+		w = cooldown
+	}
+	k := &keyring{keys: append([]Credentials{a}, f...), wait: time.Duration(w) * time.Second}
+	k.until = make([]time.Time, len(k.keys))
+	return k
+}
+
+// set replaces the credentials in use, which are the credentials rotated in by an admin.
+func (k *keyring) set(a Credentials) {
+	k.lock.Lock()
+	k.keys[k.cur], k.until[k.cur] = a, time.Time{}
+	k.lock.Unlock()
+}
+
+// next puts the credentials in use on cooldown and returns the index and credentials of
+// the next credentials that are not on cooldown. False is returned if all credentials
+// are on cooldown.
+func (k *keyring) next() (int, Credentials, bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	n := time.Now()
+	k.until[k.cur] = n.Add(k.wait)
+	for i := 1; i < len(k.keys); i++ {
+		if x := (k.cur + i) % len(k.keys); k.until[x].Before(n) {
+			return x, k.keys[x], true
+		}
+	}
+	return 0, Credentials{}, false
+}
+func (k *keyring) use(i int) {
+	k.lock.Lock()
+	k.cur = i
+	k.lock.Unlock()
+}
+
+// streamer returns the HTTP client used for the Twitter stream, which reports rate
+// limited and rejected stream requests to the stream thread.
+func (s *Scoreboard) streamer() *http.Client {
+	c := s.limits.client(s.proxy)
+	if s.limited != nil {
+		c.Transport = &limited{RoundTripper: c.Transport, c: s.limited}
+	}
+	return c
+}
+
+// failover starts a stream with the next credentials that are not on cooldown and stops
+// the current stream, if one was started. The current stream is kept if no other
+// credentials could be used.
+func (s *Scoreboard) failover(f Stream, r <-chan interface{}, l *journal) (Stream, <-chan interface{}) {
+	if s.keys == nil || len(s.keys.keys) < 2 {
+		return f, r
+	}
+	if s.cluster != nil && !s.cluster.leading() {
+		return f, r
+	}
+	for {
+		i, a, ok := s.keys.next()
+		if !ok {
+			l.Error("All Twitter credentials are on cooldown, keeping the current stream!")
+			return f, r
+		}
+		v, err := connect(s.dial, &a, s.filter, s.streamer())
+		if err != nil {
+			l.Error("Unable to fail over to Twitter credentials %d: %s!", i, err.Error())
+			s.keys.use(i)
+			continue
+		}
+		if f != nil {
+			f.Stop()
+		}
+		s.keys.use(i)
+		s.swap.Lock()
+		s.auth = a
+		s.swap.Unlock()
+		atomic.AddUint64(&s.stats.failovers, 1)
+		atomic.StoreUint32(&s.stats.stream, 1)
+		s.degrade("twitter", time.Time{})
+		s.source("twitter", "connected with failover credentials "+strconv.Itoa(i))
+		l.Warning("Twitter stream thread failed over to credentials %d.", i)
+		return v, v.Messages()
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// FakeTwitter is an in-memory Twitter API that can replace the Twitter API by passing its
+// Dial function to Cmdline, so the Tweet filters, scripts and hooks can be tested without
+// Twitter keys. Every stream started with the Dial function receives the messages sent
+// with the FakeTwitter. The zero value is ready to use.
+//
+//	f := new(scoreboard.FakeTwitter)
+//	s, err := scoreboard.Cmdline(f.Dial)
+type FakeTwitter struct {
+	lock   sync.Mutex
+	reject error
+	open   []*fakeStream
+	next   int64
+	dials  int
+}
+type fakeStream struct {
+	lock   sync.Mutex
+	out    chan interface{}
+	done   chan struct{}
+	once   sync.Once
+	closed bool
+}
+
+// Stop stops the stream. Messages sent after the stream is stopped are dropped.
+func (s *fakeStream) Stop() {
+	s.once.Do(func() { close(s.done) })
+}
+func (s *fakeStream) Messages() <-chan interface{} {
+	return s.out
+}
+
+// Dial is the Dialer of the FakeTwitter, which starts a new stream unless the FakeTwitter
+// is rejecting streams.
+func (f *FakeTwitter) Dial(_ Credentials, _ *http.Client) (Stream, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.dials++; f.reject != nil {
+		return nil, f.reject
+	}
+	s := &fakeStream{out: make(chan interface{}), done: make(chan struct{})}
+	f.open = append(f.open, s)
+	return s, nil
+}
+
+// Dials returns the number of streams that were requested with Dial, including the
+// streams that were rejected.
+func (f *FakeTwitter) Dials() int {
+	f.lock.Lock()
+	n := f.dials
+	f.lock.Unlock()
+	return n
+}
+
+// Streams returns the number of streams that were started and are not stopped or closed.
+func (f *FakeTwitter) Streams() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.prune()
+	return len(f.open)
+}
+
+// Reject makes every following Dial return the error, such as for revoked credentials.
+// A nil error starts new streams again.
+func (f *FakeTwitter) Reject(err error) {
+	f.lock.Lock()
+	f.reject = err
+	f.lock.Unlock()
+}
+
+// Send sends the stream message, such as a *twitter.Tweet or *twitter.StallWarning, to
+// every open stream and waits for each stream to receive it or to be stopped. This
+// function returns the number of streams that received the message.
+func (f *FakeTwitter) Send(v interface{}) int {
+	f.lock.Lock()
+	f.prune()
+	l := make([]*fakeStream, len(f.open))
+	copy(l, f.open)
+	f.lock.Unlock()
+	var n int
+	for _, s := range l {
+		if s.lock.Lock(); s.closed {
+			s.lock.Unlock()
+			continue
+		}
+		select {
+		case s.out <- v:
+			n++
+		case <-s.done:
+		}
+		s.lock.Unlock()
+	}
+	return n
+}
+
+// Tweet sends a Tweet with the text from the user to every open stream, the same as
+// Send. Each Tweet has the next ID, starting at one, which is returned with the number
+// of streams that received the Tweet.
+func (f *FakeTwitter) Tweet(user, text string) (int64, int) {
+	f.lock.Lock()
+	f.next++
+	i := f.next
+	f.lock.Unlock()
+	t := &twitter.Tweet{
+		ID:       i,
+		IDStr:    strconv.FormatInt(i, 10),
+		Text:     text,
+		User:     &twitter.User{Name: user, ScreenName: user},
+		Entities: new(twitter.Entities),
+	}
+	return i, f.Send(t)
+}
+
+// Fail sends the error to every open stream as a network error, which disconnects the
+// stream and fails over to the next credentials, if there are any.
+func (f *FakeTwitter) Fail(err error) int {
+	return f.Send(&url.Error{Op: "Get", URL: "https://stream.twitter.com/1.1/statuses/filter.json", Err: err})
+}
+
+// Disconnect sends a StreamDisconnect message with the reason to every open stream.
+func (f *FakeTwitter) Disconnect(reason string) int {
+	return f.Send(&twitter.StreamDisconnect{Reason: reason})
+}
+
+// Close closes the channel of every open stream, the same as when Twitter rejects the
+// stream request.
+func (f *FakeTwitter) Close() {
+	f.lock.Lock()
+	l := f.open
+	f.open = nil
+	f.lock.Unlock()
+	for _, s := range l {
+		if s.lock.Lock(); !s.closed {
+			s.closed = true
+			close(s.out)
+		}
+		s.lock.Unlock()
+	}
+}
+
+// prune removes the streams that were stopped. This function must be called while
+// holding the lock.
+func (f *FakeTwitter) prune() {
+	l := f.open[:0]
+	for _, s := range f.open {
+		select {
+		case <-s.done:
+			continue
+		default:
+		}
+		l = append(l, s)
+	}
+	f.open = l
+}
@@ -0,0 +1,67 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func TestFakeTwitter(t *testing.T) {
+	a := os.Args
+	defer func() { os.Args = a }()
+	os.Args = []string{
+		"scoreboard", "-simulate", "1", "-log-level", "5", "-bind", "127.0.0.1:0",
+		"-tw-ck", "key", "-tw-cs", "secret", "-tw-ak", "access", "-tw-as", "access-secret",
+		"-tw-keywords", "pvj", "-tw-lang", "en", "-tw-block-user", "spammer",
+	}
+	f := new(FakeTwitter)
+	s, err := Cmdline(f.Dial)
+	if err != nil {
+		t.Fatalf("Cmdline failed: %s", err.Error())
+	}
+	if n := f.Dials(); n != 1 {
+		t.Fatalf("Dials is %d, expected 1", n)
+	}
+	s.begin()
+	defer s.stop()
+	if _, n := f.Tweet("pvj", "First blood on the scoreboard!"); n != 1 {
+		t.Fatalf("Tweet was received by %d streams, expected 1", n)
+	}
+	f.Tweet("spammer", "Buy followers now!")
+	f.Send(&twitter.StreamLimit{Track: 3})
+	f.Send(&twitter.StreamLimit{Track: 5})
+	// The stream is read one message at a time, so the last message is handled once the
+	// next message is received.
+	f.Send(&twitter.Event{})
+	if n := atomic.LoadUint64(&s.stats.received); n != 2 {
+		t.Fatalf("received is %d, expected 2", n)
+	}
+	if n := atomic.LoadUint64(&s.stats.filtered); n != 1 {
+		t.Fatalf("filtered is %d, expected 1", n)
+	}
+	r := s.stats.filters()
+	if r["blocked_users"] != 1 {
+		t.Fatalf("blocked_users rule is %d, expected 1", r["blocked_users"])
+	}
+	if r["rate_limit"] != 5 {
+		t.Fatalf("rate_limit rule is %d, expected 5", r["rate_limit"])
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// closing is the end of game behavior. When enabled, the final standings of each Game
+// are locked once its game clock ends, and the display is frozen at the end time if
+// "freeze" is set. If "podium" is set, the podium view is pinned to the displays of
+// the Game when it ends.
+type closing struct {
+	Enabled bool `json:"enabled"`
+	Freeze  bool `json:"freeze"`
+	Podium  bool `json:"podium"`
+}
+
+// concluded is a locked Game listed by the finale admin endpoint, with the named game it
+// belongs to, if any.
+type concluded struct {
+	Name string `json:"name,omitempty"`
+	game.Ending
+}
+
+func (c closing) verify() error {
+	if !c.Enabled && (c.Freeze || c.Podium) {
+		return &errval{s: "the finale freeze and podium options require the finale to be enabled"}
+	}
+	return nil
+}
+
+// curtain returns the Hook that pins the podium of the Game, or the route showing the
+// named game if not empty, when a GameOver Change is sent. A podium that is already
+// pinned to another Game is moved, so the last Game to end is shown.
+func (s *Scoreboard) curtain(n string) func(game.Change) {
+	return func(c game.Change) {
+		if c.Kind != game.GameOver {
+			return
+		}
+		var o string
+		s.swap.Lock()
+		if len(n) > 0 {
+			// The named game may have been switched to another route, or to no route
+			// at all, in which case there are no displays to show the podium on.
+			for k, v := range s.routes {
+				if v == n && (len(o) == 0 || k < o) {
+					o = k
+				}
+			}
+			if len(o) == 0 {
+				s.swap.Unlock()
+				return
+			}
+		}
+		v := s.podium
+		p := v
+		if p.Pinned, p.Route, p.Game = true, o, c.GameID; len(o) > 0 {
+			p.Game = 0
+		}
+		s.podium = p
+		s.swap.Unlock()
+		if v.Pinned && (v.Route != p.Route || v.Game != p.Game) {
+			s.release(v)
+		}
+		if !v.Pinned || v.Route != p.Route || v.Game != p.Game {
+			s.release(p)
+		}
+		s.log.Info("Pinned the podium of Game %d, as the game is over.", c.GameID)
+	}
+}
+
+// httpFinale returns the Games that are over and locked, and the action "unlock" shows
+// the updates of the source again and allows changes to the Game.
+func (s *Scoreboard) httpFinale(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.finished())
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c control
+	if !s.control(w, r, &c) {
+		return
+	}
+	m := s.Manager
+	if len(c.Name) > 0 {
+		if m = s.games[strings.ToLower(c.Name)]; m == nil {
+			fail(w, `game "`+c.Name+`" does not exist`, http.StatusNotFound)
+			return
+		}
+	}
+	if !strings.EqualFold(c.Action, "unlock") {
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	if c.Game == 0 {
+		c.Game = current(m)
+	}
+	if err := m.Unlock(c.Game); err != nil {
+		fail(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" unlocked the final standings of Game %s.`, r.RemoteAddr, strconv.FormatUint(c.Game, 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.finished())
+}
+
+// finished returns the locked Games of the Scoreboard and every named game.
+func (s *Scoreboard) finished() []concluded {
+	var o []concluded
+	for _, v := range s.Over() {
+		o = append(o, concluded{Ending: v})
+	}
+	n := make([]string, 0, len(s.games))
+	for k := range s.games {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	for _, k := range n {
+		for _, v := range s.games[k].Over() {
+			o = append(o, concluded{Name: k, Ending: v})
+		}
+	}
+	if o == nil {
+		return []concluded{}
+	}
+	return o
+}
@@ -0,0 +1,194 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Adjustment is a manual bonus or penalty that is added to the score of a team on top
+// of the score sent by the Source. Reverted Adjustments are kept as a record, but are
+// no longer added to the team score.
+type Adjustment struct {
+	Time     time.Time `json:"time"`
+	Reverted time.Time `json:"reverted"`
+	Reason   string    `json:"reason"`
+	By       string    `json:"by"`
+	ID       uint64    `json:"id"`
+	Game     uint64    `json:"game"`
+	Team     uint64    `json:"team"`
+	Points   int64     `json:"points"`
+	Active   bool      `json:"active"`
+}
+type notice struct {
+	Adjustment
+	revert bool
+}
+
+// Adjust adds the supplied number of points to the score of the team with the supplied
+// ID in the Game with the supplied ID, which is shown during the next update. Negative
+// points are a penalty. The reason and the name of who made the Adjustment are kept
+// with the Adjustment and are shown in the event log.
+func (m *Manager) Adjust(g, t uint64, p int64, reason, by string) (Adjustment, error) {
+	if g == 0 || t == 0 {
+		return Adjustment{}, errors.New("a valid game and team ID are required")
+	}
+	if p == 0 {
+		return Adjustment{}, errors.New("points cannot be zero")
+	}
+	if reason = strings.TrimSpace(reason); len(reason) == 0 {
+		return Adjustment{}, errors.New("a reason is required")
+	}
+	if m.Locked(g) {
+		return Adjustment{}, ErrLocked
+	}
+	m.lock.Lock()
+	a := Adjustment{ID: uint64(len(m.adjusts) + 1), Time: time.Now().UTC(), Game: g, Team: t, Points: p, Reason: reason, By: by, Active: true}
+	m.adjusts = append(m.adjusts, a)
+	m.notices = append(m.notices, notice{Adjustment: a})
+	m.lock.Unlock()
+	m.log.Info(`Adjusted team %d in Game %d by %d points (by "%s"): %s.`, t, g, p, by, reason)
+	return a, nil
+}
+
+// Revert removes the Adjustment with the supplied ID from the team score during the
+// next update. The Adjustment is kept as a record of the change.
+func (m *Manager) Revert(i uint64, by string) (Adjustment, error) {
+	m.lock.Lock()
+	if i == 0 || i > uint64(len(m.adjusts)) {
+		m.lock.Unlock()
+		return Adjustment{}, errors.New("adjustment " + strconv.FormatUint(i, 10) + " does not exist")
+	}
+	g := m.adjusts[i-1].Game
+	m.lock.Unlock()
+	if m.Locked(g) {
+		return Adjustment{}, ErrLocked
+	}
+	m.lock.Lock()
+	a := &m.adjusts[i-1]
+	if !a.Active {
+		m.lock.Unlock()
+		return *a, errors.New("adjustment " + strconv.FormatUint(i, 10) + " was already reverted")
+	}
+	a.Active, a.Reverted = false, time.Now().UTC()
+	v := *a
+	m.notices = append(m.notices, notice{Adjustment: v, revert: true})
+	m.lock.Unlock()
+	m.log.Info(`Reverted adjustment %d of team %d in Game %d (by "%s").`, i, v.Team, v.Game, by)
+	return v, nil
+}
+
+// Adjustments returns all Adjustments of the Game with the supplied ID, including any
+// reverted Adjustments, in the order they were made. An ID of zero returns the
+// Adjustments of all Games.
+func (m *Manager) Adjustments(g uint64) []Adjustment {
+	m.lock.Lock()
+	o := make([]Adjustment, 0, len(m.adjusts))
+	for i := range m.adjusts {
+		if g == 0 || m.adjusts[i].Game == g {
+			o = append(o, m.adjusts[i])
+		}
+	}
+	m.lock.Unlock()
+	return o
+}
+
+// adjust adds the active Adjustments of the Game with the supplied ID to the team
+// scores. The team list is copied first, as the Source may reuse it.
+func (m *Manager) adjust(i uint64, g *game) {
+	m.lock.Lock()
+	var b map[uint64]int64
+	for x := range m.adjusts {
+		if !m.adjusts[x].Active || m.adjusts[x].Game != i {
+			continue
+		}
+		if b == nil {
+			b = make(map[uint64]int64)
+		}
+		b[m.adjusts[x].Team] += m.adjusts[x].Points
+	}
+	m.lock.Unlock()
+	if len(b) == 0 {
+		return
+	}
+	t := make([]team, len(g.Teams))
+	for x := range g.Teams {
+		if t[x] = g.Teams[x]; b[t[x].ID] != 0 {
+			t[x].Score.Total += b[t[x].ID]
+			t[x].Score.hash, t[x].bonus = 0, b[t[x].ID]
+		}
+	}
+	g.Teams = t
+}
+
+// queue moves the pending Adjustment notices to their subscriptions. Notices of Games
+// that are not subscribed are dropped.
+func (m *Manager) queue() {
+	m.lock.Lock()
+	n := m.notices
+	m.notices = nil
+	m.lock.Unlock()
+	for i := range n {
+		if s, ok := m.subs[n[i].Game]; ok {
+			s.notices = append(s.notices, n[i])
+		}
+	}
+}
+
+// adjusted returns the Changes for the pending Adjustment notices of the subscription.
+func (s *subscription) adjusted(g *game, t time.Time) []Change {
+	if len(s.notices) == 0 {
+		return nil
+	}
+	var (
+		o = make(map[uint64]int64, len(s.last.Teams))
+		r = make([]Change, 0, len(s.notices))
+	)
+	for i := range s.last.Teams {
+		o[s.last.Teams[i].ID] = s.last.Teams[i].Score.Total
+	}
+	for _, a := range s.notices {
+		c := Change{Time: t, Kind: ScoreAdjustment, Game: g.Meta.Name, GameID: g.Meta.ID, TeamID: a.Team, Old: o[a.Team]}
+		for i := range g.Teams {
+			if g.Teams[i].ID == a.Team {
+				c.Team, c.New = g.Teams[i].Name, g.Teams[i].Score.Total
+				break
+			}
+		}
+		if len(c.Team) == 0 {
+			c.Team = "Team " + strconv.FormatUint(a.Team, 10)
+		}
+		p, k := a.Points, "award"
+		if p < 0 {
+			p, k = -p, "penalty"
+		}
+		switch {
+		case a.revert:
+			c.Text = "The " + strconv.FormatInt(p, 10) + " point " + k + " to " + c.Team + " was reverted"
+		case a.Points > 0:
+			c.Text = c.Team + " was awarded " + strconv.FormatInt(p, 10) + " points: " + a.Reason
+		default:
+			c.Text = c.Team + " was penalized " + strconv.FormatInt(p, 10) + " points: " + a.Reason
+		}
+		r = append(r, c)
+	}
+	s.notices = nil
+	return r
+}
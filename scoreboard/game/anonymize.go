@@ -0,0 +1,216 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	anonNone     anon = 0x0
+	anonNumber   anon = 0x1
+	anonCodename anon = 0x2
+)
+
+var (
+	adjectives = [...]string{
+		"Amber", "Arctic", "Azure", "Bold", "Brave", "Bright", "Crimson", "Cobalt",
+		"Dusk", "Electric", "Emerald", "Frozen", "Golden", "Hidden", "Iron", "Jade",
+		"Lunar", "Midnight", "Neon", "Onyx", "Quiet", "Rapid", "Silent", "Solar",
+		"Swift", "Thunder", "Velvet", "Violet", "Wild", "Winter", "Scarlet", "Silver",
+	}
+	animals = [...]string{
+		"Badger", "Bison", "Cobra", "Condor", "Coyote", "Falcon", "Ferret", "Fox",
+		"Gecko", "Heron", "Hornet", "Ibex", "Jackal", "Jaguar", "Kestrel", "Lynx",
+		"Mantis", "Marten", "Moose", "Octopus", "Orca", "Osprey", "Otter", "Panther",
+		"Puma", "Raven", "Shark", "Stingray", "Tiger", "Viper", "Walrus", "Wolf",
+	}
+)
+
+type anon uint8
+
+// Anonymize sets the mode used to hide the team names shown to clients added with the
+// Public function. The mode "number" names teams "Team 1", "Team 2" and so on and the
+// mode "codename" uses generated names, such as "Silent Falcon". Team logos, countries
+// and affiliations are also hidden. Pseudonyms are assigned in team ID order the first
+// time each team is seen and do not change while the Manager is running. An empty mode
+// or "none" shows the real team names. This function must be called before any Games
+// are subscribed.
+func (m *Manager) Anonymize(s string) error {
+	switch strings.ToLower(s) {
+	case "", "none":
+		m.anon = anonNone
+	case "number":
+		m.anon = anonNumber
+	case "codename":
+		m.anon = anonCodename
+	default:
+		return errors.New(`anonymize mode "` + s + `" is not valid`)
+	}
+	return nil
+}
+
+// Anonymous returns true if team names are hidden from public clients.
+func (m *Manager) Anonymous() bool {
+	return m.anon != anonNone
+}
+
+// Pseudonyms returns the pseudonyms of the teams with the supplied IDs. This function
+// returns nil if team names are not hidden.
+func (m *Manager) Pseudonyms(t []uint64) map[uint64]string {
+	if m.anon == anonNone {
+		return nil
+	}
+	v := make([]uint64, len(t))
+	copy(v, t)
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+	o := make(map[uint64]string, len(v))
+	m.lock.Lock()
+	if m.aliases == nil {
+		m.aliases, m.taken = make(map[uint64]string), make(map[string]struct{})
+	}
+	for _, i := range v {
+		n, ok := m.aliases[i]
+		if !ok {
+			n = m.pseudonym(i)
+			m.aliases[i], m.taken[n] = n, struct{}{}
+		}
+		o[i] = n
+	}
+	m.lock.Unlock()
+	return o
+}
+
+// Mask returns a copy of the Snapshot with the team names replaced by their pseudonyms
+// and the team logos, countries, affiliations and metadata removed. The Snapshot is
+// returned unchanged if team names are not hidden.
+func (m *Manager) Mask(s Snapshot) Snapshot {
+	if m.anon == anonNone {
+		return s
+	}
+	t := make([]uint64, len(s.Teams))
+	for i := range s.Teams {
+		t[i] = s.Teams[i].ID
+	}
+	var (
+		p = m.Pseudonyms(t)
+		v = s
+	)
+	v.Teams = make([]Standing, len(s.Teams))
+	for i := range s.Teams {
+		v.Teams[i] = s.Teams[i]
+		v.Teams[i].Name, v.Teams[i].Logo = p[s.Teams[i].ID], ""
+		v.Teams[i].Country, v.Teams[i].Affiliation, v.Teams[i].Meta = "", "", nil
+	}
+	return v
+}
+func (m *Manager) pseudonym(i uint64) string {
+	if m.anon == anonNumber {
+		return "Team " + strconv.Itoa(len(m.aliases)+1)
+	}
+	n := uint64(len(adjectives) * len(animals))
+	for x := uint64(0); x < n; x++ {
+		k := (i*0x9E3779B97F4A7C15 + x) % n
+		s := adjectives[k/uint64(len(animals))] + " " + animals[k%uint64(len(animals))]
+		if _, ok := m.taken[s]; !ok {
+			return s
+		}
+	}
+	return "Team " + strconv.Itoa(len(m.aliases)+1)
+}
+
+// mask returns a copy of the Game and the updates with the team names replaced by
+// their pseudonyms and the team logos, countries, affiliations and metadata removed. The Game and updates are
+// returned unchanged if team names are not hidden.
+func (m *Manager) mask(g *game, u []update) (game, []update) {
+	if m.anon == anonNone {
+		return *g, u
+	}
+	t := make([]uint64, len(g.Teams))
+	for i := range g.Teams {
+		t[i] = g.Teams[i].ID
+	}
+	var (
+		p = m.Pseudonyms(t)
+		n = make([]string, 0, len(g.Teams))
+		v = *g
+	)
+	for i := range g.Teams {
+		if len(g.Teams[i].Name) > 0 {
+			n = append(n, g.Teams[i].Name)
+		}
+	}
+	// Longer names are replaced first, so names that contain other names are not
+	// partially replaced.
+	sort.SliceStable(n, func(i, j int) bool { return len(n[i]) > len(n[j]) })
+	k := make(map[string]string, len(g.Teams))
+	for i := range g.Teams {
+		k[g.Teams[i].Name] = p[g.Teams[i].ID]
+	}
+	l := make([]string, 0, len(n)*2)
+	for i := range n {
+		l = append(l, n[i], k[n[i]])
+	}
+	r := strings.NewReplacer(l...)
+	v.hash, v.Message = 0, r.Replace(g.Message)
+	v.Teams = make([]team, len(g.Teams))
+	for i := range g.Teams {
+		v.Teams[i] = g.Teams[i]
+		v.Teams[i].Name, v.Teams[i].Logo, v.Teams[i].hash, v.Teams[i].local = p[g.Teams[i].ID], "", 0, false
+		v.Teams[i].Country, v.Teams[i].Affiliation, v.Teams[i].Meta = "", "", nil
+	}
+	v.Events = events{Window: g.Events.Window, Current: make([]event, len(g.Events.Current))}
+	for i := range g.Events.Current {
+		v.Events.Current[i] = event{ID: g.Events.Current[i].ID, Type: g.Events.Current[i].Type, Data: masked(r, g.Events.Current[i].Data)}
+	}
+	o := make([]update, len(u))
+	for i := range u {
+		o[i] = u[i]
+		// The metadata of the Source can contain the team names, so it is not sent.
+		o[i].Data, o[i].Meta = masked(r, u[i].Data), nil
+	}
+	return v, o
+}
+func masked(r *strings.Replacer, d map[string]string) map[string]string {
+	if d == nil {
+		return nil
+	}
+	o := make(map[string]string, len(d))
+	for k, v := range d {
+		if k == "text" || k == "other" || k == "name" {
+			v = r.Replace(v)
+		}
+		o[k] = v
+	}
+	return o
+}
+
+// mirror sends a masked copy of the supplied Game and updates to the public clients of
+// the subscription.
+func (s *subscription) mirror(x context.Context, m *Manager, g *game, c []update) {
+	s.accept()
+	v, u := m.mask(g, c)
+	a, d := v.Delta(m.assets, &s.last)
+	s.cache, s.last = a, v
+	if len(s.clients) > 0 {
+		s.send(x, m, append(d, u...))
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// chartRadius is the radius of the circle that teams without a set position are placed
+// on, centered on the attack map.
+const chartRadius = 0.4
+
+// Chart is the position of each team of a Game on the attack map. Positions are between
+// zero and one, from the top left corner of the map.
+type Chart struct {
+	Time   time.Time `json:"time"`
+	Game   string    `json:"game"`
+	Teams  []Node    `json:"teams"`
+	GameID uint64    `json:"game_id"`
+}
+
+// Node is a single team on the attack map.
+type Node struct {
+	Name  string  `json:"name"`
+	Color string  `json:"color,omitempty"`
+	ID    uint64  `json:"id"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+}
+
+// Chart returns the attack map positions of the teams of the subscribed Game with the
+// supplied ID. If the Game is not subscribed, this function returns false.
+func (m *Manager) Chart(i uint64) (Chart, bool) {
+	m.lock.Lock()
+	v, ok := m.charts[i]
+	m.lock.Unlock()
+	return v, ok
+}
+
+// Locate sets the function used to place teams on the attack map. The function is passed
+// the team ID and name and returns the position of the team. Teams are placed evenly on
+// a circle while the function returns false. Like Hooks, the function should not block.
+func (m *Manager) Locate(f func(uint64, string) (float64, float64, bool)) {
+	m.locate = f
+}
+
+// plot adds the attack map positions of both teams of the Attack to the event data.
+func (s *subscription) plot(d map[string]string, c Change) {
+	if v, ok := s.nodes[c.TeamID]; ok {
+		d["x"], d["y"] = coordinate(v.X), coordinate(v.Y)
+	}
+	if v, ok := s.nodes[c.OtherID]; ok {
+		d["other_x"], d["other_y"] = coordinate(v.X), coordinate(v.Y)
+	}
+}
+func coordinate(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// chart saves the attack map positions of the teams in the last known state of the Game.
+func (s *subscription) chart(m *Manager, n time.Time) {
+	var (
+		v = Chart{Time: n, Game: s.last.Meta.Name, GameID: s.ID, Teams: make([]Node, len(s.last.Teams))}
+		k = make(map[uint64]Node, len(s.last.Teams))
+	)
+	for i := range s.last.Teams {
+		t := &s.last.Teams[i]
+		v.Teams[i] = Node{ID: t.ID, Name: t.Name, Color: t.Color}
+		ok := false
+		if m.locate != nil {
+			m.guard("locate", func() { v.Teams[i].X, v.Teams[i].Y, ok = m.locate(t.ID, t.Name) })
+		}
+		if !ok {
+			a := 2*math.Pi*float64(i)/float64(len(s.last.Teams)) - math.Pi/2
+			v.Teams[i].X, v.Teams[i].Y = 0.5+chartRadius*math.Cos(a), 0.5+chartRadius*math.Sin(a)
+		}
+		k[t.ID] = v.Teams[i]
+	}
+	s.nodes = k
+	m.lock.Lock()
+	if m.charts == nil {
+		m.charts = make(map[uint64]Chart)
+	}
+	m.charts[s.ID] = v
+	m.lock.Unlock()
+}
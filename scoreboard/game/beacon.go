@@ -0,0 +1,112 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Implants is the list of active beacons in a Game, sorted by the time they were
+// first seen with the oldest first.
+type Implants struct {
+	Time    time.Time `json:"time"`
+	Game    string    `json:"game"`
+	Beacons []Implant `json:"beacons"`
+	GameID  uint64    `json:"game_id"`
+}
+
+// Implant is a single active beacon planted by the attacking Team on the Victim team.
+// Since is the time that the beacon was first seen by the Manager and Duration is the
+// number of seconds since then.
+type Implant struct {
+	Since    time.Time `json:"since"`
+	Team     string    `json:"team"`
+	Victim   string    `json:"victim"`
+	Host     string    `json:"host,omitempty"`
+	Color    string    `json:"color,omitempty"`
+	ID       uint64    `json:"id"`
+	TeamID   uint64    `json:"team_id"`
+	VictimID uint64    `json:"victim_id"`
+	Duration int64     `json:"duration"`
+}
+
+// Beacons returns the active beacons of the subscribed Game with the supplied ID. If the
+// Game is not subscribed, this function returns false.
+func (m *Manager) Beacons(i uint64) (Implants, bool) {
+	m.lock.Lock()
+	v, ok := m.implants[i]
+	m.lock.Unlock()
+	if !ok {
+		return v, false
+	}
+	n, b := time.Now().UTC(), make([]Implant, len(v.Beacons))
+	for x := range v.Beacons {
+		b[x] = v.Beacons[x]
+		b[x].Duration = int64(n.Sub(b[x].Since) / time.Second)
+	}
+	v.Beacons = b
+	return v, true
+}
+func beaconName(i uint64, names map[uint64]string) string {
+	if n, ok := names[i]; ok && len(n) > 0 {
+		return n
+	}
+	return "Team " + strconv.FormatUint(i, 10)
+}
+
+// implants saves the active beacons of the last known state of the Game. Beacons that
+// were already planted when the Game was subscribed use the time of the first sample.
+func (s *subscription) implants(m *Manager, n time.Time) {
+	var (
+		k     = make(map[uint64]time.Time, len(s.planted))
+		v     = Implants{Time: n, Game: s.last.Meta.Name, GameID: s.ID, Beacons: []Implant{}}
+		names = make(map[uint64]string, len(s.last.Teams))
+	)
+	for i := range s.last.Teams {
+		names[s.last.Teams[i].ID] = s.last.Teams[i].Name
+	}
+	for i := range s.last.Teams {
+		t := &s.last.Teams[i]
+		for _, b := range t.Beacons {
+			w, ok := s.planted[b.ID]
+			if !ok {
+				w = n
+			}
+			k[b.ID] = w
+			v.Beacons = append(v.Beacons, Implant{
+				ID:       b.ID,
+				Host:     b.Host,
+				Team:     beaconName(b.Team, names),
+				Color:    b.Color,
+				Since:    w,
+				Victim:   t.Name,
+				TeamID:   b.Team,
+				VictimID: t.ID,
+			})
+		}
+	}
+	sort.SliceStable(v.Beacons, func(i, j int) bool { return v.Beacons[i].Since.Before(v.Beacons[j].Since) })
+	s.planted = k
+	m.lock.Lock()
+	if m.implants == nil {
+		m.implants = make(map[uint64]Implants)
+	}
+	m.implants[s.ID] = v
+	m.lock.Unlock()
+}
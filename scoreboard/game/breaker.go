@@ -0,0 +1,104 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	backoffMin = time.Millisecond * 250
+	backoffMax = time.Second * 5
+)
+
+type breaker struct {
+	last      time.Time
+	until     time.Time
+	cooldown  time.Duration
+	fails     uint32
+	attempts  uint32
+	threshold uint32
+	open      bool
+}
+type retryable interface {
+	Temporary() bool
+}
+
+func (b *breaker) success() bool {
+	o := b.open
+	b.fails, b.open, b.last = 0, false, time.Now()
+	return o
+}
+func retry(s int, err error) bool {
+	if err == errNotModified {
+		return false
+	}
+	if _, ok := err.(*statusError); ok {
+		return s >= 500 || s == http.StatusTooManyRequests
+	}
+	if r, ok := err.(retryable); ok && !r.Temporary() {
+		return false
+	}
+	return err != context.Canceled
+}
+
+// Breaker configures the retry and circuit breaker settings used when requesting data from
+// the Source. Each request is attempted "attempts" times with a jittered exponential backoff.
+// After "threshold" failed ticks in a row, requests are stopped for the cooldown duration and
+// the last valid Game data is shown as stale until the Source recovers.
+//
+// Values less than or equal to zero are ignored and will keep the current setting.
+func (m *Manager) Breaker(attempts, threshold int, cooldown time.Duration) {
+	if attempts > 0 {
+		m.breaker.attempts = uint32(attempts)
+	}
+	if threshold > 0 {
+		m.breaker.threshold = uint32(threshold)
+	}
+	if cooldown > 0 {
+		m.breaker.cooldown = cooldown
+	}
+}
+func (b *breaker) allow(n time.Time) bool {
+	return !b.open || n.After(b.until)
+}
+func (b *breaker) fail(n time.Time) bool {
+	if b.fails++; b.fails < b.threshold && !b.open {
+		return false
+	}
+	o := b.open
+	b.open, b.until = true, n.Add(b.cooldown)
+	return !o
+}
+func wait(x context.Context, n uint32) bool {
+	d := backoffMin << n
+	if d > backoffMax || d <= 0 {
+		d = backoffMax
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	t := time.NewTimer(d)
+	select {
+	case <-x.Done():
+		t.Stop()
+		return false
+	case <-t.C:
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"sort"
+	"time"
+)
+
+// Board is the challenges of a jeopardy Game and the teams that solved each of them.
+// Challenges are sorted by category and then by points.
+type Board struct {
+	Time       time.Time   `json:"time"`
+	Game       string      `json:"game"`
+	Challenges []Challenge `json:"challenges"`
+	Teams      []Solver    `json:"teams"`
+	GameID     uint64      `json:"game_id"`
+}
+
+// Solver is a team in a Board, in the order of the standings, and the number of
+// challenges that it solved.
+type Solver struct {
+	Name   string `json:"name"`
+	ID     uint64 `json:"id"`
+	Solves int    `json:"solves"`
+}
+
+// Challenge is a single challenge in a Board. Solvers is the IDs of the teams that
+// solved the challenge, the first solver first.
+type Challenge struct {
+	Name     string   `json:"name"`
+	Category string   `json:"category"`
+	Solvers  []uint64 `json:"solvers"`
+	ID       uint64   `json:"id"`
+	Points   int64    `json:"points"`
+}
+
+// Challenges returns the latest challenge Board of the subscribed Game with the
+// supplied ID. If the Game is not subscribed, this function returns false. The Board
+// has no challenges if the Source does not supply them.
+func (m *Manager) Challenges(i uint64) (Board, bool) {
+	m.lock.Lock()
+	v, ok := m.boards[i]
+	m.lock.Unlock()
+	return v, ok
+}
+func (c Challenge) check(p *problems, n string) {
+	if c.ID == 0 {
+		p.add(n, " is missing an id")
+	}
+	length(p, n+" name", c.Name, maxName)
+	length(p, n+" category", c.Category, maxName)
+}
+
+// tally saves the challenge Board of the last known state of the Game. Solvers that are
+// not teams of the Game are removed.
+func (s *subscription) tally(m *Manager, n time.Time) {
+	v := Board{Time: n, Game: s.last.Meta.Name, GameID: s.ID, Challenges: make([]Challenge, 0, len(s.last.Challenges))}
+	var r []int
+	if len(s.last.Teams) > 0 {
+		r, _ = s.last.ranked()
+	}
+	k := make(map[uint64]int, len(r))
+	v.Teams = make([]Solver, len(r))
+	for x, i := range r {
+		v.Teams[x] = Solver{ID: s.last.Teams[i].ID, Name: s.last.Teams[i].Name}
+		k[s.last.Teams[i].ID] = x
+	}
+	for _, c := range s.last.Challenges {
+		h := Challenge{ID: c.ID, Name: sanitize(c.Name, 0), Category: sanitize(c.Category, 0), Points: c.Points, Solvers: make([]uint64, 0, len(c.Solvers))}
+		for _, i := range c.Solvers {
+			if x, ok := k[i]; ok {
+				h.Solvers = append(h.Solvers, i)
+				v.Teams[x].Solves++
+			}
+		}
+		v.Challenges = append(v.Challenges, h)
+	}
+	sort.SliceStable(v.Challenges, func(i, j int) bool {
+		if v.Challenges[i].Category != v.Challenges[j].Category {
+			return v.Challenges[i].Category < v.Challenges[j].Category
+		}
+		return v.Challenges[i].Points < v.Challenges[j].Points
+	})
+	m.lock.Lock()
+	if m.boards == nil {
+		m.boards = make(map[uint64]Board)
+	}
+	m.boards[s.ID] = v
+	m.lock.Unlock()
+}
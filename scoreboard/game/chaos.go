@@ -0,0 +1,107 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+var (
+	errDropped = errors.New("request was dropped by chaos testing")
+	errStalled = errors.New("request stalled by chaos testing")
+)
+
+// Chaos is the rate of simulated failures, from zero to one, that are injected into the
+// requests to the Source and the writes to the clients. Drop fails the request as if the
+// connection was lost, Malformed cuts the response body in half so it is not valid JSON
+// and Stall holds the request until the request timeout before failing it. Slow holds
+// the write to a client for the Delay, which also holds the writes to the clients after
+// it. Chaos is only meant for testing and should never be used during a live game.
+type Chaos struct {
+	Drop      float64
+	Malformed float64
+	Stall     float64
+	Slow      float64
+	Delay     time.Duration
+}
+
+// Chaos sets the rate of simulated failures injected into the Source and the clients.
+// A zero Chaos disables it.
+func (m *Manager) Chaos(c Chaos) {
+	m.lock.Lock()
+	m.chaos = c
+	m.lock.Unlock()
+}
+func (m *Manager) chance(f func(Chaos) float64) bool {
+	m.lock.Lock()
+	v := f(m.chaos)
+	m.lock.Unlock()
+	return v > 0 && rand.Float64() < v
+}
+
+// inject returns a simulated failure for a request to the Source, if one was picked. A
+// stalled request is held until the request timeout or the context is canceled.
+func (m *Manager) inject(x context.Context, u string) error {
+	if m.chance(func(c Chaos) float64 { return c.Drop }) {
+		m.log.Debug(`Chaos testing dropped the request "%s".`, u)
+		return errDropped
+	}
+	if !m.chance(func(c Chaos) float64 { return c.Stall }) {
+		return nil
+	}
+	m.log.Debug(`Chaos testing stalled the request "%s".`, u)
+	t := time.NewTimer(m.timeout)
+	select {
+	case <-x.Done():
+		t.Stop()
+		return x.Err()
+	case <-t.C:
+	}
+	return errStalled
+}
+
+// mangle cuts the response body in half, if a malformed response was picked. The body
+// is not changed, as it may be the cached response.
+func (m *Manager) mangle(u string, b []byte) []byte {
+	if len(b) == 0 || !m.chance(func(c Chaos) float64 { return c.Malformed }) {
+		return b
+	}
+	m.log.Debug(`Chaos testing sent a malformed response for "%s".`, u)
+	return b[:len(b)/2]
+}
+
+// lag holds the write to a client for the chaos Delay, if a slow client was picked.
+func (m *Manager) lag(x context.Context) {
+	if !m.chance(func(c Chaos) float64 { return c.Slow }) {
+		return
+	}
+	m.lock.Lock()
+	d := m.chaos.Delay
+	m.lock.Unlock()
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	select {
+	case <-x.Done():
+		t.Stop()
+	case <-t.C:
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const clockEvent = 6
+
+// Countdown is the state of the game clock of a Game. Remaining is the number of
+// seconds left until the End time, which stops counting while the clock is paused,
+// and Until is the number of seconds left until the Start time.
+type Countdown struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Game      uint64    `json:"game"`
+	Until     int64     `json:"until"`
+	Remaining int64     `json:"remaining"`
+	Paused    bool      `json:"paused"`
+	Started   bool      `json:"started"`
+	Ended     bool      `json:"ended"`
+}
+type clock struct {
+	Start  time.Time
+	End    time.Time
+	Paused time.Time
+}
+
+// Clock sets the start and end time of the game clock of the Game with the supplied ID,
+// which replaces the times sent by the Source. An ID of zero sets the clock of every
+// Game that does not have its own clock. Either time may be zero, but the end time is
+// required to count down. If both times are zero, the clock is removed and the times
+// sent by the Source are used.
+func (m *Manager) Clock(i uint64, start, end time.Time) error {
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return errors.New("clock end time must be after the start time")
+	}
+	if m.Locked(i) {
+		return ErrLocked
+	}
+	m.lock.Lock()
+	if m.clocks == nil {
+		m.clocks = make(map[uint64]*clock)
+	}
+	if start.IsZero() && end.IsZero() {
+		delete(m.clocks, i)
+	} else {
+		m.clocks[i] = &clock{Start: start, End: end}
+	}
+	m.lock.Unlock()
+	m.log.Info("Set the clock of Game %d to start at %s and end at %s.", i, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	return nil
+}
+
+// Suspend pauses the game clock of the Game with the supplied ID, or resumes it if p is
+// false. The end time of the clock is moved back by the time that the clock was paused.
+func (m *Manager) Suspend(i uint64, p bool) error {
+	if i == 0 {
+		return errors.New("a valid game ID is required")
+	}
+	if m.Locked(i) {
+		return ErrLocked
+	}
+	n := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c, ok := m.clocks[i]
+	if !ok {
+		v, ok := m.timers[i]
+		if !ok {
+			var d *clock
+			if d, ok = m.clocks[0]; ok {
+				v = *d
+			}
+		}
+		if !ok || v.End.IsZero() {
+			return errors.New("game " + strconv.FormatUint(i, 10) + " does not have a clock end time")
+		}
+		if m.clocks == nil {
+			m.clocks = make(map[uint64]*clock)
+		}
+		c = &clock{Start: v.Start, End: v.End, Paused: v.Paused}
+		m.clocks[i] = c
+	}
+	switch {
+	case p && !c.Paused.IsZero():
+		return errors.New("the clock of game " + strconv.FormatUint(i, 10) + " is already paused")
+	case !p && c.Paused.IsZero():
+		return errors.New("the clock of game " + strconv.FormatUint(i, 10) + " is not paused")
+	case p:
+		c.Paused = n
+		m.log.Info("Paused the clock of Game %d.", i)
+	default:
+		if !c.End.IsZero() {
+			c.End = c.End.Add(n.Sub(c.Paused))
+		}
+		c.Paused = time.Time{}
+		m.log.Info("Resumed the clock of Game %d, which now ends at %s.", i, c.End.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Extend moves the end time of the game clock of the Game with the supplied ID by the
+// supplied duration, which may be negative to shorten the Game.
+func (m *Manager) Extend(i uint64, d time.Duration) error {
+	if i == 0 {
+		return errors.New("a valid game ID is required")
+	}
+	if m.Locked(i) {
+		return ErrLocked
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c, ok := m.clocks[i]
+	if !ok {
+		v, ok := m.timers[i]
+		if !ok || v.End.IsZero() {
+			return errors.New("game " + strconv.FormatUint(i, 10) + " does not have a clock end time")
+		}
+		if m.clocks == nil {
+			m.clocks = make(map[uint64]*clock)
+		}
+		c = &clock{Start: v.Start, End: v.End, Paused: v.Paused}
+		m.clocks[i] = c
+	}
+	if c.End.IsZero() {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " does not have a clock end time")
+	}
+	c.End = c.End.Add(d)
+	m.log.Info("Moved the clock end of Game %d by %s to %s.", i, d.String(), c.End.Format(time.RFC3339))
+	return nil
+}
+
+// Warnings sets the remaining times at which a ClockWarning Change is sent to the ticker,
+// such as "30 minutes remaining". A ClockWarning is also sent when the clock ends.
+func (m *Manager) Warnings(d []time.Duration) {
+	m.warnings = make([]time.Duration, 0, len(d))
+	for i := range d {
+		if d[i] > 0 {
+			m.warnings = append(m.warnings, d[i])
+		}
+	}
+	sort.Slice(m.warnings, func(i, j int) bool { return m.warnings[i] > m.warnings[j] })
+}
+
+// Countdown returns the game clock of the Game with the supplied ID. Clocks that use
+// the times sent by the Source are only known while the Game is subscribed. If the
+// Game does not have a clock, this function returns false.
+func (m *Manager) Countdown(i uint64) (Countdown, bool) {
+	m.lock.Lock()
+	c, ok := m.timers[i]
+	if v, k := m.clocks[i]; k {
+		c, ok = *v, true
+	} else if v, k = m.clocks[0]; k {
+		c, ok = *v, true
+	}
+	m.lock.Unlock()
+	if !ok {
+		return Countdown{}, false
+	}
+	return c.countdown(i, time.Now()), true
+}
+func (c clock) same(o clock) bool {
+	return c.Start.Equal(o.Start) && c.End.Equal(o.End) && c.Paused.Equal(o.Paused)
+}
+func (c clock) countdown(i uint64, n time.Time) Countdown {
+	v := Countdown{Game: i, Start: c.Start, End: c.End, Paused: !c.Paused.IsZero()}
+	if v.Paused {
+		n = c.Paused
+	}
+	if v.Started = c.Start.IsZero() || !n.Before(c.Start); !v.Started {
+		v.Until = int64((c.Start.Sub(n) + time.Second - 1) / time.Second)
+	}
+	if c.End.IsZero() {
+		return v
+	}
+	if r := c.End.Sub(n); r > 0 {
+		v.Remaining = int64((r + time.Second - 1) / time.Second)
+	} else {
+		v.Ended = true
+	}
+	return v
+}
+func (c Countdown) update() update {
+	d := map[string]string{
+		"start":     "",
+		"end":       "",
+		"until":     strconv.FormatInt(c.Until, 10),
+		"remaining": strconv.FormatInt(c.Remaining, 10),
+		"paused":    strconv.FormatBool(c.Paused),
+		"started":   strconv.FormatBool(c.Started),
+		"ended":     strconv.FormatBool(c.Ended),
+	}
+	if !c.Start.IsZero() {
+		d["start"] = c.Start.UTC().Format(time.RFC3339)
+	}
+	if !c.End.IsZero() {
+		d["end"] = c.End.UTC().Format(time.RFC3339)
+	}
+	return update{ID: "clock", Data: d, Event: true, Value: strconv.Itoa(clockEvent)}
+}
+
+// clock returns the game clock of the Game with the supplied metadata and saves it as
+// the clock shown to clients.
+func (m *Manager) clock(g *meta) (clock, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c, ok := m.clocks[g.ID]
+	if !ok {
+		c, ok = m.clocks[0]
+	}
+	var v clock
+	switch {
+	case ok:
+		v = *c
+	case !g.Start.IsZero() || !g.End.IsZero():
+		v = clock{Start: g.Start, End: g.End}
+	default:
+		delete(m.timers, g.ID)
+		return v, false
+	}
+	if m.timers == nil {
+		m.timers = make(map[uint64]clock)
+	}
+	m.timers[g.ID] = v
+	return v, true
+}
+
+// countdown returns the current game clock update for new clients of the Game with the
+// supplied ID, or nil if the Game does not have a clock.
+func (m *Manager) countdown(i uint64) []update {
+	if c, ok := m.Countdown(i); ok {
+		return []update{c.update()}
+	}
+	return nil
+}
+
+// tick sends the game clock of the Game to the clients of the subscription when it has
+// changed and sends any warnings for the remaining time that has passed. This function
+// returns true if any warnings were added to the ticker.
+func (s *subscription) tick(x context.Context, m *Manager, n time.Time) bool {
+	g := meta{ID: s.ID}
+	for i := range m.Games {
+		if m.Games[i].ID == s.ID {
+			g = m.Games[i]
+			break
+		}
+	}
+	c, ok := m.clock(&g)
+	if !ok {
+		if s.timed {
+			s.timed = false
+			s.broadcast(x, m, []update{{ID: "clock", Event: true, Value: strconv.Itoa(clockEvent), Remove: true}})
+		}
+		return false
+	}
+	var (
+		u []update
+		r []Change
+		v = c.countdown(s.ID, n)
+	)
+	if !s.timed || !s.clock.same(c) {
+		u = append(u, v.update())
+	}
+	if s.timed && !v.Paused && v.Started && !c.End.IsZero() {
+		// Only the shortest warning that was passed is sent, in case the clock was
+		// moved past several warnings at once.
+		var w time.Duration
+		for _, d := range m.warnings {
+			if l := int64(d / time.Second); s.left > l && v.Remaining <= l && !v.Ended {
+				w = d
+			}
+		}
+		if w > 0 {
+			r = append(r, Change{Time: n, Kind: ClockWarning, Game: g.Name, GameID: s.ID, Text: remaining(w) + " remaining", New: v.Remaining, Old: s.left})
+		}
+		if v.Ended && s.left > 0 {
+			r = append(r, Change{Time: n, Kind: ClockWarning, Game: g.Name, GameID: s.ID, Text: "Time is up, the game clock has ended", Old: s.left})
+			r = append(r, s.conclude(m, &g, c, n)...)
+		}
+		if len(r) > 0 {
+			u = append(u, s.changes(m, r)...)
+		}
+	}
+	s.clock, s.left, s.timed = c, v.Remaining, true
+	if len(u) > 0 {
+		s.broadcast(x, m, u)
+	}
+	return len(r) > 0
+}
+
+// broadcast sends the updates to the clients of the subscription and any public clients.
+// The updates are only encoded once for both.
+func (s *subscription) broadcast(x context.Context, m *Manager, u []update) {
+	if s.lag != nil {
+		s.lag.accept()
+	}
+	if u = s.dedupe(u); len(u) == 0 {
+		return
+	}
+	b, err := payload(u)
+	if err != nil {
+		m.log.Error("Unable to encode %d Updates for Game %d: %s!", len(u), s.ID, err.Error())
+		return
+	}
+	if s.write(x, m, u, b.Bytes()); s.lag != nil {
+		s.lag.write(x, m, u, b.Bytes())
+	}
+	release(b)
+}
+func remaining(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return strconv.FormatInt(int64(d/time.Hour), 10) + " hours"
+	case d >= time.Minute && d%time.Minute == 0:
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return strconv.FormatInt(int64(d/time.Minute), 10) + " minutes"
+	case d == time.Second:
+		return "1 second"
+	}
+	return strconv.FormatInt(int64(d/time.Second), 10) + " seconds"
+}
+func (m *Manager) saveClocks() map[uint64]clock {
+	m.lock.Lock()
+	o := make(map[uint64]clock, len(m.clocks))
+	for k, v := range m.clocks {
+		o[k] = *v
+	}
+	m.lock.Unlock()
+	return o
+}
@@ -0,0 +1,280 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+)
+
+const ctfdSolves = 10
+
+type ctfd struct {
+	lock   sync.Mutex
+	m      *Manager
+	url    url.URL
+	seen   map[uint64]struct{}
+	token  string
+	name   string
+	teams  []ctfdTeam
+	list   []ctfdChallenge
+	counts map[uint64]uint32
+	solves map[uint64]uint32
+	solved map[uint64][]uint64
+	events []event
+	ready  bool
+	stale  bool
+}
+type ctfdTeam struct {
+	Name    string `json:"name"`
+	Bracket string `json:"bracket_name"`
+	ID      uint64 `json:"account_id"`
+	Score   int64  `json:"score"`
+}
+type ctfdSolve struct {
+	Name string `json:"name"`
+	ID   uint64 `json:"account_id"`
+}
+type ctfdResult struct {
+	Data    json.RawMessage `json:"data"`
+	Success bool            `json:"success"`
+}
+type ctfdChallenge struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	ID       uint64 `json:"id"`
+	Value    int64  `json:"value"`
+	Solves   uint32 `json:"solves"`
+}
+
+func (c *ctfd) meta() meta {
+	return meta{ID: singleGame, Name: c.name, Mode: jeopardy, Status: running}
+}
+func (*ctfd) Capabilities() capability {
+	return capEvents | capSolves
+}
+func newCTFd(m *Manager, c json.RawMessage) (adapter, error) {
+	var v struct {
+		URL   string `json:"url"`
+		Name  string `json:"name"`
+		Token string `json:"token"`
+	}
+	if len(c) > 0 {
+		if err := json.Unmarshal(c, &v); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.URL) == 0 {
+		return nil, errors.New("ctfd source URL is missing")
+	}
+	u, err := url.Parse(v.URL)
+	if err != nil {
+		return nil, errors.New(`could not unpack URL "` + v.URL + `": ` + err.Error())
+	}
+	if !u.IsAbs() {
+		u.Scheme = "http"
+	}
+	if len(v.Name) == 0 {
+		v.Name = "CTFd"
+	}
+	return &ctfd{
+		m:      m,
+		url:    *u,
+		name:   v.Name,
+		seen:   make(map[uint64]struct{}),
+		token:  v.Token,
+		counts: make(map[uint64]uint32),
+		solves: make(map[uint64]uint32),
+		solved: make(map[uint64][]uint64),
+	}, nil
+}
+func (c *ctfd) Games(x context.Context) ([]meta, error) {
+	err := c.update(x)
+	if err != nil && err != errNotModified {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.stale = err == errNotModified
+	c.lock.Unlock()
+	return []meta{c.meta()}, err
+}
+func (c *ctfd) Fetch(_ context.Context, i uint64) (*game, error) {
+	if i != singleGame {
+		return &game{}, nil
+	}
+	c.lock.Lock()
+	g := &game{Meta: c.meta(), Message: c.name, Teams: make([]team, len(c.teams))}
+	for i := range c.teams {
+		g.Teams[i] = team{
+			ID:       c.teams[i].ID,
+			Name:     c.teams[i].Name,
+			Score:    score{Total: c.teams[i].Score},
+			Division: c.teams[i].Bracket,
+			Flags:    scoreFlag{Captured: c.counts[c.teams[i].ID]},
+		}
+	}
+	g.Challenges = make([]Challenge, len(c.list))
+	for i := range c.list {
+		g.Challenges[i] = Challenge{
+			ID:       c.list[i].ID,
+			Name:     c.list[i].Name,
+			Points:   c.list[i].Value,
+			Solvers:  c.solved[c.list[i].ID],
+			Category: c.list[i].Category,
+		}
+	}
+	g.Events.Current = make([]event, len(c.events))
+	copy(g.Events.Current, c.events)
+	v := c.stale
+	if c.lock.Unlock(); v {
+		return g, errNotModified
+	}
+	return g, nil
+}
+func (c *ctfd) update(x context.Context) error {
+	var (
+		t []ctfdTeam
+		l []ctfdChallenge
+		e [2]error
+	)
+	c.m.parallel(2, func(i int) {
+		if i == 0 {
+			e[0] = c.getJSON(x, "api/v1/scoreboard", &t)
+		} else {
+			e[1] = c.getJSON(x, "api/v1/challenges", &l)
+		}
+	})
+	for i := range e {
+		if e[i] != nil && e[i] != errNotModified {
+			return e[i]
+		}
+	}
+	if e[0] == errNotModified && e[1] == errNotModified {
+		return errNotModified
+	}
+	c.lock.Lock()
+	if e[0] == errNotModified {
+		t = c.teams
+	}
+	if e[1] == errNotModified {
+		l = c.list
+	}
+	c.lock.Unlock()
+	w := make([]int, 0, len(l))
+	for i := range l {
+		if l[i].Solves > c.solves[l[i].ID] {
+			w = append(w, i)
+		}
+	}
+	r := make([][]ctfdSolve, len(w))
+	c.m.parallel(len(w), func(i int) {
+		v := l[w[i]].ID
+		if err := c.getJSON(x, "api/v1/challenges/"+strconv.FormatUint(v, 10)+"/solves", &r[i]); err != nil {
+			c.m.log.Error("Error retrieving CTFd solves for challenge %d: %s!", v, err.Error())
+			r[i] = nil
+		}
+	})
+	n := make(map[uint64]string, len(t))
+	for i := range t {
+		n[t[i].ID] = t[i].Name
+	}
+	var (
+		o []event
+		k = make(map[uint64]uint32)
+		d = make(map[uint64][]uint64)
+	)
+	for i := range w {
+		if r[i] == nil {
+			continue
+		}
+		h, s := &l[w[i]], r[i]
+		f := c.solves[h.ID] == 0
+		for v := range s {
+			q := h.ID<<32 | s[v].ID&0xFFFFFFFF
+			if _, ok := c.seen[q]; ok {
+				continue
+			}
+			c.seen[q] = struct{}{}
+			d[h.ID] = append(d[h.ID], s[v].ID)
+			if k[s[v].ID]++; !c.ready {
+				continue
+			}
+			if len(s[v].Name) == 0 {
+				s[v].Name = n[s[v].ID]
+			}
+			c.m.log.Debug(`CTFd team "%s" solved challenge "%s".`, s[v].Name, h.Name)
+			e := event{
+				ID: q,
+				Data: map[string]string{
+					"text": s[v].Name + " solved " + h.Category + "/" + h.Name + " for " + strconv.FormatInt(h.Value, 10) + " points",
+				},
+			}
+			if f {
+				e.Data["text"] = "First blood! " + e.Data["text"]
+				e.Data["kind"], e.Data["highlight"] = firstBlood, "true"
+				e.Data["team"], e.Data["team_name"] = strconv.FormatUint(s[v].ID, 10), s[v].Name
+				f = false
+			}
+			o = append(o, e)
+		}
+		c.solves[h.ID] = h.Solves
+	}
+	c.lock.Lock()
+	for i, v := range k {
+		c.counts[i] += v
+	}
+	// The solver lists are replaced instead of appended to, so the Games that were
+	// already fetched keep the lists they were given.
+	for i, v := range d {
+		c.solved[i] = append(append(make([]uint64, 0, len(c.solved[i])+len(v)), c.solved[i]...), v...)
+	}
+	if c.teams, c.list, c.ready = t, l, true; len(o) > 0 {
+		if c.events = append(c.events, o...); len(c.events) > ctfdSolves {
+			c.events = c.events[len(c.events)-ctfdSolves:]
+		}
+	}
+	c.lock.Unlock()
+	return nil
+}
+func (c *ctfd) getJSON(x context.Context, p string, d interface{}) error {
+	u := c.url
+	u.Path = path.Join(u.Path, p)
+	h := map[string]string{"Content-Type": "application/json"}
+	if len(c.token) > 0 {
+		h["Authorization"] = "Token " + c.token
+	}
+	b, err := c.m.request(x, u.String(), h)
+	if err != nil {
+		return err
+	}
+	var v ctfdResult
+	if err = json.Unmarshal(b, &v); err != nil {
+		return errors.New(`unable to unmarshal JSON from "` + u.String() + `": ` + err.Error())
+	}
+	if !v.Success {
+		return errors.New(`request "` + u.String() + `" was not successful`)
+	}
+	if err = json.Unmarshal(v.Data, d); err != nil {
+		return errors.New(`unable to unmarshal JSON from "` + u.String() + `": ` + err.Error())
+	}
+	return nil
+}
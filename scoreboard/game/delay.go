@@ -0,0 +1,135 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Delay sets the amount of time that the Game scores and events shown to clients added
+// with the Public function are behind real time. The delayed Game is read from the
+// supplied Recording. This function must be called before any Games are subscribed.
+func (m *Manager) Delay(r Recording, d time.Duration) {
+	if r == nil || d <= 0 {
+		return
+	}
+	m.record, m.delay = r, d
+}
+
+// Public is similar to the New function, but the client is shown the Game as it was at
+// the time set by the Delay function and with the team names hidden by the Anonymize
+// function. If neither was set, this function is the same as the New function.
+func (m *Manager) Public(n *websocket.Conn, r *http.Request) {
+	if m.delay == 0 && m.anon == anonNone {
+		m.New(n, r)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			m.recovered("public client", err)
+		}
+	}()
+	m.log.Debug(`Received a public connection from "%s", listening for Hello..`, n.RemoteAddr().String())
+	var h hello
+	if err := n.ReadJSON(&h); err != nil {
+		m.log.Error(`Could not read Hello message from "%s", closing: %s!`, n.RemoteAddr().String(), err.Error())
+		n.Close()
+		return
+	}
+	s, ok := m.subs[h.Game]
+	if !ok || s == nil {
+		m.log.Debug(`Checking Game ID %d, requested by "%s"..`, h.Game, n.RemoteAddr().String())
+		if s = m.subscribe(context.Background(), h.Game); s == nil {
+			n.Close()
+			return
+		}
+	}
+	atomic.StoreUint32(&s.stale, 0)
+	q, v := atomic.LoadUint64(&s.lag.seq), h.protocol(n)
+	c := &stream{Conn: n, ok: true, seq: &q, slice: h.Slice, version: v, display: m.greet(n, r, h.Game, v, false, true)}
+	if s.lag.cache == nil {
+		c.send([]update{})
+	} else {
+		c.send(c.board(s.lag.cache))
+	}
+	if v := m.countdown(h.Game); v != nil {
+		c.send(v)
+	}
+	if v := s.health; v != nil {
+		c.send(v)
+	}
+	if v := m.announcements(); len(v) > 0 {
+		c.send(v)
+	}
+	c.seq = &s.lag.seq
+	go c.listen()
+	s.lag.new <- c
+}
+func (m *Manager) shadow(s *subscription) {
+	if m.delay == 0 && m.anon == anonNone {
+		return
+	}
+	s.lag = &subscription{
+		ID:      s.ID,
+		new:     make(chan *stream, 128),
+		clients: make([]*stream, 0, 1),
+	}
+	if m.delay == 0 {
+		// Without a delay, the public clients are sent a masked copy of the live
+		// Game during each update.
+		s.lag.last, _ = m.mask(&s.last, nil)
+		s.lag.cache, _ = s.lag.last.Delta(m.assets, nil)
+		return
+	}
+	s.lag.behind = &replay{
+		rec:      m.record,
+		lag:      true,
+		reset:    true,
+		Playback: Playback{Game: s.ID, Start: time.Unix(0, 0), Paused: true},
+	}
+}
+
+// lagging sends the delayed Game to the delayed clients of each subscription that is
+// not being replayed. The delayed Game does not move past the time of a Freeze until
+// the Game is revealed.
+func (m *Manager) lagging(x context.Context, p map[uint64]*replay) {
+	if m.delay == 0 {
+		return
+	}
+	n := time.Now().Add(-m.delay)
+	for _, s := range m.subs {
+		if _, ok := p[s.ID]; ok || s.lag == nil {
+			continue
+		}
+		if s.lag.accept(); len(s.lag.clients) == 0 {
+			continue
+		}
+		t := n
+		if f, ok := m.frozen(s.ID); ok && f.thaw.IsZero() && f.at.Before(t) {
+			t = f.at
+		}
+		s.lag.behind.Lock()
+		s.lag.behind.Position, s.lag.behind.End = t, t
+		s.lag.behind.Unlock()
+		s.lag.play(x, m, s.lag.behind, &s.last)
+	}
+}
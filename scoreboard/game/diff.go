@@ -0,0 +1,366 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	ev "github.com/PvJScorebot/scorebot-scoreboard/scoreboard/events"
+)
+
+// Kinds of Changes that can be detected between two Game states.
+const (
+	ScoreIncrease   = ev.ScoreIncrease
+	RankChange      = ev.RankChange
+	ServiceDown     = ev.ServiceDown
+	ServiceUp       = ev.ServiceUp
+	FlagCapture     = ev.FlagCapture
+	BeaconPlanted   = ev.BeaconPlanted
+	FirstBlood      = ev.FirstBlood
+	Milestone       = ev.Milestone
+	FirstPlace      = ev.FirstPlace
+	ScoreAdjustment = ev.ScoreAdjustment
+	ClockWarning    = ev.ClockWarning
+	BeaconCleared   = ev.BeaconCleared
+	Attack          = ev.Attack
+	HillTaken       = ev.HillTaken
+	GameOver        = ev.GameOver
+	SourceStale     = ev.SourceStale
+	Summary         = ev.Summary
+)
+
+const (
+	feedSize  = 10
+	feedEvent = 4
+	tweetSize = 50
+)
+
+const firstBlood = "first_blood"
+
+// Kind is the type of a Change. It is the same as the Kind of the events package.
+type Kind = ev.Kind
+
+// Change is a typed event that was detected by comparing two consecutive states of
+// a Game. Changes are sent to the ticker, the connected clients and any hooks added
+// with the Hook function. It is the same as the Change of the events package.
+type Change = ev.Change
+
+// Standing is the score and rank of a single team in a Snapshot. It is the same as
+// the Standing of the events package.
+type Standing = ev.Standing
+
+// Snapshot contains the standings of all teams in a Game at a point in time. Snapshots are
+// sent to any functions added with the Watch function when the standings change. It
+// is the same as the Snapshot of the events package.
+type Snapshot = ev.Snapshot
+
+// Hook adds a function that will be called for every Change detected in a subscribed
+// Game. Hooks are called in order from the update thread and should not block. Hooks
+// may be called at the same time for different Games. Adding a Hook will keep all
+// active Games subscribed, even without any connected clients.
+func (m *Manager) Hook(f func(Change)) {
+	if f != nil {
+		m.hooks = append(m.hooks, f)
+	}
+}
+
+// Announce sets the function that decides how each Change is announced on the ticker.
+// The function is called with the Change and whether it would be added to the ticker,
+// and returns the ticker text, or an empty string to keep the Change text, and whether
+// to add it to the ticker. Like Hooks, the function should not block.
+func (m *Manager) Announce(f func(Change, bool) (string, bool)) {
+	m.announce = f
+}
+
+// Watch adds a function that will be called with a Snapshot of the Game standings when a
+// Game is first subscribed and each time the team scores change afterwards. Like Hooks,
+// Watch functions should not block and adding one will keep all active Games subscribed.
+func (m *Manager) Watch(f func(Snapshot)) {
+	if f != nil {
+		m.watch = append(m.watch, f)
+	}
+}
+
+// ParseKind returns the Kind that matches the supplied name. The boolean will be false
+// if the name does not match any Kind.
+func ParseKind(s string) (Kind, bool) {
+	return ev.ParseKind(s)
+}
+
+// Milestone sets the score interval used to detect score milestones. A Milestone Change
+// is created each time a team score crosses a multiple of this value. Zero disables
+// milestone detection.
+func (m *Manager) Milestone(n int64) {
+	if n >= 0 {
+		m.milestone = n
+	}
+}
+
+// Limit sets the most Tweets shown at once and the most ticker events kept for each
+// Game. The oldest Tweets and events are removed once a limit is reached, which keeps
+// the memory used by long running Games from growing. Zero uses the default limits.
+func (m *Manager) Limit(tweets, events int) {
+	if tweets >= 0 {
+		m.tweetMax = tweets
+	}
+	if events >= 0 {
+		m.feedMax = events
+	}
+}
+func (m *Manager) tweetLimit() int {
+	if m.tweetMax == 0 {
+		return tweetSize
+	}
+	return m.tweetMax
+}
+
+// trim removes the oldest events of the ticker feed that are over the limit.
+func (m *Manager) trim(e []event) []event {
+	k := m.feedMax
+	if k == 0 {
+		k = feedSize
+	}
+	if len(e) <= k {
+		return e
+	}
+	atomic.AddUint64(&m.stats.events, uint64(len(e)-k))
+	return e[len(e)-k:]
+}
+func ranks(g *game) map[uint64]int64 {
+	var (
+		_, v = g.ranked()
+		r    = make(map[uint64]int64, len(g.Teams))
+	)
+	for i := range g.Teams {
+		r[g.Teams[i].ID] = v[i]
+	}
+	return r
+}
+
+// record returns the ticker event of the Change.
+func record(c Change) event {
+	var h hasher
+	h.Hash(c.GameID)
+	h.Hash(c.TeamID)
+	h.Hash(uint8(c.Kind))
+	h.Hash(c.Text)
+	h.Hash(c.Time.UnixNano())
+	// The team name, values and time are included so clients can show the ticker text
+	// in their own language and time zone.
+	e := event{
+		ID: h.Sum64()&0x1FFFFFFFFFFFFF | 1,
+		Data: map[string]string{
+			"text": c.Text,
+			"kind": c.Kind.String(),
+			"team": strconv.FormatUint(c.TeamID, 10),
+			"name": c.Team,
+			"old":  strconv.FormatInt(c.Old, 10),
+			"new":  strconv.FormatInt(c.New, 10),
+			"time": c.Time.UTC().Format(time.RFC3339),
+		},
+	}
+	if c.Kind.Highlight() {
+		e.Data["highlight"] = "true"
+	}
+	if len(c.Host) > 0 {
+		e.Data["host"], e.Data["port"] = c.Host, strconv.FormatUint(uint64(c.Service), 10)
+	}
+	if len(c.Other) > 0 {
+		e.Data["other"] = c.Other
+	}
+	if c.OtherID > 0 {
+		e.Data["other_id"] = strconv.FormatUint(c.OtherID, 10)
+	}
+	return e
+}
+func item(e event) update {
+	d := make(map[string]string, len(e.Data))
+	for k, v := range e.Data {
+		d[k] = v
+	}
+	return update{ID: strconv.FormatUint(e.ID, 10), Data: d, Event: true, Value: strconv.Itoa(feedEvent)}
+}
+func diff(o, n *game, t time.Time, m int64) []Change {
+	if len(o.Teams) == 0 || len(n.Teams) == 0 {
+		return nil
+	}
+	return ev.Detect(o.model(), n.model(), t, m)
+}
+
+// model returns the Game as an events Game, with the ranks of the Game sort policy and
+// the first blood events announced by the Source.
+func (g *game) model() *ev.Game {
+	var (
+		r = ranks(g)
+		v = &ev.Game{
+			ID:       g.Meta.ID,
+			Name:     g.Meta.Name,
+			Teams:    make([]ev.Team, len(g.Teams)),
+			Jeopardy: g.Meta.Mode == jeopardy,
+		}
+	)
+	for i := range g.Teams {
+		t := &g.Teams[i]
+		e := ev.Team{
+			ID:       t.ID,
+			Name:     t.Name,
+			Rank:     r[t.ID],
+			Lost:     t.Flags.Lost,
+			Score:    t.Score.Total,
+			Bonus:    t.bonus,
+			Hosts:    make([]ev.Host, len(t.Hosts)),
+			Captured: t.Flags.Captured,
+		}
+		for x := range t.Hosts {
+			e.Hosts[x] = ev.Host{ID: t.Hosts[x].ID, Name: t.Hosts[x].Name, Services: make([]ev.Service, len(t.Hosts[x].Services))}
+			for y, s := range t.Hosts[x].Services {
+				e.Hosts[x].Services[y] = ev.Service{ID: s.ID, Port: s.Port, State: ev.State(s.State), Lost: s.Lost}
+			}
+		}
+		if len(t.Beacons) > 0 {
+			e.Beacons = make([]ev.Beacon, len(t.Beacons))
+			for x, b := range t.Beacons {
+				e.Beacons[x] = ev.Beacon{ID: b.ID, Host: b.Host, Team: b.Team}
+			}
+		}
+		v.Teams[i] = e
+	}
+	if len(g.Hills) > 0 {
+		v.Hills = make([]ev.Hill, len(g.Hills))
+		for i, h := range g.Hills {
+			v.Hills[i] = ev.Hill{ID: h.ID, Name: h.Name, Owner: h.Owner}
+		}
+	}
+	for i := range g.Events.Current {
+		if g.Events.Current[i].Data["kind"] != firstBlood {
+			continue
+		}
+		s := ev.Solve{ID: g.Events.Current[i].ID, Name: g.Events.Current[i].Data["team_name"], Text: g.Events.Current[i].Data["text"]}
+		s.Team, _ = strconv.ParseUint(g.Events.Current[i].Data["team"], 10, 64)
+		v.Solves = append(v.Solves, s)
+	}
+	return v
+}
+func (s *subscription) changes(m *Manager, c []Change) []update {
+	var (
+		u = make([]update, 0, len(c))
+		p = make([]pending, 0, len(c))
+	)
+	for i := range c {
+		m.log.Debug(`Detected "%s" change in Game %d: %s.`, c[i].Kind, s.ID, c[i].Text)
+		// Only the leader of a cluster calls the hooks, so each Change is only sent
+		// once by the cluster.
+		for _, f := range m.hooks {
+			if m.leading() {
+				m.guard("hook", func() { f(c[i]) })
+			}
+		}
+		// Attacks are already on the ticker as the flag or beacon Change that they were
+		// found from, and stale Source alerts are only meant for the operators.
+		e, t := record(c[i]), c[i].Kind != ScoreIncrease && c[i].Kind != Attack && c[i].Kind != SourceStale && !c[i].Sourced
+		if c[i].Kind == Attack {
+			s.plot(e.Data, c[i])
+		}
+		if m.announce != nil {
+			m.guard("announce", func() {
+				var v string
+				if v, t = m.announce(c[i], t); len(v) > 0 {
+					e.Data["text"], e.Data["announced"] = v, "true"
+				}
+			})
+		}
+		v := item(e)
+		if m.effect(c[i].Kind, &v); !t {
+			u = append(u, v)
+			continue
+		}
+		p = append(p, pending{c: c[i], e: e, u: v, n: 1})
+	}
+	u = append(u, s.smooth(m, p, time.Now())...)
+	s.feed = m.trim(s.feed)
+	return u
+}
+
+// snapshot returns the standings of the Game. The team logos have the asset prefix a,
+// the same as the logos shown to clients, which is added if the Game was not shown yet.
+func (g *game) snapshot(t time.Time, a string) Snapshot {
+	var (
+		v, r = g.ranked()
+		s    = Snapshot{Time: t, Game: g.Meta.Name, GameID: g.Meta.ID, Teams: make([]Standing, len(g.Teams))}
+	)
+	for x, i := range v {
+		s.Teams[x] = Standing{
+			ID:          g.Teams[i].ID,
+			Name:        g.Teams[i].Name,
+			Rank:        r[i],
+			Score:       g.Teams[i].Score.Total,
+			Health:      g.Teams[i].Score.Health,
+			Division:    g.Teams[i].Division,
+			Country:     g.Teams[i].Country,
+			Affiliation: g.Teams[i].Affiliation,
+			Logo:        g.Teams[i].Logo,
+			Meta:        g.Teams[i].Meta,
+		}
+		if g.hash == 0 {
+			s.Teams[x].Logo = g.Teams[i].logo(a)
+		}
+	}
+	return s
+}
+func standings(o, n *game) bool {
+	if len(o.Teams) != len(n.Teams) {
+		return true
+	}
+	s := make(map[uint64]score, len(o.Teams))
+	for i := range o.Teams {
+		s[o.Teams[i].ID] = o.Teams[i].Score
+	}
+	for i := range n.Teams {
+		if v, ok := s[n.Teams[i].ID]; !ok || v.Total != n.Teams[i].Score.Total || v.Health != n.Teams[i].Score.Health {
+			return true
+		}
+	}
+	a, b := ranks(o), ranks(n)
+	for k, v := range b {
+		if a[k] != v {
+			return true
+		}
+	}
+	return false
+}
+func (m *Manager) snapshot(g *game, t time.Time) {
+	if len(g.Teams) == 0 {
+		return
+	}
+	v := g.snapshot(t, m.assets)
+	m.lock.Lock()
+	if m.latest == nil {
+		m.latest = make(map[uint64]Snapshot)
+	}
+	if o, ok := m.latest[g.Meta.ID]; ok {
+		movement(&v, o)
+	}
+	m.latest[g.Meta.ID] = v
+	if m.lock.Unlock(); !m.leading() {
+		return
+	}
+	for _, f := range m.watch {
+		m.guard("watch", func() { f(v) })
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const controlEvent = 9
+
+// The control Commands that can be sent to a Display.
+const (
+	Reload     = "reload"
+	ClearCache = "clear-cache"
+	SwitchView = "switch-view"
+	Identify   = "identify"
+	Profile    = "profile"
+	Theme      = "theme"
+	Pacing     = "pace"
+)
+
+// displays is the last ID given to a Display. IDs are shared by every Manager, so a
+// Display can be found by ID without knowing which game it shows.
+var displays uint64
+
+// Display is a browser connected to the WebSocket of the Manager, such as a projector
+// showing the Scoreboard. Sent is the number of bytes sent to the Display, Queued is the
+// number of messages sent that the Display has not read yet and Latency is the time in
+// seconds the Display took to read the last message it read, at the Acked time. Version
+// is the WebSocket protocol version used by the page of the Display.
+type Display struct {
+	Since   time.Time  `json:"since"`
+	Acked   *time.Time `json:"acked,omitempty"`
+	Address string     `json:"address"`
+	Agent   string     `json:"agent,omitempty"`
+	Page    string     `json:"page,omitempty"`
+	Client  string     `json:"client,omitempty"`
+	ID      uint64     `json:"id"`
+	Game    uint64     `json:"game"`
+	Sent    uint64     `json:"sent"`
+	Queued  uint64     `json:"queued"`
+	Latency float64    `json:"latency"`
+	Version int        `json:"protocol"`
+	Staff   bool       `json:"staff"`
+	Public  bool       `json:"public"`
+
+	t *traffic
+}
+
+// Command is a control message sent to a Display. The View is the board tab or the page
+// path shown by the SwitchView Command, the profile name of the Profile Command, the
+// theme name of the Theme Command, which is empty for the theme of the page, or the
+// profile name of the Displays that use the Pace of the Pacing Command, which is empty
+// for every Display. The Duration is the number of seconds the ID is shown by the
+// Identify Command.
+type Command struct {
+	Pace     *Pace  `json:"pace,omitempty"`
+	Action   string `json:"action"`
+	View     string `json:"view,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+// Pace is the speed of the moving parts of a Display. Ticker is the speed of the
+// scrolling text and Animation is the length of the animations, where one is the normal
+// speed and length, and Flip is the number of seconds each standings tab is shown by
+// auto scroll. Zero values are the normal pace.
+type Pace struct {
+	Ticker    float64 `json:"ticker,omitempty"`
+	Animation float64 `json:"animation,omitempty"`
+	Flip      int     `json:"flip,omitempty"`
+}
+type order struct {
+	Command
+	id uint64
+}
+
+// Displays returns the browsers connected to the Manager, ordered by when they
+// connected. Displays that have disconnected are removed the next time an update is
+// sent to them.
+func (m *Manager) Displays() []Display {
+	m.lock.Lock()
+	r := make([]Display, 0, len(m.screens))
+	for _, d := range m.screens {
+		v := *d
+		v.measure()
+		r = append(r, v)
+	}
+	m.lock.Unlock()
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	return r
+}
+
+// Command sends the control Command to the Display with the supplied ID, or to every
+// Display of the Manager if the ID is zero, on the next update tick. This function
+// returns false if the Display is not connected to the Manager.
+func (m *Manager) Command(i uint64, c Command) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if i > 0 {
+		if _, ok := m.screens[i]; !ok {
+			return false
+		}
+	}
+	m.commands = append(m.commands, order{Command: c, id: i})
+	return true
+}
+func (m *Manager) greet(n *websocket.Conn, r *http.Request, g uint64, v int, staff, public bool) *Display {
+	d := &Display{
+		ID:      atomic.AddUint64(&displays, 1),
+		t:       new(traffic),
+		Game:    g,
+		Version: v,
+		Since:   time.Now().UTC(),
+		Staff:   staff,
+		Public:  public,
+		Address: n.RemoteAddr().String(),
+	}
+	if r != nil {
+		d.Agent = r.UserAgent()
+		if a, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			d.Address = a
+		}
+		// The WebSocket is opened by the page, so the Referer is the page the
+		// Display is showing, with the client name that was set in its URL.
+		if u, err := r.URL.Parse(r.Referer()); err == nil && len(r.Referer()) > 0 {
+			d.Page, d.Client = u.Path, strings.ToLower(u.Query().Get("client"))
+		}
+	}
+	m.lock.Lock()
+	if m.screens == nil {
+		m.screens = make(map[uint64]*Display)
+	}
+	m.screens[d.ID] = d
+	m.lock.Unlock()
+	return d
+}
+
+// forget removes the Display of the client that was disconnected.
+func (m *Manager) forget(c *stream) {
+	if c.display == nil {
+		return
+	}
+	m.lock.Lock()
+	delete(m.screens, c.display.ID)
+	m.lock.Unlock()
+}
+
+// control sends the queued Commands to their Displays. Commands for Displays that have
+// since disconnected are dropped.
+func (m *Manager) control(x context.Context) {
+	m.lock.Lock()
+	o := m.commands
+	m.commands = nil
+	m.lock.Unlock()
+	if len(o) == 0 {
+		return
+	}
+	for _, s := range m.subs {
+		if s.accept(); s.lag != nil {
+			s.lag.accept()
+		}
+		for _, v := range o {
+			s.command(x, m, v)
+			if s.lag != nil {
+				s.lag.command(x, m, v)
+			}
+		}
+	}
+}
+func (s *subscription) command(x context.Context, m *Manager, o order) {
+	for _, c := range s.clients {
+		select {
+		case <-x.Done():
+			return
+		default:
+		}
+		if !c.ok || c.display == nil || (o.id > 0 && c.display.ID != o.id) {
+			continue
+		}
+		u := update{
+			ID:    "control",
+			Event: true,
+			Value: strconv.Itoa(controlEvent),
+			Data:  map[string]string{"action": o.Action, "display": strconv.FormatUint(c.display.ID, 10)},
+		}
+		if len(o.View) > 0 {
+			u.Data["view"] = o.View
+		}
+		if o.Duration > 0 {
+			u.Data["duration"] = strconv.Itoa(o.Duration)
+		}
+		if o.Pace != nil {
+			u.Data["ticker"] = strconv.FormatFloat(o.Pace.Ticker, 'f', -1, 64)
+			u.Data["animation"] = strconv.FormatFloat(o.Pace.Animation, 'f', -1, 64)
+			u.Data["flip"] = strconv.Itoa(o.Pace.Flip)
+		}
+		if err := c.send([]update{u}); err != nil {
+			// The client is removed by the next broadcast.
+			c.ok = false
+			continue
+		}
+		m.log.Info(`Sent the "%s" command to display %d at "%s".`, o.Action, c.display.ID, c.display.Address)
+	}
+}
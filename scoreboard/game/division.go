@@ -0,0 +1,115 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Divisions sets the division (or bracket) of teams by team name or ID. Divisions set
+// here replace any division sent by the Source. Team names are not case sensitive. An
+// empty map removes any divisions set here.
+func (m *Manager) Divisions(d map[string]string) {
+	if len(d) == 0 {
+		m.divisions = nil
+		return
+	}
+	m.divisions = make(map[string]string, len(d))
+	for k, v := range d {
+		m.divisions[strings.ToLower(k)] = v
+	}
+}
+
+// Logos sets the function used to replace the logo of each team with a locally cached
+// copy. The function is passed the team ID, name and the full URL of the logo sent by
+// the Source, which is empty if the team uses the default logo, and returns the URL of
+// the cached logo. Teams keep the Source logo while the function returns false.
+func (m *Manager) Logos(f func(uint64, string, string) (string, bool)) {
+	m.avatar = f
+}
+
+// Standings returns the latest Snapshot of the subscribed Game with the supplied ID. If
+// the Game is not subscribed, this function returns false.
+func (m *Manager) Standings(i uint64) (Snapshot, bool) {
+	m.lock.Lock()
+	s, ok := m.latest[i]
+	m.lock.Unlock()
+	return s, ok
+}
+
+func (m *Manager) divide(g *game) {
+	if len(m.divisions) == 0 {
+		return
+	}
+	for i := range g.Teams {
+		if v, ok := m.divisions[strconv.FormatUint(g.Teams[i].ID, 10)]; ok {
+			g.Teams[i].Division = v
+		} else if v, ok = m.divisions[strings.ToLower(g.Teams[i].Name)]; ok {
+			g.Teams[i].Division = v
+		}
+	}
+}
+
+// emblem replaces the team logos of the Game with their cached copies. The team list is
+// copied first, as the Source may reuse it.
+func (m *Manager) emblem(g *game) {
+	if m.avatar == nil {
+		return
+	}
+	var t []team
+	for i := range g.Teams {
+		u := g.Teams[i].Logo
+		if u == "default.png" {
+			u = ""
+		} else if len(u) > 0 && !strings.Contains(u, "://") {
+			u = m.assets + u
+		}
+		v, ok := m.avatar(g.Teams[i].ID, g.Teams[i].Name, u)
+		if !ok {
+			continue
+		}
+		if t == nil {
+			t = make([]team, len(g.Teams))
+			copy(t, g.Teams)
+		}
+		t[i].Logo, t[i].local, t[i].hash = v, true, 0
+	}
+	if t != nil {
+		g.Teams = t
+	}
+}
+
+// refreshed returns true if any cached team logo of the Game is not shown in the last
+// known state of the Game, which happens when a logo finishes caching.
+func (g *game) refreshed(o *game) bool {
+	for i := range g.Teams {
+		if !g.Teams[i].local {
+			continue
+		}
+		for x := range o.Teams {
+			if o.Teams[x].ID != g.Teams[i].ID {
+				continue
+			}
+			if o.Teams[x].Logo != g.Teams[i].Logo {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import "strconv"
+
+// Effect is the presentation hints sent to clients with the Changes of a Kind, so the
+// displays can play a sound and an animation, such as for first bloods and lead
+// changes. Duration is the seconds that the animation is shown for.
+type Effect struct {
+	Sound     string `json:"sound,omitempty"`
+	Animation string `json:"animation,omitempty"`
+	Duration  int    `json:"duration,omitempty"`
+}
+
+// Effects sets the presentation hints sent with the Changes of each Kind. The hints are
+// only sent with new Changes, so clients that connect later do not play them again.
+func (m *Manager) Effects(e map[Kind]Effect) {
+	if len(e) == 0 {
+		m.effects = nil
+		return
+	}
+	m.effects = make(map[Kind]Effect, len(e))
+	for k, v := range e {
+		m.effects[k] = v
+	}
+}
+
+// effect adds the presentation hints of the Kind to the Change update.
+func (m *Manager) effect(k Kind, u *update) {
+	v, ok := m.effects[k]
+	if !ok {
+		return
+	}
+	if len(v.Sound) > 0 {
+		u.Data["sound"] = v.Sound
+	}
+	if len(v.Animation) > 0 {
+		u.Data["animation"] = v.Animation
+	}
+	if v.Duration > 0 {
+		u.Data["duration"] = strconv.Itoa(v.Duration)
+	}
+}
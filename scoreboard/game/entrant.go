@@ -0,0 +1,93 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Entrant is the team metadata set by the organizers, which is merged with the teams
+// sent by the Source. Only the values that are not empty replace the Source values.
+type Entrant struct {
+	Name        string `json:"name,omitempty"`
+	Display     string `json:"display,omitempty"`
+	Logo        string `json:"logo,omitempty"`
+	Division    string `json:"division,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+	ID          uint64 `json:"id,omitempty"`
+}
+
+// Entrants sets the team metadata merged with the teams sent by the Source. Entrants
+// with an ID only match the team with that ID, and Entrants without an ID match the
+// team by name, which is not case sensitive. An empty list removes the metadata.
+func (m *Manager) Entrants(l []Entrant) {
+	if len(l) == 0 {
+		m.entrants = nil
+		return
+	}
+	e := make(map[string]Entrant, len(l))
+	for _, v := range l {
+		if v.ID > 0 {
+			e[strconv.FormatUint(v.ID, 10)] = v
+		} else if len(v.Name) > 0 {
+			e["@"+strings.ToLower(v.Name)] = v
+		}
+	}
+	m.entrants = e
+}
+
+// enroll merges the Entrants with the teams of the Game. The team list is copied first,
+// as the Source may reuse it.
+func (m *Manager) enroll(g *game) {
+	if len(m.entrants) == 0 {
+		return
+	}
+	var t []team
+	for i := range g.Teams {
+		v, ok := m.entrants[strconv.FormatUint(g.Teams[i].ID, 10)]
+		if !ok {
+			if v, ok = m.entrants["@"+strings.ToLower(g.Teams[i].Name)]; !ok {
+				continue
+			}
+		}
+		if t == nil {
+			t = make([]team, len(g.Teams))
+			copy(t, g.Teams)
+		}
+		if len(v.Display) > 0 {
+			t[i].Name = v.Display
+		}
+		if len(v.Logo) > 0 {
+			t[i].Logo = v.Logo
+		}
+		if len(v.Division) > 0 {
+			t[i].Division = v.Division
+		}
+		if len(v.Country) > 0 {
+			t[i].Country = v.Country
+		}
+		if len(v.Affiliation) > 0 {
+			t[i].Affiliation = v.Affiliation
+		}
+		t[i].hash = 0
+	}
+	if t != nil {
+		g.Teams = t
+	}
+}
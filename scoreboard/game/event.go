@@ -16,7 +16,11 @@
 
 package game
 
-import "strconv"
+import (
+	"sort"
+	"strconv"
+	"time"
+)
 
 var (
 	emptyTweet  tweet
@@ -24,9 +28,23 @@ var (
 )
 
 type event struct {
-	Data map[string]string `json:"data"`
-	ID   uint64            `json:"id"`
-	Type uint8             `json:"type"`
+	Data map[string]string      `json:"data"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+	ID   uint64                 `json:"id"`
+	Type uint8                  `json:"type"`
+}
+
+// Message is an event sent by the scoring engine Source, such as a ticker message or
+// a popup. Messages are sent to any functions added with the Listen function the first
+// time they are seen in a Game. Meta is any metadata of the event from the Source.
+type Message struct {
+	Time   time.Time              `json:"time"`
+	Data   map[string]string      `json:"data"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+	Game   string                 `json:"game"`
+	ID     uint64                 `json:"id"`
+	GameID uint64                 `json:"game_id"`
+	Type   uint8                  `json:"type"`
 }
 type events struct {
 	Window  event
@@ -35,6 +53,25 @@ type events struct {
 	hash uint64
 }
 
+// Listen adds a function that will be called for every new Message sent by the Source in
+// a subscribed Game. Like Hooks, Listen functions should not block and adding one will
+// keep all active Games subscribed.
+func (m *Manager) Listen(f func(Message)) {
+	if f != nil {
+		m.listen = append(m.listen, f)
+	}
+}
+func (m *Manager) observed() bool {
+	if len(m.hooks) > 0 || len(m.watch) > 0 || len(m.listen) > 0 || len(m.monitor) > 0 || m.leader != nil {
+		return true
+	}
+	// Replicas can show any active Game, so every active Game is kept subscribed
+	// once a replica was added.
+	m.lock.Lock()
+	r := m.mirrors != nil
+	m.lock.Unlock()
+	return r
+}
 func (e event) Sum() uint64 {
 	return e.ID
 }
@@ -47,18 +84,28 @@ func (e *events) Hash(h *hasher) uint64 {
 				h.Hash(k)
 				h.Hash(v)
 			}
+			hashExtra(h, e.Current[i].Meta)
 		}
 		e.hash = h.Segment()
 	}
 	return e.hash
 }
+
+// key returns the element ID of the Tweet, which is under the element of its display
+// channel, if it has one.
+func (t tweet) key() string {
+	if len(t.Channel) == 0 {
+		return "tweet-t" + strconv.FormatUint(t.ID, 10)
+	}
+	return "tweet-" + t.Channel + "-t" + strconv.FormatUint(t.ID, 10)
+}
 func compareTweet(p *planner, n, o tweet) {
 	if o.ID == 0 {
-		p.DeltaValue("tweet-t"+strconv.FormatUint(n.ID, 10), "", "tweet")
+		p.DeltaValue(n.key(), "", "tweet")
 	} else {
-		p.Value("tweet-t"+strconv.FormatUint(n.ID, 10), "", "tweet")
+		p.Value(n.key(), "", "tweet")
 	}
-	p.Prefix(p.prefix + "-tweet-t" + strconv.FormatUint(n.ID, 10))
+	p.Prefix(p.prefix + "-" + n.key())
 	if o.ID > 0 {
 		p.Value("pic", "", "tweet-pic")
 		p.Property("pic-img", "url('"+n.UserPhoto+"')", "background-image")
@@ -110,10 +157,10 @@ func (g game) compareTweets(p *planner, o *game) {
 	for i := range g.Tweets {
 		c.Two(g.Tweets[i])
 	}
-	for k, v := range c {
+	for _, v := range c {
 		switch {
 		case !v.Second():
-			p.Remove("tweet-t" + strconv.FormatUint(k, 10))
+			p.Remove(v.A.(tweet).key())
 		case !v.First():
 			compareTweet(p, v.B.(tweet), emptyTweet)
 		default:
@@ -127,7 +174,7 @@ func (e *events) Compare(p *planner, o events) {
 	}
 	if o.hash == e.hash {
 		for i := range e.Current {
-			p.Event(e.Current[i].ID, e.Current[i].Type, e.Current[i].Data)
+			p.Event(e.Current[i].ID, e.Current[i].Type, e.Current[i].Data, e.Current[i].Meta)
 		}
 		return
 	}
@@ -138,7 +185,8 @@ func (e *events) Compare(p *planner, o events) {
 	for i := range e.Current {
 		c.Two(e.Current[i])
 	}
-	for k, v := range c {
+	for _, k := range c.chronological() {
+		v := c[k]
 		if !v.Second() {
 			p.RemoveEvent(k, v.A.(event).Type)
 			continue
@@ -147,11 +195,33 @@ func (e *events) Compare(p *planner, o events) {
 			e.setWindowEvent(p, v.B.(event))
 		}
 		if !v.First() {
-			p.DeltaEvent(k, v.B.(event).Type, v.B.(event).Data)
+			p.DeltaEvent(k, v.B.(event).Type, v.B.(event).Data, v.B.(event).Meta)
 			continue
 		}
-		p.Event(k, v.B.(event).Type, v.B.(event).Data)
+		p.Event(k, v.B.(event).Type, v.B.(event).Data, v.B.(event).Meta)
+	}
+}
+
+// chronological returns the IDs of the events in the order they are sent to the clients,
+// which is by the time of the event, after the clock skew correction, then by ID. The
+// removed events and events without a time are first.
+func (c compare) chronological() []uint64 {
+	var (
+		k = make([]uint64, 0, len(c))
+		t = make(map[uint64]time.Time, len(c))
+	)
+	for i, v := range c {
+		if k = append(k, i); v.Second() {
+			t[i], _ = v.B.(event).when()
+		}
 	}
+	sort.Slice(k, func(i, j int) bool {
+		if a, b := t[k[i]], t[k[j]]; !a.Equal(b) {
+			return a.Before(b)
+		}
+		return k[i] < k[j]
+	})
+	return k
 }
 func (e *events) setWindowEvent(p *planner, w event) {
 	if w.Type <= 0 || e.Window.ID == w.ID {
@@ -162,3 +232,26 @@ func (e *events) setWindowEvent(p *planner, w event) {
 	}
 	e.Window = w
 }
+func (m *Manager) messages(o, n *game, t time.Time) {
+	s := make(map[uint64]struct{}, len(o.Events.Current))
+	for i := range o.Events.Current {
+		s[o.Events.Current[i].ID] = struct{}{}
+	}
+	for i := range n.Events.Current {
+		if _, ok := s[n.Events.Current[i].ID]; ok {
+			continue
+		}
+		v := Message{
+			ID:     n.Events.Current[i].ID,
+			Time:   t,
+			Data:   n.Events.Current[i].Data,
+			Meta:   n.Events.Current[i].Meta,
+			Game:   n.Meta.Name,
+			Type:   n.Events.Current[i].Type,
+			GameID: n.Meta.ID,
+		}
+		for _, f := range m.listen {
+			m.guard("listen", func() { f(v) })
+		}
+	}
+}
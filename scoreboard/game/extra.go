@@ -0,0 +1,61 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"encoding/gob"
+	"encoding/json"
+)
+
+func init() {
+	// The Meta values of teams, services and events are decoded from JSON, so these
+	// are the only types that are not already known to gob, which is used to save
+	// the state and send it to replicas.
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// hashExtra adds the metadata to the hash. The metadata is written as JSON, which sorts
+// the keys, so the same metadata always has the same hash.
+func hashExtra(h *hasher, m map[string]interface{}) {
+	if len(m) == 0 {
+		return
+	}
+	if b, err := json.Marshal(m); err == nil {
+		h.Hash(b)
+	}
+}
+
+// annotate writes the metadata of the element with the supplied ID. New clients are
+// only sent metadata that is set, and changed elements send their metadata to every
+// client, as an empty object if it was removed, so it is cleared.
+func annotate(p *planner, i string, n, o map[string]interface{}, changed bool) {
+	switch {
+	case !changed && len(n) > 0:
+		p.Meta(i, n)
+	case changed && (len(n) > 0 || len(o) > 0):
+		p.DeltaMeta(i, n)
+	}
+}
+
+// extra returns the value as metadata if it is a JSON object, or nil otherwise.
+func extra(v interface{}) map[string]interface{} {
+	if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import "runtime/debug"
+
+// Report adds a function that will be called with the name of the component, the
+// recovered value and the stack of each panic that the Manager recovers from.
+func (m *Manager) Report(f func(string, interface{}, []byte)) {
+	if f != nil {
+		m.reports = append(m.reports, f)
+	}
+}
+
+// recovered logs and reports a panic recovered from the named component. This must be
+// called from the deferred function, so the stack contains the panic.
+func (m *Manager) recovered(n string, v interface{}) {
+	b := debug.Stack()
+	m.log.Error("The %s function recovered from a panic: %s!", n, v)
+	for _, f := range m.reports {
+		f(n, v, b)
+	}
+}
+
+// guard calls the function and recovers from any panic, so a failing Hook, Watch or
+// Listen function does not stop the other functions or the update tick.
+func (m *Manager) guard(n string, f func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			m.recovered(n, v)
+		}
+	}()
+	f()
+}
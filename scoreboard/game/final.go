@@ -0,0 +1,126 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const overMessage = "The game is over, the final standings are locked"
+
+// ErrLocked is returned when a change is made to a Game that is over, as its final
+// standings are locked until the Game is unlocked.
+var ErrLocked = errors.New("the game is over and its final standings are locked")
+
+// Ending is a Game that is over and locked, with the time that its game clock ended.
+type Ending struct {
+	End  time.Time `json:"end"`
+	Game uint64    `json:"game"`
+}
+type finale struct {
+	unlocked map[uint64]time.Time
+	enabled  bool
+	freeze   bool
+}
+
+// Finale locks the final standings of each Game once its game clock ends. The updates of
+// the Source after the end are not shown, a GameOver Change is sent and score adjustments
+// and clock changes are refused with ErrLocked until the Game is unlocked. If freeze is
+// true, the display of the Game is also frozen at the end time, so the final standings
+// can be revealed. Games without a clock end time are never locked.
+func (m *Manager) Finale(enabled, freeze bool) {
+	m.lock.Lock()
+	m.finale.enabled, m.finale.freeze = enabled, freeze
+	m.lock.Unlock()
+}
+
+// Locked returns true if the game clock of the Game with the supplied ID has ended and
+// the Game has not been unlocked since.
+func (m *Manager) Locked(i uint64) bool {
+	m.lock.Lock()
+	e := m.finale.enabled
+	m.lock.Unlock()
+	if !e || i == 0 {
+		return false
+	}
+	c, ok := m.Countdown(i)
+	if !ok || !c.Ended {
+		return false
+	}
+	m.lock.Lock()
+	u, k := m.finale.unlocked[i]
+	m.lock.Unlock()
+	return !k || !u.Equal(c.End)
+}
+
+// Over returns the Games that are over and locked.
+func (m *Manager) Over() []Ending {
+	m.lock.Lock()
+	l := make([]uint64, 0, len(m.timers))
+	for k := range m.timers {
+		l = append(l, k)
+	}
+	m.lock.Unlock()
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	o := make([]Ending, 0, len(l))
+	for _, i := range l {
+		if !m.Locked(i) {
+			continue
+		}
+		if c, ok := m.Countdown(i); ok {
+			o = append(o, Ending{Game: i, End: c.End})
+		}
+	}
+	return o
+}
+
+// Unlock shows the updates of the Source again and allows changes to the Game with the
+// supplied ID, which is locked again if its game clock is moved and ends again.
+func (m *Manager) Unlock(i uint64) error {
+	if !m.Locked(i) {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " is not locked")
+	}
+	c, _ := m.Countdown(i)
+	m.lock.Lock()
+	if m.finale.unlocked == nil {
+		m.finale.unlocked = make(map[uint64]time.Time)
+	}
+	m.finale.unlocked[i] = c.End
+	m.lock.Unlock()
+	m.log.Info("Unlocked the final standings of Game %d.", i)
+	return nil
+}
+
+// conclude returns the GameOver Change of the Game when its game clock has ended and the
+// Game is locked, and freezes its display at the end time if enabled. A Freeze that was
+// already set is kept.
+func (s *subscription) conclude(m *Manager, g *meta, c clock, n time.Time) []Change {
+	if !m.Locked(s.ID) {
+		return nil
+	}
+	m.lock.Lock()
+	f := m.finale.freeze
+	m.lock.Unlock()
+	m.log.Info("The clock of Game %d has ended, its final standings are locked.", s.ID)
+	if _, ok := m.frozen(s.ID); f && !ok {
+		m.Freeze(s.ID, c.End)
+	}
+	return []Change{{Time: n, Kind: GameOver, Game: g.Name, GameID: s.ID, Text: overMessage}}
+}
@@ -0,0 +1,146 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Leader sets the function that returns true while this Manager is the leader of a
+// cluster of Managers that share a Store set with Share. Only the leader polls the
+// Source and calls the Hook, Watch and Listen functions. The other Managers load the
+// Games from the Store on every update tick and send the changes to their clients.
+// The leader keeps every active Game subscribed, so the other Managers can show any
+// active Game.
+func (m *Manager) Leader(f func() bool) {
+	m.leader = f
+}
+func (m *Manager) leading() bool {
+	return m.leader == nil || m.leader()
+}
+
+// follow updates the subscriptions from the state saved by the leader, or sent by the
+// primary of a replica. The clocks are still counted down by each Manager, so the
+// clients see the same countdown as the clients of the leader.
+func (m *Manager) follow(x context.Context) {
+	n := time.Now()
+	for _, s := range m.subs {
+		s.accept()
+		s.tick(x, m, n)
+	}
+	c, ok := m.pull(n)
+	if !ok {
+		return
+	}
+	if !sameMeta(m.Games, c.Games) {
+		atomic.AddUint64(&m.version, 1)
+	}
+	m.synced, m.Games = c.Time, c.Games
+	m.names()
+	atomic.StoreInt64(&m.stats.updated, n.UnixNano())
+	if m.store == nil {
+		// Replicas are read-only, so the clocks of the primary are used. The nodes of a
+		// cluster receive the admin changes of the leader instead.
+		m.lock.Lock()
+		m.clocks = make(map[uint64]*clock, len(c.Clocks))
+		for k, v := range c.Clocks {
+			v := v
+			m.clocks[k] = &v
+		}
+		m.lock.Unlock()
+	}
+	for i := range c.Subs {
+		select {
+		case <-x.Done():
+			return
+		default:
+		}
+		s, ok := m.subs[c.Subs[i].ID]
+		if !ok {
+			m.log.Debug("Adding Game %d from the shared state.", c.Subs[i].ID)
+			s = m.restore(c.Subs[i])
+			m.snapshot(&s.last, n)
+			continue
+		}
+		s.apply(x, m, c.Subs[i], n)
+	}
+	if len(c.Subs) == 0 {
+		m.log.Trace("No Games were changed in the state saved at %s.", c.Time.Format(time.RFC3339))
+		return
+	}
+	m.log.Debug("Loaded %d Games from the state saved at %s.", len(c.Subs), c.Time.Format(time.RFC3339))
+}
+
+// pull returns the state sent by the primary since the last update or, if there is
+// none, the state saved by the leader if it was changed since the last update.
+func (m *Manager) pull(n time.Time) (checkpoint, bool) {
+	m.lock.Lock()
+	v := m.inbound
+	m.inbound = nil
+	if m.lock.Unlock(); v != nil {
+		return *v, true
+	}
+	if m.store == nil {
+		return checkpoint{}, false
+	}
+	b, err := m.store.Load()
+	if err != nil {
+		m.log.Error(`Unable to load state from "%s": %s!`, m.store.String(), err.Error())
+		m.Status("cluster", n)
+		return checkpoint{}, false
+	}
+	if m.Status("cluster", time.Time{}); len(b) == 0 {
+		return checkpoint{}, false
+	}
+	c, err := decode(b)
+	if err != nil {
+		m.log.Error(`State "%s" could not be read: %s!`, m.store.String(), err.Error())
+		return checkpoint{}, false
+	}
+	if !c.Time.After(m.synced) {
+		m.log.Trace("State was not changed by the leader, skipping update.")
+		return checkpoint{}, false
+	}
+	return c, true
+}
+
+// apply sends the changes between the last Game and the Game saved by the leader to
+// the clients. The ticker of the saved Game already contains the leader feed, so
+// no Changes are created.
+func (s *subscription) apply(x context.Context, m *Manager, v saved, n time.Time) {
+	g := v.Last
+	g.order = m.order
+	g.digest()
+	if standings(&s.last, &g) {
+		m.snapshot(&g, n)
+	}
+	var (
+		u, c    []update
+		w, o, r = s.hold(m, &g, n)
+	)
+	if o != &s.last {
+		c = r
+	}
+	s.cache, u = w.Delta(m.assets, o)
+	s.last, s.feed, s.fresh = g, v.Feed, n
+	s.send(x, m, append(u, c...))
+	if s.lag != nil && s.lag.behind == nil {
+		s.lag.mirror(x, m, w, c)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const frozenMessage = "The scoreboard is frozen!"
+
+// Hold is the status of a scheduled or active Freeze. A Game of zero applies to
+// all Games.
+type Hold struct {
+	At     time.Time `json:"at"`
+	Reveal time.Time `json:"reveal"`
+	Game   uint64    `json:"game"`
+	Frozen bool      `json:"frozen"`
+}
+type freeze struct {
+	at, thaw time.Time
+	reveal   time.Duration
+}
+
+// Freeze will stop updating the display of the Game with the supplied ID at the supplied
+// time while the Game continues to be tracked and recorded as normal. An ID of zero
+// freezes all Games and a zero time freezes the display during the next update.
+func (m *Manager) Freeze(i uint64, t time.Time) {
+	if t.IsZero() {
+		t = time.Now().UTC()
+	}
+	m.lock.Lock()
+	if m.freezes == nil {
+		m.freezes = make(map[uint64]*freeze)
+	}
+	if i == 0 {
+		m.freezes = make(map[uint64]*freeze, 1)
+	}
+	m.freezes[i] = &freeze{at: t}
+	m.lock.Unlock()
+	if i == 0 {
+		m.log.Info("Freezing the display of all Games at %s.", t.Format(time.RFC3339))
+	} else {
+		m.log.Info("Freezing the display of Game %d at %s.", i, t.Format(time.RFC3339))
+	}
+}
+
+// Unfreeze will reveal the live state of the frozen Game with the supplied ID, one team
+// at a time from the last place team to the first place team, over the supplied duration.
+// An ID of zero reveals all frozen Games.
+func (m *Manager) Unfreeze(i uint64, d time.Duration) error {
+	if d < 0 {
+		return errors.New("reveal duration cannot be less than zero")
+	}
+	n := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if i == 0 {
+		if len(m.freezes) == 0 {
+			return errors.New("no Games are frozen")
+		}
+		for _, f := range m.freezes {
+			if f.thaw.IsZero() {
+				f.thaw, f.reveal = n, d
+			}
+		}
+		m.log.Info("Revealing all frozen Games over %s.", d.String())
+		return nil
+	}
+	f, ok := m.freezes[i]
+	if !ok {
+		if f, ok = m.freezes[0]; !ok {
+			return errors.New("game " + strconv.FormatUint(i, 10) + " is not frozen")
+		}
+		f = &freeze{at: f.at}
+		m.freezes[i] = f
+	}
+	if !f.thaw.IsZero() {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " is already being revealed")
+	}
+	f.thaw, f.reveal = n, d
+	m.log.Info("Revealing Game %d over %s.", i, d.String())
+	return nil
+}
+
+// Frozen returns the status of all scheduled and active Freezes.
+func (m *Manager) Frozen() []Hold {
+	n := time.Now()
+	m.lock.Lock()
+	o := make([]Hold, 0, len(m.freezes))
+	for k, f := range m.freezes {
+		if !f.thaw.IsZero() && !n.Before(f.thaw.Add(f.reveal)) {
+			continue
+		}
+		o = append(o, Hold{Game: k, At: f.at, Reveal: f.thaw, Frozen: !n.Before(f.at)})
+	}
+	m.lock.Unlock()
+	sort.Slice(o, func(i, j int) bool { return o[i].Game < o[j].Game })
+	return o
+}
+
+// Displayed returns the standings of the subscribed Game as they are shown to the
+// clients. While the display of the Game is frozen or being revealed, these are the
+// standings at the time of the Freeze, otherwise these are the latest standings. If
+// the Game is not subscribed, this function returns false.
+func (m *Manager) Displayed(i uint64) (Snapshot, bool) {
+	m.lock.Lock()
+	s, ok := m.held[i]
+	if !ok {
+		s, ok = m.latest[i]
+	}
+	m.lock.Unlock()
+	return s, ok
+}
+func (m *Manager) frozen(i uint64) (freeze, bool) {
+	m.lock.Lock()
+	f, ok := m.freezes[i]
+	if !ok {
+		f, ok = m.freezes[0]
+	}
+	var v freeze
+	if ok {
+		v = *f
+	}
+	m.lock.Unlock()
+	return v, ok
+}
+
+// holding returns true if the display of the Game is frozen, being revealed or is
+// waiting to be frozen, which requires an update even if the Game was not modified.
+func (s *subscription) holding(m *Manager) bool {
+	if s.shown != nil {
+		return true
+	}
+	f, ok := m.frozen(s.ID)
+	return ok && f.thaw.IsZero()
+}
+
+// hold returns the Game that should be displayed to clients, the Game that was last
+// displayed to clients and any reveal updates. The live Game is returned when the
+// Game is not frozen.
+func (s *subscription) hold(m *Manager, g *game, n time.Time) (*game, *game, []update) {
+	f, ok := m.frozen(s.ID)
+	if s.shown == nil && (!ok || n.Before(f.at) || !f.thaw.IsZero()) {
+		return g, &s.last, nil
+	}
+	// Prefix the team logos before copying any teams from the live Game, so
+	// the display Game is not prefixed twice.
+	if g.hash == 0 {
+		g.logos(m.assets)
+		g.digest()
+	}
+	if s.shown == nil {
+		v := s.last
+		s.base, s.shown, s.revealed = v, &v, 0
+		m.lock.Lock()
+		if m.held == nil {
+			m.held = make(map[uint64]Snapshot)
+		}
+		m.held[s.ID] = v.snapshot(f.at, m.assets)
+		m.lock.Unlock()
+		m.log.Info("Froze the display of Game %d.", s.ID)
+	}
+	o := s.shown
+	if !ok || (!f.thaw.IsZero() && !n.Before(f.thaw.Add(f.reveal))) {
+		s.shown = nil
+		m.lock.Lock()
+		delete(m.held, s.ID)
+		m.lock.Unlock()
+		m.log.Info("Revealed the final standings of Game %d.", s.ID)
+		return g, o, s.reveal(g, len(g.Teams))
+	}
+	// The Tweets are from the live Game, so the cached hashes of the frozen Game are
+	// cleared, otherwise the Tweets are compared by position with the last ones shown.
+	v := s.base
+	v.Tweets, v.Message, v.hash, v.tweets = g.Tweets, frozenMessage, 0, 0
+	var u []update
+	if !f.thaw.IsZero() {
+		k := len(g.Teams)
+		if f.reveal > 0 {
+			k = int((int64(n.Sub(f.thaw))*int64(len(g.Teams)) + int64(f.reveal) - 1) / int64(f.reveal))
+		}
+		if k > len(g.Teams) {
+			k = len(g.Teams)
+		}
+		u, v.Message = s.reveal(g, k), "Revealing the final standings!"
+		r := make(map[uint64]int, len(s.base.Teams))
+		for i := range s.base.Teams {
+			r[s.base.Teams[i].ID] = i
+		}
+		v.Teams = make([]team, 0, len(g.Teams))
+		for i := range g.Teams {
+			if x, ok := r[g.Teams[i].ID]; ok && !s.shows(g.Teams[i].ID) {
+				v.Teams = append(v.Teams, s.base.Teams[x])
+				continue
+			}
+			v.Teams = append(v.Teams, g.Teams[i])
+		}
+	}
+	v.digest()
+	s.shown = &v
+	return &v, o, u
+}
+func (s *subscription) shows(i uint64) bool {
+	for x := 0; x < s.revealed && x < len(s.order); x++ {
+		if s.order[x] == i {
+			return true
+		}
+	}
+	return false
+}
+
+// reveal marks the first k teams, ordered from the last place team in the live Game,
+// as revealed and returns highlight updates for the newly revealed teams.
+func (s *subscription) reveal(g *game, k int) []update {
+	if s.revealed == 0 {
+		r := ranks(g)
+		s.order = make([]uint64, len(g.Teams))
+		for i := range g.Teams {
+			s.order[i] = g.Teams[i].ID
+		}
+		sort.SliceStable(s.order, func(i, j int) bool { return r[s.order[i]] > r[s.order[j]] })
+	}
+	if k > len(s.order) {
+		k = len(s.order)
+	}
+	u := make([]update, 0, k-s.revealed)
+	for ; s.revealed < k; s.revealed++ {
+		u = append(u, update{
+			ID:    "reveal-t" + strconv.FormatUint(s.order[s.revealed], 10),
+			Data:  map[string]string{"kind": "reveal", "team": strconv.FormatUint(s.order[s.revealed], 10), "highlight": "true"},
+			Event: true,
+			Value: strconv.Itoa(feedEvent),
+		})
+	}
+	return u
+}
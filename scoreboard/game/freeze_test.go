@@ -0,0 +1,69 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PurpleSec/logx"
+)
+
+func TestFreezeTweets(t *testing.T) {
+	m := &Manager{log: logx.NOP, assets: "https://scorebot.example.com"}
+	// Each Game from the Source has its own teams, as Delta adds the logo prefix.
+	teams := func() []team {
+		return []team{
+			{ID: 1, Name: "Alpha", Logo: "alpha.png", Score: score{Total: 100}},
+			{ID: 2, Name: "Bravo", Logo: "default.png", Score: score{Total: 50}},
+		}
+	}
+	g := game{Meta: meta{ID: 1, Name: "Freeze"}, Teams: teams(), Tweets: []tweet{{ID: 1, User: "pvj", Text: "First"}}}
+	s := &subscription{ID: 1, last: g}
+	s.cache, _ = s.last.Delta(m.assets, nil)
+	m.snapshot(&s.last, time.Now().UTC())
+	m.Freeze(1, time.Time{})
+	// Each tick adds a Tweet, so the Tweets of the frozen Game change while the
+	// standings are held.
+	for i := 2; i <= 4; i++ {
+		n := g
+		n.Teams = teams()
+		n.Teams[0].Score.Total += int64(i * 10)
+		n.Tweets = append(append([]tweet(nil), s.last.Tweets...), tweet{ID: uint64(i), User: "pvj", Text: "Next"})
+		// The live standings are taken before the Game is shown, the same as an update.
+		m.snapshot(&n, time.Now().UTC())
+		v, o, _ := s.hold(m, &n, time.Now().UTC().Add(time.Second))
+		if v == &n {
+			t.Fatalf("tick %d: expected the held Game, got the live Game", i)
+		}
+		s.cache, _ = v.Delta(m.assets, o)
+		if len(v.Tweets) != i {
+			t.Fatalf("tick %d: held Game has %d Tweets, expected %d", i, len(v.Tweets), i)
+		}
+		if v.Teams[0].Score.Total != 100 {
+			t.Fatalf("tick %d: held score is %d, expected 100", i, v.Teams[0].Score.Total)
+		}
+		s.last = n
+	}
+	h, _ := m.Displayed(1)
+	l, _ := m.Standings(1)
+	for i := range h.Teams {
+		if h.Teams[i].Logo != l.Teams[i].Logo {
+			t.Fatalf(`held logo of team %d is "%s", expected "%s"`, h.Teams[i].ID, h.Teams[i].Logo, l.Teams[i].Logo)
+		}
+	}
+}
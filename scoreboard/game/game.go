@@ -30,6 +30,7 @@ const (
 	king     mode = 0x2
 	rush     mode = 0x3
 	defend   mode = 0x4
+	jeopardy mode = 0x5
 
 	stopped   status = 0x0
 	running   status = 0x1
@@ -62,15 +63,18 @@ type meta struct {
 	Status status `json:"status"`
 }
 type game struct {
-	Credit  string
-	Message string
-	Teams   []team
-	Tweets  []tweet
-	Events  events
-	Meta    meta
-	hash    uint64
-	total   uint64
-	tweets  uint64
+	Credit     string
+	Message    string
+	Teams      []team
+	Tweets     []tweet
+	Challenges []Challenge
+	Hills      []hill
+	Events     events
+	Meta       meta
+	order      *ordering
+	hash       uint64
+	total      uint64
+	tweets     uint64
 }
 
 func (g game) Len() int {
@@ -94,6 +98,8 @@ func (m mode) String() string {
 		return "Rush"
 	case defend:
 		return "Server Defence"
+	case jeopardy:
+		return "Jeopardy"
 	}
 	return "Unknown"
 }
@@ -170,6 +176,11 @@ func (g *game) UnmarshalJSON(b []byte) error {
 			return err
 		}
 	}
+	if x, ok := m["hills"]; ok {
+		if err := json.Unmarshal(x, &g.Hills); err != nil {
+			return err
+		}
+	}
 	if x, ok := m["events"]; ok {
 		if err := json.Unmarshal(x, &g.Events.Current); err != nil {
 			return err
@@ -238,25 +249,31 @@ func (g *game) Delta(s string, old *game) ([]update, []update) {
 	p := new(planner)
 	sort.Sort(g)
 	if g.hash == 0 {
-		h := hashers.Get().(*hasher)
-		h.Hash(g.Message)
-		g.hash = h.Segment()
-		g.Meta.Hash(h)
-		for i := range g.Teams {
-			if g.Teams[i].Logo == "default.png" || len(g.Teams[i].Logo) == 0 {
-				g.Teams[i].Logo = "/image/team.png"
-			} else {
-				g.Teams[i].Logo = s + g.Teams[i].Logo
-			}
-			g.Teams[i].Hash(h)
-		}
-		g.total = h.Sum64()
-		h.Reset()
-		g.Events.Hash(h)
-		h.Reset()
-		g.hashTweets(h)
-		hashers.Put(h)
+		g.logos(s)
+		g.digest()
 	}
+	g.place()
+	g.trend(old)
 	g.Compare(p, old)
 	return p.Create, p.Delta
 }
+func (g *game) logos(s string) {
+	for i := range g.Teams {
+		g.Teams[i].Logo = g.Teams[i].logo(s)
+	}
+}
+func (g *game) digest() {
+	h := hashers.Get().(*hasher)
+	h.Hash(g.Message)
+	g.hash = h.Segment()
+	g.Meta.Hash(h)
+	for i := range g.Teams {
+		g.Teams[i].Hash(h)
+	}
+	g.total = h.Sum64()
+	h.Reset()
+	g.Events.Hash(h)
+	h.Reset()
+	g.hashTweets(h)
+	hashers.Put(h)
+}
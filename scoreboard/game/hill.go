@@ -0,0 +1,117 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"sort"
+	"time"
+)
+
+// Hills is the list of hills in a king of the hill Game and the team that owns each of
+// them, sorted by name.
+type Hills struct {
+	Time   time.Time `json:"time"`
+	Game   string    `json:"game"`
+	Hills  []Hill    `json:"hills"`
+	GameID uint64    `json:"game_id"`
+}
+
+// Hill is a single hill and the Team that owns it. Since is the time that the owner was
+// first seen holding the hill by the Manager and Duration is the number of seconds since
+// then. Hills that are not owned have an empty Team and a zero TeamID.
+type Hill struct {
+	Since    time.Time `json:"since"`
+	Name     string    `json:"name"`
+	Team     string    `json:"team,omitempty"`
+	Color    string    `json:"color,omitempty"`
+	ID       uint64    `json:"id"`
+	TeamID   uint64    `json:"team_id,omitempty"`
+	Duration int64     `json:"duration"`
+}
+type hill struct {
+	Name  string `json:"name"`
+	ID    uint64 `json:"id"`
+	Owner uint64 `json:"owner"`
+}
+type reign struct {
+	since time.Time
+	owner uint64
+}
+
+// Hills returns the hills of the subscribed Game with the supplied ID. If the Game is
+// not subscribed, this function returns false.
+func (m *Manager) Hills(i uint64) (Hills, bool) {
+	m.lock.Lock()
+	v, ok := m.hills[i]
+	m.lock.Unlock()
+	if !ok {
+		return v, false
+	}
+	n, h := time.Now().UTC(), make([]Hill, len(v.Hills))
+	for x := range v.Hills {
+		if h[x] = v.Hills[x]; h[x].TeamID > 0 {
+			h[x].Duration = int64(n.Sub(h[x].Since) / time.Second)
+		}
+	}
+	v.Hills = h
+	return v, true
+}
+func (h hill) check(p *problems, n string) {
+	if h.ID == 0 {
+		p.add(n, " is missing an id")
+	}
+	length(p, n+" name", h.Name, maxName)
+}
+
+// crown saves the owners of the hills in the last known state of the Game. Hills that
+// were already owned when the Game was subscribed use the time of the first sample.
+func (s *subscription) crown(m *Manager, n time.Time) {
+	var (
+		k = make(map[uint64]reign, len(s.last.Hills))
+		v = Hills{Time: n, Game: s.last.Meta.Name, GameID: s.ID, Hills: make([]Hill, len(s.last.Hills))}
+		t = make(map[uint64]*team, len(s.last.Teams))
+	)
+	for i := range s.last.Teams {
+		t[s.last.Teams[i].ID] = &s.last.Teams[i]
+	}
+	for i := range s.last.Hills {
+		h := &s.last.Hills[i]
+		r, ok := s.reigns[h.ID]
+		if !ok || r.owner != h.Owner {
+			r = reign{since: n, owner: h.Owner}
+		}
+		k[h.ID] = r
+		v.Hills[i] = Hill{ID: h.ID, Name: sanitize(h.Name, 0), Since: r.since}
+		if h.Owner == 0 {
+			continue
+		}
+		v.Hills[i].TeamID = h.Owner
+		if e, ok := t[h.Owner]; ok && len(e.Name) > 0 {
+			v.Hills[i].Team, v.Hills[i].Color = e.Name, e.Color
+		} else {
+			v.Hills[i].Team = beaconName(h.Owner, nil)
+		}
+	}
+	sort.SliceStable(v.Hills, func(i, j int) bool { return v.Hills[i].Name < v.Hills[j].Name })
+	s.reigns = k
+	m.lock.Lock()
+	if m.hills == nil {
+		m.hills = make(map[uint64]Hills)
+	}
+	m.hills[s.ID] = v
+	m.lock.Unlock()
+}
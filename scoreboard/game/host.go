@@ -48,11 +48,17 @@ type host struct {
 }
 type protocol uint8
 type service struct {
-	ID       uint64   `json:"id"`
-	Port     uint16   `json:"port"`
-	State    state    `json:"status"`
-	Bonus    bool     `json:"bool"`
-	Protocol protocol `json:"protocol"`
+	Name     string                 `json:"name"`
+	SLA      float64                `json:"sla"`
+	ID       uint64                 `json:"id"`
+	Port     uint16                 `json:"port"`
+	State    state                  `json:"status"`
+	Bonus    bool                   `json:"bool"`
+	Protocol protocol               `json:"protocol"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+	// Lost is the flags captured from the service, which is only set by Sources that
+	// report the flags of each service.
+	Lost uint32 `json:"lost,omitempty"`
 
 	hash uint64
 }
@@ -116,6 +122,8 @@ func (s *service) Hash(h *hasher) uint64 {
 		h.Hash(s.State)
 		h.Hash(s.Bonus)
 		h.Hash(s.Protocol)
+		h.Hash(s.Name)
+		hashExtra(h, s.Meta)
 		s.hash = h.Segment()
 	}
 	return s.hash
@@ -174,11 +182,11 @@ func (s *state) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	switch strings.ToLower(v) {
-	case "red", "r", "fail":
+	case "red", "r", "fail", "down", "offline":
 		*s = red
-	case "yellow", "y", "issue":
+	case "yellow", "y", "issue", "mangled", "faulty":
 		*s = yellow
-	case "green", "g", "good", "ok":
+	case "green", "g", "good", "ok", "up":
 		*s = green
 	default:
 		*s = red
@@ -201,6 +209,7 @@ func (s service) Compare(p *planner, o service) {
 			p.Property("", "-bonus", "class")
 		}
 		p.Property("", s.State.String(), "background-color")
+		annotate(p, "", s.Meta, o.Meta, false)
 		p.rollbackPrefix()
 		return
 	}
@@ -212,6 +221,7 @@ func (s service) Compare(p *planner, o service) {
 		p.DeltaProperty("", "-bonus", "class")
 	}
 	p.DeltaProperty("", s.State.String(), "background-color")
+	annotate(p, "", s.Meta, o.Meta, true)
 	p.rollbackPrefix()
 }
 func (p *protocol) UnmarshalJSON(b []byte) error {
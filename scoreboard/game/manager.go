@@ -20,66 +20,179 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
 	"net"
 	"net/http"
-	"net/url"
-	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/PurpleSec/logx"
-	"github.com/PurpleSec/parseurl"
 	"github.com/dghubble/go-twitter/twitter"
 	"github.com/gorilla/websocket"
 )
 
 var errMissingGame = errors.New("game ID is missing from JSON data")
 
-type hello uint64
 type tweet struct {
 	User      string
 	Text      string
 	UserName  string
 	UserPhoto string
+	Channel   string
 	Images    []string
 	ID        uint64
 	expire    int64
 }
 type stream struct {
 	*websocket.Conn
-	ok bool
+	display *Display
+	seq     *uint64
+	slice   slice
+	version int
+	ok      bool
+	staff   bool
 }
 type tweets struct {
 	new     chan *twitter.Tweet
+	route   func(*twitter.Tweet) string
 	current []tweet
 	timeout time.Duration
+	size    int
 }
 
 // Manager is a struct that contains for a map of subs and controls the connections between Scorebot
 // and the Scoreboard clients.
 type Manager struct {
-	log     logx.Log
-	active  map[string]uint64
-	tick    *time.Ticker
-	subs    map[uint64]*subscription
-	client  *http.Client
-	twitter *tweets
-	url     url.URL
-	assets  string
-	Games   []meta
-	timeout time.Duration
-	running uint32
+	log       logx.Log
+	active    map[string]uint64
+	tick      *time.Ticker
+	subs      map[uint64]*subscription
+	client    *http.Client
+	source    adapter
+	origin    origin
+	cache     conditional
+	breaker   breaker
+	twitter   *tweets
+	hooks     []func(Change)
+	watch     []func(Snapshot)
+	monitor   []func(Checks)
+	listen    []func(Message)
+	traces    []func(Span)
+	reports   []func(string, interface{}, []byte)
+	avatar    func(uint64, string, string) (string, bool)
+	announce  func(Change, bool) (string, bool)
+	locate    func(uint64, string) (float64, float64, bool)
+	leader    func() bool
+	replays   map[uint64]*replay
+	record    Recording
+	tape      *tape
+	freezes   map[uint64]*freeze
+	pending   []uint64
+	latest    map[uint64]Snapshot
+	held      map[uint64]Snapshot
+	matrices  map[uint64]Matrix
+	boards    map[uint64]Board
+	implants  map[uint64]Implants
+	charts    map[uint64]Chart
+	hills     map[uint64]Hills
+	divisions map[string]string
+	entrants  map[string]Entrant
+	order     *ordering
+	stats     *counters
+	aliases   map[uint64]string
+	taken     map[string]struct{}
+	adjusts   []Adjustment
+	notices   []notice
+	clocks    map[uint64]*clock
+	failing   map[string]time.Time
+	sources   map[string]string
+	timers    map[uint64]clock
+	pace      pace
+	finale    finale
+	watchdog  watchdog
+	drift     drift
+	chaos     Chaos
+	burst     burst
+	lanes     map[string]Lane
+	root      context.Context
+	gate      chan struct{}
+	ready     chan struct{}
+	warnings  []time.Duration
+	effects   map[Kind]Effect
+	saved     time.Time
+	synced    time.Time
+	assets    string
+	state     string
+	store     Store
+	mirrors   *replicas
+	inbound   *checkpoint
+	screens   map[uint64]*Display
+	commands  []order
+	retracted map[uint64]struct{}
+	shown     []Tweet
+	posts     []Announcement
+	Games     []meta
+	timeout   time.Duration
+	every     time.Duration
+	delay     time.Duration
+	milestone int64
+	tweetMax  int
+	feedMax   int
+	teamMax   int
+	lock      sync.Mutex
+	flight    sync.WaitGroup
+	anon      anon
+	version   uint64
+	running   uint32
+	workers   uint32
 }
 type subscription struct {
-	new     chan *websocket.Conn
-	cache   []update
-	clients []*stream
-	last    game
-	ID      uint64
-	stale   uint32
+	seq      uint64
+	new      chan *stream
+	cache    []update
+	clients  []*stream
+	feed     []event
+	uptime   map[string]*uptime
+	slices   map[slice]roster
+	paced    []time.Time
+	held     map[Kind]int
+	pulled   chan pull
+	due      time.Time
+	planted  map[uint64]time.Time
+	nodes    map[uint64]Node
+	reigns   map[uint64]reign
+	notices  []notice
+	order    []uint64
+	shown    *game
+	lag      *subscription
+	health   []update
+	sources  []update
+	status   string
+	sourced  string
+	echo     string
+	echoed   string
+	dropped  map[string]struct{}
+	failed   time.Time
+	fresh    time.Time
+	heard    time.Time
+	revived  time.Time
+	behind   *replay
+	clock    clock
+	base     game
+	last     game
+	upstream []event
+	ID       uint64
+	left     int64
+	stale    uint32
+	revealed int
+	fails    uint32
+	resync   bool
+	fetched  bool
+	alerted  bool
+	timed    bool
+	busy     bool
 }
 
 func (m *Manager) close() {
@@ -88,12 +201,30 @@ func (m *Manager) close() {
 			s.clients[i].Close()
 			s.clients[i] = nil
 		}
-		close(s.new)
+		if close(s.new); s.lag != nil {
+			for i := range s.lag.clients {
+				s.lag.clients[i].Close()
+				s.lag.clients[i] = nil
+			}
+			close(s.lag.new)
+		}
 		delete(m.subs, n)
 	}
 	if m.twitter != nil {
 		m.twitter.current = nil
 	}
+	if m.mirrors != nil {
+		for i := range m.mirrors.clients {
+			m.mirrors.clients[i].Close()
+		}
+		m.mirrors.clients = nil
+	}
+	if m.tape != nil {
+		m.tape.close()
+	}
+	m.lock.Lock()
+	m.screens, m.commands = nil, nil
+	m.lock.Unlock()
 	m.tick.Stop()
 }
 func (t tweet) Sum() uint64 {
@@ -128,13 +259,31 @@ func (m *Manager) Game(s string) uint64 {
 	return m.active[strings.ToLower(cleanSlugString(s))]
 }
 
-// New attempts to add the supplied web client to the Subscription swarm.
-func (m *Manager) New(n *websocket.Conn) {
-	defer func(l logx.Log) {
+// Version returns a number that changes every time the list of Games or the status of
+// any Game changes, which can be used to know when anything made from the list of
+// Games is out of date.
+func (m *Manager) Version() uint64 {
+	return atomic.LoadUint64(&m.version)
+}
+
+// New attempts to add the supplied web client to the Subscription swarm. The request,
+// if not nil, is the request that opened the WebSocket and is used to describe the
+// client in the list of Displays.
+func (m *Manager) New(n *websocket.Conn, r *http.Request) {
+	m.join(n, r, false)
+}
+
+// Staff is similar to the New function, but the client is also sent the status of each
+// data source, such as the Twitter stream and the scoring engine, whenever it changes.
+func (m *Manager) Staff(n *websocket.Conn, r *http.Request) {
+	m.join(n, r, true)
+}
+func (m *Manager) join(n *websocket.Conn, r *http.Request, staff bool) {
+	defer func() {
 		if err := recover(); err != nil {
-			l.Error("Collection newclient function recovered from a panic: %s!", err)
+			m.recovered("client", err)
 		}
-	}(m.log)
+	}()
 	m.log.Debug(`Received a connection from "%s", listening for Hello..`, n.RemoteAddr().String())
 	var h hello
 	if err := n.ReadJSON(&h); err != nil {
@@ -142,101 +291,148 @@ func (m *Manager) New(n *websocket.Conn) {
 		n.Close()
 		return
 	}
-	m.log.Debug(`Received Hello with requested Game ID %d from "%s".`, h, n.RemoteAddr().String())
-	s, ok := m.subs[uint64(h)]
+	m.log.Debug(`Received Hello with requested Game ID %d from "%s".`, h.Game, n.RemoteAddr().String())
+	s, ok := m.subs[h.Game]
 	if !ok || s == nil {
-		m.log.Debug(`Checking Game ID %d, requested by "%s"..`, h, n.RemoteAddr().String())
-		var g game
-		if err := m.getJSON(context.Background(), "api/scoreboard/"+strconv.FormatUint(uint64(h), 10)+"/", &g); err != nil {
-			m.log.Error("Error retrieving data for Game ID %d: %s!", h, err.Error())
+		m.log.Debug(`Checking Game ID %d, requested by "%s"..`, h.Game, n.RemoteAddr().String())
+		if s = m.subscribe(context.Background(), h.Game); s == nil {
 			n.Close()
 			return
 		}
-		if len(g.Meta.Name) == 0 && len(g.Teams) == 0 {
-			m.log.Error("Game ID %d is empty, ignoring!", h)
-			n.Close()
-			return
-		}
-		g.Meta.ID = uint64(h)
-		for i := range m.Games {
-			if m.Games[i].ID == g.Meta.ID {
-				g.Meta.End = m.Games[i].End
-				g.Meta.Start = m.Games[i].Start
-				g.Meta.Status = m.Games[i].Status
-				break
-			}
-		}
-		s = &subscription{
-			ID:      g.Meta.ID,
-			new:     make(chan *websocket.Conn, 128),
-			last:    g,
-			clients: make([]*stream, 0, 1),
-		}
-		if m.twitter != nil {
-			s.last.Tweets = m.twitter.current
-		}
-		s.cache, _ = s.last.Delta(m.assets, nil)
-		m.subs[g.Meta.ID] = s
 	}
 	atomic.StoreUint32(&s.stale, 0)
-	n.WriteJSON(s.cache)
-	s.new <- n
+	// The sequence number is read before the board, so a client that is sent a board
+	// older than the number misses the next message and loads the board again, instead
+	// of showing the events of a message twice.
+	q, v := atomic.LoadUint64(&s.seq), h.protocol(n)
+	c := &stream{Conn: n, ok: true, staff: staff, seq: &q, slice: h.Slice, version: v, display: m.greet(n, r, h.Game, v, staff, false)}
+	c.send(c.board(s.cache))
+	if v := m.countdown(h.Game); v != nil {
+		c.send(v)
+	}
+	if v := s.health; v != nil {
+		c.send(v)
+	}
+	if v := s.sources; staff && v != nil {
+		c.send(v)
+	}
+	if v := m.announcements(); len(v) > 0 {
+		c.send(v)
+	}
+	c.seq = &s.seq
+	go c.listen()
+	s.new <- c
 }
 
 // Start will start the Manager content thread. This function takes a context that will be used
 // to stop and cancel all running processes.
 func (m *Manager) Start(x context.Context) {
+	m.root = x
 	for {
 		select {
 		case <-x.Done():
+			// The update context is cancelled with x, so the update running now returns
+			// soon and is waited for, so its changes are in the saved state.
+			m.flight.Wait()
+			m.persist(true)
 			m.close()
 			return
 		case <-m.tick.C:
 			if atomic.LoadUint32(&m.running) == 0 {
+				m.flight.Add(1)
 				go m.startUpdate(x)
 			}
+			m.adapt(time.Now())
 		}
 	}
 }
+
 func (m *Manager) update(x context.Context) {
 	m.log.Trace("Starting update..")
-	if err := m.getJSON(x, "api/games/", &m.Games); err != nil {
-		m.log.Error("Error occurred during update tick: %s", err.Error())
+	defer m.count()
+	var (
+		t   *Span
+		err error
+	)
+	x, t = m.span(x, "update")
+	defer func() { t.finish(m, err) }()
+	defer m.degrade(x)
+	m.lock.Lock()
+	p := make(map[uint64]*replay, len(m.replays))
+	for k, v := range m.replays {
+		p[k] = v
+	}
+	m.lock.Unlock()
+	m.transition(x)
+	for k, v := range p {
+		s, ok := m.subs[k]
+		if !ok {
+			if s = m.subscribe(x, k); s == nil {
+				continue
+			}
+		}
+		s.accept()
+		s.play(x, m, v, &s.last)
+	}
+	m.lagging(x, p)
+	m.control(x)
+	m.herald(x)
+	if !m.leading() {
+		m.follow(x)
 		return
 	}
-	for i := range m.Games {
-		n := cleanSlugString(m.Games[i].Name)
-		if !m.Games[i].Active() {
-			delete(m.active, n)
-			continue
+	if n := time.Now(); !m.breaker.allow(n) {
+		m.log.Trace("Source circuit is open, skipping update until %s.", m.breaker.until.Format(time.RFC3339))
+		for _, s := range m.subs {
+			s.accept()
 		}
-		if _, ok := m.active[n]; !ok {
-			m.active[n] = m.Games[i].ID
-			m.log.Debug(`Added Game name mapping "%s" to ID %d.`, n, m.Games[i].ID)
+		return
+	}
+	if err = m.list(x); err != nil {
+		m.log.Error("Error occurred during update tick: %s", err.Error())
+		if m.breaker.fail(time.Now()) {
+			m.log.Warning("Source failed %d times, pausing updates for %s!", m.breaker.fails, m.breaker.cooldown.String())
 		}
+		return
+	}
+	if m.breaker.success() {
+		m.log.Info("Source has recovered, resuming updates.")
 	}
+	m.names()
 	select {
 	case <-x.Done():
 		return
 	default:
 		break
 	}
-	var r []uint64
+	var (
+		r []uint64
+		u []*subscription
+	)
+	if m.observed() {
+		for i := range m.Games {
+			if _, ok := m.subs[m.Games[i].ID]; !ok && m.Games[i].Active() {
+				m.log.Debug("Subscribing to Game %d for hooks..", m.Games[i].ID)
+				m.subscribe(x, m.Games[i].ID)
+			}
+		}
+	}
+	m.queue()
 	for _, s := range m.subs {
-		if len(s.clients) == 0 {
-			if atomic.LoadUint32(&s.stale) == 1 {
+		if _, ok := p[s.ID]; ok {
+			continue
+		}
+		if len(s.clients) == 0 && (s.lag == nil || len(s.lag.clients) == 0) && (!m.observed() || !s.last.Meta.Active()) {
+			if atomic.LoadUint32(&s.stale) == 1 && !s.busy {
 				r = append(r, s.ID)
 				continue
 			}
 			atomic.StoreUint32(&s.stale, 1)
 		}
-		select {
-		case <-x.Done():
-			return
-		default:
-		}
-		s.update(x, m)
+		u = append(u, s)
 	}
+	m.dispatch(x, u)
+	m.revive()
 	for i := range r {
 		select {
 		case <-x.Done():
@@ -244,37 +440,44 @@ func (m *Manager) update(x context.Context) {
 		default:
 		}
 		m.log.Debug("Removing unused subscription for Game %d.", r[i])
-		close(m.subs[r[i]].new)
+		if close(m.subs[r[i]].new); m.subs[r[i]].lag != nil {
+			close(m.subs[r[i]].lag.new)
+		}
 		delete(m.subs, r[i])
 	}
 	if m.twitter != nil {
 		m.twitter.update(x, m)
 	}
+	atomic.StoreInt64(&m.stats.updated, time.Now().UnixNano())
 	m.log.Debug("Read %d Games from scorebot, update finished.", len(m.Games))
 }
-func (h *hello) UnmarshalJSON(b []byte) error {
-	var m map[string]uint64
-	if err := json.Unmarshal(b, &m); err != nil {
-		return err
-	}
-	v, ok := m["game"]
-	if !ok {
-		return errMissingGame
+func (m *Manager) names() {
+	for i := range m.Games {
+		n := cleanSlugString(m.Games[i].Name)
+		if !m.Games[i].Active() {
+			delete(m.active, n)
+			continue
+		}
+		if _, ok := m.active[n]; !ok {
+			m.active[n] = m.Games[i].ID
+			m.log.Debug(`Added Game name mapping "%s" to ID %d.`, n, m.Games[i].ID)
+		}
 	}
-	*h = hello(v)
-	return nil
 }
 func (m *Manager) startUpdate(x context.Context) {
 	atomic.StoreUint32(&m.running, 1)
 	c, f := context.WithTimeout(x, m.timeout)
 	go func(y context.Context, w context.CancelFunc, q *Manager) {
+		defer q.flight.Done()
 		defer func() {
 			if err := recover(); err != nil {
-				q.log.Error("Panic occurred during manager tick: %s!", err)
+				q.recovered("update", err)
 				w()
 			}
 		}()
 		q.update(y)
+		q.persist(false)
+		q.replicate()
 		w()
 	}(c, f, m)
 	<-c.Done()
@@ -299,13 +502,16 @@ func (t *tweets) update(x context.Context, m *Manager) {
 			x = <-t.new
 			r = tweet{
 				ID:        uint64(x.ID),
-				User:      x.User.Name,
+				User:      sanitize(x.User.Name, 0),
 				Text:      x.Text,
 				expire:    n + int64(t.timeout.Seconds()),
-				UserName:  x.User.ScreenName,
-				UserPhoto: x.User.ProfileImageURLHttps,
+				UserName:  sanitize(x.User.ScreenName, 0),
+				UserPhoto: link(x.User.ProfileImageURLHttps),
 			}
 		)
+		if t.route != nil {
+			r.Channel = t.route(x)
+		}
 		if x.Retweeted {
 			if len(r.Text) > 0 {
 				r.Text = r.Text + "\nRT @" + x.RetweetedStatus.User.ScreenName + ": " + x.RetweetedStatus.Text
@@ -319,9 +525,14 @@ func (t *tweets) update(x context.Context, m *Manager) {
 				if x.Entities.Media[i].Type != "photo" {
 					continue
 				}
-				r.Images = append(r.Images, x.Entities.Media[i].MediaURLHttps)
+				if u := link(x.Entities.Media[i].MediaURLHttps); len(u) > 0 {
+					r.Images = append(r.Images, u)
+				}
 			}
 		}
+		// The text is sanitized after the retweet is added, so the text is cut to the
+		// size as it is shown.
+		r.Text = sanitize(r.Text, t.size)
 		c = append(c, r)
 	}
 	for i := range t.current {
@@ -335,28 +546,76 @@ func (t *tweets) update(x context.Context, m *Manager) {
 		}
 		m.log.Debug("Removed Tweet ID \"%X\" due to timeout!", t.current[i].ID)
 	}
-	t.current = c
+	// New Tweets are added before the Tweets already shown, so the oldest Tweets are
+	// the ones removed when there are more Tweets than the limit. Each channel has its
+	// own limit, so a busy channel does not remove the Tweets of a quiet one.
+	var (
+		k = m.tweetLimit()
+		v = make(map[string]int)
+		o = c[:0]
+	)
+	for i := range c {
+		if v[c[i].Channel]++; v[c[i].Channel] > k {
+			continue
+		}
+		o = append(o, c[i])
+	}
+	if len(o) < len(c) {
+		m.log.Debug("Removed %d Tweets over the limit of %d Tweets!", len(c)-len(o), k)
+		atomic.AddUint64(&m.stats.tweets, uint64(len(c)-len(o)))
+	}
+	t.current = m.retract(o)
+	m.shows(t.current)
 }
-func (s *subscription) update(x context.Context, m *Manager) {
-	defer func(l logx.Log) {
+
+// prepare runs the checks of the subscription that do not need the Source, and returns
+// true if the Game clock changed, so the Game must be compared again.
+func (s *subscription) prepare(x context.Context, m *Manager) bool {
+	defer func() {
 		if err := recover(); err != nil {
-			l.Error("Game subscription update function recovered from a panic: %s!", err)
+			m.recovered("subscription update", err)
 		}
-	}(m.log)
-	for len(s.new) > 0 {
-		s.clients = append(s.clients, &stream{<-s.new, true})
-	}
+	}()
+	s.accept()
+	w := s.tick(x, m, time.Now())
+	s.sample(m, time.Now().UTC())
+	if r := s.idle(m, time.Now().UTC()); len(r) > 0 {
+		s.broadcast(x, m, s.changes(m, r))
+	}
+	return w
+}
+func (s *subscription) update(x context.Context, m *Manager, w bool, p pull) {
+	defer func() {
+		if err := recover(); err != nil {
+			m.recovered("subscription update", err)
+		}
+	}()
 	select {
 	case <-x.Done():
 		return
 	default:
 	}
+	x, t := m.span(x, "game")
+	t.set("game.id", strconv.FormatUint(s.ID, 10))
+	defer t.finish(m, nil)
 	m.log.Debug("Checking for update for subscribed Game %d..", s.ID)
-	var g game
-	if err := m.getJSON(x, "api/scoreboard/"+strconv.FormatUint(s.ID, 10), &g); err != nil {
+	g, err := p.g, p.err
+	if err != nil && err != errNotModified {
 		m.log.Error("Error retrieving data for Game ID %d: %s!", s.ID, err.Error())
+		if s.fails++; s.fails == 1 {
+			s.failed = time.Now()
+		}
 		return
 	}
+	if !p.reused {
+		s.fails, s.fresh = 0, time.Now()
+	}
+	if err == errNotModified {
+		if !w && (m.twitter == nil || sameTweets(s.last.Tweets, m.twitter.current)) && !s.holding(m) && len(s.notices) == 0 && !g.refreshed(&s.last) {
+			m.log.Debug("Game %d was not modified, skipping comparison.", s.ID)
+			return
+		}
+	}
 	g.Meta.ID = s.ID
 	for i := range m.Games {
 		if m.Games[i].ID == g.Meta.ID {
@@ -366,6 +625,7 @@ func (s *subscription) update(x context.Context, m *Manager) {
 			break
 		}
 	}
+	g.scores(&s.last, time.Now().UTC())
 	if m.twitter != nil {
 		g.Tweets = m.twitter.current
 	}
@@ -374,99 +634,274 @@ func (s *subscription) update(x context.Context, m *Manager) {
 		return
 	default:
 	}
-	var u []update
+	var (
+		c []update
+		n = time.Now().UTC()
+	)
+	_, d := m.span(x, "diff")
+	if s.resync {
+		m.log.Debug("Resynchronizing Game %d after replay.", s.ID)
+		s.resync = false
+	} else {
+		v := diff(&s.last, &g, n, m.milestone)
+		if len(v) > 0 {
+			s.heed(m, n)
+		}
+		if v = append(v, s.adjusted(&g, n)...); len(v) > 0 || len(s.held) > 0 {
+			c = s.changes(m, v)
+		}
+		if standings(&s.last, &g) {
+			m.snapshot(&g, n)
+		}
+		if len(m.listen) > 0 {
+			m.messages(&s.last, &g, n)
+		}
+	}
+	d.set("changes", strconv.Itoa(len(c)))
+	d.finish(m, nil)
+	s.upstream, s.fetched = g.Events.Current, true
+	if len(s.feed) > 0 {
+		e := make([]event, 0, len(g.Events.Current)+len(s.feed))
+		g.Events.Current = append(append(e, g.Events.Current...), s.feed...)
+	}
+	var (
+		u       []update
+		v, o, r = s.hold(m, &g, n)
+	)
+	if o != &s.last {
+		c = r
+	}
 	m.log.Debug("Running game comparison on Game %d..", s.ID)
-	s.cache, u = g.Delta(m.assets, &s.last)
+	s.cache, u = v.Delta(m.assets, o)
 	s.last = g
-	if len(u) > 0 {
-		m.log.Debug("%d Updates detected in Game %d, updating clients..", len(u), s.ID)
-		r := make([]*stream, 0, len(s.clients))
-		for i := range s.clients {
-			select {
-			case <-x.Done():
-				return
-			default:
-			}
-			if i > len(s.clients) {
-				return
-			}
-			if !s.clients[i].ok {
-				s.clients[i].Close()
-				continue
+	s.sample(m, n)
+	s.tally(m, n)
+	s.implants(m, n)
+	s.chart(m, n)
+	s.crown(m, n)
+	s.send(x, m, append(u, c...))
+	if s.lag != nil && s.lag.behind == nil {
+		s.lag.mirror(x, m, v, c)
+	}
+}
+func (m *Manager) subscribe(x context.Context, i uint64) *subscription {
+	if !m.leading() {
+		m.log.Debug("Game %d is not in the shared state, ignoring!", i)
+		return nil
+	}
+	var g game
+	if err := m.fetch(x, i, &g); err != nil && err != errNotModified {
+		m.log.Error("Error retrieving data for Game ID %d: %s!", i, err.Error())
+		return nil
+	}
+	if len(g.Meta.Name) == 0 && len(g.Teams) == 0 {
+		m.log.Error("Game ID %d is empty, ignoring!", i)
+		return nil
+	}
+	g.Meta.ID = i
+	for v := range m.Games {
+		if m.Games[v].ID == g.Meta.ID {
+			g.Meta.End = m.Games[v].End
+			g.Meta.Start = m.Games[v].Start
+			g.Meta.Status = m.Games[v].Status
+			break
+		}
+	}
+	s := &subscription{
+		ID:      g.Meta.ID,
+		new:     make(chan *stream, 128),
+		last:    g,
+		fresh:   time.Now(),
+		clients: make([]*stream, 0, 1),
+	}
+	if m.twitter != nil {
+		s.last.Tweets = m.twitter.current
+	}
+	s.cache, _ = s.last.Delta(m.assets, nil)
+	m.shadow(s)
+	m.subs[g.Meta.ID] = s
+	m.snapshot(&s.last, time.Now().UTC())
+	s.implants(m, time.Now().UTC())
+	s.chart(m, time.Now().UTC())
+	s.crown(m, time.Now().UTC())
+	return s
+}
+func (s *subscription) accept() {
+	for len(s.new) > 0 {
+		s.clients = append(s.clients, <-s.new)
+	}
+}
+func (s *subscription) send(x context.Context, m *Manager, u []update) {
+	if u = s.dedupe(u); len(u) == 0 {
+		return
+	}
+	b, err := payload(u)
+	if err != nil {
+		m.log.Error("Unable to encode %d Updates for Game %d: %s!", len(u), s.ID, err.Error())
+		return
+	}
+	s.write(x, m, u, b.Bytes())
+	release(b)
+}
+
+// write sends the encoded updates to every client of the subscription. The updates are
+// encoded once before calling write, instead of once for each client. Clients that
+// asked for a slice of the Game are sent the updates of their slice, which are encoded
+// once for each slice.
+func (s *subscription) write(x context.Context, m *Manager, u []update, b []byte) {
+	q, n := atomic.AddUint64(&s.seq, 1), len(u)
+	m.log.Debug("%d Updates detected in Game %d, updating clients..", n, s.ID)
+	defer m.stats.sent(time.Now())
+	_, t := m.span(x, "broadcast")
+	t.set("updates", strconv.Itoa(n))
+	t.set("clients", strconv.Itoa(len(s.clients)))
+	defer t.finish(m, nil)
+	var (
+		r = make([]*stream, 0, len(s.clients))
+		k map[slice][]byte
+	)
+	for i := range s.clients {
+		select {
+		case <-x.Done():
+			return
+		default:
+		}
+		if i > len(s.clients) {
+			return
+		}
+		if !s.clients[i].ok {
+			s.clients[i].Close()
+			m.forget(s.clients[i])
+			continue
+		}
+		s.clients[i].ok = false
+		m.lag(x)
+		v := b
+		if !s.clients[i].slice.whole() {
+			if k == nil {
+				k = make(map[slice][]byte)
 			}
-			s.clients[i].ok = false
-			if err := s.clients[i].WriteJSON(u); err != nil {
-				m.log.Error(`Received error by client "%s", removing: %s!`, s.clients[i].RemoteAddr().String(), err.Error())
-				s.clients[i].Close()
-				continue
+			if v = k[s.clients[i].slice]; v == nil {
+				v = s.encode(m, s.clients[i].slice, u)
+				k[s.clients[i].slice] = v
 			}
-			s.clients[i].ok = true
-			r = append(r, s.clients[i])
 		}
-		s.clients = r
+		if err := s.clients[i].write(v, q); err != nil {
+			m.log.Error(`Received error by client "%s", removing: %s!`, s.clients[i].RemoteAddr().String(), err.Error())
+			s.clients[i].Close()
+			m.forget(s.clients[i])
+			continue
+		}
+		s.clients[i].ok = true
+		r = append(r, s.clients[i])
+	}
+	// Slices without any clients left are dropped, so a client that connects later
+	// with the same slice starts from the board it was sent.
+	for v := range s.slices {
+		if _, ok := k[v]; !ok {
+			delete(s.slices, v)
+		}
 	}
+	s.clients = r
 }
 
 // Twitter creates and returns the Twitter channel. This channel can be used to submit Tweets to
-// be sent to the scoreboard.
-func (m *Manager) Twitter(t time.Duration) chan<- *twitter.Tweet {
-	m.twitter = &tweets{new: make(chan *twitter.Tweet), timeout: t}
+// be sent to the scoreboard. The channel is buffered until the next update tick, so a full channel
+// means the Manager is not keeping up and Tweets should be dropped instead of blocking. The text of
+// each Tweet is cut to the size in characters, if not zero. The route function, if not nil, returns
+// the name of the display channel each Tweet is shown in, or an empty string for the Twitter tab.
+func (m *Manager) Twitter(t time.Duration, n int, r func(*twitter.Tweet) string) chan<- *twitter.Tweet {
+	m.twitter = &tweets{new: make(chan *twitter.Tweet, 64), route: r, timeout: t, size: n}
 	return m.twitter.new
 }
-func (m Manager) get(x context.Context, u string) ([]byte, error) {
-	m.url.Path = path.Join(m.url.Path, u) + "/"
-	var (
-		c, f   = context.WithTimeout(x, m.timeout)
-		r, err = http.NewRequestWithContext(c, http.MethodGet, m.url.String(), nil)
-	)
-	defer f()
-	if err != nil {
-		return nil, err
-	}
-	o, err := m.client.Do(r)
-	if err != nil {
-		return nil, err
+
+// Check requests the list of Games from the Source once, to test that the Source can be
+// reached and returns valid data.
+func (m *Manager) Check(x context.Context) error {
+	g, err := m.source.Games(x)
+	if err != nil && err != errNotModified {
+		return err
 	}
-	if o.Body == nil {
-		return nil, errors.New(`request "` + m.url.String() + `" returned an empty body`)
+	return validMeta(g)
+}
+func (m *Manager) list(x context.Context) error {
+	n := time.Now()
+	y, t := m.span(x, "source.games")
+	g, err := m.source.Games(y)
+	t.finish(m, err)
+	m.stats.fetched(n, err)
+	if err != nil && err != errNotModified {
+		return err
 	}
-	defer o.Body.Close()
-	if o.StatusCode >= 400 {
-		return nil, errors.New(`request "` + m.url.String() + `" returned status code ` + strconv.Itoa(o.StatusCode))
+	if err = validMeta(g); err != nil {
+		return err
 	}
-	b, err := io.ReadAll(o.Body)
-	if err != nil {
-		return nil, errors.New(`error reading from the URL "` + m.url.String() + `": ` + err.Error())
+	if !sameMeta(m.Games, g) {
+		atomic.AddUint64(&m.version, 1)
 	}
-	return b, nil
+	m.Games = g
+	return nil
 }
-func (m Manager) getJSON(x context.Context, u string, o interface{}) error {
-	r, err := m.get(x, u)
-	if err != nil {
-		return err
+func sameMeta(a, b []meta) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	if err := json.Unmarshal(r, &o); err != nil {
-		return errors.New(`unable to unmarshal JSON from "` + u + `": ` + err.Error())
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Name != b[i].Name || a[i].Mode != b[i].Mode || a[i].Status != b[i].Status {
+			return false
+		}
+		if !a[i].Start.Equal(b[i].Start) || !a[i].End.Equal(b[i].End) {
+			return false
+		}
 	}
-	return nil
+	return true
 }
-
-// New creates a collection instance from the provided logger, timeout and API URL endpoint.
-func New(burl, d string, tick, t time.Duration, l logx.Log) (*Manager, error) {
-	u, err := parseurl.Parse(burl)
-	if err != nil {
-		return nil, errors.New(`could not unpack URL "` + burl + `": ` + err.Error())
+func sameTweets(a, b []tweet) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	if !u.IsAbs() {
-		u.Scheme = "http"
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
 	}
-	if len(d) == 0 {
-		d = u.String()
+	return true
+}
+func (m *Manager) fetch(x context.Context, i uint64, g *game) error {
+	n := time.Now()
+	y, t := m.span(x, "source.fetch")
+	t.set("game.id", strconv.FormatUint(i, 10))
+	v, err := m.source.Fetch(y, i)
+	t.finish(m, err)
+	m.stats.fetched(n, err)
+	if err != nil && err != errNotModified {
+		return err
 	}
+	k := m.teamLimit()
+	c, r := v.validate(k)
+	if r != nil {
+		return r
+	}
+	if c > 0 {
+		m.log.Warning("Game %d has %d challenges with more than %d solvers, only the first %d solvers are kept!", i, c, k, k)
+	}
+	*g = *v
+	g.order = m.order
+	m.deskew(g)
+	m.divide(g)
+	m.enroll(g)
+	m.adjust(i, g)
+	m.emblem(g)
+	return err
+}
+
+// New creates a collection instance from the provided logger, timeout and Source. The Source
+// type name is used to lookup the registered adapterFunc, which is passed the raw JSON config.
+func New(n string, c json.RawMessage, d string, tick, t time.Duration, l logx.Log) (*Manager, error) {
 	m := &Manager{
 		log:    l,
-		url:    *u,
 		subs:   make(map[uint64]*subscription),
+		ready:  make(chan struct{}, 1),
 		tick:   time.NewTicker(tick),
 		active: make(map[string]uint64),
 		assets: d,
@@ -481,7 +916,19 @@ func New(burl, d string, tick, t time.Duration, l logx.Log) (*Manager, error) {
 				ResponseHeaderTimeout: t,
 			},
 		},
-		timeout: t,
+		stats:     new(counters),
+		timeout:   t,
+		workers:   4,
+		milestone: 1000,
+		breaker:   breaker{attempts: 3, threshold: 5, cooldown: time.Second * 30, last: time.Now()},
+		pace:      pace{base: tick, current: tick},
+		origin:    origin{n: n, c: c},
+	}
+	var err error
+	if m.source, err = source(m, n, c); err != nil {
+		m.tick.Stop()
+		return nil, err
 	}
+	l.Debug(`Using source type "%s" with capabilities [%s].`, n, m.source.Capabilities())
 	return m, nil
 }
@@ -0,0 +1,678 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PurpleSec/parseurl"
+)
+
+var errInvalidPath = errors.New("invalid path expression")
+
+type filter struct {
+	value *expression
+	field string
+	text  string
+}
+type selector struct {
+	where *filter
+	name  string
+	index int
+	all   bool
+}
+type expression struct {
+	path []selector
+	root bool
+}
+type mapping struct {
+	lock    sync.Mutex
+	m       *Manager
+	doc     interface{}
+	headers map[string]string
+	url     string
+	name    string
+	names   []string
+	urls    []string
+	stale   bool
+	teams   expression
+	solves  expression
+	summits expression
+	team    mapTeam
+	host    mapHost
+	service mapService
+	beacon  mapBeacon
+	solve   mapChallenge
+	summit  mapHill
+}
+type mapHost struct {
+	ID       expression `json:"id"`
+	Name     expression `json:"name"`
+	Online   expression `json:"online"`
+	Services expression `json:"services"`
+}
+type mapTeam struct {
+	ID          expression `json:"id"`
+	Name        expression `json:"name"`
+	Logo        expression `json:"logo"`
+	Color       expression `json:"color"`
+	Division    expression `json:"division"`
+	Country     expression `json:"country"`
+	Affiliation expression `json:"affiliation"`
+	Score       expression `json:"score"`
+	Health      expression `json:"health"`
+	Hosts       expression `json:"hosts"`
+	Services    expression `json:"services"`
+	Beacons     expression `json:"beacons"`
+	Meta        expression `json:"meta"`
+}
+type mapBeacon struct {
+	ID    expression `json:"id"`
+	Team  expression `json:"team"`
+	Host  expression `json:"host"`
+	Color expression `json:"color"`
+}
+type mapChallenge struct {
+	ID       expression `json:"id"`
+	Name     expression `json:"name"`
+	Points   expression `json:"points"`
+	Solvers  expression `json:"solvers"`
+	Category expression `json:"category"`
+}
+type mapHill struct {
+	ID    expression `json:"id"`
+	Name  expression `json:"name"`
+	Owner expression `json:"owner"`
+}
+type mapService struct {
+	ID       expression `json:"id"`
+	SLA      expression `json:"sla"`
+	Name     expression `json:"name"`
+	Port     expression `json:"port"`
+	Status   expression `json:"status"`
+	Protocol expression `json:"protocol"`
+	Meta     expression `json:"meta"`
+	Lost     expression `json:"lost"`
+}
+
+func (m *mapping) meta() meta {
+	return meta{ID: singleGame, Name: m.name, Status: running}
+}
+func text(v interface{}) string {
+	switch i := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return i
+	case bool:
+		return strconv.FormatBool(i)
+	case float64:
+		return strconv.FormatFloat(i, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+func decimal(v interface{}) float64 {
+	switch i := v.(type) {
+	case float64:
+		return i
+	case string:
+		if n, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(i), "%"), 64); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+func number(v interface{}) int64 {
+	switch i := v.(type) {
+	case float64:
+		return int64(i)
+	case bool:
+		if i {
+			return 1
+		}
+	case string:
+		if n, err := strconv.ParseFloat(strings.TrimSpace(i), 64); err == nil {
+			return int64(n)
+		}
+	}
+	return 0
+}
+func condition(v interface{}) state {
+	switch i := v.(type) {
+	case bool:
+		if i {
+			return green
+		}
+		return red
+	case float64:
+		switch int(i) {
+		case 0:
+			return green
+		case 1:
+			return yellow
+		}
+		return red
+	case string:
+		var s state
+		s.UnmarshalJSON([]byte(strconv.Quote(i)))
+		return s
+	}
+	return red
+}
+func identity(v interface{}, f string, i int) uint64 {
+	if n := number(v); n > 0 {
+		return uint64(n)
+	}
+	if s := text(v); len(s) > 0 {
+		f = s
+	}
+	if len(f) == 0 {
+		return uint64(i + 1)
+	}
+	var h hasher
+	h.Hash(f)
+	return h.Sum64() & 0xFFFFFFFFFFFF
+}
+func (m *mapping) Capabilities() capability {
+	c := capHosts
+	if !m.team.Beacons.empty() {
+		c |= capBeacons
+	}
+	if !m.solves.empty() {
+		c |= capSolves
+	}
+	if !m.summits.empty() {
+		c |= capHills
+	}
+	return c
+}
+
+// UnmarshalJSON parses the path expression from the supplied JSON string.
+func (e *expression) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := compile(s)
+	if err != nil {
+		return errors.New(`path "` + s + `": ` + err.Error())
+	}
+	*e = v
+	return nil
+}
+func compile(s string) (expression, error) {
+	var e expression
+	if s = strings.TrimSpace(s); len(s) == 0 {
+		return e, nil
+	}
+	switch s[0] {
+	case '$':
+		e.root, s = true, s[1:]
+	case '@':
+		s = s[1:]
+	default:
+		if s[0] != '.' && s[0] != '[' {
+			s = "." + s
+		}
+	}
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			n := strings.IndexAny(s, ".[")
+			if n == -1 {
+				n = len(s)
+			}
+			if n == 0 {
+				return e, errInvalidPath
+			}
+			if s[:n] == "*" {
+				e.path = append(e.path, selector{all: true})
+			} else {
+				e.path = append(e.path, selector{name: s[:n], index: -1})
+			}
+			s = s[n:]
+		case '[':
+			n := strings.IndexByte(s, ']')
+			if n <= 1 {
+				return e, errInvalidPath
+			}
+			v := strings.TrimSpace(s[1:n])
+			switch {
+			case len(v) > 1 && v[0] == '?':
+				f, err := where(v[1:])
+				if err != nil {
+					return e, err
+				}
+				e.path = append(e.path, selector{where: f})
+			case v == "*":
+				e.path = append(e.path, selector{all: true})
+			case len(v) > 1 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0]:
+				e.path = append(e.path, selector{name: v[1 : len(v)-1], index: -1})
+			default:
+				i, err := strconv.Atoi(v)
+				if err != nil {
+					return e, errInvalidPath
+				}
+				e.path = append(e.path, selector{index: i})
+			}
+			s = s[n+1:]
+		default:
+			return e, errInvalidPath
+		}
+	}
+	return e, nil
+}
+func where(s string) (*filter, error) {
+	n := strings.Index(s, "==")
+	if n <= 0 {
+		return nil, errInvalidPath
+	}
+	f := &filter{field: strings.TrimSpace(s[:n])}
+	if len(f.field) == 0 {
+		return nil, errInvalidPath
+	}
+	v := strings.TrimSpace(s[n+2:])
+	if len(v) > 1 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		f.text = v[1 : len(v)-1]
+		return f, nil
+	}
+	if len(v) == 0 {
+		return nil, errInvalidPath
+	}
+	e, err := compile(v)
+	if err != nil {
+		return nil, err
+	}
+	f.value = &e
+	return f, nil
+}
+func (f *filter) match(d, c, v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	o, ok := m[f.field]
+	if !ok {
+		return false
+	}
+	if f.value == nil {
+		return text(o) == f.text
+	}
+	return text(o) == text(f.value.one(d, c))
+}
+func (e expression) empty() bool {
+	return !e.root && len(e.path) == 0
+}
+func (m *mapping) Games(x context.Context) ([]meta, error) {
+	if len(m.urls) > 0 {
+		return m.endpoints(x)
+	}
+	b, err := m.m.request(x, m.url, m.headers)
+	if err != nil {
+		if err != errNotModified {
+			return nil, err
+		}
+		m.lock.Lock()
+		m.stale = true
+		m.lock.Unlock()
+		return []meta{m.meta()}, err
+	}
+	var d interface{}
+	if err = json.Unmarshal(b, &d); err != nil {
+		return nil, errors.New(`unable to unmarshal JSON from "` + m.url + `": ` + err.Error())
+	}
+	m.lock.Lock()
+	m.doc, m.stale = d, false
+	m.lock.Unlock()
+	return []meta{m.meta()}, nil
+}
+func (m *mapping) endpoints(x context.Context) ([]meta, error) {
+	var (
+		d = make([]interface{}, len(m.urls))
+		e = make([]error, len(m.urls))
+	)
+	m.m.parallel(len(m.urls), func(i int) {
+		b, err := m.m.request(x, m.urls[i], m.headers)
+		if err != nil && err != errNotModified {
+			e[i] = err
+			return
+		}
+		if v := json.Unmarshal(b, &d[i]); v != nil {
+			e[i] = errors.New(`unable to unmarshal JSON from "` + m.urls[i] + `": ` + v.Error())
+			return
+		}
+		e[i] = err
+	})
+	v := true
+	for i := range e {
+		if e[i] == nil {
+			v = false
+			continue
+		}
+		if e[i] != errNotModified {
+			return nil, e[i]
+		}
+	}
+	r := make(map[string]interface{}, len(d))
+	for i := range d {
+		r[m.names[i]] = d[i]
+	}
+	m.lock.Lock()
+	m.doc, m.stale = r, v
+	m.lock.Unlock()
+	if v {
+		return []meta{m.meta()}, errNotModified
+	}
+	return []meta{m.meta()}, nil
+}
+func (e expression) one(d, c interface{}) interface{} {
+	if r := e.eval(d, c); len(r) > 0 {
+		return r[0]
+	}
+	return nil
+}
+func (e expression) eval(d, c interface{}) []interface{} {
+	if e.empty() {
+		return nil
+	}
+	r := []interface{}{c}
+	if e.root {
+		r[0] = d
+	}
+	for _, s := range e.path {
+		n := make([]interface{}, 0, len(r))
+		for _, v := range r {
+			switch i := v.(type) {
+			case map[string]interface{}:
+				if s.where != nil {
+					for _, o := range i {
+						if s.where.match(d, c, o) {
+							n = append(n, o)
+						}
+					}
+				} else if s.all {
+					for _, o := range i {
+						n = append(n, o)
+					}
+				} else if o, ok := i[s.name]; ok && len(s.name) > 0 {
+					n = append(n, o)
+				}
+			case []interface{}:
+				switch {
+				case s.where != nil:
+					for _, o := range i {
+						if s.where.match(d, c, o) {
+							n = append(n, o)
+						}
+					}
+				case s.all:
+					n = append(n, i...)
+				case len(s.name) == 0 && s.index < 0 && -s.index <= len(i):
+					n = append(n, i[len(i)+s.index])
+				case len(s.name) == 0 && s.index >= 0 && s.index < len(i):
+					n = append(n, i[s.index])
+				}
+			}
+		}
+		if r = n; len(r) == 0 {
+			break
+		}
+	}
+	return r
+}
+func newMapping(m *Manager, c json.RawMessage) (adapter, error) {
+	var v struct {
+		Headers    map[string]string `json:"headers"`
+		Endpoints  map[string]string `json:"endpoints"`
+		URL        string            `json:"url"`
+		Name       string            `json:"name"`
+		Teams      expression        `json:"teams"`
+		Challenges expression        `json:"challenges"`
+		Hills      expression        `json:"hills"`
+		Team       mapTeam           `json:"team"`
+		Host       mapHost           `json:"host"`
+		Service    mapService        `json:"service"`
+		Beacon     mapBeacon         `json:"beacon"`
+		Challenge  mapChallenge      `json:"challenge"`
+		Hill       mapHill           `json:"hill"`
+	}
+	if len(c) > 0 {
+		if err := json.Unmarshal(c, &v); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.URL) == 0 && len(v.Endpoints) == 0 {
+		return nil, errors.New("json source URL or endpoints are missing")
+	}
+	if len(v.URL) > 0 && len(v.Endpoints) > 0 {
+		return nil, errors.New("json source cannot have both a URL and endpoints")
+	}
+	if v.Teams.empty() {
+		return nil, errors.New("json source teams path is missing")
+	}
+	r := &mapping{
+		m:       m,
+		name:    v.Name,
+		teams:   v.Teams,
+		team:    v.Team,
+		host:    v.Host,
+		service: v.Service,
+		beacon:  v.Beacon,
+		solves:  v.Challenges,
+		solve:   v.Challenge,
+		summits: v.Hills,
+		summit:  v.Hill,
+		headers: v.Headers,
+	}
+	if len(v.URL) > 0 {
+		u, err := address(v.URL)
+		if err != nil {
+			return nil, err
+		}
+		if r.url = u.String(); len(r.name) == 0 {
+			r.name = u.Host
+		}
+		return r, nil
+	}
+	r.names = make([]string, 0, len(v.Endpoints))
+	for n := range v.Endpoints {
+		r.names = append(r.names, n)
+	}
+	sort.Strings(r.names)
+	r.urls = make([]string, len(r.names))
+	for i := range r.names {
+		if len(r.names[i]) == 0 {
+			return nil, errors.New("json source endpoint name cannot be empty")
+		}
+		u, err := address(v.Endpoints[r.names[i]])
+		if err != nil {
+			return nil, err
+		}
+		if r.urls[i] = u.String(); len(r.name) == 0 {
+			r.name = u.Host
+		}
+	}
+	return r, nil
+}
+func address(s string) (*url.URL, error) {
+	u, err := parseurl.Parse(s)
+	if err != nil {
+		return nil, errors.New(`could not unpack URL "` + s + `": ` + err.Error())
+	}
+	if !u.IsAbs() {
+		u.Scheme = "http"
+	}
+	return u, nil
+}
+func (m *mapping) services(d, c interface{}, e expression) []service {
+	l := e.eval(d, c)
+	if len(l) == 0 {
+		return nil
+	}
+	r := make([]service, 0, len(l))
+	for i := range l {
+		s := service{
+			SLA:   decimal(m.service.SLA.one(d, l[i])),
+			Name:  text(m.service.Name.one(d, l[i])),
+			Port:  uint16(number(m.service.Port.one(d, l[i]))),
+			State: condition(m.service.Status.one(d, l[i])),
+			Meta:  extra(m.service.Meta.one(d, l[i])),
+			Lost:  uint32(number(m.service.Lost.one(d, l[i]))),
+		}
+		if v := m.service.Protocol.one(d, l[i]); v != nil {
+			s.Protocol.UnmarshalJSON([]byte(strconv.Quote(text(v))))
+		}
+		s.ID = identity(m.service.ID.one(d, l[i]), "", i)
+		r = append(r, s)
+	}
+	return r
+}
+func (m *mapping) beacons(d, c interface{}, t *team) []beacon {
+	l := m.team.Beacons.eval(d, c)
+	if len(l) == 0 {
+		return nil
+	}
+	r := make([]beacon, 0, len(l))
+	for i := range l {
+		v := m.beacon.Team.one(d, l[i])
+		if v == nil {
+			continue
+		}
+		b := beacon{
+			Host:  text(m.beacon.Host.one(d, l[i])),
+			Team:  identity(v, "", 0),
+			Color: text(m.beacon.Color.one(d, l[i])),
+		}
+		b.ID = identity(m.beacon.ID.one(d, l[i]), t.Name+"/"+text(v)+"/"+b.Host, i)
+		r = append(r, b)
+	}
+	return r
+}
+func (m *mapping) challenges(d interface{}, k map[uint64]uint64) []Challenge {
+	l := m.solves.eval(d, d)
+	r := make([]Challenge, 0, len(l))
+	for i := range l {
+		c := Challenge{
+			Name:     text(m.solve.Name.one(d, l[i])),
+			Points:   number(m.solve.Points.one(d, l[i])),
+			Category: text(m.solve.Category.one(d, l[i])),
+		}
+		c.ID = identity(m.solve.ID.one(d, l[i]), c.Category+"/"+c.Name, i)
+		for _, v := range m.solve.Solvers.eval(d, l[i]) {
+			if v == nil {
+				continue
+			}
+			if t, ok := k[identity(v, "", 0)]; ok {
+				c.Solvers = append(c.Solvers, t)
+			}
+		}
+		r = append(r, c)
+	}
+	return r
+}
+func (m *mapping) hills(d interface{}, k map[uint64]uint64) []hill {
+	l := m.summits.eval(d, d)
+	r := make([]hill, 0, len(l))
+	for i := range l {
+		h := hill{Name: text(m.summit.Name.one(d, l[i]))}
+		h.ID = identity(m.summit.ID.one(d, l[i]), h.Name, i)
+		// Hills without an owner, or with an owner that is not a team, are not owned.
+		if v := m.summit.Owner.one(d, l[i]); len(text(v)) > 0 {
+			h.Owner = k[identity(v, "", 0)]
+		}
+		r = append(r, h)
+	}
+	return r
+}
+func (m *mapping) Fetch(_ context.Context, i uint64) (*game, error) {
+	if i != singleGame {
+		return &game{}, nil
+	}
+	m.lock.Lock()
+	d, v := m.doc, m.stale
+	m.lock.Unlock()
+	g := &game{Meta: m.meta(), Message: m.name}
+	if d == nil {
+		return g, nil
+	}
+	l := m.teams.eval(d, d)
+	g.Teams = make([]team, 0, len(l))
+	for x := range l {
+		t := team{
+			Name:        text(m.team.Name.one(d, l[x])),
+			Logo:        text(m.team.Logo.one(d, l[x])),
+			Color:       text(m.team.Color.one(d, l[x])),
+			Division:    text(m.team.Division.one(d, l[x])),
+			Country:     text(m.team.Country.one(d, l[x])),
+			Affiliation: text(m.team.Affiliation.one(d, l[x])),
+			Score:       score{Total: number(m.team.Score.one(d, l[x])), Health: number(m.team.Health.one(d, l[x]))},
+			Meta:        extra(m.team.Meta.one(d, l[x])),
+		}
+		t.ID = identity(m.team.ID.one(d, l[x]), t.Name, x)
+		if h := m.team.Hosts.eval(d, l[x]); len(h) > 0 {
+			t.Hosts = make([]host, 0, len(h))
+			for y := range h {
+				v := host{Name: text(m.host.Name.one(d, h[y])), Online: true}
+				if o := m.host.Online.one(d, h[y]); o != nil {
+					v.Online = condition(o) != red
+				}
+				v.ID = identity(m.host.ID.one(d, h[y]), t.Name+"/"+v.Name, y)
+				v.Services = m.services(d, h[y], m.host.Services)
+				t.Hosts = append(t.Hosts, v)
+			}
+		} else if s := m.services(d, l[x], m.team.Services); len(s) > 0 {
+			t.Hosts = []host{{ID: t.ID, Name: t.Name, Online: true, Services: s}}
+		}
+		t.Beacons = m.beacons(d, l[x], &t)
+		g.Teams = append(g.Teams, t)
+	}
+	// Beacon teams, challenge solvers and hill owners can be an ID or a team name,
+	// names are converted to the generated ID of the matching team.
+	k := make(map[uint64]uint64, len(g.Teams)*2)
+	for x := range g.Teams {
+		k[identity(nil, g.Teams[x].Name, x)] = g.Teams[x].ID
+		k[g.Teams[x].ID] = g.Teams[x].ID
+	}
+	if len(g.Teams) > 0 && !m.team.Beacons.empty() {
+		for x := range g.Teams {
+			for y := range g.Teams[x].Beacons {
+				if v, ok := k[g.Teams[x].Beacons[y].Team]; ok {
+					g.Teams[x].Beacons[y].Team = v
+				}
+			}
+		}
+	}
+	if !m.solves.empty() {
+		g.Challenges = m.challenges(d, k)
+	}
+	if !m.summits.empty() {
+		g.Hills = m.hills(d, k)
+	}
+	if v {
+		return g, errNotModified
+	}
+	return g, nil
+}
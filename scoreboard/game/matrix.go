@@ -0,0 +1,214 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Matrix is the status of every service of every team in a Game. The Services of
+// each Row are in the same order as the service names of the Matrix.
+type Matrix struct {
+	Time     time.Time `json:"time"`
+	Game     string    `json:"game"`
+	Services []string  `json:"services"`
+	Teams    []Row     `json:"teams"`
+	GameID   uint64    `json:"game_id"`
+}
+
+// Row is the status of the services of a single team in a Matrix.
+type Row struct {
+	Name     string `json:"name"`
+	Services []Cell `json:"services"`
+	ID       uint64 `json:"id"`
+}
+
+// Cell is the status of a single service of a team in a Matrix. Status is "up",
+// "down", "mangled" or "none" if the team does not have the service. SLA is the
+// percentage of time that the service was up, as sent by the Source or as seen by
+// the Manager since the Game was subscribed.
+type Cell struct {
+	Status string  `json:"status"`
+	Host   string  `json:"host,omitempty"`
+	SLA    float64 `json:"sla"`
+	Port   uint16  `json:"port,omitempty"`
+}
+
+// Checks is the time that each service of each team in a Game was checked and was up
+// since the last sample, which is used to keep the availability of the services.
+type Checks struct {
+	Time     time.Time `json:"time"`
+	Services []Check   `json:"services"`
+	GameID   uint64    `json:"game_id"`
+}
+
+// Check is the time, in milliseconds, that a single service of a team was checked and
+// was up since the last sample. Services with the same name on more than one host of
+// the team are added together.
+type Check struct {
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	Team    uint64 `json:"team"`
+	Up      int64  `json:"up"`
+	Total   int64  `json:"total"`
+}
+type uptime struct {
+	at    time.Time
+	up    time.Duration
+	total time.Duration
+	state state
+}
+
+// Services returns the latest service Matrix of the subscribed Game with the supplied
+// ID. If the Game is not subscribed, this function returns false.
+func (m *Manager) Services(i uint64) (Matrix, bool) {
+	m.lock.Lock()
+	v, ok := m.matrices[i]
+	m.lock.Unlock()
+	return v, ok
+}
+
+// Monitor adds a function that will be called with the Checks of the services of a Game
+// each time that the Game is sampled while it is active. Like Hooks, Monitor functions
+// should not block and adding one will keep all active Games subscribed.
+func (m *Manager) Monitor(f func(Checks)) {
+	if f != nil {
+		m.monitor = append(m.monitor, f)
+	}
+}
+func (s service) label() string {
+	if len(s.Name) > 0 {
+		return s.Name
+	}
+	return strconv.FormatUint(uint64(s.Port), 10) + "/" + s.Protocol.String()
+}
+func (s state) status() string {
+	switch s {
+	case green:
+		return "up"
+	case yellow:
+		return "mangled"
+	}
+	return "down"
+}
+
+// sample adds the time since the last sample to the uptime of each service of the
+// last known state of the Game and saves the service Matrix of the Game. The added time
+// is sent to any Monitor functions.
+func (s *subscription) sample(m *Manager, n time.Time) {
+	if s.uptime == nil {
+		s.uptime = make(map[string]*uptime)
+	}
+	var (
+		k = make(map[string]int)
+		v = Matrix{Time: n, Game: s.last.Meta.Name, GameID: s.ID}
+		a = Checks{Time: n, GameID: s.ID}
+		r []int
+	)
+	if len(s.last.Teams) > 0 {
+		r, _ = s.last.ranked()
+	}
+	for _, i := range r {
+		for _, h := range s.last.Teams[i].Hosts {
+			for _, x := range h.Services {
+				if l := x.label(); k[l] == 0 {
+					v.Services = append(v.Services, l)
+					k[l] = len(v.Services)
+				}
+			}
+		}
+	}
+	v.Teams = make([]Row, 0, len(r))
+	for _, i := range r {
+		t := &s.last.Teams[i]
+		var (
+			w = Row{ID: t.ID, Name: t.Name, Services: make([]Cell, len(v.Services))}
+			z = make([]state, len(v.Services))
+			f = make([]bool, len(v.Services))
+			o = make([]Check, len(v.Services))
+		)
+		for y := range w.Services {
+			w.Services[y].Status = "none"
+		}
+		for _, h := range t.Hosts {
+			for _, x := range h.Services {
+				var (
+					l = x.label()
+					y = k[l] - 1
+					q = x.State
+					e = strconv.FormatUint(t.ID, 10) + "/" + h.Name + "/" + l
+				)
+				if !h.Online {
+					q = red
+				}
+				u, ok := s.uptime[e]
+				if !ok {
+					u = &uptime{at: n, state: q}
+					s.uptime[e] = u
+				}
+				if d := n.Sub(u.at); d > 0 {
+					if u.total += d; u.state == green {
+						u.up += d
+						o[y].Up += int64(d / time.Millisecond)
+					}
+					o[y].Total += int64(d / time.Millisecond)
+				}
+				u.at, u.state = n, q
+				p := x.SLA
+				if p <= 0 && u.total > 0 {
+					p = math.Round(float64(u.up)*1000/float64(u.total)) / 10
+				} else if p <= 0 && q == green {
+					p = 100
+				}
+				// Teams with more than one host with the same service show the worst
+				// status and the lowest SLA of the service.
+				c := &w.Services[y]
+				if !f[y] || q > z[y] {
+					z[y], c.Status, c.Host, c.Port = q, q.status(), h.Name, x.Port
+				}
+				if !f[y] || p < c.SLA {
+					c.SLA = p
+				}
+				f[y] = true
+			}
+		}
+		for y := range o {
+			if o[y].Total > 0 {
+				o[y].Team, o[y].Name, o[y].Service = t.ID, t.Name, v.Services[y]
+				a.Services = append(a.Services, o[y])
+			}
+		}
+		v.Teams = append(v.Teams, w)
+	}
+	if v.Services == nil {
+		v.Services = []string{}
+	}
+	m.lock.Lock()
+	if m.matrices == nil {
+		m.matrices = make(map[uint64]Matrix)
+	}
+	m.matrices[s.ID] = v
+	m.lock.Unlock()
+	if len(a.Services) == 0 || !s.last.Meta.Active() || !m.leading() {
+		return
+	}
+	for _, f := range m.monitor {
+		m.guard("monitor", func() { f(a) })
+	}
+}
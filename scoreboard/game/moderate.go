@@ -0,0 +1,218 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// retractMax is the most retracted Tweet IDs kept. Retracted Tweets are usually removed
+// within minutes of being posted, so the oldest IDs are no longer received by then.
+const retractMax = 1024
+
+// heralds is the last ID given to an Announcement. IDs are shared by every Manager, so
+// an Announcement posted to every game can be withdrawn by the same ID.
+var heralds uint64
+
+// Tweet is a Tweet shown on the ticker.
+type Tweet struct {
+	Expires  time.Time `json:"expires"`
+	User     string    `json:"user"`
+	UserName string    `json:"user_name"`
+	Text     string    `json:"text"`
+	Channel  string    `json:"channel,omitempty"`
+	ID       uint64    `json:"id,string"`
+}
+
+// Announcement is a message posted by staff to every display of the Manager, shown as
+// a popup window or on the ticker until the Until time.
+type Announcement struct {
+	Until      time.Time `json:"until"`
+	Title      string    `json:"title,omitempty"`
+	Text       string    `json:"text"`
+	ID         uint64    `json:"id"`
+	Ticker     bool      `json:"ticker"`
+	Fullscreen bool      `json:"fullscreen"`
+
+	sent bool
+}
+
+// Tweets returns the Tweets shown on the ticker as of the last update tick.
+func (m *Manager) Tweets() []Tweet {
+	m.lock.Lock()
+	r := make([]Tweet, len(m.shown))
+	copy(r, m.shown)
+	m.lock.Unlock()
+	return r
+}
+
+// Retract removes the Tweet with the supplied ID from the ticker on the next update
+// tick. The Tweet is not shown again if it is received again, such as from the Tweets
+// held while the ticker was paused.
+func (m *Manager) Retract(i uint64) {
+	m.lock.Lock()
+	if m.retracted == nil || len(m.retracted) >= retractMax {
+		m.retracted = make(map[uint64]struct{})
+	}
+	m.retracted[i] = struct{}{}
+	m.lock.Unlock()
+	m.log.Info("Retracting Tweet ID %d from the ticker.", i)
+}
+func (m *Manager) retract(t []tweet) []tweet {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.retracted) == 0 {
+		return t
+	}
+	r := t[:0]
+	for i := range t {
+		if _, ok := m.retracted[t[i].ID]; !ok {
+			r = append(r, t[i])
+		}
+	}
+	return r
+}
+
+// shows keeps a copy of the Tweets on the ticker for the Tweets function.
+func (m *Manager) shows(t []tweet) {
+	v := make([]Tweet, len(t))
+	for i := range t {
+		v[i] = Tweet{
+			ID:       t[i].ID,
+			User:     t[i].User,
+			Text:     t[i].Text,
+			Channel:  t[i].Channel,
+			Expires:  time.Unix(t[i].expire, 0).UTC(),
+			UserName: t[i].UserName,
+		}
+	}
+	m.lock.Lock()
+	m.shown = v
+	m.lock.Unlock()
+}
+
+// Post sends the Announcement to every display of the Manager on the next update tick
+// and returns it with its ID. The Announcement is given a new ID if the ID is zero.
+// Displays that connect while the Announcement is shown are also sent the Announcement.
+func (m *Manager) Post(a Announcement) Announcement {
+	if a.sent = false; a.ID == 0 {
+		a.ID = atomic.AddUint64(&heralds, 1)
+	}
+	m.lock.Lock()
+	m.posts = append(m.posts, a)
+	m.lock.Unlock()
+	m.log.Info("Posting announcement %d until %s.", a.ID, a.Until.Format(time.RFC3339))
+	return a
+}
+
+// Withdraw removes the Announcement with the supplied ID, or every Announcement if the
+// ID is zero, from the displays on the next update tick. This function returns false if
+// the Announcement is not shown.
+func (m *Manager) Withdraw(i uint64) bool {
+	var (
+		n  = time.Now()
+		ok bool
+	)
+	m.lock.Lock()
+	for x := range m.posts {
+		if i == 0 || m.posts[x].ID == i {
+			m.posts[x].Until, ok = n, true
+		}
+	}
+	m.lock.Unlock()
+	return ok
+}
+
+// Announcements returns the Announcements that are shown or waiting to be shown.
+func (m *Manager) Announcements() []Announcement {
+	n := time.Now()
+	m.lock.Lock()
+	r := make([]Announcement, 0, len(m.posts))
+	for _, a := range m.posts {
+		if a.Until.After(n) {
+			r = append(r, a)
+		}
+	}
+	m.lock.Unlock()
+	return r
+}
+func (a *Announcement) update(remove bool) update {
+	u := update{ID: "announce-" + strconv.FormatUint(a.ID, 10), Event: true, Remove: remove}
+	if a.Ticker {
+		u.Value, u.Data = "0", map[string]string{"text": a.Text, "announced": "true", "highlight": "true"}
+		return u
+	}
+	u.Value, u.Data = "1", map[string]string{"title": a.Title, "text": html.EscapeString(a.Text)}
+	if a.Fullscreen {
+		u.Data["fullscreen"] = "true"
+	}
+	return u
+}
+
+// announcements returns the updates of the Announcements that are shown, for new
+// clients.
+func (m *Manager) announcements() []update {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var r []update
+	for i := range m.posts {
+		if m.posts[i].sent {
+			r = append(r, m.posts[i].update(false))
+		}
+	}
+	return r
+}
+
+// herald sends the new Announcements to the clients of every subscription and removes
+// the Announcements that have ended.
+func (m *Manager) herald(x context.Context) {
+	var (
+		n = time.Now()
+		u []update
+	)
+	m.lock.Lock()
+	p := m.posts[:0]
+	for i := range m.posts {
+		if !m.posts[i].Until.After(n) {
+			if m.posts[i].sent {
+				u = append(u, m.posts[i].update(true))
+			}
+			continue
+		}
+		if !m.posts[i].sent {
+			m.posts[i].sent = true
+			u = append(u, m.posts[i].update(false))
+		}
+		p = append(p, m.posts[i])
+	}
+	m.posts = p
+	m.lock.Unlock()
+	if len(u) == 0 {
+		return
+	}
+	for _, s := range m.subs {
+		if s.accept(); s.lag != nil {
+			s.lag.accept()
+			s.lag.send(x, m, u)
+		}
+		s.send(x, m, u)
+	}
+}
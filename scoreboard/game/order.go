@@ -0,0 +1,204 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	byScore  key = 0x0
+	byTime   key = 0x1
+	byUptime key = 0x2
+	byHealth key = 0x3
+	byName   key = 0x4
+	byID     key = 0x5
+)
+
+var defaultOrder = ordering{keys: []sortKey{{k: byScore}}}
+
+type key uint8
+type sortKey struct {
+	k       key
+	reverse bool
+}
+type ordering struct {
+	keys  []sortKey
+	split bool
+}
+
+// Order sets the sort policy used to rank and display the teams of each Game. Teams
+// are compared by each key in order until they differ. Valid keys are "score" (highest
+// first), "time" (earliest last score first), "uptime" (most services up first),
+// "health" (highest first), "name" (alphabetical) and "id" (lowest first). Keys can be
+// prefixed with "-" to reverse their order. Teams that are equal by every key share
+// the same rank, unless split is true, which ranks tied teams in display order.
+func (m *Manager) Order(k []string, split bool) error {
+	if len(k) == 0 && !split {
+		m.order = nil
+		return nil
+	}
+	o := ordering{keys: make([]sortKey, 0, len(k)), split: split}
+	for i := range k {
+		var (
+			v = strings.ToLower(strings.TrimSpace(k[i]))
+			s = sortKey{reverse: strings.HasPrefix(v, "-")}
+		)
+		switch strings.TrimPrefix(v, "-") {
+		case "score":
+			s.k = byScore
+		case "time":
+			s.k = byTime
+		case "uptime":
+			s.k = byUptime
+		case "health":
+			s.k = byHealth
+		case "name":
+			s.k = byName
+		case "id":
+			s.k = byID
+		default:
+			return errors.New(`sort key "` + k[i] + `" is not valid`)
+		}
+		o.keys = append(o.keys, s)
+	}
+	if len(o.keys) == 0 {
+		o.keys = defaultOrder.keys
+	}
+	m.order = &o
+	return nil
+}
+func (t *team) uptime() int64 {
+	var n, u int64
+	for i := range t.Hosts {
+		for x := range t.Hosts[i].Services {
+			if n++; t.Hosts[i].Online && t.Hosts[i].Services[x].State == green {
+				u++
+			}
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return u * 1000 / n
+}
+
+// compare returns a negative number if the team a should be ranked above the team b,
+// a positive number if b should be ranked above a, or zero if the teams are tied.
+func (o *ordering) compare(a, b *team) int {
+	for _, s := range o.keys {
+		var r int
+		switch s.k {
+		case byScore:
+			r = compareInt(b.Score.Total, a.Score.Total)
+		case byTime:
+			r = compareTime(a.scored, b.scored)
+		case byUptime:
+			r = compareInt(b.uptime(), a.uptime())
+		case byHealth:
+			r = compareInt(b.Score.Health, a.Score.Health)
+		case byName:
+			r = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		case byID:
+			r = compareInt(int64(a.ID), int64(b.ID))
+		}
+		if r == 0 {
+			continue
+		}
+		if s.reverse {
+			return -r
+		}
+		return r
+	}
+	return 0
+}
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// scores marks the time that each team in the Game last scored, using the last known
+// state of the Game.
+func (g *game) scores(o *game, t time.Time) {
+	p := make(map[uint64]*team, len(o.Teams))
+	for i := range o.Teams {
+		p[o.Teams[i].ID] = &o.Teams[i]
+	}
+	for i := range g.Teams {
+		v, ok := p[g.Teams[i].ID]
+		if !ok {
+			continue
+		}
+		if g.Teams[i].Score.Total-g.Teams[i].bonus > v.Score.Total-v.bonus {
+			g.Teams[i].scored = t
+		} else {
+			g.Teams[i].scored = v.scored
+		}
+	}
+}
+
+// ranked returns the team indexes of the Game in ranked order and the rank of
+// each team, using the Game sort policy.
+func (g *game) ranked() ([]int, []int64) {
+	o := g.order
+	if o == nil {
+		o = &defaultOrder
+	}
+	v := make([]int, len(g.Teams))
+	for i := range v {
+		v[i] = i
+	}
+	sort.SliceStable(v, func(i, j int) bool {
+		if r := o.compare(&g.Teams[v[i]], &g.Teams[v[j]]); r != 0 {
+			return r < 0
+		}
+		return g.Teams[v[i]].ID < g.Teams[v[j]].ID
+	})
+	r := make([]int64, len(g.Teams))
+	for i := range v {
+		if r[v[i]] = int64(i + 1); i > 0 && !o.split && o.compare(&g.Teams[v[i-1]], &g.Teams[v[i]]) == 0 {
+			r[v[i]] = r[v[i-1]]
+		}
+	}
+	return v, r
+}
+
+// place sets the display position of each team in the Game, using the Game
+// sort policy.
+func (g *game) place() {
+	v, _ := g.ranked()
+	for i := range v {
+		g.Teams[v[i]].place = int64(i + 1)
+	}
+}
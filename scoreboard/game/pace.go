@@ -0,0 +1,120 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import "time"
+
+// Break is a scheduled break in the Games, such as a lunch break, where the Source is
+// not expected to change.
+type Break struct {
+	Start time.Time
+	End   time.Time
+}
+type pace struct {
+	breaks  []Break
+	base    time.Duration
+	final   time.Duration
+	fast    time.Duration
+	slow    time.Duration
+	current time.Duration
+}
+
+// Breaks sets the scheduled breaks used by the adaptive update interval. Breaks that do
+// not have an end time after their start time are ignored.
+func (m *Manager) Breaks(b []Break) {
+	v := make([]Break, 0, len(b))
+	for i := range b {
+		if b[i].End.After(b[i].Start) {
+			v = append(v, b[i])
+		}
+	}
+	m.lock.Lock()
+	m.pace.breaks = v
+	m.lock.Unlock()
+}
+
+// Adapt sets the adaptive update interval, which is driven by the game clocks of the
+// subscribed Games. The time between update ticks is changed to fast while any game
+// clock has less than the final duration remaining, and to slow during a scheduled
+// Break or while every game clock is paused. Durations less than or equal to zero
+// disable that part, which keeps the interval set by Interval.
+func (m *Manager) Adapt(final, fast, slow time.Duration) {
+	m.lock.Lock()
+	m.pace.final, m.pace.fast, m.pace.slow = final, fast, slow
+	m.lock.Unlock()
+	m.adapt(time.Now())
+}
+
+// Interval changes the time between update ticks. Values less than or equal to zero are
+// ignored. The adaptive update interval replaces this value while it is active.
+func (m *Manager) Interval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	m.lock.Lock()
+	m.pace.base = d
+	m.lock.Unlock()
+	m.adapt(time.Now())
+}
+
+// adapt changes the time between update ticks to the adaptive update interval if it
+// has changed since the last tick.
+func (m *Manager) adapt(n time.Time) {
+	m.lock.Lock()
+	d := m.interval(n)
+	if d == m.pace.current {
+		m.lock.Unlock()
+		return
+	}
+	m.pace.current = d
+	m.lock.Unlock()
+	m.tick.Reset(d)
+	m.log.Debug("Changed the update interval to %s.", d.String())
+}
+
+// interval returns the adaptive update interval at the supplied time. This function
+// must be called while holding the lock.
+func (m *Manager) interval(n time.Time) time.Duration {
+	var (
+		p = m.pace
+		c int
+	)
+	for _, v := range m.timers {
+		if !v.Paused.IsZero() {
+			c++
+			continue
+		}
+		if p.fast <= 0 || p.final <= 0 || v.End.IsZero() || !n.Before(v.End) || (!v.Start.IsZero() && n.Before(v.Start)) {
+			continue
+		}
+		if v.End.Sub(n) <= p.final {
+			return p.fast
+		}
+	}
+	if p.slow <= 0 {
+		return p.base
+	}
+	if c > 0 && c == len(m.timers) {
+		return p.slow
+	}
+	for i := range p.breaks {
+		if !n.Before(p.breaks[i].Start) && n.Before(p.breaks[i].End) {
+			return p.slow
+		}
+	}
+	return p.base
+}
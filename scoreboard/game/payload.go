@@ -0,0 +1,52 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// payloadMax is the largest buffer that is returned to the pool, so one very large
+// update does not keep a large buffer in memory after it is sent.
+const payloadMax = 1 << 20
+
+var payloads = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// payload encodes the updates into a buffer from the pool, the same way the websocket
+// WriteJSON function does. The buffer must be given back with release once it has been
+// sent to every client.
+func payload(u []update) (*bytes.Buffer, error) {
+	b := payloads.Get().(*bytes.Buffer)
+	if err := json.NewEncoder(b).Encode(u); err != nil {
+		release(b)
+		return nil, err
+	}
+	return b, nil
+}
+func release(b *bytes.Buffer) {
+	if b.Cap() > payloadMax {
+		return
+	}
+	b.Reset()
+	payloads.Put(b)
+}
@@ -27,6 +27,7 @@ type delta struct {
 type update struct {
 	Value  interface{}       `json:"value,omitempty"`
 	Data   map[string]string `json:"data"`
+	Meta   interface{}       `json:"meta,omitempty"`
 	ID     string            `json:"id"`
 	Name   string            `json:"name,omitempty"`
 	Class  string            `json:"class,omitempty"`
@@ -162,21 +163,52 @@ func (p *planner) DeltaProperty(i, v interface{}, s string) {
 	p.Delta = append(p.Delta, u)
 	p.Create = append(p.Create, u)
 }
-func (p *planner) Event(i uint64, t uint8, d map[string]string) {
-	p.Create = append(p.Create, update{
+func (p *planner) Meta(i interface{}, m map[string]interface{}) {
+	u := update{ID: printStr(i), Meta: m}
+	if len(u.ID) == 0 {
+		u.ID = p.prefix
+	} else if len(p.prefix) > 0 {
+		u.ID = p.prefix + "-" + u.ID
+	}
+	p.Create = append(p.Create, u)
+}
+func (p *planner) DeltaMeta(i interface{}, m map[string]interface{}) {
+	if m == nil {
+		// An empty object is sent so the client clears the metadata, as a nil map
+		// would be left out of the update.
+		m = map[string]interface{}{}
+	}
+	u := update{ID: printStr(i), Meta: m}
+	if len(u.ID) == 0 {
+		u.ID = p.prefix
+	} else if len(p.prefix) > 0 {
+		u.ID = p.prefix + "-" + u.ID
+	}
+	p.Delta = append(p.Delta, u)
+	p.Create = append(p.Create, u)
+}
+func (p *planner) Event(i uint64, t uint8, d map[string]string, m map[string]interface{}) {
+	u := update{
 		ID:    strconv.Itoa(int(i)),
 		Data:  d,
 		Event: true,
 		Value: strconv.Itoa(int(t)),
-	})
+	}
+	if len(m) > 0 {
+		u.Meta = m
+	}
+	p.Create = append(p.Create, u)
 }
-func (p *planner) DeltaEvent(i uint64, t uint8, d map[string]string) {
+func (p *planner) DeltaEvent(i uint64, t uint8, d map[string]string, m map[string]interface{}) {
 	u := update{
 		ID:    strconv.FormatUint(i, 10),
 		Data:  d,
 		Event: true,
 		Value: strconv.FormatUint(uint64(t), 10),
 	}
+	if len(m) > 0 {
+		u.Meta = m
+	}
 	p.Delta = append(p.Delta, u)
 	p.Create = append(p.Create, u)
 }
@@ -0,0 +1,110 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+)
+
+// The WebSocket protocol versions. Pages cached by kiosk browsers can be older than
+// the Scoreboard, so every version down to ProtocolLegacy is still sent.
+const (
+	// ProtocolLegacy is the first protocol, where each message is a JSON array of the
+	// updates. Clients that do not ask for a version use this protocol.
+	ProtocolLegacy = 1
+	// Protocol is the current protocol, where each message is a JSON object with the
+	// protocol version, sequence number and the updates, so values can be added to
+	// messages without breaking the pages that do not know them.
+	Protocol = 2
+)
+
+// Subprotocols is the WebSocket subprotocol of each protocol version, newest first,
+// for the Upgrader. Browsers fail to connect if they ask for a subprotocol that the
+// server does not answer, so pages ask for the version in the Hello message instead.
+var Subprotocols = []string{"scoreboard.v2", "scoreboard.v1"}
+
+// envelope is the start of every message of the current protocol, before the sequence
+// number. The encoded updates are written after it, so the updates are still only
+// encoded once for every client.
+var envelope = []byte(`{"version":2,"seq":`)
+
+type hello struct {
+	Slice   slice
+	Game    uint64
+	Version int
+}
+
+func (h *hello) UnmarshalJSON(b []byte) error {
+	var m struct {
+		Game     *uint64 `json:"game"`
+		Division string  `json:"division"`
+		Version  int     `json:"version"`
+		Team     uint64  `json:"team"`
+		Top      int64   `json:"top"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	if m.Game == nil {
+		return errMissingGame
+	}
+	if h.Game, h.Version = *m.Game, m.Version; len(m.Division) <= sliceDivision {
+		h.Slice.Division = m.Division
+	}
+	h.Slice.Team, h.Slice.Top = m.Team, m.Top
+	return nil
+}
+
+// protocol returns the protocol version used with the client. The subprotocol picked
+// when the WebSocket was opened is used first, then the version in the Hello message.
+// Clients that ask for a newer version than the Scoreboard knows get the current one,
+// and read the version from each message.
+func (h hello) protocol(n *websocket.Conn) int {
+	switch n.Subprotocol() {
+	case "scoreboard.v1":
+		return ProtocolLegacy
+	case "scoreboard.v2":
+		return Protocol
+	}
+	if h.Version >= Protocol {
+		return Protocol
+	}
+	return ProtocolLegacy
+}
+
+// frame writes the encoded updates to the client as one message of its protocol, with
+// the sequence number of the message. Legacy messages do not have sequence numbers.
+func (c *stream) frame(b []byte, q uint64) (int, error) {
+	if c.version < Protocol {
+		return len(b), c.WriteMessage(websocket.TextMessage, b)
+	}
+	w, err := c.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return 0, err
+	}
+	h := append(strconv.AppendUint(append(make([]byte, 0, len(envelope)+32), envelope...), q, 10), `,"updates":`...)
+	w.Write(h)
+	w.Write(b)
+	if _, err = w.Write([]byte{'}'}); err != nil {
+		w.Close()
+		return 0, err
+	}
+	return len(h) + len(b) + 1, w.Close()
+}
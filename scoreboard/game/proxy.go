@@ -0,0 +1,114 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type bypass struct {
+	host string
+	net  *net.IPNet
+	port string
+}
+
+// Proxy returns a Proxy function for a http.Transport that sends every request through
+// the supplied proxy URL, except for requests to hosts that match the NO_PROXY style
+// comma separated list n. The proxy scheme may be "http", "https" or "socks5" and the
+// URL may have a username and password for the proxy. An empty URL uses the proxy
+// environment variables instead, which include their own NO_PROXY list.
+func Proxy(u, n string) (func(*http.Request) (*url.URL, error), error) {
+	if len(u) == 0 {
+		return http.ProxyFromEnvironment, nil
+	}
+	p, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.New(`proxy "` + u + `" is not a valid URL: ` + err.Error())
+	}
+	switch p.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.New(`proxy scheme "` + p.Scheme + `" is not supported`)
+	}
+	if len(p.Host) == 0 {
+		return nil, errors.New(`proxy "` + u + `" does not have a host`)
+	}
+	var b []bypass
+	for _, v := range strings.Split(n, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); len(v) == 0 {
+			continue
+		}
+		if v == "*" {
+			return func(_ *http.Request) (*url.URL, error) { return nil, nil }, nil
+		}
+		if _, x, err := net.ParseCIDR(v); err == nil {
+			b = append(b, bypass{net: x})
+			continue
+		}
+		var e bypass
+		if h, o, err := net.SplitHostPort(v); err == nil {
+			e.host, e.port = h, o
+		} else {
+			e.host = v
+		}
+		e.host = strings.TrimPrefix(strings.Trim(e.host, "[]"), "*")
+		b = append(b, e)
+	}
+	return func(r *http.Request) (*url.URL, error) {
+		h, o := strings.ToLower(r.URL.Hostname()), r.URL.Port()
+		if len(o) == 0 {
+			if o = "80"; r.URL.Scheme == "https" {
+				o = "443"
+			}
+		}
+		i := net.ParseIP(h)
+		for _, e := range b {
+			if e.net != nil {
+				if i != nil && e.net.Contains(i) {
+					return nil, nil
+				}
+				continue
+			}
+			if len(e.port) > 0 && e.port != o {
+				continue
+			}
+			// Entries match the host and any subdomain of the host, with or without
+			// a leading dot, the same as the NO_PROXY environment variable.
+			if d := strings.TrimPrefix(e.host, "."); h == d || strings.HasSuffix(h, "."+d) {
+				return nil, nil
+			}
+		}
+		return p, nil
+	}, nil
+}
+
+// Proxy sets the proxy used for every request made by the Source, using the same
+// values as the Proxy function. An empty URL uses the proxy environment variables.
+func (m *Manager) Proxy(u, n string) error {
+	p, err := Proxy(u, n)
+	if err != nil {
+		return err
+	}
+	if t, ok := m.client.Transport.(*http.Transport); ok {
+		t.Proxy = p
+	}
+	return nil
+}
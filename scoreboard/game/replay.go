@@ -0,0 +1,251 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Record is a single recorded score sample or event that is played back during a
+// Replay. Score samples have an empty Kind.
+type Record struct {
+	Time  time.Time
+	Kind  string
+	Text  string
+	Team  uint64
+	Score int64
+}
+
+// Recording is an interface that supplies the recorded history of a Game to a Replay.
+type Recording interface {
+	// Span returns the time of the first and last Records of the Game.
+	Span(context.Context, uint64) (time.Time, time.Time, error)
+	// Records returns all Records of the Game after the first time and up to (and
+	// including) the second time, in time order.
+	Records(context.Context, uint64, time.Time, time.Time) ([]Record, error)
+}
+
+// Playback is the status of a running Replay.
+type Playback struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Position time.Time `json:"position"`
+	Game     uint64    `json:"game"`
+	Speed    float64   `json:"speed"`
+	Paused   bool      `json:"paused"`
+}
+type replay struct {
+	wall   time.Time
+	rec    Recording
+	scores map[uint64]int64
+	scored map[uint64]time.Time
+	feed   []event
+	read   time.Time
+	Playback
+	sync.Mutex
+	reset bool
+	lag   bool
+}
+
+// Replay starts playing back the recorded history of the Game with the supplied ID at
+// the supplied speed, which is the number of recorded seconds shown each second. Live
+// updates for the Game are paused until the Replay is stopped. The Game will be
+// subscribed during the next update if it was not already.
+func (m *Manager) Replay(x context.Context, i uint64, r Recording, speed float64) error {
+	if speed <= 0 {
+		return errors.New("replay speed must be greater than zero")
+	}
+	s, e, err := r.Span(x, i)
+	if err != nil {
+		return err
+	}
+	if s.IsZero() || !e.After(s) {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " does not have any recorded history")
+	}
+	v := &replay{
+		rec:      r,
+		wall:     time.Now(),
+		reset:    true,
+		Playback: Playback{Game: i, Start: s, End: e, Position: s, Speed: speed},
+	}
+	m.lock.Lock()
+	if m.replays == nil {
+		m.replays = make(map[uint64]*replay)
+	}
+	m.replays[i] = v
+	m.lock.Unlock()
+	m.log.Info("Started replay of Game %d (%s to %s) at %.1fx speed.", i, s.Format(time.RFC3339), e.Format(time.RFC3339), speed)
+	return nil
+}
+
+// Seek moves the running Replay of the Game with the supplied ID to the supplied time.
+func (m *Manager) Seek(i uint64, t time.Time) error {
+	r := m.replay(i)
+	if r == nil {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " is not being replayed")
+	}
+	r.Lock()
+	if t.Before(r.Start) {
+		t = r.Start
+	} else if t.After(r.End) {
+		t = r.End
+	}
+	r.Position, r.wall, r.reset = t, time.Now(), true
+	r.Unlock()
+	return nil
+}
+
+// Stop ends the running Replay of the Game with the supplied ID and resumes live updates.
+func (m *Manager) Stop(i uint64) error {
+	m.lock.Lock()
+	_, ok := m.replays[i]
+	delete(m.replays, i)
+	m.lock.Unlock()
+	if !ok {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " is not being replayed")
+	}
+	m.log.Info("Stopped replay of Game %d.", i)
+	return nil
+}
+
+// Pause will pause or resume the running Replay of the Game with the supplied ID. The
+// speed of the Replay is also changed if the supplied speed is greater than zero.
+func (m *Manager) Pause(i uint64, p bool, speed float64) error {
+	r := m.replay(i)
+	if r == nil {
+		return errors.New("game " + strconv.FormatUint(i, 10) + " is not being replayed")
+	}
+	r.Lock()
+	r.advance(time.Now())
+	if r.Paused = p; speed > 0 {
+		r.Speed = speed
+	}
+	r.Unlock()
+	return nil
+}
+
+// Replays returns the status of all running Replays.
+func (m *Manager) Replays() []Playback {
+	m.lock.Lock()
+	o := make([]Playback, 0, len(m.replays))
+	for _, r := range m.replays {
+		r.Lock()
+		r.advance(time.Now())
+		o = append(o, r.Playback)
+		r.Unlock()
+	}
+	m.lock.Unlock()
+	return o
+}
+func (r *replay) advance(n time.Time) {
+	if !r.Paused {
+		r.Position = r.Position.Add(time.Duration(float64(n.Sub(r.wall)) * r.Speed))
+	}
+	if r.wall = n; !r.Position.Before(r.End) {
+		r.Position, r.Paused = r.End, true
+	}
+}
+func (m *Manager) replay(i uint64) *replay {
+	m.lock.Lock()
+	r := m.replays[i]
+	m.lock.Unlock()
+	return r
+}
+func (r *replay) frame(t *game, z bool) game {
+	g := *t
+	g.hash, g.Teams = 0, make([]team, len(t.Teams))
+	for i := range t.Teams {
+		g.Teams[i] = t.Teams[i]
+		g.Teams[i].Score.Total, g.Teams[i].Score.hash = r.scores[g.Teams[i].ID], 0
+		g.Teams[i].scored = r.scored[g.Teams[i].ID]
+	}
+	if !r.lag {
+		g.Message = "Replay: " + r.read.In(time.UTC).Format("Jan 2 15:04:05") + " UTC"
+	}
+	if z && !r.lag {
+		g.Message += " (Paused)"
+	}
+	g.Events = events{Current: r.feed}
+	g.digest()
+	return g
+}
+
+// play sends the Records of the Replay up to the current position to the clients of
+// the subscription, using the supplied Game for everything but the scores and events.
+func (s *subscription) play(x context.Context, m *Manager, r *replay, l *game) {
+	r.Lock()
+	r.advance(time.Now())
+	var (
+		t = r.read
+		p = r.Position
+		z = r.Paused
+		w = r.reset
+	)
+	if w {
+		t, r.reset = r.Start.Add(-time.Millisecond), false
+		r.scores, r.scored, r.feed = make(map[uint64]int64), make(map[uint64]time.Time), nil
+	}
+	r.Unlock()
+	v, err := r.rec.Records(x, s.ID, t, p)
+	if err != nil {
+		m.log.Error("Error reading recorded history for Game %d: %s!", s.ID, err.Error())
+		return
+	}
+	var c []update
+	for i := range v {
+		if len(v[i].Kind) == 0 {
+			if v[i].Score > r.scores[v[i].Team] {
+				r.scored[v[i].Team] = v[i].Time
+			}
+			r.scores[v[i].Team] = v[i].Score
+			continue
+		}
+		k, ok := ParseKind(v[i].Kind)
+		h := Change{Time: v[i].Time, Text: v[i].Text, Kind: k, GameID: s.ID, TeamID: v[i].Team}
+		e := record(h)
+		if !ok {
+			delete(e.Data, "kind")
+			delete(e.Data, "team")
+		} else {
+			u := item(e)
+			m.effect(k, &u)
+			if c = append(c, u); k == ScoreIncrease {
+				continue
+			}
+		}
+		r.feed = append(r.feed, e)
+	}
+	r.feed = m.trim(r.feed)
+	if r.read = p; w {
+		// Don't highlight every change read when catching up to the position.
+		c = nil
+	}
+	g := r.frame(l, z)
+	if s.behind != nil {
+		g, c = m.mask(&g, c)
+	}
+	u, d := g.Delta(m.assets, &s.last)
+	s.cache, s.last, s.resync = u, g, true
+	s.send(x, m, append(d, c...))
+	if s.lag != nil && s.lag.behind == nil {
+		s.lag.mirror(x, m, &g, c)
+	}
+}
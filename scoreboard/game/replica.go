@@ -0,0 +1,154 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// replicas are the connections of the read-only replicas of a Manager. Each replica
+// is sent the full state when it connects and then only the Games that changed after
+// each update.
+type replicas struct {
+	new     chan *websocket.Conn
+	sent    map[uint64]uint64
+	clients []*websocket.Conn
+}
+
+// Replica adds the supplied connection as a read-only replica. The replica is sent the
+// state of every subscribed Game after the next update, then the Games that changed
+// after every update. Each message is a binary message that is passed to Apply by
+// the replica. The leader of a cluster keeps every active Game subscribed, so Managers
+// with replicas should be the leader or not use a cluster.
+func (m *Manager) Replica(n *websocket.Conn) {
+	m.lock.Lock()
+	if m.mirrors == nil {
+		m.mirrors = &replicas{new: make(chan *websocket.Conn, 16), sent: make(map[uint64]uint64)}
+	}
+	r := m.mirrors
+	m.lock.Unlock()
+	select {
+	case r.new <- n:
+		m.log.Debug(`Added replica "%s", sending state on the next update.`, n.RemoteAddr().String())
+	default:
+		m.log.Warning(`Too many replicas are waiting to be added, closing "%s"!`, n.RemoteAddr().String())
+		n.Close()
+	}
+}
+
+// Apply queues the state sent by the primary Manager, which is shown on the next update
+// tick. Managers that apply the state of a primary should use a Leader function that
+// returns false, so the Source is not polled.
+func (m *Manager) Apply(b []byte) error {
+	c, err := decode(b)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	// Only the changed Games are sent, so the Games of a state that was not shown
+	// yet are kept if they are not in the new state.
+	if m.inbound != nil {
+		for _, v := range m.inbound.Subs {
+			if !c.has(v.ID) {
+				c.Subs = append(c.Subs, v)
+			}
+		}
+	}
+	m.inbound = &c
+	m.lock.Unlock()
+	return nil
+}
+func (c checkpoint) has(i uint64) bool {
+	for _, v := range c.Subs {
+		if v.ID == i {
+			return true
+		}
+	}
+	return false
+}
+
+// replicate sends the state of the Games that changed during the update to every
+// replica and the state of every Game to new replicas. The state is sent after every
+// update, even if no Game changed, so the replicas receive the clocks and the list of
+// Games.
+func (m *Manager) replicate() {
+	m.lock.Lock()
+	r := m.mirrors
+	if m.lock.Unlock(); r == nil {
+		return
+	}
+	var j []*websocket.Conn
+	for len(r.new) > 0 {
+		j = append(j, <-r.new)
+	}
+	if len(j) == 0 && len(r.clients) == 0 {
+		return
+	}
+	var (
+		b bytes.Buffer
+		d = checkpoint{Time: time.Now().UTC(), Games: m.Games, Clocks: m.saveClocks(), Version: stateVersion}
+		a = d
+	)
+	for _, s := range m.subs {
+		v := saved{ID: s.ID, Last: s.last, Feed: s.feed}
+		// Replicas are sent the Game shown to the clients, so the standings of a frozen
+		// Game are not shown by the replicas.
+		if s.shown != nil {
+			v.Last = *s.shown
+		}
+		if b.Reset(); gob.NewEncoder(&b).Encode(&v) != nil {
+			continue
+		}
+		a.Subs = append(a.Subs, v)
+		if h := updateFnv(fnvStart, b.Bytes()); r.sent[s.ID] != h {
+			r.sent[s.ID] = h
+			d.Subs = append(d.Subs, v)
+		}
+	}
+	if len(r.clients) > 0 {
+		r.clients = m.push(r.clients, &d)
+	}
+	if len(j) > 0 {
+		r.clients = append(r.clients, m.push(j, &a)...)
+	}
+	m.log.Trace("Sent %d changed Games to %d replicas.", len(d.Subs), len(r.clients))
+}
+
+// push sends the state to each connection and returns the connections that did not
+// fail, the failed connections are closed.
+func (m *Manager) push(c []*websocket.Conn, v *checkpoint) []*websocket.Conn {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		m.log.Error("Unable to encode replica state: %s!", err.Error())
+		return c
+	}
+	r := c[:0]
+	for i := range c {
+		c[i].SetWriteDeadline(time.Now().Add(m.timeout))
+		if err := c[i].WriteMessage(websocket.BinaryMessage, b.Bytes()); err != nil {
+			m.log.Warning(`Removing replica "%s" after an error: %s!`, c[i].RemoteAddr().String(), err.Error())
+			c[i].Close()
+			continue
+		}
+		r = append(r, c[i])
+	}
+	return r
+}
@@ -0,0 +1,193 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errNotModified is returned by Sources (along with the last valid data) when the
+// upstream scoring engine reports that nothing has changed since the last request.
+var errNotModified = errors.New("not modified")
+
+type validator struct {
+	etag     string
+	modified string
+	body     []byte
+}
+type statusError struct {
+	s string
+}
+type conditional struct {
+	e map[string]*validator
+	sync.Mutex
+}
+
+func (e statusError) Error() string {
+	return e.s
+}
+func (c *conditional) get(u string) *validator {
+	c.Lock()
+	v := c.e[u]
+	c.Unlock()
+	return v
+}
+func (c *conditional) set(u string, v *validator) {
+	c.Lock()
+	if c.e == nil {
+		c.e = make(map[string]*validator)
+	}
+	c.e[u] = v
+	c.Unlock()
+}
+
+func (m *Manager) parallel(n int, f func(int)) {
+	if n <= 0 {
+		return
+	}
+	w := int(m.workers)
+	if w <= 0 || w > n {
+		w = n
+	}
+	if w == 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	var (
+		g sync.WaitGroup
+		c = make(chan int)
+	)
+	g.Add(w)
+	for i := 0; i < w; i++ {
+		go func() {
+			for v := range c {
+				f(v)
+			}
+			g.Done()
+		}()
+	}
+	for i := 0; i < n; i++ {
+		c <- i
+	}
+	close(c)
+	g.Wait()
+}
+
+// Workers sets the maximum number of requests that can be made to the Source at the same
+// time during an update tick. Values less than or equal to zero are ignored.
+func (m *Manager) Workers(n int) {
+	if n > 0 {
+		m.workers = uint32(n)
+	}
+}
+
+// request will issue a GET request to the supplied URL with any of the supplied
+// headers. If the URL was requested before and the server returned an ETag or
+// Last-Modified header, the request is made conditional. When the server responds
+// with a 304, the last response body is returned along with errNotModified. Failed
+// requests that can be retried are sent again, up to the attempts of the breaker.
+func (m *Manager) request(x context.Context, u string, h map[string]string) ([]byte, error) {
+	var (
+		b   []byte
+		c   int
+		err error
+	)
+	for i := uint32(0); i < m.breaker.attempts; i++ {
+		if i > 0 {
+			m.log.Debug(`Retrying request "%s" (attempt %d of %d)..`, u, i+1, m.breaker.attempts)
+			if !wait(x, i-1) {
+				break
+			}
+		}
+		if b, c, err = m.attempt(x, u, h); err == nil || !retry(c, err) {
+			break
+		}
+	}
+	return b, err
+}
+func (m *Manager) attempt(x context.Context, u string, h map[string]string) ([]byte, int, error) {
+	if m.tape != nil && m.tape.takes != nil {
+		return m.tape.play(m, u)
+	}
+	if err := m.inject(x, u); err != nil {
+		return nil, 0, err
+	}
+	b, c, err := m.call(x, u, h)
+	// Canceled requests are not recorded, as they are not a response of the Source.
+	if m.tape != nil && err != errNotModified && x.Err() == nil {
+		m.tape.record(m, u, b, c, err)
+	}
+	if err == nil {
+		b = m.mangle(u, b)
+	}
+	return b, c, err
+}
+func (m *Manager) call(x context.Context, u string, h map[string]string) ([]byte, int, error) {
+	c, f := context.WithTimeout(x, m.timeout)
+	defer f()
+	r, err := http.NewRequestWithContext(c, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k, v := range h {
+		r.Header.Set(k, v)
+	}
+	propagate(x, r)
+	v, n := m.cache.get(u), time.Now()
+	if v != nil {
+		if len(v.etag) > 0 {
+			r.Header.Set("If-None-Match", v.etag)
+		}
+		if len(v.modified) > 0 {
+			r.Header.Set("If-Modified-Since", v.modified)
+		}
+	}
+	o, err := m.client.Do(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	m.gauge(n, time.Now(), o.Header)
+	if o.Body == nil {
+		return nil, o.StatusCode, errors.New(`request "` + u + `" returned an empty body`)
+	}
+	defer o.Body.Close()
+	if o.StatusCode == http.StatusNotModified && v != nil {
+		m.log.Trace(`Request "%s" was not modified, using cached response.`, u)
+		return v.body, o.StatusCode, errNotModified
+	}
+	if o.StatusCode >= 400 {
+		return nil, o.StatusCode, &statusError{s: `request "` + u + `" returned status code ` + strconv.Itoa(o.StatusCode)}
+	}
+	b, err := io.ReadAll(o.Body)
+	if err != nil {
+		return nil, o.StatusCode, errors.New(`error reading from the URL "` + u + `": ` + err.Error())
+	}
+	if e, l := o.Header.Get("ETag"), o.Header.Get("Last-Modified"); len(e) > 0 || len(l) > 0 {
+		m.cache.set(u, &validator{etag: e, modified: l, body: b})
+	} else if v != nil {
+		m.cache.set(u, nil)
+	}
+	return b, o.StatusCode, nil
+}
@@ -0,0 +1,143 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sanitize returns the Tweet text as plain text. Twitter sends text with HTML entities,
+// which are decoded, and any HTML tags left after that are removed, so the text is the
+// same on every display and cannot add markup if it is ever used as HTML. Control and
+// direction override characters are removed, line breaks are limited to one empty line,
+// and the text is cut to the max amount of characters, if not zero, without splitting
+// an emoji or accented letter.
+func sanitize(s string, max int) string {
+	var (
+		b strings.Builder
+		v = html.UnescapeString(s)
+		n int
+	)
+	b.Grow(len(v))
+	for i := 0; i < len(v); {
+		r, w := utf8.DecodeRuneInString(v[i:])
+		if r == '<' && i+1 < len(v) && tag(v[i+1]) {
+			if e := strings.IndexByte(v[i:], '>'); e > 0 {
+				i += e + 1
+				continue
+			}
+		}
+		i += w
+		switch {
+		case r == utf8.RuneError && w == 1:
+			continue
+		case r == '\r':
+			if i < len(v) && v[i] == '\n' {
+				continue
+			}
+			r = '\n'
+		case r == '\t':
+			r = ' '
+		}
+		if r == '\n' {
+			if n++; n > 2 {
+				continue
+			}
+		} else if n = 0; hidden(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return truncate(strings.TrimSpace(b.String()), max)
+}
+
+// link returns the URL if it is a HTTPS URL that is safe to use in a quoted CSS url value,
+// or an empty string if it is not.
+func link(s string) string {
+	if !strings.HasPrefix(s, "https://") {
+		return ""
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c <= ' ', c == 0x7F, c == '\'', c == '"', c == '(', c == ')', c == '\\', c == '<', c == '>':
+			return ""
+		}
+	}
+	return s
+}
+func tag(c byte) bool {
+	return c == '/' || c == '!' || c == '?' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// hidden returns true for control characters and the characters that change the text
+// direction, which can be used to make text show differently than it reads.
+func hidden(r rune) bool {
+	switch {
+	case r == '\n':
+		return false
+	case unicode.IsControl(r):
+		return true
+	case r >= 0x202A && r <= 0x202E, r >= 0x2066 && r <= 0x2069, r == 0x200E, r == 0x200F:
+		return true
+	}
+	return false
+}
+
+// joined returns true if the rune is part of the character before it, such as accents,
+// emoji skin tones and variation selectors, or if the rune before it was a zero width
+// joiner.
+func joined(r, p rune) bool {
+	switch {
+	case p == 0x200D, r == 0x200D:
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// truncate cuts the text after the max amount of characters, if not zero, and adds
+// an ellipsis. Characters made of more than one rune, such as flags and emoji with
+// skin tones, are counted once and are not split.
+func truncate(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	var (
+		n    int
+		p    rune
+		flag bool
+	)
+	for i, r := range s {
+		switch {
+		case i > 0 && joined(r, p):
+		case r >= 0x1F1E6 && r <= 0x1F1FF && flag:
+			// Flags are two regional indicator letters.
+			flag = false
+		default:
+			if n++; n > max {
+				return strings.TrimSpace(s[:i]) + "…"
+			}
+			flag = r >= 0x1F1E6 && r <= 0x1F1FF
+		}
+		p = r
+	}
+	return s
+}
@@ -0,0 +1,243 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lane classes that a Lane can be set for, instead of a Game ID.
+const (
+	LaneAttackDefense = "attack_defense"
+	LaneJeopardy      = "jeopardy"
+)
+
+var errPanic = errors.New("source fetch stopped by a panic")
+
+// Lane is the schedule of the Games fetched from the Source. Interval is the least time
+// between fetches of the Game, which is rounded up to the update tick, Deadline is the
+// most time a fetch can take before it is cancelled and Priority orders the fetches when
+// every worker is busy, higher first. Zero values fetch the Game every tick, with the
+// update timeout as the deadline.
+type Lane struct {
+	Interval time.Duration
+	Deadline time.Duration
+	Priority int
+}
+
+// pull is the result of a fetch, which is made outside of the update thread so a slow
+// Game does not hold up the other Games. The update thread takes the result from the
+// subscription and compares it, as it owns the subscription.
+type pull struct {
+	err error
+	g   game
+	// reused is true if the Game was not fetched, as it is not due yet, so the
+	// subscription is not counted as fresh.
+	reused bool
+}
+
+// Lanes sets the schedules of the Games, by Game ID or by the "attack_defense" and
+// "jeopardy" classes of the Game mode. A Game ID replaces the class of the Game.
+func (m *Manager) Lanes(l map[string]Lane) {
+	m.lock.Lock()
+	m.lanes = l
+	m.lock.Unlock()
+}
+
+// lane returns the Lane of the Game. This function must be called while holding the
+// lock.
+func (m *Manager) lane(g meta) Lane {
+	if len(m.lanes) == 0 {
+		return Lane{}
+	}
+	if v, ok := m.lanes[strconv.FormatUint(g.ID, 10)]; ok {
+		return v
+	}
+	if g.Mode == jeopardy {
+		return m.lanes[LaneJeopardy]
+	}
+	return m.lanes[LaneAttackDefense]
+}
+
+// group runs the comparisons of the fetched Games, each in its own thread, and waits
+// for them before the update continues.
+type group struct {
+	sync.WaitGroup
+}
+
+func (g *group) run(x context.Context, m *Manager, s *subscription, w bool, v pull) {
+	g.Add(1)
+	go func() {
+		defer g.Done()
+		s.update(x, m, w, v)
+	}()
+}
+
+// dispatch runs an update of each subscription. The Games that are due are fetched
+// in the background, by Priority, and each is compared as soon as it is read. The
+// update waits up to half of the tick for the fetches, and a fetch that takes longer is
+// compared on a later tick, so the other Games are not held up by it.
+func (m *Manager) dispatch(x context.Context, u []*subscription) {
+	w := make([]bool, len(u))
+	m.parallel(len(u), func(i int) {
+		select {
+		case <-x.Done():
+			return
+		default:
+		}
+		w[i] = u[i].prepare(x, m)
+	})
+	var (
+		n = time.Now()
+		q []int
+		g group
+	)
+	for i, s := range u {
+		select {
+		case <-x.Done():
+			return
+		default:
+		}
+		if len(s.pulled) > 0 {
+			s.busy = false
+			g.run(x, m, s, w[i], <-s.pulled)
+			continue
+		}
+		if s.busy {
+			continue
+		}
+		if m.Locked(s.ID) && s.fetched {
+			// The last Game from the Source is used again while the Game is locked, so
+			// late data from the Source does not change the final standings.
+			v := pull{g: s.last, err: errNotModified}
+			v.g.Events.Current = s.upstream
+			g.run(x, m, s, w[i], v)
+			continue
+		}
+		if n.Before(s.due) {
+			// The last Game is compared again, which is skipped unless the clock,
+			// Tweets or notices have changed since.
+			v := pull{g: s.last, err: errNotModified, reused: true}
+			v.g.Events.Current = s.upstream
+			g.run(x, m, s, w[i], v)
+			continue
+		}
+		q = append(q, i)
+	}
+	m.lock.Lock()
+	var (
+		l = make([]Lane, len(u))
+		h = m.pace.current / 2
+	)
+	for _, i := range q {
+		l[i] = m.lane(u[i].last.Meta)
+	}
+	m.lock.Unlock()
+	sort.SliceStable(q, func(i, j int) bool {
+		if l[q[i]].Priority == l[q[j]].Priority {
+			return u[q[i]].due.Before(u[q[j]].due)
+		}
+		return l[q[i]].Priority > l[q[j]].Priority
+	})
+	if m.gate == nil || cap(m.gate) != int(m.workers) {
+		m.gate = make(chan struct{}, m.workers)
+	}
+	var o []int
+	for _, i := range q {
+		select {
+		case m.gate <- struct{}{}:
+		default:
+			m.log.Debug("Every worker is busy, fetching Game %d on a later tick.", u[i].ID)
+			continue
+		}
+		u[i].busy, u[i].due = true, n.Add(l[i].Interval)
+		m.background(x, u[i], l[i], m.gate)
+		o = append(o, i)
+	}
+	t := time.NewTimer(h)
+	defer t.Stop()
+	for len(o) > 0 {
+		r := o[:0]
+		for _, i := range o {
+			if len(u[i].pulled) == 0 {
+				r = append(r, i)
+				continue
+			}
+			u[i].busy = false
+			g.run(x, m, u[i], w[i], <-u[i].pulled)
+		}
+		if o = r; len(o) == 0 {
+			break
+		}
+		select {
+		case <-m.ready:
+		case <-t.C:
+			for _, i := range o {
+				m.log.Debug("Game %d is still being fetched, comparing it on a later tick.", u[i].ID)
+			}
+			o = nil
+		case <-x.Done():
+			o = nil
+		}
+	}
+	g.Wait()
+}
+
+// background fetches the Game of the subscription in the background and sends the result to
+// the subscription. The fetch is not stopped when the update ends, only when the Lane
+// deadline passes or the Manager is stopped.
+func (m *Manager) background(x context.Context, s *subscription, l Lane, c chan struct{}) {
+	if s.pulled == nil {
+		s.pulled = make(chan pull, 1)
+	}
+	d := l.Deadline
+	if d <= 0 {
+		d = m.timeout
+	}
+	r := m.root
+	if r == nil {
+		r = context.Background()
+	}
+	if v := x.Value(spanKey{}); v != nil {
+		r = context.WithValue(r, spanKey{}, v)
+	}
+	y, f := context.WithTimeout(r, d)
+	go func(i uint64, o chan<- pull) {
+		var v pull
+		defer func() {
+			if err := recover(); err != nil {
+				m.recovered("source fetch", err)
+				v = pull{err: errPanic}
+			}
+			if f(); y.Err() == context.DeadlineExceeded && v.err != nil && v.err != errNotModified {
+				m.log.Warning("Fetching Game %d ran over the deadline of %s!", i, d.String())
+			}
+			<-c
+			o <- v
+			select {
+			case m.ready <- struct{}{}:
+			default:
+			}
+		}()
+		v.err = m.fetch(y, i, &v.g)
+	}(s.ID, s.pulled)
+}
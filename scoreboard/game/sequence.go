@@ -0,0 +1,113 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// droppedMax is the most IDs of duplicate events kept, so their removals are dropped
+// too. The IDs are cleared once full, as duplicate events are rare.
+const droppedMax = 256
+
+// Every message sent to the clients of a subscription has the sequence number of the
+// subscription, which goes up by one with every message sent to all of its clients.
+// Messages sent to a single client, such as the board sent after connecting or a
+// display command, have the sequence number of the last message sent to all clients,
+// so a client that gets a number more than one higher than the last one it read has
+// missed updates, and must load the board again.
+
+// sequence returns the sequence number of the last message sent to the client.
+func (c *stream) sequence() uint64 {
+	if c.seq == nil {
+		return 0
+	}
+	return atomic.LoadUint64(c.seq)
+}
+
+// fingerprint returns the value and data of the event, which is the same for events
+// with the same content and different IDs.
+func (u *update) fingerprint() string {
+	k := make([]string, 0, len(u.Data))
+	for n := range u.Data {
+		k = append(k, n)
+	}
+	sort.Strings(k)
+	var b strings.Builder
+	b.WriteString(u.Class)
+	b.WriteByte(0)
+	if v, ok := u.Value.(string); ok {
+		b.WriteString(v)
+	}
+	for _, n := range k {
+		b.WriteByte(0)
+		b.WriteString(n)
+		b.WriteByte('=')
+		b.WriteString(u.Data[n])
+	}
+	return b.String()
+}
+
+// dedupe returns the updates without the events that are the same as the last event
+// sent to the clients, such as a first blood that the source sent twice with different
+// IDs, so the displays do not show the same banner twice. The removals of the dropped
+// events are dropped too. The updates are only copied if any are dropped.
+func (s *subscription) dedupe(u []update) []update {
+	var r []update
+	for i := range u {
+		if s.duplicate(&u[i]) {
+			if r == nil {
+				r = append(make([]update, 0, len(u)), u[:i]...)
+			}
+			continue
+		}
+		if r != nil {
+			r = append(r, u[i])
+		}
+	}
+	if r == nil {
+		return u
+	}
+	return r
+}
+func (s *subscription) duplicate(u *update) bool {
+	if !u.Event {
+		return false
+	}
+	if u.Remove {
+		if _, ok := s.dropped[u.ID]; ok {
+			delete(s.dropped, u.ID)
+			return true
+		}
+		if u.ID == s.echoed {
+			s.echo, s.echoed = "", ""
+		}
+		return false
+	}
+	f := u.fingerprint()
+	if f == s.echo && u.ID != s.echoed {
+		if s.dropped == nil || len(s.dropped) >= droppedMax {
+			s.dropped = make(map[string]struct{})
+		}
+		s.dropped[u.ID] = struct{}{}
+		return true
+	}
+	s.echo, s.echoed = f, u.ID
+	return false
+}
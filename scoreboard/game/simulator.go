@@ -0,0 +1,328 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	simEvents = 10
+	simTweets = 3
+)
+
+var (
+	simNames = [...]string{
+		"Alpha", "Bravo", "Charlie", "Delta", "Echo", "Foxtrot", "Golf", "Hotel", "India", "Juliett", "Kilo", "Lima",
+		"Mike", "November", "Oscar", "Papa", "Quebec", "Romeo", "Sierra", "Tango", "Uniform", "Victor", "Whiskey", "Yankee",
+	}
+	simColors = [...]string{
+		"#e03c31", "#3e922e", "#2f6fdf", "#f0a020", "#8e44ad", "#16a085", "#d35400", "#c0392b", "#2980b9", "#27ae60",
+		"#f39c12", "#7f8c8d",
+	}
+	simHosts = [...]string{"web", "mail", "db", "dc", "files", "vpn", "dns", "proxy"}
+	simPorts = [...]struct {
+		name  string
+		port  uint16
+		proto protocol
+	}{
+		{"http", 80, tcp}, {"ssh", 22, tcp}, {"dns", 53, udp}, {"smtp", 25, tcp}, {"mysql", 3306, tcp},
+		{"ftp", 21, tcp}, {"ldap", 389, tcp}, {"smb", 445, tcp}, {"ping", 0, icmp},
+	}
+	simMessages = [...]string{
+		"{team} patched a vulnerable service",
+		"{team} reset their administrator passwords",
+		"{team} found a backdoor on one of their hosts",
+		"{team} submitted an incident report",
+		"{team} restored a host from backup",
+		"The White Team is checking on {team}",
+	}
+	simPosts = [...]string{
+		"Great game so far, good luck everyone!",
+		"Who else is still hunting for that last flag?",
+		"The scoreboard is looking close this year.",
+		"Coffee break for the Blue Teams, not for the Red Team.",
+		"Watching the services flap is a sport in itself.",
+	}
+)
+
+// simulator is an adapter that generates Games without a scoring engine, which is used to
+// demo and test the Scoreboard. Each Game is generated from the seed, so the same seed
+// and config always plays out the same Games.
+type simulator struct {
+	lock  sync.Mutex
+	games []*simulation
+}
+type simulation struct {
+	rng    *rand.Rand
+	checks map[uint64][2]uint32
+	expire map[uint64]uint64
+	teams  []team
+	events []event
+	tweets []tweet
+	meta   meta
+	next   uint64
+	flap   float64
+	rate   float64
+}
+
+func (*simulator) Capabilities() capability {
+	return capMulti | capHosts | capEvents | capBeacons
+}
+func newSimulator(_ *Manager, c json.RawMessage) (adapter, error) {
+	var v struct {
+		Name     string  `json:"name"`
+		Seed     int64   `json:"seed"`
+		Flap     float64 `json:"flap"`
+		Rate     float64 `json:"rate"`
+		Games    int     `json:"games"`
+		Teams    int     `json:"teams"`
+		Hosts    int     `json:"hosts"`
+		Length   int     `json:"length"`
+		Services int     `json:"services"`
+	}
+	if len(c) > 0 {
+		if err := json.Unmarshal(c, &v); err != nil {
+			return nil, err
+		}
+	}
+	if v.Games == 0 {
+		v.Games = 1
+	}
+	if v.Teams == 0 {
+		v.Teams = 6
+	}
+	if v.Hosts == 0 {
+		v.Hosts = 3
+	}
+	if v.Services == 0 {
+		v.Services = 2
+	}
+	if v.Flap == 0 {
+		v.Flap = 0.05
+	}
+	if v.Rate == 0 {
+		v.Rate = 0.2
+	}
+	switch {
+	case v.Games < 0 || v.Games > maxGames:
+		return nil, errors.New("simulator games must be between 1 and " + strconv.Itoa(maxGames))
+	case v.Teams < 0 || v.Teams > maxTeams:
+		return nil, errors.New("simulator teams must be between 1 and " + strconv.Itoa(maxTeams))
+	case v.Hosts < 0 || v.Hosts > len(simHosts):
+		return nil, errors.New("simulator hosts must be between 1 and " + strconv.Itoa(len(simHosts)))
+	case v.Services < 0 || v.Services > len(simPorts):
+		return nil, errors.New("simulator services must be between 1 and " + strconv.Itoa(len(simPorts)))
+	case v.Flap < 0 || v.Flap > 1:
+		return nil, errors.New("simulator flap must be between 0 and 1")
+	case v.Rate < 0 || v.Rate > 1:
+		return nil, errors.New("simulator rate must be between 0 and 1")
+	case v.Length < 0:
+		return nil, errors.New("simulator length cannot be negative")
+	}
+	if v.Seed == 0 {
+		v.Seed = time.Now().UnixNano()
+	}
+	if len(v.Name) == 0 {
+		v.Name = "Simulation"
+	}
+	var (
+		s = &simulator{games: make([]*simulation, v.Games)}
+		n = time.Now().UTC().Truncate(time.Second)
+	)
+	for i := range s.games {
+		g := &simulation{
+			rng:    rand.New(rand.NewSource(v.Seed + int64(i))),
+			flap:   v.Flap,
+			rate:   v.Rate,
+			checks: make(map[uint64][2]uint32),
+			expire: make(map[uint64]uint64),
+			meta:   meta{ID: uint64(i + 1), Name: v.Name, Status: running},
+		}
+		if v.Games > 1 {
+			g.meta.Name = v.Name + " " + strconv.Itoa(i+1)
+		}
+		if v.Length > 0 {
+			g.meta.Start, g.meta.End = n, n.Add(time.Duration(v.Length)*time.Minute)
+		}
+		g.populate(v.Teams, v.Hosts, v.Services)
+		s.games[i] = g
+	}
+	return s, nil
+}
+
+// Games advances every simulated Game by one update tick and returns them.
+func (s *simulator) Games(_ context.Context) ([]meta, error) {
+	var (
+		n = time.Now().UTC()
+		r = make([]meta, len(s.games))
+	)
+	s.lock.Lock()
+	for i := range s.games {
+		s.games[i].step(n)
+		r[i] = s.games[i].meta
+	}
+	s.lock.Unlock()
+	return r, nil
+}
+func (s *simulation) step(n time.Time) {
+	if s.meta.Status != running {
+		return
+	}
+	if !s.meta.End.IsZero() && !n.Before(s.meta.End) {
+		s.meta.Status = completed
+		return
+	}
+	s.next++
+	for i := range s.teams {
+		t := &s.teams[i]
+		for x := range t.Hosts {
+			for y := range t.Hosts[x].Services {
+				v := &t.Hosts[x].Services[y]
+				// Services that are down are more likely to change, so outages are
+				// short and the board does not slowly turn red.
+				switch {
+				case v.State == green && s.rng.Float64() < s.flap:
+					if v.State = red; s.rng.Intn(3) == 0 {
+						v.State = yellow
+					}
+				case v.State != green && s.rng.Float64() < 0.3:
+					v.State = green
+				}
+				c := s.checks[v.ID]
+				if c[1]++; v.State == green {
+					c[0]++
+					t.Score.Total += int64(5 + s.rng.Intn(6))
+				}
+				s.checks[v.ID], v.SLA = c, float64(c[0]*1000/c[1])/10
+			}
+		}
+		// Beacons are cleared by the attacked team after a few ticks.
+		b := t.Beacons[:0]
+		for _, v := range t.Beacons {
+			if s.expire[v.ID] > s.next {
+				b = append(b, v)
+			} else {
+				delete(s.expire, v.ID)
+			}
+		}
+		t.Beacons, t.Score.Health = b, int64(100-10*len(b))
+	}
+	if len(s.teams) > 1 && s.rng.Float64() < s.rate {
+		a, d := &s.teams[s.rng.Intn(len(s.teams))], &s.teams[s.rng.Intn(len(s.teams))]
+		if a.ID != d.ID {
+			if s.rng.Intn(2) == 0 {
+				a.Flags.Captured++
+				d.Flags.Lost++
+				a.Score.Total += 100
+			} else if len(d.Beacons) < 10 {
+				d.Beacons = append(d.Beacons, beacon{
+					ID:    s.next,
+					Team:  a.ID,
+					Host:  d.Hosts[s.rng.Intn(len(d.Hosts))].Name,
+					Color: a.Color,
+				})
+				s.expire[s.next] = s.next + uint64(5+s.rng.Intn(10))
+				a.Score.Total += 50
+			}
+		}
+	}
+	if s.rng.Float64() < s.rate/2 {
+		t := &s.teams[s.rng.Intn(len(s.teams))]
+		v := strings.Replace(simMessages[s.rng.Intn(len(simMessages))], "{team}", t.Name, 1)
+		if s.events = append(s.events, event{ID: s.next, Data: map[string]string{"text": v}}); len(s.events) > simEvents {
+			s.events = s.events[len(s.events)-simEvents:]
+		}
+	}
+	if s.rng.Float64() < s.rate/4 {
+		t := &s.teams[s.rng.Intn(len(s.teams))]
+		s.tweets = append(s.tweets, tweet{
+			ID:       s.meta.ID<<32 | s.next,
+			User:     t.Name,
+			Text:     simPosts[s.rng.Intn(len(simPosts))],
+			UserName: "team" + strconv.FormatUint(t.ID, 10),
+		})
+		if len(s.tweets) > simTweets {
+			s.tweets = s.tweets[len(s.tweets)-simTweets:]
+		}
+	}
+}
+func (s *simulation) populate(t, h, c int) {
+	s.teams = make([]team, t)
+	for i := range s.teams {
+		v := &s.teams[i]
+		v.ID, v.Color = uint64(i+1), simColors[i%len(simColors)]
+		if v.Name = "Team " + strconv.Itoa(i+1); i < len(simNames) {
+			v.Name = "Team " + simNames[i]
+		}
+		v.Hosts, v.Beacons, v.Score.Health = make([]host, h), make([]beacon, 0), 100
+		for x := range v.Hosts {
+			v.Hosts[x] = host{ID: v.ID<<16 | uint64(x+1), Name: simHosts[x], Online: true, Services: make([]service, c)}
+			// Each host has a different set of services, which are the same for every
+			// team so the service matrix lines up.
+			for y := range v.Hosts[x].Services {
+				p := simPorts[(x+y)%len(simPorts)]
+				v.Hosts[x].Services[y] = service{
+					ID:       v.Hosts[x].ID<<8 | uint64(y+1),
+					Name:     p.name,
+					Port:     p.port,
+					SLA:      100,
+					Protocol: p.proto,
+				}
+			}
+		}
+	}
+}
+
+// Fetch returns a copy of the simulated Game with the supplied ID, so the Games that
+// were already fetched are not changed by the next update tick.
+func (s *simulator) Fetch(_ context.Context, i uint64) (*game, error) {
+	if i == 0 || i > uint64(len(s.games)) {
+		return &game{}, nil
+	}
+	s.lock.Lock()
+	var (
+		v = s.games[i-1]
+		g = &game{Meta: v.meta, Message: "Simulated Game", Teams: make([]team, len(v.teams))}
+	)
+	for x := range v.teams {
+		t := v.teams[x]
+		t.Hosts, t.Beacons = make([]host, len(v.teams[x].Hosts)), make([]beacon, len(v.teams[x].Beacons))
+		copy(t.Beacons, v.teams[x].Beacons)
+		for y := range t.Hosts {
+			t.Hosts[y] = v.teams[x].Hosts[y]
+			t.Hosts[y].Services = make([]service, len(v.teams[x].Hosts[y].Services))
+			copy(t.Hosts[y].Services, v.teams[x].Hosts[y].Services)
+		}
+		g.Teams[x] = t
+	}
+	g.Events.Current = make([]event, len(v.events))
+	copy(g.Events.Current, v.events)
+	if len(v.tweets) > 0 {
+		g.Tweets = make([]tweet, len(v.tweets))
+		copy(g.Tweets, v.tweets)
+	}
+	s.lock.Unlock()
+	return g, nil
+}
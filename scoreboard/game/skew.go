@@ -0,0 +1,137 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"net/http"
+	"time"
+)
+
+// skewWarn is the clock skew of the Source that is logged as a warning. The Date header
+// only has a resolution of one second, so smaller values are not reliable.
+const skewWarn = 5 * time.Second
+
+// Drift is the clock skew of the Source, which is how far the clock of the scoring
+// engine is ahead of the local clock, or behind it if negative. The skew is measured
+// from the Date header of each response of the Source. Correction is the time that
+// is taken off the event times of the Source, which is the measured skew if Auto is
+// true.
+type Drift struct {
+	Time       time.Time
+	Skew       time.Duration
+	Correction time.Duration
+	Auto       bool
+}
+type drift struct {
+	at     time.Time
+	skew   time.Duration
+	fixed  time.Duration
+	auto   bool
+	warned bool
+}
+
+// Correct sets the correction that is taken off the times of the events sent by the
+// Source, so the ticker does not show events from the future when the clock of the
+// scoring engine is ahead. If auto is true, the measured skew is used, otherwise the
+// supplied fixed correction is used. A fixed correction of zero disables it.
+func (m *Manager) Correct(auto bool, d time.Duration) {
+	m.lock.Lock()
+	m.drift.auto, m.drift.fixed = auto, d
+	m.lock.Unlock()
+}
+
+// Skew returns the measured clock skew of the Source and the correction used. The
+// Drift time is zero if the Source has not sent a Date header yet.
+func (m *Manager) Skew() Drift {
+	m.lock.Lock()
+	d := Drift{Time: m.drift.at, Skew: m.drift.skew, Correction: m.drift.fixed, Auto: m.drift.auto}
+	m.lock.Unlock()
+	if d.Auto {
+		d.Correction = d.Skew.Round(time.Second)
+	}
+	return d
+}
+
+// gauge measures the clock skew of the Source from the Date header of a response. The
+// header is compared with the middle of the request, and half a second is added as
+// the header is cut to the second. Each measure is averaged with the last ones, so a
+// slow response does not move the skew much.
+func (m *Manager) gauge(s, r time.Time, h http.Header) {
+	v := h.Get("Date")
+	if len(v) == 0 {
+		return
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return
+	}
+	d := t.Add(time.Second / 2).Sub(s.Add(r.Sub(s) / 2))
+	m.lock.Lock()
+	if !m.drift.at.IsZero() {
+		d = m.drift.skew + (d-m.drift.skew)/5
+	}
+	m.drift.at, m.drift.skew = r.UTC(), d
+	w, a := m.drift.warned, d
+	if a < 0 {
+		a = -a
+	}
+	switch {
+	case !w && a >= skewWarn:
+		m.drift.warned = true
+	case w && a < skewWarn/2:
+		m.drift.warned = false
+	}
+	c := w != m.drift.warned
+	m.lock.Unlock()
+	switch {
+	case c && !w:
+		m.log.Warning("The clock of the Source is %s off from the local clock, event times may be wrong!", d.Round(time.Second).String())
+	case c:
+		m.log.Info("The clock of the Source is %s off from the local clock, which is within the limit.", d.Round(time.Second).String())
+	}
+}
+
+// deskew takes the correction off the times of the events of the Game. The event data
+// is copied, so the Game of the Source is not changed.
+func (m *Manager) deskew(g *game) {
+	c := m.Skew().Correction
+	if c == 0 || len(g.Events.Current) == 0 {
+		return
+	}
+	e := make([]event, len(g.Events.Current))
+	for i, v := range g.Events.Current {
+		if t, ok := v.when(); ok {
+			d := make(map[string]string, len(v.Data))
+			for k, x := range v.Data {
+				d[k] = x
+			}
+			d["time"], v.Data = t.Add(-c).UTC().Format(time.RFC3339), d
+		}
+		e[i] = v
+	}
+	g.Events.Current = e
+}
+
+// when returns the time of the event sent by the Source, if it has one.
+func (e event) when() (time.Time, bool) {
+	v, ok := e.Data["time"]
+	if !ok || len(v) == 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, err == nil
+}
@@ -0,0 +1,172 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sliceDivision is the longest division name a client can ask for in its Hello.
+const sliceDivision = 64
+
+// teamPrefix is the start of the ID of every update of a team.
+const teamPrefix = "game-team-t"
+
+// slice is the part of a Game a client asked for in its Hello, such as a single team
+// for a pit display. Updates of the teams that are not in the slice are removed before
+// the updates are encoded, every other update is sent as is. A zero slice is the whole
+// Game.
+type slice struct {
+	Division string
+	Team     uint64
+	Top      int64
+}
+type roster map[uint64]struct{}
+
+func (v slice) whole() bool {
+	return len(v.Division) == 0 && v.Team == 0 && v.Top <= 0
+}
+
+// owner returns the ID of the team the update belongs to, or false if the update is not
+// the update of a team.
+func owner(s string) (uint64, bool) {
+	if !strings.HasPrefix(s, teamPrefix) {
+		return 0, false
+	}
+	s = s[len(teamPrefix):]
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s = s[:i]
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	return v, err == nil
+}
+
+// teams returns the IDs of the teams in the slice, read from the division and place of
+// each team in the board updates.
+func (v slice) teams(b []update) roster {
+	var (
+		d = make(map[uint64]string)
+		p = make(map[uint64]int64)
+		r = make(roster)
+	)
+	for i := range b {
+		t, ok := owner(b[i].ID)
+		if !ok {
+			continue
+		}
+		switch x, _ := b[i].Value.(string); {
+		case b[i].ID == teamPrefix+strconv.FormatUint(t, 10)+"-name-division":
+			d[t] = x
+		case b[i].Name == "order" && len(b[i].ID) == len(teamPrefix)+len(strconv.FormatUint(t, 10)):
+			p[t], _ = strconv.ParseInt(x, 10, 64)
+		default:
+			if _, ok := p[t]; !ok {
+				p[t] = 0
+			}
+		}
+	}
+	for t, n := range p {
+		switch {
+		case v.Team > 0 && t != v.Team:
+		case len(v.Division) > 0 && !strings.EqualFold(d[t], v.Division):
+		case v.Top > 0 && (n <= 0 || n > v.Top):
+		default:
+			r[t] = struct{}{}
+		}
+	}
+	return r
+}
+
+// cut returns the updates that are not the updates of a team outside of the roster.
+func (r roster) cut(u []update) []update {
+	o := make([]update, 0, len(u))
+	for i := range u {
+		if t, ok := owner(u[i].ID); ok {
+			if _, ok = r[t]; !ok {
+				continue
+			}
+		}
+		o = append(o, u[i])
+	}
+	return o
+}
+
+// sliced returns the updates of the message for the clients of the slice. Teams that
+// moved into the slice, such as a team that moved into the top places, are sent from
+// the board and teams that left it are removed, so the clients do not need to reload.
+func (s *subscription) sliced(v slice, u []update) []update {
+	k := v.teams(s.cache)
+	if s.slices == nil {
+		s.slices = make(map[slice]roster)
+	}
+	o, ok := s.slices[v]
+	if s.slices[v] = k; !ok {
+		o = k
+	}
+	r := k.cut(u)
+	a := make(roster)
+	for t := range k {
+		if _, ok := o[t]; !ok {
+			a[t] = struct{}{}
+		}
+	}
+	if len(a) > 0 {
+		r = append(a.board(s.cache), r...)
+	}
+	for t := range o {
+		if _, ok := k[t]; !ok {
+			r = append(r, update{ID: teamPrefix + strconv.FormatUint(t, 10), Remove: true})
+		}
+	}
+	return r
+}
+
+// board returns the board updates of the teams in the roster.
+func (r roster) board(b []update) []update {
+	o := make([]update, 0, len(r)*16)
+	for i := range b {
+		if t, ok := owner(b[i].ID); ok {
+			if _, ok = r[t]; ok {
+				o = append(o, b[i])
+			}
+		}
+	}
+	return o
+}
+
+// board returns the board updates sent to the client when it connects, which are only
+// the updates of its slice.
+func (c *stream) board(b []update) []update {
+	if c.slice.whole() {
+		return b
+	}
+	return c.slice.teams(b).cut(b)
+}
+
+// encode returns the encoded updates of the slice. Clients of a slice are sent a message
+// even if none of the updates are in the slice, so the sequence numbers have no gaps.
+func (s *subscription) encode(m *Manager, v slice, u []update) []byte {
+	b, err := payload(s.sliced(v, u))
+	if err != nil {
+		m.log.Error("Unable to encode the Updates of a slice of Game %d: %s!", s.ID, err.Error())
+		return []byte("[]\n")
+	}
+	r := append([]byte(nil), b.Bytes()...)
+	release(b)
+	return r
+}
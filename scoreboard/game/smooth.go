@@ -0,0 +1,220 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type burst struct {
+	rate     int
+	collapse bool
+}
+
+// pending is a Change that would be added to the ticker, with its event and update. N
+// is the number of Changes it stands for once collapsed.
+type pending struct {
+	c Change
+	e event
+	u update
+	n int
+}
+
+// Pacing sets the most Changes added to the ticker of each Game each minute and if the
+// Changes of the same kind and team found in a single update are collapsed into one,
+// such as when the Source catches up after an outage. The Changes over the rate are
+// held and added to the ticker as a single Summary Change once the rate allows. Hooks
+// are still called with every Change. A rate of zero disables the limit.
+func (m *Manager) Pacing(rate int, collapse bool) {
+	if rate < 0 {
+		rate = 0
+	}
+	m.lock.Lock()
+	m.burst = burst{rate: rate, collapse: collapse}
+	m.lock.Unlock()
+}
+func noun(k Kind) string {
+	switch k {
+	case ScoreIncrease:
+		return "score increases"
+	case RankChange:
+		return "rank changes"
+	case ServiceDown:
+		return "services down"
+	case ServiceUp:
+		return "services back up"
+	case FlagCapture:
+		return "flag captures"
+	case BeaconPlanted:
+		return "beacons planted"
+	case FirstBlood:
+		return "first bloods"
+	case Milestone:
+		return "milestones"
+	case FirstPlace:
+		return "lead changes"
+	case ScoreAdjustment:
+		return "score adjustments"
+	case ClockWarning:
+		return "clock warnings"
+	case BeaconCleared:
+		return "beacons cleared"
+	case Attack:
+		return "attacks"
+	case HillTaken:
+		return "hills taken"
+	}
+	return "changes"
+}
+
+// smooth adds the Changes to the ticker feed, collapsed and paced as set by Pacing, and
+// returns the updates of the Changes that were added.
+func (s *subscription) smooth(m *Manager, p []pending, n time.Time) []update {
+	m.lock.Lock()
+	b := m.burst
+	m.lock.Unlock()
+	if b.collapse {
+		p = collapse(p)
+	}
+	if b.rate > 0 {
+		p = s.pace(m, p, b.rate, n)
+	}
+	r := make([]update, 0, len(p))
+	for i := range p {
+		s.feed = append(s.feed, p[i].e)
+		r = append(r, p[i].u)
+	}
+	return r
+}
+
+// collapse merges the Changes of the same kind and team into a single Change, such as
+// "Team 1: 5 services down", in the place of the first one. Changes without a team are
+// never collapsed.
+func collapse(p []pending) []pending {
+	type group struct {
+		k Kind
+		t uint64
+	}
+	var (
+		g = make(map[group]int, len(p))
+		r = make([]pending, 0, len(p))
+	)
+	for i := range p {
+		if p[i].c.TeamID == 0 {
+			r = append(r, p[i])
+			continue
+		}
+		k := group{k: p[i].c.Kind, t: p[i].c.TeamID}
+		x, ok := g[k]
+		if !ok {
+			g[k] = len(r)
+			r = append(r, p[i])
+			continue
+		}
+		r[x].n += p[i].n
+	}
+	for i := range r {
+		if r[i].n > 1 {
+			r[i].fold(r[i].c.Team + ": " + strconv.Itoa(r[i].n) + " " + noun(r[i].c.Kind))
+		}
+	}
+	return r
+}
+
+// fold replaces the text of the collapsed Change. The host and other team are removed,
+// as they are only those of the first Change.
+func (p *pending) fold(t string) {
+	for _, d := range []map[string]string{p.e.Data, p.u.Data} {
+		delete(d, "host")
+		delete(d, "port")
+		delete(d, "other")
+		delete(d, "other_id")
+		delete(d, "announced")
+		d["text"], d["count"] = t, strconv.Itoa(p.n)
+	}
+}
+
+// pace returns the Changes that fit in the rate of the last minute. The Changes over the
+// rate are held, and a slot is kept for the Summary Change of the held Changes, which
+// is added once the rate allows.
+func (s *subscription) pace(m *Manager, p []pending, v int, n time.Time) []pending {
+	var (
+		o = n.Add(-time.Minute)
+		x int
+	)
+	for x < len(s.paced) && !s.paced[x].After(o) {
+		x++
+	}
+	s.paced = s.paced[x:]
+	f := v - len(s.paced)
+	if len(p) > f {
+		k := f - 1
+		if k < 0 {
+			k = 0
+		}
+		if s.held == nil {
+			s.held = make(map[Kind]int)
+		}
+		for i := k; i < len(p); i++ {
+			s.held[p[i].c.Kind] += p[i].n
+		}
+		m.log.Debug("Held %d ticker Changes of Game %d over the rate of %d each minute.", len(p)-k, s.ID, v)
+		p = p[:k]
+	}
+	if len(s.held) > 0 && len(p) < f {
+		p = append(p, s.summary(m, n))
+	}
+	for range p {
+		s.paced = append(s.paced, n)
+	}
+	return p
+}
+
+// summary returns the Summary Change of the held Changes, such as "12 more events: 5
+// services down, 4 rank changes, 3 flag captures", and clears them.
+func (s *subscription) summary(m *Manager, n time.Time) pending {
+	var (
+		t int
+		k = make([]Kind, 0, len(s.held))
+	)
+	for v, c := range s.held {
+		k, t = append(k, v), t+c
+	}
+	sort.Slice(k, func(i, j int) bool {
+		if s.held[k[i]] == s.held[k[j]] {
+			return k[i] < k[j]
+		}
+		return s.held[k[i]] > s.held[k[j]]
+	})
+	l := make([]string, len(k))
+	for i := range k {
+		l[i] = strconv.Itoa(s.held[k[i]]) + " " + noun(k[i])
+	}
+	s.held = nil
+	c := Change{Time: n, Kind: Summary, Game: s.last.Meta.Name, GameID: s.ID, New: int64(t)}
+	if c.Text = strconv.Itoa(t) + " more events: " + strings.Join(l, ", "); t == 1 {
+		c.Text = "1 more event: " + strings.Join(l, ", ")
+	}
+	e := record(c)
+	e.Data["count"] = strconv.Itoa(t)
+	u := item(e)
+	m.effect(Summary, &u)
+	return pending{c: c, e: e, u: u, n: t}
+}
@@ -0,0 +1,190 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PurpleSec/parseurl"
+)
+
+// Capability flags that an adapter can report. These are used by the Manager
+// to determine what data can be expected from an adapter.
+const (
+	capMulti capability = 1 << iota
+	capHosts
+	capEvents
+	capSolves
+	capBeacons
+	capHills
+)
+
+const singleGame = 1
+
+var errStandby = errors.New("replica source cannot be polled, the Games are sent by the primary")
+
+var sources = struct {
+	e map[string]adapterFunc
+	sync.RWMutex
+}{e: make(map[string]adapterFunc)}
+
+// capability is a bitmask of flags that describe what data an adapter is able
+// to supply.
+type capability uint16
+
+// adapter is an interface that represents a scoring engine that is able to supply
+// Game data to the Manager. Adapters are created by the adapterFunc that is
+// registered with the "type" name of the source config.
+type adapter interface {
+	Games(context.Context) ([]meta, error)
+	Fetch(context.Context, uint64) (*game, error)
+	Capabilities() capability
+}
+type scorebot struct {
+	m   *Manager
+	url url.URL
+}
+
+// standby is the adapter of a replica, which receives the Games from its primary with
+// Apply instead of polling a scoring engine.
+type standby struct{}
+
+// adapterFunc is a function that can create an adapter from the supplied Manager and
+// raw JSON configuration. The Manager can be used to access the shared HTTP client
+// and logger.
+type adapterFunc func(*Manager, json.RawMessage) (adapter, error)
+
+func init() {
+	register("scorebot", newScorebot)
+	register("ctfd", newCTFd)
+	register("json", newMapping)
+	register("replica", newStandby)
+	register("simulator", newSimulator)
+}
+
+// register will add the adapterFunc to the adapter registry under the provided type name.
+// Type names are not case sensitive. Registering a name that already exists will replace
+// the existing adapterFunc.
+func register(n string, f adapterFunc) {
+	sources.Lock()
+	sources.e[strings.ToLower(n)] = f
+	sources.Unlock()
+}
+
+// Has returns true if the capability contains all of the supplied flags.
+func (c capability) Has(v capability) bool {
+	return c&v == v
+}
+func (c capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+	var b strings.Builder
+	for i, n := range [...]string{"multi", "hosts", "events", "solves", "beacons", "hills"} {
+		if c&(1<<uint(i)) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+	}
+	return b.String()
+}
+func (scorebot) Capabilities() capability {
+	return capMulti | capHosts | capEvents | capBeacons
+}
+func (standby) Capabilities() capability {
+	return capMulti | capHosts | capEvents | capSolves | capBeacons | capHills
+}
+func (standby) Games(_ context.Context) ([]meta, error) {
+	return nil, errStandby
+}
+func (standby) Fetch(_ context.Context, _ uint64) (*game, error) {
+	return nil, errStandby
+}
+func newStandby(_ *Manager, _ json.RawMessage) (adapter, error) {
+	return standby{}, nil
+}
+func source(m *Manager, n string, c json.RawMessage) (adapter, error) {
+	sources.RLock()
+	f, ok := sources.e[strings.ToLower(n)]
+	if sources.RUnlock(); !ok {
+		return nil, errors.New(`source type "` + n + `" is not registered`)
+	}
+	return f(m, c)
+}
+func newScorebot(m *Manager, c json.RawMessage) (adapter, error) {
+	var v struct {
+		URL string `json:"url"`
+	}
+	if len(c) > 0 {
+		if err := json.Unmarshal(c, &v); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.URL) == 0 {
+		return nil, errors.New("scorebot source URL is missing")
+	}
+	u, err := parseurl.Parse(v.URL)
+	if err != nil {
+		return nil, errors.New(`could not unpack URL "` + v.URL + `": ` + err.Error())
+	}
+	if !u.IsAbs() {
+		u.Scheme = "http"
+	}
+	if len(m.assets) == 0 {
+		m.assets = u.String()
+	}
+	return &scorebot{m: m, url: *u}, nil
+}
+func (s *scorebot) Games(x context.Context) ([]meta, error) {
+	var g []meta
+	if err := s.getJSON(x, "api/games/", &g); err != nil && err != errNotModified {
+		return nil, err
+	} else if err != nil {
+		return g, err
+	}
+	return g, nil
+}
+func (s scorebot) getJSON(x context.Context, u string, o interface{}) error {
+	s.url.Path = path.Join(s.url.Path, u) + "/"
+	r, err := s.m.request(x, s.url.String(), nil)
+	if err != nil && err != errNotModified {
+		return err
+	}
+	if v := json.Unmarshal(r, &o); v != nil {
+		return errors.New(`unable to unmarshal JSON from "` + u + `": ` + v.Error())
+	}
+	return err
+}
+func (s *scorebot) Fetch(x context.Context, i uint64) (*game, error) {
+	var g game
+	if err := s.getJSON(x, "api/scoreboard/"+strconv.FormatUint(i, 10), &g); err != nil && err != errNotModified {
+		return nil, err
+	} else if err != nil {
+		return &g, err
+	}
+	return &g, nil
+}
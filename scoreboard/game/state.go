@@ -0,0 +1,212 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const stateVersion = 1
+
+type saved struct {
+	Last game
+	Feed []event
+	ID   uint64
+}
+type checkpoint struct {
+	Time        time.Time
+	Games       []meta
+	Subs        []saved
+	Adjustments []Adjustment
+	Clocks      map[uint64]clock
+	Version     uint8
+}
+
+// Store saves and loads the state of a Manager, such as a database that is shared by
+// several Scoreboards. Load returns nil if there is no saved state.
+type Store interface {
+	Load() ([]byte, error)
+	Save([]byte) error
+	String() string
+}
+type file string
+
+// Persist will save the state of all subscribed Games, including the ticker and event
+// log, to the supplied file every interval and when the Manager is stopped. If the file
+// already exists, the saved state is loaded first, so clients will see the last known
+// Game state before the first update completes.
+func (m *Manager) Persist(p string, d time.Duration) error {
+	if len(p) == 0 {
+		return nil
+	}
+	m.state = p
+	return m.Share(file(p), d)
+}
+
+// Share is like Persist, but saves the state to the supplied Store instead of a file.
+func (m *Manager) Share(s Store, d time.Duration) error {
+	if s == nil {
+		return nil
+	}
+	if d <= 0 {
+		d = time.Second * 30
+	}
+	m.store, m.every, m.saved = s, d, time.Now()
+	b, err := s.Load()
+	if err != nil {
+		return errors.New(`unable to load state "` + s.String() + `": ` + err.Error())
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	c, err := decode(b)
+	if err != nil {
+		m.log.Warning(`State "%s" could not be read, ignoring it: %s!`, s.String(), err.Error())
+		return nil
+	}
+	m.Games, m.adjusts = c.Games, c.Adjustments
+	atomic.AddUint64(&m.version, 1)
+	// Clocks set before the state was loaded, such as from the config, replace the
+	// saved clocks.
+	if len(c.Clocks) > 0 && m.clocks == nil {
+		m.clocks = make(map[uint64]*clock, len(c.Clocks))
+	}
+	for k, v := range c.Clocks {
+		if _, ok := m.clocks[k]; !ok {
+			v := v
+			m.clocks[k] = &v
+		}
+	}
+	for i := range m.Games {
+		if m.Games[i].Active() {
+			m.active[cleanSlugString(m.Games[i].Name)] = m.Games[i].ID
+		}
+	}
+	for i := range c.Subs {
+		m.restore(c.Subs[i])
+	}
+	m.synced = c.Time
+	m.log.Info(`Restored %d Games from state "%s" saved at %s.`, len(c.Subs), s.String(), c.Time.Format(time.RFC3339))
+	return nil
+}
+func decode(b []byte) (checkpoint, error) {
+	var c checkpoint
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&c); err != nil {
+		return c, err
+	}
+	if c.Version != stateVersion {
+		return c, errors.New("version " + strconv.Itoa(int(c.Version)) + " is not supported")
+	}
+	return c, nil
+}
+
+// restore adds a subscription for the saved Game, so clients are shown the saved
+// Game until it is updated.
+func (m *Manager) restore(v saved) *subscription {
+	s := &subscription{
+		ID:      v.ID,
+		new:     make(chan *stream, 128),
+		last:    v.Last,
+		feed:    v.Feed,
+		clients: make([]*stream, 0, 1),
+	}
+	s.last.order = m.order
+	s.last.digest()
+	s.cache, _ = s.last.Delta(m.assets, nil)
+	m.shadow(s)
+	m.subs[s.ID] = s
+	return s
+}
+
+// persist saves the state once the save interval has passed, or right away if forced.
+// The leader of a cluster saves the state after every update, so the other Managers
+// are at most one update behind, and the other Managers never save the state.
+func (m *Manager) persist(f bool) {
+	if m.store == nil || !m.leading() {
+		return
+	}
+	n := time.Now()
+	if !f && m.leader == nil && n.Sub(m.saved) < m.every {
+		return
+	}
+	m.saved = n
+	c := checkpoint{Time: n, Games: m.Games, Subs: make([]saved, 0, len(m.subs)), Adjustments: m.Adjustments(0), Clocks: m.saveClocks(), Version: stateVersion}
+	for _, s := range m.subs {
+		c.Subs = append(c.Subs, saved{ID: s.ID, Last: s.last, Feed: s.feed})
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&c); err != nil {
+		m.log.Error(`Unable to encode state: %s!`, err.Error())
+		return
+	}
+	if err := m.store.Save(b.Bytes()); err != nil {
+		m.log.Error(`Unable to save state to "%s": %s!`, m.store.String(), err.Error())
+		return
+	}
+	m.log.Trace(`Saved state of %d Games to "%s".`, len(c.Subs), m.store.String())
+}
+
+// Writable returns an error if the state file was set with Persist and a new state
+// file cannot be created next to it. This function returns nil if the state is not
+// saved.
+func (m *Manager) Writable() error {
+	if len(m.state) == 0 {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(m.state), "."+filepath.Base(m.state)+".*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+func (f file) String() string {
+	return string(f)
+}
+func (f file) Load() ([]byte, error) {
+	b, err := os.ReadFile(string(f))
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+func (f file) Save(b []byte) error {
+	v, err := os.CreateTemp(filepath.Dir(string(f)), "."+filepath.Base(string(f))+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = v.Write(b); err == nil {
+		err = v.Sync()
+	}
+	if x := v.Close(); err == nil {
+		err = x
+	}
+	if err == nil {
+		err = os.Rename(v.Name(), string(f))
+	}
+	if err != nil {
+		os.Remove(v.Name())
+	}
+	return err
+}
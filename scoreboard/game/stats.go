@@ -0,0 +1,180 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the update counters of a Manager. Fetching and Sending are
+// the total time spent requesting Games from the Source and sending updates to the
+// Scoreboard clients. Tweets and Events are the Tweets and ticker events removed to keep
+// under the limits set by Limit. Updated is the time of the last successful update tick and Ticked
+// is the time of the last update tick, even if the Source failed. Skew is the measured clock skew
+// of the Source.
+type Stats struct {
+	Updated    time.Time
+	Ticked     time.Time
+	Fetches    uint64
+	Failures   uint64
+	Broadcasts uint64
+	Tweets     uint64
+	Events     uint64
+	Fetching   time.Duration
+	Sending    time.Duration
+	Skew       time.Duration
+	Clients    int64
+}
+
+// State is a snapshot of the subscriptions, client lists and queues of a Manager, taken
+// at the end of the last update tick. State is only kept after Inspect is called.
+type State struct {
+	Time          time.Time      `json:"time"`
+	Subscriptions []Subscription `json:"subscriptions"`
+	Tweets        int            `json:"tweets_queued"`
+	Shown         int            `json:"tweets_shown"`
+	Replays       int            `json:"replays"`
+}
+
+// Subscription is the state of a subscribed Game. Delayed are the clients that are
+// shown the delayed or anonymized view of the Game.
+type Subscription struct {
+	Clients []string `json:"clients"`
+	Delayed []string `json:"delayed,omitempty"`
+	ID      uint64   `json:"id"`
+	Waiting int      `json:"waiting"`
+	Feed    int      `json:"feed"`
+	Cache   int      `json:"cache"`
+	Stale   bool     `json:"stale"`
+}
+
+// counters is kept behind a pointer so the 64bit values are aligned for atomic
+// access on 32bit platforms.
+type counters struct {
+	fetches    uint64
+	failures   uint64
+	broadcasts uint64
+	tweets     uint64
+	events     uint64
+	fetching   int64
+	sending    int64
+	updated    int64
+	ticked     int64
+	clients    int64
+	state      atomic.Value
+	inspect    uint32
+}
+
+// Stats returns a snapshot of the update counters of the Manager.
+func (m *Manager) Stats() Stats {
+	s := Stats{
+		Fetches:    atomic.LoadUint64(&m.stats.fetches),
+		Failures:   atomic.LoadUint64(&m.stats.failures),
+		Broadcasts: atomic.LoadUint64(&m.stats.broadcasts),
+		Tweets:     atomic.LoadUint64(&m.stats.tweets),
+		Events:     atomic.LoadUint64(&m.stats.events),
+		Fetching:   time.Duration(atomic.LoadInt64(&m.stats.fetching)),
+		Sending:    time.Duration(atomic.LoadInt64(&m.stats.sending)),
+		Clients:    atomic.LoadInt64(&m.stats.clients),
+		Skew:       m.Skew().Skew,
+	}
+	if u := atomic.LoadInt64(&m.stats.updated); u > 0 {
+		s.Updated = time.Unix(0, u).UTC()
+	}
+	if t := atomic.LoadInt64(&m.stats.ticked); t > 0 {
+		s.Ticked = time.Unix(0, t).UTC()
+	}
+	return s
+}
+
+// Inspect makes the Manager keep a State snapshot at the end of each update tick, which
+// is returned by State.
+func (m *Manager) Inspect() {
+	atomic.StoreUint32(&m.stats.inspect, 1)
+}
+
+// State returns the State snapshot of the last update tick. The State is empty if
+// Inspect was not called or no update tick has finished since.
+func (m *Manager) State() State {
+	if v, ok := m.stats.state.Load().(State); ok {
+		return v
+	}
+	return State{Subscriptions: []Subscription{}}
+}
+
+// count saves the amount of connected clients of every subscription. This is only
+// called by the update thread, which owns the subscription client lists.
+func (m *Manager) count() {
+	var n int
+	for _, s := range m.subs {
+		if n += len(s.clients) + len(s.new); s.lag != nil {
+			n += len(s.lag.clients) + len(s.lag.new)
+		}
+	}
+	atomic.StoreInt64(&m.stats.clients, int64(n))
+	atomic.StoreInt64(&m.stats.ticked, time.Now().UnixNano())
+	if atomic.LoadUint32(&m.stats.inspect) == 1 {
+		m.stats.state.Store(m.inspect())
+	}
+}
+func (m *Manager) inspect() State {
+	v := State{Time: time.Now().UTC(), Subscriptions: make([]Subscription, 0, len(m.subs))}
+	for _, s := range m.subs {
+		i := Subscription{
+			ID:      s.ID,
+			Feed:    len(s.feed),
+			Cache:   len(s.cache),
+			Stale:   atomic.LoadUint32(&s.stale) == 1,
+			Waiting: len(s.new),
+			Clients: addresses(s.clients),
+		}
+		if s.lag != nil {
+			i.Waiting += len(s.lag.new)
+			i.Delayed = addresses(s.lag.clients)
+		}
+		v.Subscriptions = append(v.Subscriptions, i)
+	}
+	sort.Slice(v.Subscriptions, func(i, j int) bool { return v.Subscriptions[i].ID < v.Subscriptions[j].ID })
+	if m.twitter != nil {
+		v.Tweets, v.Shown = len(m.twitter.new), len(m.twitter.current)
+	}
+	m.lock.Lock()
+	v.Replays = len(m.replays)
+	m.lock.Unlock()
+	return v
+}
+func addresses(c []*stream) []string {
+	r := make([]string, 0, len(c))
+	for i := range c {
+		if c[i] != nil && c[i].Conn != nil {
+			r = append(r, c[i].RemoteAddr().String())
+		}
+	}
+	return r
+}
+func (c *counters) sent(t time.Time) {
+	atomic.AddUint64(&c.broadcasts, 1)
+	atomic.AddInt64(&c.sending, int64(time.Since(t)))
+}
+func (c *counters) fetched(t time.Time, err error) {
+	atomic.AddUint64(&c.fetches, 1)
+	if atomic.AddInt64(&c.fetching, int64(time.Since(t))); err != nil && err != errNotModified {
+		atomic.AddUint64(&c.failures, 1)
+	}
+}
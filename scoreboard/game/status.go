@@ -0,0 +1,202 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statusEvent = 7
+	sourceEvent = 8
+)
+
+// Status marks the named data source, such as "twitter", as failing since the supplied
+// time. The clients of every Game show a banner that the data may be stale while any
+// source is failing. A zero time marks the source as working again.
+func (m *Manager) Status(n string, t time.Time) {
+	m.lock.Lock()
+	if t.IsZero() {
+		delete(m.failing, n)
+	} else {
+		if m.failing == nil {
+			m.failing = make(map[string]time.Time)
+		}
+		if _, ok := m.failing[n]; !ok {
+			m.failing[n] = t
+		}
+	}
+	m.lock.Unlock()
+}
+
+// Source sets the status of the named data source, such as "connected" for the Twitter
+// stream, which is sent to the Staff clients of every Game along with the status of the
+// scoring engine. An empty status removes the data source.
+func (m *Manager) Source(n, v string) {
+	m.lock.Lock()
+	if len(v) == 0 {
+		delete(m.sources, n)
+	} else {
+		if m.sources == nil {
+			m.sources = make(map[string]string)
+		}
+		m.sources[n] = v
+	}
+	m.lock.Unlock()
+}
+
+// degrade sends the status of the data sources to the clients of each subscription
+// when it has changed. The Source is failing while the breaker is open and a Game is
+// failing once it could not be fetched as many times as the breaker threshold.
+func (m *Manager) degrade(x context.Context) {
+	var (
+		d = make(map[string]string, 4)
+		o = make(map[string]string, 4)
+	)
+	m.lock.Lock()
+	for k, v := range m.failing {
+		d[k] = v.UTC().Format(time.RFC3339)
+	}
+	for k, v := range m.sources {
+		o[k] = v
+	}
+	m.lock.Unlock()
+	if m.breaker.open {
+		d["source"] = m.breaker.last.UTC().Format(time.RFC3339)
+	}
+	for _, s := range m.subs {
+		if s.fails >= m.breaker.threshold && m.breaker.threshold > 0 {
+			d["game"] = s.failed.UTC().Format(time.RFC3339)
+		} else {
+			delete(d, "game")
+		}
+		if k := failing(d); k != s.status {
+			s.status = k
+			s.health = s.degraded(d)
+			if len(k) == 0 {
+				m.log.Info("Data sources for Game %d have recovered.", s.ID)
+				s.broadcast(x, m, []update{{ID: "status", Event: true, Value: strconv.Itoa(statusEvent), Remove: true}})
+				continue
+			}
+			m.log.Warning("Data sources for Game %d are failing (%s), clients may show stale data.", s.ID, k)
+			s.broadcast(x, m, s.health)
+		}
+		s.inform(m, m.engine(s, o, d))
+	}
+}
+
+// engine adds the status of the scoring engine to the data source statuses and returns
+// them, with the names of the failing data sources in the "failing" value.
+func (m *Manager) engine(s *subscription, o, d map[string]string) map[string]string {
+	r := make(map[string]string, len(o)+2)
+	for k, v := range o {
+		r[k] = v
+	}
+	switch {
+	case !m.leading():
+		r["engine"] = "following the cluster leader"
+	case m.breaker.open:
+		r["engine"] = "paused after " + strconv.FormatUint(uint64(m.breaker.fails), 10) + " consecutive failures"
+	case m.breaker.fails > 0:
+		r["engine"] = strconv.FormatUint(uint64(m.breaker.fails), 10) + " consecutive failures"
+	case s.fails > 0:
+		r["engine"] = strconv.FormatUint(uint64(s.fails), 10) + " consecutive failures for this Game"
+	default:
+		r["engine"] = "connected"
+	}
+	f := make(map[string]string, len(d)+1)
+	for k := range d {
+		if k == "source" || k == "game" {
+			k = "engine"
+		}
+		f[k] = ""
+	}
+	if m.leading() && (m.breaker.fails > 0 || s.fails > 0) {
+		f["engine"] = ""
+	}
+	r["failing"] = failing(f)
+	return r
+}
+
+// inform sends the status of the data sources to the Staff clients of the subscription
+// when it has changed.
+func (s *subscription) inform(m *Manager, d map[string]string) {
+	k := make([]string, 0, len(d))
+	for n, v := range d {
+		k = append(k, n+"="+v)
+	}
+	sort.Strings(k)
+	v := strings.Join(k, "\n")
+	if v == s.sourced {
+		return
+	}
+	s.sourced = v
+	s.sources = []update{{ID: "sources", Data: d, Event: true, Value: strconv.Itoa(sourceEvent)}}
+	b, err := payload(s.sources)
+	if err != nil {
+		m.log.Error("Unable to encode the data source status for Game %d: %s!", s.ID, err.Error())
+		return
+	}
+	for _, c := range s.clients {
+		if !c.ok || !c.staff {
+			continue
+		}
+		if err := c.write(b.Bytes(), atomic.LoadUint64(&s.seq)); err != nil {
+			// The client is removed by the next broadcast.
+			c.ok = false
+		}
+	}
+	release(b)
+}
+func failing(d map[string]string) string {
+	if len(d) == 0 {
+		return ""
+	}
+	k := make([]string, 0, len(d))
+	for v := range d {
+		k = append(k, v)
+	}
+	sort.Strings(k)
+	var s string
+	for i := range k {
+		if i > 0 {
+			s += ", "
+		}
+		s += k[i]
+	}
+	return s
+}
+
+// degraded returns the status update with the time each failing data source started
+// failing and the time of the last successful update of the Game, or nil if there are
+// no failing sources.
+func (s *subscription) degraded(d map[string]string) []update {
+	if len(d) == 0 {
+		return nil
+	}
+	v := make(map[string]string, len(d)+1)
+	for k, t := range d {
+		v[k] = t
+	}
+	v["updated"] = s.fresh.UTC().Format(time.RFC3339)
+	return []update{{ID: "status", Data: v, Event: true, Value: strconv.Itoa(statusEvent)}}
+}
@@ -0,0 +1,201 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// take is a single recorded response of the Source. Responses that are JSON are kept
+// as is, so the fixture can be read, and any other responses are kept in Data.
+type take struct {
+	Time   time.Time       `json:"time"`
+	URL    string          `json:"url"`
+	Error  string          `json:"error,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Data   []byte          `json:"data,omitempty"`
+	Status int             `json:"status,omitempty"`
+}
+
+// tape records the responses of the Source to a fixture file, or plays them back in
+// place of the Source when it was loaded from a fixture.
+type tape struct {
+	lock   sync.Mutex
+	w      *os.File
+	last   map[string]*take
+	takes  map[string][]take
+	served map[string]int
+	wall   time.Time
+	base   time.Time
+	end    time.Time
+	speed  float64
+	ended  bool
+}
+
+// Record saves every response of the Source to the supplied fixture file, which can be
+// played back with Rewind to reproduce what the Scoreboard showed. Responses are only
+// saved when they are different from the last response of the same URL, and request
+// headers, such as tokens, are never saved. The file is appended to if it exists.
+func (m *Manager) Record(f string) error {
+	w, err := os.OpenFile(f, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	m.tape = &tape{w: w, last: make(map[string]*take)}
+	m.log.Info(`Recording Source responses to fixture "%s".`, f)
+	return nil
+}
+
+// Rewind plays back the responses in the supplied fixture file instead of requesting the
+// Source, with the same timing as they were recorded at speed times real time. If start
+// is not zero, the playback starts at that recorded time instead of the first response.
+// Once the end of the fixture is reached, the last responses are kept.
+func (m *Manager) Rewind(f string, start time.Time, speed float64) error {
+	if speed <= 0 {
+		return errors.New("fixture speed must be greater than zero")
+	}
+	r, err := os.Open(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var (
+		d = json.NewDecoder(r)
+		t = &tape{takes: make(map[string][]take), served: make(map[string]int), speed: speed}
+		c int
+	)
+	for {
+		var v take
+		if err = d.Decode(&v); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New(`fixture "` + f + `" is not valid: ` + err.Error())
+		}
+		if len(v.URL) == 0 || v.Time.IsZero() {
+			continue
+		}
+		if t.takes[v.URL] = append(t.takes[v.URL], v); t.base.IsZero() || v.Time.Before(t.base) {
+			t.base = v.Time
+		}
+		if v.Time.After(t.end) {
+			t.end = v.Time
+		}
+		c++
+	}
+	if c == 0 {
+		return errors.New(`fixture "` + f + `" does not have any responses`)
+	}
+	for _, v := range t.takes {
+		sort.SliceStable(v, func(i, j int) bool { return v[i].Time.Before(v[j].Time) })
+	}
+	if !start.IsZero() {
+		if start.After(t.end) {
+			return errors.New("fixture start time is after the last response at " + t.end.Format(time.RFC3339))
+		}
+		if start.After(t.base) {
+			t.base = start
+		}
+	}
+	t.wall, m.tape = time.Now(), t
+	m.log.Info(`Playing back %d responses from fixture "%s" starting at %s at %sx speed.`, c, f, t.base.Format(time.RFC3339), strconv.FormatFloat(speed, 'f', -1, 64))
+	return nil
+}
+func (t *tape) close() {
+	t.lock.Lock()
+	if t.w != nil {
+		t.w.Close()
+		t.w = nil
+	}
+	t.lock.Unlock()
+}
+
+// record saves the response of the URL if it changed since the last response.
+func (t *tape) record(m *Manager, u string, b []byte, c int, err error) {
+	v := take{Time: time.Now().UTC(), URL: u, Status: c}
+	if err != nil {
+		v.Error = err.Error()
+	} else if json.Valid(b) {
+		v.Body = b
+	} else {
+		v.Data = b
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.w == nil {
+		return
+	}
+	if o := t.last[u]; o != nil && o.Status == v.Status && o.Error == v.Error && bytes.Equal(o.Body, v.Body) && bytes.Equal(o.Data, v.Data) {
+		return
+	}
+	o, err := json.Marshal(v)
+	if err == nil {
+		_, err = t.w.Write(append(o, '\n'))
+	}
+	if err != nil {
+		m.log.Error(`Error writing to the fixture file: %s!`, err.Error())
+		return
+	}
+	t.last[u] = &v
+}
+
+// play returns the last response of the URL that was recorded before the current
+// position of the playback. Responses that were already returned are returned with
+// errNotModified, the same as a cached response.
+func (t *tape) play(m *Manager, u string) ([]byte, int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	l := t.takes[u]
+	if len(l) == 0 {
+		return nil, 0, errors.New(`request "` + u + `" is not in the fixture`)
+	}
+	n := t.base.Add(time.Duration(float64(time.Since(t.wall)) * t.speed))
+	if !t.ended && n.After(t.end) {
+		t.ended = true
+		m.log.Info("Reached the end of the fixture at %s, the last responses will be kept.", t.end.Format(time.RFC3339))
+	}
+	i := sort.Search(len(l), func(i int) bool { return l[i].Time.After(n) }) - 1
+	if i < 0 {
+		i = 0
+	}
+	v := &l[i]
+	if v.Status >= 400 {
+		return nil, v.Status, &statusError{s: `request "` + u + `" returned status code ` + strconv.Itoa(v.Status)}
+	}
+	if len(v.Error) > 0 {
+		return nil, v.Status, errors.New(v.Error)
+	}
+	b := []byte(v.Body)
+	if len(b) == 0 {
+		b = v.Data
+	}
+	if p, ok := t.served[u]; ok && p == i {
+		return b, http.StatusNotModified, errNotModified
+	}
+	t.served[u] = i
+	m.log.Debug(`Playing back the response of "%s" recorded at %s.`, u, v.Time.Format(time.RFC3339))
+	return b, v.Status, nil
+}
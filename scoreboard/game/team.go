@@ -19,6 +19,8 @@ package game
 import (
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -27,21 +29,32 @@ var (
 )
 
 type team struct {
-	Name    string      `json:"name"`
-	Logo    string      `json:"logo"`
-	Color   string      `json:"color"`
-	Beacons []beacon    `json:"beacons"`
-	Hosts   []host      `json:"hosts"`
-	Flags   scoreFlag   `json:"flags"`
-	Score   score       `json:"score"`
-	Tickets scoreTicket `json:"tickets"`
-	ID      uint64      `json:"id"`
-	hash    uint64
-	total   uint64
-	Minimal bool `json:"minimal"`
-	Offense bool `json:"offense"`
+	scored      time.Time
+	Name        string                 `json:"name"`
+	Logo        string                 `json:"logo"`
+	Color       string                 `json:"color"`
+	Division    string                 `json:"division"`
+	Country     string                 `json:"country"`
+	Affiliation string                 `json:"affiliation"`
+	Beacons     []beacon               `json:"beacons"`
+	Hosts       []host                 `json:"hosts"`
+	Flags       scoreFlag              `json:"flags"`
+	Score       score                  `json:"score"`
+	Tickets     scoreTicket            `json:"tickets"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+	ID          uint64                 `json:"id"`
+	hash        uint64
+	total       uint64
+	place       int64
+	bonus       int64
+	gained      int64
+	moved       int64
+	Minimal     bool `json:"minimal"`
+	Offense     bool `json:"offense"`
+	local       bool
 }
 type beacon struct {
+	Host  string `json:"host,omitempty"`
 	Color string `json:"color"`
 	ID    uint64 `json:"id"`
 	Team  uint64 `json:"team"`
@@ -63,14 +76,46 @@ func (t *team) Swap(i, j int) {
 func (t team) Less(i, j int) bool {
 	return t.Hosts[i].Name < t.Hosts[j].Name
 }
+
+// logo returns the logo URL of the team as it is shown to clients, with the asset
+// prefix s. Cached logos are already local and are returned as they are.
+func (t team) logo(s string) string {
+	if t.local {
+		return t.Logo
+	}
+	if t.Logo == "default.png" || len(t.Logo) == 0 {
+		return "/image/team.png"
+	}
+	return s + t.Logo
+}
+
+// emoji returns the flag emoji of the two letter ISO 3166 country code, which is made of
+// the regional indicator symbols of the letters. Other values are returned as they are.
+func emoji(c string) string {
+	if len(c) != 2 {
+		return c
+	}
+	var b strings.Builder
+	for _, r := range strings.ToUpper(c) {
+		if r < 'A' || r > 'Z' {
+			return c
+		}
+		b.WriteRune(0x1F1E6 + r - 'A')
+	}
+	return b.String()
+}
 func (t *team) Hash(h *hasher) uint64 {
 	if t.hash == 0 {
 		h.Hash(t.ID)
 		h.Hash(t.Name)
 		h.Hash(t.Logo)
 		h.Hash(t.Color)
+		h.Hash(t.Division)
+		h.Hash(t.Country)
+		h.Hash(t.Affiliation)
 		h.Hash(t.Offense)
 		h.Hash(t.Minimal)
+		hashExtra(h, t.Meta)
 		t.hash = h.Segment()
 		sort.Sort(t)
 	}
@@ -90,6 +135,7 @@ func (b *beacon) Hash(h *hasher) uint64 {
 	if b.hash == 0 {
 		h.Hash(b.ID)
 		h.Hash(b.Team)
+		h.Hash(b.Host)
 		h.Hash(b.Color)
 		b.hash = h.Segment()
 	}
@@ -101,6 +147,11 @@ func (t team) Compare(p *planner, o team) {
 	} else {
 		p.Value("team-t"+strconv.FormatUint(t.ID, 10), "", "team")
 	}
+	if o.place == t.place {
+		p.Property("team-t"+strconv.FormatUint(t.ID, 10), t.place, "order")
+	} else {
+		p.DeltaProperty("team-t"+strconv.FormatUint(t.ID, 10), t.place, "order")
+	}
 	p.Prefix(p.prefix + "-team-t" + strconv.FormatUint(t.ID, 10))
 	if o.hash == t.hash {
 		p.Value("beacon", "", "team-beacon")
@@ -110,9 +161,13 @@ func (t team) Compare(p *planner, o team) {
 		p.Value("host", "", "team-host")
 		p.Value("score", "", "team-score")
 		p.Value("name-name", t.Name, "team-name-div")
+		p.Value("name-division", t.Division, "team-division")
+		p.Value("name-country", emoji(t.Country), "team-country")
+		p.Value("name-affiliation", t.Affiliation, "team-affiliation")
 		p.Property("logo", t.Color, "background-color")
 		p.Property("logo", "url('"+t.Logo+"')", "background-image")
 		p.Property("", t.Color, "border-color")
+		annotate(p, "", t.Meta, o.Meta, false)
 		if t.Offense {
 			p.Property("", "+offense", "class")
 		} else {
@@ -142,9 +197,13 @@ func (t team) Compare(p *planner, o team) {
 		p.DeltaValue("host", "", "team-host")
 		p.DeltaValue("score", "", "team-score")
 		p.DeltaValue("name-name", t.Name, "team-name-div")
+		p.DeltaValue("name-division", t.Division, "team-division")
+		p.DeltaValue("name-country", emoji(t.Country), "team-country")
+		p.DeltaValue("name-affiliation", t.Affiliation, "team-affiliation")
 		p.DeltaProperty("logo", t.Color, "background-color")
 		p.DeltaProperty("logo", "url('"+t.Logo+"')", "background-image")
 		p.DeltaProperty("", t.Color, "border-color")
+		annotate(p, "", t.Meta, o.Meta, true)
 		if t.Offense {
 			p.DeltaProperty("", "+offense", "class")
 		} else {
@@ -194,6 +253,7 @@ func (t team) Compare(p *planner, o team) {
 			}
 		}
 	}
+	t.arrows(p, o)
 	p.rollbackPrefix()
 }
 func (b beacon) Compare(p *planner, o beacon) {
@@ -0,0 +1,96 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+type spanKey struct{}
+
+// Span is a finished timed step of an update tick. Spans of the same tick share the
+// Trace ID and are linked to the span that started them by the Parent ID, which is
+// empty for the root "update" span.
+type Span struct {
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Name       string
+	Error      string
+	Trace      [16]byte
+	ID         [8]byte
+	Parent     [8]byte
+}
+
+// Trace adds a function that will be called with each finished Span of the update
+// ticks. Trace functions are called from the update thread and should not block.
+func (m *Manager) Trace(f func(Span)) {
+	if f != nil {
+		m.traces = append(m.traces, f)
+	}
+}
+
+// span starts a Span that is a child of the Span in the supplied context, or a new
+// trace if there is none. The returned Span is nil if no Trace functions were added,
+// which makes every Span function a no-op.
+func (m *Manager) span(x context.Context, n string) (context.Context, *Span) {
+	if len(m.traces) == 0 {
+		return x, nil
+	}
+	s := &Span{Name: n, Start: time.Now()}
+	if p, ok := x.Value(spanKey{}).(*Span); ok && p != nil {
+		s.Trace, s.Parent = p.Trace, p.ID
+	} else {
+		rand.Read(s.Trace[:])
+	}
+	rand.Read(s.ID[:])
+	return context.WithValue(x, spanKey{}, s), s
+}
+func (s *Span) set(k, v string) {
+	if s == nil {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string, 2)
+	}
+	s.Attributes[k] = v
+}
+func (s *Span) finish(m *Manager, err error) {
+	if s == nil {
+		return
+	}
+	if s.End = time.Now(); err != nil && err != errNotModified {
+		s.Error = err.Error()
+	}
+	for _, f := range m.traces {
+		m.guard("trace", func() { f(*s) })
+	}
+}
+
+// propagate adds the W3C "traceparent" header of the Span in the context to the
+// request, so the scoring engine can link its own spans to the update tick.
+func propagate(x context.Context, r *http.Request) {
+	s, ok := x.Value(spanKey{}).(*Span)
+	if !ok || s == nil {
+		return
+	}
+	r.Header.Set("traceparent", "00-"+hex.EncodeToString(s.Trace[:])+"-"+hex.EncodeToString(s.ID[:])+"-01")
+}
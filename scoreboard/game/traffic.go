@@ -0,0 +1,130 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readMax is the largest message read from a client after the Hello message. Clients
+// do not send anything after the Hello, so this only needs to fit control frames.
+const readMax = 512
+
+// traffic is the counters of a client connection. The counters are written by the
+// update thread and the reader of the client, and read by the list of Displays, so
+// they are only accessed atomically.
+type traffic struct {
+	sent     uint64
+	messages uint64
+	acked    uint64
+	latency  int64
+	last     int64
+}
+
+// measure fills the traffic values of the Display from its counters.
+func (d *Display) measure() {
+	if d.t == nil {
+		return
+	}
+	var (
+		n = atomic.LoadUint64(&d.t.messages)
+		a = atomic.LoadUint64(&d.t.acked)
+	)
+	d.Sent, d.Latency = atomic.LoadUint64(&d.t.sent), time.Duration(atomic.LoadInt64(&d.t.latency)).Seconds()
+	if n > a {
+		d.Queued = n - a
+	}
+	if v := atomic.LoadInt64(&d.t.last); v > 0 {
+		t := time.Unix(0, v).UTC()
+		d.Acked = &t
+	}
+}
+
+// write sends the encoded updates to the client, followed by a ping with the number of
+// the message and the time it was sent. The browser answers the ping once it has read
+// the message, which gives the latency of the client and the number of messages it has
+// not read yet.
+func (c *stream) write(b []byte, q uint64) error {
+	k, err := c.frame(b, q)
+	if err != nil {
+		return err
+	}
+	if c.display == nil || c.display.t == nil {
+		return nil
+	}
+	atomic.AddUint64(&c.display.t.sent, uint64(k))
+	var (
+		p [16]byte
+		n = time.Now()
+	)
+	binary.BigEndian.PutUint64(p[0:], atomic.AddUint64(&c.display.t.messages, 1))
+	binary.BigEndian.PutUint64(p[8:], uint64(n.UnixNano()))
+	// A client that does not answer pings is still sent updates, so a failed ping is
+	// not treated as a failed write.
+	c.WriteControl(websocket.PingMessage, p[:], n.Add(time.Second*5))
+	return nil
+}
+
+// send encodes and sends the updates to the client.
+func (c *stream) send(u []update) error {
+	b, err := payload(u)
+	if err != nil {
+		return err
+	}
+	err = c.write(b.Bytes(), c.sequence())
+	release(b)
+	return err
+}
+
+// listen reads from the client until the connection is closed, so the answers to the
+// pings sent with each message are received. Anything else sent by the client is
+// ignored.
+func (c *stream) listen() {
+	c.SetReadLimit(readMax)
+	c.SetPongHandler(c.pong)
+	for {
+		if _, _, err := c.NextReader(); err != nil {
+			return
+		}
+	}
+}
+func (c *stream) pong(s string) error {
+	if len(s) != 16 || c.display == nil || c.display.t == nil {
+		return nil
+	}
+	var (
+		b = []byte(s)
+		n = time.Now()
+		i = binary.BigEndian.Uint64(b[0:])
+		t = int64(binary.BigEndian.Uint64(b[8:]))
+	)
+	// Pongs are answered in order, but an old pong is ignored in case the client
+	// answers the same ping twice.
+	if i <= atomic.LoadUint64(&c.display.t.acked) {
+		return nil
+	}
+	atomic.StoreUint64(&c.display.t.acked, i)
+	if d := n.UnixNano() - t; d >= 0 {
+		atomic.StoreInt64(&c.display.t.latency, d)
+	}
+	atomic.StoreInt64(&c.display.t.last, n.UnixNano())
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"context"
+	"strconv"
+)
+
+const transitionEvent = 5
+
+// Transition will send a transition event to every client of the Game with the supplied
+// ID during the next update. Clients play the transition animation and then reload the
+// page, which shows the Game that the display route now points to.
+func (m *Manager) Transition(i uint64) {
+	m.lock.Lock()
+	m.pending = append(m.pending, i)
+	m.lock.Unlock()
+}
+func (m *Manager) transition(x context.Context) {
+	m.lock.Lock()
+	p := m.pending
+	m.pending = nil
+	m.lock.Unlock()
+	for _, i := range p {
+		s, ok := m.subs[i]
+		if !ok {
+			continue
+		}
+		m.log.Debug("Sending transition to %d clients of Game %d.", len(s.clients), i)
+		s.accept()
+		s.broadcast(x, m, []update{{ID: "transition", Event: true, Value: strconv.Itoa(transitionEvent)}})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import "strconv"
+
+// trend sets the points gained and ranks moved of each team since the last Game. The
+// values of the last Game are kept when the standings did not change, so they are
+// shown until the standings change again, the same as the Snapshot deltas.
+func (g *game) trend(o *game) {
+	if o == nil || len(o.Teams) == 0 {
+		return
+	}
+	l := make(map[uint64]*team, len(o.Teams))
+	for i := range o.Teams {
+		l[o.Teams[i].ID] = &o.Teams[i]
+	}
+	if !standings(o, g) {
+		for i := range g.Teams {
+			if v, ok := l[g.Teams[i].ID]; ok {
+				g.Teams[i].gained, g.Teams[i].moved = v.gained, v.moved
+			}
+		}
+		return
+	}
+	a, b := ranks(o), ranks(g)
+	for i := range g.Teams {
+		if v, ok := l[g.Teams[i].ID]; ok {
+			g.Teams[i].gained = g.Teams[i].Score.Total - v.Score.Total
+			g.Teams[i].moved = a[g.Teams[i].ID] - b[g.Teams[i].ID]
+		} else {
+			g.Teams[i].gained, g.Teams[i].moved = 0, 0
+		}
+	}
+}
+
+// movement sets the Delta and Movement of each team since the last Snapshot. Teams that
+// were not in the last Snapshot have no deltas.
+func movement(s *Snapshot, o Snapshot) {
+	l := make(map[uint64]Standing, len(o.Teams))
+	for _, v := range o.Teams {
+		l[v.ID] = v
+	}
+	for i := range s.Teams {
+		if v, ok := l[s.Teams[i].ID]; ok {
+			s.Teams[i].Delta, s.Teams[i].Movement = s.Teams[i].Score-v.Score, v.Rank-s.Teams[i].Rank
+		}
+	}
+}
+
+// arrows writes the points gained and rank movement of the team. They are sent to the
+// clients whenever the score or place of the team changes, so a team that gains the
+// same points twice is still animated twice.
+func (t team) arrows(p *planner, o team) {
+	var (
+		d, dc = strconv.FormatInt(t.gained, 10), "score-delta score none"
+		m, mc = strconv.FormatInt(t.moved, 10), "team-move none"
+		u, w  = "-rank-up", "-rank-down"
+	)
+	switch {
+	case t.gained > 0:
+		d, dc = "+"+d, "score-delta score up"
+	case t.gained < 0:
+		dc = "score-delta score down"
+	}
+	switch {
+	case t.moved > 0:
+		m, mc, u = "▲"+m, "team-move up", "+rank-up"
+	case t.moved < 0:
+		m, mc, w = "▼"+strconv.FormatInt(-t.moved, 10), "team-move down", "+rank-down"
+	}
+	if o.ID != 0 && o.gained == t.gained && o.moved == t.moved && o.Score.Total == t.Score.Total && o.place == t.place {
+		p.Value("name-delta", d, dc)
+		p.Value("name-move", m, mc)
+		p.Property("", u, "class")
+		p.Property("", w, "class")
+		return
+	}
+	p.DeltaValue("name-delta", d, dc)
+	p.DeltaValue("name-move", m, mc)
+	p.DeltaProperty("", u, "class")
+	p.DeltaProperty("", w, "class")
+}
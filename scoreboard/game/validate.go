@@ -0,0 +1,265 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	maxName     = 128
+	maxText     = 1024
+	maxURL      = 2048
+	maxColor    = 32
+	maxTeams    = 256
+	maxHosts    = 128
+	maxGames    = 256
+	maxScore    = 1 << 40
+	maxEvents   = 64
+	maxProblems = 10
+	maxBeacons  = 1024
+	maxServices = 256
+	maxEventKey = 32
+	maxSolvable = 1024
+	maxHills    = 256
+)
+
+type problems struct {
+	e []string
+	n int
+}
+
+func (p *problems) err() error {
+	if p.n == 0 {
+		return nil
+	}
+	return p
+}
+func (p *problems) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid data: ")
+	b.WriteString(strings.Join(p.e, "; "))
+	if p.n > len(p.e) {
+		b.WriteString(" (and " + strconv.Itoa(p.n-len(p.e)) + " more)")
+	}
+	return b.String()
+}
+func (p *problems) add(s ...string) {
+	if p.n++; len(p.e) >= maxProblems {
+		return
+	}
+	p.e = append(p.e, strings.Join(s, ""))
+}
+
+// TeamLimit sets the most teams that a Game read from the Source can have, which is
+// also the most solvers kept for each challenge. A Game with more teams is rejected,
+// and the solvers over the limit are removed. Zero uses the default limit of 256.
+func (m *Manager) TeamLimit(n int) {
+	if n < 0 {
+		return
+	}
+	m.lock.Lock()
+	m.teamMax = n
+	m.lock.Unlock()
+}
+func (m *Manager) teamLimit() int {
+	m.lock.Lock()
+	n := m.teamMax
+	if m.lock.Unlock(); n == 0 {
+		return maxTeams
+	}
+	return n
+}
+
+// validate returns an error if the Game has invalid or too many values. The solvers of
+// each challenge over the team limit k are removed, the first solvers are kept, and
+// the number of challenges changed is returned.
+func (g *game) validate(k int) (int, error) {
+	var p problems
+	g.Meta.check(&p, "game")
+	length(&p, "game credit", g.Credit, maxText)
+	length(&p, "game message", g.Message, maxText)
+	if len(g.Teams) > k {
+		p.add("game has ", strconv.Itoa(len(g.Teams)), " teams, more than the limit of ", strconv.Itoa(k))
+	}
+	if len(g.Events.Current) > maxEvents {
+		p.add("game has ", strconv.Itoa(len(g.Events.Current)), " events, more than the limit of ", strconv.Itoa(maxEvents))
+	}
+	t := make(map[uint64]struct{}, len(g.Teams))
+	for i := range g.Teams {
+		n := "team[" + strconv.Itoa(i) + "]"
+		if g.Teams[i].ID == 0 {
+			p.add(n, " is missing an id")
+		} else if _, ok := t[g.Teams[i].ID]; ok {
+			p.add(n, " has a duplicate id ", strconv.FormatUint(g.Teams[i].ID, 10))
+		}
+		t[g.Teams[i].ID] = struct{}{}
+		g.Teams[i].check(&p, n)
+	}
+	for i := range g.Events.Current {
+		g.Events.Current[i].check(&p, "event["+strconv.Itoa(i)+"]")
+	}
+	if len(g.Challenges) > maxSolvable {
+		p.add("game has ", strconv.Itoa(len(g.Challenges)), " challenges, more than the limit of ", strconv.Itoa(maxSolvable))
+	}
+	var c int
+	for i := range g.Challenges {
+		if g.Challenges[i].check(&p, "challenge["+strconv.Itoa(i)+"]"); len(g.Challenges[i].Solvers) > k {
+			g.Challenges[i].Solvers, c = g.Challenges[i].Solvers[:k], c+1
+		}
+	}
+	if len(g.Hills) > maxHills {
+		p.add("game has ", strconv.Itoa(len(g.Hills)), " hills, more than the limit of ", strconv.Itoa(maxHills))
+	}
+	for i := range g.Hills {
+		g.Hills[i].check(&p, "hill["+strconv.Itoa(i)+"]")
+	}
+	return c, p.err()
+}
+func validMeta(g []meta) error {
+	var p problems
+	if len(g) > maxGames {
+		p.add("source returned ", strconv.Itoa(len(g)), " games, more than the limit of ", strconv.Itoa(maxGames))
+	}
+	s := make(map[uint64]struct{}, len(g))
+	for i := range g {
+		n := "game[" + strconv.Itoa(i) + "]"
+		if g[i].ID == 0 {
+			p.add(n, " is missing an id")
+		} else if _, ok := s[g[i].ID]; ok {
+			p.add(n, " has a duplicate id ", strconv.FormatUint(g[i].ID, 10))
+		}
+		s[g[i].ID] = struct{}{}
+		g[i].check(&p, n)
+	}
+	return p.err()
+}
+func color(p *problems, n, s string) {
+	if len(s) == 0 {
+		return
+	}
+	if len(s) > maxColor {
+		p.add(n, " is longer than ", strconv.Itoa(maxColor), " characters")
+		return
+	}
+	for i := range s {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+		case s[i] >= 'a' && s[i] <= 'z':
+		case s[i] >= 'A' && s[i] <= 'Z':
+		case s[i] == '#' && i == 0:
+		default:
+			p.add(n, ` "`, s, `" is not a valid color`)
+			return
+		}
+	}
+}
+func (m meta) check(p *problems, n string) {
+	length(p, n+" name", m.Name, maxName)
+	if m.Mode > jeopardy {
+		p.add(n, " has an unknown mode ", strconv.Itoa(int(m.Mode)))
+	}
+	if m.Status > completed {
+		p.add(n, " has an unknown status ", strconv.Itoa(int(m.Status)))
+	}
+	if !m.End.IsZero() && !m.Start.IsZero() && m.End.Before(m.Start) {
+		p.add(n, " ends before it starts")
+	}
+}
+func (e event) check(p *problems, n string) {
+	if len(e.Data) > maxEventKey {
+		p.add(n, " has more than ", strconv.Itoa(maxEventKey), " data values")
+		return
+	}
+	for k, v := range e.Data {
+		length(p, n+" key", k, maxName)
+		length(p, n+` value "`+k+`"`, v, maxURL)
+	}
+}
+func length(p *problems, n, s string, l int) {
+	if len(s) > l {
+		p.add(n, " is longer than ", strconv.Itoa(l), " characters")
+	}
+}
+func (t *team) check(p *problems, n string) {
+	if len(t.Name) == 0 {
+		p.add(n, " is missing a name")
+	} else if len(t.Name) > maxName {
+		p.add(n, " name is longer than ", strconv.Itoa(maxName), " characters")
+	} else {
+		n += " " + strconv.Quote(t.Name)
+	}
+	if len(t.Logo) > maxURL {
+		p.add(n, " logo is longer than ", strconv.Itoa(maxURL), " characters")
+	} else if strings.ContainsAny(t.Logo, "'\"()\\\r\n") {
+		p.add(n, " logo contains invalid characters")
+	}
+	color(p, n+" color", t.Color)
+	if t.Score.Total > maxScore || t.Score.Total < -maxScore {
+		p.add(n, " score ", strconv.FormatInt(t.Score.Total, 10), " is out of range")
+	}
+	if t.Score.Health > maxScore || t.Score.Health < -maxScore {
+		p.add(n, " health ", strconv.FormatInt(t.Score.Health, 10), " is out of range")
+	}
+	if len(t.Hosts) > maxHosts {
+		p.add(n, " has ", strconv.Itoa(len(t.Hosts)), " hosts, more than the limit of ", strconv.Itoa(maxHosts))
+	}
+	if len(t.Beacons) > maxBeacons {
+		p.add(n, " has ", strconv.Itoa(len(t.Beacons)), " beacons, more than the limit of ", strconv.Itoa(maxBeacons))
+	}
+	h := make(map[uint64]struct{}, len(t.Hosts))
+	for i := range t.Hosts {
+		v := n + " host[" + strconv.Itoa(i) + "]"
+		if t.Hosts[i].ID == 0 {
+			p.add(v, " is missing an id")
+		} else if _, ok := h[t.Hosts[i].ID]; ok {
+			p.add(v, " has a duplicate id ", strconv.FormatUint(t.Hosts[i].ID, 10))
+		}
+		h[t.Hosts[i].ID] = struct{}{}
+		t.Hosts[i].check(p, v)
+	}
+	for i := range t.Beacons {
+		v := n + " beacon[" + strconv.Itoa(i) + "]"
+		if t.Beacons[i].ID == 0 {
+			p.add(v, " is missing an id")
+		}
+		color(p, v+" color", t.Beacons[i].Color)
+	}
+}
+func (h *host) check(p *problems, n string) {
+	length(p, n+" name", h.Name, maxName)
+	if len(h.Services) > maxServices {
+		p.add(n, " has ", strconv.Itoa(len(h.Services)), " services, more than the limit of ", strconv.Itoa(maxServices))
+	}
+	s := make(map[uint64]struct{}, len(h.Services))
+	for i := range h.Services {
+		v := n + " service[" + strconv.Itoa(i) + "]"
+		if h.Services[i].ID == 0 {
+			p.add(v, " is missing an id")
+		} else if _, ok := s[h.Services[i].ID]; ok {
+			p.add(v, " has a duplicate id ", strconv.FormatUint(h.Services[i].ID, 10))
+		}
+		s[h.Services[i].ID] = struct{}{}
+		if h.Services[i].State > red {
+			p.add(v, " has an unknown status ", strconv.Itoa(int(h.Services[i].State)))
+		}
+		if h.Services[i].Protocol > icmp {
+			p.add(v, " has an unknown protocol ", strconv.Itoa(int(h.Services[i].Protocol)))
+		}
+	}
+}
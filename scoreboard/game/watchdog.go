@@ -0,0 +1,145 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package game
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// watchdog restarts a Source that answers without errors but has stopped sending any
+// changes, such as a scoring engine with a stuck cache or a dead worker.
+type watchdog struct {
+	quiet   time.Duration
+	restart bool
+}
+
+// origin is the type and config of the Source, so it can be created again.
+type origin struct {
+	n string
+	c json.RawMessage
+}
+
+// Watchdog sets how long a running Game can go without any changes from the Source
+// before the Source is restarted. The Source is created again from its config and the
+// cached responses and idle connections are dropped. If there are still no changes
+// for the same time after the restart, a SourceStale Change is sent and the Source is
+// marked as failing until a change is seen. Games that are not active, or that have a
+// game clock that is paused, not started or ended, are not checked.
+//
+// A duration of zero or less disables the watchdog.
+func (m *Manager) Watchdog(d time.Duration) {
+	m.lock.Lock()
+	m.watchdog.quiet = d
+	m.lock.Unlock()
+}
+
+// heed marks that the Source sent a change for the Game, which clears any restart or
+// alert of the watchdog.
+func (s *subscription) heed(m *Manager, n time.Time) {
+	if s.heard = n; s.revived.IsZero() {
+		return
+	}
+	if s.revived = (time.Time{}); !s.alerted {
+		m.log.Info("Source sent changes for Game %d again after it was restarted.", s.ID)
+		return
+	}
+	s.alerted = false
+	m.Status("watchdog-"+strconv.FormatUint(s.ID, 10), time.Time{})
+	m.log.Info("Source sent changes for Game %d again, it is no longer stale.", s.ID)
+}
+
+// idle checks that the Source sent a change for the Game within the watchdog time and
+// asks for a restart of the Source when it did not. The returned SourceStale Change is
+// only sent once, when the Source sent no changes for the watchdog time after it was
+// restarted.
+func (s *subscription) idle(m *Manager, n time.Time) []Change {
+	m.lock.Lock()
+	d := m.watchdog.quiet
+	m.lock.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	if s.heard.IsZero() || !s.running(m) {
+		s.heard = n
+		return nil
+	}
+	if n.Sub(s.heard) < d {
+		return nil
+	}
+	if s.revived.IsZero() {
+		m.log.Warning("Source sent no changes for Game %d in %s, restarting the Source!", s.ID, d.String())
+		s.revived, s.heard = n, n
+		m.lock.Lock()
+		m.watchdog.restart = true
+		m.lock.Unlock()
+		return nil
+	}
+	if s.alerted {
+		return nil
+	}
+	s.alerted = true
+	m.Status("watchdog-"+strconv.FormatUint(s.ID, 10), s.revived)
+	m.log.Error("Source still sent no changes for Game %d in %s after it was restarted!", s.ID, n.Sub(s.revived).Round(time.Second).String())
+	t := n.Sub(s.revived) + d
+	return []Change{{
+		Time: n, Kind: SourceStale, Game: s.last.Meta.Name, GameID: s.ID, New: int64(t / time.Second),
+		Text: "The source sent no changes in " + t.Round(time.Second).String() + ", even after it was restarted",
+	}}
+}
+
+// running returns true if the Game is expected to change, as it is active and its game
+// clock, if any, is running.
+func (s *subscription) running(m *Manager) bool {
+	if !s.last.Meta.Active() {
+		return false
+	}
+	c, ok := m.Countdown(s.ID)
+	return !ok || (c.Started && !c.Paused && !c.Ended)
+}
+
+// revive creates the Source again if the watchdog asked for a restart, and drops the
+// cached responses and idle connections so the next requests start over. This must be
+// called from the update thread once the subscriptions are updated.
+func (m *Manager) revive() {
+	// The Source is not replaced while a Game is still being fetched from it in the
+	// background, so the restart waits for a later tick.
+	for _, s := range m.subs {
+		if s.busy {
+			return
+		}
+	}
+	m.lock.Lock()
+	r := m.watchdog.restart
+	m.watchdog.restart = false
+	m.lock.Unlock()
+	if !r {
+		return
+	}
+	v, err := source(m, m.origin.n, m.origin.c)
+	if err != nil {
+		m.log.Error("Unable to restart the Source: %s!", err.Error())
+		return
+	}
+	m.source = v
+	m.cache.Lock()
+	m.cache.e = nil
+	m.cache.Unlock()
+	m.client.CloseIdleConnections()
+	m.log.Info("Restarted the Source, as it sent no changes for the watchdog time.")
+}
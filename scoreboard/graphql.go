@@ -0,0 +1,1212 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	graphBody    = 1 << 16
+	graphDepth   = 16
+	graphEvents  = 100
+	graphQueries = 64
+)
+
+// graphSchema is the schema of the GraphQL API. Introspection is not supported, so the
+// schema is returned by a GET request without a query instead.
+const graphSchema = `type Query {
+  # Games of the main game, or of the named game route.
+  games(name: String): [Game!]!
+  # Game with the ID, or the current Game of the main game or the named game route.
+  game(id: ID, name: String): Game
+}
+type Game {
+  id: ID!
+  name: String!
+  mode: String!
+  status: String!
+  active: Boolean!
+  start: String
+  end: String
+  # Time of the current standings.
+  time: String
+  divisions: [String!]!
+  # Teams in rank order, limited to the first teams and a single division if set.
+  teams(first: Int, division: String): [Team!]!
+  team(id: ID!): Team
+  # Recorded events, most recent first (Requires history, at most 100).
+  events(last: Int = 10, kind: String): [Event!]!
+  clock: Clock
+}
+type Team {
+  id: ID!
+  name: String!
+  division: String
+  score: Int!
+  health: Int!
+  rank: Int!
+  # Points gained and ranks moved up, or down if negative, since the standings last changed.
+  delta: Int!
+  movement: Int!
+  # Recorded events of the team, most recent first (Requires history, at most 100).
+  events(last: Int = 10, kind: String): [Event!]!
+}
+type Event {
+  time: String!
+  kind: String!
+  text: String!
+  teamId: ID
+  team: Team
+}
+type Clock {
+  start: String
+  end: String
+  # Seconds left on the clock.
+  remaining: Int!
+  paused: Boolean!
+  started: Boolean!
+  ended: Boolean!
+}
+`
+
+// literal is a GraphQL input value. The kind is the first character of the value type,
+// "$" for a variable, "i" for an int, "f" for a float, "s" for a string, "b" for a
+// boolean, "n" for null, "e" for an enum, "l" for a list and "o" for an object.
+type literal struct {
+	obj  map[string]literal
+	text string
+	list []literal
+	kind byte
+}
+
+// selection is a field, a named fragment spread or an inline fragment of a selection
+// set. Fragment spreads use the name of the fragment as the name.
+type selection struct {
+	args   map[string]literal
+	dirs   map[string]map[string]literal
+	alias  string
+	name   string
+	on     string
+	sub    []*selection
+	spread bool
+	inline bool
+}
+type operation struct {
+	vars map[string]literal
+	name string
+	kind string
+	sel  []*selection
+}
+type document struct {
+	frags map[string]*selection
+	ops   []*operation
+}
+type parser struct {
+	s     string
+	i     int
+	depth int
+}
+
+// graph is the execution of a single GraphQL request.
+type graph struct {
+	x      context.Context
+	s      *Scoreboard
+	doc    *document
+	vars   map[string]interface{}
+	errs   []graphError
+	public bool
+	reads  int
+}
+type graphError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+type member struct {
+	v interface{}
+	k string
+}
+type object []member
+
+// node is a GraphQL object type, which returns the value of each of its fields.
+type node interface {
+	kind() string
+	resolve(*graph, *selection) (interface{}, error)
+}
+type root struct{}
+type match struct {
+	m      *game.Manager
+	snap   *game.Snapshot
+	start  time.Time
+	end    time.Time
+	name   string
+	mode   string
+	status string
+	id     uint64
+	active bool
+	loaded bool
+}
+type contender struct {
+	g *match
+	v game.Standing
+}
+type occurrence struct {
+	g *match
+	v game.Record
+}
+type timer game.Countdown
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(o[i].k)
+		v, err := json.Marshal(o[i].v)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+func (p *parser) fail(m string) error {
+	return &errval{s: "syntax error at position " + strconv.Itoa(p.i) + ": " + m}
+}
+func (p *parser) skip() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r', ',':
+			p.i++
+		case '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			if strings.HasPrefix(p.s[p.i:], "\uFEFF") {
+				p.i += 3
+				continue
+			}
+			return
+		}
+	}
+}
+func (p *parser) peek() byte {
+	if p.skip(); p.i >= len(p.s) {
+		return 0
+	}
+	return p.s[p.i]
+}
+func (p *parser) eat(c byte) bool {
+	if p.peek() == c {
+		p.i++
+		return true
+	}
+	return false
+}
+func (p *parser) expect(c byte) error {
+	if !p.eat(c) {
+		return p.fail(`expected "` + string(c) + `"`)
+	}
+	return nil
+}
+func (p *parser) name() (string, error) {
+	p.skip()
+	s := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (p.i > s && c >= '0' && c <= '9') {
+			p.i++
+			continue
+		}
+		break
+	}
+	if p.i == s {
+		return "", p.fail("expected a name")
+	}
+	return p.s[s:p.i], nil
+}
+
+// parse parses the GraphQL document, which can only contain operations and fragments.
+func parse(s string) (*document, error) {
+	var (
+		p = &parser{s: s}
+		d = &document{frags: make(map[string]*selection)}
+	)
+	for p.peek() != 0 {
+		if p.peek() == '{' {
+			v, err := p.selections()
+			if err != nil {
+				return nil, err
+			}
+			d.ops = append(d.ops, &operation{kind: "query", sel: v})
+			continue
+		}
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch n {
+		case "query", "mutation", "subscription":
+			o := &operation{kind: n, vars: make(map[string]literal)}
+			if c := p.peek(); c != '(' && c != '{' && c != '@' {
+				if o.name, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if p.eat('(') {
+				for !p.eat(')') {
+					if err = p.variable(o); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if _, err = p.directives(); err != nil {
+				return nil, err
+			}
+			if o.sel, err = p.selections(); err != nil {
+				return nil, err
+			}
+			d.ops = append(d.ops, o)
+		case "fragment":
+			f := &selection{spread: true}
+			if f.name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if v, err := p.name(); err != nil || v != "on" {
+				return nil, p.fail(`expected "on"`)
+			}
+			if f.on, err = p.name(); err != nil {
+				return nil, err
+			}
+			if _, err = p.directives(); err != nil {
+				return nil, err
+			}
+			if f.sub, err = p.selections(); err != nil {
+				return nil, err
+			}
+			if _, ok := d.frags[f.name]; ok {
+				return nil, &errval{s: `fragment "` + f.name + `" is defined more than once`}
+			}
+			d.frags[f.name] = f
+		default:
+			return nil, p.fail(`unexpected "` + n + `"`)
+		}
+	}
+	if len(d.ops) == 0 {
+		return nil, &errval{s: "document does not contain an operation"}
+	}
+	return d, nil
+}
+
+// variable parses a variable definition. The type is only checked for its syntax, the
+// arguments check the type of each value instead.
+func (p *parser) variable(o *operation) error {
+	if err := p.expect('$'); err != nil {
+		return err
+	}
+	n, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err = p.expect(':'); err != nil {
+		return err
+	}
+	if err = p.kind(0); err != nil {
+		return err
+	}
+	var v literal
+	if p.eat('=') {
+		if v, err = p.value(true); err != nil {
+			return err
+		}
+	}
+	o.vars[n] = v
+	_, err = p.directives()
+	return err
+}
+func (p *parser) kind(d int) error {
+	if d > graphDepth {
+		return p.fail("type is too deep")
+	}
+	if p.eat('[') {
+		if err := p.kind(d + 1); err != nil {
+			return err
+		}
+		if err := p.expect(']'); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	p.eat('!')
+	return nil
+}
+func (p *parser) directives() (map[string]map[string]literal, error) {
+	var d map[string]map[string]literal
+	for p.eat('@') {
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			d = make(map[string]map[string]literal)
+		}
+		if d[n], err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+func (p *parser) arguments() (map[string]literal, error) {
+	if !p.eat('(') {
+		return nil, nil
+	}
+	a := make(map[string]literal)
+	for !p.eat(')') {
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(':'); err != nil {
+			return nil, err
+		}
+		if a[n], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+func (p *parser) selections() ([]*selection, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	if p.depth++; p.depth > graphDepth {
+		return nil, p.fail("query is too deep")
+	}
+	var (
+		o   []*selection
+		err error
+	)
+	for !p.eat('}') {
+		if p.peek() == 0 {
+			return nil, p.fail(`expected "}"`)
+		}
+		v := new(selection)
+		if strings.HasPrefix(p.s[p.i:], "...") {
+			p.i += 3
+			switch c := p.peek(); {
+			case c == '{' || c == '@':
+				v.inline = true
+			default:
+				if v.name, err = p.name(); err != nil {
+					return nil, err
+				}
+				if v.name == "on" {
+					v.inline, v.name = true, ""
+					if v.on, err = p.name(); err != nil {
+						return nil, err
+					}
+				} else {
+					v.spread = true
+				}
+			}
+			if v.dirs, err = p.directives(); err != nil {
+				return nil, err
+			}
+			if v.inline {
+				if v.sub, err = p.selections(); err != nil {
+					return nil, err
+				}
+			}
+			o = append(o, v)
+			continue
+		}
+		if v.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if p.eat(':') {
+			v.alias = v.name
+			if v.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if v.args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+		if v.dirs, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '{' {
+			if v.sub, err = p.selections(); err != nil {
+				return nil, err
+			}
+		}
+		o = append(o, v)
+	}
+	p.depth--
+	if len(o) == 0 {
+		return nil, p.fail("selection set cannot be empty")
+	}
+	return o, nil
+}
+func (p *parser) value(c bool) (literal, error) {
+	switch x := p.peek(); {
+	case x == '$':
+		if c {
+			return literal{}, p.fail("variables cannot be used in default values")
+		}
+		p.i++
+		n, err := p.name()
+		return literal{kind: '$', text: n}, err
+	case x == '"':
+		s, err := p.str()
+		return literal{kind: 's', text: s}, err
+	case x == '-' || (x >= '0' && x <= '9'):
+		s, k := p.i, byte('i')
+		if p.s[p.i] == '-' {
+			p.i++
+		}
+		for p.i < len(p.s) {
+			switch v := p.s[p.i]; {
+			case v >= '0' && v <= '9':
+			case v == '.' || v == 'e' || v == 'E' || ((v == '+' || v == '-') && k == 'f'):
+				k = 'f'
+			default:
+				return p.number(s, k)
+			}
+			p.i++
+		}
+		return p.number(s, k)
+	case x == '[':
+		p.i++
+		if p.depth++; p.depth > graphDepth {
+			return literal{}, p.fail("value is too deep")
+		}
+		v := literal{kind: 'l', list: []literal{}}
+		for !p.eat(']') {
+			if p.peek() == 0 {
+				return literal{}, p.fail(`expected "]"`)
+			}
+			e, err := p.value(c)
+			if err != nil {
+				return literal{}, err
+			}
+			v.list = append(v.list, e)
+		}
+		p.depth--
+		return v, nil
+	case x == '{':
+		p.i++
+		if p.depth++; p.depth > graphDepth {
+			return literal{}, p.fail("value is too deep")
+		}
+		v := literal{kind: 'o', obj: make(map[string]literal)}
+		for !p.eat('}') {
+			n, err := p.name()
+			if err != nil {
+				return literal{}, err
+			}
+			if err = p.expect(':'); err != nil {
+				return literal{}, err
+			}
+			if v.obj[n], err = p.value(c); err != nil {
+				return literal{}, err
+			}
+		}
+		p.depth--
+		return v, nil
+	}
+	n, err := p.name()
+	if err != nil {
+		return literal{}, p.fail("expected a value")
+	}
+	switch n {
+	case "true", "false":
+		return literal{kind: 'b', text: n}, nil
+	case "null":
+		return literal{kind: 'n'}, nil
+	}
+	return literal{kind: 'e', text: n}, nil
+}
+func (p *parser) number(s int, k byte) (literal, error) {
+	v := literal{kind: k, text: p.s[s:p.i]}
+	if _, err := strconv.ParseFloat(v.text, 64); err != nil {
+		return literal{}, p.fail(`number "` + v.text + `" is not valid`)
+	}
+	return v, nil
+}
+
+// str parses a string value. Block strings are returned as they are, without removing
+// the common indentation.
+func (p *parser) str() (string, error) {
+	if strings.HasPrefix(p.s[p.i:], `"""`) {
+		e := strings.Index(p.s[p.i+3:], `"""`)
+		if e < 0 {
+			return "", p.fail("block string is not closed")
+		}
+		v := p.s[p.i+3 : p.i+3+e]
+		p.i += e + 6
+		return v, nil
+	}
+	s := p.i
+	for p.i++; p.i < len(p.s); p.i++ {
+		switch p.s[p.i] {
+		case '\\':
+			p.i++
+		case '\n', '\r':
+			return "", p.fail("string is not closed")
+		case '"':
+			p.i++
+			// JSON strings use the same escapes, except for "\/" which is also valid.
+			var v string
+			if err := json.Unmarshal([]byte(p.s[s:p.i]), &v); err != nil {
+				return "", p.fail("string is not valid")
+			}
+			return v, nil
+		}
+	}
+	return "", p.fail("string is not closed")
+}
+
+// operation returns the operation to run, which must be named if the document has
+// more than one operation.
+func (d *document) operation(n string) (*operation, error) {
+	var o *operation
+	switch {
+	case len(n) > 0:
+		for i := range d.ops {
+			if d.ops[i].name == n {
+				o = d.ops[i]
+				break
+			}
+		}
+		if o == nil {
+			return nil, &errval{s: `operation "` + n + `" does not exist`}
+		}
+	case len(d.ops) > 1:
+		return nil, &errval{s: "operationName is required when the document has more than one operation"}
+	default:
+		o = d.ops[0]
+	}
+	if o.kind != "query" {
+		return nil, &errval{s: `operation type "` + o.kind + `" is not supported, only queries can be used`}
+	}
+	return o, nil
+}
+func (g *graph) input(v literal) interface{} {
+	switch v.kind {
+	case '$':
+		return g.vars[v.text]
+	case 'i':
+		n, err := strconv.ParseInt(v.text, 10, 64)
+		if err != nil {
+			return v.text
+		}
+		return n
+	case 'f':
+		n, _ := strconv.ParseFloat(v.text, 64)
+		return n
+	case 's', 'e':
+		return v.text
+	case 'b':
+		return v.text == "true"
+	case 'l':
+		o := make([]interface{}, len(v.list))
+		for i := range v.list {
+			o[i] = g.input(v.list[i])
+		}
+		return o
+	case 'o':
+		o := make(map[string]interface{}, len(v.obj))
+		for k, e := range v.obj {
+			o[k] = g.input(e)
+		}
+		return o
+	}
+	return nil
+}
+func (g *graph) integer(f *selection, n string, d int64) (int64, error) {
+	v, ok := f.args[n]
+	if !ok {
+		return d, nil
+	}
+	switch i := g.input(v).(type) {
+	case nil:
+		return d, nil
+	case int64:
+		return i, nil
+	case json.Number:
+		if r, err := i.Int64(); err == nil {
+			return r, nil
+		}
+	case float64:
+		if i == float64(int64(i)) {
+			return int64(i), nil
+		}
+	}
+	return 0, &errval{s: `argument "` + n + `" must be an Int`}
+}
+func (g *graph) text(f *selection, n string) (string, error) {
+	v, ok := f.args[n]
+	if !ok {
+		return "", nil
+	}
+	switch i := g.input(v).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return i, nil
+	}
+	return "", &errval{s: `argument "` + n + `" must be a String`}
+}
+func (g *graph) id(f *selection, n string) (uint64, error) {
+	v, ok := f.args[n]
+	if !ok {
+		return 0, nil
+	}
+	var s string
+	switch i := g.input(v).(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if i >= 0 {
+			return uint64(i), nil
+		}
+	case json.Number:
+		s = i.String()
+	case float64:
+		if i >= 0 && i == float64(int64(i)) {
+			return uint64(i), nil
+		}
+	case string:
+		s = i
+	}
+	r, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, &errval{s: `argument "` + n + `" must be a valid ID`}
+	}
+	return r, nil
+}
+
+// included returns false if the selection has a "skip" directive that is true or an
+// "include" directive that is false.
+func (g *graph) included(s *selection) bool {
+	if v, ok := s.dirs["skip"]; ok {
+		if b, _ := g.input(v["if"]).(bool); b {
+			return false
+		}
+	}
+	if v, ok := s.dirs["include"]; ok {
+		if b, _ := g.input(v["if"]).(bool); !b {
+			return false
+		}
+	}
+	return true
+}
+
+// collect adds the fields of the selection set to the map by their response name,
+// following the fragments that apply to the type.
+func (g *graph) collect(t string, s []*selection, o *[]string, m map[string][]*selection, u map[string]bool) error {
+	for _, v := range s {
+		if !g.included(v) {
+			continue
+		}
+		switch {
+		case v.spread:
+			f, ok := g.doc.frags[v.name]
+			if !ok {
+				return &errval{s: `fragment "` + v.name + `" does not exist`}
+			}
+			if u[v.name] {
+				return &errval{s: `fragment "` + v.name + `" cannot spread itself`}
+			}
+			if f.on != t {
+				continue
+			}
+			u[v.name] = true
+			err := g.collect(t, f.sub, o, m, u)
+			if delete(u, v.name); err != nil {
+				return err
+			}
+		case v.inline:
+			if len(v.on) > 0 && v.on != t {
+				continue
+			}
+			if err := g.collect(t, v.sub, o, m, u); err != nil {
+				return err
+			}
+		default:
+			k := v.alias
+			if len(k) == 0 {
+				k = v.name
+			}
+			if _, ok := m[k]; !ok {
+				*o = append(*o, k)
+			}
+			m[k] = append(m[k], v)
+		}
+	}
+	return nil
+}
+func (g *graph) fail(p []interface{}, err error) {
+	g.errs = append(g.errs, graphError{Message: err.Error(), Path: append([]interface{}(nil), p...)})
+}
+
+// object returns the selected fields of the node. Fields with the same response name
+// are merged, like the fields selected by more than one fragment.
+func (g *graph) object(n node, s []*selection, p []interface{}) interface{} {
+	var (
+		t = n.kind()
+		k []string
+		m = make(map[string][]*selection)
+	)
+	if err := g.collect(t, s, &k, m, make(map[string]bool)); err != nil {
+		g.fail(p, err)
+		return nil
+	}
+	o := make(object, 0, len(k))
+	for _, r := range k {
+		var (
+			f = m[r][0]
+			c = append(p, r)
+		)
+		if f.name == "__typename" {
+			o = append(o, member{k: r, v: t})
+			continue
+		}
+		v, err := n.resolve(g, f)
+		if err != nil {
+			g.fail(c, err)
+			o = append(o, member{k: r})
+			continue
+		}
+		var u []*selection
+		for _, x := range m[r] {
+			u = append(u, x.sub...)
+		}
+		o = append(o, member{k: r, v: g.complete(f, v, u, c)})
+	}
+	return o
+}
+func (g *graph) complete(f *selection, v interface{}, s []*selection, p []interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case []node:
+		if len(s) == 0 {
+			g.fail(p, &errval{s: `field "` + f.name + `" is a list of objects and must have a selection of subfields`})
+			return nil
+		}
+		o := make([]interface{}, len(x))
+		for i := range x {
+			o[i] = g.complete(f, x[i], s, append(p, i))
+		}
+		return o
+	case node:
+		if len(s) == 0 {
+			g.fail(p, &errval{s: `field "` + f.name + `" of type "` + x.kind() + `" must have a selection of subfields`})
+			return nil
+		}
+		return g.object(x, s, p)
+	}
+	if len(s) > 0 {
+		g.fail(p, &errval{s: `field "` + f.name + `" does not have subfields`})
+		return nil
+	}
+	return v
+}
+func unknown(t string, f *selection) error {
+	return &errval{s: `field "` + f.name + `" does not exist on type "` + t + `"`}
+}
+func stamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+// route returns the Manager of the named game route, or the main Manager if the name
+// is empty.
+func (g *graph) route(n string) (*game.Manager, error) {
+	if len(n) == 0 {
+		return g.s.Manager, nil
+	}
+	m := g.s.arena(n)
+	if m == nil {
+		return nil, &errval{s: `game "` + n + `" does not exist`}
+	}
+	return m, nil
+}
+
+// events returns the most recent recorded events of the Game, or of a single team if
+// the team ID is not zero.
+func (g *graph) events(m *match, f *selection, t uint64) (interface{}, error) {
+	if g.s.store == nil {
+		return nil, &errval{s: "history is not enabled"}
+	}
+	n, err := g.integer(f, "last", 10)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > graphEvents {
+		return nil, &errval{s: `argument "last" must be between 0 and ` + strconv.Itoa(graphEvents)}
+	}
+	k, err := g.text(f, "kind")
+	if err != nil {
+		return nil, err
+	}
+	if g.reads++; g.reads > graphQueries {
+		return nil, &errval{s: "query reads the history too many times"}
+	}
+	// Public requests only read the events up to the freeze, the same as the display.
+	var e time.Time
+	if v, ok := held(m.m, m.id); ok && g.public {
+		e = v
+	}
+	r, err := g.s.store.Latest(g.x, m.id, t, k, e, n)
+	if err != nil {
+		g.s.log.Error("Unable to read the events of Game %d: %s!", m.id, err.Error())
+		return nil, &errval{s: "events could not be read"}
+	}
+	var x *strings.Replacer
+	if g.public && m.m.Anonymous() {
+		x = replacer(m.m, m.id)
+	}
+	o := make([]node, len(r))
+	for i := range r {
+		if x != nil {
+			r[i].Text = x.Replace(r[i].Text)
+		}
+		o[i] = &occurrence{g: m, v: r[i]}
+	}
+	return o, nil
+}
+
+// standings returns the current standings of the Game, which are read once for each
+// request. Public requests are returned the standings shown on the display, so the
+// live standings of a frozen Game are not shown.
+func (g *graph) standings(m *match) (game.Snapshot, bool) {
+	if !m.loaded {
+		var (
+			v  game.Snapshot
+			ok bool
+		)
+		if g.public {
+			v, ok = m.m.Displayed(m.id)
+		} else {
+			v, ok = m.m.Standings(m.id)
+		}
+		if ok {
+			if g.public {
+				v = m.m.Mask(v)
+			}
+			m.snap = &v
+		}
+		m.loaded = true
+	}
+	if m.snap == nil {
+		return game.Snapshot{}, false
+	}
+	return *m.snap, true
+}
+func (root) kind() string {
+	return "Query"
+}
+func (root) resolve(g *graph, f *selection) (interface{}, error) {
+	switch f.name {
+	case "__schema", "__type":
+		return nil, &errval{s: "introspection is not supported, the schema is returned by a GET request without a query"}
+	case "games":
+		n, err := g.text(f, "name")
+		if err != nil {
+			return nil, err
+		}
+		m, err := g.route(n)
+		if err != nil {
+			return nil, err
+		}
+		o := make([]node, 0, len(m.Games))
+		for i := range m.Games {
+			o = append(o, &match{
+				m: m, id: m.Games[i].ID, name: m.Games[i].Name, mode: m.Games[i].Mode.String(), status: m.Games[i].Status.String(),
+				start: m.Games[i].Start, end: m.Games[i].End, active: m.Games[i].Active(),
+			})
+		}
+		return o, nil
+	case "game":
+		n, err := g.text(f, "name")
+		if err != nil {
+			return nil, err
+		}
+		i, err := g.id(f, "id")
+		if err != nil {
+			return nil, err
+		}
+		m, err := g.route(n)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			if i = current(m); i == 0 {
+				return nil, nil
+			}
+		}
+		v := &match{m: m, id: i}
+		for x := range m.Games {
+			if m.Games[x].ID != i {
+				continue
+			}
+			v.name, v.mode, v.status = m.Games[x].Name, m.Games[x].Mode.String(), m.Games[x].Status.String()
+			v.start, v.end, v.active = m.Games[x].Start, m.Games[x].End, m.Games[x].Active()
+			return v, nil
+		}
+		// Games that are not listed by the source can still be tracked, such as the
+		// Games of a replay.
+		s, ok := g.standings(v)
+		if !ok {
+			return nil, nil
+		}
+		v.name, v.active = s.Game, true
+		return v, nil
+	}
+	return nil, unknown("Query", f)
+}
+func (*match) kind() string {
+	return "Game"
+}
+func (m *match) resolve(g *graph, f *selection) (interface{}, error) {
+	switch f.name {
+	case "id":
+		return strconv.FormatUint(m.id, 10), nil
+	case "name":
+		return m.name, nil
+	case "mode":
+		return m.mode, nil
+	case "status":
+		return m.status, nil
+	case "active":
+		return m.active, nil
+	case "start":
+		return stamp(m.start), nil
+	case "end":
+		return stamp(m.end), nil
+	case "time":
+		s, _ := g.standings(m)
+		return stamp(s.Time), nil
+	case "divisions":
+		s, _ := g.standings(m)
+		if d := s.Divisions(); d != nil {
+			return d, nil
+		}
+		return []string{}, nil
+	case "teams":
+		d, err := g.text(f, "division")
+		if err != nil {
+			return nil, err
+		}
+		n, err := g.integer(f, "first", -1)
+		if err != nil {
+			return nil, err
+		}
+		s, _ := g.standings(m)
+		if len(d) > 0 {
+			s = s.Division(d)
+		}
+		if n >= 0 && int64(len(s.Teams)) > n {
+			s.Teams = s.Teams[:n]
+		}
+		o := make([]node, len(s.Teams))
+		for i := range s.Teams {
+			o[i] = &contender{g: m, v: s.Teams[i]}
+		}
+		return o, nil
+	case "team":
+		i, err := g.id(f, "id")
+		if err != nil {
+			return nil, err
+		}
+		return m.team(g, i), nil
+	case "events":
+		return g.events(m, f, 0)
+	case "clock":
+		c, ok := m.m.Countdown(m.id)
+		if !ok {
+			return nil, nil
+		}
+		return timer(c), nil
+	}
+	return nil, unknown("Game", f)
+}
+func (m *match) team(g *graph, i uint64) node {
+	s, _ := g.standings(m)
+	for x := range s.Teams {
+		if s.Teams[x].ID == i {
+			return &contender{g: m, v: s.Teams[x]}
+		}
+	}
+	return nil
+}
+func (*contender) kind() string {
+	return "Team"
+}
+func (c *contender) resolve(g *graph, f *selection) (interface{}, error) {
+	switch f.name {
+	case "id":
+		return strconv.FormatUint(c.v.ID, 10), nil
+	case "name":
+		return c.v.Name, nil
+	case "division":
+		if len(c.v.Division) == 0 {
+			return nil, nil
+		}
+		return c.v.Division, nil
+	case "score":
+		return c.v.Score, nil
+	case "health":
+		return c.v.Health, nil
+	case "rank":
+		return c.v.Rank, nil
+	case "delta":
+		return c.v.Delta, nil
+	case "movement":
+		return c.v.Movement, nil
+	case "events":
+		return g.events(c.g, f, c.v.ID)
+	}
+	return nil, unknown("Team", f)
+}
+func (*occurrence) kind() string {
+	return "Event"
+}
+func (e *occurrence) resolve(g *graph, f *selection) (interface{}, error) {
+	switch f.name {
+	case "time":
+		return stamp(e.v.Time), nil
+	case "kind":
+		return e.v.Kind, nil
+	case "text":
+		return e.v.Text, nil
+	case "teamId":
+		if e.v.Team == 0 {
+			return nil, nil
+		}
+		return strconv.FormatUint(e.v.Team, 10), nil
+	case "team":
+		if e.v.Team == 0 {
+			return nil, nil
+		}
+		return e.g.team(g, e.v.Team), nil
+	}
+	return nil, unknown("Event", f)
+}
+func (timer) kind() string {
+	return "Clock"
+}
+func (c timer) resolve(_ *graph, f *selection) (interface{}, error) {
+	switch f.name {
+	case "start":
+		return stamp(c.Start), nil
+	case "end":
+		return stamp(c.End), nil
+	case "remaining":
+		return c.Remaining, nil
+	case "paused":
+		return c.Paused, nil
+	case "started":
+		return c.Started, nil
+	case "ended":
+		return c.Ended, nil
+	}
+	return nil, unknown("Clock", f)
+}
+func (s *Scoreboard) httpGraph(w http.ResponseWriter, r *http.Request) {
+	var q struct {
+		Variables map[string]interface{} `json:"variables"`
+		Query     string                 `json:"query"`
+		Operation string                 `json:"operationName"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		v := r.URL.Query()
+		if q.Query, q.Operation = v.Get("query"), v.Get("operationName"); len(q.Query) == 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(graphSchema))
+			return
+		}
+		if x := v.Get("variables"); len(x) > 0 {
+			d := json.NewDecoder(strings.NewReader(x))
+			if d.UseNumber(); d.Decode(&q.Variables) != nil {
+				fail(w, "variables must be a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		d := json.NewDecoder(http.MaxBytesReader(w, r.Body, graphBody))
+		if d.UseNumber(); d.Decode(&q) != nil {
+			fail(w, "request body is not valid JSON", http.StatusBadRequest)
+			return
+		}
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	d, err := parse(q.Query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]graphError{"errors": {{Message: err.Error()}}})
+		return
+	}
+	v, err := d.operation(q.Operation)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]graphError{"errors": {{Message: err.Error()}}})
+		return
+	}
+	g := &graph{x: r.Context(), s: s, doc: d, vars: make(map[string]interface{}, len(v.vars)), public: !s.permitted(r, true, scopeScores)}
+	for k, x := range v.vars {
+		if x.kind != 0 {
+			g.vars[k] = g.input(x)
+		}
+	}
+	for k, x := range q.Variables {
+		g.vars[k] = x
+	}
+	s.log.request(r).Debug(`Received GraphQL query from "%s"..`, r.RemoteAddr)
+	// The data is always returned once the query is run, even if it is null.
+	o := struct {
+		Data   interface{}  `json:"data"`
+		Errors []graphError `json:"errors,omitempty"`
+	}{Data: g.object(root{}, v.sel, nil)}
+	o.Errors = g.errs
+	json.NewEncoder(w).Encode(o)
+}
@@ -0,0 +1,490 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	grpcLimit  = 1 << 16
+	grpcBuffer = 256
+	grpcPrefix = "/scoreboard.v1.Scoreboard/"
+)
+
+// gRPC status codes, only the codes returned by the Scoreboard are listed.
+const (
+	grpcOK          = 0
+	grpcInvalid     = 3
+	grpcNotFound    = 5
+	grpcExhausted   = 8
+	grpcUnsupported = 12
+	grpcUnavailable = 14
+)
+
+type gateway struct {
+	Listen string `json:"listen"`
+}
+
+// pb is a protobuf message that is built one field at a time. Fields with the zero
+// value are not added, like any proto3 encoder.
+type pb []byte
+
+// streams are the gRPC watch calls, which are sent the Changes, Messages and Snapshots
+// of the Managers they watch.
+type streams struct {
+	subs map[*watcher]struct{}
+	lock sync.Mutex
+}
+type request struct {
+	name     string
+	division string
+	game     uint64
+}
+
+// watcher is a single gRPC watch call. The lost channel is closed if the client does
+// not read the stream fast enough and the buffer is full, as dropping an event would
+// leave the client with the wrong state.
+type watcher struct {
+	m      *game.Manager
+	out    chan interface{}
+	lost   chan struct{}
+	game   uint64
+	full   uint32
+	events bool
+}
+
+func (g gateway) verify(c *config) error {
+	if len(g.Listen) == 0 {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(g.Listen); err != nil {
+		return &errval{s: `grpc listen address "` + g.Listen + `" is not valid`, e: err}
+	}
+	if len(c.Cert) == 0 || len(c.Key) == 0 {
+		return &errval{s: "grpc requires a TLS certificate and key, as clients only use HTTP/2"}
+	}
+	return nil
+}
+func (p pb) varint(v uint64) pb {
+	for v >= 0x80 {
+		p = append(p, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(p, byte(v))
+}
+func (p pb) uint(f int, v uint64) pb {
+	if v == 0 {
+		return p
+	}
+	return p.varint(uint64(f) << 3).varint(v)
+}
+func (p pb) int(f int, v int64) pb {
+	return p.uint(f, uint64(v))
+}
+func (p pb) text(f int, s string) pb {
+	if len(s) == 0 {
+		return p
+	}
+	return append(p.varint(uint64(f)<<3|2).varint(uint64(len(s))), s...)
+}
+
+// field adds a length delimited field, even if it is empty, which is needed for each
+// entry of a repeated field.
+func (p pb) field(f int, b []byte) pb {
+	return append(p.varint(uint64(f)<<3|2).varint(uint64(len(b))), b...)
+}
+func (p pb) time(f int, t time.Time) pb {
+	if t.IsZero() {
+		return p
+	}
+	return p.field(f, pb(nil).int(1, t.Unix()).int(2, int64(t.Nanosecond())))
+}
+func team(v game.Standing) pb {
+	return pb(nil).uint(1, v.ID).text(2, v.Name).text(3, v.Division).int(4, v.Score).int(5, v.Health).int(6, v.Rank).int(7, v.Delta).int(8, v.Movement)
+}
+func standing(v game.Snapshot) pb {
+	p := pb(nil).time(1, v.Time).text(2, v.Game).uint(3, v.GameID)
+	for i := range v.Teams {
+		p = p.field(4, team(v.Teams[i]))
+	}
+	return p
+}
+func change(c game.Change) pb {
+	p := pb(nil).time(1, c.Time).text(2, c.Game).uint(3, c.GameID).text(4, c.Kind.String()).text(5, c.Team)
+	p = p.uint(6, c.TeamID).text(7, c.Host).text(8, c.Other).text(9, c.Text).int(10, c.Old).int(11, c.New)
+	return pb(nil).field(1, p.uint(12, uint64(c.Service)).uint(13, c.OtherID))
+}
+func notice(m game.Message) pb {
+	p := pb(nil).time(1, m.Time).text(2, m.Game).uint(3, m.GameID).uint(4, m.ID).uint(5, uint64(m.Type))
+	for k, v := range m.Data {
+		p = p.field(6, pb(nil).text(1, k).text(2, v))
+	}
+	return pb(nil).field(2, p)
+}
+
+// read reads the single request message of a call, only uncompressed messages are
+// accepted as the Scoreboard does not advertise any encodings.
+func (q *request) read(r io.Reader) error {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return &errval{s: "request message could not be read", e: err}
+	}
+	if h[0] != 0 {
+		return &errval{s: "compressed request messages are not supported"}
+	}
+	n := binary.BigEndian.Uint32(h[1:])
+	if n > grpcLimit {
+		return &errval{s: "request message of " + strconv.FormatUint(uint64(n), 10) + " bytes is too large"}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return &errval{s: "request message could not be read", e: err}
+	}
+	for len(b) > 0 {
+		t, i := binary.Uvarint(b)
+		if i <= 0 {
+			return &errval{s: "request message is not valid"}
+		}
+		b = b[i:]
+		switch t & 7 {
+		case 0:
+			v, i := binary.Uvarint(b)
+			if i <= 0 {
+				return &errval{s: "request message is not valid"}
+			}
+			if b = b[i:]; t>>3 == 1 {
+				q.game = v
+			}
+		case 1, 5:
+			n := 8
+			if t&7 == 5 {
+				n = 4
+			}
+			if len(b) < n {
+				return &errval{s: "request message is not valid"}
+			}
+			b = b[n:]
+		case 2:
+			v, i := binary.Uvarint(b)
+			if i <= 0 || v > uint64(len(b)-i) {
+				return &errval{s: "request message is not valid"}
+			}
+			switch s := string(b[i : i+int(v)]); t >> 3 {
+			case 2:
+				q.name = s
+			case 3:
+				q.division = s
+			}
+			b = b[i+int(v):]
+		default:
+			return &errval{s: "request message is not valid"}
+		}
+	}
+	return nil
+}
+func (v *streams) add(w *watcher) {
+	v.lock.Lock()
+	v.subs[w] = struct{}{}
+	v.lock.Unlock()
+}
+func (v *streams) remove(w *watcher) {
+	v.lock.Lock()
+	delete(v.subs, w)
+	v.lock.Unlock()
+}
+
+// attach adds the functions that send the Changes, Messages and Snapshots of the
+// Manager to the watch calls. Like the other hooks, these are only called by the
+// cluster leader.
+func (v *streams) attach(m *game.Manager) {
+	m.Hook(func(c game.Change) { v.publish(m, c.GameID, true, c) })
+	m.Listen(func(e game.Message) { v.publish(m, e.GameID, true, e) })
+	m.Watch(func(n game.Snapshot) { v.publish(m, n.GameID, false, n) })
+}
+func (v *streams) publish(m *game.Manager, g uint64, e bool, d interface{}) {
+	v.lock.Lock()
+	for w := range v.subs {
+		if w.m != m || w.game != g || w.events != e {
+			continue
+		}
+		select {
+		case w.out <- d:
+		default:
+			if atomic.CompareAndSwapUint32(&w.full, 0, 1) {
+				close(w.lost)
+			}
+		}
+	}
+	v.lock.Unlock()
+}
+
+// grpc returns the gRPC server, which is kept separate from the public server as the
+// watch calls are never finished, so the server cannot have a write timeout. gRPC
+// clients only use HTTP/2, so the server always uses TLS.
+func (s *Scoreboard) grpc(c *config, t time.Duration) *http.Server {
+	s.streams = &streams{subs: make(map[*watcher]struct{})}
+	s.streams.attach(s.Manager)
+	return &http.Server{
+		Addr:              c.RPC.Listen,
+		Handler:           http.HandlerFunc(s.httpRPC),
+		ErrorLog:          s.log.with("grpc").logger(),
+		TLSConfig:         &tls.Config{NextProtos: []string{"h2"}, MinVersion: tls.VersionTLS12},
+		ReadHeaderTimeout: t,
+	}
+}
+func (s *Scoreboard) httpRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	n := strings.TrimPrefix(r.URL.Path, grpcPrefix)
+	switch n {
+	case "ListTeams", "WatchEvents", "WatchScoreboard":
+	default:
+		status(w, grpcUnsupported, `method "`+r.URL.Path+`" is not implemented`)
+		return
+	}
+	var q request
+	if err := q.read(http.MaxBytesReader(w, r.Body, grpcLimit+5)); err != nil {
+		status(w, grpcInvalid, err.Error())
+		return
+	}
+	m := s.Manager
+	if len(q.name) > 0 {
+		if m = s.arena(q.name); m == nil {
+			status(w, grpcNotFound, `game "`+q.name+`" does not exist`)
+			return
+		}
+	}
+	if q.game == 0 {
+		q.game = current(m)
+	}
+	if q.game == 0 {
+		status(w, grpcInvalid, "a valid game ID is required")
+		return
+	}
+	a := s.permitted(r, false, scopeScores)
+	s.log.request(r).Debug(`Received gRPC call "%s" for Game %d from "%s".`, n, q.game, r.RemoteAddr)
+	switch n {
+	case "ListTeams":
+		// Callers without the scores scope are sent the standings shown on the display,
+		// so the live standings of a frozen Game are not shown.
+		var (
+			v  game.Snapshot
+			ok bool
+		)
+		if a {
+			v, ok = m.Standings(q.game)
+		} else {
+			v, ok = m.Displayed(q.game)
+		}
+		if !ok {
+			status(w, grpcNotFound, "game "+strconv.FormatUint(q.game, 10)+" is not being tracked")
+			return
+		}
+		if !a {
+			v = m.Mask(v)
+		}
+		d := v.Divisions()
+		if len(q.division) > 0 {
+			v = v.Division(q.division)
+		}
+		var p pb
+		for i := range v.Teams {
+			p = p.field(1, team(v.Teams[i]))
+		}
+		for i := range d {
+			p = p.field(2, []byte(d[i]))
+		}
+		if send(w, p) == nil {
+			status(w, grpcOK, "")
+		}
+	case "WatchEvents":
+		s.observe(r.Context(), w, &watcher{m: m, game: q.game, events: true}, func(d interface{}) pb {
+			// The events of a frozen Game are not sent to callers without the scores
+			// scope, the same as the display, as they show the live results.
+			if _, ok := held(m, q.game); ok && !a {
+				return nil
+			}
+			switch v := d.(type) {
+			case game.Change:
+				if !a && m.Anonymous() {
+					v = conceal(m, v)
+				}
+				return change(v)
+			case game.Message:
+				if !a && m.Anonymous() {
+					r := replacer(m, v.GameID)
+					o := make(map[string]string, len(v.Data))
+					for k, x := range v.Data {
+						if k == "text" || k == "other" {
+							x = r.Replace(x)
+						}
+						o[k] = x
+					}
+					v.Data = o
+				}
+				return notice(v)
+			}
+			return nil
+		})
+	case "WatchScoreboard":
+		f := func(d interface{}) pb {
+			v := d.(game.Snapshot)
+			if !a {
+				v = m.Mask(v)
+			}
+			if len(q.division) > 0 {
+				v = v.Division(q.division)
+			}
+			return standing(v)
+		}
+		// The current standings are sent first, so the client does not have to wait
+		// for the scores to change.
+		var (
+			v  game.Snapshot
+			ok bool
+		)
+		if a {
+			v, ok = m.Standings(q.game)
+		} else {
+			v, ok = m.Displayed(q.game)
+		}
+		if ok {
+			if send(w, f(v)) != nil {
+				return
+			}
+		}
+		s.observe(r.Context(), w, &watcher{m: m, game: q.game}, func(d interface{}) pb {
+			// The live standings of a frozen Game are not sent to callers without the
+			// scores scope until the Game is revealed.
+			if _, ok := held(m, q.game); ok && !a {
+				return nil
+			}
+			return f(d)
+		})
+	}
+}
+
+// observe sends each value sent to the watcher as a message, using the supplied function
+// to build the message, until the call is cancelled or the Scoreboard is stopped.
+func (s *Scoreboard) observe(x context.Context, w http.ResponseWriter, v *watcher, f func(interface{}) pb) {
+	v.out, v.lost = make(chan interface{}, grpcBuffer), make(chan struct{})
+	s.streams.add(v)
+	defer s.streams.remove(v)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	for {
+		select {
+		case <-x.Done():
+			status(w, grpcUnavailable, "scoreboard is shutting down")
+			return
+		case <-v.lost:
+			status(w, grpcExhausted, "stream was not read fast enough and events were lost")
+			return
+		case d := <-v.out:
+			if p := f(d); p != nil && send(w, p) != nil {
+				return
+			}
+		}
+	}
+}
+
+// send writes the message with the gRPC message prefix and flushes it to the client.
+func send(w http.ResponseWriter, p pb) error {
+	var h [5]byte
+	binary.BigEndian.PutUint32(h[1:], uint32(len(p)))
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(p); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// status sets the gRPC status trailers, which are sent once the handler returns.
+func status(w http.ResponseWriter, c int, m string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(c))
+	if len(m) == 0 {
+		return
+	}
+	var b strings.Builder
+	for i := 0; i < len(m); i++ {
+		if m[i] < 0x20 || m[i] > 0x7E || m[i] == '%' {
+			b.WriteString("%" + strings.ToUpper(strconv.FormatUint(uint64(m[i])>>4, 16)+strconv.FormatUint(uint64(m[i])&0xF, 16)))
+			continue
+		}
+		b.WriteByte(m[i])
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Message", b.String())
+}
+
+// replacer returns a Replacer that replaces the team names of the Game with their
+// pseudonyms. Longer names are replaced first, so names that contain other names are
+// not partially replaced.
+func replacer(m *game.Manager, g uint64) *strings.Replacer {
+	v, _ := m.Standings(g)
+	var (
+		t = make([]uint64, len(v.Teams))
+		n = make([]game.Standing, len(v.Teams))
+	)
+	for i := range v.Teams {
+		t[i], n[i] = v.Teams[i].ID, v.Teams[i]
+	}
+	p := m.Pseudonyms(t)
+	sort.SliceStable(n, func(i, j int) bool { return len(n[i].Name) > len(n[j].Name) })
+	l := make([]string, 0, len(n)*2)
+	for i := range n {
+		if len(n[i].Name) > 0 {
+			l = append(l, n[i].Name, p[n[i].ID])
+		}
+	}
+	return strings.NewReplacer(l...)
+}
+
+// conceal returns a copy of the Change with the team names replaced by their
+// pseudonyms. The host is removed, as host names often contain the team name.
+func conceal(m *game.Manager, c game.Change) game.Change {
+	r := replacer(m, c.GameID)
+	if p := m.Pseudonyms([]uint64{c.TeamID}); c.TeamID > 0 {
+		c.Team = p[c.TeamID]
+	} else {
+		c.Team = r.Replace(c.Team)
+	}
+	c.Other, c.Text, c.Host = r.Replace(c.Other), r.Replace(c.Text), ""
+	return c
+}
@@ -0,0 +1,148 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type probe struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+type readiness struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`
+	Checks []probe   `json:"checks"`
+}
+
+// ready runs the readiness checks. The Scoreboard is not ready if any check failed, a
+// disconnected Twitter stream only degrades the Scoreboard, since the scores are still
+// shown without the ticker.
+func (s *Scoreboard) ready(x context.Context) readiness {
+	r := readiness{Time: time.Now().UTC(), Status: "ready"}
+	switch {
+	case s.rotate == nil:
+		r.Checks = append(r.Checks, probe{Name: "twitter", Status: "disabled"})
+	case s.cluster != nil && !s.cluster.leading():
+		r.Checks = append(r.Checks, probe{Name: "twitter", Status: "ok", Detail: "stream is read by the cluster leader"})
+	case atomic.LoadUint32(&s.stats.stream) == 0:
+		r.Checks = append(r.Checks, probe{Name: "twitter", Status: "degraded", Detail: "stream is disconnected, waiting for new credentials"})
+	default:
+		r.Checks = append(r.Checks, probe{Name: "twitter", Status: "ok"})
+	}
+	n := make([]string, 0, len(s.games))
+	for k := range s.games {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	if s.cluster != nil {
+		if s.cluster.leading() {
+			r.Checks = append(r.Checks, probe{Name: "cluster", Status: "ok", Detail: `node "` + s.cluster.node + `" is the leader`})
+		} else {
+			r.Checks = append(r.Checks, probe{Name: "cluster", Status: "ok", Detail: `node "` + s.cluster.node + `" is following the leader`})
+		}
+	}
+	r.Checks = append(r.Checks, s.fresh("game", s.Stats().Updated, r.Time))
+	for _, k := range n {
+		r.Checks = append(r.Checks, s.fresh("game."+k, s.games[k].Stats().Updated, r.Time))
+	}
+	n = n[:0]
+	for k := range s.tenant {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	for _, k := range n {
+		r.Checks = append(r.Checks, s.fresh("tenant."+k, s.tenant[k].Stats().Updated, r.Time))
+	}
+	if s.store != nil {
+		if err := s.store.check(x); err != nil {
+			r.Checks = append(r.Checks, probe{Name: "history", Status: "failed", Detail: err.Error()})
+		} else {
+			r.Checks = append(r.Checks, probe{Name: "history", Status: "ok"})
+		}
+	}
+	if err := s.Writable(); err != nil {
+		r.Checks = append(r.Checks, probe{Name: "state", Status: "failed", Detail: err.Error()})
+	} else if s.saved {
+		r.Checks = append(r.Checks, probe{Name: "state", Status: "ok"})
+	}
+	for i := range r.Checks {
+		if r.Checks[i].Status == "failed" {
+			r.Status = "not_ready"
+			break
+		}
+	}
+	return r
+}
+func (s *Scoreboard) fresh(n string, u, t time.Time) probe {
+	switch {
+	case u.IsZero():
+		return probe{Name: n, Status: "failed", Detail: "no update has finished yet"}
+	case s.stale > 0 && t.Sub(u) > s.stale:
+		return probe{Name: n, Status: "failed", Detail: "last update finished at " + u.Format(time.RFC3339)}
+	}
+	return probe{Name: n, Status: "ok"}
+}
+
+// degrade marks the named data source as failing since the time on the main Game and
+// every arena, or as working again if the time is zero.
+func (s *Scoreboard) degrade(n string, t time.Time) {
+	s.Status(n, t)
+	for _, g := range s.games {
+		g.Status(n, t)
+	}
+}
+
+// source sets the status of the named data source on every Game, which is sent to the
+// staff displays.
+func (s *Scoreboard) source(n, v string) {
+	s.Source(n, v)
+	for _, g := range s.games {
+		g.Source(n, v)
+	}
+}
+func (s *Scoreboard) httpHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+func (s *Scoreboard) httpReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	x, f := context.WithTimeout(r.Context(), s.ReadTimeout)
+	v := s.ready(x)
+	f()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if v.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,637 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+
+	// Database drivers for the history store.
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	historyQueue  = 4096
+	historyBatch  = 256
+	historyPoints = 2000
+	historySteps  = 200
+	historyRows   = 1 << 20
+)
+
+var schema = [...]string{
+	`CREATE TABLE IF NOT EXISTS scores (
+		game	BIGINT NOT NULL,
+		team	BIGINT NOT NULL,
+		name	TEXT NOT NULL,
+		score	BIGINT NOT NULL,
+		health	BIGINT NOT NULL,
+		rank	BIGINT NOT NULL,
+		time	BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS scores_game ON scores (game, time)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		game	BIGINT NOT NULL,
+		team	BIGINT NOT NULL,
+		kind	TEXT NOT NULL,
+		text	TEXT NOT NULL,
+		data	TEXT NOT NULL,
+		time	BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS events_game ON events (game, time)`,
+	`CREATE TABLE IF NOT EXISTS checks (
+		game	BIGINT NOT NULL,
+		team	BIGINT NOT NULL,
+		service	TEXT NOT NULL,
+		name	TEXT NOT NULL,
+		up	BIGINT NOT NULL,
+		total	BIGINT NOT NULL,
+		PRIMARY KEY (game, team, service)
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id	TEXT NOT NULL PRIMARY KEY,
+		name	TEXT NOT NULL,
+		hash	TEXT NOT NULL,
+		scopes	TEXT NOT NULL,
+		created	BIGINT NOT NULL,
+		expires	BIGINT NOT NULL,
+		revoked	BIGINT NOT NULL
+	)`,
+}
+
+type sample struct {
+	data   []byte
+	kind   string
+	text   string
+	teams  []game.Standing
+	checks []game.Check
+	time   int64
+	game   uint64
+	team   uint64
+}
+type series struct {
+	Name   string     `json:"name"`
+	Points [][2]int64 `json:"points"`
+	ID     uint64     `json:"id"`
+}
+type history struct {
+	pruned   uint64
+	took     int64
+	swept    int64
+	rolled   int64
+	db       *sql.DB
+	log      logx.Log
+	queue    chan sample
+	scores   string
+	events   string
+	query    string
+	span     string
+	replay   string
+	recent   string
+	ledger   string
+	uptime   string
+	report   string
+	recorded string
+	sampled  string
+	rollup   string
+	expire   string
+	purge    string
+	size     string
+	keep     retention
+	binds    [7]string
+	sqlite   bool
+}
+type timeline struct {
+	Series     []*series `json:"series"`
+	Game       uint64    `json:"game"`
+	Resolution int64     `json:"resolution"`
+}
+type database struct {
+	Type      string    `json:"type"`
+	Source    string    `json:"source"`
+	Retention retention `json:"retention,omitempty"`
+}
+
+func (d database) verify() error {
+	if len(d.Source) == 0 {
+		return nil
+	}
+	switch strings.ToLower(d.Type) {
+	case "", "sqlite", "postgres":
+	default:
+		return &errval{s: `history type "` + d.Type + `" is not supported`}
+	}
+	return d.Retention.verify()
+}
+func (h *history) close() {
+	h.db.Close()
+}
+
+// check runs an insert that is rolled back, to test that the database can be written to.
+func (h *history) check(x context.Context) error {
+	t, err := h.db.BeginTx(x, nil)
+	if err != nil {
+		return err
+	}
+	_, err = t.ExecContext(x, h.scores, int64(0), int64(0), "", int64(0), int64(0), int64(0), int64(0))
+	t.Rollback()
+	return err
+}
+func (h *history) push(s sample) {
+	select {
+	case h.queue <- s:
+	default:
+		h.log.Warning("History queue is full, dropping record for Game %d!", s.game)
+	}
+}
+func (h *history) change(c game.Change) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	h.push(sample{
+		data: b,
+		kind: c.Kind.String(),
+		text: c.Text,
+		time: c.Time.UnixMilli(),
+		game: c.GameID,
+		team: c.TeamID,
+	})
+}
+func (h *history) start(x context.Context) {
+	r := make([]sample, 0, historyBatch)
+	for {
+		select {
+		case <-x.Done():
+			h.drain(r[:0])
+			return
+		case v := <-h.queue:
+			r = append(r[:0], v)
+		}
+	fill:
+		for len(r) < historyBatch {
+			select {
+			case v := <-h.queue:
+				r = append(r, v)
+			default:
+				break fill
+			}
+		}
+		h.write(r)
+	}
+}
+func (h *history) drain(r []sample) {
+	for {
+		select {
+		case v := <-h.queue:
+			if r = append(r, v); len(r) >= historyBatch {
+				h.write(r)
+				r = r[:0]
+			}
+		default:
+			if len(r) > 0 {
+				h.write(r)
+			}
+			return
+		}
+	}
+}
+func (h *history) write(r []sample) {
+	t, err := h.db.Begin()
+	if err != nil {
+		h.log.Error("Unable to start history transaction: %s!", err.Error())
+		return
+	}
+	var n int
+	for i := range r {
+		if r[i].checks != nil {
+			for _, v := range r[i].checks {
+				if _, err = t.Exec(h.uptime, int64(r[i].game), int64(v.Team), v.Service, v.Name, v.Up, v.Total); err != nil {
+					break
+				}
+				n++
+			}
+			if err != nil {
+				break
+			}
+			continue
+		}
+		if r[i].teams == nil {
+			if _, err = t.Exec(h.events, int64(r[i].game), int64(r[i].team), r[i].kind, r[i].text, string(r[i].data), r[i].time); err != nil {
+				break
+			}
+			n++
+			continue
+		}
+		for _, v := range r[i].teams {
+			if _, err = t.Exec(h.scores, int64(r[i].game), int64(v.ID), v.Name, v.Score, v.Health, v.Rank, r[i].time); err != nil {
+				break
+			}
+			n++
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Rollback()
+		h.log.Error("Unable to write %d history records: %s!", len(r), err.Error())
+		return
+	}
+	if err = t.Commit(); err != nil {
+		h.log.Error("Unable to commit %d history records: %s!", len(r), err.Error())
+		return
+	}
+	h.log.Trace("Wrote %d history rows.", n)
+}
+func (h *history) message(m game.Message) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	h.push(sample{
+		data: b,
+		kind: "message",
+		text: m.Data["text"],
+		time: m.Time.UnixMilli(),
+		game: m.GameID,
+	})
+}
+func (h *history) snapshot(s game.Snapshot) {
+	h.push(sample{teams: s.Teams, time: s.Time.UnixMilli(), game: s.GameID})
+}
+func newHistory(d database, t time.Duration, l logx.Log) (*history, error) {
+	var (
+		n = "sqlite"
+		p = [7]string{"?", "?", "?", "?", "?", "?", "?"}
+	)
+	if strings.EqualFold(d.Type, "postgres") {
+		n = "postgres"
+		for i := range p {
+			p[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	b, err := sql.Open(n, d.Source)
+	if err != nil {
+		return nil, &errval{s: `unable to open ` + n + ` history database`, e: err}
+	}
+	x, f := context.WithTimeout(context.Background(), t)
+	defer f()
+	if n == "sqlite" {
+		b.SetMaxOpenConns(1)
+		// Incremental vacuum can only be enabled before the tables are created, so only
+		// new databases give back the pages of rows removed by the retention policy.
+		if _, err = b.ExecContext(x, "PRAGMA auto_vacuum=INCREMENTAL"); err != nil {
+			b.Close()
+			return nil, &errval{s: `unable to open ` + n + ` history database`, e: err}
+		}
+		if _, err = b.ExecContext(x, "PRAGMA journal_mode=WAL"); err != nil {
+			b.Close()
+			return nil, &errval{s: `unable to open ` + n + ` history database`, e: err}
+		}
+	}
+	for i := range schema {
+		if _, err = b.ExecContext(x, schema[i]); err != nil {
+			b.Close()
+			return nil, &errval{s: `unable to create ` + n + ` history tables`, e: err}
+		}
+	}
+	h := &history{
+		binds:  p,
+		db:     b,
+		log:    l,
+		queue:  make(chan sample, historyQueue),
+		scores: "INSERT INTO scores (game, team, name, score, health, rank, time) VALUES (" + strings.Join(p[:], ", ") + ")",
+		events: "INSERT INTO events (game, team, kind, text, data, time) VALUES (" + strings.Join(p[:6], ", ") + ")",
+		query:  "SELECT team, name, score, time FROM scores WHERE game = " + p[0] + " AND time >= " + p[1] + " AND time <= " + p[2] + " ORDER BY time",
+		span:   "SELECT MIN(t), MAX(t) FROM (SELECT time AS t FROM scores WHERE game = " + p[0] + " UNION ALL SELECT time AS t FROM events WHERE game = " + p[1] + ") AS r",
+		replay: "SELECT team, kind, text, time FROM events WHERE game = " + p[0] + " AND time > " + p[1] + " AND time <= " + p[2] + " ORDER BY time",
+		recent: "SELECT team, kind, text, time FROM events WHERE game = " + p[0] + " AND (CAST(" + p[1] + " AS BIGINT) = 0 OR team = " + p[2] + ") AND (" +
+			p[3] + " = '' OR kind = " + p[4] + ") AND time <= " + p[5] + " ORDER BY time DESC LIMIT " + p[6],
+		ledger: "SELECT team, kind, text, data, time FROM events WHERE game = " + p[0] + " AND time <= " + p[1] + " ORDER BY time",
+		uptime: "INSERT INTO checks (game, team, service, name, up, total) VALUES (" + strings.Join(p[:6], ", ") + ") ON CONFLICT (game, team, service) " +
+			"DO UPDATE SET name = excluded.name, up = checks.up + excluded.up, total = checks.total + excluded.total",
+		report:   "SELECT team, service, name, up, total FROM checks WHERE game = " + p[0],
+		recorded: "SELECT COUNT(*) FROM events WHERE game = " + p[0] + " AND time = " + p[1] + " AND kind = " + p[2] + " AND text = " + p[3],
+		sampled:  "SELECT COUNT(*) FROM scores WHERE game = " + p[0] + " AND team = " + p[1] + " AND time = " + p[2],
+		rollup: "DELETE FROM scores WHERE time < " + p[0] + " AND time >= " + p[1] + " AND EXISTS (SELECT 1 FROM scores AS n WHERE n.game = scores.game AND " +
+			"n.team = scores.team AND n.time > scores.time AND n.time < (scores.time / " + p[2] + " + 1) * " + p[3] + ")",
+		expire: "DELETE FROM scores WHERE time < " + p[0],
+		purge:  "DELETE FROM events WHERE time < " + p[0],
+		size:   "SELECT pg_database_size(current_database())",
+		keep:   d.Retention,
+		sqlite: n == "sqlite",
+	}
+	if h.sqlite {
+		h.size = "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()"
+	}
+	return h, nil
+}
+func (s *Scoreboard) httpHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		q      = r.URL.Query()
+		g, err = strconv.ParseUint(q.Get("game"), 10, 64)
+	)
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	var (
+		e    = time.Now().UnixMilli()
+		b, n int64
+		d    time.Duration
+	)
+	if v := q.Get("from"); len(v) > 0 {
+		if b, err = strconv.ParseInt(v, 10, 64); err != nil {
+			fail(w, "from must be a Unix timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); len(v) > 0 {
+		if e, err = strconv.ParseInt(v, 10, 64); err != nil {
+			fail(w, "to must be a Unix timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+	}
+	// The history of a frozen Game ends at the time of the freeze, unless the request
+	// has the admin token.
+	if f, ok := held(s.Manager, g); ok && !s.permitted(r, true, scopeScores) && e > f.UnixMilli() {
+		e = f.UnixMilli()
+	}
+	if v := q.Get("resolution"); len(v) > 0 {
+		if d, err = time.ParseDuration(v); err != nil {
+			var i int64
+			if i, err = strconv.ParseInt(v, 10, 64); err != nil || i < 0 {
+				fail(w, "resolution must be a duration or a number of seconds", http.StatusBadRequest)
+				return
+			}
+			d = time.Duration(i) * time.Second
+		}
+	}
+	if v := q.Get("top"); len(v) > 0 {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil || n < 0 {
+			fail(w, "top must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	var t map[uint64]struct{}
+	if v := split(q.Get("teams")); len(v) > 0 {
+		t = make(map[uint64]struct{}, len(v))
+		for i := range v {
+			k, err := strconv.ParseUint(v[i], 10, 64)
+			if err != nil {
+				fail(w, `team ID "`+v[i]+`" is not valid`, http.StatusBadRequest)
+				return
+			}
+			t[k] = struct{}{}
+		}
+	}
+	l, err := s.store.timeline(r.Context(), g, b, e, int64(d/time.Millisecond), t)
+	if err != nil {
+		fail(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.log.request(r).Error(`Error reading history for "%s": %s!`, r.RemoteAddr, err.Error())
+		return
+	}
+	if n > 0 && int64(len(l.Series)) > n {
+		sort.SliceStable(l.Series, func(i, j int) bool {
+			return l.Series[i].Points[len(l.Series[i].Points)-1][1] > l.Series[j].Points[len(l.Series[j].Points)-1][1]
+		})
+		l.Series = l.Series[:n]
+	}
+	if s.Anonymous() && !s.permitted(r, true, scopeScores) {
+		v := make([]uint64, len(l.Series))
+		for i := range l.Series {
+			v[i] = l.Series[i].ID
+		}
+		p := s.Pseudonyms(v)
+		for i := range l.Series {
+			l.Series[i].Name = p[l.Series[i].ID]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(l)
+}
+func (h *history) timeline(x context.Context, g uint64, b, e, d int64, t map[uint64]struct{}) (*timeline, error) {
+	var (
+		a = []interface{}{int64(g), b, e}
+		w = "game = " + h.bind(0) + " AND time >= " + h.bind(1) + " AND time <= " + h.bind(2)
+	)
+	if len(t) > 0 {
+		v := make([]string, 0, len(t))
+		for k := range t {
+			v, a = append(v, h.bind(len(a))), append(a, int64(k))
+		}
+		w += " AND team IN (" + strings.Join(v, ", ") + ")"
+	}
+	l := &timeline{Game: g, Series: make([]*series, 0)}
+	var f, z sql.NullInt64
+	if err := h.db.QueryRowContext(x, "SELECT MIN(time), MAX(time) FROM scores WHERE "+w, a...).Scan(&f, &z); err != nil {
+		return nil, err
+	}
+	if !f.Valid || !z.Valid {
+		return l, nil
+	}
+	if d <= 0 {
+		d = (z.Int64 - f.Int64) / historySteps
+	}
+	if m := (z.Int64 - f.Int64) / historyPoints; d < m {
+		d = m
+	}
+	if d < 1000 {
+		d = 1000
+	}
+	l.Resolution = d / 1000
+	// Keep the last sample of each team in each bucket, as scores only move at each
+	// sample. The buckets keep the rows to historyPoints for each team, and historyRows
+	// limits the rows if the samples are not spread out.
+	r, err := h.db.QueryContext(x,
+		"SELECT s.team, s.name, s.score, s.time FROM scores AS s INNER JOIN (SELECT team, MAX(time) AS t FROM scores WHERE "+w+
+			" GROUP BY team, time / "+h.bind(len(a))+") AS k ON s.team = k.team AND s.time = k.t WHERE s.game = "+h.bind(len(a)+1)+
+			" ORDER BY s.time LIMIT "+strconv.Itoa(historyRows),
+		append(a, d, int64(g))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	m := make(map[uint64]*series)
+	for r.Next() {
+		var (
+			n    string
+			i    uint64
+			c, v int64
+		)
+		if err = r.Scan(&i, &n, &c, &v); err != nil {
+			return nil, err
+		}
+		s, ok := m[i]
+		if !ok {
+			s = &series{ID: i, Name: n}
+			m[i] = s
+			l.Series = append(l.Series, s)
+		}
+		// Samples of a team with the same time are all returned, so the last one is kept.
+		if k := len(s.Points) - 1; k >= 0 && s.Points[k][0]/d == v/d {
+			s.Points[k] = [2]int64{v, c}
+		} else {
+			s.Points = append(s.Points, [2]int64{v, c})
+		}
+		s.Name = n
+	}
+	if err = r.Err(); err != nil {
+		return nil, err
+	}
+	for _, s := range l.Series {
+		if c := s.Points[len(s.Points)-1]; c[0] < z.Int64 {
+			s.Points = append(s.Points, [2]int64{z.Int64, c[1]})
+		}
+	}
+	return l, nil
+}
+
+// bind returns the query placeholder of the argument at the index i, which is only
+// used for queries that are built with a variable number of arguments.
+func (h *history) bind(i int) string {
+	if h.sqlite {
+		return "?"
+	}
+	return "$" + strconv.Itoa(i+1)
+}
+func (h *history) Span(x context.Context, g uint64) (time.Time, time.Time, error) {
+	var s, e sql.NullInt64
+	if err := h.db.QueryRowContext(x, h.span, int64(g), int64(g)).Scan(&s, &e); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !s.Valid || !e.Valid {
+		return time.Time{}, time.Time{}, nil
+	}
+	return time.UnixMilli(s.Int64).UTC(), time.UnixMilli(e.Int64).UTC(), nil
+}
+func (h *history) Records(x context.Context, g uint64, a, b time.Time) ([]game.Record, error) {
+	var (
+		o      []game.Record
+		f, t   = a.UnixMilli(), b.UnixMilli()
+		r, err = h.db.QueryContext(x, h.query, int64(g), f+1, t)
+	)
+	if err != nil {
+		return nil, err
+	}
+	for r.Next() {
+		var (
+			v game.Record
+			n string
+			i int64
+		)
+		if err = r.Scan(&v.Team, &n, &v.Score, &i); err != nil {
+			r.Close()
+			return nil, err
+		}
+		v.Time = time.UnixMilli(i).UTC()
+		o = append(o, v)
+	}
+	if r.Close(); r.Err() != nil {
+		return nil, r.Err()
+	}
+	if r, err = h.db.QueryContext(x, h.replay, int64(g), f, t); err != nil {
+		return nil, err
+	}
+	for r.Next() {
+		var (
+			v game.Record
+			i int64
+		)
+		if err = r.Scan(&v.Team, &v.Kind, &v.Text, &i); err != nil {
+			r.Close()
+			return nil, err
+		}
+		v.Time = time.UnixMilli(i).UTC()
+		o = append(o, v)
+	}
+	if r.Close(); r.Err() != nil {
+		return nil, r.Err()
+	}
+	sort.SliceStable(o, func(i, j int) bool { return o[i].Time.Before(o[j].Time) })
+	return o, nil
+}
+
+// Latest returns the last n events of the Game up to the end time, the most recent
+// first. The events are limited to a single team if the team ID is not zero and to a
+// single kind if the kind is not empty. A zero end time returns the latest events.
+func (h *history) Latest(x context.Context, g, t uint64, k string, e time.Time, n int64) ([]game.Record, error) {
+	v := int64(math.MaxInt64)
+	if !e.IsZero() {
+		v = e.UnixMilli()
+	}
+	r, err := h.db.QueryContext(x, h.recent, int64(g), int64(t), int64(t), k, k, v, n)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var o []game.Record
+	for r.Next() {
+		var (
+			v game.Record
+			i int64
+		)
+		if err = r.Scan(&v.Team, &v.Kind, &v.Text, &i); err != nil {
+			return nil, err
+		}
+		v.Time = time.UnixMilli(i).UTC()
+		o = append(o, v)
+	}
+	return o, r.Err()
+}
+
+// journal returns every event of the Game recorded up to the end time, the oldest first.
+func (h *history) journal(x context.Context, g uint64, e time.Time) ([]logged, error) {
+	r, err := h.db.QueryContext(x, h.ledger, int64(g), e.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var o []logged
+	for r.Next() {
+		var (
+			v logged
+			d string
+			i int64
+		)
+		if err = r.Scan(&v.TeamID, &v.Kind, &v.Text, &d, &i); err != nil {
+			return nil, err
+		}
+		if v.Time = time.UnixMilli(i).UTC(); len(d) > 0 && json.Valid([]byte(d)) {
+			v.Data = json.RawMessage(d)
+		}
+		o = append(o, v)
+	}
+	return o, r.Err()
+}
@@ -52,13 +52,95 @@ const messages = [
     "(creating unresolved tension...",
 ];
 
+// WebSocket protocol version asked for in the Hello message.
+const protocol = 2;
+
 // Auto Interval Constants
 const interval_all = 15000;
 const interval_team = 7500;
+const interval_graph = 10000;
 const interval_credit = 5000;
 
+// Score Graph Constants
+const graph_top = 8;
+const graph_colors = [
+    "rgb(62, 146, 46)",
+    "rgb(230, 159, 0)",
+    "rgb(86, 180, 233)",
+    "rgb(240, 228, 66)",
+    "rgb(204, 121, 167)",
+    "rgb(213, 94, 0)",
+    "rgb(0, 114, 178)",
+    "rgb(255, 255, 255)",
+];
+
+// Page handlers are bound with listeners instead of inline attributes, so the Content
+// Security Policy does not need to allow inline scripts.
+window.addEventListener("load", init);
+document.addEventListener("click", handle_click);
+document.addEventListener("mouseover", handle_hover);
+document.addEventListener("mouseout", handle_hover);
+
+function handle_click(event) {
+    let target = event.target.closest("[data-navigate], [data-click]");
+    if (target === null) {
+        return;
+    }
+    event.preventDefault();
+    if (target.hasAttribute("data-navigate")) {
+        navigate(target.getAttribute("data-navigate"));
+        return;
+    }
+    let action = target.getAttribute("data-click");
+    if (action === "exit") {
+        exit_game();
+    } else if (action === "hamburger") {
+        hamburger();
+    } else if (action === "close") {
+        event_close();
+    } else if (action === "reload") {
+        document.location.reload();
+    }
+}
+function handle_hover(event) {
+    let target = event.target.closest("[data-callout]");
+    if (target === null) {
+        return;
+    }
+    if (event.type === "mouseover") {
+        callout(event, target.getAttribute("data-callout"));
+    } else {
+        callout_done();
+    }
+}
+// unpack returns the updates of the WebSocket message. Older Scoreboards send the
+// updates as an array, while newer ones send an object with the protocol version and
+// sequence number. Messages older than the last one are skipped, and a missed message
+// reloads the page, so updates are never applied twice or out of order.
+function unpack(data) {
+    let message = JSON.parse(data);
+    if (Array.isArray(message)) {
+        return message;
+    }
+    if (typeof message.seq === "number") {
+        if (document.sb_seq !== null && message.seq < document.sb_seq) {
+            debug("Skipping old message " + message.seq + "...");
+            return [];
+        }
+        if (document.sb_seq !== null && message.seq > document.sb_seq + 1) {
+            debug("Missed messages " + (document.sb_seq + 1) + " to " + (message.seq - 1) + ", reloading...");
+            document.sb_socket.onclose = null;
+            document.sb_socket.close();
+            document.location.reload();
+            return [];
+        }
+        document.sb_seq = message.seq;
+    }
+    return message.updates || [];
+}
 function init() {
     document.sb_auto = false;
+    document.sb_seq = null;
     document.sb_loaded = false;
     document.sb_callout = false;
     document.sb_tab_offset = null;
@@ -75,19 +157,58 @@ function init() {
     document.sb_message = document.getElementById("console-msg");
     document.sb_event_data = document.getElementById("event-data");
     document.sb_event_title = document.getElementById("event-title");
-    setInterval(scroll_elements, 200);
+    document.sb_scroll = null;
+    pace_set(typeof profile !== "undefined" && profile !== null && profile.pace ? profile.pace : {});
+    setInterval(update_clock, 1000);
+    setup_lobby();
+    sponsors_load();
+    challenges_load();
+    hills_load();
+    setInterval(hills_tick, 1000);
+    availability_load();
     debug("Opening websocket..");
-    let s = window.location.host + "/w";
+    let s = window.location.host + path("/w");
+    if (typeof route !== "undefined" && route) {
+        s = s + "/" + route;
+    }
     if (document.location.protocol.indexOf("https") >= 0) {
         s = "wss://" + s;
     } else {
         s = "ws://" + s;
     }
-    document.sb_socket = new WebSocket(s);
+    socket_open(s);
+    debug("Init complete.");
+}
+function socket_open(url) {
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (!token) {
+        socket_connect(url);
+        return;
+    }
+    // The admin token is traded for a short lived signed ticket, so the token is not
+    // sent in the WebSocket URL. The board is opened as a public display if the token
+    // is not accepted.
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Ticket request returned " + request.status + "!");
+            socket_connect(url);
+            return;
+        }
+        socket_connect(url + "?ticket=" + encodeURIComponent(JSON.parse(request.responseText).ticket));
+    };
+    request.onerror = function () {
+        socket_connect(url);
+    };
+    request.open("POST", path("/api/v1/ticket"));
+    request.setRequestHeader("Authorization", "Bearer " + token);
+    request.send();
+}
+function socket_connect(url) {
+    document.sb_socket = new WebSocket(url);
     document.sb_socket.onopen = startup;
     document.sb_socket.onclose = closed;
     document.sb_socket.onmessage = recv;
-    debug("Init complete.");
 }
 function closed() {
     debug("Received websocket close signal.");
@@ -99,7 +220,20 @@ function closed() {
 }
 function startup() {
     debug("Received websocket open signal.");
-    document.sb_socket.send(JSON.stringify({"game": game}));
+    document.sb_seq = null;
+    // A "division", "top" or "team" in the page URL asks for only that slice of the
+    // game, which the Scoreboard filters before sending each update.
+    let hello = {"game": game, "version": protocol}, query = new URLSearchParams(document.location.search);
+    if (query.get("division")) {
+        hello.division = query.get("division");
+    }
+    if (parseInt(query.get("top"), 10) > 0) {
+        hello.top = parseInt(query.get("top"), 10);
+    }
+    if (parseInt(query.get("team"), 10) > 0) {
+        hello.team = parseInt(query.get("team"), 10);
+    }
+    document.sb_socket.send(JSON.stringify(hello));
 }
 function exit_game() {
     alert(messages[Math.floor(Math.random() * messages.length)]);
@@ -142,6 +276,12 @@ function auto_scroll() {
                 continue;
             }
         }
+        if ((tabs[i].id === "matrix-tab" || tabs[i].id === "beacons-tab" || tabs[i].id === "challenges-tab" || tabs[i].id === "hills-tab" || tabs[i].id === "availability-tab") && tabs[i].style.display === "none") {
+            continue;
+        }
+        if (tabs_auto && !auto_rotates(tabs[i].id)) {
+            continue;
+        }
         if (tabs_auto) {
             auto_set(tabs[i], tabs);
             return
@@ -151,12 +291,33 @@ function auto_scroll() {
             tabs[i].classList.remove("auto-selected");
         }
     }
+    for (let i = 0; i < tabs.length; i++) {
+        if (tabs[i].id !== "auto-tab" && auto_rotates(tabs[i].id)) {
+            auto_set(tabs[i], tabs);
+            return;
+        }
+    }
     if (tabs[0].id !== "auto-tab") {
         auto_set(tabs[0], tabs);
     } else if (tabs[1].id !== "auto-tab") {
         auto_set(tabs[1], tabs);
     }
 }
+function auto_rotates(id) {
+    // The display profile can limit the tabs shown by auto scroll. The "teams" and
+    // "divisions" names match every team or division tab.
+    if (typeof profile === "undefined" || profile === null || !profile.rotation || profile.rotation.length === 0) {
+        return true;
+    }
+    let name = id.replace("-tab", "");
+    for (let i = 0; i < profile.rotation.length; i++) {
+        let tab = profile.rotation[i];
+        if (tab === name || (tab === "teams" && name.indexOf("game-team-") === 0) || (tab === "divisions" && name.indexOf("division-") === 0)) {
+            return true;
+        }
+    }
+    return false;
+}
 function recv(message) {
     if (message.data === null && !document.sb_loaded) {
         document.sb_socket.close();
@@ -178,7 +339,7 @@ function recv(message) {
         }
         let game_status = document.getElementById("game-status-name");
         if (game_status !== null) {
-            game_status.setAttribute("onclick", "return navigate('overview');");
+            game_status.setAttribute("data-navigate", "overview");
         }
         document.sb_loaded = true;
     }
@@ -221,13 +382,61 @@ function update_tabs() {
             team_name.classList.add("small");
         }
         team_tab.setAttribute("href", "#");
-        team_tab.setAttribute("onclick", "return navigate('" + teams[i].id + "');");
+        team_tab.setAttribute("data-navigate", teams[i].id);
         let team_div = document.getElementById(teams[i].id);
         if (team_div !== null) {
-            team_div.setAttribute("onclick", "return navigate('" + teams[i].id + "');");
+            team_div.setAttribute("data-navigate", teams[i].id);
         }
         team_tab.innerText = team_name.innerText
     }
+    update_divisions(tabs);
+}
+function update_order() {
+    let team = document.getElementById("game-team");
+    if (team === null) {
+        return;
+    }
+    let teams = Array.prototype.slice.call(team.children);
+    let sorted = teams.slice().sort(function(a, b) {
+        return (parseInt(a.style.order) || 0) - (parseInt(b.style.order) || 0);
+    });
+    let start = 0;
+    while (start < sorted.length && teams[start] === sorted[start]) {
+        start++;
+    }
+    for (let i = start; i < sorted.length; i++) {
+        team.appendChild(sorted[i]);
+    }
+}
+function update_divisions(tabs) {
+    let names = {};
+    let divisions = document.getElementsByClassName("team-division");
+    for (let i = 0; i < divisions.length; i++) {
+        let name = divisions[i].innerText.trim();
+        if (name.length > 0) {
+            names[division_slug(name)] = name;
+        }
+    }
+    for (let i = tabs.children.length - 1; i >= 0; i--) {
+        let id = tabs.children[i].id;
+        if (id.indexOf("division-") === 0 && !(id.substring(9, id.length - 4) in names)) {
+            tabs.children[i].remove();
+        }
+    }
+    for (let slug in names) {
+        let division_tab = document.getElementById("division-" + slug + "-tab");
+        if (division_tab === null) {
+            division_tab = document.createElement("a");
+            division_tab.id = "division-" + slug + "-tab";
+            division_tab.setAttribute("href", "#");
+            division_tab.setAttribute("data-navigate", "division-" + slug);
+            tabs.appendChild(division_tab);
+        }
+        division_tab.innerText = names[slug];
+    }
+}
+function division_slug(name) {
+    return name.trim().toLowerCase().replace(/[^a-z0-9]+/g, "-");
 }
 function check_mobile() {
     if (is_mobile(true)) {
@@ -317,6 +526,10 @@ function display_invalid() {
     }
 }
 function scroll_elements() {
+    if (accessible()) {
+        // Long names are shown in full instead of scrolling in accessible mode.
+        return;
+    }
     let beacons = document.getElementsByClassName("team-beacon");
     for (let i = 0; i < beacons.length; i++) {
         scroll_beacon(beacons[i]);
@@ -334,13 +547,25 @@ function scroll_elements() {
     */
 }
 function update_board(data) {
-    let updates = JSON.parse(data);
+    let updates = unpack(data);
     debug("Received " + updates.length + " entries...");
     for (let i = 0; i < updates.length; i++) {
         handle_update(updates[i]);
     }
+    update_order();
     update_tabs();
     update_beacons();
+    if (accessible()) {
+        update_labels();
+    }
+    let matrix_tab = document.getElementById("matrix-tab");
+    if (matrix_tab !== null) {
+        matrix_tab.style.display = document.getElementsByClassName("service").length > 0 ? "" : "none";
+    }
+    let beacons_tab = document.getElementById("beacons-tab");
+    if (beacons_tab !== null) {
+        beacons_tab.style.display = document.getElementsByClassName("beacon").length > 0 ? "" : "none";
+    }
     let game_name = document.getElementById("game-status-name");
     if (game_name !== null) {
         document.title = game_name.innerText;
@@ -355,6 +580,21 @@ function update_board(data) {
     callout_add("score-ticket-closed", "callout-ticket-closed");
     callout_add("score-flag-captured", "callout-flag-captured");
 }
+function update_labels() {
+    // The team cards are built from many small elements, so screen readers are given
+    // a single label with the name, rank and score of each team instead.
+    let teams = document.querySelectorAll("#game-team .team");
+    for (let i = 0; i < teams.length; i++) {
+        let name = document.getElementById(teams[i].id + "-name-name");
+        let score = document.getElementById(teams[i].id + "-name-total");
+        teams[i].setAttribute("role", "listitem");
+        teams[i].setAttribute("aria-label", translate("aria.team", {
+            team: name !== null ? name.innerText : "",
+            rank: i + 1,
+            score: score !== null ? score.innerText : "0",
+        }));
+    }
+}
 function scroll_element(ele) {
     if (ele.scrollWidth === 0) {
         ele.classList.remove("reverse");
@@ -390,6 +630,30 @@ function handle_event(event) {
         handle_event_effect(event)
         return;
     }
+    if (event.value === "4") {
+        handle_event_change(event)
+        return;
+    }
+    if (event.value === "5") {
+        handle_event_transition(event)
+        return;
+    }
+    if (event.value === "6") {
+        handle_event_clock(event)
+        return;
+    }
+    if (event.value === "7") {
+        handle_event_status(event)
+        return;
+    }
+    if (event.value === "8") {
+        handle_event_sources(event)
+        return;
+    }
+    if (event.value === "9") {
+        handle_event_control(event)
+        return;
+    }
 }
 function callout(event, type) {
     if (is_mobile()) {
@@ -417,6 +681,16 @@ function callout(event, type) {
     }
     document.sb_callout = true;
 }
+function handle_meta(target, meta) {
+    // The metadata of the scoring engine is kept on the element for override scripts,
+    // which can listen for the "scoreboard-meta" event to see when it changes.
+    if (Object.keys(meta).length === 0) {
+        delete target.dataset.meta;
+    } else {
+        target.dataset.meta = JSON.stringify(meta);
+    }
+    target.dispatchEvent(new CustomEvent("scoreboard-meta", {bubbles: true, detail: meta}));
+}
 function handle_update(update) {
     debug("Processing '" + JSON.stringify(update) + "'..")
     if (update.event) {
@@ -453,6 +727,9 @@ function handle_update(update) {
             target.classList.add(classes[i]);
         }
     }
+    if (update.meta) {
+        handle_meta(target, update.meta);
+    }
     if (!update.value) {
         return;
     }
@@ -507,18 +784,25 @@ function scroll_beacon(beacon) {
 function callout_add(ele, type) {
     let elements = document.getElementsByClassName(ele);
     for (let i = 0; i < elements.length; i++) {
-        if (!elements[i].onmouseover) {
-            elements[i].setAttribute("onmouseover", "callout(event, '" + type + "');");
-            elements[i].setAttribute("onmouseout", "callout_done();");
+        if (!elements[i].hasAttribute("data-callout")) {
+            elements[i].setAttribute("data-callout", type);
         }
     }
 }
 function auto_set(div, entries) {
     div.classList.add("auto-selected");
-    if (div.id === "overview-tab") {
+    if (document.sb_pace.flip > 0 && (div.id === "overview-tab" || div.id.indexOf("division-") === 0)) {
+        setTimeout(auto_scroll, document.sb_pace.flip * 1000);
+    } else if (typeof profile !== "undefined" && profile !== null && profile.interval > 0) {
+        setTimeout(auto_scroll, profile.interval * 1000);
+    } else if (div.id === "overview-tab") {
         setTimeout(auto_scroll, interval_all);
     } else if (div.id === "credits-tab") {
         setTimeout(auto_scroll, interval_credit);
+    } else if (div.id === "graph-tab") {
+        setTimeout(auto_scroll, interval_graph);
+    } else if (div.id.indexOf("division-") === 0) {
+        setTimeout(auto_scroll, interval_all);
     } else {
         setTimeout(auto_scroll, interval_team);
     }
@@ -583,7 +867,7 @@ function set_beacon_image(beacon) {
         beacon.style.background = "url('" + canvas.toDataURL("image/png") + "')";
     }
     image.crossOrigin = "anonymous";
-    image.src = "/image/beacon.png";
+    image.src = path("/image/beacon.png");
 }
 function handle_event_popup(event) {
     if (event.remove) {
@@ -628,6 +912,10 @@ function handle_event_effect(event) {
         }
         return;
     }
+    if (accessible()) {
+        debug("Skipping effect event in accessible mode.");
+        return;
+    }
     let container = document.createElement("div");
     container.id = "eff-" + event.id;
     container.innerHTML = event.data.html;
@@ -653,6 +941,12 @@ function handle_event_message(event) {
     let message = document.createElement("div");
     message.id = "msg-" + event.id;
     message.classList.add("message");
+    if (event.data.kind) {
+        message.classList.add("message-" + event.data.kind.replace("_", "-"));
+    }
+    if (event.data.highlight === "true") {
+        message.classList.add("message-highlight");
+    }
     if (event.data.command && event.data.command.length > 0) {
         if (event.data.response && event.data.response.length > 0) {
             message.innerHTML = "[root@localhost ~]# " + event.data.text + "<br/>" + event.data.response.replace("\n", "<br/>");
@@ -660,12 +954,443 @@ function handle_event_message(event) {
             message.innerText = "[root@localhost ~]# " + event.data.text;
         }
     } else {
-        message.innerText = "[root@localhost ~]# echo " + event.data.text + " > /dev/null";
+        message.innerText = "[root@localhost ~]# echo " + ticker_text(event.data) + " > /dev/null";
+    }
+    if (event.data.time) {
+        let stamp = document.createElement("span");
+        stamp.classList.add("message-time");
+        stamp.innerText = time_format(event.data.time);
+        message.insertBefore(stamp, message.firstChild);
     }
     document.sb_message.appendChild(message);
     document.sb_message.scrollTop = document.sb_message.offsetHeight;
     debug("Added message event!");
 }
+function handle_event_change(event) {
+    if (event.remove || !event.data) {
+        return;
+    }
+    document.dispatchEvent(new CustomEvent("scoreboard-change", {detail: event.data}));
+    debug("Received " + event.data.kind + " change event.");
+    play_effect(event.data);
+    if (event.data.kind === "hill") {
+        hills_load();
+    }
+    if (event.data.highlight !== "true" || !event.data.team) {
+        return;
+    }
+    let team = document.getElementById("game-team-t" + event.data.team);
+    if (team === null) {
+        return;
+    }
+    team.classList.add("highlight");
+    setTimeout(function() {
+        team.classList.remove("highlight");
+    }, 5000 * document.sb_pace.animation);
+}
+function play_effect(data) {
+    // Sounds are skipped when the page was opened with the "mute" option and animations
+    // are skipped in accessible mode, as they can be hard to follow.
+    if (data.sound && !new URLSearchParams(document.location.search).get("mute")) {
+        let sound = new Audio(path("/sound/" + data.sound + ".mp3"));
+        sound.play().catch(function(err) {
+            debug("Unable to play sound " + data.sound + ": " + err);
+        });
+    }
+    if (!data.animation || accessible()) {
+        return;
+    }
+    // The animation is shown on the team row when the team is shown, otherwise it is
+    // shown on the whole board.
+    let target = (data.team && document.getElementById("game-team-t" + data.team)) || document.sb_board;
+    let name = "effect-" + data.animation;
+    target.classList.add(name);
+    setTimeout(function() {
+        target.classList.remove(name);
+    }, (parseInt(data.duration, 10) || 2) * 1000 * document.sb_pace.animation);
+    debug("Played " + data.animation + " animation for " + data.kind + " change event.");
+}
+function handle_event_transition(event) {
+    if (event.remove) {
+        return;
+    }
+    debug("Received transition event, reloading..");
+    document.sb_socket.onclose = null;
+    document.body.classList.add("transition");
+    setTimeout(function() {
+        document.location.reload();
+    }, 1500);
+}
+function handle_event_clock(event) {
+    if (event.remove || !event.data) {
+        document.sb_clock = null;
+        update_clock();
+        return;
+    }
+    // The server sends the seconds left instead of the end time, so the countdown
+    // does not depend on the display clock being correct.
+    let now = Date.now();
+    document.sb_clock = {
+        paused: event.data.paused === "true",
+        ended: event.data.ended === "true",
+        counts: event.data.end !== "",
+        start: now + parseInt(event.data.until, 10) * 1000,
+        starts_at: event.data.start,
+        ends_at: event.data.end,
+        end: now + parseInt(event.data.remaining, 10) * 1000,
+        until: parseInt(event.data.until, 10),
+        remaining: parseInt(event.data.remaining, 10),
+    };
+    debug("Received clock event with " + document.sb_clock.remaining + " seconds remaining.");
+    update_clock();
+}
+function handle_event_status(event) {
+    let stale = document.getElementById("game-stale");
+    if (stale === null) {
+        return;
+    }
+    if (event.remove || !event.data) {
+        debug("Received status event, all data sources have recovered.");
+        stale.className = "game-stale";
+        stale.innerText = "";
+        return;
+    }
+    // Only the last update time is shown, the failing sources are only a hint of
+    // which data may be behind.
+    let text = translate("status.stale");
+    if (event.data.twitter && !event.data.source && !event.data.game) {
+        text = translate("status.delayed");
+    }
+    let updated = new Date(event.data.updated);
+    if (!isNaN(updated.getTime())) {
+        text = translate("status.updated", {
+            status: text,
+            time: time_format(updated, true),
+        });
+    }
+    debug("Received status event, data sources are failing.");
+    stale.className = "game-stale active";
+    stale.innerText = text;
+}
+function handle_event_sources(event) {
+    // The data source status is only sent to clients opened with the admin token and
+    // is only shown when the page was also opened with the "sources" option.
+    let element = document.getElementById("game-sources");
+    if (element === null || !event.data || !new URLSearchParams(document.location.search).get("sources")) {
+        return;
+    }
+    let text = Object.keys(event.data).sort().filter(function(name) {
+        return name !== "failing";
+    }).map(function(name) {
+        return name + ": " + event.data[name];
+    });
+    debug("Received data source status: " + text.join(", ") + ".");
+    element.hidden = false;
+    element.className = event.data.failing ? "game-sources failing" : "game-sources";
+    element.innerText = event.data.failing || "";
+    element.title = text.join("\n");
+    element.setAttribute("aria-label", translate("aria.sources") + ", " + text.join(", "));
+}
+function handle_event_control(event) {
+    // Control commands are sent by staff to fix a display without walking over to it.
+    if (!event.data) {
+        return;
+    }
+    debug("Received control command '" + event.data.action + "'.");
+    if (event.data.action === "reload") {
+        control_reload();
+        return;
+    }
+    if (event.data.action === "clear-cache") {
+        control_refresh();
+        return;
+    }
+    if (event.data.action === "identify") {
+        control_identify(event.data.display, parseInt(event.data.duration) || 10);
+        return;
+    }
+    if (event.data.action === "profile" && event.data.view) {
+        // The profile is rendered into the page, so the page is loaded again with the
+        // new profile in its URL.
+        let query = new URLSearchParams(document.location.search);
+        query.set("profile", event.data.view);
+        document.sb_socket.onclose = null;
+        document.sb_socket.close();
+        document.location.search = query.toString();
+        return;
+    }
+    if (event.data.action === "pace") {
+        // A pace sent for a profile is only used by the displays showing that profile.
+        if (!event.data.view || (typeof profile !== "undefined" && profile !== null && profile.name === event.data.view)) {
+            pace_set({"ticker": parseFloat(event.data.ticker), "animation": parseFloat(event.data.animation), "flip": parseInt(event.data.flip, 10)});
+        }
+        return;
+    }
+    if (event.data.action === "theme") {
+        control_theme(event.data.view);
+        return;
+    }
+    if (event.data.action === "switch-view" && event.data.view) {
+        if (event.data.view.indexOf("/") === 0) {
+            control_reload(path(event.data.view));
+            return;
+        }
+        if (document.getElementById("game-tab") !== null) {
+            navigate(event.data.view);
+        }
+    }
+}
+function control_reload(url) {
+    // The close handler is removed first, so the disconnected message is not shown
+    // while the page is reloading.
+    document.sb_socket.onclose = null;
+    document.sb_socket.close();
+    if (url) {
+        document.location.assign(url + document.location.search);
+        return;
+    }
+    document.location.reload();
+}
+function pace_set(pace) {
+    // Zero values are the normal pace. The scrolling text is moved on a shorter timer
+    // for a faster ticker, and the length of the CSS animations is scaled with the
+    // "--pace" value.
+    document.sb_pace = {
+        "ticker": pace.ticker > 0 ? pace.ticker : 1,
+        "animation": pace.animation > 0 ? pace.animation : 1,
+        "flip": pace.flip > 0 ? pace.flip : 0
+    };
+    if (document.sb_scroll !== null) {
+        clearInterval(document.sb_scroll);
+    }
+    document.sb_scroll = setInterval(scroll_elements, 200 / document.sb_pace.ticker);
+    document.body.style.setProperty("--pace", document.sb_pace.animation);
+    debug("Set pace to ticker " + document.sb_pace.ticker + ", animation " + document.sb_pace.animation + " and flip " + document.sb_pace.flip + ".");
+}
+function control_theme(name) {
+    // The theme stylesheet is swapped in place, so the board keeps its state. An empty
+    // name returns to the theme of the profile of the page.
+    let element = document.getElementById("theme");
+    if (element === null) {
+        return;
+    }
+    if (!name) {
+        name = element.getAttribute("data-profile");
+    }
+    if (!name) {
+        element.removeAttribute("href");
+        return;
+    }
+    element.href = path("/style/theme/" + name + ".css");
+}
+function control_refresh() {
+    // The assets are requested again with a "no-cache" header, which replaces the
+    // cached copies, before the page is reloaded.
+    let assets = document.querySelectorAll("script[src], link[rel='stylesheet'][href]");
+    let waiting = assets.length;
+    if (waiting === 0) {
+        control_reload();
+        return;
+    }
+    for (let i = 0; i < assets.length; i++) {
+        let request = new XMLHttpRequest();
+        request.onloadend = function() {
+            if (--waiting === 0) {
+                control_reload();
+            }
+        };
+        request.open("GET", assets[i].src || assets[i].href);
+        request.setRequestHeader("Cache-Control", "no-cache");
+        request.send();
+    }
+}
+function control_identify(display, duration) {
+    let element = document.getElementById("game-identify");
+    if (element === null) {
+        element = document.createElement("div");
+        element.id = "game-identify";
+        element.setAttribute("role", "status");
+        document.body.appendChild(element);
+    }
+    element.innerText = translate("status.display", {display: display});
+    element.className = "active";
+    clearTimeout(document.sb_identify);
+    document.sb_identify = setTimeout(function() {
+        element.className = "";
+    }, Math.max(1, duration) * 1000);
+}
+function update_clock() {
+    let c = document.sb_clock;
+    update_lobby(c);
+    let clock = document.getElementById("game-clock");
+    if (clock === null) {
+        return;
+    }
+    if (!c || !c.counts) {
+        clock.className = "";
+        clock.innerText = "";
+        clock.title = "";
+        return;
+    }
+    let now = Date.now(), left = c.remaining;
+    clock.className = "active";
+    clock.title = translate("clock.window", {start: time_format(c.starts_at, true), end: time_format(c.ends_at, true)});
+    if (c.ended) {
+        clock.innerText = translate("clock.over");
+        return;
+    }
+    if (now < c.start && !c.paused) {
+        clock.innerText = translate("clock.starts", {time: clock_format(Math.ceil((c.start - now) / 1000)), at: time_format(c.starts_at, true)});
+        return;
+    }
+    if (c.paused) {
+        clock.classList.add("paused");
+    } else {
+        left = Math.max(0, Math.ceil((c.end - now) / 1000));
+    }
+    if (left <= 300) {
+        clock.classList.add("ending");
+    }
+    clock.innerText = clock_format(left);
+}
+function setup_lobby() {
+    let lobby = document.getElementById("lobby");
+    if (lobby === null) {
+        return;
+    }
+    document.sb_lobby_slide = 0;
+    setInterval(rotate_lobby, (parseInt(lobby.dataset.rotate, 10) || 15) * 1000);
+}
+function rotate_lobby() {
+    let slides = document.querySelectorAll("#lobby .lobby-slide");
+    if (slides.length === 0 || !document.body.classList.contains("lobby")) {
+        return;
+    }
+    let current = document.sb_lobby_slide % slides.length;
+    for (let i = 0; i < slides.length; i++) {
+        slides[i].hidden = i !== current;
+    }
+    document.sb_lobby_slide++;
+}
+function update_lobby(c) {
+    // The lobby is shown until the clock start time and is left on its own once the
+    // clock starts, so the displays do not need to be reloaded. A clock paused before
+    // the start time keeps the lobby up with the countdown stopped.
+    let lobby = document.getElementById("lobby");
+    if (lobby === null) {
+        return;
+    }
+    let now = Date.now();
+    if (!c || !(c.until > 0) || (!c.paused && now >= c.start)) {
+        if (!lobby.hidden) {
+            debug("Game clock started, leaving the lobby.");
+            lobby.hidden = true;
+            document.body.classList.remove("lobby");
+        }
+        return;
+    }
+    if (lobby.hidden) {
+        debug("Game clock has not started, showing the lobby.");
+        lobby.hidden = false;
+        document.body.classList.add("lobby");
+        rotate_lobby();
+    }
+    let left = c.paused ? c.until : Math.ceil((c.start - now) / 1000);
+    document.getElementById("lobby-clock").innerText = clock_format(left);
+    document.getElementById("lobby-start").innerText = translate("clock.at", {at: time_format(c.starts_at, true)});
+}
+function clock_format(seconds) {
+    let h = Math.floor(seconds / 3600), m = Math.floor((seconds % 3600) / 60), s = seconds % 60;
+    return (h > 0 ? h + ":" : "") + String(m).padStart(2, "0") + ":" + String(s).padStart(2, "0");
+}
+function time_format(value, named = false) {
+    // Times are sent in UTC and shown in the display time zone instead of the time
+    // zone of the browser, so every viewer sees the same times as the event staff.
+    let date = new Date(value);
+    if (isNaN(date.getTime())) {
+        return "";
+    }
+    let options = {hour: "2-digit", minute: "2-digit"};
+    if (named) {
+        options.timeZoneName = "short";
+    }
+    try {
+        options.timeZone = (typeof zone !== "undefined" && zone) ? zone : "UTC";
+        return date.toLocaleTimeString([document.documentElement.lang], options);
+    } catch (e) {
+        delete options.timeZone;
+        return date.toLocaleTimeString([document.documentElement.lang], options);
+    }
+}
+function translate(key, values) {
+    // Messages missing from the catalog are shown as their key, so they are easy
+    // to find.
+    let text = (typeof catalog !== "undefined" && catalog && catalog[key]) || key;
+    if (!values) {
+        return text;
+    }
+    return text.replace(/\{(\w+)\}/g, function(match, name) {
+        return values[name] !== undefined ? values[name] : match;
+    });
+}
+function ticker_text(data) {
+    // The server text is kept when it was changed by a script, or when the catalog
+    // does not have the message, such as for the built in English text.
+    if (data.announced === "true" || !data.kind || typeof catalog === "undefined" || !catalog) {
+        return data.text;
+    }
+    let key = "ticker." + data.kind;
+    let old = parseInt(data.old, 10), now = parseInt(data.new, 10);
+    let values = {team: data.name, other: data.other, rank: now, points: now};
+    switch (data.kind) {
+        case "rank":
+            key = now < old ? "ticker.rank_up" : "ticker.rank_down";
+            break;
+        case "flag":
+            values.count = now - old;
+            if (values.count === 1) {
+                key = "ticker.flag_one";
+            }
+            break;
+        case "service_down":
+        case "service_up":
+            values.service = data.host + ":" + data.port;
+            break;
+        case "clock":
+            if (now <= 0) {
+                key = "ticker.clock_ended";
+                break;
+            }
+            values.minutes = Math.max(1, Math.round(now / 60));
+            if (values.minutes === 1) {
+                key = "ticker.clock_one";
+            }
+            break;
+        case "hill":
+            // Released hills have no new owner, only the team that lost the hill.
+            values.host = data.host;
+            if (!data.name) {
+                key = "ticker.hill_lost";
+            } else if (data.other) {
+                key = "ticker.hill_from";
+            }
+            break;
+    }
+    if (!catalog[key] || !data.name && data.kind !== "clock" && data.kind !== "game_over" && key !== "ticker.hill_lost") {
+        return data.text;
+    }
+    return translate(key, values);
+}
+function accessible() {
+    return typeof access !== "undefined" && access === true;
+}
+function path(url) {
+    // Tenant scoreboards are served under their own path prefix.
+    if (typeof base !== "undefined" && base) {
+        return base + url;
+    }
+    return url;
+}
 function is_mobile(css_only = false) {
     let media_match = window.matchMedia("only screen and (max-width: 650px)").matches || window.matchMedia("only screen and (max-width:767px) and (orientation:portrait)").matches
     if (media_match) {
@@ -709,13 +1434,539 @@ function select_div(panel, entries, select) {
             }
         }
     }
+    if (panel === "graph") {
+        graph_load();
+    }
+    if (panel === "matrix") {
+        matrix_load();
+    }
+    if (panel === "beacons") {
+        beacons_load();
+    }
+    if (panel === "challenges") {
+        challenges_load();
+    }
+    if (panel === "hills") {
+        hills_load();
+    }
+    if (panel === "availability") {
+        availability_load();
+    }
+    let division = null;
+    if (panel.indexOf("division-") === 0) {
+        division = panel.substring(9);
+    }
+    let teams = document.getElementsByClassName("team");
+    for (let i = 0; i < teams.length; i++) {
+        let team_division = document.getElementById(teams[i].id + "-name-division");
+        if (division === null || (team_division !== null && division_slug(team_division.innerText) === division)) {
+            teams[i].classList.remove("division-hidden");
+        } else {
+            teams[i].classList.add("division-hidden");
+        }
+    }
     let team = document.getElementById("game-team");
     if (team === null) {
         return;
     }
-    if (panel === "auto" || panel === "overview") {
+    if (panel === "auto" || panel === "overview" || division !== null) {
         team.classList.remove("single");
     } else {
         team.classList.add("single");
     }
 }
+function graph_load() {
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Score history request returned " + request.status + "!");
+            return;
+        }
+        graph_draw(JSON.parse(request.responseText));
+    };
+    let url = path("/api/v1/history/scores") + "?game=" + game + "&top=" + graph_top;
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (token) {
+        url = url + "&token=" + encodeURIComponent(token);
+    }
+    request.open("GET", url);
+    request.send();
+}
+function matrix_load() {
+    clearTimeout(document.sb_matrix);
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Service matrix request returned " + request.status + "!");
+            return;
+        }
+        matrix_draw(JSON.parse(request.responseText));
+    };
+    let url = path("/api/v1/services") + "?game=" + game;
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (token) {
+        url = url + "&token=" + encodeURIComponent(token);
+    }
+    request.open("GET", url);
+    request.send();
+    let matrix = document.getElementById("matrix");
+    if (matrix !== null && matrix.classList.contains("selected")) {
+        document.sb_matrix = setTimeout(matrix_load, interval_team);
+    }
+}
+function matrix_draw(matrix) {
+    let table = document.getElementById("matrix-table");
+    if (table === null) {
+        return;
+    }
+    table.innerHTML = "";
+    let header = document.createElement("tr");
+    let corner = document.createElement("th");
+    corner.innerText = translate("matrix.team");
+    header.appendChild(corner);
+    for (let i = 0; i < matrix.services.length; i++) {
+        let name = document.createElement("th");
+        name.innerText = matrix.services[i];
+        header.appendChild(name);
+    }
+    table.appendChild(header);
+    for (let i = 0; i < matrix.teams.length; i++) {
+        let row = document.createElement("tr");
+        let name = document.createElement("td");
+        name.className = "matrix-team";
+        name.innerText = matrix.teams[i].name;
+        row.appendChild(name);
+        for (let x = 0; x < matrix.teams[i].services.length; x++) {
+            let service = matrix.teams[i].services[x];
+            let cell = document.createElement("td");
+            cell.className = "matrix-" + service.status;
+            if (service.status !== "none") {
+                cell.innerText = service.sla.toFixed(1) + "%";
+                cell.title = (service.host ? service.host + " " : "") + service.status;
+                // The status is also shown as text, as the cell colors are hard to tell
+                // apart for some viewers.
+                cell.setAttribute("aria-label", translate("aria." + service.status) + ", " + cell.innerText);
+                if (accessible()) {
+                    cell.innerText = translate("aria." + service.status) + " " + cell.innerText;
+                }
+            }
+            row.appendChild(cell);
+        }
+        table.appendChild(row);
+    }
+}
+function beacons_load() {
+    clearTimeout(document.sb_beacons);
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Beacons request returned " + request.status + "!");
+            return;
+        }
+        beacons_draw(JSON.parse(request.responseText));
+    };
+    let url = path("/api/v1/beacons") + "?game=" + game;
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (token) {
+        url = url + "&token=" + encodeURIComponent(token);
+    }
+    request.open("GET", url);
+    request.send();
+    let beacons = document.getElementById("beacons");
+    if (beacons !== null && beacons.classList.contains("selected")) {
+        document.sb_beacons = setTimeout(beacons_load, interval_team);
+    }
+}
+function beacons_draw(list) {
+    let table = document.getElementById("beacons-table");
+    if (table === null) {
+        return;
+    }
+    table.innerHTML = "";
+    let header = document.createElement("tr");
+    let names = ["", translate("beacons.attacker"), translate("beacons.victim"), translate("beacons.host"), translate("beacons.active")];
+    for (let i = 0; i < names.length; i++) {
+        let name = document.createElement("th");
+        name.innerText = names[i];
+        header.appendChild(name);
+    }
+    table.appendChild(header);
+    for (let i = 0; i < list.beacons.length; i++) {
+        let beacon = list.beacons[i];
+        let row = document.createElement("tr");
+        let color = document.createElement("td");
+        color.className = "beacons-color";
+        if (beacon.color) {
+            color.style.background = beacon.color;
+        }
+        row.appendChild(color);
+        let values = [beacon.team, beacon.victim, beacon.host || "", clock_format(beacon.duration)];
+        for (let x = 0; x < values.length; x++) {
+            let cell = document.createElement("td");
+            cell.innerText = values[x];
+            row.appendChild(cell);
+        }
+        table.appendChild(row);
+    }
+}
+function hills_load() {
+    clearTimeout(document.sb_hills);
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Hills request returned " + request.status + "!");
+            return;
+        }
+        hills_draw(JSON.parse(request.responseText));
+    };
+    let url = path("/api/v1/hills") + "?game=" + game;
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (token) {
+        url = url + "&token=" + encodeURIComponent(token);
+    }
+    request.open("GET", url);
+    request.send();
+    // The hills are requested every so often while the tab is hidden, so it is shown
+    // once the source sends any hills.
+    let hills = document.getElementById("hills");
+    if (hills !== null && hills.classList.contains("selected")) {
+        document.sb_hills = setTimeout(hills_load, interval_team);
+    } else if (document.getElementById("hills-tab").style.display === "none") {
+        document.sb_hills = setTimeout(hills_load, interval_all * 4);
+    }
+}
+function hills_draw(list) {
+    let tab = document.getElementById("hills-tab");
+    if (tab !== null) {
+        tab.style.display = list.hills.length > 0 ? "" : "none";
+    }
+    let table = document.getElementById("hills-table");
+    if (table === null) {
+        return;
+    }
+    table.innerHTML = "";
+    let header = document.createElement("tr");
+    let names = ["", translate("hills.hill"), translate("hills.owner"), translate("hills.held")];
+    for (let i = 0; i < names.length; i++) {
+        let name = document.createElement("th");
+        name.innerText = names[i];
+        header.appendChild(name);
+    }
+    table.appendChild(header);
+    // The hold times are counted up every second from the time of the request, so
+    // the hills do not have to be requested again to show them.
+    let loaded = Date.now();
+    for (let i = 0; i < list.hills.length; i++) {
+        let hill = list.hills[i];
+        let row = document.createElement("tr");
+        let color = document.createElement("td");
+        color.className = "hills-color";
+        if (hill.color) {
+            color.style.background = hill.color;
+        }
+        let name = document.createElement("td"), owner = document.createElement("td"), held = document.createElement("td");
+        name.innerText = hill.name;
+        if (hill.team_id) {
+            owner.innerText = hill.team;
+            held.className = "hills-held";
+            held.dataset.duration = hill.duration;
+            held.dataset.loaded = loaded;
+            held.innerText = clock_format(hill.duration);
+        } else {
+            row.className = "hills-open";
+            owner.innerText = translate("hills.open");
+        }
+        row.append(color, name, owner, held);
+        table.appendChild(row);
+    }
+}
+function hills_tick() {
+    let cells = document.getElementsByClassName("hills-held");
+    for (let i = 0; i < cells.length; i++) {
+        let seconds = parseInt(cells[i].dataset.duration, 10) + Math.floor((Date.now() - parseInt(cells[i].dataset.loaded, 10)) / 1000);
+        cells[i].innerText = clock_format(seconds);
+    }
+}
+function availability_load() {
+    clearTimeout(document.sb_availability);
+    // The availability is only kept by the history store, which adds the tab.
+    if (document.getElementById("availability-tab") === null) {
+        return;
+    }
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Availability request returned " + request.status + "!");
+            return;
+        }
+        availability_draw(JSON.parse(request.responseText));
+    };
+    let url = path("/api/v1/history/availability") + "?game=" + game;
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (token) {
+        url = url + "&token=" + encodeURIComponent(token);
+    }
+    request.open("GET", url);
+    request.send();
+    let availability = document.getElementById("availability");
+    if (availability !== null && availability.classList.contains("selected")) {
+        document.sb_availability = setTimeout(availability_load, interval_team);
+    } else if (document.getElementById("availability-tab").style.display === "none") {
+        document.sb_availability = setTimeout(availability_load, interval_all * 4);
+    }
+}
+function availability_draw(list) {
+    let tab = document.getElementById("availability-tab");
+    if (tab !== null) {
+        tab.style.display = list.teams.length > 0 ? "" : "none";
+    }
+    let table = document.getElementById("availability-table");
+    if (table === null) {
+        return;
+    }
+    table.innerHTML = "";
+    let header = document.createElement("tr");
+    let names = ["#", translate("matrix.team"), translate("availability.sla")].concat(list.services);
+    for (let i = 0; i < names.length; i++) {
+        let name = document.createElement("th");
+        name.innerText = names[i];
+        header.appendChild(name);
+    }
+    table.appendChild(header);
+    for (let i = 0; i < list.teams.length; i++) {
+        let team = list.teams[i];
+        let row = document.createElement("tr");
+        let rank = document.createElement("td"), name = document.createElement("td"), sla = document.createElement("td");
+        rank.innerText = i + 1;
+        name.innerText = team.name;
+        sla.className = "availability-sla";
+        sla.innerText = team.sla.toFixed(1) + "%";
+        row.append(rank, name, sla);
+        for (let x = 0; x < team.services.length; x++) {
+            let cell = document.createElement("td");
+            // Services that the team does not have are sent as -1.
+            if (team.services[x] < 0) {
+                cell.className = "availability-none";
+                cell.innerText = "-";
+                cell.setAttribute("aria-label", translate("availability.none"));
+            } else {
+                cell.innerText = team.services[x].toFixed(1) + "%";
+            }
+            row.appendChild(cell);
+        }
+        table.appendChild(row);
+    }
+}
+function challenges_load() {
+    clearTimeout(document.sb_challenges);
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Challenges request returned " + request.status + "!");
+            return;
+        }
+        challenges_draw(JSON.parse(request.responseText));
+    };
+    let url = path("/api/v1/challenges") + "?game=" + game;
+    let token = new URLSearchParams(document.location.search).get("token");
+    if (token) {
+        url = url + "&token=" + encodeURIComponent(token);
+    }
+    request.open("GET", url);
+    request.send();
+    // The challenges are requested again while the tab is selected, and every so often
+    // while the tab is hidden, so it is shown once the source sends any challenges.
+    let challenges = document.getElementById("challenges");
+    if (challenges !== null && challenges.classList.contains("selected")) {
+        document.sb_challenges = setTimeout(challenges_load, interval_team);
+    } else if (document.getElementById("challenges-tab").style.display === "none") {
+        document.sb_challenges = setTimeout(challenges_load, interval_all * 4);
+    }
+}
+function challenges_draw(board) {
+    let tab = document.getElementById("challenges-tab");
+    if (tab !== null) {
+        tab.style.display = board.challenges.length > 0 ? "" : "none";
+    }
+    let table = document.getElementById("challenges-table");
+    if (table === null) {
+        return;
+    }
+    table.innerHTML = "";
+    let categories = document.createElement("tr"), header = document.createElement("tr");
+    let corner = document.createElement("th");
+    corner.rowSpan = 2;
+    corner.innerText = translate("matrix.team");
+    categories.appendChild(corner);
+    for (let i = 0; i < board.challenges.length; i++) {
+        let challenge = board.challenges[i];
+        if (i === 0 || board.challenges[i - 1].category !== challenge.category) {
+            let category = document.createElement("th");
+            category.className = "challenges-category";
+            category.colSpan = 0;
+            category.innerText = challenge.category;
+            categories.appendChild(category);
+        }
+        categories.lastChild.colSpan++;
+        let name = document.createElement("th");
+        name.innerText = challenge.name + " (" + challenge.points + ")";
+        name.title = translate("challenges.solves", {count: challenge.solvers.length});
+        header.appendChild(name);
+    }
+    table.append(categories, header);
+    for (let i = 0; i < board.teams.length; i++) {
+        let team = board.teams[i];
+        let row = document.createElement("tr");
+        let name = document.createElement("td");
+        name.className = "challenges-team";
+        name.innerText = team.name;
+        row.appendChild(name);
+        for (let x = 0; x < board.challenges.length; x++) {
+            let challenge = board.challenges[x], cell = document.createElement("td"), place = challenge.solvers.indexOf(team.id);
+            if (place >= 0) {
+                cell.className = place === 0 ? "challenges-first" : "challenges-solved";
+                cell.innerText = place === 0 ? "\u2605" : "\u2713";
+                cell.title = translate(place === 0 ? "challenges.first" : "challenges.solved", {team: team.name, challenge: challenge.name});
+                cell.setAttribute("aria-label", cell.title);
+            }
+            row.appendChild(cell);
+        }
+        table.appendChild(row);
+    }
+}
+function graph_draw(history) {
+    let canvas = document.getElementById("graph-canvas");
+    let legend = document.getElementById("graph-legend");
+    if (canvas === null || legend === null) {
+        return;
+    }
+    canvas.width = canvas.offsetWidth;
+    canvas.height = canvas.offsetHeight;
+    let layer = canvas.getContext("2d");
+    layer.clearRect(0, 0, canvas.width, canvas.height);
+    legend.innerHTML = "";
+    if (!history.series || history.series.length === 0) {
+        layer.fillStyle = "rgb(255, 255, 255)";
+        layer.font = "18px monospace";
+        layer.fillText(translate("graph.empty"), 10, 30);
+        return;
+    }
+    let time_min = Infinity, time_max = -Infinity, score_min = 0, score_max = 1;
+    for (let i = 0; i < history.series.length; i++) {
+        let points = history.series[i].points;
+        for (let x = 0; x < points.length; x++) {
+            time_min = Math.min(time_min, points[x][0]);
+            time_max = Math.max(time_max, points[x][0]);
+            score_min = Math.min(score_min, points[x][1]);
+            score_max = Math.max(score_max, points[x][1]);
+        }
+    }
+    let pad = 40;
+    let width = canvas.width - pad * 2, height = canvas.height - pad * 2;
+    let time_span = Math.max(time_max - time_min, 1), score_span = Math.max(score_max - score_min, 1);
+    layer.strokeStyle = "rgb(128, 128, 128)";
+    layer.fillStyle = "rgb(255, 255, 255)";
+    layer.font = "12px monospace";
+    layer.beginPath();
+    layer.moveTo(pad, pad);
+    layer.lineTo(pad, pad + height);
+    layer.lineTo(pad + width, pad + height);
+    layer.stroke();
+    layer.fillText(score_max.toString(), 2, pad);
+    layer.fillText(score_min.toString(), 2, pad + height);
+    layer.fillText(time_format(time_min), pad, pad + height + 16);
+    layer.fillText(time_format(time_max), pad + width - 70, pad + height + 16);
+    layer.lineWidth = 3;
+    for (let i = 0; i < history.series.length; i++) {
+        let points = history.series[i].points;
+        let color = graph_colors[i % graph_colors.length];
+        layer.strokeStyle = color;
+        layer.beginPath();
+        for (let x = 0; x < points.length; x++) {
+            let px = pad + ((points[x][0] - time_min) / time_span) * width;
+            let py = pad + height - ((points[x][1] - score_min) / score_span) * height;
+            if (x === 0) {
+                layer.moveTo(px, py);
+            } else {
+                layer.lineTo(px, py);
+            }
+        }
+        layer.stroke();
+        let entry = document.createElement("span");
+        entry.classList.add("graph-team");
+        entry.style.borderColor = color;
+        entry.innerText = history.series[i].name + " (" + points[points.length - 1][1] + ")";
+        legend.appendChild(entry);
+    }
+    debug("Drew score graph with " + history.series.length + " teams.");
+}
+function sponsors_load() {
+    // The sponsors are requested again when a sponsor window starts or ends, so the
+    // server decides which sponsors are shown and the admin API can change them live.
+    let element = document.getElementById("sponsors");
+    if (element === null) {
+        return;
+    }
+    clearTimeout(document.sb_sponsors_load);
+    let request = new XMLHttpRequest();
+    request.onload = function () {
+        if (request.status !== 200) {
+            debug("Sponsors request returned " + request.status + "!");
+            document.sb_sponsors_load = setTimeout(sponsors_load, 60000);
+            return;
+        }
+        let data = JSON.parse(request.responseText);
+        document.sb_sponsors = data.sponsors || [];
+        document.sb_sponsors_load = setTimeout(sponsors_load, Math.max(1, data.refresh) * 1000);
+        if (document.sb_sponsors_rotate !== data.rotate) {
+            clearInterval(document.sb_sponsors_timer);
+            document.sb_sponsors_rotate = data.rotate;
+            document.sb_sponsors_timer = setInterval(sponsors_next, data.rotate * 1000);
+        }
+        debug("Received " + document.sb_sponsors.length + " sponsors.");
+        sponsors_next();
+    };
+    request.onerror = function () {
+        document.sb_sponsors_load = setTimeout(sponsors_load, 60000);
+    };
+    request.open("GET", path("/api/v1/sponsors"));
+    request.send();
+}
+function sponsors_next() {
+    // Sponsors are picked with a smooth weighted round robin, so each sponsor is
+    // shown as often as its weight without being shown several times in a row.
+    let element = document.getElementById("sponsors");
+    let list = document.sb_sponsors || [];
+    if (element === null) {
+        return;
+    }
+    if (list.length === 0) {
+        element.hidden = true;
+        element.innerHTML = "";
+        return;
+    }
+    let current = document.sb_sponsors_current || {}, total = 0, pick = null;
+    for (let i = 0; i < list.length; i++) {
+        current[list[i].name] = (current[list[i].name] || 0) + list[i].weight;
+        total += list[i].weight;
+        if (pick === null || current[list[i].name] > current[pick.name]) {
+            pick = list[i];
+        }
+    }
+    current[pick.name] -= total;
+    document.sb_sponsors_current = current;
+    let image = document.createElement("img");
+    image.src = pick.image;
+    image.alt = pick.name;
+    let item = image;
+    if (pick.link) {
+        item = document.createElement("a");
+        item.href = pick.link;
+        item.rel = "noopener";
+        item.target = "_blank";
+        item.appendChild(image);
+    }
+    element.innerHTML = "";
+    element.appendChild(item);
+    element.hidden = false;
+}
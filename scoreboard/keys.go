@@ -0,0 +1,404 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keyPrefix starts every API key, so leaked keys are easy to find in logs and
+	// repositories.
+	keyPrefix = "sbk_"
+	// keyCache is the time a key is kept in memory before it is read from the database
+	// again, so keys revoked on another node of the cluster stop working.
+	keyCache = time.Second * 30
+	// keyCacheMax is the most keys kept in memory, including unknown keys.
+	keyCacheMax = 1024
+)
+
+// scopeScores is the scope of API keys that can read the live standings and the names
+// of an anonymous Game, like a request with the admin token.
+const scopeScores = "read:scores"
+
+// scopes is the admin API endpoints that API keys can be given access to, as the
+// path after "/api/v1/admin/" with slashes replaced by dashes. A key needs the "read:"
+// scope of the resource for GET requests and the "write:" scope for other requests.
+// Endpoints that are not listed, such as the keys themselves, need the admin token.
+var scopes = [...]string{
+	"adjustments", "announce", "clock", "config-history", "displays", "finale", "freeze", "game-switch", "log", "logos",
+	"podium", "presenter", "profiles", "reload", "replay", "skew", "sponsors", "tweets", "twitter",
+}
+
+// keychain is the API keys stored in the history database. Only the SHA-256 hash of the
+// secret part of each key is stored, as keys are long random values.
+type keychain struct {
+	db     *sql.DB
+	cache  map[string]cached
+	add    string
+	store  string
+	get    string
+	list   string
+	revoke string
+	lock   sync.Mutex
+}
+type cached struct {
+	key    *apiKey
+	loaded time.Time
+}
+
+// apiKey is an API key, without its secret.
+type apiKey struct {
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Scopes  []string   `json:"scopes"`
+
+	hash string
+}
+
+func newKeychain(h *history) *keychain {
+	p := h.binds
+	return &keychain{
+		db:     h.db,
+		cache:  make(map[string]cached),
+		add:    "INSERT INTO api_keys (id, name, hash, scopes, created, expires, revoked) VALUES (" + strings.Join(p[:6], ", ") + ", 0)",
+		store:  "INSERT INTO api_keys (id, name, hash, scopes, created, expires, revoked) VALUES (" + strings.Join(p[:6], ", ") + ", 0) ON CONFLICT (id) DO NOTHING",
+		get:    "SELECT id, name, hash, scopes, created, expires, revoked FROM api_keys WHERE id = " + p[0],
+		list:   "SELECT id, name, hash, scopes, created, expires, revoked FROM api_keys ORDER BY created",
+		revoke: "UPDATE api_keys SET revoked = " + p[0] + " WHERE id = " + p[1] + " AND revoked = 0",
+	}
+}
+
+// scope returns the scope a key needs for the admin request, or an empty string if keys
+// cannot be used for the request.
+func scope(r *http.Request) string {
+	n := strings.ReplaceAll(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/"), "/"), "/", "-")
+	if !listed(scopes[:], n) {
+		return ""
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return "read:" + n
+	}
+	return "write:" + n
+}
+
+// valid returns true if the scope can be given to a key.
+func valid(s string) bool {
+	if s == scopeScores {
+		return true
+	}
+	switch {
+	case strings.HasPrefix(s, "read:"):
+		return listed(scopes[:], s[5:])
+	case strings.HasPrefix(s, "write:"):
+		return listed(scopes[:], s[6:])
+	}
+	return false
+}
+func (k *apiKey) allows(s string, n time.Time) bool {
+	if k.Revoked != nil || (k.Expires != nil && !k.Expires.After(n)) {
+		return false
+	}
+	return listed(k.Scopes, s)
+}
+func scan(r interface{ Scan(...interface{}) error }) (*apiKey, error) {
+	var (
+		k       apiKey
+		s       string
+		c, e, v int64
+	)
+	if err := r.Scan(&k.ID, &k.Name, &k.hash, &s, &c, &e, &v); err != nil {
+		return nil, err
+	}
+	if k.Created, k.Scopes = time.UnixMilli(c).UTC(), strings.Fields(s); e > 0 {
+		t := time.UnixMilli(e).UTC()
+		k.Expires = &t
+	}
+	if v > 0 {
+		t := time.UnixMilli(v).UTC()
+		k.Revoked = &t
+	}
+	return &k, nil
+}
+
+// lookup returns the key with the ID from the cache, or from the database if the cached
+// key is too old. Unknown IDs are also cached, so invalid keys do not each query the
+// database.
+func (r *keychain) lookup(x context.Context, i string) (*apiKey, error) {
+	n := time.Now()
+	r.lock.Lock()
+	c, ok := r.cache[i]
+	r.lock.Unlock()
+	if ok && n.Sub(c.loaded) < keyCache {
+		return c.key, nil
+	}
+	k, err := scan(r.db.QueryRowContext(x, r.get, i))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	r.lock.Lock()
+	if len(r.cache) >= keyCacheMax {
+		r.cache = make(map[string]cached)
+	}
+	r.cache[i] = cached{key: k, loaded: n}
+	r.lock.Unlock()
+	return k, nil
+}
+
+// check returns the key if the value is a valid key that has the scope.
+func (r *keychain) check(x context.Context, v, s string) (*apiKey, bool) {
+	if !strings.HasPrefix(v, keyPrefix) {
+		return nil, false
+	}
+	i, p, ok := strings.Cut(v[len(keyPrefix):], "_")
+	if !ok || len(i) != 16 || len(p) == 0 {
+		return nil, false
+	}
+	k, err := r.lookup(x, i)
+	if err != nil || k == nil {
+		return nil, false
+	}
+	h := sha256.Sum256([]byte(p))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(h[:])), []byte(k.hash)) != 1 {
+		return nil, false
+	}
+	return k, k.allows(s, time.Now())
+}
+
+// create adds a new key and returns it with the full key value, which is only shown
+// once as it is not stored.
+func (r *keychain) create(x context.Context, n string, s []string, e time.Time) (*apiKey, string, error) {
+	var i [8]byte
+	rand.Read(i[:])
+	var p [24]byte
+	rand.Read(p[:])
+	var (
+		t = time.Now().UTC()
+		v = base64.RawURLEncoding.EncodeToString(p[:])
+		h = sha256.Sum256([]byte(v))
+		k = &apiKey{ID: hex.EncodeToString(i[:]), Name: n, Scopes: s, Created: t, hash: hex.EncodeToString(h[:])}
+		d int64
+	)
+	if !e.IsZero() {
+		e = e.UTC()
+		k.Expires, d = &e, e.UnixMilli()
+	}
+	if _, err := r.db.ExecContext(x, r.add, k.ID, k.Name, k.hash, strings.Join(s, " "), t.UnixMilli(), d); err != nil {
+		return nil, "", err
+	}
+	return k, keyPrefix + k.ID + "_" + v, nil
+}
+
+// insert adds a key created by another node of the cluster. Keys that already exist are
+// left as is, as the nodes may share the database.
+func (r *keychain) insert(x context.Context, k *apiKey) error {
+	var d int64
+	if k.Expires != nil {
+		d = k.Expires.UnixMilli()
+	}
+	_, err := r.db.ExecContext(x, r.store, k.ID, k.Name, k.hash, strings.Join(k.Scopes, " "), k.Created.UnixMilli(), d)
+	return err
+}
+
+// remove revokes the key and returns false if the key does not exist or was already
+// revoked. Revoked keys are kept so they are still listed.
+func (r *keychain) remove(x context.Context, i string) (bool, error) {
+	o, err := r.db.ExecContext(x, r.revoke, time.Now().UnixMilli(), i)
+	if err != nil {
+		return false, err
+	}
+	r.lock.Lock()
+	delete(r.cache, i)
+	r.lock.Unlock()
+	c, _ := o.RowsAffected()
+	return c > 0, nil
+}
+func (r *keychain) all(x context.Context) ([]apiKey, error) {
+	q, err := r.db.QueryContext(x, r.list)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	o := make([]apiKey, 0)
+	for q.Next() {
+		k, err := scan(q)
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, *k)
+	}
+	return o, q.Err()
+}
+
+// credential returns the bearer token of the request, or the "token" query parameter if
+// q is true.
+func credential(r *http.Request, q bool) string {
+	if q {
+		if v := r.URL.Query().Get("token"); len(v) > 0 {
+			return v
+		}
+	}
+	if a := r.Header.Get("Authorization"); len(a) > 7 && strings.EqualFold(a[:7], "bearer ") {
+		return a[7:]
+	}
+	return ""
+}
+
+// permitted returns true if the request has the admin token or an API key with the
+// scope. If q is true, the token can also be in the "token" query parameter.
+func (s *Scoreboard) permitted(r *http.Request, q bool, c string) bool {
+	if s.authorized(r, q) {
+		return true
+	}
+	if s.chain == nil || len(c) == 0 {
+		return false
+	}
+	k, ok := s.chain.check(r.Context(), credential(r, q), c)
+	if ok {
+		s.log.request(r).Debug(`API key "%s" (%s) used scope "%s" from "%s".`, k.Name, k.ID, c, r.RemoteAddr)
+	}
+	return ok
+}
+func (s *Scoreboard) httpKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		k, err := s.chain.all(r.Context())
+		if err != nil {
+			fail(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k)
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c struct {
+		Action   string   `json:"action"`
+		Name     string   `json:"name"`
+		ID       string   `json:"id"`
+		Duration string   `json:"duration"`
+		Hash     string   `json:"hash"`
+		Key      *apiKey  `json:"key"`
+		Scopes   []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	_, x := r.Context().Value(clusterKey{}).(string)
+	switch strings.ToLower(c.Action) {
+	case "create":
+	case "store":
+		// Only nodes of the cluster share the keys they created, with the ID and hash
+		// already set.
+		if !x || c.Key == nil || len(c.Key.ID) != 16 || len(c.Hash) != 64 {
+			fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+			return
+		}
+		if c.Key.hash = c.Hash; s.chain.insert(r.Context(), c.Key) != nil {
+			fail(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "revoke":
+		ok, err := s.chain.remove(r.Context(), c.ID)
+		if err != nil {
+			fail(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Relayed requests revoke the key again, which is not an error if the nodes
+		// share the database.
+		if !ok && !x {
+			fail(w, `key "`+c.ID+`" does not exist or is already revoked`, http.StatusNotFound)
+			return
+		}
+		s.log.request(r).Info(`Admin "%s" revoked API key "%s".`, r.RemoteAddr, c.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	// Keys are created once on the node that received the request, as each node would
+	// create a different key. The created key is shared with the other nodes instead.
+	if local(r); x {
+		return
+	}
+	if c.Name = strings.TrimSpace(c.Name); len(c.Name) == 0 || len(c.Name) > 128 {
+		fail(w, "a key name of up to 128 characters is required", http.StatusBadRequest)
+		return
+	}
+	if len(c.Scopes) == 0 {
+		fail(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for i := range c.Scopes {
+		if c.Scopes[i] = strings.ToLower(c.Scopes[i]); !valid(c.Scopes[i]) {
+			fail(w, `scope "`+c.Scopes[i]+`" is not valid`, http.StatusBadRequest)
+			return
+		}
+	}
+	sort.Strings(c.Scopes)
+	var e time.Time
+	if len(c.Duration) > 0 {
+		d, err := time.ParseDuration(c.Duration)
+		if err != nil || d <= 0 {
+			fail(w, "duration must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		e = time.Now().Add(d)
+	}
+	k, v, err := s.chain.create(r.Context(), c.Name, c.Scopes, e)
+	if err != nil {
+		fail(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" created API key "%s" (%s) with scopes %s.`, r.RemoteAddr, k.Name, k.ID, strings.Join(k.Scopes, ", "))
+	if s.cluster != nil {
+		b, _ := json.Marshal(struct {
+			Key    *apiKey `json:"key"`
+			Action string  `json:"action"`
+			Hash   string  `json:"hash"`
+		}{k, "store", k.hash})
+		s.cluster.publish(r.Context(), relayed{Method: http.MethodPost, Path: r.URL.Path, Type: "application/json", Body: b})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*apiKey
+		Key string `json:"key"`
+	}{k, v})
+}
@@ -0,0 +1,177 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ldapTimeout is the time a bind to the directory can take.
+	ldapTimeout = time.Second * 10
+	// ldapMax is the largest response read from the directory.
+	ldapMax = 1 << 16
+)
+
+// directory is the "ldap" backend, which signs in a staff member with a simple bind as
+// their DN and password. Only the bind is sent, so no service account is needed.
+type directory struct {
+	dn    string
+	host  string
+	name  string
+	allow []string
+	tls   bool
+}
+
+func newDirectory(s staff) *directory {
+	u, _ := url.Parse(s.Server)
+	d := &directory{dn: s.DN, host: u.Host, name: u.Hostname(), allow: s.Allow, tls: u.Scheme == "ldaps"}
+	if len(u.Port()) == 0 {
+		if d.tls {
+			d.host = net.JoinHostPort(d.name, "636")
+		} else {
+			d.host = net.JoinHostPort(d.name, "389")
+		}
+	}
+	return d
+}
+
+// escape returns the user name escaped as an RFC 4514 DN value.
+func escape(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == ',' || c == '+' || c == '"' || c == '\\' || c == '<' || c == '>' || c == ';' || c == '=':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20:
+			b.WriteString("\\" + string("0123456789abcdef"[c>>4]) + string("0123456789abcdef"[c&0xF]))
+		case (c == ' ' || c == '#') && i == 0, c == ' ' && i == len(v)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+func (d *directory) authenticate(x context.Context, u, v string) (string, bool) {
+	// An empty password is an unauthenticated bind, which most directories allow for
+	// any DN, so it is never sent.
+	if u, v = password(u, v); len(u) == 0 || len(v) == 0 || !allowed(d.allow, u) {
+		return "", false
+	}
+	x, f := context.WithTimeout(x, ldapTimeout)
+	defer f()
+	var (
+		c   net.Conn
+		err error
+		n   = net.Dialer{}
+	)
+	if d.tls {
+		c, err = (&tls.Dialer{NetDialer: &n, Config: &tls.Config{ServerName: d.name, MinVersion: tls.VersionTLS12}}).DialContext(x, "tcp", d.host)
+	} else {
+		c, err = n.DialContext(x, "tcp", d.host)
+	}
+	if err != nil {
+		return "", false
+	}
+	defer c.Close()
+	if t, ok := x.Deadline(); ok {
+		c.SetDeadline(t)
+	}
+	if _, err = c.Write(bind(strings.ReplaceAll(d.dn, "{user}", escape(u)), v)); err != nil {
+		return "", false
+	}
+	return u, bound(bufio.NewReader(c))
+}
+
+// bind returns the LDAPv3 simple bind request of the DN and password.
+func bind(dn, p string) []byte {
+	r := ber(0x60, append(append(ber(0x02, []byte{3}), ber(0x04, []byte(dn))...), ber(0x80, []byte(p))...))
+	return ber(0x30, append(ber(0x02, []byte{1}), r...))
+}
+
+// ber returns the BER element with the tag and value.
+func ber(t byte, v []byte) []byte {
+	n := len(v)
+	switch {
+	case n < 0x80:
+		return append([]byte{t, byte(n)}, v...)
+	case n < 0x100:
+		return append([]byte{t, 0x81, byte(n)}, v...)
+	case n < 0x10000:
+		return append([]byte{t, 0x82, byte(n >> 8), byte(n)}, v...)
+	}
+	return append([]byte{t, 0x84, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, v...)
+}
+
+// element reads a BER element and returns its tag and value. Lengths in the long form
+// can have leading zeros, which some directories send.
+func element(r io.Reader) (byte, []byte, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	n := int(h[1])
+	if n&0x80 != 0 {
+		k := n & 0x7F
+		if k == 0 || k > 4 {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:k]); err != nil {
+			return 0, nil, err
+		}
+		n = 0
+		for i := 0; i < k; i++ {
+			n = n<<8 | int(b[i])
+		}
+	}
+	if n > ldapMax {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	v := make([]byte, n)
+	if _, err := io.ReadFull(r, v); err != nil {
+		return 0, nil, err
+	}
+	return h[0], v, nil
+}
+
+// bound returns true if the response is a bind response with the "success" result.
+func bound(r io.Reader) bool {
+	t, v, err := element(r)
+	if err != nil || t != 0x30 {
+		return false
+	}
+	b := strings.NewReader(string(v))
+	if t, _, err = element(b); err != nil || t != 0x02 {
+		return false
+	}
+	if t, v, err = element(b); err != nil || t != 0x61 {
+		return false
+	}
+	t, v, err = element(strings.NewReader(string(v)))
+	return err == nil && t == 0x0A && len(v) == 1 && v[0] == 0
+}
@@ -0,0 +1,206 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// unitWait is how long each thread is given to stop before the next thread is stopped.
+// Threads that do not stop in time are reported as stuck and are left running.
+const unitWait = time.Second * 10
+
+const (
+	unitPending uint32 = iota
+	unitRunning
+	unitStopping
+	unitStopped
+	unitStuck
+)
+
+// unit is a long running thread of the Scoreboard, such as a Game ticking thread or a
+// webhook delivery thread. After is the names of the units that must be started before
+// this unit and stopped after it.
+type unit struct {
+	Started time.Time `json:"started"`
+	Stopped time.Time `json:"stopped"`
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+	After   []string  `json:"after,omitempty"`
+	Runs    uint32    `json:"runs"`
+
+	f      func(context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+	state  uint32
+}
+
+// lifecycle owns the long running threads of a Scoreboard. Units are started in the
+// order of their dependencies and stopped in the reverse order, one at a time, so a
+// thread that sends to another thread is stopped before the thread it sends to. Each
+// unit can only be running once, which stops a thread from being started twice.
+type lifecycle struct {
+	units []*unit
+	lock  sync.Mutex
+}
+
+// spawn registers the thread with the name, which is supervised and restarted if it
+// panics. The unit is started by the next call to start.
+func (s *Scoreboard) spawn(n string, f func(context.Context), after ...string) {
+	s.life.lock.Lock()
+	defer s.life.lock.Unlock()
+	for _, u := range s.life.units {
+		if u.Name != n {
+			continue
+		}
+		if v := atomic.LoadUint32(&u.state); v == unitRunning || v == unitStopping || v == unitStuck {
+			s.log.Warning(`Thread "%s" is already running, not starting it again!`, n)
+			return
+		}
+		u.f, u.After, u.state = f, after, unitPending
+		return
+	}
+	s.life.units = append(s.life.units, &unit{Name: n, After: after, f: f})
+}
+
+// order returns the units in the order they are started, which keeps the order they
+// were added in, but moves each unit after the units it depends on. Dependencies that
+// were not added are ignored. The lock must be held when this is called.
+func (l *lifecycle) order() []*unit {
+	var (
+		r = make([]*unit, 0, len(l.units))
+		v = make(map[string]uint8, len(l.units))
+		k = make(map[string]*unit, len(l.units))
+		w func(*unit)
+	)
+	for _, u := range l.units {
+		k[u.Name] = u
+	}
+	w = func(u *unit) {
+		// A dependency loop is broken by starting the unit that closes the loop first.
+		if v[u.Name] > 0 {
+			return
+		}
+		v[u.Name] = 1
+		for _, n := range u.After {
+			if d, ok := k[n]; ok {
+				w(d)
+			}
+		}
+		v[u.Name] = 2
+		r = append(r, u)
+	}
+	for _, u := range l.units {
+		w(u)
+	}
+	return r
+}
+
+// start starts every pending unit.
+func (s *Scoreboard) start() {
+	s.life.lock.Lock()
+	s.life.units = s.life.order()
+	for _, u := range s.life.units {
+		if !atomic.CompareAndSwapUint32(&u.state, unitPending, unitRunning) {
+			continue
+		}
+		var x context.Context
+		x, u.cancel = context.WithCancel(context.Background())
+		u.done, u.Started, u.Stopped = make(chan struct{}), time.Now().UTC(), time.Time{}
+		go s.launch(x, u)
+	}
+	s.life.lock.Unlock()
+}
+func (s *Scoreboard) launch(x context.Context, u *unit) {
+	s.supervise(x, u.Name, func(y context.Context) {
+		s.life.lock.Lock()
+		u.Runs++
+		s.life.lock.Unlock()
+		u.f(y)
+	})
+	s.life.lock.Lock()
+	u.Stopped = time.Now().UTC()
+	s.life.lock.Unlock()
+	atomic.StoreUint32(&u.state, unitStopped)
+	close(u.done)
+}
+
+// halt stops the running units in the reverse of the order they were started in, and
+// waits for each unit to stop before stopping the next one.
+func (s *Scoreboard) halt() {
+	s.life.lock.Lock()
+	u := make([]*unit, len(s.life.units))
+	copy(u, s.life.units)
+	s.life.lock.Unlock()
+	for i := len(u) - 1; i >= 0; i-- {
+		if !atomic.CompareAndSwapUint32(&u[i].state, unitRunning, unitStopping) {
+			continue
+		}
+		s.log.Debug(`Stopping thread "%s"..`, u[i].Name)
+		u[i].cancel()
+		t := time.NewTimer(unitWait)
+		select {
+		case <-u[i].done:
+			t.Stop()
+		case <-t.C:
+			atomic.CompareAndSwapUint32(&u[i].state, unitStopping, unitStuck)
+			s.log.Warning(`Thread "%s" did not stop after %s, leaving it running!`, u[i].Name, unitWait.String())
+		}
+	}
+}
+
+// threads returns the state of every unit, in the order they were started.
+func (s *Scoreboard) threads() []unit {
+	s.life.lock.Lock()
+	r := make([]unit, 0, len(s.life.units))
+	for _, u := range s.life.units {
+		v := unit{Name: u.Name, After: u.After, Runs: u.Runs, Started: u.Started, Stopped: u.Stopped}
+		switch atomic.LoadUint32(&u.state) {
+		case unitPending:
+			v.State = "pending"
+		case unitRunning:
+			v.State = "running"
+		case unitStopping:
+			v.State = "stopping"
+		case unitStopped:
+			v.State = "stopped"
+		case unitStuck:
+			v.State = "stuck"
+		}
+		r = append(r, v)
+	}
+	s.life.lock.Unlock()
+	return r
+}
+func (s *Scoreboard) httpLifecycle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	v := map[string][]unit{"": s.threads()}
+	for n, t := range s.tenant {
+		v[n] = t.threads()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
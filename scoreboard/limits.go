@@ -0,0 +1,191 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// bodyMax is the default largest request body, which is larger than every
+	// request body except logo uploads.
+	bodyMax = 1 << 20
+	// headerMax is the default largest size of the request headers.
+	headerMax = 1 << 15
+)
+
+// serving is the limits of the HTTP server. The request body limit of a route is the
+// limit of the longest matching path prefix in "routes", or "body" if none match. The
+// timeouts are in seconds and use the "timeout" value when zero. The connection limits
+// close new connections once reached and are disabled when zero.
+type serving struct {
+	Routes        map[string]int64 `json:"routes,omitempty"`
+	Body          int64            `json:"body,omitempty"`
+	Headers       int              `json:"headers,omitempty"`
+	HeaderTimeout int              `json:"header_timeout,omitempty"`
+	IdleTimeout   int              `json:"idle_timeout,omitempty"`
+	Connections   int              `json:"connections,omitempty"`
+	PerAddress    int              `json:"per_address,omitempty"`
+}
+
+// gate is a Listener that limits the connections that are open at once, in total and
+// from each address.
+type gate struct {
+	net.Listener
+	log   *journal
+	addrs map[string]int
+	total int
+	max   int
+	each  int
+	lock  sync.Mutex
+}
+type admitted struct {
+	net.Conn
+	g    *gate
+	a    string
+	once sync.Once
+}
+
+func (v serving) verify() error {
+	switch {
+	case v.Body < 0:
+		return &errval{s: "server body limit " + strconv.FormatInt(v.Body, 10) + " cannot be less than zero"}
+	case v.Headers < 0:
+		return &errval{s: "server header limit " + strconv.Itoa(v.Headers) + " cannot be less than zero"}
+	case v.HeaderTimeout < 0:
+		return &errval{s: "server header timeout " + strconv.Itoa(v.HeaderTimeout) + " cannot be less than zero"}
+	case v.IdleTimeout < 0:
+		return &errval{s: "server idle timeout " + strconv.Itoa(v.IdleTimeout) + " cannot be less than zero"}
+	case v.Connections < 0:
+		return &errval{s: "server connection limit " + strconv.Itoa(v.Connections) + " cannot be less than zero"}
+	case v.PerAddress < 0:
+		return &errval{s: "server per address limit " + strconv.Itoa(v.PerAddress) + " cannot be less than zero"}
+	}
+	for k, n := range v.Routes {
+		if len(k) == 0 || k[0] != '/' {
+			return &errval{s: `server route "` + k + `" must start with "/"`}
+		}
+		if n <= 0 {
+			return &errval{s: `server route "` + k + `" body limit must be greater than zero`}
+		}
+	}
+	return nil
+}
+func (v *serving) defaults(t time.Duration) (time.Duration, time.Duration) {
+	if v.Body == 0 {
+		v.Body = bodyMax
+	}
+	if v.Headers == 0 {
+		v.Headers = headerMax
+	}
+	// Logo uploads are larger than the default body limit, so the route keeps the
+	// logo limit unless it is set.
+	if _, ok := v.Routes["/api/v1/admin/logos"]; !ok {
+		r := make(map[string]int64, len(v.Routes)+1)
+		for k, n := range v.Routes {
+			r[k] = n
+		}
+		r["/api/v1/admin/logos"], v.Routes = logoLimit, r
+	}
+	h, i := t, t
+	if v.HeaderTimeout > 0 {
+		h = time.Duration(v.HeaderTimeout) * time.Second
+	}
+	if v.IdleTimeout > 0 {
+		i = time.Duration(v.IdleTimeout) * time.Second
+	}
+	return h, i
+}
+
+// limit returns the largest request body of the path. Tenant paths are checked without
+// the tenant prefix, as tenants are served with the limits of the main Scoreboard.
+func (v *serving) limit(p string) int64 {
+	var (
+		n = v.Body
+		m int
+	)
+	p = unprefixed(p)
+	for k, l := range v.Routes {
+		if len(k) > m && strings.HasPrefix(p, k) {
+			n, m = l, len(k)
+		}
+	}
+	return n
+}
+
+// bound limits the request body to the limit of the request path. Requests that state
+// a larger body are rejected before the body is read.
+func (s *Scoreboard) bound(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.serve.limit(r.URL.Path)
+		if r.ContentLength > n {
+			fail(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// admit returns a Listener that limits the open connections, or the Listener if no
+// connection limits are set.
+func (s *Scoreboard) admit(l net.Listener) net.Listener {
+	if s.serve.Connections == 0 && s.serve.PerAddress == 0 {
+		return l
+	}
+	return &gate{Listener: l, log: s.web, addrs: make(map[string]int), max: s.serve.Connections, each: s.serve.PerAddress}
+}
+func (g *gate) Accept() (net.Conn, error) {
+	for {
+		c, err := g.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		a, _, err := net.SplitHostPort(c.RemoteAddr().String())
+		if err != nil {
+			a = c.RemoteAddr().String()
+		}
+		g.lock.Lock()
+		if (g.max > 0 && g.total >= g.max) || (g.each > 0 && g.addrs[a] >= g.each) {
+			g.lock.Unlock()
+			c.Close()
+			g.log.Debug(`Closed connection from "%s", the connection limit was reached.`, a)
+			continue
+		}
+		g.total++
+		g.addrs[a]++
+		g.lock.Unlock()
+		return &admitted{Conn: c, g: g, a: a}, nil
+	}
+}
+func (e *admitted) Close() error {
+	e.once.Do(func() {
+		e.g.lock.Lock()
+		if e.g.total--; e.g.addrs[e.a] <= 1 {
+			delete(e.g.addrs, e.a)
+		} else {
+			e.g.addrs[e.a]--
+		}
+		e.g.lock.Unlock()
+	})
+	return e.Conn.Close()
+}
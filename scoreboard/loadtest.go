@@ -0,0 +1,342 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/gorilla/websocket"
+)
+
+// siegeReport is how often the load test prints the connected clients.
+const siegeReport = time.Second * 10
+
+// siege is a load test of a running Scoreboard. Each client connects to the WebSocket
+// the same as a browser, at a random time during the ramp up, and stays connected until
+// the test ends, reloading the page at the churn rate and reconnecting a second after
+// the connection is lost.
+type siege struct {
+	dialer  *websocket.Dialer
+	first   map[uint64]time.Time
+	target  string
+	page    string
+	hello   []byte
+	connect []time.Duration
+	deliver []time.Duration
+	clients int
+	ramp    time.Duration
+	churn   float64
+	lock    sync.Mutex
+
+	live, failed, dropped, gaps, reloads uint64
+}
+
+// loadtest runs the "loadtest" command with the command line arguments, and prints the
+// report once the test ends or is interrupted.
+func loadtest(a []string) error {
+	var (
+		args    = flag.NewFlagSet("Scorebot Scoreboard", flag.ExitOnError)
+		s       string
+		n       string
+		g       uint64
+		c       int
+		d, r    int
+		churn   float64
+		timeout int
+	)
+	args.Usage = func() {
+		os.Stdout.WriteString(usage)
+		os.Exit(2)
+	}
+	args.StringVar(&s, "url", "", "")
+	args.StringVar(&n, "name", "", "")
+	args.Uint64Var(&g, "game", 1, "")
+	args.IntVar(&c, "clients", 1000, "")
+	args.IntVar(&d, "duration", 60, "")
+	args.IntVar(&r, "ramp", 30, "")
+	args.Float64Var(&churn, "churn", 0.02, "")
+	args.IntVar(&timeout, "timeout", 10, "")
+	if err := args.Parse(a); err != nil {
+		os.Stdout.WriteString(usage)
+		return flag.ErrHelp
+	}
+	switch {
+	case len(s) == 0:
+		return &errval{s: "the load test requires a Scoreboard URL"}
+	case c <= 0:
+		return &errval{s: "load test clients " + strconv.Itoa(c) + " must be greater than zero"}
+	case g == 0:
+		return &errval{s: "the load test requires a valid game ID"}
+	case d <= 0:
+		return &errval{s: "load test duration " + strconv.Itoa(d) + " must be greater than zero"}
+	case r < 0 || r >= d:
+		return &errval{s: "load test ramp " + strconv.Itoa(r) + " must be zero or more and less than the duration"}
+	case churn < 0 || churn > 1:
+		return &errval{s: "load test churn must be between 0 and 1"}
+	case timeout <= 0:
+		return &errval{s: "load test timeout " + strconv.Itoa(timeout) + " must be greater than zero"}
+	}
+	u, err := url.Parse(s)
+	if err != nil || len(u.Host) == 0 {
+		return &errval{s: `load test URL "` + s + `" is not valid`}
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return &errval{s: `load test URL scheme "` + u.Scheme + `" is not supported`}
+	}
+	// The URL can be the page or WebSocket URL of the board, so both are trimmed to the
+	// base path of the Scoreboard.
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/w")
+	u.RawQuery, u.Fragment = "", ""
+	p := *u
+	if p.Scheme = "http"; u.Scheme == "wss" {
+		p.Scheme = "https"
+	}
+	if u.Path += "/w"; len(n) > 0 {
+		u.Path += "/" + strings.Trim(n, "/")
+	}
+	p.Path += "/"
+	h, _ := json.Marshal(map[string]uint64{"game": g, "version": game.Protocol})
+	v := &siege{
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: time.Duration(timeout) * time.Second,
+			ReadBufferSize:   1 << 12,
+			WriteBufferSize:  1 << 10,
+		},
+		first:   make(map[uint64]time.Time),
+		target:  u.String(),
+		page:    p.String(),
+		hello:   h,
+		clients: c,
+		ramp:    time.Duration(r) * time.Second,
+		churn:   churn,
+	}
+	x, f := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer f()
+	x, f2 := context.WithTimeout(x, time.Duration(d)*time.Second)
+	defer f2()
+	os.Stdout.WriteString("Starting " + strconv.Itoa(c) + " clients on \"" + v.target + "\" over " + strconv.Itoa(r) + " seconds...\n")
+	t := time.Now()
+	v.run(x)
+	v.report(os.Stdout, time.Since(t))
+	return nil
+}
+
+// run starts every client and waits for them to stop, printing the connected clients
+// every report interval.
+func (v *siege) run(x context.Context) {
+	var w sync.WaitGroup
+	w.Add(v.clients)
+	for i := 0; i < v.clients; i++ {
+		var d time.Duration
+		if v.ramp > 0 {
+			d = time.Duration(rand.Int63n(int64(v.ramp)))
+		}
+		go func() {
+			v.client(x, d)
+			w.Done()
+		}()
+	}
+	t := time.NewTicker(siegeReport)
+	defer t.Stop()
+	for {
+		select {
+		case <-x.Done():
+			w.Wait()
+			return
+		case <-t.C:
+			os.Stdout.WriteString(
+				"Connected " + strconv.FormatUint(atomic.LoadUint64(&v.live), 10) + "/" + strconv.Itoa(v.clients) +
+					", " + strconv.FormatUint(atomic.LoadUint64(&v.failed), 10) + " failed, " +
+					strconv.FormatUint(atomic.LoadUint64(&v.dropped), 10) + " dropped.\n",
+			)
+		}
+	}
+}
+
+// client connects after the delay and keeps the connection open until the context is
+// cancelled. A page reload closes the connection and connects again straight away, the
+// same as a browser.
+func (v *siege) client(x context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+		}
+		var l time.Duration
+		if v.churn > 0 {
+			l = time.Duration(rand.ExpFloat64() / v.churn * float64(time.Minute))
+		}
+		switch ok, err := v.session(x, l); {
+		case x.Err() != nil:
+			return
+		case err == nil:
+			atomic.AddUint64(&v.reloads, 1)
+			t.Reset(0)
+		case ok:
+			atomic.AddUint64(&v.dropped, 1)
+			t.Reset(time.Second)
+		default:
+			atomic.AddUint64(&v.failed, 1)
+			t.Reset(time.Second)
+		}
+	}
+}
+
+// session connects to the Scoreboard and reads messages until the connection is lost
+// or the lifetime passes, if not zero. The returned boolean is true if the board was
+// received, and the error is nil if the lifetime passed.
+func (v *siege) session(x context.Context, l time.Duration) (bool, error) {
+	s := time.Now()
+	c, _, err := v.dialer.DialContext(x, v.target, http.Header{"Referer": []string{v.page}})
+	if err != nil {
+		return false, err
+	}
+	var (
+		d    = make(chan struct{})
+		done uint32
+	)
+	defer close(d)
+	go func() {
+		var e <-chan time.Time
+		if l > 0 {
+			t := time.NewTimer(l)
+			defer t.Stop()
+			e = t.C
+		}
+		select {
+		case <-x.Done():
+		case <-d:
+		case <-e:
+			atomic.StoreUint32(&done, 1)
+		}
+		c.Close()
+	}()
+	if err = c.WriteMessage(websocket.TextMessage, v.hello); err != nil {
+		return false, err
+	}
+	var q uint64
+	for f := true; ; f = false {
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			if !f {
+				atomic.AddUint64(&v.live, ^uint64(0))
+			}
+			if atomic.LoadUint32(&done) == 1 {
+				return !f, nil
+			}
+			return !f, err
+		}
+		n := time.Now()
+		var m struct {
+			Seq *uint64 `json:"seq"`
+		}
+		// Messages of older Scoreboards are arrays and do not have a sequence number.
+		if len(b) > 0 && b[0] == '{' {
+			json.Unmarshal(b, &m)
+		}
+		if f {
+			atomic.AddUint64(&v.live, 1)
+			v.lock.Lock()
+			v.connect = append(v.connect, n.Sub(s))
+			v.lock.Unlock()
+			if m.Seq != nil {
+				q = *m.Seq
+			}
+			continue
+		}
+		if m.Seq == nil || *m.Seq <= q {
+			continue
+		}
+		if *m.Seq > q+1 {
+			atomic.AddUint64(&v.gaps, 1)
+		}
+		q = *m.Seq
+		// The delivery time of a message is the time since the first client received
+		// it, which shows how far behind the slowest clients are.
+		v.lock.Lock()
+		if t, ok := v.first[q]; ok {
+			v.deliver = append(v.deliver, n.Sub(t))
+		} else {
+			v.first[q] = n
+			v.deliver = append(v.deliver, 0)
+		}
+		v.lock.Unlock()
+	}
+}
+
+// report prints the connection and delivery time percentiles and the drop rates.
+func (v *siege) report(w *os.File, d time.Duration) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	var (
+		f = atomic.LoadUint64(&v.failed)
+		o = atomic.LoadUint64(&v.dropped)
+		b strings.Builder
+	)
+	b.WriteString("\nLoad test of \"" + v.target + "\" ran for " + d.Round(time.Second).String() + ".\n")
+	b.WriteString("Clients:   " + strconv.Itoa(v.clients) + ", " + strconv.Itoa(len(v.connect)) + " connections, " + strconv.FormatUint(atomic.LoadUint64(&v.reloads), 10) + " reloads\n")
+	b.WriteString("Connect:   " + percentiles(v.connect) + "\n")
+	b.WriteString("Delivery:  " + percentiles(v.deliver) + " (" + strconv.Itoa(len(v.deliver)) + " messages)\n")
+	b.WriteString("Failed:    " + strconv.FormatUint(f, 10) + " (" + rate(f, f+uint64(len(v.connect))) + " of attempts)\n")
+	b.WriteString("Dropped:   " + strconv.FormatUint(o, 10) + " (" + rate(o, uint64(len(v.connect))) + " of connections)\n")
+	b.WriteString("Gaps:      " + strconv.FormatUint(atomic.LoadUint64(&v.gaps), 10) + " (" + rate(atomic.LoadUint64(&v.gaps), uint64(len(v.deliver))) + " of messages)\n")
+	w.WriteString(b.String())
+}
+
+// percentiles returns the 50th, 90th, 99th and largest times.
+func percentiles(l []time.Duration) string {
+	if len(l) == 0 {
+		return "none"
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	p := func(v float64) string {
+		return l[int(v*float64(len(l)-1))].Round(time.Microsecond * 100).String()
+	}
+	return "p50 " + p(0.5) + ", p90 " + p(0.9) + ", p99 " + p(0.99) + ", max " + l[len(l)-1].Round(time.Microsecond*100).String()
+}
+
+// rate returns the share of the total as a percentage.
+func rate(n, t uint64) string {
+	if t == 0 {
+		return "0%"
+	}
+	return strconv.FormatFloat(float64(n)/float64(t)*100, 'f', 2, 64) + "%"
+}
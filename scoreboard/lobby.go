@@ -0,0 +1,93 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"hash/fnv"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// lobbyRotate is the default seconds that each lobby slide is shown for.
+const lobbyRotate = 15
+
+// lobby is the pre-game page shown by the displays until the game clock starts, which
+// shows a countdown to the start time, the slides, such as the rules and sponsors, in
+// turn and the ticker. Displays switch to the scoreboard on their own once the clock
+// starts, so it does not need to be restarted with a different config.
+type lobby struct {
+	Title   string  `json:"title,omitempty"`
+	Image   string  `json:"image,omitempty"`
+	Slides  []slide `json:"slides,omitempty"`
+	Rotate  int     `json:"rotate,omitempty"`
+	Enabled bool    `json:"enabled"`
+}
+type slide struct {
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// picture returns true if the image is a path on the Scoreboard or an absolute http or
+// https URL.
+func picture(s string) bool {
+	if strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0
+}
+func (l lobby) verify() error {
+	if l.Rotate < 0 {
+		return &errval{s: "lobby rotate " + strconv.Itoa(l.Rotate) + " cannot be less than zero"}
+	}
+	if len(l.Image) > 0 && !picture(l.Image) {
+		return &errval{s: `lobby image "` + l.Image + `" must be a path or an absolute http or https URL`}
+	}
+	for i, v := range l.Slides {
+		if len(v.Title) == 0 && len(v.Text) == 0 && len(v.Image) == 0 {
+			return &errval{s: "lobby slide " + strconv.Itoa(i+1) + " needs a title, text or image"}
+		}
+		if len(v.Image) > 0 && !picture(v.Image) {
+			return &errval{s: `lobby slide image "` + v.Image + `" must be a path or an absolute http or https URL`}
+		}
+	}
+	return nil
+}
+
+// Seconds returns the seconds that each slide is shown for.
+func (l *lobby) Seconds() int {
+	if l.Rotate == 0 {
+		return lobbyRotate
+	}
+	return l.Rotate
+}
+
+// stamp returns a hash of the lobby, which is added to the render cache key so pages
+// are rendered again when the lobby is changed by a config reload.
+func (l *lobby) stamp() string {
+	if l == nil {
+		return "0"
+	}
+	h := fnv.New64a()
+	h.Write([]byte(l.Title + "\x00" + l.Image + "\x00" + strconv.Itoa(l.Rotate)))
+	for _, v := range l.Slides {
+		h.Write([]byte("\x00" + v.Title + "\x00" + v.Text + "\x00" + v.Image))
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,170 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// fallback is the language of the built in text, which is used for any messages that
+// are missing from the other catalogs.
+const fallback = "en"
+
+// catalog is the translated messages of a single language, by message key.
+type catalog map[string]string
+
+// T returns the HTML escaped message of the key in the language of the page, so
+// templates can use it as "{{.T "tab.auto"}}".
+func (d *display) T(k string) string {
+	if v, ok := d.Text[k]; ok {
+		return template.HTMLEscapeString(v)
+	}
+	return k
+}
+
+// Catalog returns the messages in the language of the page as a JSON object, for the
+// text shown by the scoreboard script. The JSON encoder escapes HTML characters, so
+// this is safe to use in a script tag.
+func (d *display) Catalog() string {
+	b, err := json.Marshal(d.Text)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// catalogs loads the built in message catalogs and any catalogs in the "locale" folder
+// of the override directory, which replace the built in messages of the same language.
+// Every catalog is filled with the messages of the fallback language that it is
+// missing.
+func catalogs(d string) (map[string]catalog, error) {
+	l := make(map[string]catalog)
+	e, err := fs.ReadDir(resources, "html/locale")
+	if err != nil {
+		return nil, &errval{s: "unable to read the built in message catalogs", e: err}
+	}
+	for i := range e {
+		if err = translation(l, e[i].Name(), func(n string) ([]byte, error) { return resources.ReadFile("html/locale/" + n) }); err != nil {
+			return nil, err
+		}
+	}
+	if len(d) > 0 {
+		if e, err = os.ReadDir(d); err != nil && !os.IsNotExist(err) {
+			return nil, &errval{s: `unable to read locale directory "` + d + `"`, e: err}
+		}
+		for i := range e {
+			if err = translation(l, e[i].Name(), func(n string) ([]byte, error) { return os.ReadFile(filepath.Join(d, n)) }); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b := l[fallback]
+	for _, c := range l {
+		for k, v := range b {
+			if _, ok := c[k]; !ok {
+				c[k] = v
+			}
+		}
+	}
+	return l, nil
+}
+func translation(l map[string]catalog, n string, f func(string) ([]byte, error)) error {
+	if !strings.HasSuffix(n, ".json") {
+		return nil
+	}
+	b, err := f(n)
+	if err != nil {
+		return &errval{s: `unable to read message catalog "` + n + `"`, e: err}
+	}
+	var c catalog
+	if err = json.Unmarshal(b, &c); err != nil {
+		return &errval{s: `unable to parse message catalog "` + n + `"`, e: err}
+	}
+	k := strings.ToLower(strings.TrimSuffix(n, ".json"))
+	if v, ok := l[k]; ok {
+		for x, y := range c {
+			v[x] = y
+		}
+		return nil
+	}
+	l[k] = c
+	return nil
+}
+
+// supported returns the catalog language that matches the language tag, trying the
+// full tag and then only the primary language, such as "pt" for "pt-BR".
+func (s *Scoreboard) supported(t string) (string, bool) {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if _, ok := s.locales[t]; ok && len(t) > 0 {
+		return t, true
+	}
+	if i := strings.IndexByte(t, '-'); i > 0 {
+		if _, ok := s.locales[t[:i]]; ok {
+			return t[:i], true
+		}
+	}
+	return "", false
+}
+
+// language returns the language to show the page in, which is the "lang" query value,
+// then the most preferred language of the Accept-Language header that has a catalog,
+// then the configured default language.
+func (s *Scoreboard) language(r *http.Request) string {
+	if v, ok := s.supported(r.URL.Query().Get("lang")); ok {
+		return v
+	}
+	type preference struct {
+		tag string
+		q   float64
+	}
+	var p []preference
+	for _, v := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		var (
+			t = strings.TrimSpace(v)
+			q = 1.0
+		)
+		if i := strings.IndexByte(t, ';'); i >= 0 {
+			if x := strings.TrimSpace(t[i+1:]); strings.HasPrefix(x, "q=") {
+				if f, err := strconv.ParseFloat(x[2:], 64); err == nil {
+					q = f
+				}
+			}
+			t = strings.TrimSpace(t[:i])
+		}
+		if len(t) > 0 && t != "*" && q > 0 {
+			p = append(p, preference{tag: t, q: q})
+		}
+	}
+	sort.SliceStable(p, func(i, j int) bool { return p[i].q > p[j].q })
+	for i := range p {
+		if v, ok := s.supported(p[i].tag); ok {
+			return v
+		}
+	}
+	s.swap.RLock()
+	v := s.locale
+	s.swap.RUnlock()
+	return v
+}
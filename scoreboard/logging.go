@@ -0,0 +1,327 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"fmt"
+	stdlog "log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PurpleSec/logx"
+)
+
+// journal is a leveled logger that writes each message with the component that logged
+// it, in the console or JSON format, to the console and an optional log file that is
+// rotated once it reaches the size limit. Every journal created by with shares the
+// same output, level and format.
+type journal struct {
+	out  *output
+	name string
+	id   string
+}
+type output struct {
+	file   *os.File
+	report func(string, string)
+	path   string
+	tenant string
+	size   int64
+	limit  int64
+	keep   int
+	level  uint32
+	json   uint32
+	lock   sync.Mutex
+}
+type entry struct {
+	Time      time.Time              `json:"time"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Level     string                 `json:"level"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	Component string                 `json:"component,omitempty"`
+	Request   string                 `json:"request_id,omitempty"`
+	Message   string                 `json:"msg"`
+}
+type verbosity struct {
+	Format string `json:"format"`
+	Level  int    `json:"level"`
+}
+type errorLog struct {
+	*journal
+}
+
+func (l log) verify() error {
+	if l.Level < int(logx.Trace) || l.Level > int(logx.Fatal) {
+		return &errval{s: "log level " + strconv.Itoa(l.Level) + " must be between zero and five"}
+	}
+	switch strings.ToLower(l.Format) {
+	case "", "console", "json":
+	default:
+		return &errval{s: `log format "` + l.Format + `" is not supported`}
+	}
+	if l.Size < 0 || l.Files < 0 {
+		return &errval{s: "log rotation values cannot be less than zero"}
+	}
+	return nil
+}
+func newJournal(l log) (*journal, error) {
+	o := &output{path: l.File, limit: int64(l.Size) << 20, keep: l.Files, level: uint32(l.Level)}
+	if strings.EqualFold(l.Format, "json") {
+		o.json = 1
+	}
+	if len(l.File) > 0 {
+		if err := o.open(); err != nil {
+			return nil, &errval{s: `unable to create log file "` + l.File + `"`, e: err}
+		}
+	}
+	return &journal{out: o}, nil
+}
+
+// with returns a journal that logs messages as the supplied component.
+func (j *journal) with(n string) *journal {
+	return &journal{out: j.out, name: n}
+}
+
+// request returns a journal that adds the request ID of the HTTP request to each
+// message, so every message of a request can be found by the ID.
+func (j *journal) request(r *http.Request) *journal {
+	v, _ := r.Context().Value(requestKey{}).(string)
+	return &journal{out: j.out, name: j.name, id: v}
+}
+
+// format sets the output format of the journal, which is "console" or "json".
+func (j *journal) format(f string) {
+	if strings.EqualFold(f, "json") {
+		atomic.StoreUint32(&j.out.json, 1)
+	} else {
+		atomic.StoreUint32(&j.out.json, 0)
+	}
+}
+func (j *journal) verbosity() verbosity {
+	v := verbosity{Format: "console", Level: int(atomic.LoadUint32(&j.out.level))}
+	if atomic.LoadUint32(&j.out.json) == 1 {
+		v.Format = "json"
+	}
+	return v
+}
+func (j *journal) SetLevel(l logx.Level) {
+	atomic.StoreUint32(&j.out.level, uint32(l))
+}
+func (j *journal) SetPrefix(p string) {
+	j.name = p
+}
+func (*journal) SetPrintLevel(_ logx.Level) {}
+func (j *journal) Print(v ...interface{}) {
+	j.write(logx.Info, fmt.Sprint(v...), nil)
+}
+func (j *journal) Panic(v ...interface{}) {
+	s := fmt.Sprint(v...)
+	j.write(logx.Panic, s, nil)
+	panic(s)
+}
+func (j *journal) Println(v ...interface{}) {
+	j.write(logx.Info, strings.TrimSuffix(fmt.Sprintln(v...), "\n"), nil)
+}
+func (j *journal) Panicln(v ...interface{}) {
+	s := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	j.write(logx.Panic, s, nil)
+	panic(s)
+}
+func (j *journal) Info(s string, v ...interface{}) {
+	j.log(logx.Info, s, v)
+}
+func (j *journal) Error(s string, v ...interface{}) {
+	j.log(logx.Error, s, v)
+}
+func (j *journal) Fatal(s string, v ...interface{}) {
+	j.log(logx.Fatal, s, v)
+	if logx.FatalExits {
+		os.Exit(1)
+	}
+}
+func (j *journal) Trace(s string, v ...interface{}) {
+	j.log(logx.Trace, s, v)
+}
+func (j *journal) Debug(s string, v ...interface{}) {
+	j.log(logx.Debug, s, v)
+}
+func (j *journal) Printf(s string, v ...interface{}) {
+	j.log(logx.Info, s, v)
+}
+func (j *journal) Panicf(s string, v ...interface{}) {
+	m := fmt.Sprintf(s, v...)
+	j.write(logx.Panic, m, nil)
+	panic(m)
+}
+func (j *journal) Warning(s string, v ...interface{}) {
+	j.log(logx.Warning, s, v)
+}
+func (j *journal) log(l logx.Level, s string, v []interface{}) {
+	if l < logx.Level(atomic.LoadUint32(&j.out.level)) {
+		return
+	}
+	if len(v) > 0 {
+		s = fmt.Sprintf(s, v...)
+	}
+	j.write(l, s, nil)
+}
+
+// fields logs the message with the supplied values, which are kept as separate values
+// in the JSON format and are added to the end of the message in the console format.
+func (j *journal) fields(l logx.Level, s string, f map[string]interface{}) {
+	j.write(l, s, f)
+}
+func (j *journal) write(l logx.Level, s string, f map[string]interface{}) {
+	if l < logx.Level(atomic.LoadUint32(&j.out.level)) {
+		return
+	}
+	var (
+		n = time.Now()
+		b []byte
+	)
+	if atomic.LoadUint32(&j.out.json) == 1 {
+		b, _ = json.Marshal(entry{Time: n, Level: strings.ToLower(strings.TrimSpace(l.String())), Tenant: j.out.tenant, Component: j.name, Request: j.id, Message: s, Fields: f})
+		b = append(b, '\n')
+	} else {
+		b = append(b, n.Format("2006/01/02 15:04:05 [")...)
+		if b = append(append(b, l.String()...), ']'); len(j.out.tenant) > 0 {
+			if b = append(append(b, ' '), j.out.tenant...); len(j.name) > 0 {
+				b = append(append(b, '/'), j.name...)
+			}
+		} else if len(j.name) > 0 {
+			b = append(append(b, ' '), j.name...)
+		}
+		if len(j.id) > 0 {
+			b = append(append(append(b, " ("...), j.id...), ')')
+		}
+		b = append(append(append(b, ':'), ' '), s...)
+		if len(f) > 0 {
+			k := make([]string, 0, len(f))
+			for v := range f {
+				k = append(k, v)
+			}
+			sort.Strings(k)
+			for i := range k {
+				b = append(append(append(append(b, ' '), k[i]...), '='), fmt.Sprint(f[k[i]])...)
+			}
+		}
+		b = append(b, '\n')
+	}
+	j.out.lock.Lock()
+	logx.DefaultConsole.Write(b)
+	if j.out.file != nil {
+		j.out.append(b)
+	}
+	r := j.out.report
+	if j.out.lock.Unlock(); r != nil && l >= logx.Error {
+		r(j.name, s)
+	}
+}
+
+// forward sets the function that is called with the component and message of each
+// error, or higher, message. This must be called before the journal is used.
+func (j *journal) forward(f func(string, string)) {
+	j.out.report = f
+}
+func (o *output) open() error {
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	i, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	o.file, o.size = f, i.Size()
+	return nil
+}
+
+// append writes the data to the log file, first rotating the file if the data would
+// go past the size limit. Rotated files are renamed with a number suffix, newest first,
+// and only the configured number of rotated files are kept.
+func (o *output) append(b []byte) {
+	if o.limit > 0 && o.size > 0 && o.size+int64(len(b)) > o.limit {
+		o.file.Close()
+		if o.keep > 0 {
+			for i := o.keep - 1; i > 0; i-- {
+				os.Rename(o.path+"."+strconv.Itoa(i), o.path+"."+strconv.Itoa(i+1))
+			}
+			os.Rename(o.path, o.path+".1")
+		} else {
+			os.Remove(o.path)
+		}
+		if err := o.open(); err != nil {
+			o.file = nil
+			os.Stderr.WriteString("Unable to rotate the log file: " + err.Error() + "!\n")
+			return
+		}
+	}
+	n, _ := o.file.Write(b)
+	o.size += int64(n)
+}
+func (o *output) close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+func (e errorLog) Write(b []byte) (int, error) {
+	e.write(logx.Error, strings.TrimSuffix(string(b), "\n"), nil)
+	return len(b), nil
+}
+
+// logger returns a standard library logger that writes to the journal as errors, which
+// is used for the errors of the web server.
+func (j *journal) logger() *stdlog.Logger {
+	return stdlog.New(errorLog{j}, "", 0)
+}
+func (s *Scoreboard) httpLog(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		// Values that are not in the request body keep their current value.
+		v := s.log.verbosity()
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&v); err != nil {
+			fail(w, "request body is not valid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := (log{Level: v.Level, Format: v.Format}).verify(); err != nil {
+			fail(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.log.SetLevel(logx.Level(v.Level))
+		s.log.format(v.Format)
+		s.log.request(r).Info(`Admin "%s" set the log level to %d and the log format to "%s".`, r.RemoteAddr, v.Level, v.Format)
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.log.verbosity())
+}
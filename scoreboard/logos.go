@@ -0,0 +1,379 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Register the JPEG and GIF decoders for uploaded and fetched logos.
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"github.com/PurpleSec/logx"
+)
+
+const (
+	logoSize  = 256
+	logoLimit = 4 << 20
+	logoRetry = time.Minute * 5
+	logoIndex = "index.json"
+)
+
+type avatars struct {
+	Teams map[string]string `json:"teams,omitempty"`
+	Dir   string            `json:"dir"`
+	Size  int               `json:"size"`
+}
+type gallery struct {
+	log    logx.Log
+	client *http.Client
+	URLs   map[string]string `json:"urls"`
+	Teams  map[string]string `json:"teams"`
+	links  map[string]string
+	failed map[string]time.Time
+	busy   map[string]struct{}
+	dir    string
+	prefix string
+	size   int
+	lock   sync.Mutex
+}
+
+func (a *avatars) verify() error {
+	if a.Size < 0 {
+		return &errval{s: "logo size " + strconv.Itoa(a.Size) + " cannot be less than zero"}
+	}
+	if len(a.Teams) > 0 && len(a.Dir) == 0 {
+		return &errval{s: "team logos require a logo directory"}
+	}
+	return nil
+}
+func newGallery(a avatars, c *http.Client, l logx.Log) (*gallery, error) {
+	if err := os.MkdirAll(a.Dir, 0750); err != nil {
+		return nil, &errval{s: `unable to create logo directory "` + a.Dir + `"`, e: err}
+	}
+	g := &gallery{
+		log:    l,
+		dir:    a.Dir,
+		size:   a.Size,
+		URLs:   make(map[string]string),
+		Teams:  make(map[string]string),
+		links:  make(map[string]string, len(a.Teams)),
+		busy:   make(map[string]struct{}),
+		failed: make(map[string]time.Time),
+		client: c,
+	}
+	if g.size == 0 {
+		g.size = logoSize
+	}
+	for k, v := range a.Teams {
+		g.links[strings.ToLower(k)] = v
+	}
+	b, err := os.ReadFile(filepath.Join(a.Dir, logoIndex))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return g, nil
+		}
+		return nil, &errval{s: `unable to read logo index in "` + a.Dir + `"`, e: err}
+	}
+	if err = json.Unmarshal(b, g); err != nil {
+		l.Warning(`Logo index in "%s" could not be read, ignoring it: %s!`, a.Dir, err.Error())
+	}
+	if g.URLs == nil {
+		g.URLs = make(map[string]string)
+	}
+	if g.Teams == nil {
+		g.Teams = make(map[string]string)
+	}
+	return g, nil
+}
+
+// path returns the local URL of the logo with the supplied key.
+func (g *gallery) path(k string) string {
+	return g.prefix + "/logo/" + k + ".png"
+}
+
+// resolve returns the local URL of the logo of the team with the supplied ID and name.
+// Uploaded logos are used first, then logos set in the config and then the logo URL
+// sent by the source. Logos that are not cached yet are fetched in the background and
+// this function returns false until they are ready.
+func (g *gallery) resolve(i uint64, n, u string) (string, bool) {
+	var (
+		d = strconv.FormatUint(i, 10)
+		k = strings.ToLower(n)
+	)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if v, ok := g.Teams[d]; ok {
+		return g.path(v), true
+	}
+	if v, ok := g.Teams[k]; ok {
+		return g.path(v), true
+	}
+	if v, ok := g.links[d]; ok {
+		u = v
+	} else if v, ok = g.links[k]; ok {
+		u = v
+	} else if !strings.Contains(u, "://") {
+		return "", false
+	}
+	if v, ok := g.URLs[u]; ok {
+		return g.path(v), true
+	}
+	if _, ok := g.busy[u]; ok {
+		return "", false
+	}
+	if t, ok := g.failed[u]; ok && time.Since(t) < logoRetry {
+		return "", false
+	}
+	g.busy[u] = struct{}{}
+	go g.fetch(u)
+	return "", false
+}
+func (g *gallery) fetch(u string) {
+	b, err := g.read(u)
+	var k string
+	if err == nil {
+		k, err = g.store(b)
+	}
+	g.lock.Lock()
+	if delete(g.busy, u); err != nil {
+		g.failed[u] = time.Now()
+	} else {
+		delete(g.failed, u)
+		g.URLs[u] = k
+		g.save()
+	}
+	g.lock.Unlock()
+	if err != nil {
+		g.log.Warning(`Unable to cache team logo "%s": %s!`, u, err.Error())
+		return
+	}
+	g.log.Debug(`Cached team logo "%s" as "%s".`, u, k)
+}
+func (g *gallery) read(u string) ([]byte, error) {
+	if !strings.Contains(u, "://") {
+		return os.ReadFile(u)
+	}
+	r, err := g.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, &errval{s: "logo request returned status " + strconv.Itoa(r.StatusCode)}
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, logoLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > logoLimit {
+		return nil, &errval{s: "logo is larger than " + strconv.Itoa(logoLimit) + " bytes"}
+	}
+	return b, nil
+}
+
+// store decodes, resizes and saves the supplied image as a PNG file named after its
+// contents, so the logo URL only changes when the logo does.
+func (g *gallery) store(b []byte) (string, error) {
+	m, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return "", &errval{s: "logo is not a valid PNG, JPEG or GIF image", e: err}
+	}
+	var o bytes.Buffer
+	if err = png.Encode(&o, scale(m, g.size)); err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(o.Bytes())
+	k := hex.EncodeToString(h[:8])
+	p := filepath.Join(g.dir, k+".png")
+	if _, err = os.Stat(p); err == nil {
+		return k, nil
+	}
+	f, err := os.CreateTemp(g.dir, "."+k+".*")
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Write(o.Bytes()); err == nil {
+		err = f.Sync()
+	}
+	if x := f.Close(); err == nil {
+		err = x
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return k, nil
+}
+
+// save writes the logo index to the logo directory. This function must be called
+// while holding the lock.
+func (g *gallery) save() {
+	b, err := json.Marshal(g)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(g.dir, logoIndex), b, 0640)
+	}
+	if err != nil {
+		g.log.Error(`Unable to save logo index in "%s": %s!`, g.dir, err.Error())
+	}
+}
+
+// scale returns the image resized to fit in a square of the supplied size, using the
+// average of the source pixels covered by each output pixel. Images smaller than the
+// size are not enlarged.
+func scale(m image.Image, n int) image.Image {
+	var (
+		b    = m.Bounds()
+		w, h = b.Dx(), b.Dy()
+	)
+	if w <= n && h <= n {
+		return m
+	}
+	x, y := n, n
+	if w > h {
+		y = h * n / w
+	} else {
+		x = w * n / h
+	}
+	if x == 0 {
+		x = 1
+	}
+	if y == 0 {
+		y = 1
+	}
+	o := image.NewNRGBA(image.Rect(0, 0, x, y))
+	for j := 0; j < y; j++ {
+		y0, y1 := b.Min.Y+j*h/y, b.Min.Y+(j+1)*h/y
+		for i := 0; i < x; i++ {
+			x0, x1 := b.Min.X+i*w/x, b.Min.X+(i+1)*w/x
+			var r, g, l, a, c uint64
+			for v := y0; v < y1; v++ {
+				for u := x0; u < x1; u++ {
+					p := color.NRGBA64Model.Convert(m.At(u, v)).(color.NRGBA64)
+					// Weight the colors by alpha, so transparent pixels don't darken
+					// the edges of the logo.
+					r += uint64(p.R) * uint64(p.A)
+					g += uint64(p.G) * uint64(p.A)
+					l += uint64(p.B) * uint64(p.A)
+					a += uint64(p.A)
+					c++
+				}
+			}
+			if c == 0 || a == 0 {
+				continue
+			}
+			o.SetNRGBA(i, j, color.NRGBA{
+				R: uint8(r / a >> 8),
+				G: uint8(g / a >> 8),
+				B: uint8(l / a >> 8),
+				A: uint8(a / c >> 8),
+			})
+		}
+	}
+	return o
+}
+func (s *Scoreboard) httpLogo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	n := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/logo/"), ".png")
+	if len(n) != 16 || strings.Trim(n, "0123456789abcdef") != "" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(filepath.Join(s.album.dir, n+".png"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	i, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, n+".png", i.ModTime(), f)
+}
+func (s *Scoreboard) httpLogos(w http.ResponseWriter, r *http.Request) {
+	t := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("team")))
+	switch r.Method {
+	case http.MethodGet:
+		s.album.lock.Lock()
+		b, _ := json.Marshal(s.album)
+		s.album.lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+		return
+	case http.MethodPost, http.MethodPut:
+		if len(t) == 0 {
+			fail(w, "a team name or ID is required", http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, logoLimit))
+		if err != nil {
+			fail(w, "logo is larger than "+strconv.Itoa(logoLimit)+" bytes", http.StatusRequestEntityTooLarge)
+			return
+		}
+		k, err := s.album.store(b)
+		if err != nil {
+			fail(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.album.lock.Lock()
+		s.album.Teams[t] = k
+		s.album.save()
+		s.album.lock.Unlock()
+		s.log.request(r).Info(`Admin "%s" uploaded logo "%s" for team "%s".`, r.RemoteAddr, k, t)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"team": t, "url": s.album.path(k)})
+	case http.MethodDelete:
+		s.album.lock.Lock()
+		_, ok := s.album.Teams[t]
+		if delete(s.album.Teams, t); ok {
+			s.album.save()
+		}
+		s.album.lock.Unlock()
+		if !ok {
+			fail(w, `team "`+t+`" does not have an uploaded logo`, http.StatusNotFound)
+			return
+		}
+		s.log.request(r).Info(`Admin "%s" removed the uploaded logo for team "%s".`, r.RemoteAddr, t)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// meters is the Scoreboard counters exposed on the metrics endpoint. The Game update
+// counters are kept by each Manager and are read when the metrics are requested. The
+// rules are the Tweets removed by each filter rule, by the rule name.
+type meters struct {
+	codes       map[int]uint64
+	rules       map[string]uint64
+	received    uint64
+	filtered    uint64
+	dropped     uint64
+	reconnects  uint64
+	disconnects uint64
+	failovers   uint64
+	lock        sync.Mutex
+	stream      uint32
+	paused      uint32
+	held        uint32
+}
+type recorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+func (r *recorder) WriteHeader(c int) {
+	if r.code == 0 {
+		r.code = c
+	}
+	r.ResponseWriter.WriteHeader(c)
+}
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack is needed by the WebSocket upgrade, the connection is counted as switching
+// protocols since the upgrade response is written directly to the connection.
+func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	r.code = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+func (m *meters) reject(n string) {
+	atomic.AddUint64(&m.filtered, 1)
+	m.lock.Lock()
+	m.rules[n]++
+	m.lock.Unlock()
+}
+
+// limit counts Tweets under the "rate_limit" rule, which are the Tweets held back by
+// Twitter with a StreamLimit message and the Tweets dropped by the Scoreboard. These
+// were never shown, but were not removed by a filter, so they are not in filtered.
+func (m *meters) limit(n uint64) {
+	m.lock.Lock()
+	m.rules["rate_limit"] += n
+	m.lock.Unlock()
+}
+
+// filters returns a copy of the number of Tweets removed by each filter rule.
+func (m *meters) filters() map[string]uint64 {
+	m.lock.Lock()
+	r := make(map[string]uint64, len(m.rules))
+	for k, v := range m.rules {
+		r[k] = v
+	}
+	m.lock.Unlock()
+	return r
+}
+func (m *meters) status(c int) {
+	if c == 0 {
+		c = http.StatusOK
+	}
+	m.lock.Lock()
+	m.codes[c]++
+	m.lock.Unlock()
+}
+
+func (s *Scoreboard) httpMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var b bytes.Buffer
+	metric(&b, "scoreboard_tweets_received_total", "counter", "Tweets received from the Twitter stream.")
+	value(&b, "scoreboard_tweets_received_total", "", float64(atomic.LoadUint64(&s.stats.received)))
+	metric(&b, "scoreboard_tweets_filtered_total", "counter", "Tweets removed by the user, word and script filters.")
+	value(&b, "scoreboard_tweets_filtered_total", "", float64(atomic.LoadUint64(&s.stats.filtered)))
+	f := s.stats.filters()
+	k := make([]string, 0, len(f))
+	for n := range f {
+		k = append(k, n)
+	}
+	sort.Strings(k)
+	metric(&b, "scoreboard_tweets_filter_hits_total", "counter", "Tweets removed by each filter rule.")
+	for _, n := range k {
+		value(&b, "scoreboard_tweets_filter_hits_total", label("rule", n), float64(f[n]))
+	}
+	metric(&b, "scoreboard_tweets_dropped_total", "counter", "Tweets dropped because a game was not keeping up.")
+	value(&b, "scoreboard_tweets_dropped_total", "", float64(atomic.LoadUint64(&s.stats.dropped)))
+	metric(&b, "scoreboard_twitter_reconnects_total", "counter", "Twitter streams started by credential rotations.")
+	value(&b, "scoreboard_twitter_reconnects_total", "", float64(atomic.LoadUint64(&s.stats.reconnects)))
+	metric(&b, "scoreboard_twitter_disconnects_total", "counter", "Twitter streams closed by Twitter or by an error.")
+	value(&b, "scoreboard_twitter_disconnects_total", "", float64(atomic.LoadUint64(&s.stats.disconnects)))
+	metric(&b, "scoreboard_twitter_failovers_total", "counter", "Twitter streams started with the next credentials after a rate limit or error.")
+	value(&b, "scoreboard_twitter_failovers_total", "", float64(atomic.LoadUint64(&s.stats.failovers)))
+	metric(&b, "scoreboard_twitter_paused", "gauge", "One if the Twitter ticker is paused.")
+	value(&b, "scoreboard_twitter_paused", "", float64(atomic.LoadUint32(&s.stats.paused)))
+	metric(&b, "scoreboard_twitter_held", "gauge", "Tweets kept while the Twitter ticker is paused.")
+	value(&b, "scoreboard_twitter_held", "", float64(atomic.LoadUint32(&s.stats.held)))
+	var (
+		n = make([]string, 0, len(s.games))
+		v = make(map[string]game.Stats, len(s.games)+1)
+	)
+	v[""] = s.Stats()
+	for k, m := range s.games {
+		n, v[k] = append(n, k), m.Stats()
+	}
+	sort.Strings(n)
+	n = append([]string{""}, n...)
+	metric(&b, "scoreboard_websocket_clients", "gauge", "Connected WebSocket clients.")
+	for _, k := range n {
+		value(&b, "scoreboard_websocket_clients", label("game", k), float64(v[k].Clients))
+	}
+	metric(&b, "scoreboard_fetch_duration_seconds", "summary", "Time spent requesting data from the source.")
+	for _, k := range n {
+		value(&b, "scoreboard_fetch_duration_seconds_sum", label("game", k), v[k].Fetching.Seconds())
+		value(&b, "scoreboard_fetch_duration_seconds_count", label("game", k), float64(v[k].Fetches))
+	}
+	metric(&b, "scoreboard_fetch_failures_total", "counter", "Failed requests to the source.")
+	for _, k := range n {
+		value(&b, "scoreboard_fetch_failures_total", label("game", k), float64(v[k].Failures))
+	}
+	metric(&b, "scoreboard_broadcast_duration_seconds", "summary", "Time spent sending updates to the WebSocket clients.")
+	for _, k := range n {
+		value(&b, "scoreboard_broadcast_duration_seconds_sum", label("game", k), v[k].Sending.Seconds())
+		value(&b, "scoreboard_broadcast_duration_seconds_count", label("game", k), float64(v[k].Broadcasts))
+	}
+	metric(&b, "scoreboard_memory_evictions_total", "counter", "Values removed from the in-memory buffers to keep under the memory limits.")
+	for _, k := range n {
+		value(&b, "scoreboard_memory_evictions_total", "{game="+strconv.Quote(k)+",buffer=\"tweets\"}", float64(v[k].Tweets))
+		value(&b, "scoreboard_memory_evictions_total", "{game="+strconv.Quote(k)+",buffer=\"events\"}", float64(v[k].Events))
+	}
+	a, e := s.static.cached()
+	value(&b, "scoreboard_memory_evictions_total", "{game=\"\",buffer=\"assets\"}", float64(e))
+	metric(&b, "scoreboard_memory_assets_bytes", "gauge", "Static files kept in memory, in bytes.")
+	value(&b, "scoreboard_memory_assets_bytes", "", float64(a))
+	if s.store != nil {
+		if n, err := s.store.usage(r.Context()); err == nil {
+			metric(&b, "scoreboard_history_size_bytes", "gauge", "Size of the history database, in bytes.")
+			value(&b, "scoreboard_history_size_bytes", "", float64(n))
+		}
+		metric(&b, "scoreboard_history_removed_rows_total", "counter", "History rows removed by the retention policy.")
+		value(&b, "scoreboard_history_removed_rows_total", "", float64(atomic.LoadUint64(&s.store.pruned)))
+		var t float64
+		if v := atomic.LoadInt64(&s.store.swept); v > 0 {
+			t = float64(v) / 1e9
+		}
+		metric(&b, "scoreboard_history_compaction_timestamp_seconds", "gauge", "Time of the last history compaction, zero if none ran yet.")
+		value(&b, "scoreboard_history_compaction_timestamp_seconds", "", t)
+		metric(&b, "scoreboard_history_compaction_duration_seconds", "gauge", "Time the last history compaction took.")
+		value(&b, "scoreboard_history_compaction_duration_seconds", "", time.Duration(atomic.LoadInt64(&s.store.took)).Seconds())
+	}
+	metric(&b, "scoreboard_last_update_timestamp_seconds", "gauge", "Time of the last finished update, zero if no update finished yet.")
+	for _, k := range n {
+		var t float64
+		if !v[k].Updated.IsZero() {
+			t = float64(v[k].Updated.UnixNano()) / 1e9
+		}
+		value(&b, "scoreboard_last_update_timestamp_seconds", label("game", k), t)
+	}
+	metric(&b, "scoreboard_source_clock_skew_seconds", "gauge", "Measured time the source clock is ahead of the local clock, negative if behind.")
+	for _, k := range n {
+		value(&b, "scoreboard_source_clock_skew_seconds", label("game", k), v[k].Skew.Seconds())
+	}
+	d := s.screens()
+	metric(&b, "scoreboard_display_sent_bytes_total", "counter", "Bytes sent to each connected display.")
+	for _, v := range d {
+		value(&b, "scoreboard_display_sent_bytes_total", v.labels(), float64(v.Sent))
+	}
+	metric(&b, "scoreboard_display_queued_messages", "gauge", "Messages sent to each connected display that it has not read yet.")
+	for _, v := range d {
+		value(&b, "scoreboard_display_queued_messages", v.labels(), float64(v.Queued))
+	}
+	metric(&b, "scoreboard_display_ack_latency_seconds", "gauge", "Time each connected display took to read the last message it read.")
+	for _, v := range d {
+		value(&b, "scoreboard_display_ack_latency_seconds", v.labels(), v.Latency)
+	}
+	s.stats.lock.Lock()
+	c := make([]int, 0, len(s.stats.codes))
+	for k := range s.stats.codes {
+		c = append(c, k)
+	}
+	sort.Ints(c)
+	metric(&b, "scoreboard_http_responses_total", "counter", "HTTP responses by status code.")
+	for _, k := range c {
+		value(&b, "scoreboard_http_responses_total", label("code", strconv.Itoa(k)), float64(s.stats.codes[k]))
+	}
+	s.stats.lock.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(b.Bytes())
+}
+func (d *screen) labels() string {
+	return "{display=\"" + strconv.FormatUint(d.ID, 10) + "\",game=" + strconv.Quote(d.Name) + ",client=" + strconv.Quote(d.Client) + ",address=" + strconv.Quote(d.Address) + "}"
+}
+func label(k, v string) string {
+	return "{" + k + "=" + strconv.Quote(v) + "}"
+}
+func metric(b *bytes.Buffer, n, t, h string) {
+	b.WriteString("# HELP " + n + " " + h + "\n# TYPE " + n + " " + t + "\n")
+}
+func value(b *bytes.Buffer, n, l string, v float64) {
+	b.WriteString(n + l + " " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+}
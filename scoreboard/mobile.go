@@ -0,0 +1,123 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressMin is the smallest response that is compressed, as the gzip header and
+// footer make smaller responses larger.
+const compressMin = 512
+
+// buffer is a ResponseWriter that keeps the response in memory, so it can be tagged
+// and compressed before it is sent.
+type buffer struct {
+	bytes.Buffer
+	h    http.Header
+	code int
+}
+
+func (b *buffer) Header() http.Header {
+	return b.h
+}
+func (b *buffer) WriteHeader(c int) {
+	if b.code == 0 {
+		b.code = c
+	}
+}
+
+// light wraps the handler for clients on slow networks. Successful responses are given
+// an ETag, so a client that sends the same tag in the "If-None-Match" header gets an
+// empty "304 Not Modified" response, and are compressed with gzip if the client
+// supports it.
+func light(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := &buffer{h: w.Header()}
+		if h(b, r); b.code == 0 {
+			b.code = http.StatusOK
+		}
+		if b.code != http.StatusOK {
+			w.WriteHeader(b.code)
+			w.Write(b.Bytes())
+			return
+		}
+		f := fnv.New64a()
+		f.Write(b.Bytes())
+		t := `"` + hex.EncodeToString(f.Sum(nil)) + `"`
+		w.Header().Set("ETag", t)
+		w.Header().Add("Vary", "Accept-Encoding")
+		if m := r.Header.Get("If-None-Match"); len(m) > 0 && strings.Contains(m, t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if b.Len() < compressMin || !accepts(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+			w.Write(b.Bytes())
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		z, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		z.Write(b.Bytes())
+		z.Close()
+	}
+}
+
+// httpMobile returns the mobile standings view of the Game in the path, which is a
+// Game ID or the name of a named game, or the current Game if the path is empty. The
+// view loads the standings from the standings API instead of using a websocket.
+func (s *Scoreboard) httpMobile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		v uint64
+		o string
+		n = strings.Trim(strings.TrimPrefix(r.URL.Path, "/m"), "/")
+	)
+	switch x, err := strconv.ParseUint(n, 10, 64); {
+	case len(n) == 0:
+		v = current(s.Manager)
+	case err == nil:
+		v = x
+	default:
+		if m := s.arena(n); m != nil {
+			v, o = current(m), strings.ToLower(n)
+		}
+	}
+	if v == 0 {
+		http.Error(w, "game does not exist or is not active", http.StatusNotFound)
+		return
+	}
+	l := s.language(r)
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", l)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	d := &display{Game: v, Route: o, Lang: l, Zone: s.timezone(r).String(), Text: s.locales[l], Access: accessible(r)}
+	if err := s.render(w, r, "mobile.html", d.key(), d); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.web.request(r).Error(`Error during request from "%s": %s!`, r.RemoteAddr, err.Error())
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	mqttQueue   = 256
+	mqttBackoff = time.Second * 30
+)
+
+type broker struct {
+	Server   string `json:"server"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Prefix   string `json:"prefix"`
+	QoS      int    `json:"qos"`
+	Keep     int    `json:"keepalive"`
+}
+type message struct {
+	topic  string
+	body   []byte
+	id     uint16
+	retain bool
+}
+type mqtt struct {
+	log     logx.Log
+	queue   chan message
+	pending map[uint16]message
+	acks    chan uint16
+	url     *url.URL
+	id      string
+	user    string
+	pass    string
+	prefix  string
+	timeout time.Duration
+	keep    time.Duration
+	next    uint16
+	qos     byte
+}
+
+func (b broker) verify() error {
+	if len(b.Server) == 0 {
+		return nil
+	}
+	u, err := url.Parse(b.Server)
+	if err != nil {
+		return &errval{s: `mqtt server "` + b.Server + `" is not valid`, e: err}
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts":
+	default:
+		return &errval{s: `mqtt server scheme "` + u.Scheme + `" is not supported`}
+	}
+	if b.QoS < 0 || b.QoS > 1 {
+		return &errval{s: "mqtt qos " + strconv.Itoa(b.QoS) + " must be zero or one"}
+	}
+	if b.Keep < 0 {
+		return &errval{s: "mqtt keepalive " + strconv.Itoa(b.Keep) + " cannot be less than zero"}
+	}
+	return nil
+}
+func (m *mqtt) packet() uint16 {
+	if m.next++; m.next == 0 {
+		m.next = 1
+	}
+	return m.next
+}
+func (m *mqtt) change(c game.Change) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	m.publish(message{topic: m.topic(c.GameID, "events/"+c.Kind.String()), body: b})
+}
+func (m *mqtt) publish(v message) {
+	select {
+	case m.queue <- v:
+	default:
+		m.log.Warning(`MQTT queue is full, dropping message for topic "%s"!`, v.topic)
+	}
+}
+func (m *mqtt) snapshot(s game.Snapshot) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	m.publish(message{topic: m.topic(s.GameID, "scores"), body: b, retain: true})
+	if len(s.Teams) > 0 {
+		b, _ = json.Marshal(s.Teams[0])
+		m.publish(message{topic: m.topic(s.GameID, "leader"), body: b, retain: true})
+	}
+}
+func (m *mqtt) start(x context.Context) {
+	for d := time.Second; ; {
+		err := m.session(x)
+		select {
+		case <-x.Done():
+			return
+		default:
+		}
+		if err != nil {
+			m.log.Error(`MQTT connection to "%s" failed, retrying in %s: %s!`, m.url.Host, d.String(), err.Error())
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if d *= 2; d > mqttBackoff {
+			d = mqttBackoff
+		}
+	}
+}
+func (m *mqtt) topic(g uint64, s string) string {
+	return m.prefix + "/games/" + strconv.FormatUint(g, 10) + "/" + s
+}
+func (m *mqtt) session(x context.Context) error {
+	c, err := m.dial(x)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err = m.connect(c); err != nil {
+		return err
+	}
+	m.log.Info(`Connected to MQTT server "%s".`, m.url.Host)
+	r := make(chan error, 1)
+	go m.read(c, r)
+	for _, v := range m.pending {
+		if err = m.write(c, v, true); err != nil {
+			return err
+		}
+	}
+	t := time.NewTicker(m.keep)
+	defer t.Stop()
+	for {
+		select {
+		case <-x.Done():
+			c.SetWriteDeadline(time.Now().Add(m.timeout))
+			c.Write([]byte{0xE0, 0})
+			return nil
+		case err = <-r:
+			return err
+		case i := <-m.acks:
+			delete(m.pending, i)
+		case <-t.C:
+			c.SetWriteDeadline(time.Now().Add(m.timeout))
+			if _, err = c.Write([]byte{0xC0, 0}); err != nil {
+				return err
+			}
+		case v := <-m.queue:
+			if m.qos > 0 {
+				if v.id = m.packet(); len(m.pending) < mqttQueue {
+					m.pending[v.id] = v
+				}
+			}
+			if err = m.write(c, v, false); err != nil {
+				return err
+			}
+		}
+	}
+}
+func remaining(b []byte, n int) []byte {
+	for {
+		v := byte(n % 128)
+		if n /= 128; n > 0 {
+			v |= 0x80
+		}
+		if b = append(b, v); n == 0 {
+			return b
+		}
+	}
+}
+func str(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+func (m *mqtt) connect(c net.Conn) error {
+	var (
+		f byte = 0x02
+		v      = str(nil, "MQTT")
+		k      = int(m.keep / time.Second)
+	)
+	if len(m.user) > 0 {
+		f |= 0x80
+	}
+	if len(m.pass) > 0 {
+		f |= 0x40
+	}
+	v = append(v, 4, f, byte(k>>8), byte(k))
+	if v = str(v, m.id); len(m.user) > 0 {
+		v = str(v, m.user)
+	}
+	if len(m.pass) > 0 {
+		v = str(v, m.pass)
+	}
+	c.SetDeadline(time.Now().Add(m.timeout))
+	if _, err := c.Write(append(remaining([]byte{0x10}, len(v)), v...)); err != nil {
+		return err
+	}
+	var r [4]byte
+	if _, err := io.ReadFull(c, r[:]); err != nil {
+		return err
+	}
+	if r[0] != 0x20 || r[1] != 2 {
+		return &errval{s: "mqtt server returned an invalid CONNACK"}
+	}
+	if r[3] != 0 {
+		return &errval{s: "mqtt server refused the connection with code " + strconv.Itoa(int(r[3]))}
+	}
+	c.SetDeadline(time.Time{})
+	return nil
+}
+func (m *mqtt) read(c net.Conn, e chan<- error) {
+	r := bufio.NewReader(c)
+	for {
+		h, err := r.ReadByte()
+		if err != nil {
+			e <- err
+			return
+		}
+		var n, s int
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				e <- err
+				return
+			}
+			if n |= int(b&0x7F) << s; b&0x80 == 0 {
+				break
+			}
+			if s += 7; s > 21 {
+				e <- &errval{s: "mqtt server sent an invalid packet length"}
+				return
+			}
+		}
+		b := make([]byte, n)
+		if _, err = io.ReadFull(r, b); err != nil {
+			e <- err
+			return
+		}
+		if h&0xF0 == 0x40 && n >= 2 {
+			m.acks <- uint16(b[0])<<8 | uint16(b[1])
+		}
+	}
+}
+func (m *mqtt) dial(x context.Context) (net.Conn, error) {
+	h := m.url.Host
+	switch m.url.Scheme {
+	case "ssl", "tls", "mqtts":
+		if len(m.url.Port()) == 0 {
+			h = net.JoinHostPort(m.url.Hostname(), "8883")
+		}
+		d := &tls.Dialer{NetDialer: &net.Dialer{Timeout: m.timeout}, Config: &tls.Config{ServerName: m.url.Hostname()}}
+		return d.DialContext(x, "tcp", h)
+	}
+	if len(m.url.Port()) == 0 {
+		h = net.JoinHostPort(m.url.Hostname(), "1883")
+	}
+	return (&net.Dialer{Timeout: m.timeout}).DialContext(x, "tcp", h)
+}
+func (m *mqtt) write(c net.Conn, v message, d bool) error {
+	h := 0x30 | m.qos<<1
+	if v.retain {
+		h |= 0x01
+	}
+	if d {
+		h |= 0x08
+	}
+	b := str(nil, v.topic)
+	if m.qos > 0 {
+		b = append(b, byte(v.id>>8), byte(v.id))
+	}
+	b = append(b, v.body...)
+	c.SetWriteDeadline(time.Now().Add(m.timeout))
+	_, err := c.Write(append(remaining([]byte{h}, len(b)), b...))
+	return err
+}
+func newMQTT(b broker, t time.Duration, l logx.Log) *mqtt {
+	u, _ := url.Parse(b.Server)
+	m := &mqtt{
+		log:     l,
+		url:     u,
+		id:      b.ClientID,
+		user:    b.Username,
+		pass:    b.Password,
+		acks:    make(chan uint16, mqttQueue),
+		qos:     byte(b.QoS),
+		keep:    time.Duration(b.Keep) * time.Second,
+		queue:   make(chan message, mqttQueue),
+		prefix:  strings.Trim(b.Prefix, "/"),
+		pending: make(map[uint16]message),
+		timeout: t,
+	}
+	if len(m.id) == 0 {
+		m.id = "scoreboard-" + strconv.FormatInt(time.Now().Unix(), 36)
+	}
+	if len(m.prefix) == 0 {
+		m.prefix = "scoreboard"
+	}
+	if m.keep <= 0 {
+		m.keep = time.Second * 60
+	}
+	return m
+}
@@ -0,0 +1,448 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcRefresh is the time between reads of the provider keys, which are also read
+	// again when a token is signed by an unknown key.
+	oidcRefresh = time.Hour
+	// oidcRetry is the least time between reads of the provider keys.
+	oidcRetry = time.Minute
+	// oidcLeeway is the clock skew allowed when checking the token times.
+	oidcLeeway = time.Minute
+	// oidcCookie is the cookie that keeps the state of a sign in on the browser until
+	// the provider sends it back.
+	oidcCookie = "scoreboard-oidc"
+	// oidcMax is the largest response read from the provider.
+	oidcMax = 1 << 20
+)
+
+// provider is the "oidc" backend, which checks the ID tokens signed by an OpenID Connect
+// provider for the client ID. The admin page signs staff in with the authorization
+// code flow at "/admin/login", which gets the ID token used as the bearer token.
+type provider struct {
+	c        *http.Client
+	log      *journal
+	keys     map[string]crypto.PublicKey
+	issuer   string
+	client   string
+	secret   string
+	redirect string
+	auth     string
+	token    string
+	jwks     string
+	post     bool
+	allow    []string
+	loaded   time.Time
+	tried    time.Time
+	lock     sync.Mutex
+}
+type claims struct {
+	Audience audience `json:"aud"`
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Email    string   `json:"email"`
+	Username string   `json:"preferred_username"`
+	Nonce    string   `json:"nonce"`
+	Groups   []string `json:"groups"`
+	Expires  int64    `json:"exp"`
+	Before   int64    `json:"nbf"`
+}
+type audience []string
+
+func newProvider(s staff, c *http.Client, l *journal) *provider {
+	return &provider{
+		c: c, log: l, issuer: strings.TrimSuffix(s.Issuer, "/"), client: s.ClientID, secret: s.Secret,
+		redirect: s.Redirect, allow: s.Allow,
+	}
+}
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var v []string
+	if err := json.Unmarshal(b, &v); err == nil {
+		*a = v
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*a = audience{s}
+	return nil
+}
+func (p *provider) get(x context.Context, u string, v interface{}) error {
+	r, err := http.NewRequestWithContext(x, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	o, err := p.c.Do(r)
+	if err != nil {
+		return err
+	}
+	defer o.Body.Close()
+	if o.StatusCode != http.StatusOK {
+		return &errval{s: `request to "` + u + `" returned ` + o.Status}
+	}
+	return json.NewDecoder(io.LimitReader(o.Body, oidcMax)).Decode(v)
+}
+
+// discover reads the endpoints and the signing keys of the provider. This must be called
+// with the lock held.
+func (p *provider) discover(x context.Context) error {
+	var d struct {
+		Issuer  string   `json:"issuer"`
+		Auth    string   `json:"authorization_endpoint"`
+		Token   string   `json:"token_endpoint"`
+		JWKS    string   `json:"jwks_uri"`
+		Methods []string `json:"token_endpoint_auth_methods_supported"`
+	}
+	if err := p.get(x, p.issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return &errval{s: `provider issuer "` + d.Issuer + `" does not match "` + p.issuer + `"`}
+	}
+	var k struct {
+		Keys []struct {
+			Type  string `json:"kty"`
+			ID    string `json:"kid"`
+			Use   string `json:"use"`
+			N     string `json:"n"`
+			E     string `json:"e"`
+			Curve string `json:"crv"`
+			X     string `json:"x"`
+			Y     string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.get(x, d.JWKS, &k); err != nil {
+		return err
+	}
+	m := make(map[string]crypto.PublicKey, len(k.Keys))
+	for _, v := range k.Keys {
+		if len(v.Use) > 0 && v.Use != "sig" {
+			continue
+		}
+		switch v.Type {
+		case "RSA":
+			n, e := number(v.N), number(v.E)
+			if n == nil || e == nil || !e.IsInt64() {
+				continue
+			}
+			m[v.ID] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var c elliptic.Curve
+			switch v.Curve {
+			case "P-256":
+				c = elliptic.P256()
+			case "P-384":
+				c = elliptic.P384()
+			case "P-521":
+				c = elliptic.P521()
+			default:
+				continue
+			}
+			if x, y := number(v.X), number(v.Y); x != nil && y != nil && c.IsOnCurve(x, y) {
+				m[v.ID] = &ecdsa.PublicKey{Curve: c, X: x, Y: y}
+			}
+		}
+	}
+	p.auth, p.token, p.jwks, p.keys, p.loaded = d.Auth, d.Token, d.JWKS, m, time.Now()
+	p.post = len(d.Methods) > 0 && !listed(d.Methods, "client_secret_basic") && listed(d.Methods, "client_secret_post")
+	return nil
+}
+func number(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+// key returns the signing key with the ID, reading the keys again if they are old or
+// the key is unknown.
+func (p *provider) key(x context.Context, i string) crypto.PublicKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	k, ok := p.keys[i]
+	if (ok && time.Since(p.loaded) < oidcRefresh) || time.Since(p.tried) < oidcRetry {
+		return k
+	}
+	// The keys are not read again until the retry time has passed, so a provider that
+	// is down, or tokens with an unknown key, do not ask the provider with every request.
+	p.tried = time.Now()
+	if err := p.discover(x); err != nil {
+		p.log.Error(`Unable to read the keys of OpenID Connect provider "%s": %s!`, p.issuer, err.Error())
+		return k
+	}
+	return p.keys[i]
+}
+
+// verify returns the claims of the ID token if it is signed by the provider, was issued
+// for the client and has not expired.
+func (p *provider) verify(x context.Context, t string) (*claims, bool) {
+	s := strings.Split(t, ".")
+	if len(s) != 3 {
+		return nil, false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s[0])
+	if err != nil || json.Unmarshal(b, &h) != nil {
+		return nil, false
+	}
+	g, err := base64.RawURLEncoding.DecodeString(s[2])
+	if err != nil {
+		return nil, false
+	}
+	var f crypto.Hash
+	switch h.Alg {
+	case "RS256", "ES256":
+		f = crypto.SHA256
+	case "RS384", "ES384":
+		f = crypto.SHA384
+	case "RS512", "ES512":
+		f = crypto.SHA512
+	default:
+		return nil, false
+	}
+	d := f.New()
+	d.Write([]byte(s[0] + "." + s[1]))
+	switch k := p.key(x, h.Kid).(type) {
+	case *rsa.PublicKey:
+		if h.Alg[0] != 'R' || rsa.VerifyPKCS1v15(k, f, d.Sum(nil), g) != nil {
+			return nil, false
+		}
+	case *ecdsa.PublicKey:
+		n := (k.Curve.Params().BitSize + 7) / 8
+		if h.Alg[0] != 'E' || len(g) != n*2 || !ecdsa.Verify(k, d.Sum(nil), new(big.Int).SetBytes(g[:n]), new(big.Int).SetBytes(g[n:])) {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	var c claims
+	if b, err = base64.RawURLEncoding.DecodeString(s[1]); err != nil || json.Unmarshal(b, &c) != nil {
+		return nil, false
+	}
+	n := time.Now()
+	switch {
+	case strings.TrimSuffix(c.Issuer, "/") != p.issuer:
+		return nil, false
+	case !listed(c.Audience, p.client):
+		return nil, false
+	case n.Add(-oidcLeeway).After(time.Unix(c.Expires, 0)):
+		return nil, false
+	case c.Before > 0 && n.Add(oidcLeeway).Before(time.Unix(c.Before, 0)):
+		return nil, false
+	}
+	return &c, true
+}
+func (p *provider) authenticate(x context.Context, u, v string) (string, bool) {
+	if len(u) > 0 || len(v) == 0 {
+		return "", false
+	}
+	c, ok := p.verify(x, v)
+	if !ok || !allowed(p.allow, append([]string{c.Email, c.Username, c.Subject}, c.Groups...)...) {
+		return "", false
+	}
+	switch {
+	case len(c.Email) > 0:
+		return c.Email, true
+	case len(c.Username) > 0:
+		return c.Username, true
+	}
+	return c.Subject, true
+}
+
+// callback returns the redirect URL of the sign in, which is set in the config or made
+// from the request.
+func (p *provider) callback(r *http.Request) string {
+	if len(p.redirect) > 0 {
+		return p.redirect
+	}
+	s := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		s = "https"
+	}
+	return s + "://" + r.Host + strings.TrimSuffix(r.URL.Path, "/login") + "/callback"
+}
+
+// httpLogin sends the browser to the provider to sign in. The state, nonce and PKCE
+// verifier are kept in a short lived cookie, so they are checked by the callback on any
+// node of a cluster.
+func (s *Scoreboard) httpLogin(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.signin.(*provider)
+	if !ok || r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	p.lock.Lock()
+	err := error(nil)
+	if len(p.auth) == 0 {
+		err = p.discover(r.Context())
+	}
+	a := p.auth
+	p.lock.Unlock()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		s.log.request(r).Error(`Unable to reach OpenID Connect provider "%s": %s!`, p.issuer, err.Error())
+		return
+	}
+	var b [48]byte
+	rand.Read(b[:])
+	var (
+		t = hex.EncodeToString(b[:16])
+		n = hex.EncodeToString(b[16:32])
+		v = base64.RawURLEncoding.EncodeToString(b[32:])
+		c = sha256.Sum256([]byte(v))
+		q = url.Values{
+			"response_type":         {"code"},
+			"client_id":             {p.client},
+			"redirect_uri":          {p.callback(r)},
+			"scope":                 {"openid email profile"},
+			"state":                 {t},
+			"nonce":                 {n},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(c[:])},
+			"code_challenge_method": {"S256"},
+		}
+	)
+	http.SetCookie(w, &http.Cookie{
+		Name: oidcCookie, Value: t + "." + n + "." + v, Path: strings.TrimSuffix(r.URL.Path, "/login"), MaxAge: 600,
+		HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	if strings.ContainsRune(a, '?') {
+		http.Redirect(w, r, a+"&"+q.Encode(), http.StatusFound)
+	} else {
+		http.Redirect(w, r, a+"?"+q.Encode(), http.StatusFound)
+	}
+}
+
+// httpCallback exchanges the code sent back by the provider for an ID token, which is
+// passed to the admin page in the URL fragment, so it is never sent to the server or
+// written to the access logs.
+func (s *Scoreboard) httpCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.signin.(*provider)
+	if !ok || r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	k, err := r.Cookie(oidcCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: strings.TrimSuffix(r.URL.Path, "/callback"), MaxAge: -1, HttpOnly: true})
+	if err != nil {
+		http.Error(w, "Sign in expired, please try again.", http.StatusBadRequest)
+		return
+	}
+	var (
+		q = r.URL.Query()
+		c = strings.SplitN(k.Value, ".", 3)
+	)
+	if e := q.Get("error"); len(e) > 0 {
+		http.Error(w, "Sign in failed: "+e, http.StatusForbidden)
+		s.log.request(r).Warning(`OpenID Connect sign in from "%s" failed: %s!`, r.RemoteAddr, e)
+		return
+	}
+	if len(c) != 3 || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(c[0])) != 1 || len(q.Get("code")) == 0 {
+		http.Error(w, "Sign in expired, please try again.", http.StatusBadRequest)
+		return
+	}
+	t, err := p.exchange(r, q.Get("code"), c[2])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		s.log.request(r).Error(`Unable to finish the OpenID Connect sign in from "%s": %s!`, r.RemoteAddr, err.Error())
+		return
+	}
+	v, ok := p.verify(r.Context(), t)
+	if !ok || subtle.ConstantTimeCompare([]byte(v.Nonce), []byte(c[1])) != 1 {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		s.log.request(r).Warning(`Rejected the OpenID Connect ID token of the sign in from "%s"!`, r.RemoteAddr)
+		return
+	}
+	n, ok := p.authenticate(r.Context(), "", t)
+	if !ok {
+		http.Error(w, "This account cannot sign in to the admin page.", http.StatusForbidden)
+		s.log.request(r).Warning(`Rejected the OpenID Connect sign in of "%s" from "%s", they are not allowed!`, v.Subject, r.RemoteAddr)
+		return
+	}
+	s.log.request(r).Info(`Staff "%s" signed in with OpenID Connect from "%s".`, n, r.RemoteAddr)
+	// The relative location keeps any tenant prefix of the request path.
+	w.Header().Set("Location", "../admin#token="+url.QueryEscape(t))
+	w.WriteHeader(http.StatusFound)
+}
+
+// exchange returns the ID token of the authorization code.
+func (p *provider) exchange(r *http.Request, c, v string) (string, error) {
+	p.lock.Lock()
+	e := p.token
+	p.lock.Unlock()
+	f := url.Values{"grant_type": {"authorization_code"}, "code": {c}, "redirect_uri": {p.callback(r)}, "code_verifier": {v}}
+	if p.post {
+		f.Set("client_id", p.client)
+		f.Set("client_secret", p.secret)
+	}
+	q, err := http.NewRequestWithContext(r.Context(), http.MethodPost, e, strings.NewReader(f.Encode()))
+	if err != nil {
+		return "", err
+	}
+	q.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	q.Header.Set("Accept", "application/json")
+	if !p.post {
+		q.SetBasicAuth(url.QueryEscape(p.client), url.QueryEscape(p.secret))
+	}
+	o, err := p.c.Do(q)
+	if err != nil {
+		return "", err
+	}
+	defer o.Body.Close()
+	if o.StatusCode != http.StatusOK {
+		return "", &errval{s: "token request returned " + o.Status}
+	}
+	var t struct {
+		ID string `json:"id_token"`
+	}
+	if err = json.NewDecoder(io.LimitReader(o.Body, oidcMax)).Decode(&t); err != nil {
+		return "", err
+	}
+	if len(t.ID) == 0 {
+		return "", &errval{s: "token response does not have an ID token"}
+	}
+	return t.ID, nil
+}
@@ -0,0 +1,247 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const prefix = "SCOREBOARD_"
+
+var sourceType = reflect.TypeOf(source{})
+
+type values []string
+
+func (v values) String() string {
+	return strings.Join(v, ",")
+}
+func (v *values) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+func environ() bool {
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// overrides returns the config overrides set by environment variables, followed by the
+// supplied overrides from the command line, as "name=value" strings.
+func overrides(o []string) ([]string, error) {
+	var r []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, prefix) {
+			continue
+		}
+		i := strings.IndexByte(e, '=')
+		if i <= len(prefix) {
+			continue
+		}
+		n := e[len(prefix):i]
+		p, ok := lookup(reflect.TypeOf(config{}), n)
+		if !ok && strings.HasSuffix(n, "_FILE") {
+			if p, ok = lookup(reflect.TypeOf(config{}), n[:len(n)-5]); ok {
+				p[len(p)-1] += "_file"
+			}
+		}
+		if !ok {
+			return nil, &errval{s: `environment variable "` + e[:i] + `" does not match a config value`}
+		}
+		r = append(r, strings.Join(p, ".")+"="+e[i+1:])
+	}
+	return append(r, o...), nil
+}
+
+// lookup returns the config value path that matches the supplied environment variable
+// name, which is the JSON names of the path in upper case joined with underscores.
+func lookup(t reflect.Type, n string) ([]string, bool) {
+	if t == sourceType || t.Kind() == reflect.Map {
+		return []string{strings.ToLower(n)}, true
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		k := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(k) == 0 || k == "-" {
+			continue
+		}
+		v := strings.ToUpper(k)
+		if n == v {
+			return []string{k}, true
+		}
+		if !strings.HasPrefix(n, v+"_") {
+			continue
+		}
+		if p, ok := lookup(t.Field(i).Type, n[len(v)+1:]); ok {
+			return append([]string{k}, p...), true
+		}
+	}
+	return nil, false
+}
+
+// override sets the config values named in the supplied "name=value" strings. Names are
+// the JSON names of the value joined with dots, such as "twitter.auth.access_key". Names
+// that end with "_file" set the value to the contents of the named file instead.
+func override(c *config, o []string) error {
+	if len(o) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for _, s := range o {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return &errval{s: `config override "` + s + `" must be in the form "name=value"`}
+		}
+		n, v := s[:i], s[i+1:]
+		if strings.HasSuffix(n, "_file") {
+			if v, err = secret(v); err != nil {
+				return err
+			}
+			n = n[:len(n)-5]
+		}
+		if err = set(m, reflect.TypeOf(config{}), strings.Split(n, "."), v); err != nil {
+			return &errval{s: `cannot set config value "` + n + `"`, e: err}
+		}
+	}
+	if b, err = json.Marshal(m); err != nil {
+		return err
+	}
+	var v config
+	if err = json.Unmarshal(b, &v); err != nil {
+		return &errval{s: "cannot apply the config overrides", e: err}
+	}
+	*c = v
+	return nil
+}
+func set(m map[string]interface{}, t reflect.Type, p []string, s string) error {
+	if t == sourceType {
+		if len(p) != 1 {
+			return &errval{s: "source values cannot be nested"}
+		}
+		if len(s) > 0 && (s[0] == '{' || s[0] == '[') {
+			if !json.Valid([]byte(s)) {
+				return &errval{s: "value is not valid JSON"}
+			}
+			m[p[0]] = json.RawMessage(s)
+		} else {
+			m[p[0]] = s
+		}
+		return nil
+	}
+	if t.Kind() == reflect.Map && len(p) == 1 {
+		v, err := convert(t.Elem(), s)
+		if err != nil {
+			return err
+		}
+		m[p[0]] = v
+		return nil
+	}
+	if t.Kind() != reflect.Struct {
+		return &errval{s: "value does not have any fields"}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] != p[0] {
+			continue
+		}
+		if len(p) == 1 {
+			v, err := convert(t.Field(i).Type, s)
+			if err != nil {
+				return err
+			}
+			m[p[0]] = v
+			return nil
+		}
+		n, ok := m[p[0]].(map[string]interface{})
+		if !ok {
+			n = make(map[string]interface{})
+			m[p[0]] = n
+		}
+		return set(n, t.Field(i).Type, p[1:], s)
+	}
+	return &errval{s: `"` + p[0] + `" is not a config value`}
+}
+
+// convert returns the JSON value of the supplied string for the config value type. Lists
+// of strings or numbers can be comma separated and all other types must be JSON.
+func convert(t reflect.Type, s string) (json.RawMessage, error) {
+	switch t.Kind() {
+	case reflect.String:
+		b, _ := json.Marshal(s)
+		return b, nil
+	case reflect.Bool:
+		if _, err := strconv.ParseBool(s); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(strings.ToLower(s)), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(s), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(s), nil
+	case reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(s), nil
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			break
+		}
+		switch e := t.Elem(); e.Kind() {
+		case reflect.String, reflect.Int, reflect.Int64:
+			l := split(s)
+			r := make([]json.RawMessage, 0, len(l))
+			for i := range l {
+				v, err := convert(e, strings.TrimSpace(l[i]))
+				if err != nil {
+					return nil, err
+				}
+				r = append(r, v)
+			}
+			b, _ := json.Marshal(r)
+			return b, nil
+		}
+	}
+	if t == sourceType && !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		return nil, &errval{s: "source must be a JSON object"}
+	}
+	if !json.Valid([]byte(s)) {
+		return nil, &errval{s: "value is not valid JSON"}
+	}
+	return json.RawMessage(s), nil
+}
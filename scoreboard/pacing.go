@@ -0,0 +1,35 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import "strconv"
+
+// pacing smooths the ticker when many Changes are found at once, such as when the
+// Source catches up after an outage. Rate is the most Changes added to the ticker of
+// each Game each minute, zero for no limit, and Collapse merges the Changes of the same
+// kind and team found in one update into one.
+type pacing struct {
+	Rate     int  `json:"rate"`
+	Collapse bool `json:"collapse"`
+}
+
+func (p pacing) verify() error {
+	if p.Rate < 0 {
+		return &errval{s: "pacing rate " + strconv.Itoa(p.Rate) + " cannot be less than zero"}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	// podiumTop is the default number of places shown on the podium.
+	podiumTop = 3
+	// podiumMax is the most places that can be shown on the podium.
+	podiumMax = 10
+)
+
+// podium is the podium view of the top teams of a Game, used for award ceremonies. A
+// pinned podium is shown instead of the scoreboard on the displays of the pinned Game
+// or named game. A staged podium hides every place until each is revealed with the
+// admin API, from the last place to the first.
+type podium struct {
+	Route    string `json:"route,omitempty"`
+	Game     uint64 `json:"game,omitempty"`
+	Top      int    `json:"top"`
+	Revealed int    `json:"revealed"`
+	Pinned   bool   `json:"pinned"`
+	Staged   bool   `json:"staged"`
+}
+type place struct {
+	Team  *game.Standing `json:"team,omitempty"`
+	Place int            `json:"place"`
+}
+
+// places returns the number of places shown on the podium.
+func (p podium) places() int {
+	if p.Top == 0 {
+		return podiumTop
+	}
+	return p.Top
+}
+
+// pinned returns true if the podium is pinned to the displays of the Game or named
+// game route.
+func (p podium) pinned(g uint64, o string) bool {
+	if !p.Pinned {
+		return false
+	}
+	if len(p.Route) > 0 {
+		return p.Route == o
+	}
+	return len(o) == 0 && p.Game == g
+}
+
+// hidden returns true if the place, out of the number of places shown, is not shown
+// yet, as the podium is staged and the place has not been revealed.
+func (p podium) hidden(i, n int) bool {
+	return p.Staged && i <= n-p.Revealed
+}
+
+// release sends a transition to the displays of the pinned Game or named game, so they
+// reload and show the podium or the scoreboard.
+func (s *Scoreboard) release(p podium) {
+	if len(p.Route) == 0 {
+		if p.Game > 0 {
+			s.Transition(p.Game)
+		}
+		return
+	}
+	if m := s.arena(p.Route); m != nil {
+		m.Transition(current(m))
+	}
+}
+
+// httpPodium returns the podium view of the Game in the path, which is a Game ID or the
+// name of a named game, or the current Game if the path is empty.
+func (s *Scoreboard) httpPodium(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		v uint64
+		o string
+		n = strings.Trim(strings.TrimPrefix(r.URL.Path, "/podium"), "/")
+	)
+	switch x, err := strconv.ParseUint(n, 10, 64); {
+	case len(n) == 0:
+		s.swap.RLock()
+		p := s.podium
+		s.swap.RUnlock()
+		if v = current(s.Manager); p.Pinned {
+			if len(p.Route) == 0 {
+				v = p.Game
+			} else if m := s.arena(p.Route); m != nil {
+				v, o = current(m), p.Route
+			}
+		}
+	case err == nil:
+		v = x
+	default:
+		if m := s.arena(n); m != nil {
+			v, o = current(m), strings.ToLower(n)
+		}
+	}
+	if v == 0 {
+		http.Error(w, "game does not exist or is not active", http.StatusNotFound)
+		return
+	}
+	s.ceremony(w, r, &display{Game: v, Route: o})
+}
+
+// ceremony writes the podium view with the display, which is also used by displays of a
+// Game or named game that has the podium pinned.
+func (s *Scoreboard) ceremony(w http.ResponseWriter, r *http.Request, d *display) {
+	l := s.language(r)
+	d.Lang, d.Zone, d.Text, d.Access = l, s.timezone(r).String(), s.locales[l], accessible(r)
+	d.History = s.store != nil && len(d.Route) == 0
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", l)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.render(w, r, "podium.html", d.key(), d); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.web.request(r).Error(`Error during request from "%s": %s!`, r.RemoteAddr, err.Error())
+	}
+}
+
+// httpPlaces returns the top places of the Game for the podium view. Places that are
+// not revealed yet are returned without the team, so they cannot be read from the API
+// before the ceremony.
+func (s *Scoreboard) httpPlaces(w http.ResponseWriter, r *http.Request) {
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	var (
+		a = s.permitted(r, true, scopeScores)
+		v game.Snapshot
+	)
+	if a {
+		v, ok = m.Standings(g)
+	} else {
+		v, ok = m.Displayed(g)
+	}
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if !a {
+		v = m.Mask(v)
+	}
+	s.swap.RLock()
+	p := s.podium
+	s.swap.RUnlock()
+	n := p.places()
+	if n > len(v.Teams) {
+		n = len(v.Teams)
+	}
+	l := make([]place, n)
+	for i := range l {
+		if l[i].Place = i + 1; !p.hidden(i+1, n) {
+			l[i].Team = &v.Teams[i]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"game":     v.Game,
+		"game_id":  v.GameID,
+		"top":      p.places(),
+		"staged":   p.Staged,
+		"revealed": p.Revealed,
+		"pinned":   p.pinned(g, strings.ToLower(r.URL.Query().Get("name"))),
+		"places":   l,
+	})
+}
+
+// httpAdminPodium returns or changes the podium. The action "pin" shows the podium on
+// the displays of a Game or named game and "unpin" returns them to the scoreboard. The
+// action "stage" hides every place, "reveal" shows the next place, from the last place
+// to the first, and "show" shows every place.
+func (s *Scoreboard) httpAdminPodium(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.swap.RLock()
+		p := s.podium
+		s.swap.RUnlock()
+		p.Top = p.places()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c struct {
+		Action string `json:"action"`
+		Route  string `json:"route"`
+		Game   uint64 `json:"game"`
+		Top    int    `json:"top"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	if c.Top < 0 || c.Top > podiumMax {
+		fail(w, "top must be between 1 and "+strconv.Itoa(podiumMax), http.StatusBadRequest)
+		return
+	}
+	if c.Route = strings.ToLower(c.Route); len(c.Route) > 0 && s.arena(c.Route) == nil {
+		fail(w, `route "`+c.Route+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	s.swap.Lock()
+	o := s.podium
+	p := o
+	if c.Top > 0 {
+		p.Top = c.Top
+	}
+	switch c.Action = strings.ToLower(c.Action); c.Action {
+	case "pin":
+		if p.Pinned, p.Route, p.Game = true, c.Route, c.Game; len(c.Route) == 0 && c.Game == 0 {
+			p.Game = current(s.Manager)
+		}
+		if len(p.Route) == 0 && p.Game == 0 {
+			s.swap.Unlock()
+			fail(w, "a game or route is required", http.StatusBadRequest)
+			return
+		}
+	case "unpin":
+		p.Pinned = false
+	case "stage":
+		p.Staged, p.Revealed = true, 0
+	case "reveal":
+		if !p.Staged {
+			s.swap.Unlock()
+			fail(w, "the podium is not staged", http.StatusConflict)
+			return
+		}
+		if p.Revealed < p.places() {
+			p.Revealed++
+		}
+	case "show":
+		p.Staged, p.Revealed = false, 0
+	default:
+		s.swap.Unlock()
+		fail(w, `action "`+c.Action+`" must be "pin", "unpin", "stage", "reveal" or "show"`, http.StatusBadRequest)
+		return
+	}
+	if p.Revealed > p.places() {
+		p.Revealed = p.places()
+	}
+	s.podium = p
+	s.swap.Unlock()
+	if o.Pinned && (!p.Pinned || o.Route != p.Route || o.Game != p.Game) {
+		s.release(o)
+	}
+	if p.Pinned && (!o.Pinned || o.Route != p.Route || o.Game != p.Game) {
+		s.release(p)
+	}
+	s.log.request(r).Info(`Admin "%s" sent the podium action "%s".`, r.RemoteAddr, c.Action)
+	p.Top = p.places()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
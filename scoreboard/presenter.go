@@ -0,0 +1,145 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// presenterReveal is the default time in seconds the unfreeze animation started from
+// the presenter page takes.
+const presenterReveal = 30
+
+// presenter is the config of the presenter page, which runs the closing ceremony from
+// a wireless presenter or keyboard. Views are the board tabs or pages the displays are
+// switched between, in order, and Reveal is the time in seconds the unfreeze animation
+// takes.
+type presenter struct {
+	Views  []string `json:"views"`
+	Reveal int      `json:"reveal"`
+}
+
+// keypress is a single key press sent by the presenter page. The action "next" reveals the
+// next podium place, "unfreeze" starts the unfreeze animation of the Game and "view"
+// switches every display to the view with the index in View.
+type keypress struct {
+	Action string `json:"action"`
+	Game   uint64 `json:"game"`
+	View   int    `json:"view"`
+}
+type rundown struct {
+	Views  []string    `json:"views"`
+	Frozen []game.Hold `json:"frozen"`
+	Podium podium      `json:"podium"`
+	Reveal int         `json:"reveal"`
+}
+
+func (p presenter) verify() error {
+	if p.Reveal < 0 {
+		return &errval{s: "admin presenter reveal " + strconv.Itoa(p.Reveal) + " cannot be less than zero"}
+	}
+	for _, v := range p.Views {
+		if !view(v) {
+			return &errval{s: `admin presenter view "` + v + `" must be a board tab or a page path`}
+		}
+	}
+	return nil
+}
+func (p presenter) reveal() time.Duration {
+	if p.Reveal == 0 {
+		return presenterReveal * time.Second
+	}
+	return time.Duration(p.Reveal) * time.Second
+}
+
+// httpPresenter returns the presenter page. Like the admin page, it holds no secrets and
+// asks for the admin token, which is sent with each key press.
+func (s *Scoreboard) httpPresenter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := s.render(w, r, "presenter.html", strings.Join(s.cues.Views, ","), s.cues); err != nil {
+		s.log.request(r).Error("Unable to render the presenter page: %s!", err.Error())
+	}
+}
+
+// httpCue returns the state shown on the presenter page or runs the action of a key
+// press. Each action is handled by the admin endpoint it stands for, so it is logged,
+// held for approval and relayed to the cluster the same way.
+func (s *Scoreboard) httpCue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.swap.RLock()
+		p := s.podium
+		s.swap.RUnlock()
+		p.Top = p.places()
+		v := rundown{Views: s.cues.Views, Frozen: s.Frozen(), Podium: p, Reveal: int(s.cues.reveal() / time.Second)}
+		if v.Views == nil {
+			v.Views = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c keypress
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	switch c.Action = strings.ToLower(c.Action); c.Action {
+	case "next":
+		forward(w, r, s.httpAdminPodium, map[string]string{"action": "reveal"})
+	case "unfreeze":
+		forward(w, r, s.httpFreeze, control{Action: "unfreeze", Game: c.Game, Duration: s.cues.reveal().String()})
+	case "view":
+		if c.View < 0 || c.View >= len(s.cues.Views) {
+			fail(w, "view "+strconv.Itoa(c.View)+" is not a presenter view", http.StatusBadRequest)
+			return
+		}
+		forward(w, r, s.httpDisplays, directive{Command: game.Command{Action: game.SwitchView, View: s.cues.Views[c.View]}})
+	default:
+		fail(w, `action "`+c.Action+`" must be "next", "unfreeze" or "view"`, http.StatusBadRequest)
+	}
+}
+
+// forward runs the admin handler with the body in place of the body of the request.
+func forward(w http.ResponseWriter, r *http.Request, h http.HandlerFunc, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fail(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	q := r.Clone(r.Context())
+	q.Body, q.ContentLength = io.NopCloser(bytes.NewReader(b)), int64(len(b))
+	h(w, q)
+}
@@ -0,0 +1,100 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Problem codes are the machine readable "code" values of the API error responses,
+// which stay the same when the wording of the detail changes.
+const (
+	codeInvalid     = "validation_failed"
+	codeUnauthed    = "unauthorized"
+	codeForbidden   = "forbidden"
+	codeNotFound    = "not_found"
+	codeMethod      = "method_not_allowed"
+	codeConflict    = "conflict"
+	codeFrozen      = "frozen"
+	codeLocked      = "locked"
+	codeReadOnly    = "read_only"
+	codeTooLarge    = "too_large"
+	codeMediaType   = "unsupported_media_type"
+	codeRateLimited = "rate_limited"
+	codeInternal    = "internal_error"
+	codeUnavailable = "unavailable"
+)
+
+// problem is an RFC 7807 "application/problem+json" error response. The type is always
+// "about:blank", so the title is the status text, and the code tells the kind of error
+// apart when a status is used for several errors.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+}
+
+// coded returns the problem code of the HTTP status.
+func coded(c int) string {
+	switch c {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codeInvalid
+	case http.StatusUnauthorized:
+		return codeUnauthed
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethod
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusRequestEntityTooLarge:
+		return codeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return codeMediaType
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+	return codeInternal
+}
+
+// fail writes the API error response with the detail and status, using the problem
+// code of the status. It takes the same values as http.Error.
+func fail(w http.ResponseWriter, d string, c int) {
+	refuse(w, coded(c), d, c)
+}
+
+// refuse writes the API error response with the problem code, detail and status.
+func refuse(w http.ResponseWriter, k, d string, c int) {
+	p := problem{Type: "about:blank", Title: http.StatusText(c), Code: k, Status: c}
+	// The status text is not repeated as the detail, as it is already the title.
+	if d != p.Title {
+		p.Detail = d
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(c)
+	json.NewEncoder(w).Encode(p)
+}
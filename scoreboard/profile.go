@@ -0,0 +1,403 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	// paceMax is the largest ticker speed and animation length of a profile.
+	paceMax = 10
+	// flipMax is the most seconds a standings tab can be shown by auto scroll.
+	flipMax = 3600
+)
+
+// widgets is the parts of the board that a profile can show or hide.
+var widgets = [...]string{
+	"title", "clock", "tabs", "status", "ticker", "tweets", "channels", "sponsors", "qr", "popups", "effects",
+	"callouts",
+}
+
+// resolutions is the resolution classes of a profile, which scale the board to fit the
+// screen it is shown on.
+var resolutions = [...]string{"sd", "hd", "fhd", "uhd"}
+
+// profiles is the named display layouts, so the lobby TV, the main projector and the
+// stream overlay can show different parts of the same board. Displays select a profile
+// with the "profile" query parameter, or are assigned one by the "client" name in their
+// URL, either in the config or with the admin API.
+type profiles map[string]preset
+type preset struct {
+	Resolution string    `json:"resolution,omitempty"`
+	Theme      string    `json:"theme,omitempty"`
+	Widgets    []string  `json:"widgets,omitempty"`
+	Rotation   []string  `json:"rotation,omitempty"`
+	Clients    []string  `json:"clients,omitempty"`
+	Pace       game.Pace `json:"pace,omitempty"`
+	Interval   int       `json:"interval,omitempty"`
+}
+
+// layout is the profile of a rendered page. The name is empty if the page does not
+// use a profile.
+type layout struct {
+	preset
+	Name string
+}
+
+func (p profiles) verify() error {
+	c := make(map[string]string)
+	for n, v := range p {
+		if !slug(n) {
+			return &errval{s: `profile name "` + n + `" can only contain lowercase letters, numbers, dashes and underscores`}
+		}
+		if err := v.verify(n); err != nil {
+			return err
+		}
+		for _, k := range v.Clients {
+			if !slug(k) {
+				return &errval{s: `profile "` + n + `" client "` + k + `" can only contain lowercase letters, numbers, dashes and underscores`}
+			}
+			if o, ok := c[k]; ok {
+				return &errval{s: `client "` + k + `" is assigned to both profile "` + o + `" and "` + n + `"`}
+			}
+			c[k] = n
+		}
+	}
+	return nil
+}
+func (p preset) verify(n string) error {
+	if len(p.Resolution) > 0 && !listed(resolutions[:], p.Resolution) {
+		return &errval{s: `profile "` + n + `" resolution "` + p.Resolution + `" must be one of ` + strings.Join(resolutions[:], ", ")}
+	}
+	if len(p.Theme) > 0 && !slug(p.Theme) {
+		return &errval{s: `profile "` + n + `" theme "` + p.Theme + `" can only contain lowercase letters, numbers, dashes and underscores`}
+	}
+	for _, v := range p.Widgets {
+		if !listed(widgets[:], v) {
+			return &errval{s: `profile "` + n + `" widget "` + v + `" must be one of ` + strings.Join(widgets[:], ", ")}
+		}
+	}
+	for _, v := range p.Rotation {
+		if !view(v) || strings.HasPrefix(v, "/") {
+			return &errval{s: `profile "` + n + `" rotation tab "` + v + `" is not valid`}
+		}
+	}
+	if p.Interval < 0 {
+		return &errval{s: `profile "` + n + `" interval ` + strconv.Itoa(p.Interval) + " cannot be less than zero"}
+	}
+	if v := tempo(p.Pace); len(v) > 0 {
+		return &errval{s: `profile "` + n + `" ` + v}
+	}
+	return nil
+}
+
+// tempo returns the problem with the Pace, or an empty string if it is valid.
+func tempo(p game.Pace) string {
+	switch {
+	case p.Ticker < 0 || p.Ticker > paceMax:
+		return "pace ticker must be between 0 and " + strconv.Itoa(paceMax)
+	case p.Animation < 0 || p.Animation > paceMax:
+		return "pace animation must be between 0 and " + strconv.Itoa(paceMax)
+	case p.Flip < 0 || p.Flip > flipMax:
+		return "pace flip must be between 0 and " + strconv.Itoa(flipMax) + " seconds"
+	}
+	return ""
+}
+func listed(l []string, s string) bool {
+	for i := range l {
+		if l[i] == s {
+			return true
+		}
+	}
+	return false
+}
+func slug(s string) bool {
+	if len(s) == 0 || len(s) > 64 {
+		return false
+	}
+	for i := range s {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-' || c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// assigned returns the name of the profile of the client, from the admin API first and
+// then the config.
+func (s *Scoreboard) assigned(c string) string {
+	if len(c) == 0 {
+		return ""
+	}
+	if n, ok := s.assign[c]; ok {
+		return n
+	}
+	for n, v := range s.profiles {
+		if listed(v.Clients, c) {
+			return n
+		}
+	}
+	return ""
+}
+
+// layout returns the profile selected by the "profile" query parameter of the request,
+// or the profile assigned to the "client" query parameter. Unknown profiles are ignored,
+// so a display with an old URL still shows the board.
+func (s *Scoreboard) layout(r *http.Request) *layout {
+	q := r.URL.Query()
+	n := strings.ToLower(q.Get("profile"))
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	if len(n) == 0 {
+		n = s.assigned(strings.ToLower(q.Get("client")))
+	}
+	v, ok := s.profiles[n]
+	if !ok {
+		return nil
+	}
+	if p, ok := s.paces[n]; ok {
+		v.Pace = p
+	}
+	return &layout{Name: n, preset: v}
+}
+
+// Classes returns the classes of the page body that hide the widgets not shown by the
+// profile and scale the board to the resolution.
+func (l *layout) Classes() string {
+	if l == nil {
+		return ""
+	}
+	var c []string
+	if len(l.Widgets) > 0 {
+		for _, v := range widgets {
+			if !listed(l.Widgets, v) {
+				c = append(c, "hide-"+v)
+			}
+		}
+	}
+	if len(l.Resolution) > 0 {
+		c = append(c, "res-"+l.Resolution)
+	}
+	return strings.Join(c, " ")
+}
+
+// Profile returns the name, rotation, interval and pace of the profile of the page as JSON for
+// the page script, or "null" if the page does not use a profile.
+func (d *display) Profile() string {
+	if d.Layout == nil {
+		return "null"
+	}
+	b, err := json.Marshal(map[string]interface{}{"name": d.Layout.Name, "rotation": d.Layout.Rotation, "interval": d.Layout.Interval, "pace": d.Layout.Pace})
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// stamp returns a hash of the profile, which is added to the render cache key so pages
+// are rendered again when the profile is changed by a config reload.
+func (l *layout) stamp() string {
+	if l == nil {
+		return "0"
+	}
+	h := fnv.New64a()
+	h.Write([]byte(l.Name + "\x00" + l.Resolution + "\x00" + l.Theme + "\x00" + strconv.Itoa(l.Interval)))
+	h.Write([]byte("\x00" + strconv.FormatFloat(l.Pace.Ticker, 'f', -1, 64) + "\x00" + strconv.FormatFloat(l.Pace.Animation, 'f', -1, 64) + "\x00" + strconv.Itoa(l.Pace.Flip)))
+	for _, v := range l.Widgets {
+		h.Write([]byte("\x00w" + v))
+	}
+	for _, v := range l.Rotation {
+		h.Write([]byte("\x00r" + v))
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+func (s *Scoreboard) httpProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.swap.RLock()
+		v := struct {
+			Profiles []string          `json:"profiles"`
+			Assigned map[string]string `json:"assigned"`
+		}{Profiles: make([]string, 0, len(s.profiles)), Assigned: make(map[string]string)}
+		for n, p := range s.profiles {
+			v.Profiles = append(v.Profiles, n)
+			for _, c := range p.Clients {
+				v.Assigned[c] = n
+			}
+		}
+		for c, n := range s.assign {
+			if len(n) == 0 {
+				delete(v.Assigned, c)
+			} else {
+				v.Assigned[c] = n
+			}
+		}
+		s.swap.RUnlock()
+		sort.Strings(v.Profiles)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c struct {
+		Client  string `json:"client"`
+		Profile string `json:"profile"`
+		Display uint64 `json:"display"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	c.Client, c.Profile = strings.ToLower(c.Client), strings.ToLower(c.Profile)
+	s.swap.RLock()
+	_, ok := s.profiles[c.Profile]
+	s.swap.RUnlock()
+	if !ok && len(c.Profile) > 0 {
+		fail(w, `profile "`+c.Profile+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	// Display IDs are different on each node of the cluster, so relayed requests are
+	// only applied by client name.
+	if _, ok := r.Context().Value(clusterKey{}).(string); ok && c.Display > 0 {
+		return
+	}
+	// A display that was opened without a client name is sent its profile directly, as
+	// there is no name to keep the assignment under.
+	if c.Display > 0 {
+		var d *screen
+		for _, v := range s.screens() {
+			if v.ID == c.Display {
+				d = &v
+				break
+			}
+		}
+		if d == nil {
+			fail(w, "display "+strconv.FormatUint(c.Display, 10)+" is not connected", http.StatusNotFound)
+			return
+		}
+		if c.Client = d.Client; len(c.Client) == 0 {
+			s.command(d, game.Command{Action: game.Profile, View: c.Profile})
+			s.log.request(r).Info(`Admin "%s" set the profile of display %d to "%s".`, r.RemoteAddr, c.Display, c.Profile)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+	if !slug(c.Client) {
+		fail(w, "a valid client name or display ID is required", http.StatusBadRequest)
+		return
+	}
+	s.swap.Lock()
+	if s.assign == nil {
+		s.assign = make(map[string]string)
+	}
+	s.assign[c.Client] = c.Profile
+	s.swap.Unlock()
+	// Displays of the client are reloaded, so they are rendered with the new profile.
+	var n int
+	for _, v := range s.screens() {
+		if v.Client == c.Client {
+			s.command(&v, game.Command{Action: game.Reload})
+			n++
+		}
+	}
+	s.log.request(r).Info(`Admin "%s" assigned client "%s" to profile "%s", reloading %d displays.`, r.RemoteAddr, c.Client, c.Profile, n)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"client": c.Client, "profile": c.Profile, "reloaded": n})
+}
+
+// httpPace returns the pace of each profile, or changes the pace of a profile and sends
+// it to the displays using the profile, so the change is shown without reloading them.
+// A DELETE with the "profile" query value returns the profile to its config pace.
+func (s *Scoreboard) httpPace(w http.ResponseWriter, r *http.Request) {
+	var (
+		n string
+		p game.Pace
+	)
+	switch r.Method {
+	case http.MethodGet:
+		s.swap.RLock()
+		v := make(map[string]game.Pace, len(s.profiles))
+		for k, c := range s.profiles {
+			if o, ok := s.paces[k]; ok {
+				v[k] = o
+			} else {
+				v[k] = c.Pace
+			}
+		}
+		s.swap.RUnlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	case http.MethodPost, http.MethodPut:
+		var c struct {
+			Profile string `json:"profile"`
+			game.Pace
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+			fail(w, "request body is not valid JSON", http.StatusBadRequest)
+			return
+		}
+		if v := tempo(c.Pace); len(v) > 0 {
+			fail(w, v, http.StatusBadRequest)
+			return
+		}
+		n, p = strings.ToLower(c.Profile), c.Pace
+	case http.MethodDelete:
+		n = strings.ToLower(r.URL.Query().Get("profile"))
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.swap.Lock()
+	c, ok := s.profiles[n]
+	if !ok {
+		s.swap.Unlock()
+		fail(w, `profile "`+n+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		delete(s.paces, n)
+		p = c.Pace
+	} else {
+		if s.paces == nil {
+			s.paces = make(map[string]game.Pace)
+		}
+		s.paces[n] = p
+	}
+	s.swap.Unlock()
+	s.Command(0, game.Command{Action: game.Pacing, View: n, Pace: &p})
+	for _, m := range s.games {
+		m.Command(0, game.Command{Action: game.Pacing, View: n, Pace: &p})
+	}
+	s.log.request(r).Info(`Admin "%s" set the pace of profile "%s" to ticker %g, animation %g and flip %d.`, r.RemoteAddr, n, p.Ticker, p.Animation, p.Flip)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
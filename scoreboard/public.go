@@ -0,0 +1,227 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	// crowdRate is the default requests each address can make to the public scoreboard
+	// each minute.
+	crowdRate = 60
+	// crowdBurst is the default requests each address can make at once before the rate
+	// limit applies.
+	crowdBurst = 10
+	// crowdAge is the default seconds that the public scoreboard is cached by clients.
+	crowdAge = 15
+)
+
+// exposure is the limits of the public scoreboard at "/api/v1/public/scoreboard", which
+// is made for sites and bots outside the venue that poll the standings. Each address can
+// make "burst" requests at once and "rate" requests each minute after that, and clients
+// and CDNs are told to cache the response for "max_age" seconds.
+type exposure struct {
+	Rate   int `json:"rate,omitempty"`
+	Burst  int `json:"burst,omitempty"`
+	MaxAge int `json:"max_age,omitempty"`
+}
+type crowd struct {
+	seen  map[string]*visitor
+	cache map[reprintKey]*reprint
+	swept time.Time
+	lock  sync.Mutex
+	exposure
+}
+type visitor struct {
+	last   time.Time
+	tokens float64
+}
+
+// reprint is the public scoreboard of a Game, which is only built again when the
+// standings shown on the display are updated.
+type reprint struct {
+	at     time.Time
+	tag    string
+	body   []byte
+	hidden bool
+}
+type reprintKey struct {
+	m *game.Manager
+	g uint64
+}
+
+// outsider is the public scoreboard. Only the fields shown on the displays are sent.
+type outsider struct {
+	Time      time.Time `json:"time"`
+	Game      string    `json:"game"`
+	Divisions []string  `json:"divisions"`
+	Teams     []placing `json:"teams"`
+	GameID    uint64    `json:"game_id"`
+}
+type placing struct {
+	Name        string `json:"name"`
+	Division    string `json:"division,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+	ID          uint64 `json:"id"`
+	Rank        int64  `json:"rank"`
+	Score       int64  `json:"score"`
+	Delta       int64  `json:"delta"`
+	Movement    int64  `json:"movement"`
+}
+
+func (e exposure) verify() error {
+	switch {
+	case e.Rate < 0:
+		return &errval{s: "public rate " + strconv.Itoa(e.Rate) + " cannot be less than zero"}
+	case e.Burst < 0:
+		return &errval{s: "public burst " + strconv.Itoa(e.Burst) + " cannot be less than zero"}
+	case e.MaxAge < 0:
+		return &errval{s: "public max age " + strconv.Itoa(e.MaxAge) + " cannot be less than zero"}
+	}
+	return nil
+}
+func newCrowd(e exposure) *crowd {
+	if e.Rate == 0 {
+		e.Rate = crowdRate
+	}
+	if e.Burst == 0 {
+		e.Burst = crowdBurst
+	}
+	if e.MaxAge == 0 {
+		e.MaxAge = crowdAge
+	}
+	return &crowd{seen: make(map[string]*visitor), cache: make(map[reprintKey]*reprint), exposure: e}
+}
+
+// admit takes a request from the address, and returns false and the seconds until the
+// next request can be made if the address is over its limit.
+func (c *crowd) admit(a string, n time.Time) (int, bool) {
+	r := float64(c.Rate) / 60
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Addresses that have not made a request for long enough to be back at the full
+	// burst are removed once a minute, so the list does not grow forever.
+	if n.Sub(c.swept) > time.Minute {
+		f := time.Duration(float64(c.Burst)/r*float64(time.Second)) + time.Second
+		for k, v := range c.seen {
+			if n.Sub(v.last) > f {
+				delete(c.seen, k)
+			}
+		}
+		c.swept = n
+	}
+	v, ok := c.seen[a]
+	if !ok {
+		v = &visitor{tokens: float64(c.Burst)}
+		c.seen[a] = v
+	} else if v.tokens += n.Sub(v.last).Seconds() * r; v.tokens > float64(c.Burst) {
+		v.tokens = float64(c.Burst)
+	}
+	v.last = n
+	if v.tokens < 1 {
+		return int((1-v.tokens)/r) + 1, false
+	}
+	v.tokens--
+	return 0, true
+}
+
+// issue returns the public scoreboard of the Game and its tag. The scoreboard is only
+// built again when the standings shown on the display or the anonymize mode change, so
+// polling clients do not add work for the Scoreboard.
+func (c *crowd) issue(m *game.Manager, g uint64) ([]byte, string, bool) {
+	v, ok := m.Displayed(g)
+	if !ok {
+		return nil, "", false
+	}
+	var (
+		k = reprintKey{m: m, g: g}
+		h = m.Anonymous()
+	)
+	c.lock.Lock()
+	if p, ok := c.cache[k]; ok && p.at.Equal(v.Time) && p.hidden == h {
+		c.lock.Unlock()
+		return p.body, p.tag, true
+	}
+	c.lock.Unlock()
+	v = m.Mask(v)
+	o := outsider{Time: v.Time, Game: v.Game, Divisions: v.Divisions(), Teams: make([]placing, len(v.Teams)), GameID: v.GameID}
+	if o.Divisions == nil {
+		o.Divisions = []string{}
+	}
+	for i, t := range v.Teams {
+		o.Teams[i] = placing{
+			Name: t.Name, Division: t.Division, Country: t.Country, Affiliation: t.Affiliation,
+			ID: t.ID, Rank: t.Rank, Score: t.Score, Delta: t.Delta, Movement: t.Movement,
+		}
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, "", false
+	}
+	f := fnv.New64a()
+	f.Write(b)
+	p := &reprint{at: v.Time, tag: `"` + hex.EncodeToString(f.Sum(nil)) + `"`, body: b, hidden: h}
+	c.lock.Lock()
+	c.cache[k] = p
+	c.lock.Unlock()
+	return p.body, p.tag, true
+}
+
+// httpPublic returns the public scoreboard of the Game. Requests with a token get the
+// same public scoreboard and are rate limited the same, as the response is shared.
+func (s *Scoreboard) httpPublic(w http.ResponseWriter, r *http.Request) {
+	a, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		a = r.RemoteAddr
+	}
+	if d, ok := s.crowd.admit(a, time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(d))
+		fail(w, "too many requests, try again in "+strconv.Itoa(d)+" seconds", http.StatusTooManyRequests)
+		return
+	}
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	b, t, ok := s.crowd.issue(m, g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	h := w.Header()
+	h.Set("ETag", t)
+	h.Set("Cache-Control", "public, max-age="+strconv.Itoa(s.crowd.MaxAge))
+	if v := r.Header.Get("If-None-Match"); len(v) > 0 && strings.Contains(v, t) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
@@ -0,0 +1,178 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// publishDefault is the default seconds between uploads to the publish bucket.
+const publishDefault = 60
+
+// outlet is the publisher of the standings to an S3 compatible bucket. Every "interval"
+// seconds, the standings JSON, snapshot image and export files of the current Game and
+// every named Game are uploaded under the "bucket" URL, so the public can be sent to a
+// CDN in front of the bucket instead of the uplink of the venue.
+type outlet struct {
+	Bucket   string `json:"bucket,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Interval int    `json:"interval,omitempty"`
+	Enabled  bool   `json:"enabled"`
+}
+type publisher struct {
+	log    *journal
+	client *http.Client
+	base   *url.URL
+	sums   map[string]uint64
+	outlet
+}
+
+// parcel is a file uploaded by the publisher, which is the response of the handler to
+// a GET request of the path.
+type parcel struct {
+	name string
+	path string
+	h    http.HandlerFunc
+}
+
+func (o outlet) verify() error {
+	if !o.Enabled {
+		return nil
+	}
+	if o.Interval < 0 {
+		return &errval{s: "publish interval " + strconv.Itoa(o.Interval) + " cannot be less than zero"}
+	}
+	if len(o.Bucket) == 0 {
+		return &errval{s: "the publish bucket is required"}
+	}
+	if _, err := bucket(o.Bucket, o.Region); err != nil {
+		return &errval{s: "invalid publish bucket", e: err}
+	}
+	if len(keystore{Region: o.Region}.region()) == 0 {
+		return &errval{s: "the publish bucket region is required"}
+	}
+	return nil
+}
+func newPublisher(o outlet, c *http.Client, l *journal) *publisher {
+	if o.Interval == 0 {
+		o.Interval = publishDefault
+	}
+	p := &publisher{log: l, client: c, sums: make(map[string]uint64), outlet: o}
+	p.base, _ = bucket(o.Bucket, o.Region)
+	if !strings.HasSuffix(p.base.Path, "/") {
+		p.base.Path += "/"
+	}
+	return p
+}
+
+// watch keeps the active Games subscribed, so the current Game has standings to upload
+// when no displays are connected. The standings are read when they are uploaded.
+func (p *publisher) watch(_ game.Snapshot) {}
+
+// publish uploads the files when started and then every interval, until the context
+// is cancelled.
+func (s *Scoreboard) publish(x context.Context) {
+	t := time.NewTicker(time.Duration(s.courier.Interval) * time.Second)
+	defer t.Stop()
+	for s.distribute(x); ; {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+			s.distribute(x)
+		}
+	}
+}
+
+// distribute uploads the files of the current Game to the root of the bucket and the
+// files of each named Game under its route. In a cluster, only the leader uploads.
+func (s *Scoreboard) distribute(x context.Context) {
+	if !s.leading() {
+		return
+	}
+	var o []parcel
+	if g := current(s.Manager); g > 0 {
+		o = s.parcels(o, "", "game="+strconv.FormatUint(g, 10))
+	}
+	s.swap.RLock()
+	r := make([]string, 0, len(s.routes))
+	for k := range s.routes {
+		r = append(r, k)
+	}
+	s.swap.RUnlock()
+	sort.Strings(r)
+	for _, k := range r {
+		o = s.parcels(o, k+"/", "name="+url.QueryEscape(k))
+	}
+	var (
+		c = "public, max-age=" + strconv.Itoa(s.courier.Interval)
+		n int
+	)
+	for _, v := range o {
+		if x.Err() != nil {
+			return
+		}
+		// The handlers are called the same as a public request, so the files have the
+		// standings shown on the display and hidden team names stay hidden.
+		q, _ := http.NewRequestWithContext(x, http.MethodGet, v.path, nil)
+		w := &buffer{h: make(http.Header)}
+		if v.h(w, q); w.code != 0 && w.code != http.StatusOK {
+			s.courier.log.Debug(`Not publishing "%s", it returned status %d.`, v.name, w.code)
+			continue
+		}
+		// Files that have not changed since they were last uploaded are skipped.
+		f := fnv.New64a()
+		f.Write(w.Bytes())
+		h := f.Sum64()
+		if s.courier.sums[v.name] == h {
+			continue
+		}
+		u := s.courier.base.ResolveReference(&url.URL{Path: v.name})
+		if err := upload(x, s.courier.client, u, s.courier.Region, w.Bytes(), w.h.Get("Content-Type"), c); err != nil {
+			s.courier.log.Error(`Unable to publish "%s" to "%s": %s!`, v.name, s.courier.Bucket, err.Error())
+			continue
+		}
+		s.courier.sums[v.name] = h
+		n++
+	}
+	if n > 0 {
+		s.courier.log.Debug("Published %d changed files to the bucket.", n)
+	}
+}
+
+// parcels appends the files of the Game selected by the query to the list, named with
+// the prefix.
+func (s *Scoreboard) parcels(o []parcel, prefix, query string) []parcel {
+	o = append(o,
+		parcel{name: prefix + "standings.json", path: "/api/v1/standings?" + query, h: s.httpStandings},
+		parcel{name: prefix + "snapshot.png", path: "/api/v1/snapshot.png?" + query, h: s.httpSnapshot},
+		parcel{name: prefix + "standings.csv", path: "/api/v1/export/standings.csv?" + query, h: s.httpExportStandings},
+	)
+	if s.store != nil {
+		o = append(o, parcel{name: prefix + "events.json", path: "/api/v1/export/events.json?" + query, h: s.httpExportEvents})
+	}
+	return o
+}
@@ -0,0 +1,496 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// QR codes are encoded in byte mode with the medium (M) error correction level, which
+// can hold URLs up to 213 bytes in the largest supported version (10).
+const (
+	qrQuiet = 4
+	qrScale = 8
+)
+
+// qrBlocks is the error correction codewords per block and the data codewords of each
+// block for versions 1 to 10 at error correction level M.
+var qrBlocks = [...]struct {
+	ec   int
+	data []int
+}{
+	{10, []int{16}},
+	{16, []int{28}},
+	{26, []int{44}},
+	{18, []int{32, 32}},
+	{24, []int{43, 43}},
+	{16, []int{27, 27, 27, 27}},
+	{18, []int{31, 31, 31, 31}},
+	{22, []int{38, 38, 39, 39}},
+	{22, []int{36, 36, 36, 37, 37}},
+	{26, []int{43, 43, 43, 43, 44}},
+}
+
+type qrcode struct {
+	URL    string `json:"url,omitempty"`
+	Widget bool   `json:"widget"`
+}
+type symbol struct {
+	mods  [][]bool
+	fixed [][]bool
+	size  int
+}
+
+func (q qrcode) verify() error {
+	if len(q.URL) == 0 {
+		return nil
+	}
+	u, err := url.Parse(q.URL)
+	if err != nil {
+		return &errval{s: `qr URL "` + q.URL + `" is not valid`, e: err}
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return &errval{s: `qr URL "` + q.URL + `" must be an absolute http or https URL`}
+	}
+	return nil
+}
+
+// gfMul multiplies two elements of the QR code Galois field GF(2^8).
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// correction returns the Reed-Solomon error correction codewords of the data block.
+func correction(d []byte, n int) []byte {
+	g := make([]byte, n)
+	g[n-1] = 1
+	for i, r := 0, byte(1); i < n; i++ {
+		for j := 0; j < n; j++ {
+			if g[j] = gfMul(g[j], r); j+1 < n {
+				g[j] ^= g[j+1]
+			}
+		}
+		r = gfMul(r, 2)
+	}
+	o := make([]byte, n)
+	for _, b := range d {
+		f := b ^ o[0]
+		copy(o, o[1:])
+		o[n-1] = 0
+		for i := range o {
+			o[i] ^= gfMul(g[i], f)
+		}
+	}
+	return o
+}
+
+// codewords returns the data and error correction codewords of the string, interleaved
+// in the order they are placed, and the smallest version that can hold it.
+func codewords(s string) ([]byte, int, bool) {
+	v, c := 0, 0
+	for ; v < len(qrBlocks); v++ {
+		c = 0
+		for _, n := range qrBlocks[v].data {
+			c += n
+		}
+		h := 12
+		if v >= 9 {
+			h += 8
+		}
+		if (c*8-h)/8 >= len(s) {
+			break
+		}
+	}
+	if v == len(qrBlocks) {
+		return nil, 0, false
+	}
+	var (
+		b = make([]byte, 0, c)
+		a uint32
+		n uint
+	)
+	push := func(x uint32, k uint) {
+		for a, n = a<<k|x, n+k; n >= 8; n -= 8 {
+			b = append(b, byte(a>>(n-8)))
+		}
+		a &= 1<<n - 1
+	}
+	if push(4, 4); v >= 9 {
+		push(uint32(len(s)), 16)
+	} else {
+		push(uint32(len(s)), 8)
+	}
+	for i := 0; i < len(s); i++ {
+		push(uint32(s[i]), 8)
+	}
+	if r := c*8 - len(b)*8 - int(n); r >= 4 {
+		push(0, 4)
+	} else if r > 0 {
+		push(0, uint(r))
+	}
+	if n > 0 {
+		push(0, 8-n)
+	}
+	for p := byte(0xEC); len(b) < c; p ^= 0xEC ^ 0x11 {
+		b = append(b, p)
+	}
+	var (
+		k = qrBlocks[v]
+		d = make([][]byte, len(k.data))
+		e = make([][]byte, len(k.data))
+		o = make([]byte, 0, c+k.ec*len(k.data))
+	)
+	for i, x := 0, 0; i < len(k.data); i++ {
+		d[i], e[i] = b[x:x+k.data[i]], correction(b[x:x+k.data[i]], k.ec)
+		x += k.data[i]
+	}
+	for i := 0; i < k.data[len(k.data)-1]; i++ {
+		for j := range d {
+			if i < len(d[j]) {
+				o = append(o, d[j][i])
+			}
+		}
+	}
+	for i := 0; i < k.ec; i++ {
+		for j := range e {
+			o = append(o, e[j][i])
+		}
+	}
+	return o, v + 1, true
+}
+func (q *symbol) set(x, y int, v bool) {
+	q.mods[y][x], q.fixed[y][x] = v, true
+}
+
+// functions draws the finder, timing and alignment patterns and reserves the format
+// and version areas.
+func (q *symbol) functions(v int) {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [3][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || y < 0 || x >= q.size || y >= q.size {
+					continue
+				}
+				d := abs(dx)
+				if abs(dy) > d {
+					d = abs(dy)
+				}
+				q.set(x, y, d != 2 && d != 4)
+			}
+		}
+	}
+	if v > 1 {
+		var (
+			n = v/7 + 2
+			s = (v*8 + n*3 + 5) / (n*4 - 4) * 2
+			p = make([]int, n)
+		)
+		p[0] = 6
+		for i, x := n-1, q.size-7; i > 0; i, x = i-1, x-s {
+			p[i] = x
+		}
+		for i := range p {
+			for j := range p {
+				if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+					continue
+				}
+				for dy := -2; dy <= 2; dy++ {
+					for dx := -2; dx <= 2; dx++ {
+						d := abs(dx)
+						if abs(dy) > d {
+							d = abs(dy)
+						}
+						q.set(p[i]+dx, p[j]+dy, d != 1)
+					}
+				}
+			}
+		}
+	}
+	q.format(0)
+	if v < 7 {
+		return
+	}
+	r := v
+	for i := 0; i < 12; i++ {
+		r = (r << 1) ^ ((r >> 11) * 0x1F25)
+	}
+	b := v<<12 | r
+	for i := 0; i < 18; i++ {
+		x, y := q.size-11+i%3, i/3
+		q.set(x, y, (b>>uint(i))&1 != 0)
+		q.set(y, x, (b>>uint(i))&1 != 0)
+	}
+}
+
+// format draws both copies of the format information for the mask, with the error
+// correction level M.
+func (q *symbol) format(m int) {
+	r := m
+	for i := 0; i < 10; i++ {
+		r = (r << 1) ^ ((r >> 9) * 0x537)
+	}
+	b := (m<<10 | r) ^ 0x5412
+	bit := func(i int) bool { return (b>>uint(i))&1 != 0 }
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// place fills the data modules with the codewords, in the two module wide columns
+// that zig-zag up and down from the bottom right corner.
+func (q *symbol) place(b []byte) {
+	for i, r := 0, q.size-1; r >= 1; r -= 2 {
+		if r == 6 {
+			r = 5
+		}
+		for v := 0; v < q.size; v++ {
+			for j := 0; j < 2; j++ {
+				x, y := r-j, v
+				if (r+1)&2 == 0 {
+					y = q.size - 1 - v
+				}
+				if q.fixed[y][x] || i >= len(b)*8 {
+					continue
+				}
+				q.mods[y][x] = (b[i>>3]>>uint(7-(i&7)))&1 != 0
+				i++
+			}
+		}
+	}
+}
+func masked(m, x, y int) bool {
+	switch m {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	}
+	return ((x+y)%2+x*y%3)%2 == 0
+}
+func (q *symbol) mask(m int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.fixed[y][x] && masked(m, x, y) {
+				q.mods[y][x] = !q.mods[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four rules used to select the mask, runs of the
+// same color, 2x2 blocks, patterns that look like a finder and the dark module ratio.
+func (q *symbol) penalty() int {
+	var p, d int
+	at := func(x, y int, t bool) bool {
+		if t {
+			return q.mods[x][y]
+		}
+		return q.mods[y][x]
+	}
+	for _, t := range [2]bool{false, true} {
+		for y := 0; y < q.size; y++ {
+			var (
+				n int
+				w uint
+			)
+			for x := 0; x < q.size; x++ {
+				c := at(x, y, t)
+				if x > 0 && c == at(x-1, y, t) {
+					if n++; n == 5 {
+						p += 3
+					} else if n > 5 {
+						p++
+					}
+				} else {
+					n = 1
+				}
+				if w = (w << 1) & 0x7FF; c {
+					w |= 1
+				}
+				if x >= 10 && (w == 0x5D0 || w == 0x05D) {
+					p += 40
+				}
+			}
+		}
+	}
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			c := q.mods[y][x]
+			if c {
+				d++
+			}
+			if x > 0 && y > 0 && c == q.mods[y][x-1] && c == q.mods[y-1][x] && c == q.mods[y-1][x-1] {
+				p += 3
+			}
+		}
+	}
+	t := q.size * q.size
+	return p + (abs(d*20-t*10)+t-1)/t*10 - 10
+}
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// qrEncode returns the modules of the QR code for the string, using the mask with the
+// lowest penalty.
+func qrEncode(s string) (*symbol, bool) {
+	b, v, ok := codewords(s)
+	if !ok {
+		return nil, false
+	}
+	q := &symbol{size: v*4 + 17}
+	q.mods, q.fixed = make([][]bool, q.size), make([][]bool, q.size)
+	for i := range q.mods {
+		q.mods[i], q.fixed[i] = make([]bool, q.size), make([]bool, q.size)
+	}
+	q.functions(v)
+	q.place(b)
+	m, p := 0, -1
+	for i := 0; i < 8; i++ {
+		q.mask(i)
+		q.format(i)
+		if n := q.penalty(); p < 0 || n < p {
+			m, p = i, n
+		}
+		q.mask(i)
+	}
+	q.mask(m)
+	q.format(m)
+	return q, true
+}
+
+// image draws the QR code with each module as a square of z pixels, surrounded by the
+// quiet zone.
+func (q *symbol) image(z int) *image.Paletted {
+	var (
+		n = (q.size + qrQuiet*2) * z
+		i = image.NewPaletted(image.Rect(0, 0, n, n), color.Palette{color.White, color.Black})
+	)
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.mods[y][x] {
+				continue
+			}
+			for j := 0; j < z; j++ {
+				o := i.PixOffset((x+qrQuiet)*z, (y+qrQuiet)*z+j)
+				for k := 0; k < z; k++ {
+					i.Pix[o+k] = 1
+				}
+			}
+		}
+	}
+	return i
+}
+
+// public returns the public URL of the scoreboard page of the request. The configured
+// URL is used if set, otherwise the URL is built from the Host header of the request and
+// if TLS is enabled. The path prefix of a tenant is added to either.
+func (s *Scoreboard) public(r *http.Request) string {
+	s.swap.RLock()
+	b := strings.TrimSuffix(s.qr.URL, "/")
+	s.swap.RUnlock()
+	if len(b) == 0 {
+		if b = "http://" + r.Host; len(s.cert) > 0 && len(s.key) > 0 {
+			b = "https://" + r.Host
+		}
+	}
+	b += s.prefix
+	q := r.URL.Query()
+	if n := q.Get("name"); len(n) > 0 {
+		return b + "/game/" + url.PathEscape(strings.ToLower(n))
+	}
+	if g, err := strconv.ParseUint(q.Get("game"), 10, 64); err == nil && g > 0 {
+		return b + "/game/" + strconv.FormatUint(g, 10)
+	}
+	return b + "/"
+}
+
+// httpQR returns a PNG image of a QR code that links to the public scoreboard, so it
+// can be shown on the projector for people to open the scoreboard on their phones. The
+// "game" or "name" values link to the scoreboard of that Game instead of the home page.
+func (s *Scoreboard) httpQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	z := qrScale
+	if v := r.URL.Query().Get("scale"); len(v) > 0 {
+		var err error
+		if z, err = strconv.Atoi(v); err != nil || z < 1 || z > 32 {
+			http.Error(w, "scale must be between 1 and 32", http.StatusBadRequest)
+			return
+		}
+	}
+	if n := r.URL.Query().Get("name"); len(n) > 0 && s.arena(n) == nil {
+		http.Error(w, `game "`+n+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	u := s.public(r)
+	q, ok := qrEncode(u)
+	if !ok {
+		http.Error(w, "the scoreboard URL is too long for a QR code", http.StatusInternalServerError)
+		s.web.request(r).Error(`Unable to create a QR code for "%s": URL is too long!`, u)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := png.Encode(w, q.image(z)); err != nil {
+		s.web.request(r).Error(`Error sending QR code to "%s": %s!`, r.RemoteAddr, err.Error())
+	}
+}
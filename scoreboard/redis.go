@@ -0,0 +1,252 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisLimit is the largest bulk reply that is read, which is larger than the saved
+// state of any Game.
+const redisLimit = 64 << 20
+
+// redis is a minimal client for the Redis commands used by the cluster. Commands are
+// sent one at a time on a single connection, which is opened again after any error.
+type redis struct {
+	url     *url.URL
+	conn    net.Conn
+	read    *bufio.Reader
+	user    string
+	pass    string
+	db      string
+	timeout time.Duration
+	lock    sync.Mutex
+}
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis server returned an error: " + string(e)
+}
+func newRedis(s string, t time.Duration) (*redis, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, &errval{s: `redis server "` + s + `" is not valid`, e: err}
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, &errval{s: `redis server scheme "` + u.Scheme + `" is not supported`}
+	}
+	r := &redis{url: u, timeout: t}
+	if u.User != nil {
+		r.user = u.User.Username()
+		r.pass, _ = u.User.Password()
+	}
+	if p := strings.Trim(u.Path, "/"); len(p) > 0 {
+		if _, err := strconv.ParseUint(p, 10, 8); err != nil {
+			return nil, &errval{s: `redis database "` + p + `" is not valid`}
+		}
+		r.db = p
+	}
+	return r, nil
+}
+func (r *redis) close() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn, r.read = nil, nil
+	}
+}
+func (r *redis) String() string {
+	return r.url.Scheme + "://" + r.url.Host
+}
+func encode(a []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("*" + strconv.Itoa(len(a)) + "\r\n")
+	for i := range a {
+		b.WriteString("$" + strconv.Itoa(len(a[i])) + "\r\n")
+		b.WriteString(a[i])
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
+// dial opens a new connection to the Redis server and selects the database after
+// authenticating, if the URL has a password.
+func (r *redis) dial(x context.Context) (net.Conn, *bufio.Reader, error) {
+	h := r.url.Host
+	if len(r.url.Port()) == 0 {
+		h = net.JoinHostPort(r.url.Hostname(), "6379")
+	}
+	c, err := (&net.Dialer{Timeout: r.timeout}).DialContext(x, "tcp", h)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.url.Scheme == "rediss" {
+		t := tls.Client(c, &tls.Config{ServerName: r.url.Hostname()})
+		if err = t.HandshakeContext(x); err != nil {
+			c.Close()
+			return nil, nil, err
+		}
+		c = t
+	}
+	var (
+		b = bufio.NewReader(c)
+		v [][]string
+	)
+	switch {
+	case len(r.pass) > 0 && len(r.user) > 0:
+		v = append(v, []string{"AUTH", r.user, r.pass})
+	case len(r.pass) > 0:
+		v = append(v, []string{"AUTH", r.pass})
+	}
+	if len(r.db) > 0 {
+		v = append(v, []string{"SELECT", r.db})
+	}
+	c.SetDeadline(time.Now().Add(r.timeout))
+	for i := range v {
+		if _, err = c.Write(encode(v[i])); err == nil {
+			_, err = reply(b)
+		}
+		if err != nil {
+			c.Close()
+			return nil, nil, err
+		}
+	}
+	c.SetDeadline(time.Time{})
+	return c, b, nil
+}
+
+// do sends the command and returns the reply, which is a string, an int64, nil or a
+// slice of replies.
+func (r *redis) do(x context.Context, a ...string) (interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conn == nil {
+		var err error
+		if r.conn, r.read, err = r.dial(x); err != nil {
+			return nil, err
+		}
+	}
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := r.conn.Write(encode(a)); err != nil {
+		r.close()
+		return nil, err
+	}
+	v, err := reply(r.read)
+	if _, ok := err.(redisError); err != nil && !ok {
+		r.close()
+	}
+	return v, err
+}
+
+// subscribe calls the function with each message sent to the channel until the context
+// is done or the connection fails.
+func (r *redis) subscribe(x context.Context, n string, f func([]byte)) error {
+	c, b, err := r.dial(x)
+	if err != nil {
+		return err
+	}
+	d := make(chan struct{})
+	defer close(d)
+	go func() {
+		select {
+		case <-x.Done():
+		case <-d:
+		}
+		c.Close()
+	}()
+	c.SetDeadline(time.Now().Add(r.timeout))
+	if _, err = c.Write(encode([]string{"SUBSCRIBE", n})); err != nil {
+		return err
+	}
+	if _, err = reply(b); err != nil {
+		return err
+	}
+	c.SetDeadline(time.Time{})
+	for {
+		v, err := reply(b)
+		if err != nil {
+			if x.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		m, ok := v.([]interface{})
+		if !ok || len(m) != 3 {
+			continue
+		}
+		if k, _ := m[0].(string); k != "message" {
+			continue
+		}
+		if d, ok := m[2].(string); ok {
+			f([]byte(d))
+		}
+	}
+}
+func reply(b *bufio.Reader) (interface{}, error) {
+	l, err := b.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if l = strings.TrimRight(l, "\r\n"); len(l) == 0 {
+		return nil, &errval{s: "redis server sent an empty reply"}
+	}
+	switch l[0] {
+	case '+':
+		return l[1:], nil
+	case '-':
+		return nil, redisError(l[1:])
+	case ':':
+		return strconv.ParseInt(l[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(l[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if n > redisLimit {
+			return nil, &errval{s: "redis server reply of " + strconv.Itoa(n) + " bytes is too large"}
+		}
+		v := make([]byte, n+2)
+		if _, err = io.ReadFull(b, v); err != nil {
+			return nil, err
+		}
+		return string(v[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(l[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		v := make([]interface{}, n)
+		for i := range v {
+			if v[i], err = reply(b); err != nil {
+				if _, ok := err.(redisError); !ok {
+					return nil, err
+				}
+			}
+		}
+		return v, nil
+	}
+	return nil, &errval{s: "redis server sent an invalid reply"}
+}
@@ -0,0 +1,424 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const watchInterval = time.Second * 2
+
+// live is the list of config values that are applied without a restart when the config
+// file is reloaded. Changes to any other values are reported as requiring a restart.
+var live = [...]string{
+	"log.level",
+	"log.format",
+	"tick",
+	"retry",
+	"workers",
+	"milestone",
+	"freeze",
+	"divisions",
+	"handles",
+	"positions",
+	"teams",
+	"sort",
+	"clock",
+	"lobby",
+	"profiles",
+	"themes",
+	"sponsors",
+	"effects",
+	"pacing",
+	"twitter.filter.only_users",
+	"twitter.filter.blocked_users",
+	"twitter.filter.banned_words",
+	"twitter.filter.detect",
+	"twitter.auth",
+	"qr",
+	"memory.tweets",
+	"memory.events",
+	"memory.assets",
+	"memory.teams",
+	"locale",
+	"timezone",
+}
+
+type reload struct {
+	Time    time.Time `json:"time"`
+	File    string    `json:"file"`
+	Applied []string  `json:"applied"`
+	Restart []string  `json:"restart"`
+}
+
+func nested(n string) bool {
+	for i := range live {
+		if strings.HasPrefix(live[i], n+".") {
+			return true
+		}
+	}
+	return false
+}
+func changeable(n string) bool {
+	for i := range live {
+		if live[i] == n {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the config file, if any, on top of the supplied JSON config, which contains
+// the values set on the command line, and then sets any environment variable and command
+// line overrides.
+func load(b []byte, f string, o []string) (config, error) {
+	var c config
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &c); err != nil {
+			return c, &errval{s: "cannot parse the command line config", e: err}
+		}
+	}
+	if len(f) > 0 {
+		d, err := os.ReadFile(f)
+		if err != nil {
+			return c, &errval{s: `cannot read file "` + f + `"`, e: err}
+		}
+		if err = decode(f, d, &c); err != nil {
+			return c, err
+		}
+	}
+	v, err := overrides(o)
+	if err != nil {
+		return c, err
+	}
+	if err = override(&c, v); err != nil {
+		return c, err
+	}
+	return c, resolve(context.Background(), &c)
+}
+
+func (c config) copy() config {
+	var v config
+	b, _ := json.Marshal(c)
+	json.Unmarshal(b, &v)
+	return v
+}
+
+// changes returns the names of the config values that are different, using the JSON
+// names of each value joined with a dot. Structs are only compared by their fields if
+// they contain any live values.
+func changes(p string, a, b reflect.Value) []string {
+	var r []string
+	for i := 0; i < a.NumField(); i++ {
+		n := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+		if len(n) == 0 || n == "-" {
+			continue
+		}
+		if len(p) > 0 {
+			n = p + "." + n
+		}
+		if a.Field(i).Kind() == reflect.Struct && nested(n) {
+			r = append(r, changes(n, a.Field(i), b.Field(i))...)
+			continue
+		}
+		x, _ := json.Marshal(a.Field(i).Interface())
+		if y, _ := json.Marshal(b.Field(i).Interface()); !bytes.Equal(x, y) {
+			r = append(r, n)
+		}
+	}
+	return r
+}
+func (s *Scoreboard) watch(x context.Context) {
+	i, err := os.Stat(s.file)
+	if err != nil {
+		s.log.Error(`Cannot watch config file "%s": %s!`, s.file, err.Error())
+		return
+	}
+	t := time.NewTicker(watchInterval)
+	for m := i.ModTime(); ; {
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if i, err = os.Stat(s.file); err != nil || i.ModTime().Equal(m) {
+			continue
+		}
+		m = i.ModTime()
+		s.log.Info(`Config file "%s" was changed, reloading..`, s.file)
+		s.reload()
+	}
+}
+
+// reload reads the config file again and applies any changed values that do not
+// require a restart. The config is not changed if the new config is not valid.
+func (s *Scoreboard) reload() (reload, error) {
+	s.cfg.Lock()
+	defer s.cfg.Unlock()
+	r := reload{Time: time.Now().UTC(), File: s.file, Applied: []string{}, Restart: []string{}}
+	n, err := load(s.base, s.file, s.sets)
+	if err != nil {
+		s.log.Error("Cannot reload the config: %s!", err.Error())
+		return r, err
+	}
+	// verify fills in default values, so the changes are found using the config as
+	// it was read and the verified copy is applied.
+	v := n.copy()
+	if err = v.verify(); err != nil {
+		s.log.Error("Cannot reload the config: %s!", err.Error())
+		return r, err
+	}
+	if err = s.apply(&v, changes("", reflect.ValueOf(s.conf), reflect.ValueOf(n)), &r); err != nil {
+		s.log.Error("Cannot reload the config: %s!", err.Error())
+		return r, err
+	}
+	if s.conf = n; len(r.Applied) > 0 || len(r.Restart) > 0 {
+		s.revise("reload", 0)
+	}
+	if len(r.Applied) > 0 {
+		s.log.Info("Config reloaded, applied changes to %s.", strings.Join(r.Applied, ", "))
+	}
+	if len(r.Restart) > 0 {
+		s.log.Warning("Config reloaded, the changes to %s require a restart to take effect!", strings.Join(r.Restart, ", "))
+	}
+	if len(r.Applied) == 0 && len(r.Restart) == 0 {
+		s.log.Info("Config reloaded, no changes were found.")
+	}
+	return r, nil
+}
+func (s *Scoreboard) apply(c *config, k []string, r *reload) error {
+	for _, n := range k {
+		if !changeable(n) || (n == "twitter.auth" && s.rotate == nil) {
+			r.Restart = append(r.Restart, n)
+			continue
+		}
+		// The sort policy, locale and time zone are the only values that can fail to apply,
+		// so they are checked before anything else is changed to not leave the config half
+		// applied.
+		if n == "locale" && s.locales[strings.ToLower(c.Locale)] == nil {
+			return &errval{s: `locale "` + c.Locale + `" does not have a message catalog`}
+		}
+		if n == "timezone" {
+			if _, err := zone(c.Timezone); err != nil {
+				return err
+			}
+		}
+		if n == "sort" {
+			if err := s.Order(c.Sort.Keys, c.Sort.Ties == "split"); err != nil {
+				return &errval{s: "unable to set the sort policy", e: err}
+			}
+			for i := range c.Games {
+				if c.Games[i].Sort != nil {
+					continue
+				}
+				if m := s.games[c.Games[i].Name]; m != nil {
+					m.Order(c.Sort.Keys, c.Sort.Ties == "split")
+				}
+			}
+		}
+	}
+	// New Twitter credentials are verified by connecting with them, which can also fail,
+	// so the stream is rotated before the remaining values are changed.
+	var t []game.Entrant
+	for _, n := range k {
+		if n == "twitter.auth" && s.rotate != nil {
+			if err := s.Rotate(&c.Twitter.Credentials); err != nil {
+				return &errval{s: "unable to rotate the Twitter credentials", e: err}
+			}
+		}
+		if n == "teams" && len(c.Teams) > 0 {
+			var err error
+			if t, err = entrants(c.Teams); err != nil {
+				return err
+			}
+		}
+	}
+	for _, n := range k {
+		if !changeable(n) || (n == "twitter.auth" && s.rotate == nil) {
+			continue
+		}
+		switch r.Applied = append(r.Applied, n); n {
+		case "log.level":
+			s.log.SetLevel(logx.Level(c.Log.Level))
+		case "log.format":
+			s.log.format(c.Log.Format)
+		case "tick":
+			s.Interval(time.Duration(c.Source.interval(c.Tick)) * time.Second)
+			for i := range c.Games {
+				if m := s.games[c.Games[i].Name]; m != nil {
+					m.Interval(time.Duration(c.Games[i].Source.interval(c.Games[i].Tick)) * time.Second)
+				}
+			}
+		case "freeze":
+			if len(c.Freeze) == 0 {
+				if err := s.Unfreeze(0, 0); err != nil {
+					s.log.Warning("Cannot unfreeze the display after the config reload: %s!", err.Error())
+				}
+				break
+			}
+			v, _ := time.Parse(time.RFC3339, c.Freeze)
+			s.Freeze(0, v)
+		case "clock":
+			b, e := c.Clock.times()
+			s.Clock(0, b, e)
+			s.Warnings(c.Clock.warnings())
+			s.Breaks(c.Clock.breaks())
+			s.Adapt(c.Clock.pacing())
+			for _, m := range s.games {
+				m.Warnings(c.Clock.warnings())
+				m.Breaks(c.Clock.breaks())
+				m.Adapt(c.Clock.pacing())
+			}
+		case "retry":
+			d := time.Duration(c.Retry.Cooldown) * time.Second
+			s.Breaker(c.Retry.Attempts, c.Retry.Threshold, d)
+			for _, m := range s.games {
+				m.Breaker(c.Retry.Attempts, c.Retry.Threshold, d)
+			}
+		case "workers":
+			s.Workers(c.Workers)
+			for _, m := range s.games {
+				m.Workers(c.Workers)
+			}
+		case "milestone":
+			s.Milestone(c.milestone())
+			for _, m := range s.games {
+				m.Milestone(c.milestone())
+			}
+		case "memory.tweets", "memory.events":
+			s.Limit(c.Memory.Tweets, c.Memory.Events)
+			for _, m := range s.games {
+				m.Limit(c.Memory.Tweets, c.Memory.Events)
+			}
+		case "memory.teams":
+			s.TeamLimit(c.Memory.Teams)
+			for _, m := range s.games {
+				m.TeamLimit(c.Memory.Teams)
+			}
+		case "memory.assets":
+			s.static.lock.Lock()
+			s.static.limit = int64(c.Memory.Assets) << 20
+			s.static.evict("")
+			s.static.lock.Unlock()
+		case "divisions":
+			s.Divisions(c.Divisions)
+			for _, m := range s.games {
+				m.Divisions(c.Divisions)
+			}
+		case "effects":
+			s.Effects(c.Effects.kinds())
+			for _, m := range s.games {
+				m.Effects(c.Effects.kinds())
+			}
+		case "pacing":
+			s.Pacing(c.Pacing.Rate, c.Pacing.Collapse)
+			for _, m := range s.games {
+				m.Pacing(c.Pacing.Rate, c.Pacing.Collapse)
+			}
+		case "twitter.filter.only_users":
+			s.swap.Lock()
+			s.filter.OnlyUsers = c.Twitter.Filter.OnlyUsers
+			s.swap.Unlock()
+		case "twitter.filter.blocked_users":
+			s.swap.Lock()
+			s.filter.BlockedUsers = c.Twitter.Filter.BlockedUsers
+			s.swap.Unlock()
+		case "twitter.filter.banned_words":
+			s.swap.Lock()
+			s.filter.BlockedWords = c.Twitter.Filter.BlockedWords
+			s.swap.Unlock()
+		case "twitter.filter.detect":
+			s.swap.Lock()
+			s.filter.Detect = c.Twitter.Filter.Detect
+			s.swap.Unlock()
+		case "qr":
+			s.swap.Lock()
+			s.qr = c.QR
+			s.swap.Unlock()
+		case "handles":
+			s.swap.Lock()
+			s.handles = c.Handles
+			s.swap.Unlock()
+		case "positions":
+			s.swap.Lock()
+			s.places = c.Positions
+			s.swap.Unlock()
+		case "teams":
+			s.swap.Lock()
+			s.enlisted = c.Teams
+			s.swap.Unlock()
+			s.enter(t)
+		case "lobby":
+			s.swap.Lock()
+			s.lobby = c.Lobby
+			s.swap.Unlock()
+		case "profiles":
+			s.swap.Lock()
+			s.profiles = c.Profiles
+			s.swap.Unlock()
+		case "themes":
+			s.swap.Lock()
+			s.themes = c.Themes
+			s.swap.Unlock()
+			s.tint()
+		case "sponsors":
+			s.swap.Lock()
+			s.sponsors = c.Sponsors
+			s.swap.Unlock()
+		case "locale":
+			s.swap.Lock()
+			s.locale = strings.ToLower(c.Locale)
+			s.swap.Unlock()
+		case "timezone":
+			l, _ := zone(c.Timezone)
+			s.swap.Lock()
+			s.zone = l
+			s.swap.Unlock()
+		}
+	}
+	return nil
+}
+func (s *Scoreboard) httpReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if len(s.file) == 0 {
+		fail(w, "the scoreboard was not started with a config file", http.StatusConflict)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" requested a config reload.`, r.RemoteAddr)
+	v, err := s.reload()
+	if err != nil {
+		fail(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,115 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// renderMax is the most rendered pages that are kept. The cache is cleared once it is
+// full, as the keys include values from the requests.
+const renderMax = 256
+
+type renders struct {
+	pages map[string][]byte
+	lock  sync.RWMutex
+}
+
+// key returns the render cache key of the page, which includes every value that
+// changes the rendered page.
+func (d *display) key() string {
+	b := []byte(strconv.FormatUint(d.Game, 10) + "|" + strconv.FormatUint(d.Team, 10) + "|" + d.Route + "|" + d.Lang + "|" + d.Zone + "|" + d.Sponsors + "|" + d.Theme + "|")
+	for _, v := range [...]bool{d.Twitter, d.History, d.QR, d.Access, d.Pinned} {
+		if v {
+			b = append(b, '1')
+		} else {
+			b = append(b, '0')
+		}
+	}
+	return string(append(b, "|"+d.Lobby.stamp()+"|"+d.Layout.stamp()...))
+}
+
+// render writes the template with the data to the response. Each page is rendered
+// once and then sent from the cache, until the key or the version of the asset files
+// changes, so the key must include every value that changes the rendered page. The
+// nonce of the request is added to the cached page when it is sent.
+func (s *Scoreboard) render(w http.ResponseWriter, r *http.Request, n, k string, d interface{}) error {
+	k = n + "|" + strconv.FormatUint(atomic.LoadUint64(&s.static.version), 10) + "|" + k
+	s.pages.lock.RLock()
+	b, ok := s.pages.pages[k]
+	s.pages.lock.RUnlock()
+	if !ok {
+		var o bytes.Buffer
+		if err := s.html.ExecuteTemplate(&o, n, d); err != nil {
+			return err
+		}
+		b = o.Bytes()
+		s.pages.lock.Lock()
+		if s.pages.pages == nil || len(s.pages.pages) >= renderMax {
+			s.pages.pages = make(map[string][]byte, renderMax)
+		}
+		s.pages.pages[k] = b
+		s.pages.lock.Unlock()
+	}
+	b = bytes.ReplaceAll(b, []byte(nonceMark), []byte(nonce(r)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+	return nil
+}
+
+// precompile renders every template once with example data when the Scoreboard is
+// created, so errors in templates, including ones in the override directory, stop the
+// Scoreboard from starting instead of failing the first requests.
+func (s *Scoreboard) precompile() error {
+	d := &display{Game: 1, Lang: s.locale, Zone: s.zone.String(), Text: s.locales[s.locale], Lobby: &lobby{Slides: []slide{{Title: "Rules"}}}, Sponsors: "top"}
+	if err := s.html.ExecuteTemplate(io.Discard, "home.html", s.Games); err != nil {
+		return &errval{s: "unable to render home template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "scoreboard.html", d); err != nil {
+		return &errval{s: "unable to render scoreboard template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "mobile.html", d); err != nil {
+		return &errval{s: "unable to render mobile template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "podium.html", d); err != nil {
+		return &errval{s: "unable to render podium template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "team.html", d); err != nil {
+		return &errval{s: "unable to render team template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "attacks.html", d); err != nil {
+		return &errval{s: "unable to render attack map template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "admin.html", console{Games: []string{"example"}, Twitter: true}); err != nil {
+		return &errval{s: "unable to render admin template", e: err}
+	}
+	if err := s.html.ExecuteTemplate(io.Discard, "presenter.html", presenter{Views: []string{"overview", "/podium"}}); err != nil {
+		return &errval{s: "unable to render presenter template", e: err}
+	}
+	v := game.Snapshot{Game: "Example", Teams: []game.Standing{{Name: "Alpha", Division: "Open", ID: 1, Rank: 1}}}
+	if err := s.html.ExecuteTemplate(io.Discard, "static.html", still{display: d, Standings: v, Refresh: backupDefault}); err != nil {
+		return &errval{s: "unable to render static board template", e: err}
+	}
+	return nil
+}
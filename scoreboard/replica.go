@@ -0,0 +1,199 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/gorilla/websocket"
+)
+
+const replicaRetry = time.Second * 5
+
+// replicaLimit is the largest state message that a replica reads from its primary.
+const replicaLimit = 64 << 20
+
+type mirroring struct {
+	Primary string `json:"primary,omitempty"`
+	Token   string `json:"token"`
+}
+
+// replica receives the state of a Game Manager from the primary Scoreboard over a
+// WebSocket, so the replica can serve its own clients without polling the sources.
+type replica struct {
+	log    logx.Log
+	game   *game.Manager
+	dialer *websocket.Dialer
+	header http.Header
+	url    string
+}
+
+func (r mirroring) verify() error {
+	if len(r.Primary) == 0 {
+		return nil
+	}
+	if len(r.Token) == 0 {
+		return &errval{s: "replication token is required to connect to a primary"}
+	}
+	if _, err := upstream(r.Primary, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+// standby is the Leader function of the replica Managers, which never poll a Source.
+func standby() bool {
+	return false
+}
+
+// upstream returns the WebSocket URL of the replication endpoint of the primary for the
+// named game, or the main Game if the name is empty.
+func upstream(s, n string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", &errval{s: `primary URL "` + s + `" is not valid`, e: err}
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", &errval{s: `primary URL scheme "` + u.Scheme + `" is not supported`}
+	}
+	if len(u.Host) == 0 {
+		return "", &errval{s: `primary URL "` + s + `" is missing a host`}
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1/replicate"
+	if u.RawQuery = ""; len(n) > 0 {
+		u.RawQuery = "game=" + url.QueryEscape(n)
+	}
+	return u.String(), nil
+}
+func newReplica(c mirroring, n string, m *game.Manager, p func(*http.Request) (*url.URL, error), t time.Duration, l logx.Log) (*replica, error) {
+	u, err := upstream(c.Primary, n)
+	if err != nil {
+		return nil, err
+	}
+	m.Leader(standby)
+	return &replica{
+		log:  l,
+		url:  u,
+		game: m,
+		dialer: &websocket.Dialer{
+			Proxy:             p,
+			HandshakeTimeout:  t,
+			EnableCompression: true,
+		},
+		header: http.Header{"Authorization": []string{"Bearer " + c.Token}},
+	}, nil
+}
+func (r *replica) start(x context.Context) {
+	for {
+		if err := r.pull(x); err != nil && x.Err() == nil {
+			r.log.Warning(`Replication from "%s" failed, retrying in %s: %s!`, r.url, replicaRetry.String(), err.Error())
+			r.game.Status("primary", time.Now())
+		}
+		t := time.NewTimer(replicaRetry)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// pull connects to the primary and applies each state it sends until the connection
+// is closed.
+func (r *replica) pull(x context.Context) error {
+	c, _, err := r.dialer.DialContext(x, r.url, r.header)
+	if err != nil {
+		return err
+	}
+	d := make(chan struct{})
+	defer close(d)
+	go func() {
+		select {
+		case <-x.Done():
+		case <-d:
+		}
+		c.Close()
+	}()
+	c.SetReadLimit(replicaLimit)
+	r.log.Info(`Connected to primary "%s".`, r.url)
+	r.game.Status("primary", time.Time{})
+	for {
+		t, b, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if t != websocket.BinaryMessage {
+			continue
+		}
+		if err = r.game.Apply(b); err != nil {
+			r.log.Error(`Received an invalid state from primary "%s": %s!`, r.url, err.Error())
+		}
+	}
+}
+
+// replicate adds a replica for the main Game and each extra game, which receive their
+// Games from the same games of the primary.
+func (s *Scoreboard) replicate(c *config, t time.Duration) error {
+	r, err := newReplica(c.Replicate, "", s.Manager, s.proxy, t, s.log.with("replica"))
+	if err != nil {
+		return err
+	}
+	s.replica = append(s.replica, r)
+	for i := range c.Games {
+		if r, err = newReplica(c.Replicate, c.Games[i].Name, s.games[c.Games[i].Name], s.proxy, t, s.log.with("replica."+c.Games[i].Name)); err != nil {
+			return err
+		}
+		s.replica = append(s.replica, r)
+	}
+	s.log.Info(`Replicating %d games from primary "%s".`, len(s.replica), c.Replicate.Primary)
+	return nil
+}
+func (s *Scoreboard) httpReplicate(w http.ResponseWriter, r *http.Request) {
+	if v := r.Header.Get("Authorization"); !strings.HasPrefix(v, "Bearer ") || subtle.ConstantTimeCompare([]byte(v[7:]), []byte(s.mirror)) != 1 {
+		fail(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		s.log.request(r).Warning(`Rejected unauthorized replica "%s"!`, r.RemoteAddr)
+		return
+	}
+	m := s.Manager
+	if n := r.URL.Query().Get("game"); len(n) > 0 {
+		if m = s.games[strings.ToLower(n)]; m == nil {
+			fail(w, `game "`+n+`" does not exist`, http.StatusNotFound)
+			return
+		}
+	}
+	u := *s.ws
+	u.EnableCompression = true
+	c, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	m.Replica(c)
+	s.log.request(r).Info(`Replica "%s" connected to "%s".`, r.RemoteAddr, r.URL.RequestURI())
+}
@@ -0,0 +1,132 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rollupDefault  = 60
+	compactDefault = 300
+)
+
+// retention is the downsampling and retention of the history store. Score samples older
+// than "raw" seconds are rolled up, which keeps only the last sample of each team in
+// every "rollup" seconds, and scores and events older than "keep" seconds are removed.
+// Either is disabled when zero. Compaction runs every "interval" seconds.
+type retention struct {
+	Raw      int `json:"raw,omitempty"`
+	Keep     int `json:"keep,omitempty"`
+	Rollup   int `json:"rollup,omitempty"`
+	Interval int `json:"interval,omitempty"`
+}
+
+func (r retention) verify() error {
+	switch {
+	case r.Raw < 0:
+		return &errval{s: "history retention raw " + strconv.Itoa(r.Raw) + " cannot be less than zero"}
+	case r.Keep < 0:
+		return &errval{s: "history retention keep " + strconv.Itoa(r.Keep) + " cannot be less than zero"}
+	case r.Rollup < 0:
+		return &errval{s: "history retention rollup " + strconv.Itoa(r.Rollup) + " cannot be less than zero"}
+	case r.Interval < 0:
+		return &errval{s: "history retention interval " + strconv.Itoa(r.Interval) + " cannot be less than zero"}
+	case r.Keep > 0 && r.Keep < r.Raw:
+		return &errval{s: "history retention keep cannot be less than raw"}
+	}
+	return nil
+}
+func (r retention) enabled() bool {
+	return r.Raw > 0 || r.Keep > 0
+}
+
+// compact removes the history rows outside the retention policy when started and then
+// every interval, until the context is cancelled.
+func (h *history) compact(x context.Context) {
+	d := time.Duration(compactDefault) * time.Second
+	if h.keep.Interval > 0 {
+		d = time.Duration(h.keep.Interval) * time.Second
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for h.sweep(x); ; {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+			h.sweep(x)
+		}
+	}
+}
+func (h *history) sweep(x context.Context) {
+	var (
+		s = time.Now()
+		n int64
+	)
+	if h.keep.Raw > 0 {
+		b := int64(rollupDefault) * 1000
+		if h.keep.Rollup > 0 {
+			b = int64(h.keep.Rollup) * 1000
+		}
+		// Only the samples since the last compaction are checked, starting one rollup
+		// before it, as the older samples were already rolled up. The first compaction
+		// checks every sample, which includes any imported while the Scoreboard was
+		// stopped.
+		c := s.Add(-time.Duration(h.keep.Raw) * time.Second).UnixMilli()
+		r, err := h.db.ExecContext(x, h.rollup, c, h.rolled-b, b, b)
+		if err != nil {
+			h.log.Error("Unable to roll up history scores: %s!", err.Error())
+			return
+		}
+		v, _ := r.RowsAffected()
+		n, h.rolled = n+v, c
+	}
+	if h.keep.Keep > 0 {
+		c := s.Add(-time.Duration(h.keep.Keep) * time.Second).UnixMilli()
+		for _, q := range [...]string{h.expire, h.purge} {
+			r, err := h.db.ExecContext(x, q, c)
+			if err != nil {
+				h.log.Error("Unable to remove expired history rows: %s!", err.Error())
+				return
+			}
+			v, _ := r.RowsAffected()
+			n += v
+		}
+	}
+	// SQLite keeps the pages of removed rows for new rows, only databases created with
+	// incremental vacuum enabled can give them back.
+	if n > 0 && h.sqlite {
+		if _, err := h.db.ExecContext(x, "PRAGMA incremental_vacuum"); err != nil {
+			h.log.Warning("Unable to vacuum the history database: %s!", err.Error())
+		}
+	}
+	atomic.AddUint64(&h.pruned, uint64(n))
+	atomic.StoreInt64(&h.took, int64(time.Since(s)))
+	atomic.StoreInt64(&h.swept, s.UnixNano())
+	h.log.Debug("Removed %d history rows in %s.", n, time.Since(s).String())
+}
+
+// usage returns the size of the history database in bytes.
+func (h *history) usage(x context.Context) (int64, error) {
+	var n int64
+	err := h.db.QueryRowContext(x, h.size).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,231 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// revisionMax is the number of config versions that are kept for a rollback.
+const revisionMax = 32
+
+// redacted is the value shown in place of a secret in the config diffs.
+var redacted = json.RawMessage(`"[redacted]"`)
+
+// revision is a version of the config that was applied, with the differences from the
+// version before it. Origin is "start", "reload" or "rollback", and From is the version
+// that a rollback returned to.
+type revision struct {
+	Time    time.Time `json:"time"`
+	Origin  string    `json:"origin"`
+	Diff    []delta   `json:"diff"`
+	Version uint32    `json:"version"`
+	From    uint32    `json:"from,omitempty"`
+	conf    config
+}
+
+// delta is a single config value that was changed, named by the JSON names of each
+// value joined with a dot. Old or New is empty if the value was added or removed.
+type delta struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+type revisions struct {
+	list []revision
+	last uint32
+}
+
+// sensitive returns true if the config value at the path holds a secret, such as a
+// token or a password, which is never shown in the diffs.
+func sensitive(p string) bool {
+	for _, v := range strings.Split(p, ".") {
+		switch v {
+		case "auth", "approvers", "token", "password", "secret", "dsn", "key":
+			return true
+		}
+		if strings.HasSuffix(v, "_token") || strings.HasSuffix(v, "_key") || strings.HasSuffix(v, "_secret") || strings.HasSuffix(v, "_password") {
+			return true
+		}
+	}
+	return false
+}
+
+// compare returns the config values that are different between the configs, ordered by
+// path. Objects are compared by their values and everything else, including lists, is
+// compared as a whole.
+func compare(a, b config) []delta {
+	var x, y interface{}
+	if v, err := json.Marshal(a); err == nil {
+		json.Unmarshal(v, &x)
+	}
+	if v, err := json.Marshal(b); err == nil {
+		json.Unmarshal(v, &y)
+	}
+	r := make([]delta, 0)
+	walk("", x, y, &r)
+	return r
+}
+func walk(p string, a, b interface{}, r *[]delta) {
+	x, i := a.(map[string]interface{})
+	y, k := b.(map[string]interface{})
+	if i && k {
+		n := make([]string, 0, len(x)+len(y))
+		for v := range x {
+			n = append(n, v)
+		}
+		for v := range y {
+			if _, ok := x[v]; !ok {
+				n = append(n, v)
+			}
+		}
+		sort.Strings(n)
+		for _, v := range n {
+			if len(p) > 0 {
+				walk(p+"."+v, x[v], y[v], r)
+			} else {
+				walk(v, x[v], y[v], r)
+			}
+		}
+		return
+	}
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	d := delta{Path: p}
+	if a != nil {
+		d.Old, _ = json.Marshal(a)
+	}
+	if b != nil {
+		d.New, _ = json.Marshal(b)
+	}
+	if sensitive(p) {
+		if d.Old != nil {
+			d.Old = redacted
+		}
+		if d.New != nil {
+			d.New = redacted
+		}
+	}
+	*r = append(*r, d)
+}
+
+// revise adds the current config as a new version, with the differences from the last
+// version. The oldest versions are dropped once there are more than revisionMax. The
+// config lock must be held, unless the Scoreboard is not started yet.
+func (s *Scoreboard) revise(o string, f uint32) {
+	v := revision{Time: time.Now().UTC(), Origin: o, From: f, conf: s.conf.copy()}
+	if n := len(s.versions.list); n > 0 {
+		v.Diff = compare(s.versions.list[n-1].conf, v.conf)
+	} else {
+		v.Diff = []delta{}
+	}
+	s.versions.last++
+	v.Version = s.versions.last
+	if s.versions.list = append(s.versions.list, v); len(s.versions.list) > revisionMax {
+		s.versions.list = append(s.versions.list[:0:0], s.versions.list[len(s.versions.list)-revisionMax:]...)
+	}
+}
+
+// rollback applies the config of the supplied version again, like a reload of the config
+// file, and adds it as a new version. The config file is not changed. The returned bool
+// is false if the version is not kept.
+func (s *Scoreboard) rollback(i uint32) (reload, bool, error) {
+	s.cfg.Lock()
+	defer s.cfg.Unlock()
+	r := reload{Time: time.Now().UTC(), File: s.file, Applied: []string{}, Restart: []string{}}
+	var n *config
+	for x := range s.versions.list {
+		if s.versions.list[x].Version == i {
+			v := s.versions.list[x].conf.copy()
+			n = &v
+			break
+		}
+	}
+	if n == nil {
+		return r, false, nil
+	}
+	v := n.copy()
+	if err := v.verify(); err != nil {
+		s.log.Error("Cannot roll back the config to version %d: %s!", i, err.Error())
+		return r, true, err
+	}
+	if err := s.apply(&v, changes("", reflect.ValueOf(s.conf), reflect.ValueOf(*n)), &r); err != nil {
+		s.log.Error("Cannot roll back the config to version %d: %s!", i, err.Error())
+		return r, true, err
+	}
+	s.conf = *n
+	s.revise("rollback", i)
+	if len(r.Restart) > 0 {
+		s.log.Warning("Config rolled back to version %d, the changes to %s require a restart to take effect!", i, strings.Join(r.Restart, ", "))
+	} else {
+		s.log.Info("Config rolled back to version %d.", i)
+	}
+	return r, true, nil
+}
+
+// httpVersions lists the versions of the config, newest first, with the differences from
+// the version before each, or rolls back the config to a version with the "rollback"
+// action.
+func (s *Scoreboard) httpVersions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.cfg.Lock()
+		v := make([]revision, len(s.versions.list))
+		for i := range s.versions.list {
+			v[len(v)-i-1] = s.versions.list[i]
+		}
+		s.cfg.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	case http.MethodPost:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var c struct {
+		Action  string `json:"action"`
+		Version uint32 `json:"version"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+		fail(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	if !strings.EqualFold(c.Action, "rollback") {
+		fail(w, `action "`+c.Action+`" is not valid`, http.StatusBadRequest)
+		return
+	}
+	s.log.request(r).Info(`Admin "%s" requested a config rollback to version %d.`, r.RemoteAddr, c.Version)
+	v, ok, err := s.rollback(c.Version)
+	switch {
+	case !ok:
+		fail(w, "config version "+strconv.FormatUint(uint64(c.Version), 10)+" is not kept", http.StatusNotFound)
+		return
+	case err != nil:
+		fail(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -29,14 +29,14 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"text/template"
 	"time"
 
-	"github.com/PurpleSec/logx"
 	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
 	"github.com/dghubble/go-twitter/twitter"
-	"github.com/dghubble/oauth1"
 	"github.com/gorilla/websocket"
 )
 
@@ -48,30 +48,121 @@ type errval struct {
 	s string
 }
 type display struct {
-	Game    uint64
-	Twitter bool
+	Game     uint64
+	Twitter  bool
+	Route    string
+	History  bool
+	QR       bool
+	Lang     string
+	Zone     string
+	Text     catalog
+	Access   bool
+	Channels []string
+	Lobby    *lobby
+	Sponsors string
+	Pinned   bool
+	Team     uint64
+	Layout   *layout
+	Theme    string
 }
 
 // Scoreboard is a struct that represents the Scoreboard multiplexer. This struct is used to gather and
 // compare Game data to push to Scoreboard clients.
 type Scoreboard struct {
 	fs  http.Handler
-	log logx.Log
+	log *journal
+	web *journal
 	dir http.FileSystem
 	ws  *websocket.Upgrader
 	*game.Manager
 	*http.Server
-	feed   *twitter.Stream
-	html   *template.Template
-	key    string
-	cert   string
-	filter filter
-	expire time.Duration
+	proxy    func(*http.Request) (*url.URL, error)
+	feed     Stream
+	dial     Dialer
+	auth     Credentials
+	rotate   chan Stream
+	handoff  chan struct{}
+	resume   chan struct{}
+	limited  chan int
+	keys     *keyring
+	html     *template.Template
+	key      string
+	cert     string
+	saved    bool
+	hooks    []*webhook
+	digests  []*poster
+	press    *press
+	courier  *publisher
+	execs    []*runner
+	script   *engine
+	words    *wordlist
+	cluster  *cluster
+	replica  []*replica
+	mqtt     *mqtt
+	bus      *bus
+	store    *history
+	trace    *exporter
+	debug    *http.Server
+	rpc      *http.Server
+	streams  *streams
+	report   *reporter
+	stats    *meters
+	album    *gallery
+	static   *assets
+	pages    renders
+	life     lifecycle
+	games    map[string]*game.Manager
+	tenant   map[string]*Scoreboard
+	routes   map[string]string
+	token    string
+	signin   authenticator
+	pending  *approvals
+	chain    *keychain
+	tickets  bool
+	shield   *shield
+	serve    serving
+	crowd    *crowd
+	mirror   string
+	prefix   string
+	filter   filter
+	lanes    channels
+	cut      int
+	qr       qrcode
+	lobby    lobby
+	profiles profiles
+	assign   map[string]string
+	paces    map[string]game.Pace
+	sponsors sponsors
+	themes   shades
+	tone     string
+	shown    string
+	podium   podium
+	cues     presenter
+	handles  handles
+	entrants []game.Entrant
+	enlisted string
+	heard    mentions
+	late     late
+	places   positions
+	locale   string
+	locales  map[string]catalog
+	zone     *time.Location
+	limits   deadline
+	stale    time.Duration
+	file     string
+	base     []byte
+	sets     []string
+	conf     config
+	versions revisions
+	expire   time.Duration
+	swap     sync.RWMutex
+	cfg      sync.Mutex
 }
 
 // Run begins the listening process for the Scoreboard and the Game ticking threads. This
-// function blocks until interrupted. This function watches the SIGINT, SIGHUP, SIGTERM and SIGQUIT
-// signals and will automatically close and clean up after a signal is received.
+// function blocks until interrupted. This function watches the SIGINT, SIGTERM and SIGQUIT signals
+// and will automatically close and clean up after a signal is received. The SIGHUP signal reloads
+// the config file, if the Scoreboard was started with one.
 func (s *Scoreboard) Run() error {
 	var (
 		err  error
@@ -79,14 +170,52 @@ func (s *Scoreboard) Run() error {
 		x, c = context.WithCancel(context.Background())
 	)
 	s.BaseContext = func(_ net.Listener) context.Context { return x }
-	signal.Notify(w, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(w, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
 	s.log.Info("Starting Scoreboard service..")
-	go s.listen(&err, c)
-	go s.twitter(x)
-	go s.Start(x)
-	select {
-	case <-w:
-	case <-x.Done():
+	b := make(chan struct{})
+	go s.listen(&err, c, b)
+	go s.systemd(x, b)
+	if s.debug != nil {
+		go func() {
+			s.log.Warning(`Debug server is listening on "%s".`, s.debug.Addr)
+			if err := s.debug.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.log.Error("Debug server stopped: %s!", err.Error())
+			}
+		}()
+	}
+	if s.rpc != nil {
+		s.rpc.BaseContext = s.BaseContext
+		go func() {
+			s.log.Info(`gRPC server is listening on "%s".`, s.rpc.Addr)
+			if err := s.rpc.ListenAndServeTLS(s.cert, s.key); err != nil && err != http.ErrServerClosed {
+				s.log.Error("gRPC server stopped: %s!", err.Error())
+			}
+		}()
+	}
+	s.begin()
+	for n, t := range s.tenant {
+		s.log.Info(`Starting tenant "%s"..`, n)
+		t.begin()
+	}
+	for done := false; !done; {
+		select {
+		case v := <-w:
+			if v != syscall.SIGHUP {
+				done = true
+				break
+			}
+			if len(s.file) == 0 {
+				s.log.Warning("Received SIGHUP, but there is no config file to reload!")
+				break
+			}
+			s.log.Info("Received SIGHUP, reloading the config..")
+			s.reload()
+			for _, t := range s.tenant {
+				t.reload()
+			}
+		case <-x.Done():
+			done = true
+		}
 	}
 	signal.Stop(w)
 	close(w)
@@ -94,13 +223,123 @@ func (s *Scoreboard) Run() error {
 		s.log.Error("Received error during runtime: %s!", err.Error())
 	}
 	s.log.Info("Stopping and shutting down..")
+	notify("STOPPING=1")
 	f, u := context.WithTimeout(x, s.ReadTimeout)
 	err = s.Shutdown(f)
-	s.Close()
+	if s.Close(); s.debug != nil {
+		s.debug.Close()
+	}
+	if s.rpc != nil {
+		s.rpc.Close()
+	}
+	for _, t := range s.tenant {
+		t.stop()
+	}
+	s.stop()
 	u()
 	return err
 }
+
+// begin adds the Twitter, delivery and Game ticking threads of the Scoreboard to its
+// lifecycle and starts them. The Games depend on the delivery threads, so the Games are
+// started after and stopped before the threads they send changes to.
+func (s *Scoreboard) begin() {
+	var d []string
+	if s.report != nil {
+		s.spawn("sentry", s.report.start)
+		d = append(d, "sentry")
+	}
+	if s.trace != nil {
+		s.spawn("tracing", s.trace.start)
+		d = append(d, "tracing")
+	}
+	if s.store != nil {
+		s.spawn("history", s.store.start)
+		d = append(d, "history")
+		if s.store.keep.enabled() {
+			s.spawn("compact", s.store.compact)
+		}
+	}
+	for i := range s.hooks {
+		n := "webhook." + strconv.Itoa(i)
+		s.spawn(n, s.hooks[i].start)
+		d = append(d, n)
+	}
+	for i := range s.digests {
+		n := "digest." + strconv.Itoa(i)
+		s.spawn(n, s.digests[i].start)
+		d = append(d, n)
+	}
+	for i := range s.execs {
+		n := "exec." + strconv.Itoa(i)
+		s.spawn(n, s.execs[i].start)
+		d = append(d, n)
+	}
+	if s.mqtt != nil {
+		s.spawn("mqtt", s.mqtt.start)
+		d = append(d, "mqtt")
+	}
+	if s.bus != nil {
+		s.spawn("bus", s.bus.start)
+		d = append(d, "bus")
+	}
+	if s.script != nil {
+		s.spawn("script", s.script.start)
+		d = append(d, "script")
+	}
+	if s.cluster != nil {
+		s.spawn("cluster", s.cluster.start)
+		s.spawn("leader", s.cluster.elect, "cluster")
+		d = append(d, "cluster", "leader")
+	}
+	g := []string{"game"}
+	s.spawn("game", s.Start, d...)
+	for n, m := range s.games {
+		s.spawn("game."+n, m.Start, d...)
+		g = append(g, "game."+n)
+	}
+	for i := range s.replica {
+		s.spawn("replica."+strconv.Itoa(i), s.replica[i].start, g...)
+	}
+	if s.press != nil {
+		s.spawn("fallback", s.preserve, g...)
+	}
+	if s.courier != nil {
+		s.spawn("publish", s.publish, g...)
+	}
+	if s.words != nil {
+		s.spawn("wordlist", s.words.start)
+		g = append(g, "wordlist")
+	}
+	if f := s.twitter(); f != nil {
+		if s.feed != nil {
+			s.source("twitter", "connected")
+		} else {
+			s.source("twitter", "read by the cluster leader")
+		}
+		s.spawn("twitter", f, g...)
+	}
+	s.spawn("themes", s.palette)
+	if len(s.file) > 0 && s.conf.Watch {
+		s.spawn("watch", s.watch, g...)
+	}
+	s.start()
+}
+
+// stop stops every thread, then closes the history database and the log file.
+func (s *Scoreboard) stop() {
+	if s.halt(); s.store != nil {
+		s.store.close()
+	}
+	s.log.out.close()
+}
 func (c config) New() (*Scoreboard, error) {
+	return c.build("")
+}
+
+// build returns a Scoreboard from the config. The name is empty for the main Scoreboard,
+// tenants are built with their name, which sets the path prefix of their pages.
+func (c config) build(n string) (*Scoreboard, error) {
 	if err := c.verify(); err != nil {
 		return nil, err
 	}
@@ -121,104 +360,576 @@ func (c config) New() (*Scoreboard, error) {
 		x = filepath.Join(c.Directory, "template")
 	}
 	var s Scoreboard
-	if len(c.Log.File) > 0 {
-		var f logx.Log
-		if f, err = logx.File(c.Log.File, logx.Level(c.Log.Level)); err != nil {
-			return nil, &errval{s: `unable to create log file "` + c.Log.File + `"`, e: err}
-		}
-		s.log = logx.Multiple(f, logx.Console(logx.Level(c.Log.Level)))
-	} else {
-		s.log = logx.Console(logx.Level(c.Log.Level))
+	if s.log, err = newJournal(c.Log); err != nil {
+		return nil, err
+	}
+	s.dial = c.dial
+	if len(n) > 0 {
+		s.prefix, s.log.out.tenant = "/e/"+n, n
 	}
-	s.html = template.New("base")
+	s.static = &assets{fs: &s, files: make(map[string]*asset), limit: int64(c.Memory.Assets) << 20}
+	s.html, s.stats = template.New("base").Funcs(template.FuncMap{
+		"base":  func() string { return s.prefix },
+		"asset": func(n string) string { return s.prefix + "/" + s.static.path(n) },
+		"nonce": func() string { return nonceMark },
+	}), &meters{codes: make(map[int]uint64), rules: make(map[string]uint64)}
 	if err = getTemplate(s.html, x, "home.html"); err != nil {
 		return nil, &errval{s: "unable to load home template", e: err}
 	}
 	if err = getTemplate(s.html, x, "scoreboard.html"); err != nil {
 		return nil, &errval{s: "unable to load scoreboard template", e: err}
 	}
-	if s.Manager, err = game.New(c.Scorebot, c.Assets, time.Duration(c.Tick)*time.Second, t, s.log); err != nil {
+	if err = getTemplate(s.html, x, "mobile.html"); err != nil {
+		return nil, &errval{s: "unable to load mobile template", e: err}
+	}
+	if err = getTemplate(s.html, x, "podium.html"); err != nil {
+		return nil, &errval{s: "unable to load podium template", e: err}
+	}
+	if err = getTemplate(s.html, x, "team.html"); err != nil {
+		return nil, &errval{s: "unable to load team template", e: err}
+	}
+	if err = getTemplate(s.html, x, "attacks.html"); err != nil {
+		return nil, &errval{s: "unable to load attack map template", e: err}
+	}
+	if err = getTemplate(s.html, x, "admin.html"); err != nil {
+		return nil, &errval{s: "unable to load admin template", e: err}
+	}
+	if err = getTemplate(s.html, x, "presenter.html"); err != nil {
+		return nil, &errval{s: "unable to load presenter template", e: err}
+	}
+	if err = getTemplate(s.html, x, "static.html"); err != nil {
+		return nil, &errval{s: "unable to load static board template", e: err}
+	}
+	var l string
+	if len(c.Directory) > 0 {
+		l = filepath.Join(c.Directory, "locale")
+	}
+	if s.locales, err = catalogs(l); err != nil {
+		return nil, err
+	}
+	if s.locale = strings.ToLower(c.Locale); s.locales[s.locale] == nil {
+		return nil, &errval{s: `locale "` + c.Locale + `" does not have a message catalog`}
+	}
+	if s.zone, err = zone(c.Timezone); err != nil {
+		return nil, err
+	}
+	if s.proxy, err = game.Proxy(c.Proxy, c.NoProxy); err != nil {
+		return nil, &errval{s: "invalid proxy config", e: err}
+	}
+	if len(c.Sentry.DSN) > 0 {
+		s.report = newReporter(c.Sentry, s.outbound(t), s.log.with("sentry"))
+		if c.Sentry.Errors {
+			s.log.forward(s.report.error)
+		}
+	}
+	s.Manager, err = game.New(c.Source.Type, c.Source.raw, c.Assets, time.Duration(c.Source.interval(c.Tick))*time.Second, t, s.log.with("game"))
+	if err != nil {
 		return nil, &errval{s: "unable to setup game manager", e: err}
 	}
+	if err = s.Proxy(c.proxy(c.Source)); err != nil {
+		return nil, &errval{s: "invalid proxy config", e: err}
+	}
+	if len(c.Fixture.Record) > 0 {
+		if err = s.Record(c.Fixture.Record); err != nil {
+			return nil, &errval{s: `unable to record fixture "` + c.Fixture.Record + `"`, e: err}
+		}
+	}
+	if len(c.Fixture.Replay) > 0 {
+		v, _ := time.Parse(time.RFC3339, c.Fixture.Start)
+		if err = s.Rewind(c.Fixture.Replay, v, c.Fixture.speed()); err != nil {
+			return nil, &errval{s: `unable to replay fixture "` + c.Fixture.Replay + `"`, e: err}
+		}
+	}
+	if s.report != nil {
+		s.Report(s.report.game(""))
+	}
+	s.Breaker(c.Retry.Attempts, c.Retry.Threshold, time.Duration(c.Retry.Cooldown)*time.Second)
+	s.Workers(c.Workers)
+	s.Milestone(c.milestone())
+	s.Limit(c.Memory.Tweets, c.Memory.Events)
+	s.TeamLimit(c.Memory.Teams)
+	s.Divisions(c.Divisions)
+	s.Effects(c.Effects.kinds())
+	s.Pacing(c.Pacing.Rate, c.Pacing.Collapse)
+	s.Locate(s.locate)
+	if err = s.Order(c.Sort.Keys, c.Sort.Ties == "split"); err != nil {
+		return nil, &errval{s: "unable to set the sort policy", e: err}
+	}
+	if err = s.Anonymize(c.Anonymize); err != nil {
+		return nil, &errval{s: "unable to set the anonymize mode", e: err}
+	}
+	s.Warnings(c.Clock.warnings())
+	s.Breaks(c.Clock.breaks())
+	s.Adapt(c.Clock.pacing())
+	s.Watchdog(time.Duration(c.Source.watchdog()) * time.Second)
+	a, d, _ := c.Source.skew()
+	s.Correct(a, d)
+	v, _ := c.Source.lanes()
+	s.Lanes(v)
+	s.Chaos(c.Debug.rates())
+	if b, e := c.Clock.times(); !b.IsZero() || !e.IsZero() {
+		s.Clock(0, b, e)
+	}
+	if len(c.Freeze) > 0 {
+		v, _ := time.Parse(time.RFC3339, c.Freeze)
+		s.Freeze(0, v)
+	}
+	if c.Finale.Enabled {
+		if s.Finale(true, c.Finale.Freeze); c.Finale.Podium {
+			s.Hook(s.curtain(""))
+		}
+	}
+	if len(c.Webhooks) > 0 {
+		s.hooks = make([]*webhook, len(c.Webhooks))
+		for i := range c.Webhooks {
+			s.hooks[i] = newWebhook(c.Webhooks[i], s.outbound(t), s.log.with("webhook"))
+		}
+		s.Hook(s.dispatch)
+		s.log.Debug("Added %d webhooks.", len(s.hooks))
+	}
+	if len(c.Digests) > 0 {
+		s.digests = make([]*poster, len(c.Digests))
+		for i := range c.Digests {
+			s.digests[i] = newPoster(c.Digests[i], s.outbound(t), s.log.with("digest"))
+			s.digests[i].zone, s.digests[i].leader = s.local, s.leading
+			if len(c.Digests[i].Game) == 0 {
+				s.digests[i].attach(s.Manager)
+			}
+		}
+		s.log.Debug("Added %d standings digests.", len(s.digests))
+	}
+	if c.Fallback.Enabled {
+		s.press = newPress(c.Fallback, s.outbound(t), s.log.with("fallback"))
+		s.Watch(s.press.watch)
+	}
+	if c.Publish.Enabled {
+		s.courier = newPublisher(c.Publish, s.outbound(t), s.log.with("publish"))
+		s.Watch(s.courier.watch)
+	}
+	if len(c.Exec) > 0 {
+		s.execs = make([]*runner, len(c.Exec))
+		for i := range c.Exec {
+			s.execs[i] = newRunner(c.Exec[i], s.log.with("exec"))
+		}
+		s.Hook(s.execute)
+		s.log.Debug("Added %d exec commands.", len(s.execs))
+	}
+	if len(c.Script.File) > 0 {
+		if s.script, err = newEngine(c.Script, s.log.with("script")); err != nil {
+			return nil, err
+		}
+		s.Announce(s.script.change)
+		s.log.Debug(`Loaded script "%s".`, c.Script.File)
+	}
+	if len(c.MQTT.Server) > 0 {
+		s.mqtt = newMQTT(c.MQTT, t, s.log.with("mqtt"))
+		s.Hook(s.mqtt.change)
+		s.Watch(s.mqtt.snapshot)
+	}
+	if len(c.History.Source) > 0 {
+		if s.store, err = newHistory(c.History, t, s.log.with("history")); err != nil {
+			return nil, err
+		}
+		s.Hook(s.store.change)
+		s.Watch(s.store.snapshot)
+		s.Listen(s.store.message)
+		s.Monitor(s.monitor)
+	}
+	if c.Delay > 0 {
+		s.Delay(s.store, time.Duration(c.Delay)*time.Second)
+		s.log.Info("Public clients will be shown the Game %d seconds behind real time.", c.Delay)
+	}
+	if len(c.Logos.Dir) > 0 {
+		if s.album, err = newGallery(c.Logos, s.outbound(t), s.log.with("logos")); err != nil {
+			return nil, err
+		}
+		s.album.prefix = s.prefix
+		s.Logos(s.album.resolve)
+	}
+	if len(c.Cluster.Server) > 0 {
+		if s.cluster, err = newCluster(c.Cluster, t, s.log.with("cluster")); err != nil {
+			return nil, err
+		}
+		s.Leader(s.cluster.leading)
+		err = s.Share(s.cluster.store(""), time.Duration(c.State.Interval)*time.Second)
+		s.log.Debug(`Sharing state with the cluster as node "%s".`, s.cluster.node)
+	} else {
+		err = s.Persist(c.State.File, time.Duration(c.State.Interval)*time.Second)
+	}
+	if err != nil {
+		return nil, &errval{s: "unable to restore game state", e: err}
+	}
+	s.saved, s.stale = len(c.State.File) > 0, time.Duration(c.Stale)*time.Second
+	if len(c.Bus.Server) > 0 {
+		s.bus = newBus(c.Bus, t, s.outbound(t), s.log.with("bus"))
+		s.Hook(s.bus.change)
+		s.Listen(s.bus.message)
+		s.log.Debug(`Streaming events to %s server "%s".`, c.Bus.Type, c.Bus.Server)
+	}
+	if len(c.Tracing.Endpoint) > 0 {
+		s.trace = newExporter(c.Tracing, s.outbound(t), s.log.with("tracing"))
+		s.Trace(s.trace.trace(""))
+		s.log.Debug(`Sending update spans to "%s".`, c.Tracing.Endpoint)
+	}
+	if len(c.RPC.Listen) > 0 {
+		s.rpc = s.grpc(&c, t)
+	}
+	if err = s.arenas(&c, t); err != nil {
+		return nil, err
+	}
+	if len(c.Replicate.Primary) > 0 {
+		if err = s.replicate(&c, t); err != nil {
+			return nil, err
+		}
+	}
+	if c.Debug.Enabled {
+		s.debug = s.inspector(c.Debug, t)
+		if v := c.Debug.Chaos; v.Drop > 0 || v.Malformed > 0 || v.Stall > 0 || v.Slow > 0 {
+			s.log.Warning("Chaos testing is enabled, the Source and clients will see simulated failures!")
+		}
+	}
+	s.serve, s.crowd = c.Server, newCrowd(c.Public)
+	h, i := s.serve.defaults(t)
 	s.Server = &http.Server{
 		Addr:              c.Listen,
 		Handler:           new(http.ServeMux),
 		ReadTimeout:       t,
-		IdleTimeout:       t,
+		IdleTimeout:       i,
 		WriteTimeout:      t,
-		ReadHeaderTimeout: t,
+		MaxHeaderBytes:    s.serve.Headers,
+		ReadHeaderTimeout: h,
 	}
+	s.web = s.log.with("web")
+	s.Server.ErrorLog = s.web.logger()
+	// The write buffers are shared between the clients, so idle clients do not keep a
+	// write buffer in memory between updates.
 	s.ws = &websocket.Upgrader{
 		CheckOrigin:      func(_ *http.Request) bool { return true },
 		ReadBufferSize:   1024,
-		WriteBufferSize:  1024,
+		WriteBufferSize:  c.Memory.buffer(),
+		Subprotocols:     game.Subprotocols,
+		WriteBufferPool:  new(sync.Pool),
 		HandshakeTimeout: t,
 	}
-	if c.twitter {
-		y := twitter.NewClient(
-			oauth1.NewConfig(c.Twitter.Credentials.ConsumerKey, c.Twitter.Credentials.ConsumerSecret).Client(
-				context.Background(),
-				oauth1.NewToken(c.Twitter.Credentials.AccessKey, c.Twitter.Credentials.AccessSecret),
-			),
-		)
-		if _, _, err = y.Accounts.VerifyCredentials(nil); err != nil {
-			return nil, &errval{s: "cannot authenticate to Twitter: %w", e: err}
-		}
-		s.feed, err = y.Streams.Filter(
-			&twitter.StreamFilterParams{
-				Track:         c.Twitter.Filter.Keywords,
-				Language:      c.Twitter.Filter.Language,
-				StallWarnings: twitter.Bool(true),
-			},
-		)
-		if err != nil {
-			return nil, &errval{s: "unable to start Twitter filter", e: err}
+	switch {
+	case c.twitter && len(s.replica) > 0:
+		s.log.Warning("Tweets are sent by the primary, skipping Twitter setup on the replica!")
+	case c.twitter && s.cluster != nil:
+		// Only the cluster leader reads the Twitter stream, which is started once this
+		// node is elected.
+		s.auth, s.rotate, s.handoff = c.Twitter.Credentials, make(chan Stream, 1), make(chan struct{}, 1)
+		s.resume, s.limited = make(chan struct{}, 1), make(chan int, 1)
+		s.filter, s.limits, s.expire = c.Twitter.Filter, c.Twitter.Timeouts, time.Duration(c.Twitter.Expire)*time.Second
+		s.lanes, s.cut = c.Twitter.Channels, c.Twitter.Truncate
+		s.keys = newKeyring(c.Twitter.Credentials, c.Twitter.Failover, c.Twitter.Cooldown)
+		s.cluster.notify = append(s.cluster.notify, s.elected)
+		s.log.Info("Twitter setup successful, the stream will be started by the cluster leader.")
+	case c.twitter:
+		s.filter, s.limits, s.expire = c.Twitter.Filter, c.Twitter.Timeouts, time.Duration(c.Twitter.Expire)*time.Second
+		s.lanes, s.cut = c.Twitter.Channels, c.Twitter.Truncate
+		s.keys, s.limited = newKeyring(c.Twitter.Credentials, c.Twitter.Failover, c.Twitter.Cooldown), make(chan int, 1)
+		if s.feed, err = connect(s.dial, &c.Twitter.Credentials, c.Twitter.Filter, s.streamer()); err != nil {
+			// The failover credentials are tried before giving up, so the Scoreboard can
+			// start while the main credentials are rate limited.
+			if s.feed, _ = s.failover(nil, nil, s.log.with("twitter")); s.feed == nil {
+				return nil, err
+			}
 		}
-		s.filter, s.expire = c.Twitter.Filter, time.Duration(c.Twitter.Expire)*time.Second
+		s.rotate, s.resume, s.stats.stream = make(chan Stream, 1), make(chan struct{}, 1), 1
 		s.log.Info("Twitter setup successful!")
-	} else {
+	default:
 		s.log.Warning("Missing Twitter keys and/or filter parameters, skipping Twitter setup!")
 	}
-	s.key, s.cert = c.Key, c.Cert
+	if s.rotate != nil && len(c.Twitter.Filter.Wordlists) > 0 {
+		if s.words, err = newWordlist(c.Twitter.Filter.Wordlists, s.outbound(t), s.log.with("wordlist")); err != nil {
+			return nil, err
+		}
+		s.log.Debug("Loaded %d wordlists.", len(c.Twitter.Filter.Wordlists))
+	}
+	s.key, s.cert, s.qr, s.lobby, s.sponsors, s.handles, s.places = c.Key, c.Cert, c.QR, c.Lobby, c.Sponsors, c.Handles, c.Positions
+	s.profiles, s.themes = c.Profiles, c.Themes
+	s.shown = s.theme()
+	if s.enlisted = c.Teams; len(c.Teams) > 0 {
+		l, err := entrants(c.Teams)
+		if err != nil {
+			return nil, err
+		}
+		s.enter(l)
+		s.log.Debug(`Loaded %d teams from "%s".`, len(l), c.Teams)
+	}
+	if !c.Security.Disabled {
+		v := c.Security
+		v.defaults()
+		s.shield = &v
+	}
 	s.fs, s.dir = http.FileServer(http.FS(&s)), http.Dir(p)
+	if err = s.precompile(); err != nil {
+		return nil, err
+	}
 	s.Server.Handler.(*http.ServeMux).HandleFunc("/", s.http)
 	s.Server.Handler.(*http.ServeMux).HandleFunc("/w", s.httpWebsocket)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/m", light(s.httpMobile))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/m/", light(s.httpMobile))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/standings", light(s.httpStandings))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/public/scoreboard", s.httpPublic)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/clock", s.httpCountdown)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/services", light(s.httpServices))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/beacons", light(s.httpBeacons))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/challenges", light(s.httpChallenges))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/hills", light(s.httpHills))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/sponsors", light(s.httpSponsors))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/podium", light(s.httpPlaces))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/podium", s.httpPodium)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/podium/", s.httpPodium)
+	if s.press != nil {
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/static-board", light(s.httpStaticBoard))
+	}
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/teams/", light(s.httpTeam))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/team/", light(s.httpTeamPage))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/attacks", light(s.httpAttacks))
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/attacks", s.httpAttackMap)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/attacks/", s.httpAttackMap)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/export/standings.csv", s.httpExportStandings)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/snapshot.png", s.httpSnapshot)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/qr.png", s.httpQR)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/graphql", s.httpGraph)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/metrics", s.httpMetrics)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/healthz", s.httpHealth)
+	s.Server.Handler.(*http.ServeMux).HandleFunc("/readyz", s.httpReady)
+	if len(s.games) > 0 {
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/w/", s.httpWebsocket)
+	}
+	if s.store != nil {
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/history/scores", light(s.httpHistory))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/history/availability", light(s.httpAvailability))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/export/events.json", s.httpExportEvents)
+	}
+	if s.album != nil {
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/logo/", s.httpLogo)
+	}
+	if s.mirror = c.Replicate.Token; len(s.mirror) > 0 {
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/replicate", s.httpReplicate)
+	}
+	if s.token = c.Admin.Token; len(s.token) > 0 {
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/freeze", s.admin(s.httpFreeze))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/adjustments", s.admin(s.httpAdjust))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/clock", s.admin(s.httpClock))
+		if c.Finale.Enabled {
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/finale", s.admin(s.httpFinale))
+		}
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/reload", s.admin(s.httpReload))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/config/history", s.admin(s.httpVersions))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/log", s.admin(s.httpLog))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/sponsors", s.admin(s.httpAdminSponsors))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/teams", s.admin(s.httpTeams))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/podium", s.admin(s.httpAdminPodium))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/displays", s.admin(s.httpDisplays))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/profiles", s.admin(s.httpProfiles))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/pace", s.admin(s.httpPace))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/theme", s.admin(s.httpTheme))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/announce", s.admin(s.httpAnnounce))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/skew", s.admin(s.httpSkew))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/presenter", s.admin(s.httpCue))
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/admin", s.httpConsole)
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/presenter", s.httpPresenter)
+		s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/ticket", s.httpTicket)
+		if s.signin, err = c.Admin.Auth.backend(s.outbound(t), s.log.with("auth")); err != nil {
+			return nil, err
+		}
+		if _, ok := s.signin.(*provider); ok {
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/admin/login", s.httpLogin)
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/admin/callback", s.httpCallback)
+		}
+		s.tickets, s.cues = c.Admin.Tickets, c.Admin.Presenter
+		if s.pending = newApprovals(c.Admin.Confirm, s.log.with("audit")); s.pending != nil {
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/approvals", s.httpApprovals)
+		}
+		if len(s.games) > 0 {
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/game/switch", s.admin(s.httpSwitch))
+		}
+		if s.store != nil {
+			s.chain = newKeychain(s.store)
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/replay", s.admin(s.httpReplay))
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/keys", s.admin(s.httpKeys))
+		}
+		if s.rotate != nil {
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/twitter", s.admin(s.httpTwitter))
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/tweets", s.admin(s.httpTweets))
+		}
+		if s.album != nil {
+			s.Server.Handler.(*http.ServeMux).HandleFunc("/api/v1/admin/logos", s.admin(s.httpLogos))
+		}
+	}
+	if s.cluster != nil {
+		s.cluster.handler = s.Server.Handler
+	}
+	for i := range c.Tenants {
+		if err = s.tenants(c.Tenants[i]); err != nil {
+			return nil, err
+		}
+	}
 	return &s, nil
 }
-func (s *Scoreboard) twitter(x context.Context) {
-	if s.feed == nil {
-		return
+
+// twitter returns the Twitter stream thread, which sends the Tweets from the stream to
+// every Game, or nil if Twitter is not enabled.
+func (s *Scoreboard) twitter() func(context.Context) {
+	if s.rotate == nil {
+		return nil
 	}
-	for c := s.Twitter(s.expire); ; {
-		select {
-		case <-x.Done():
-			close(c)
-			s.feed.Stop()
-			return
-		case n := <-s.feed.Messages:
-			switch t := n.(type) {
-			case *twitter.Tweet:
-				c <- t
-			case *twitter.Event:
-			case *twitter.FriendsList:
-			case *twitter.UserWithheld:
-			case *twitter.DirectMessage:
-			case *twitter.StatusDeletion:
-			case *twitter.StatusWithheld:
-			case *twitter.LocationDeletion:
-			case *twitter.StreamLimit:
-				s.log.Warning("Twitter stream thread received a StreamLimit message of %d!", t.Track)
-			case *twitter.StallWarning:
-				s.log.Warning("Twitter stream thread received a StallWarning message: %s!", t.Message)
-			case *twitter.StreamDisconnect:
-				s.log.Error("Twitter stream thread received a StreamDisconnect message: %s!", t.Reason)
-				return
-			case *url.Error:
-				s.log.Error("Twitter stream thread received an error: %s!", t.Error())
-				return
+	c := []chan<- *twitter.Tweet{s.Twitter(s.expire, s.cut, s.lanes.route)}
+	for _, m := range s.games {
+		c = append(c, m.Twitter(s.expire, s.cut, s.lanes.route))
+	}
+	var (
+		f = s.feed
+		r <-chan interface{}
+		h []*twitter.Tweet
+		k uint64
+		l = s.log.with("twitter")
+	)
+	if f != nil {
+		r = f.Messages()
+	}
+	send := func(t *twitter.Tweet) {
+		s.matched(t)
+		s.heard.add(t)
+		for i := range c {
+			select {
+			case c[i] <- t:
 			default:
-				if t != nil {
-					s.log.Warning("Twitter stream thread received an unrecognized message (%T): %s\n", t, t)
+				atomic.AddUint64(&s.stats.dropped, 1)
+				s.stats.limit(1)
+				l.Warning("Twitter stream thread dropped Tweet ID %d, the game is not keeping up!", t.ID)
+			}
+		}
+	}
+	// The current stream and the Tweets kept while paused are kept outside of the loop,
+	// so they are not lost if the loop is restarted after a panic.
+	return func(x context.Context) {
+		for {
+			select {
+			case <-x.Done():
+				for i := range c {
+					close(c[i])
+				}
+				if f != nil {
+					f.Stop()
+				}
+				return
+			case <-s.handoff:
+				f, r = s.handover(f, r, l)
+			case v := <-s.limited:
+				l.Warning("Twitter stream request returned status %d, failing over to the next credentials.", v)
+				f, r = s.failover(f, r, l)
+			case <-s.resume:
+				if atomic.LoadUint32(&s.stats.paused) == 1 || len(h) == 0 {
+					break
+				}
+				l.Debug("Twitter stream thread is sending %d Tweets kept while paused.", len(h))
+				for i := range h {
+					send(h[i])
+				}
+				h = nil
+				atomic.StoreUint32(&s.stats.held, 0)
+			case v := <-s.rotate:
+				// The new stream is already started, so no Tweets are missed while the old
+				// stream is stopped.
+				if f != nil {
+					f.Stop()
+				}
+				f, r = v, v.Messages()
+				atomic.AddUint64(&s.stats.reconnects, 1)
+				atomic.StoreUint32(&s.stats.stream, 1)
+				s.degrade("twitter", time.Time{})
+				s.source("twitter", "connected")
+				l.Info("Twitter stream thread switched to the rotated credentials.")
+			case n, ok := <-r:
+				if !ok {
+					// The stream closes its channel when Twitter rejects the request, so the
+					// closed channel is not read again.
+					l.Error("Twitter stream thread stream was closed, waiting for new credentials!")
+					r = nil
+					atomic.AddUint64(&s.stats.disconnects, 1)
+					atomic.StoreUint32(&s.stats.stream, 0)
+					s.degrade("twitter", time.Now())
+					s.source("twitter", "disconnected, waiting for new credentials")
+					f, r = s.failover(f, r, l)
+					break
+				}
+				switch t := n.(type) {
+				case *twitter.Tweet:
+					atomic.AddUint64(&s.stats.received, 1)
+					s.swap.RLock()
+					v, w := s.filter.reject(t)
+					if s.swap.RUnlock(); len(v) == 0 && s.words != nil {
+						if w = s.words.match(t); len(w) > 0 {
+							v = "wordlist"
+						}
+					}
+					if len(v) == 0 && s.script != nil && !s.script.allow(t) {
+						v = "script"
+					}
+					if len(v) > 0 {
+						s.stats.reject(v)
+						if len(w) > 0 {
+							l.Debug(`Twitter stream thread filtered Tweet ID %d by the "%s" rule, matching "%s".`, t.ID, v, w)
+						} else {
+							l.Debug(`Twitter stream thread filtered Tweet ID %d by the "%s" rule.`, t.ID, v)
+						}
+						break
+					}
+					if atomic.LoadUint32(&s.stats.paused) == 0 {
+						send(t)
+						break
+					}
+					if len(h) >= twitterHold {
+						h = h[1:]
+						atomic.AddUint64(&s.stats.dropped, 1)
+						s.stats.limit(1)
+					}
+					h = append(h, t)
+					atomic.StoreUint32(&s.stats.held, uint32(len(h)))
+				case *twitter.Event:
+				case *twitter.FriendsList:
+				case *twitter.UserWithheld:
+				case *twitter.DirectMessage:
+				case *twitter.StatusDeletion:
+				case *twitter.StatusWithheld:
+				case *twitter.LocationDeletion:
+				case *twitter.StreamLimit:
+					// Track is the number of Tweets held back since the stream was started,
+					// so only the increase is counted. A lower number is a new stream.
+					if v := uint64(t.Track); t.Track > 0 && v > k {
+						s.stats.limit(v - k)
+						k = v
+					} else if t.Track > 0 && v < k {
+						s.stats.limit(v)
+						k = v
+					}
+					l.Warning("Twitter stream thread received a StreamLimit message of %d!", t.Track)
+				case *twitter.StallWarning:
+					l.Warning("Twitter stream thread received a StallWarning message: %s!", t.Message)
+				case *twitter.StreamDisconnect:
+					l.Error("Twitter stream thread received a StreamDisconnect message, waiting for new credentials: %s!", t.Reason)
+					r = nil
+					atomic.AddUint64(&s.stats.disconnects, 1)
+					atomic.StoreUint32(&s.stats.stream, 0)
+					s.degrade("twitter", time.Now())
+					s.source("twitter", "disconnected, waiting for new credentials")
+					f, r = s.failover(f, r, l)
+				case *url.Error:
+					l.Error("Twitter stream thread received an error, waiting for new credentials: %s!", t.Error())
+					r = nil
+					atomic.AddUint64(&s.stats.disconnects, 1)
+					atomic.StoreUint32(&s.stats.stream, 0)
+					s.degrade("twitter", time.Now())
+					s.source("twitter", "disconnected, waiting for new credentials")
+					f, r = s.failover(f, r, l)
+				default:
+					if t != nil {
+						l.Warning("Twitter stream thread received an unrecognized message (%T): %s\n", t, t)
+					}
 				}
 			}
 		}
@@ -238,6 +949,14 @@ func (s *Scoreboard) Open(n string) (fs.File, error) {
 	}
 	return r, nil
 }
+
+// outbound returns a HTTP client for requests to other services that uses the proxy
+// config of the Scoreboard.
+func (s *Scoreboard) outbound(t time.Duration) *http.Client {
+	v := http.DefaultTransport.(*http.Transport).Clone()
+	v.Proxy = s.proxy
+	return &http.Client{Timeout: t, Transport: v}
+}
 func getTemplate(t *template.Template, d, f string) error {
 	if len(d) > 0 {
 		s := filepath.Join(d, f)
@@ -257,9 +976,19 @@ func getTemplate(t *template.Template, d, f string) error {
 	}
 	return nil
 }
-func (s *Scoreboard) listen(err *error, f context.CancelFunc) {
-	if len(s.cert) == 0 || len(s.key) == 0 {
-		*err = s.ListenAndServe()
+func (s *Scoreboard) listen(err *error, f context.CancelFunc, b chan<- struct{}) {
+	s.Handler = s.track(s.protect(s.secure(s.bound(s.Handler))))
+	// The listener is opened first, so the bound channel is closed only once clients
+	// are able to connect.
+	l, e := net.Listen("tcp", s.Addr)
+	if e != nil {
+		*err = e
+		f()
+		return
+	}
+	l = s.admit(l)
+	if close(b); len(s.cert) == 0 || len(s.key) == 0 {
+		*err = s.Serve(l)
 		f()
 		return
 	}
@@ -276,9 +1005,16 @@ func (s *Scoreboard) listen(err *error, f context.CancelFunc) {
 		},
 		CurvePreferences: []tls.CurveID{tls.CurveP256, tls.X25519},
 	}
-	*err = s.ListenAndServeTLS(s.cert, s.key)
+	*err = s.ServeTLS(l, s.cert, s.key)
 	f()
 }
+
+// accessible returns true if the request selected the accessible display profile, which
+// has high contrast colors, larger text and no animations, with the "a11y" query value.
+func accessible(r *http.Request) bool {
+	v, err := strconv.ParseBool(r.URL.Query().Get("a11y"))
+	return err == nil && v
+}
 func (s *Scoreboard) http(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
@@ -286,14 +1022,15 @@ func (s *Scoreboard) http(w http.ResponseWriter, r *http.Request) {
 	}
 	if w.Header().Set("Access-Control-Allow-Origin", `"*"`); len(r.URL.Path) <= 1 || r.URL.Path == "/" {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if err := s.html.ExecuteTemplate(w, "home.html", s.Games); err != nil {
+		if err := s.render(w, r, "home.html", strconv.FormatUint(s.Version(), 10), s.Games); err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			s.log.Error(`Error during request from "%s": %s`, r.RemoteAddr, err.Error())
+			s.web.request(r).Error(`Error during request from "%s": %s`, r.RemoteAddr, err.Error())
 		}
 		return
 	}
 	var (
 		v uint64
+		o string
 		n = strings.Trim(r.URL.Path, "/")
 		i = strings.IndexRune(n, '/')
 	)
@@ -307,24 +1044,57 @@ func (s *Scoreboard) http(w http.ResponseWriter, r *http.Request) {
 	case strings.ToLower(n[:i]) == "game":
 		if x, err := strconv.Atoi(n[i+1:]); err == nil {
 			v = uint64(x)
+		} else if m := s.arena(n[i+1:]); m != nil {
+			v, o = current(m), strings.ToLower(n[i+1:])
 		}
 	}
 	if v == 0 {
-		s.fs.ServeHTTP(w, r)
+		s.httpStatic(w, r)
 		return
 	}
-	s.log.Debug(`Received scoreboard request from "%s"..`, r.RemoteAddr)
+	s.web.request(r).Debug(`Received scoreboard request from "%s"..`, r.RemoteAddr)
+	s.swap.RLock()
+	q, b, p, f, t := s.qr.Widget, s.lobby, s.sponsors.region(), s.podium.pinned(v, o), s.theme()
+	s.swap.RUnlock()
+	if f {
+		s.ceremony(w, r, &display{Game: v, Route: o, Pinned: true})
+		return
+	}
+	l := s.language(r)
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", l)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := s.html.ExecuteTemplate(w, "scoreboard.html", &display{Game: v, Twitter: s.feed != nil}); err != nil {
+	d := &display{Game: v, Route: o, Twitter: s.rotate != nil, History: s.store != nil && len(o) == 0, QR: q, Lang: l, Zone: s.timezone(r).String(), Text: s.locales[l], Access: accessible(r), Channels: s.lanes.names(), Sponsors: p, Layout: s.layout(r), Theme: t}
+	if d.Theme == "" && d.Layout != nil {
+		d.Theme = d.Layout.Theme
+	}
+	if b.Enabled {
+		d.Lobby = &b
+	}
+	if err := s.render(w, r, "scoreboard.html", d.key(), d); err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		s.log.Error(`Error during request from "%s": %s!`, r.RemoteAddr, err.Error())
+		s.web.request(r).Error(`Error during request from "%s": %s!`, r.RemoteAddr, err.Error())
 	}
 }
 func (s *Scoreboard) httpWebsocket(w http.ResponseWriter, r *http.Request) {
+	var m *game.Manager
+	if n := strings.Trim(strings.TrimPrefix(r.URL.Path, "/w"), "/"); len(n) > 0 {
+		if m = s.arena(n); m == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+	}
 	c, err := s.ws.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	s.New(c)
+	if m == nil {
+		m = s.Manager
+	}
+	if s.staff(r) {
+		m.Staff(c, r)
+		return
+	}
+	m.Public(c, r)
 }
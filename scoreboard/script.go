@@ -0,0 +1,201 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/dghubble/go-twitter/twitter"
+	"go.starlark.net/starlark"
+)
+
+// scriptSteps is the most steps a script function can run for each call, so a script
+// with an endless loop cannot stop the Twitter or update threads.
+const scriptSteps = 1000000
+
+type scripting struct {
+	File string `json:"file"`
+}
+
+// engine runs the Starlark script functions. The "filter" function is called with each
+// Tweet that passed the filter and the "announce" function is called with each Change.
+// The script is loaded again when the file is changed.
+type engine struct {
+	log      logx.Log
+	filter   starlark.Value
+	announce starlark.Value
+	file     string
+	lock     sync.RWMutex
+}
+
+func (s scripting) verify() error {
+	if len(s.File) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(s.File); err != nil {
+		return &errval{s: `script file "` + s.File + `" cannot be read`, e: err}
+	}
+	return nil
+}
+func newEngine(s scripting, l logx.Log) (*engine, error) {
+	e := &engine{log: l, file: s.File}
+	if err := e.load(); err != nil {
+		return nil, &errval{s: `unable to load script "` + s.File + `"`, e: err}
+	}
+	return e, nil
+}
+
+// compile runs the script file and returns the "filter" and "announce" functions, which
+// are nil if the script does not define them. The script globals are frozen, so the
+// functions can be called from multiple threads.
+func compile(f string) (starlark.Value, starlark.Value, error) {
+	t := &starlark.Thread{Name: "load"}
+	t.SetMaxExecutionSteps(scriptSteps)
+	g, err := starlark.ExecFile(t, f, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	g.Freeze()
+	var a, b starlark.Value
+	if v, ok := g["filter"].(starlark.Callable); ok {
+		a = v
+	}
+	if v, ok := g["announce"].(starlark.Callable); ok {
+		b = v
+	}
+	if a == nil && b == nil {
+		return nil, nil, &errval{s: `script does not define a "filter" or "announce" function`}
+	}
+	return a, b, nil
+}
+func (e *engine) load() error {
+	a, b, err := compile(e.file)
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	e.filter, e.announce = a, b
+	e.lock.Unlock()
+	return nil
+}
+func (e *engine) start(x context.Context) {
+	i, err := os.Stat(e.file)
+	if err != nil {
+		e.log.Error(`Cannot watch script file "%s": %s!`, e.file, err.Error())
+		return
+	}
+	t := time.NewTicker(watchInterval)
+	defer t.Stop()
+	for m := i.ModTime(); ; {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+		}
+		if i, err = os.Stat(e.file); err != nil || i.ModTime().Equal(m) {
+			continue
+		}
+		m = i.ModTime()
+		// A script with errors does not replace the running script, so a mistake made
+		// while editing does not stop the filter.
+		if err = e.load(); err != nil {
+			e.log.Error(`Unable to reload script file "%s", keeping the current script: %s!`, e.file, err.Error())
+			continue
+		}
+		e.log.Info(`Script file "%s" was changed and reloaded.`, e.file)
+	}
+}
+func (e *engine) call(n string, f starlark.Value, v ...starlark.Value) (starlark.Value, bool) {
+	t := &starlark.Thread{Name: n}
+	t.SetMaxExecutionSteps(scriptSteps)
+	r, err := starlark.Call(t, f, starlark.Tuple(v), nil)
+	if err != nil {
+		if x, ok := err.(*starlark.EvalError); ok {
+			e.log.Error(`Script function "%s" failed: %s!`, n, x.Backtrace())
+		} else {
+			e.log.Error(`Script function "%s" failed: %s!`, n, err.Error())
+		}
+		return nil, false
+	}
+	return r, true
+}
+
+// allow returns false if the "filter" function of the script returned a false value
+// for the Tweet. Tweets are allowed if the function fails.
+func (e *engine) allow(t *twitter.Tweet) bool {
+	e.lock.RLock()
+	f := e.filter
+	if e.lock.RUnlock(); f == nil {
+		return true
+	}
+	d := starlark.NewDict(6)
+	d.SetKey(starlark.String("id"), starlark.MakeInt64(t.ID))
+	d.SetKey(starlark.String("text"), starlark.String(t.Text))
+	d.SetKey(starlark.String("lang"), starlark.String(t.Lang))
+	d.SetKey(starlark.String("retweet"), starlark.Bool(t.RetweetedStatus != nil))
+	if t.User != nil {
+		d.SetKey(starlark.String("user"), starlark.String(t.User.ScreenName))
+		d.SetKey(starlark.String("name"), starlark.String(t.User.Name))
+	} else {
+		d.SetKey(starlark.String("user"), starlark.String(""))
+		d.SetKey(starlark.String("name"), starlark.String(""))
+	}
+	r, ok := e.call("filter", f, d)
+	return !ok || bool(r.Truth())
+}
+
+// change calls the "announce" function of the script with the Change and whether it
+// would be shown on the ticker. The function may return None to keep the default, a
+// boolean to show or hide the Change, or a string to show the Change with that text,
+// where an empty string hides the Change.
+func (e *engine) change(c game.Change, show bool) (string, bool) {
+	e.lock.RLock()
+	f := e.announce
+	if e.lock.RUnlock(); f == nil {
+		return "", show
+	}
+	d := starlark.NewDict(10)
+	d.SetKey(starlark.String("kind"), starlark.String(c.Kind.String()))
+	d.SetKey(starlark.String("game"), starlark.String(c.Game))
+	d.SetKey(starlark.String("team"), starlark.String(c.Team))
+	d.SetKey(starlark.String("host"), starlark.String(c.Host))
+	d.SetKey(starlark.String("other"), starlark.String(c.Other))
+	d.SetKey(starlark.String("text"), starlark.String(c.Text))
+	d.SetKey(starlark.String("old"), starlark.MakeInt64(c.Old))
+	d.SetKey(starlark.String("new"), starlark.MakeInt64(c.New))
+	d.SetKey(starlark.String("port"), starlark.MakeInt(int(c.Service)))
+	d.SetKey(starlark.String("highlight"), starlark.Bool(c.Kind.Highlight()))
+	r, ok := e.call("announce", f, d, starlark.Bool(show))
+	if !ok {
+		return "", show
+	}
+	switch v := r.(type) {
+	case starlark.NoneType:
+		return "", show
+	case starlark.Bool:
+		return "", bool(v)
+	case starlark.String:
+		return string(v), len(v) > 0
+	}
+	e.log.Warning(`Script function "announce" returned an unsupported %s value, ignoring it.`, r.Type())
+	return "", show
+}
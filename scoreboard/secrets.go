@@ -0,0 +1,362 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const reference = "secret:"
+
+type keystore struct {
+	Type   string `json:"type"`
+	Server string `json:"server,omitempty"`
+	Token  string `json:"token,omitempty"`
+	Region string `json:"region,omitempty"`
+}
+type fetcher struct {
+	k      keystore
+	cache  map[string]map[string]string
+	client *http.Client
+}
+
+func (k keystore) verify() error {
+	switch strings.ToLower(k.Type) {
+	case "":
+	case "vault":
+		if len(k.Server) == 0 {
+			return &errval{s: "the Vault secrets server is required"}
+		}
+		if _, err := url.Parse(k.Server); err != nil {
+			return &errval{s: `secrets server "` + k.Server + `" is not a valid URL`, e: err}
+		}
+	case "aws":
+		if len(k.region()) == 0 {
+			return &errval{s: "the AWS secrets region is required"}
+		}
+	default:
+		return &errval{s: `secrets type "` + k.Type + `" is not supported`}
+	}
+	return nil
+}
+func (k keystore) token() string {
+	if len(k.Token) > 0 {
+		return k.Token
+	}
+	return os.Getenv("VAULT_TOKEN")
+}
+func (k keystore) region() string {
+	if len(k.Region) > 0 {
+		return k.Region
+	}
+	if r := os.Getenv("AWS_REGION"); len(r) > 0 {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// files replaces every "<name>_file" value in the supplied decoded config with a
+// "<name>" value that has the contents of the named file, without any trailing newline.
+func files(v interface{}) error {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		for k, x := range m {
+			if err := files(x); err != nil {
+				return err
+			}
+			if !strings.HasSuffix(k, "_file") || len(k) <= 5 {
+				continue
+			}
+			p, ok := x.(string)
+			if !ok {
+				continue
+			}
+			s, err := secret(p)
+			if err != nil {
+				return err
+			}
+			delete(m, k)
+			m[k[:len(k)-5]] = s
+		}
+	case []interface{}:
+		for i := range m {
+			if err := files(m[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func secret(f string) (string, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return "", &errval{s: `cannot read secret file "` + f + `"`, e: err}
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// resolve replaces every "secret:<path>#<key>" string in the config with the value
+// fetched from the configured secrets manager. Each path is only fetched once.
+func resolve(x context.Context, c *config) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(b, []byte(`"`+reference)) {
+		return nil
+	}
+	if len(c.Secrets.Type) == 0 {
+		return &errval{s: "secret references require a secrets manager type"}
+	}
+	if err = c.Secrets.verify(); err != nil {
+		return err
+	}
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err = d.Decode(&v); err != nil {
+		return err
+	}
+	p, err := game.Proxy(c.Proxy, c.NoProxy)
+	if err != nil {
+		return err
+	}
+	f := &fetcher{k: c.Secrets, cache: make(map[string]map[string]string), client: &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: p}}}
+	if v, err = f.walk(x, v); err != nil {
+		return err
+	}
+	if b, err = json.Marshal(v); err != nil {
+		return err
+	}
+	var r config
+	if err = json.Unmarshal(b, &r); err != nil {
+		return &errval{s: "cannot apply the config secrets", e: err}
+	}
+	*c = r
+	return nil
+}
+func (f *fetcher) walk(x context.Context, v interface{}) (interface{}, error) {
+	var err error
+	switch m := v.(type) {
+	case string:
+		if !strings.HasPrefix(m, reference) {
+			return m, nil
+		}
+		return f.lookup(x, m[len(reference):])
+	case map[string]interface{}:
+		for k := range m {
+			if m[k], err = f.walk(x, m[k]); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i := range m {
+			if m[i], err = f.walk(x, m[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+func (f *fetcher) lookup(x context.Context, r string) (string, error) {
+	p, k := r, ""
+	if i := strings.LastIndexByte(r, '#'); i >= 0 {
+		p, k = r[:i], r[i+1:]
+	}
+	if len(p) == 0 {
+		return "", &errval{s: `secret reference "` + r + `" does not have a path`}
+	}
+	v, ok := f.cache[p]
+	if !ok {
+		var err error
+		switch strings.ToLower(f.k.Type) {
+		case "vault":
+			v, err = f.vault(x, p)
+		case "aws":
+			v, err = f.aws(x, p)
+		}
+		if err != nil {
+			return "", &errval{s: `cannot fetch secret "` + p + `"`, e: err}
+		}
+		f.cache[p] = v
+	}
+	if len(k) == 0 {
+		if s, ok := v[""]; ok {
+			return s, nil
+		}
+		if len(v) == 1 {
+			for _, s := range v {
+				return s, nil
+			}
+		}
+		return "", &errval{s: `secret "` + p + `" has more than one value and requires a key`}
+	}
+	s, ok := v[k]
+	if !ok {
+		return "", &errval{s: `secret "` + p + `" does not have the key "` + k + `"`}
+	}
+	return s, nil
+}
+
+// vault returns the values of the Vault secret at the supplied path, which includes
+// the mount, such as "secret/data/scoreboard" for a KV version 2 mount.
+func (f *fetcher) vault(x context.Context, p string) (map[string]string, error) {
+	r, err := http.NewRequestWithContext(x, http.MethodGet, strings.TrimRight(f.k.Server, "/")+"/v1/"+strings.TrimLeft(p, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if t := f.k.token(); len(t) > 0 {
+		r.Header.Set("X-Vault-Token", t)
+	}
+	var v struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err = f.fetch(r, &v); err != nil {
+		return nil, err
+	}
+	// KV version 2 mounts nest the values under another "data" key with the metadata.
+	if d, ok := v.Data["data"]; ok {
+		if _, ok = v.Data["metadata"]; ok {
+			v.Data = nil
+			if err = json.Unmarshal(d, &v.Data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	o := make(map[string]string, len(v.Data))
+	for n, b := range v.Data {
+		var s string
+		if json.Unmarshal(b, &s) != nil {
+			s = string(b)
+		}
+		o[n] = s
+	}
+	return o, nil
+}
+
+// aws returns the values of the AWS Secrets Manager secret with the supplied name or
+// ARN. Secrets that are JSON objects return each value by key and other secrets return
+// the secret string as the only value.
+func (f *fetcher) aws(x context.Context, p string) (map[string]string, error) {
+	a, s := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if len(a) == 0 || len(s) == 0 {
+		return nil, &errval{s: "the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables are required"}
+	}
+	var (
+		g = f.k.region()
+		u = f.k.Server
+	)
+	if len(u) == 0 {
+		u = "https://secretsmanager." + g + ".amazonaws.com/"
+	}
+	b, _ := json.Marshal(map[string]string{"SecretId": p})
+	r, err := http.NewRequestWithContext(x, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	r.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sign(r, b, a, s, os.Getenv("AWS_SESSION_TOKEN"), g, "secretsmanager", time.Now())
+	var v struct {
+		String string `json:"SecretString"`
+	}
+	if err = f.fetch(r, &v); err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if json.Unmarshal([]byte(v.String), &m) != nil {
+		return map[string]string{"": v.String}, nil
+	}
+	o := make(map[string]string, len(m))
+	for n, b := range m {
+		var s string
+		if json.Unmarshal(b, &s) != nil {
+			s = string(b)
+		}
+		o[n] = s
+	}
+	return o, nil
+}
+func (f *fetcher) fetch(r *http.Request, v interface{}) error {
+	o, err := f.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer o.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(o.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if o.StatusCode != http.StatusOK {
+		return &errval{s: "secrets manager returned status " + o.Status}
+	}
+	return json.Unmarshal(b, v)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the supplied request.
+// Only the Content-Type and X-Amz-Target headers are signed, so any other headers set
+// on the request must not be required to be signed. The payload hash is sent in the
+// X-Amz-Content-Sha256 header, which S3 requires.
+func sign(r *http.Request, b []byte, a, s, t, g, n string, d time.Time) {
+	var (
+		q = sha256.Sum256(b)
+		x = hex.EncodeToString(q[:])
+		z = d.UTC().Format("20060102T150405Z")
+		y = z[:8] + "/" + g + "/" + n + "/aws4_request"
+		h = "content-type;host;x-amz-content-sha256;x-amz-date"
+		c = "content-type:" + r.Header.Get("Content-Type") + "\nhost:" + r.URL.Host + "\nx-amz-content-sha256:" + x + "\nx-amz-date:" + z + "\n"
+	)
+	r.Header.Set("X-Amz-Date", z)
+	r.Header.Set("X-Amz-Content-Sha256", x)
+	if len(t) > 0 {
+		r.Header.Set("X-Amz-Security-Token", t)
+		h, c = h+";x-amz-security-token", c+"x-amz-security-token:"+t+"\n"
+	}
+	if v := r.Header.Get("X-Amz-Target"); len(v) > 0 {
+		h, c = h+";x-amz-target", c+"x-amz-target:"+v+"\n"
+	}
+	p := r.URL.EscapedPath()
+	if len(p) == 0 {
+		p = "/"
+	}
+	var (
+		e = sha256.Sum256([]byte(r.Method + "\n" + p + "\n" + r.URL.RawQuery + "\n" + c + "\n" + h + "\n" + x))
+		k = []byte("AWS4" + s)
+	)
+	for _, v := range []string{z[:8], g, n, "aws4_request"} {
+		k = mac(k, v)
+	}
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+a+"/"+y+", SignedHeaders="+h+", Signature="+hex.EncodeToString(mac(k, "AWS4-HMAC-SHA256\n"+z+"\n"+y+"\n"+hex.EncodeToString(e[:]))))
+}
+func mac(k []byte, s string) []byte {
+	h := hmac.New(sha256.New, k)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
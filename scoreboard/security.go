@@ -0,0 +1,158 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// nonceMark is written by the "nonce" template function in place of the nonce, so
+// rendered pages can be cached and the nonce of each request is added when the page is
+// sent.
+const nonceMark = "\x00scoreboard-nonce\x00"
+
+// policy is the default Content Security Policy. Effects run the scripts sent by
+// Scorebot with eval, and the video popup is a YouTube frame, so both are allowed. The
+// "{nonce}" value is replaced with the nonce of each request.
+const policy = "default-src 'self'; script-src 'self' 'nonce-{nonce}' 'unsafe-eval'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: https:; media-src 'self' https:; frame-src https://www.youtube-nocookie.com; connect-src 'self'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'"
+
+type nonceKey struct{}
+
+// shield is the security headers sent with every response. Empty values use the
+// defaults, the "frames" paths can be framed by the "ancestors" sources so the widgets
+// can be embedded in stream overlays and other sites, and HSTS is only sent when TLS is
+// used.
+type shield struct {
+	Policy    string   `json:"policy,omitempty"`
+	Referrer  string   `json:"referrer,omitempty"`
+	Frames    []string `json:"frames,omitempty"`
+	Ancestors []string `json:"ancestors,omitempty"`
+	HSTS      int      `json:"hsts,omitempty"`
+	Disabled  bool     `json:"disabled,omitempty"`
+}
+
+func (h shield) verify() error {
+	if h.Disabled {
+		return nil
+	}
+	if strings.ContainsAny(h.Policy, "\r\n") {
+		return &errval{s: "security policy cannot contain newlines"}
+	}
+	// The frame ancestors are set from the frames and ancestors values, so each path
+	// gets the right value.
+	if strings.Contains(strings.ToLower(h.Policy), "frame-ancestors") {
+		return &errval{s: `security policy cannot contain "frame-ancestors", use the "frames" and "ancestors" values instead`}
+	}
+	switch h.Referrer {
+	case "", "no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin", "same-origin",
+		"strict-origin", "strict-origin-when-cross-origin", "unsafe-url":
+	default:
+		return &errval{s: `security referrer "` + h.Referrer + `" is not a valid Referrer-Policy`}
+	}
+	for _, v := range h.Frames {
+		if len(v) == 0 || v[0] != '/' {
+			return &errval{s: `security frame path "` + v + `" must start with "/"`}
+		}
+	}
+	for _, v := range h.Ancestors {
+		if len(v) == 0 || strings.ContainsAny(v, " ;,\r\n") {
+			return &errval{s: `security frame ancestor "` + v + `" is not valid`}
+		}
+	}
+	return nil
+}
+func (h *shield) defaults() {
+	if len(h.Policy) == 0 {
+		h.Policy = policy
+	}
+	if len(h.Referrer) == 0 {
+		h.Referrer = "strict-origin-when-cross-origin"
+	}
+	// An empty list stops every page from being framed, while a missing list allows
+	// the podium and attack map widgets.
+	if h.Frames == nil {
+		h.Frames = []string{"/podium", "/attacks"}
+	}
+	if len(h.Ancestors) == 0 {
+		h.Ancestors = []string{"*"}
+	}
+	if h.HSTS == 0 {
+		h.HSTS = 31536000
+	}
+}
+
+// nonce returns the nonce of the request, or an empty string if the security headers
+// are disabled.
+func nonce(r *http.Request) string {
+	if v, ok := r.Context().Value(nonceKey{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// framed returns true if the path can be framed by other sites. Tenant paths are
+// checked without the tenant prefix, as tenants are served with the headers of the
+// main Scoreboard.
+func (h *shield) framed(p string) bool {
+	p = unprefixed(p)
+	for _, v := range h.Frames {
+		if p == v || (strings.HasPrefix(p, v) && (v[len(v)-1] == '/' || p[len(v)] == '/')) {
+			return true
+		}
+	}
+	return false
+}
+
+// secure sets the security headers of the response and adds a new nonce to the request
+// context for the inline scripts of the rendered pages.
+func (s *Scoreboard) secure(h http.Handler) http.Handler {
+	if s.shield == nil {
+		return h
+	}
+	var (
+		f = "; frame-ancestors " + strings.Join(s.shield.Ancestors, " ")
+		t string
+	)
+	if s.shield.HSTS > 0 && len(s.cert) > 0 && len(s.key) > 0 {
+		t = "max-age=" + strconv.Itoa(s.shield.HSTS) + "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b [16]byte
+		rand.Read(b[:])
+		n := base64.StdEncoding.EncodeToString(b[:])
+		v := w.Header()
+		if s.shield.framed(r.URL.Path) {
+			v.Set("Content-Security-Policy", strings.ReplaceAll(s.shield.Policy, "{nonce}", n)+f)
+		} else {
+			v.Set("X-Frame-Options", "DENY")
+			v.Set("Content-Security-Policy", strings.ReplaceAll(s.shield.Policy, "{nonce}", n)+"; frame-ancestors 'none'")
+		}
+		v.Set("Referrer-Policy", s.shield.Referrer)
+		v.Set("X-Content-Type-Options", "nosniff")
+		if len(t) > 0 {
+			v.Set("Strict-Transport-Security", t)
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nonceKey{}, n)))
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+)
+
+const (
+	reportQueue   = 64
+	reportRestart = time.Second
+)
+
+// reporter sends recovered panics, and logged errors if enabled, to Sentry or any
+// service that supports the Sentry store API.
+type reporter struct {
+	log    logx.Log
+	client *http.Client
+	queue  chan report
+	url    string
+	auth   string
+	env    string
+	host   string
+}
+type reporting struct {
+	DSN         string `json:"dsn"`
+	Environment string `json:"environment,omitempty"`
+	Errors      bool   `json:"errors"`
+}
+type report struct {
+	Time        time.Time         `json:"timestamp"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Exception   *exceptions       `json:"exception,omitempty"`
+	ID          string            `json:"event_id"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Platform    string            `json:"platform"`
+	Server      string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+}
+type exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+type exceptions struct {
+	Values []exception `json:"values"`
+}
+
+func (r reporting) verify() error {
+	if len(r.DSN) == 0 {
+		return nil
+	}
+	if _, _, err := dsn(r.DSN); err != nil {
+		return err
+	}
+	return nil
+}
+
+// dsn returns the store API URL and the public key of the Sentry DSN, which has the
+// format "https://<key>@<host>/<project>".
+func dsn(s string) (string, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", &errval{s: `sentry DSN "` + s + `" is not valid`, e: err}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", &errval{s: `sentry DSN scheme "` + u.Scheme + `" is not supported`}
+	}
+	if u.User == nil || len(u.User.Username()) == 0 {
+		return "", "", &errval{s: "sentry DSN is missing the public key"}
+	}
+	p := strings.Trim(u.Path, "/")
+	if len(p) == 0 {
+		return "", "", &errval{s: "sentry DSN is missing the project ID"}
+	}
+	k := u.User.Username()
+	d, n := path.Split(p)
+	u.User, u.Path = nil, "/"+d+"api/"+n+"/store/"
+	return u.String(), k, nil
+}
+func newReporter(r reporting, c *http.Client, l logx.Log) *reporter {
+	v := &reporter{log: l, env: r.Environment, queue: make(chan report, reportQueue), client: c}
+	var k string
+	v.url, k, _ = dsn(r.DSN)
+	v.auth = "Sentry sentry_version=7, sentry_client=scoreboard/" + version + ", sentry_key=" + k
+	v.host, _ = os.Hostname()
+	return v
+}
+
+// panic queues a report of a recovered panic with the component and game tags.
+func (r *reporter) panic(n, g string, v interface{}, b []byte) {
+	t := map[string]string{"component": n}
+	if len(g) > 0 {
+		t["game"] = g
+	}
+	r.push(report{
+		Tags:      t,
+		Level:     "fatal",
+		Extra:     map[string]string{"stack": string(b)},
+		Exception: &exceptions{Values: []exception{{Type: "panic", Value: fmt.Sprint(v)}}},
+	})
+}
+
+// error queues a report of a logged error with the component tag.
+func (r *reporter) error(n, s string) {
+	r.push(report{Tags: map[string]string{"component": n}, Level: "error", Logger: n, Message: s})
+}
+
+// game returns the Report function of the named game, the main Game has no name.
+func (r *reporter) game(g string) func(string, interface{}, []byte) {
+	return func(n string, v interface{}, b []byte) {
+		r.panic(n, g, v, b)
+	}
+}
+func (r *reporter) push(v report) {
+	var b [16]byte
+	rand.Read(b[:])
+	v.ID, v.Time, v.Platform = hex.EncodeToString(b[:]), time.Now().UTC(), "go"
+	v.Release, v.Server, v.Environment = version, r.host, r.env
+	select {
+	case r.queue <- v:
+	default:
+	}
+}
+func (r *reporter) start(x context.Context) {
+	for {
+		select {
+		case <-x.Done():
+			return
+		case v := <-r.queue:
+			r.send(x, v)
+		}
+	}
+}
+func (r *reporter) send(x context.Context, v report) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	q, err := http.NewRequestWithContext(x, http.MethodPost, r.url, bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	q.Header.Set("Content-Type", "application/json")
+	q.Header.Set("X-Sentry-Auth", r.auth)
+	// Errors sending the report are logged as warnings, since logged errors are also
+	// reported and would be sent again.
+	o, err := r.client.Do(q)
+	if err != nil {
+		r.log.Warning("Unable to send the error report: %s!", err.Error())
+		return
+	}
+	if o.Body.Close(); o.StatusCode >= 300 {
+		r.log.Warning("Error report was rejected with status code %d!", o.StatusCode)
+	}
+}
+
+// recovered logs and reports a panic recovered from the named component. This must be
+// called from the deferred function, so the stack contains the panic.
+func (s *Scoreboard) recovered(n string, v interface{}) {
+	b := debug.Stack()
+	s.log.with(n).Error("Recovered from a panic: %s!", v)
+	if s.report != nil {
+		s.report.panic(n, "", v, b)
+	}
+}
+
+// protect wraps the Handler to recover from any panic in a request, so a failing
+// request only returns an error to that client.
+func (s *Scoreboard) protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			s.recovered("web", v)
+			if c, ok := w.(*recorder); !ok || c.code == 0 {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// supervise runs the function until the context is done, starting it again after a
+// short wait if it panics.
+func (s *Scoreboard) supervise(x context.Context, n string, f func(context.Context)) {
+	for {
+		if s.run(x, n, f) {
+			return
+		}
+		t := time.NewTimer(reportRestart)
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		s.log.with(n).Warning("Restarting after a panic..")
+	}
+}
+func (s *Scoreboard) run(x context.Context, n string, f func(context.Context)) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.recovered(n, v)
+			ok = false
+		}
+	}()
+	f(x)
+	return true
+}
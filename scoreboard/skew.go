@@ -0,0 +1,63 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+type skewed struct {
+	Time       *time.Time `json:"time,omitempty"`
+	Game       string     `json:"game"`
+	Skew       float64    `json:"skew"`
+	Correction float64    `json:"correction"`
+	Auto       bool       `json:"auto"`
+}
+
+// httpSkew lists the measured clock skew of the Source of each Game, in seconds, with
+// the correction that is taken off the event times. The main Game has an empty name.
+func (s *Scoreboard) httpSkew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	n := make([]string, 0, len(s.games))
+	for k := range s.games {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	v := make([]skewed, 0, len(n)+1)
+	v = append(v, measure("", s.Skew()))
+	for _, k := range n {
+		v = append(v, measure(k, s.games[k].Skew()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+func measure(n string, d game.Drift) skewed {
+	k := skewed{Game: n, Skew: d.Skew.Seconds(), Correction: d.Correction.Seconds(), Auto: d.Auto}
+	if !d.Time.IsZero() {
+		k.Time = &d.Time
+	}
+	return k
+}
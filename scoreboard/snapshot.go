@@ -0,0 +1,250 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// Snapshot images are sized for the preview cards of social posts (16:9).
+const (
+	snapWidth  = 1200
+	snapHeight = 675
+	snapRows   = 10
+)
+
+var (
+	snapBack   = color.RGBA{0, 0, 0, 255}
+	snapRow    = color.RGBA{11, 24, 14, 255}
+	snapBar    = color.RGBA{40, 111, 36, 255}
+	snapTitle  = color.RGBA{62, 146, 46, 255}
+	snapText   = color.RGBA{255, 255, 255, 255}
+	snapMuted  = color.RGBA{173, 164, 21, 255}
+	snapBorder = color.RGBA{40, 40, 40, 255}
+)
+
+// glyphs is a 5x7 pixel font for the characters from ' ' to '_', which matches the
+// pixel font of the scoreboard. Each row is five bits, with the left pixel as the
+// high bit. Lowercase letters are drawn as uppercase and any other character as '?'.
+var glyphs = [64][7]uint8{
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // ' '
+	{0x04, 0x04, 0x04, 0x04, 0x00, 0x00, 0x04}, // '!'
+	{0x0A, 0x0A, 0x0A, 0x00, 0x00, 0x00, 0x00}, // '"'
+	{0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A}, // '#'
+	{0x04, 0x0F, 0x14, 0x0E, 0x05, 0x1E, 0x04}, // '$'
+	{0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03}, // '%'
+	{0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D}, // '&'
+	{0x0C, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00}, // '''
+	{0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02}, // '('
+	{0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08}, // ')'
+	{0x00, 0x04, 0x15, 0x0E, 0x15, 0x04, 0x00}, // '*'
+	{0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00}, // '+'
+	{0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08}, // ','
+	{0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00}, // '-'
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C}, // '.'
+	{0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00}, // '/'
+	{0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E}, // '0'
+	{0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E}, // '1'
+	{0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F}, // '2'
+	{0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E}, // '3'
+	{0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02}, // '4'
+	{0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E}, // '5'
+	{0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E}, // '6'
+	{0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08}, // '7'
+	{0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E}, // '8'
+	{0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C}, // '9'
+	{0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00}, // ':'
+	{0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x04, 0x08}, // ';'
+	{0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02}, // '<'
+	{0x00, 0x00, 0x1F, 0x00, 0x1F, 0x00, 0x00}, // '='
+	{0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08}, // '>'
+	{0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04}, // '?'
+	{0x0E, 0x11, 0x01, 0x0D, 0x15, 0x15, 0x0E}, // '@'
+	{0x0E, 0x11, 0x11, 0x11, 0x1F, 0x11, 0x11}, // 'A'
+	{0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E}, // 'B'
+	{0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E}, // 'C'
+	{0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C}, // 'D'
+	{0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F}, // 'E'
+	{0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10}, // 'F'
+	{0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F}, // 'G'
+	{0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11}, // 'H'
+	{0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E}, // 'I'
+	{0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C}, // 'J'
+	{0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11}, // 'K'
+	{0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F}, // 'L'
+	{0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11}, // 'M'
+	{0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11}, // 'N'
+	{0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}, // 'O'
+	{0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10}, // 'P'
+	{0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D}, // 'Q'
+	{0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11}, // 'R'
+	{0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E}, // 'S'
+	{0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04}, // 'T'
+	{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}, // 'U'
+	{0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04}, // 'V'
+	{0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A}, // 'W'
+	{0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11}, // 'X'
+	{0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04}, // 'Y'
+	{0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F}, // 'Z'
+	{0x0E, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0E}, // '['
+	{0x00, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00}, // '\'
+	{0x0E, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0E}, // ']'
+	{0x04, 0x0A, 0x11, 0x00, 0x00, 0x00, 0x00}, // '^'
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F}, // '_'
+}
+
+type canvas struct {
+	*image.RGBA
+}
+
+// advance returns the width of a character drawn at the scale, including the space
+// after it.
+func advance(z int) int {
+	return z * 6
+}
+func (c canvas) fill(r image.Rectangle, v color.RGBA) {
+	draw.Draw(c.RGBA, r, &image.Uniform{C: v}, image.Point{}, draw.Src)
+}
+
+// text draws the string with the top left corner at x, y and returns the x position
+// after it. The string is cut with a ".." if it is wider than w pixels.
+func (c canvas) text(s string, x, y, z, w int, v color.RGBA) int {
+	r := []rune(s)
+	if n := w / advance(z); len(r) > n {
+		if n < 2 {
+			return x
+		}
+		r = append(r[:n-2], '.', '.')
+	}
+	for _, k := range r {
+		if k >= 'a' && k <= 'z' {
+			k -= 'a' - 'A'
+		}
+		if k < ' ' || k > '_' {
+			k = '?'
+		}
+		g := glyphs[k-' ']
+		for i := range g {
+			for j := 0; j < 5; j++ {
+				if g[i]&(0x10>>uint(j)) != 0 {
+					c.fill(image.Rect(x+j*z, y+i*z, x+(j+1)*z, y+(i+1)*z), v)
+				}
+			}
+		}
+		x += advance(z)
+	}
+	return x
+}
+
+// right draws the string so it ends at x, which ignores the space after the last
+// character.
+func (c canvas) right(s string, x, y, z int, v color.RGBA) {
+	c.text(s, x-len(s)*advance(z)+z, y, z, len(s)*advance(z), v)
+}
+
+// render draws the top n teams of the Snapshot, with a bar that shows the score of each
+// team compared to the leading team. The time of the Snapshot is shown in the time zone.
+func render(v game.Snapshot, n int, l *time.Location) *image.RGBA {
+	c := canvas{image.NewRGBA(image.Rect(0, 0, snapWidth, snapHeight))}
+	c.fill(c.Bounds(), snapBack)
+	c.fill(image.Rect(0, 0, snapWidth, 6), snapTitle)
+	c.text(v.Game, 40, 36, 6, snapWidth-80, snapTitle)
+	c.text(v.Time.In(l).Format("2006-01-02 15:04 MST"), 40, 96, 3, snapWidth-80, snapMuted)
+	if n > len(v.Teams) {
+		n = len(v.Teams)
+	}
+	var m int64 = 1
+	for i := 0; i < n; i++ {
+		if v.Teams[i].Score > m {
+			m = v.Teams[i].Score
+		}
+	}
+	const (
+		y = 140
+		h = (snapHeight - y - 20) / snapRows
+	)
+	for i := 0; i < n; i++ {
+		var (
+			p = v.Teams[i]
+			r = image.Rect(30, y+i*h, snapWidth-30, y+(i+1)*h-4)
+			s = strconv.FormatInt(p.Score, 10)
+		)
+		c.fill(r, snapRow)
+		if p.Score > 0 {
+			c.fill(image.Rect(r.Min.X, r.Min.Y, r.Min.X+int(int64(r.Dx())*p.Score/m), r.Max.Y), snapBar)
+		}
+		c.fill(image.Rect(r.Min.X, r.Max.Y-2, r.Max.X, r.Max.Y), snapBorder)
+		o := r.Min.Y + (r.Dy()-28)/2
+		c.text(strconv.FormatInt(p.Rank, 10), r.Min.X+12, o, 4, advance(4)*3, snapMuted)
+		c.text(p.Name, r.Min.X+100, o, 4, r.Dx()-130-len(s)*advance(4), snapText)
+		c.right(s, r.Max.X-12, o, 4, snapText)
+	}
+	if n == 0 {
+		c.text("No teams", 40, y+20, 4, snapWidth-80, snapMuted)
+	}
+	return c.RGBA
+}
+
+// httpSnapshot returns a PNG image of the standings of the Game that can be attached to
+// social posts. The standings shown on the display are used, so the image of a frozen
+// Game does not show the live standings unless the request has the admin token.
+func (s *Scoreboard) httpSnapshot(w http.ResponseWriter, r *http.Request) {
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	var (
+		q = r.URL.Query()
+		a = s.permitted(r, true, scopeScores)
+		n = snapRows
+		v game.Snapshot
+	)
+	if t := q.Get("top"); len(t) > 0 {
+		if n, _ = strconv.Atoi(t); n < 1 || n > snapRows {
+			fail(w, "top must be between 1 and "+strconv.Itoa(snapRows), http.StatusBadRequest)
+			return
+		}
+	}
+	if a {
+		v, ok = m.Standings(g)
+	} else {
+		v, ok = m.Displayed(g)
+	}
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if !a {
+		v = m.Mask(v)
+	}
+	if d := q.Get("division"); len(d) > 0 {
+		v = v.Division(d)
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := png.Encode(w, render(v, n, s.timezone(r))); err != nil {
+		s.log.request(r).Error(`Error rendering snapshot for "%s": %s!`, r.RemoteAddr, err.Error())
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sponsorRotate is the default seconds that each sponsor is shown for.
+const sponsorRotate = 10
+
+// sponsorRefresh is the most seconds that displays wait before requesting the sponsors
+// again, so sponsors changed with the admin API are shown without a reload.
+const sponsorRefresh = 60
+
+// sponsors is the sponsor carousel shown in a region of the displays. Each sponsor is
+// shown in turn as often as its weight, while the time is inside its window.
+type sponsors struct {
+	Region  string    `json:"region,omitempty"`
+	List    []sponsor `json:"list,omitempty"`
+	Rotate  int       `json:"rotate,omitempty"`
+	Enabled bool      `json:"enabled"`
+}
+type sponsor struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Link   string `json:"link,omitempty"`
+	Start  string `json:"start,omitempty"`
+	End    string `json:"end,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+}
+type showing struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Link   string `json:"link,omitempty"`
+	Weight int    `json:"weight"`
+}
+
+func (s sponsors) verify() error {
+	switch strings.ToLower(s.Region) {
+	case "", "top", "bottom", "left", "right":
+	default:
+		return &errval{s: `sponsors region "` + s.Region + `" must be "top", "bottom", "left" or "right"`}
+	}
+	if s.Rotate < 0 {
+		return &errval{s: "sponsors rotate " + strconv.Itoa(s.Rotate) + " cannot be less than zero"}
+	}
+	return roster(s.List)
+}
+
+// roster checks the sponsors in the list, which is also used for lists sent to the
+// admin API.
+func roster(l []sponsor) error {
+	for i, v := range l {
+		n := "sponsor " + strconv.Itoa(i+1)
+		if len(v.Name) == 0 || len(v.Image) == 0 {
+			return &errval{s: n + " needs a name and an image"}
+		}
+		if !picture(v.Image) {
+			return &errval{s: n + ` image "` + v.Image + `" must be a path or an absolute http or https URL`}
+		}
+		if len(v.Link) > 0 && !picture(v.Link) {
+			return &errval{s: n + ` link "` + v.Link + `" must be a path or an absolute http or https URL`}
+		}
+		if v.Weight < 0 {
+			return &errval{s: n + " weight " + strconv.Itoa(v.Weight) + " cannot be less than zero"}
+		}
+		b, e, err := v.window()
+		if err != nil {
+			return &errval{s: n + " window is not valid", e: err}
+		}
+		if !b.IsZero() && !e.IsZero() && !e.After(b) {
+			return &errval{s: n + " end time must be after the start time"}
+		}
+	}
+	return nil
+}
+
+// region returns the region of the displays that the carousel is shown in, or an empty
+// string if the carousel is disabled.
+func (s sponsors) region() string {
+	if !s.Enabled {
+		return ""
+	}
+	if len(s.Region) == 0 {
+		return "bottom"
+	}
+	return strings.ToLower(s.Region)
+}
+func (v sponsor) window() (time.Time, time.Time, error) {
+	var (
+		b, e time.Time
+		err  error
+	)
+	if len(v.Start) > 0 {
+		if b, err = time.Parse(time.RFC3339, v.Start); err != nil {
+			return b, e, err
+		}
+	}
+	if len(v.End) > 0 {
+		e, err = time.Parse(time.RFC3339, v.End)
+	}
+	return b, e, err
+}
+
+// active returns the sponsors shown at the time and the seconds until the next
+// sponsor window starts or ends, up to the refresh time.
+func (s sponsors) active(n time.Time) ([]showing, int) {
+	var (
+		o = make([]showing, 0, len(s.List))
+		r = time.Duration(sponsorRefresh) * time.Second
+	)
+	for _, v := range s.List {
+		b, e, _ := v.window()
+		if !b.IsZero() && b.After(n) {
+			if d := b.Sub(n); d < r {
+				r = d
+			}
+			continue
+		}
+		if !e.IsZero() && !e.After(n) {
+			continue
+		}
+		if !e.IsZero() {
+			if d := e.Sub(n); d < r {
+				r = d
+			}
+		}
+		w := v.Weight
+		if w == 0 {
+			w = 1
+		}
+		o = append(o, showing{Name: v.Name, Image: v.Image, Link: v.Link, Weight: w})
+	}
+	return o, int((r + time.Second - 1) / time.Second)
+}
+func (s *Scoreboard) httpSponsors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.swap.RLock()
+	c := s.sponsors
+	s.swap.RUnlock()
+	l, n := c.active(time.Now())
+	t := c.Rotate
+	if t == 0 {
+		t = sponsorRotate
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rotate": t, "refresh": n, "sponsors": l})
+}
+
+// httpAdminSponsors returns or replaces the list of sponsors. Lists set with the admin
+// API are kept until the Scoreboard is restarted or the sponsors are changed by a
+// config reload.
+func (s *Scoreboard) httpAdminSponsors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.swap.RLock()
+		l := s.sponsors.List
+		s.swap.RUnlock()
+		if l == nil {
+			l = []sponsor{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l)
+		return
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var l []sponsor
+	if r.Method != http.MethodDelete {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&l); err != nil {
+			fail(w, "request body is not a valid JSON list of sponsors", http.StatusBadRequest)
+			return
+		}
+		if err := roster(l); err != nil {
+			fail(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	s.swap.Lock()
+	s.sponsors.List = l
+	s.swap.Unlock()
+	s.log.request(r).Info(`Admin "%s" set the sponsor list to %d sponsors.`, r.RemoteAddr, len(l))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,373 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// staffCache is the time a signed in staff member is kept in memory before their
+	// credentials are checked by the backend again, so the admin page does not bind
+	// to the directory with every request.
+	staffCache = time.Minute
+	// staffCacheMax is the most signed in staff members kept in memory.
+	staffCacheMax = 1024
+)
+
+// itoa64 is the alphabet of the Apache MD5 password hashes.
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// staff is the config of the backend that staff sign in to the admin API with, as well
+// as the admin token. The "tokens" backend checks the named tokens, "htpasswd" checks
+// the user names and passwords in an Apache htpasswd file, "ldap" binds to the directory
+// with the user DN and password and "oidc" checks the ID tokens of an OpenID Connect
+// provider. Allow limits the LDAP and OIDC users that can sign in, by user name, email
+// or group.
+type staff struct {
+	Type     string            `json:"type"`
+	Tokens   map[string]string `json:"tokens,omitempty"`
+	File     string            `json:"file,omitempty"`
+	Server   string            `json:"server,omitempty"`
+	DN       string            `json:"dn,omitempty"`
+	Issuer   string            `json:"issuer,omitempty"`
+	ClientID string            `json:"client_id,omitempty"`
+	Secret   string            `json:"client_secret,omitempty"`
+	Redirect string            `json:"redirect_url,omitempty"`
+	Allow    []string          `json:"allow,omitempty"`
+}
+
+// authenticator checks the credentials of a staff request, as a user name and secret,
+// and returns the name of the staff member. The user name is empty if the request has a
+// bearer token.
+type authenticator interface {
+	authenticate(context.Context, string, string) (string, bool)
+}
+
+// tokens is the "tokens" backend, the named tokens of each staff member.
+type tokens map[string]string
+
+// htpasswd is the "htpasswd" backend. The file is read again when it is changed, so
+// staff can be added without a restart.
+type htpasswd struct {
+	users map[string]string
+	file  string
+	log   *journal
+	mod   time.Time
+	lock  sync.Mutex
+}
+
+// remembered keeps the staff members that signed in with a password, by the hash of their credentials,
+// so the backend is only asked again once staffCache has passed.
+type remembered struct {
+	authenticator
+	cache map[[32]byte]signed
+	lock  sync.Mutex
+}
+type signed struct {
+	at   time.Time
+	name string
+}
+
+func (s staff) verify(t string) error {
+	switch strings.ToLower(s.Type) {
+	case "":
+		return nil
+	case "tokens":
+		if len(s.Tokens) == 0 {
+			return &errval{s: "admin auth tokens are required for the tokens backend"}
+		}
+		for k, v := range s.Tokens {
+			if len(v) < 16 {
+				return &errval{s: `admin auth token of "` + k + `" must be at least 16 characters`}
+			}
+		}
+	case "htpasswd":
+		if len(s.File) == 0 {
+			return &errval{s: "admin auth file is required for the htpasswd backend"}
+		}
+	case "ldap":
+		u, err := url.Parse(s.Server)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || len(u.Host) == 0 {
+			return &errval{s: `admin auth server "` + s.Server + `" must be an "ldap://" or "ldaps://" URL`}
+		}
+		if !strings.Contains(s.DN, "{user}") {
+			return &errval{s: `admin auth DN "` + s.DN + `" must contain "{user}"`}
+		}
+	case "oidc":
+		u, err := url.Parse(s.Issuer)
+		if err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+			return &errval{s: `admin auth issuer "` + s.Issuer + `" must be an "https://" URL`}
+		}
+		if len(s.ClientID) == 0 {
+			return &errval{s: "admin auth client ID is required for the oidc backend"}
+		}
+		if len(s.Redirect) > 0 {
+			if u, err = url.Parse(s.Redirect); err != nil || !u.IsAbs() || !strings.HasSuffix(u.Path, "/admin/callback") {
+				return &errval{s: `admin auth redirect URL "` + s.Redirect + `" must be the full URL of "/admin/callback"`}
+			}
+		}
+	default:
+		return &errval{s: `admin auth type "` + s.Type + `" is not supported`}
+	}
+	if len(t) == 0 {
+		return &errval{s: "admin auth requires the admin token"}
+	}
+	return nil
+}
+
+// backend returns the authenticator of the config, or nil if only the admin token is
+// used.
+func (s staff) backend(c *http.Client, l *journal) (authenticator, error) {
+	var a authenticator
+	switch strings.ToLower(s.Type) {
+	case "tokens":
+		return tokens(s.Tokens), nil
+	case "htpasswd":
+		h := &htpasswd{file: s.File, log: l}
+		if err := h.load(); err != nil {
+			return nil, err
+		}
+		a = h
+	case "ldap":
+		a = newDirectory(s)
+	case "oidc":
+		// ID tokens are checked locally and can expire at any time, so they are
+		// never kept.
+		return newProvider(s, c, l), nil
+	default:
+		return nil, nil
+	}
+	return &remembered{authenticator: a, cache: make(map[[32]byte]signed)}, nil
+}
+
+// allowed returns true if any of the names is in the allow list, or if the list is
+// empty.
+func allowed(a []string, n ...string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	for i := range n {
+		for x := range a {
+			if len(n[i]) > 0 && strings.EqualFold(n[i], a[x]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// password returns the user name and password of a password backend, which are read
+// from a bearer token as "user:password" if the request did not use Basic auth, as the
+// admin page only sends bearer tokens.
+func password(u, v string) (string, string) {
+	if len(u) > 0 {
+		return u, v
+	}
+	u, v, _ = strings.Cut(v, ":")
+	return u, v
+}
+func (t tokens) authenticate(_ context.Context, u, v string) (string, bool) {
+	if len(u) > 0 || len(v) == 0 {
+		return "", false
+	}
+	var n string
+	for k, s := range t {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(s)) == 1 {
+			n = k
+		}
+	}
+	return n, len(n) > 0
+}
+func (r *remembered) authenticate(x context.Context, u, v string) (string, bool) {
+	if len(v) == 0 {
+		return "", false
+	}
+	var (
+		k = sha256.Sum256([]byte(u + "\x00" + v))
+		n = time.Now()
+	)
+	r.lock.Lock()
+	c, ok := r.cache[k]
+	r.lock.Unlock()
+	if ok && n.Sub(c.at) < staffCache {
+		return c.name, true
+	}
+	s, ok := r.authenticator.authenticate(x, u, v)
+	r.lock.Lock()
+	if ok {
+		if len(r.cache) >= staffCacheMax {
+			r.cache = make(map[[32]byte]signed)
+		}
+		r.cache[k] = signed{at: n, name: s}
+	} else {
+		delete(r.cache, k)
+	}
+	r.lock.Unlock()
+	return s, ok
+}
+
+// load reads the htpasswd file if it was changed since it was last read. A file with a
+// user that has a hash that is not supported is not loaded, so the users are not
+// silently locked out. MD5 and SHA1 hashes are accepted with a warning.
+func (h *htpasswd) load() error {
+	i, err := os.Stat(h.file)
+	if err != nil {
+		return &errval{s: `unable to read admin auth file "` + h.file + `"`, e: err}
+	}
+	if i.ModTime().Equal(h.mod) && h.users != nil {
+		return nil
+	}
+	f, err := os.Open(h.file)
+	if err != nil {
+		return &errval{s: `unable to read admin auth file "` + h.file + `"`, e: err}
+	}
+	defer f.Close()
+	var (
+		s = bufio.NewScanner(f)
+		m = make(map[string]string)
+	)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if len(l) == 0 || l[0] == '#' {
+			continue
+		}
+		u, p, ok := strings.Cut(l, ":")
+		if !ok || len(u) == 0 {
+			continue
+		}
+		switch {
+		case bcrypted(p):
+		case strings.HasPrefix(p, "$apr1$") || strings.HasPrefix(p, "{SHA}"):
+			h.log.Warning(`Admin auth file "%s" user "%s" uses a weak MD5 or SHA1 hash, use a bcrypt ("-B") hash instead!`, h.file, u)
+		default:
+			return &errval{s: `admin auth file "` + h.file + `" user "` + u + `" does not use a bcrypt ("-B"), MD5 ("-m") or SHA1 ("-s") hash`}
+		}
+		m[u] = p
+	}
+	if err = s.Err(); err != nil {
+		return &errval{s: `unable to read admin auth file "` + h.file + `"`, e: err}
+	}
+	h.users, h.mod = m, i.ModTime()
+	return nil
+}
+func (h *htpasswd) authenticate(_ context.Context, u, v string) (string, bool) {
+	if u, v = password(u, v); len(u) == 0 || len(v) == 0 {
+		return "", false
+	}
+	h.lock.Lock()
+	if err := h.load(); err != nil {
+		h.log.Error("Unable to reload the admin auth file: %s!", err.Error())
+	}
+	p, ok := h.users[u]
+	h.lock.Unlock()
+	if !ok {
+		return "", false
+	}
+	if bcrypted(p) {
+		return u, bcrypt.CompareHashAndPassword([]byte(p), []byte(v)) == nil
+	}
+	var c string
+	if strings.HasPrefix(p, "{SHA}") {
+		d := sha1.Sum([]byte(v))
+		c = "{SHA}" + base64.StdEncoding.EncodeToString(d[:])
+	} else {
+		s := strings.TrimPrefix(p, "$apr1$")
+		if i := strings.IndexByte(s, '$'); i >= 0 {
+			s = s[:i]
+		}
+		c = apr1(v, s)
+	}
+	return u, subtle.ConstantTimeCompare([]byte(c), []byte(p)) == 1
+}
+
+func bcrypted(p string) bool {
+	return strings.HasPrefix(p, "$2y$") || strings.HasPrefix(p, "$2a$") || strings.HasPrefix(p, "$2b$")
+}
+
+// apr1 returns the Apache MD5 hash of the password with the salt.
+func apr1(p, s string) string {
+	if len(s) > 8 {
+		s = s[:8]
+	}
+	a := md5.Sum([]byte(p + s + p))
+	h := md5.New()
+	h.Write([]byte(p + "$apr1$" + s))
+	for i := len(p); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(a[:])
+		} else {
+			h.Write(a[:i])
+		}
+	}
+	for i := len(p); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write([]byte{p[0]})
+		}
+	}
+	f := h.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write([]byte(p))
+		} else {
+			h.Write(f)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(s))
+		}
+		if i%7 != 0 {
+			h.Write([]byte(p))
+		}
+		if i&1 != 0 {
+			h.Write(f)
+		} else {
+			h.Write([]byte(p))
+		}
+		f = h.Sum(nil)
+	}
+	var b strings.Builder
+	b.WriteString("$apr1$" + s + "$")
+	for _, v := range [...][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		n := uint32(f[v[0]])<<16 | uint32(f[v[1]])<<8 | uint32(f[v[2]])
+		for i := 0; i < 4; i++ {
+			b.WriteByte(itoa64[n&0x3F])
+			n >>= 6
+		}
+	}
+	for n, i := uint32(f[11]), 0; i < 2; i++ {
+		b.WriteByte(itoa64[n&0x3F])
+		n >>= 6
+	}
+	return b.String()
+}
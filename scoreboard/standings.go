@@ -0,0 +1,229 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+type standings struct {
+	Division  string   `json:"division,omitempty"`
+	Divisions []string `json:"divisions"`
+	game.Snapshot
+}
+
+func (s *Scoreboard) httpStandings(w http.ResponseWriter, r *http.Request) {
+	m, g, ok := s.exported(w, r)
+	if !ok {
+		return
+	}
+	// The standings shown on the display are returned, so the mobile view and other
+	// clients of the API do not show the live standings of a frozen Game.
+	var (
+		q = r.URL.Query()
+		a = s.permitted(r, true, scopeScores)
+		v game.Snapshot
+	)
+	if a {
+		v, ok = m.Standings(g)
+	} else {
+		v, ok = m.Displayed(g)
+	}
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if !a {
+		v = m.Mask(v)
+	}
+	o := standings{Division: q.Get("division"), Divisions: v.Divisions(), Snapshot: v}
+	if len(o.Division) > 0 {
+		o.Snapshot = v.Division(o.Division)
+	}
+	if o.Divisions == nil {
+		o.Divisions = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(o)
+}
+func (s *Scoreboard) httpServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	g, err := strconv.ParseUint(r.URL.Query().Get("game"), 10, 64)
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	v, ok := s.Services(g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if s.Anonymous() && !s.permitted(r, true, scopeScores) {
+		t := make([]uint64, len(v.Teams))
+		for i := range v.Teams {
+			t[i] = v.Teams[i].ID
+		}
+		p, o := s.Pseudonyms(t), make([]game.Row, len(v.Teams))
+		for i := range v.Teams {
+			o[i] = v.Teams[i]
+			o[i].Name, o[i].Services = p[v.Teams[i].ID], make([]game.Cell, len(v.Teams[i].Services))
+			// Host names often contain the team name, so they are removed too.
+			for x := range v.Teams[i].Services {
+				o[i].Services[x] = v.Teams[i].Services[x]
+				o[i].Services[x].Host = ""
+			}
+		}
+		v.Teams = o
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+func (s *Scoreboard) httpBeacons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	g, err := strconv.ParseUint(r.URL.Query().Get("game"), 10, 64)
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	v, ok := s.Beacons(g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if s.Anonymous() && !s.permitted(r, true, scopeScores) {
+		t := make([]uint64, 0, len(v.Beacons)*2)
+		for i := range v.Beacons {
+			t = append(t, v.Beacons[i].TeamID, v.Beacons[i].VictimID)
+		}
+		p := s.Pseudonyms(t)
+		for i := range v.Beacons {
+			v.Beacons[i].Team, v.Beacons[i].Victim = p[v.Beacons[i].TeamID], p[v.Beacons[i].VictimID]
+			v.Beacons[i].Host = ""
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+func (s *Scoreboard) httpHills(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	g, err := strconv.ParseUint(r.URL.Query().Get("game"), 10, 64)
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	v, ok := s.Hills(g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if s.Anonymous() && !s.permitted(r, true, scopeScores) {
+		t := make([]uint64, 0, len(v.Hills))
+		for i := range v.Hills {
+			if v.Hills[i].TeamID > 0 {
+				t = append(t, v.Hills[i].TeamID)
+			}
+		}
+		p := s.Pseudonyms(t)
+		for i := range v.Hills {
+			if v.Hills[i].TeamID > 0 {
+				v.Hills[i].Team = p[v.Hills[i].TeamID]
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+func (s *Scoreboard) httpChallenges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	g, err := strconv.ParseUint(r.URL.Query().Get("game"), 10, 64)
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	v, ok := s.Challenges(g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if s.Anonymous() && !s.permitted(r, true, scopeScores) {
+		t := make([]uint64, len(v.Teams))
+		for i := range v.Teams {
+			t[i] = v.Teams[i].ID
+		}
+		p, o := s.Pseudonyms(t), make([]game.Solver, len(v.Teams))
+		for i := range v.Teams {
+			o[i] = v.Teams[i]
+			o[i].Name = p[v.Teams[i].ID]
+		}
+		v.Teams = o
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+func (s *Scoreboard) httpCountdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		q      = r.URL.Query()
+		m      = s.Manager
+		g, err = strconv.ParseUint(q.Get("game"), 10, 64)
+	)
+	if n := q.Get("name"); len(n) > 0 {
+		if m = s.arena(n); m == nil {
+			fail(w, `game "`+n+`" does not exist`, http.StatusNotFound)
+			return
+		}
+		if err != nil || g == 0 {
+			g, err = current(m), nil
+		}
+	}
+	if err != nil || g == 0 {
+		fail(w, "a valid game ID is required", http.StatusBadRequest)
+		return
+	}
+	v, ok := m.Countdown(g)
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" does not have a clock", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
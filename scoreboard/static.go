@@ -0,0 +1,243 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// backupDefault is the default seconds between renders of the static standings page.
+const backupDefault = 30
+
+// backup is the static standings page, which is a single HTML file with no scripts or
+// other files, rendered every "interval" seconds from the standings shown on the
+// displays. The page is served at "/static-board", written to the "file" and uploaded
+// to the "bucket" S3 URL, so displays can be pointed at it if the live board stops.
+type backup struct {
+	File     string `json:"file,omitempty"`
+	Bucket   string `json:"bucket,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Interval int    `json:"interval,omitempty"`
+	Enabled  bool   `json:"enabled"`
+}
+type press struct {
+	log    *journal
+	client *http.Client
+	target *url.URL
+	page   []byte
+	lock   sync.RWMutex
+	backup
+}
+
+// still is the data of the static standings page template.
+type still struct {
+	*display
+	Standings game.Snapshot
+	Refresh   int
+	Updated   string
+}
+
+func (b backup) verify() error {
+	if !b.Enabled {
+		return nil
+	}
+	if b.Interval < 0 {
+		return &errval{s: "fallback interval " + strconv.Itoa(b.Interval) + " cannot be less than zero"}
+	}
+	if len(b.Bucket) > 0 {
+		if _, err := b.target(); err != nil {
+			return err
+		}
+		if len(keystore{Region: b.Region}.region()) == 0 {
+			return &errval{s: "the fallback bucket region is required"}
+		}
+	}
+	return nil
+}
+
+// target returns the URL the page is uploaded to. A key ending in "/" is uploaded as
+// "index.html".
+func (b backup) target() (*url.URL, error) {
+	u, err := bucket(b.Bucket, b.Region)
+	if err != nil {
+		return nil, &errval{s: "invalid fallback bucket", e: err}
+	}
+	if len(u.Path) == 0 || strings.HasSuffix(u.Path, "/") {
+		u.Path += "index.html"
+	}
+	return u, nil
+}
+
+// bucket returns the URL of the S3 bucket URL. An "s3://<bucket>/<key>" URL is changed
+// to the AWS endpoint of the bucket in the region, and a http or https URL is used as
+// is, for S3 compatible stores.
+func bucket(v, region string) (*url.URL, error) {
+	u, err := url.Parse(v)
+	if err != nil || len(u.Host) == 0 {
+		return nil, &errval{s: `bucket "` + v + `" is not a valid URL`}
+	}
+	switch u.Scheme {
+	case "s3":
+		u.Scheme, u.Host = "https", u.Host+".s3."+keystore{Region: region}.region()+".amazonaws.com"
+	case "http", "https":
+	default:
+		return nil, &errval{s: `bucket "` + v + `" must be an "s3", http or https URL`}
+	}
+	return u, nil
+}
+
+// upload signs and sends a PUT request of the body to the bucket URL, with the
+// credentials in the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables.
+func upload(x context.Context, c *http.Client, u *url.URL, region string, b []byte, kind, cache string) error {
+	a, k := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if len(a) == 0 || len(k) == 0 {
+		return &errval{s: "the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables are required"}
+	}
+	r, err := http.NewRequestWithContext(x, http.MethodPut, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", kind)
+	sign(r, b, a, k, os.Getenv("AWS_SESSION_TOKEN"), keystore{Region: region}.region(), "s3", time.Now())
+	// The Cache-Control header is stored with the object and sent to browsers and CDNs.
+	// It does not need to be signed.
+	r.Header.Set("Cache-Control", cache)
+	o, err := c.Do(r)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(o.Body, 1<<16))
+	if o.Body.Close(); o.StatusCode != http.StatusOK {
+		return &errval{s: "bucket returned status " + o.Status}
+	}
+	return nil
+}
+func newPress(b backup, c *http.Client, l *journal) *press {
+	if b.Interval == 0 {
+		b.Interval = backupDefault
+	}
+	p := &press{log: l, client: c, backup: b}
+	if len(b.Bucket) > 0 {
+		p.target, _ = b.target()
+	}
+	return p
+}
+
+// watch keeps the active Games subscribed, so the current Game has standings to render
+// when no displays are connected. The standings are read when the page is rendered.
+func (p *press) watch(_ game.Snapshot) {}
+
+// preserve renders the static standings page when started and then every interval,
+// until the context is cancelled.
+func (s *Scoreboard) preserve(x context.Context) {
+	t := time.NewTicker(time.Duration(s.press.Interval) * time.Second)
+	defer t.Stop()
+	for s.engrave(x); ; {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+			s.engrave(x)
+		}
+	}
+}
+
+// engrave renders the static standings page of the current Game, then writes and
+// uploads it. The standings shown on the displays are used, so a frozen Game does not
+// leak its live standings.
+func (s *Scoreboard) engrave(x context.Context) {
+	g := current(s.Manager)
+	v, ok := s.Displayed(g)
+	if !ok {
+		s.press.log.Debug("Game %d has no standings yet, not rendering the static page.", g)
+		return
+	}
+	v = s.Mask(v)
+	l := s.local()
+	s.swap.RLock()
+	d := &display{Game: g, Lang: s.locale, Zone: l.String(), Text: s.locales[s.locale]}
+	s.swap.RUnlock()
+	var o bytes.Buffer
+	err := s.html.ExecuteTemplate(&o, "static.html", still{
+		display:   d,
+		Standings: v,
+		Refresh:   s.press.Interval,
+		Updated:   strings.ReplaceAll(d.T("static.updated"), "{time}", v.Time.In(l).Format("2006-01-02 15:04:05 MST")),
+	})
+	if err != nil {
+		s.press.log.Error("Unable to render the static page: %s!", err.Error())
+		return
+	}
+	b := o.Bytes()
+	s.press.lock.Lock()
+	s.press.page = b
+	s.press.lock.Unlock()
+	if len(s.press.File) > 0 {
+		// The page is written to a temporary file first, so a web server showing the
+		// file never sends a partly written page.
+		f := s.press.File + ".tmp"
+		if err = os.WriteFile(f, b, 0644); err == nil {
+			err = os.Rename(f, s.press.File)
+		}
+		if err != nil {
+			s.press.log.Error(`Unable to write the static page to "%s": %s!`, s.press.File, err.Error())
+		}
+	}
+	if s.press.target != nil && s.leading() {
+		// The page is sent with "no-cache", so browsers and CDNs check for a new page
+		// each time.
+		if err = upload(x, s.press.client, s.press.target, s.press.Region, b, "text/html; charset=utf-8", "no-cache"); err != nil {
+			s.press.log.Error(`Unable to upload the static page to "%s": %s!`, s.press.Bucket, err.Error())
+		}
+	}
+	s.press.log.Trace("Rendered the static page of Game %d.", g)
+}
+
+// httpStaticBoard serves the last static standings page, or the page in the file when
+// none was rendered since the Scoreboard started.
+func (s *Scoreboard) httpStaticBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.press.lock.RLock()
+	b := s.press.page
+	s.press.lock.RUnlock()
+	if b == nil && len(s.press.File) > 0 {
+		b, _ = os.ReadFile(s.press.File)
+	}
+	if b == nil {
+		http.Error(w, "the static board has not been rendered yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
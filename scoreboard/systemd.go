@@ -0,0 +1,114 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const readyPoll = time.Millisecond * 500
+
+// notify sends the state to the systemd notify socket. This function does nothing if
+// the Scoreboard was not started by systemd with "Type=notify".
+func notify(v string) error {
+	n := os.Getenv("NOTIFY_SOCKET")
+	if len(n) == 0 {
+		return nil
+	}
+	if n[0] == '@' {
+		// Abstract socket names start with a NUL byte instead of the "@".
+		n = "\x00" + n[1:]
+	}
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	_, err = c.Write([]byte(v))
+	c.Close()
+	return err
+}
+
+// watchdog returns the systemd watchdog timeout, or zero if the watchdog is not enabled
+// for this process.
+func watchdog() time.Duration {
+	if p := os.Getenv("WATCHDOG_PID"); len(p) > 0 && p != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	v, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Microsecond
+}
+
+// systemd tells systemd that the Scoreboard is ready once the web server is listening
+// and the first update of the main Game has finished, and then pets the watchdog, if
+// enabled, as long as the update ticks keep running. A stuck update thread stops the
+// watchdog, so systemd restarts the Scoreboard.
+func (s *Scoreboard) systemd(x context.Context, b <-chan struct{}) {
+	if len(os.Getenv("NOTIFY_SOCKET")) == 0 {
+		return
+	}
+	l := s.log.with("systemd")
+	select {
+	case <-x.Done():
+		return
+	case <-b:
+	}
+	t := time.NewTicker(readyPoll)
+	for s.Stats().Updated.IsZero() {
+		select {
+		case <-x.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+	t.Stop()
+	if err := notify("READY=1\nSTATUS=Serving on " + s.Addr); err != nil {
+		l.Error("Unable to send the ready state to systemd: %s!", err.Error())
+		return
+	}
+	l.Debug("Sent the ready state to systemd.")
+	w := watchdog()
+	if w <= 0 {
+		return
+	}
+	if d := time.Duration(s.conf.Source.interval(s.conf.Tick)) * time.Second; d >= w || time.Duration(s.conf.Clock.Adaptive.Slow)*time.Second >= w {
+		l.Warning("The watchdog timeout %s is shorter than the tick, the watchdog may restart the Scoreboard!", w.String())
+	}
+	t = time.NewTicker(w / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+		}
+		if v := s.Stats().Ticked; time.Since(v) > w {
+			l.Warning("No update tick has run since %s, not petting the watchdog!", v.Format(time.RFC3339))
+			continue
+		}
+		if err := notify("WATCHDOG=1"); err != nil {
+			l.Error("Unable to pet the systemd watchdog: %s!", err.Error())
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+const (
+	// teamMentions is the most Tweets kept to find the mentions of team handles in.
+	teamMentions = 200
+	// teamEvents is the most captures returned for a team.
+	teamEvents = 50
+)
+
+// captures are the kinds of events returned as the captures of a team.
+var captures = [...]string{"flag", "first_blood", "beacon"}
+
+// handles is the Twitter handle of teams, by team name or ID, which is used to find
+// the Tweets that mention the team.
+type handles map[string]string
+type mention struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Name string    `json:"name"`
+	Text string    `json:"text"`
+	ID   uint64    `json:"id"`
+}
+
+// mentions is the list of the latest Tweets sent to the Games, the most recent last.
+type mentions struct {
+	lock sync.Mutex
+	list []mention
+}
+type capture struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	Text string    `json:"text"`
+}
+type station struct {
+	Name string `json:"name"`
+	game.Cell
+}
+type profile struct {
+	Game     string        `json:"game"`
+	Team     game.Standing `json:"team"`
+	Services []station     `json:"services"`
+	History  [][2]int64    `json:"history"`
+	Events   []capture     `json:"events"`
+	Mentions []mention     `json:"mentions"`
+	GameID   uint64        `json:"game_id"`
+}
+
+func (h handles) verify() error {
+	for k, v := range h {
+		if len(k) == 0 {
+			return &errval{s: "team handle names cannot be empty"}
+		}
+		if v = strings.TrimPrefix(v, "@"); len(v) == 0 || len(v) > 15 || strings.Trim(v, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") != "" {
+			return &errval{s: `team "` + k + `" handle "` + h[k] + `" is not a valid Twitter handle`}
+		}
+	}
+	return nil
+}
+
+// find returns the handle of the team, without the "@", by the team ID or name.
+func (h handles) find(i uint64, n string) string {
+	v, ok := h[strconv.FormatUint(i, 10)]
+	if !ok {
+		for k := range h {
+			if strings.EqualFold(k, n) {
+				v = h[k]
+				break
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimPrefix(v, "@"))
+}
+func (l *mentions) add(t *twitter.Tweet) {
+	v := mention{ID: uint64(t.ID), Text: t.Text, Time: time.Now().UTC()}
+	if t.User != nil {
+		v.User, v.Name = t.User.ScreenName, t.User.Name
+	}
+	if c, err := t.CreatedAtTime(); err == nil {
+		v.Time = c.UTC()
+	}
+	l.lock.Lock()
+	if len(l.list) >= teamMentions {
+		l.list = append(l.list[:0], l.list[1:]...)
+	}
+	l.list = append(l.list, v)
+	l.lock.Unlock()
+}
+
+// find returns the Tweets sent by or mentioning the handle, the most recent first.
+func (l *mentions) find(h string) []mention {
+	o := make([]mention, 0)
+	if len(h) == 0 {
+		return o
+	}
+	l.lock.Lock()
+	for i := len(l.list) - 1; i >= 0; i-- {
+		if strings.EqualFold(l.list[i].User, h) || strings.Contains(strings.ToLower(l.list[i].Text), "@"+h) {
+			o = append(o, l.list[i])
+		}
+	}
+	l.lock.Unlock()
+	return o
+}
+
+// httpTeam returns the details of a single team, which are the standing, service
+// status, score history, captures and the Tweets that mention the team handle. The
+// Game is selected with the "game" or "name" query value, or is the current Game.
+func (s *Scoreboard) httpTeam(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	t, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/teams"), "/"), 10, 64)
+	if err != nil || t == 0 {
+		fail(w, "a valid team ID is required", http.StatusBadRequest)
+		return
+	}
+	var (
+		q = r.URL.Query()
+		m = s.Manager
+		g uint64
+	)
+	if n := q.Get("name"); len(n) > 0 {
+		if m = s.arena(n); m == nil {
+			fail(w, `game "`+n+`" does not exist`, http.StatusNotFound)
+			return
+		}
+		g = current(m)
+	}
+	if v := q.Get("game"); len(v) > 0 {
+		if g, err = strconv.ParseUint(v, 10, 64); err != nil {
+			fail(w, "a valid game ID is required", http.StatusBadRequest)
+			return
+		}
+	}
+	if g == 0 {
+		g = current(m)
+	}
+	a := s.permitted(r, true, scopeScores)
+	// The standings shown on the display are used, so the team page does not show the
+	// live standings of a frozen Game.
+	v, ok := m.Displayed(g)
+	if a {
+		v, ok = m.Standings(g)
+	}
+	if !ok {
+		fail(w, "game "+strconv.FormatUint(g, 10)+" is not being tracked", http.StatusNotFound)
+		return
+	}
+	if !a {
+		v = m.Mask(v)
+	}
+	o := profile{Game: v.Game, GameID: v.GameID, Services: []station{}, History: [][2]int64{}, Events: []capture{}, Mentions: []mention{}}
+	ok = false
+	for i := range v.Teams {
+		if v.Teams[i].ID == t {
+			o.Team, ok = v.Teams[i], true
+			break
+		}
+	}
+	if !ok {
+		fail(w, "team "+strconv.FormatUint(t, 10)+" is not in game "+strconv.FormatUint(g, 10), http.StatusNotFound)
+		return
+	}
+	p := !a && m.Anonymous()
+	if x, ok := m.Services(g); ok {
+		for i := range x.Teams {
+			if x.Teams[i].ID != t {
+				continue
+			}
+			for k := range x.Teams[i].Services {
+				if k >= len(x.Services) {
+					break
+				}
+				c := station{Name: x.Services[k], Cell: x.Teams[i].Services[k]}
+				if p {
+					// Host names often contain the team name, so they are removed too.
+					c.Host = ""
+				}
+				o.Services = append(o.Services, c)
+			}
+			break
+		}
+	}
+	// Only the main Games are recorded in the history store. The history of a frozen
+	// Game ends at the time of the freeze, unless the request has the admin token.
+	if s.store != nil && m == s.Manager {
+		e := time.Now()
+		if f, ok := held(m, g); ok && !a {
+			e = f
+		}
+		l, err := s.store.timeline(r.Context(), g, 0, e.UnixMilli(), 0, map[uint64]struct{}{t: {}})
+		if err != nil {
+			s.log.request(r).Error(`Error reading history for "%s": %s!`, r.RemoteAddr, err.Error())
+		} else if len(l.Series) > 0 {
+			o.History = l.Series[0].Points
+		}
+		var x *strings.Replacer
+		if p {
+			x = replacer(m, g)
+		}
+		for _, k := range captures {
+			c, err := s.store.Latest(r.Context(), g, t, k, e, teamEvents)
+			if err != nil {
+				s.log.request(r).Error(`Error reading events for "%s": %s!`, r.RemoteAddr, err.Error())
+				break
+			}
+			for i := range c {
+				if x != nil {
+					c[i].Text = x.Replace(c[i].Text)
+				}
+				o.Events = append(o.Events, capture{Time: c[i].Time, Kind: c[i].Kind, Text: c[i].Text})
+			}
+		}
+		sort.SliceStable(o.Events, func(i, j int) bool { return o.Events[i].Time.After(o.Events[j].Time) })
+		if len(o.Events) > teamEvents {
+			o.Events = o.Events[:teamEvents]
+		}
+	}
+	// The handle would show who the team is, so mentions are not returned while team
+	// names are hidden.
+	if !p {
+		s.swap.RLock()
+		h := s.handles.find(t, o.Team.Name)
+		s.swap.RUnlock()
+		o.Mentions = s.heard.find(h)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(o)
+}
+
+// httpTeamPage returns the detail page of the team in the path, which loads the
+// details from the team API. The Game is selected the same way as the team API.
+func (s *Scoreboard) httpTeamPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	t, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(r.URL.Path, "/team"), "/"), 10, 64)
+	if err != nil || t == 0 {
+		http.Error(w, "a valid team ID is required", http.StatusNotFound)
+		return
+	}
+	var (
+		q = r.URL.Query()
+		o = strings.ToLower(q.Get("name"))
+		v uint64
+	)
+	if len(o) > 0 && s.arena(o) == nil {
+		http.Error(w, `game "`+o+`" does not exist`, http.StatusNotFound)
+		return
+	}
+	if n := q.Get("game"); len(n) > 0 {
+		if v, err = strconv.ParseUint(n, 10, 64); err != nil {
+			http.Error(w, "a valid game ID is required", http.StatusBadRequest)
+			return
+		}
+	}
+	l := s.language(r)
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", l)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	d := &display{Game: v, Team: t, Route: o, Lang: l, Zone: s.timezone(r).String(), Text: s.locales[l], Access: accessible(r)}
+	if err := s.render(w, r, "team.html", d.key(), d); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		s.web.request(r).Error(`Error during request from "%s": %s!`, r.RemoteAddr, err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"net/http"
+	"strings"
+)
+
+type tenant struct {
+	Name   string `json:"name"`
+	Config string `json:"config"`
+}
+
+func (t tenant) verify() error {
+	if len(t.Name) == 0 {
+		return &errval{s: "tenant name cannot be empty"}
+	}
+	for _, c := range t.Name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return &errval{s: `tenant name "` + t.Name + `" can only contain lowercase letters, numbers, "-" and "_"`}
+		}
+	}
+	if len(t.Config) == 0 {
+		return &errval{s: `tenant "` + t.Name + `" config file cannot be empty`}
+	}
+	return nil
+}
+
+// tenants builds the tenant Scoreboard from its config file and serves it under the
+// "/e/<name>/" path. Tenant configs start from the default config instead of the
+// command line values, so no values of the main Scoreboard are shared with a tenant.
+// The listen, TLS, security and debug values of a tenant are not used, as tenants are
+// served by the main Scoreboard.
+func (s *Scoreboard) tenants(t tenant) error {
+	if _, ok := s.tenant[t.Name]; ok {
+		return &errval{s: `tenant "` + t.Name + `" is already defined`}
+	}
+	c, err := load([]byte(defaults), t.Config, nil)
+	if err != nil {
+		return &errval{s: `unable to load the config of tenant "` + t.Name + `"`, e: err}
+	}
+	if len(c.Tenants) > 0 {
+		return &errval{s: `tenant "` + t.Name + `" cannot have its own tenants`}
+	}
+	if c.Debug.Enabled {
+		return &errval{s: `tenant "` + t.Name + `" cannot enable the debug server`}
+	}
+	if len(c.RPC.Listen) > 0 {
+		return &errval{s: `tenant "` + t.Name + `" cannot serve the gRPC API`}
+	}
+	w := c.copy()
+	w.dial = s.dial
+	v, err := w.build(t.Name)
+	if err != nil {
+		return &errval{s: `unable to setup tenant "` + t.Name + `"`, e: err}
+	}
+	v.file, v.base, v.conf = t.Config, []byte(defaults), c
+	v.revise("start", 0)
+	if s.tenant == nil {
+		s.tenant = make(map[string]*Scoreboard)
+	}
+	s.tenant[t.Name] = v
+	s.Server.Handler.(*http.ServeMux).Handle(v.prefix+"/", http.StripPrefix(v.prefix, v.Handler))
+	s.log.Debug(`Added tenant "%s" from "%s".`, t.Name, t.Config)
+	return nil
+}
+
+// unprefixed returns the path without the tenant prefix, if any, for the values of the
+// main Scoreboard that also apply to tenants.
+func unprefixed(p string) string {
+	if !strings.HasPrefix(p, "/e/") {
+		return p
+	}
+	if i := strings.IndexByte(p[3:], '/'); i >= 0 {
+		return p[3+i:]
+	}
+	return p
+}
@@ -0,0 +1,171 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+// themeInterval is how often the theme schedule is checked.
+const themeInterval = time.Second * 15
+
+// shades is the theme schedule of the displays. Each shift switches every display to its
+// theme at its time of day, in the config timezone, until the next shift. An empty theme
+// is the theme of the page, which is the theme of its profile.
+type shades struct {
+	Schedule []shift `json:"schedule,omitempty"`
+}
+type shift struct {
+	At    string `json:"at"`
+	Theme string `json:"theme"`
+}
+
+func (t shades) verify() error {
+	for _, v := range t.Schedule {
+		if _, err := time.Parse("15:04", v.At); err != nil {
+			return &errval{s: `theme schedule time "` + v.At + `" must be in the "HH:MM" format`}
+		}
+		if len(v.Theme) > 0 && !slug(v.Theme) {
+			return &errval{s: `theme "` + v.Theme + `" can only contain lowercase letters, numbers, dashes and underscores`}
+		}
+	}
+	return nil
+}
+
+// scheduled returns the theme of the shift at the time. Before the first shift of the
+// day, the last shift of the day before is used.
+func (t shades) scheduled(n time.Time) string {
+	if len(t.Schedule) == 0 {
+		return ""
+	}
+	var (
+		m    = n.Hour()*60 + n.Minute()
+		b, l = -1, -1
+		r, x string
+	)
+	for _, v := range t.Schedule {
+		a, err := time.Parse("15:04", v.At)
+		if err != nil {
+			continue
+		}
+		k := a.Hour()*60 + a.Minute()
+		if k <= m && k >= b {
+			b, r = k, v.Theme
+		}
+		if k >= l {
+			l, x = k, v.Theme
+		}
+	}
+	if b == -1 {
+		return x
+	}
+	return r
+}
+
+// theme returns the theme shown by the displays, which is the theme set by the admin API
+// or the theme of the schedule. The swap lock must be held when this is called.
+func (s *Scoreboard) theme() string {
+	if len(s.tone) > 0 {
+		return s.tone
+	}
+	return s.themes.scheduled(time.Now().In(s.zone))
+}
+
+// tint sends the Theme Command to the displays of every game, if the theme shown by
+// the displays has changed since it was last sent.
+func (s *Scoreboard) tint() {
+	s.swap.Lock()
+	v := s.theme()
+	if v == s.shown {
+		s.swap.Unlock()
+		return
+	}
+	s.shown = v
+	s.swap.Unlock()
+	s.Command(0, game.Command{Action: game.Theme, View: v})
+	for _, m := range s.games {
+		m.Command(0, game.Command{Action: game.Theme, View: v})
+	}
+	if len(v) == 0 {
+		s.log.Info("Switched the displays to the theme of their page.")
+	} else {
+		s.log.Info(`Switched the displays to the "%s" theme.`, v)
+	}
+}
+
+// palette checks the theme schedule until the context is cancelled.
+func (s *Scoreboard) palette(x context.Context) {
+	t := time.NewTicker(themeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+			s.tint()
+		}
+	}
+}
+
+// httpTheme returns the theme shown by the displays, or sets the theme of every display
+// until it is removed with a DELETE, which returns the displays to the theme schedule.
+func (s *Scoreboard) httpTheme(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		var c struct {
+			Theme string `json:"theme"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminBody)).Decode(&c); err != nil {
+			fail(w, "request body is not valid JSON", http.StatusBadRequest)
+			return
+		}
+		if c.Theme = strings.ToLower(c.Theme); !slug(c.Theme) {
+			fail(w, `theme "`+c.Theme+`" is not valid`, http.StatusBadRequest)
+			return
+		}
+		s.swap.Lock()
+		s.tone = c.Theme
+		s.swap.Unlock()
+		s.log.request(r).Info(`Admin "%s" set the display theme to "%s".`, r.RemoteAddr, c.Theme)
+		s.tint()
+	case http.MethodDelete:
+		s.swap.Lock()
+		s.tone = ""
+		s.swap.Unlock()
+		s.log.request(r).Info(`Admin "%s" returned the display theme to the schedule.`, r.RemoteAddr)
+		s.tint()
+	default:
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.swap.RLock()
+	v := struct {
+		Theme     string `json:"theme"`
+		Override  string `json:"override,omitempty"`
+		Scheduled string `json:"scheduled,omitempty"`
+	}{Theme: s.theme(), Override: s.tone, Scheduled: s.themes.scheduled(time.Now().In(s.zone))}
+	s.swap.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
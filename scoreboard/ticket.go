@@ -0,0 +1,108 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ticketLife is how long a WebSocket ticket can be used after it is created. Tickets
+// are only checked when the WebSocket is opened, so the page asks for a ticket just
+// before connecting.
+const ticketLife = time.Second * 30
+
+// signer returns the key that signs WebSocket tickets. The key is derived from the
+// admin token, so every node of a cluster accepts the tickets of the others and
+// changing the admin token invalidates every ticket.
+func (s *Scoreboard) signer() []byte {
+	h := sha256.Sum256([]byte("scoreboard-ticket\x00" + s.token))
+	return h[:]
+}
+
+// ticket returns a new signed ticket that opens a staff WebSocket until the expiry. The
+// ticket is the expiry and a random nonce, followed by the HMAC-SHA256 of both.
+func (s *Scoreboard) ticket(e time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:], uint64(e.UnixMilli()))
+	rand.Read(b[8:])
+	m := hmac.New(sha256.New, s.signer())
+	m.Write(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:]) + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// redeem returns true if the ticket was signed by the Scoreboard and has not expired.
+func (s *Scoreboard) redeem(t string) bool {
+	if len(s.token) == 0 || len(t) == 0 || len(t) > 128 {
+		return false
+	}
+	p, v, ok := strings.Cut(t, ".")
+	if !ok {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil || len(b) != 16 {
+		return false
+	}
+	g, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return false
+	}
+	m := hmac.New(sha256.New, s.signer())
+	m.Write(b)
+	if !hmac.Equal(g, m.Sum(nil)) {
+		return false
+	}
+	return time.Now().Before(time.UnixMilli(int64(binary.BigEndian.Uint64(b))))
+}
+
+// staff returns true if the WebSocket request can join the staff channel, which is sent
+// the source status and the live standings of frozen Games. The signed "ticket" query
+// parameter and the Authorization header are always accepted, while the "token" query
+// parameter is only accepted if tickets are not required.
+func (s *Scoreboard) staff(r *http.Request) bool {
+	if s.redeem(r.URL.Query().Get("ticket")) {
+		return true
+	}
+	return s.permitted(r, !s.tickets, scopeScores)
+}
+func (s *Scoreboard) httpTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		fail(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if !s.permitted(r, false, scopeScores) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scoreboard"`)
+		fail(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		s.log.request(r).Warning(`Rejected unauthorized ticket request from "%s"!`, r.RemoteAddr)
+		return
+	}
+	e := time.Now().Add(ticketLife)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Expires time.Time `json:"expires"`
+		Ticket  string    `json:"ticket"`
+	}{e.UTC(), s.ticket(e)})
+}
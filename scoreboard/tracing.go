@@ -0,0 +1,213 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	traceIdle   = time.Second * 5
+	traceBatch  = 256
+	traceBuffer = 2048
+)
+
+// exporter sends the update tick spans of every Game to an OpenTelemetry collector,
+// such as Jaeger or Tempo, with the OTLP/HTTP JSON protocol.
+type exporter struct {
+	log     logx.Log
+	client  *http.Client
+	queue   chan traced
+	headers map[string]string
+	url     string
+	service string
+}
+type traced struct {
+	game string
+	span game.Span
+}
+type telemetry struct {
+	Headers  map[string]string `json:"headers,omitempty"`
+	Endpoint string            `json:"endpoint"`
+	Service  string            `json:"service"`
+}
+type otlpValue struct {
+	String string `json:"stringValue"`
+}
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code"`
+}
+type otlpSpan struct {
+	Trace      string          `json:"traceId"`
+	ID         string          `json:"spanId"`
+	Parent     string          `json:"parentSpanId,omitempty"`
+	Name       string          `json:"name"`
+	Start      string          `json:"startTimeUnixNano"`
+	End        string          `json:"endTimeUnixNano"`
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+	Status     otlpStatus      `json:"status"`
+	Kind       int             `json:"kind"`
+}
+
+func (t telemetry) verify() error {
+	if len(t.Endpoint) == 0 {
+		return nil
+	}
+	u, err := url.Parse(t.Endpoint)
+	if err != nil {
+		return &errval{s: `tracing endpoint "` + t.Endpoint + `" is not valid`, e: err}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &errval{s: `tracing endpoint scheme "` + u.Scheme + `" is not supported`}
+	}
+	return nil
+}
+
+// trace returns the Trace function for the named game, the main Game has no name.
+func (e *exporter) trace(n string) func(game.Span) {
+	return func(s game.Span) {
+		select {
+		case e.queue <- traced{game: n, span: s}:
+		default:
+		}
+	}
+}
+func (e *exporter) start(x context.Context) {
+	t := time.NewTicker(traceIdle)
+	defer t.Stop()
+	r := make([]traced, 0, traceBatch)
+	for {
+		select {
+		case <-x.Done():
+			// Send any queued spans so the last update ticks before a shutdown are
+			// not lost.
+			for len(e.queue) > 0 && len(r) < traceBatch {
+				r = append(r, <-e.queue)
+			}
+			if len(r) > 0 {
+				c, f := context.WithTimeout(context.Background(), e.client.Timeout)
+				e.send(c, r)
+				f()
+			}
+			return
+		case <-t.C:
+			if len(r) == 0 {
+				continue
+			}
+		case v := <-e.queue:
+			if r = append(r, v); len(r) < traceBatch {
+				continue
+			}
+		}
+		e.send(x, r)
+		r = r[:0]
+	}
+}
+func newExporter(t telemetry, c *http.Client, l logx.Log) *exporter {
+	e := &exporter{
+		log:     l,
+		url:     t.Endpoint,
+		queue:   make(chan traced, traceBuffer),
+		client:  c,
+		headers: t.Headers,
+		service: t.Service,
+	}
+	if len(e.service) == 0 {
+		e.service = "scoreboard"
+	}
+	return e
+}
+func (e *exporter) send(x context.Context, r []traced) {
+	o := make([]otlpSpan, len(r))
+	for i := range r {
+		s := &r[i].span
+		o[i] = otlpSpan{
+			ID:    hex.EncodeToString(s.ID[:]),
+			Name:  s.Name,
+			Kind:  1,
+			Trace: hex.EncodeToString(s.Trace[:]),
+			Start: strconv.FormatInt(s.Start.UnixNano(), 10),
+			End:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.Parent != ([8]byte{}) {
+			o[i].Parent = hex.EncodeToString(s.Parent[:])
+		}
+		if len(s.Error) > 0 {
+			o[i].Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+		if len(r[i].game) > 0 {
+			o[i].Attributes = append(o[i].Attributes, otlpAttribute{Key: "scoreboard.game", Value: otlpValue{String: r[i].game}})
+		}
+		k := make([]string, 0, len(s.Attributes))
+		for n := range s.Attributes {
+			k = append(k, n)
+		}
+		sort.Strings(k)
+		for _, n := range k {
+			o[i].Attributes = append(o[i].Attributes, otlpAttribute{Key: n, Value: otlpValue{String: s.Attributes[n]}})
+		}
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{String: e.service}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "scoreboard", "version": version},
+				"spans": o,
+			}},
+		}},
+	})
+	if err != nil {
+		return
+	}
+	q, err := http.NewRequestWithContext(x, http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		e.log.Error("Unable to create the tracing request: %s!", err.Error())
+		return
+	}
+	q.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		q.Header.Set(k, v)
+	}
+	p, err := e.client.Do(q)
+	if err != nil {
+		e.log.Warning("Unable to send %d spans to the tracing endpoint: %s!", len(r), err.Error())
+		return
+	}
+	if p.Body.Close(); p.StatusCode >= 300 {
+		e.log.Warning("Tracing endpoint returned status code %d for %d spans!", p.StatusCode, len(r))
+		return
+	}
+	e.log.Trace("Sent %d spans to the tracing endpoint.", len(r))
+}
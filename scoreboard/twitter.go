@@ -0,0 +1,259 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+)
+
+// twitterHold is the most Tweets kept while the Twitter ticker is paused. The oldest
+// Tweets are dropped once it is full.
+const twitterHold = 64
+
+// Dialer is a function that starts a Twitter stream with the supplied credentials and
+// HTTP client, which is used in place of the Twitter API when passed to Cmdline.
+type Dialer func(Credentials, *http.Client) (Stream, error)
+
+// deadline is the Twitter client timeouts, in seconds. The client does not have an overall
+// request timeout, as that would close the stream, so a stream that stops sending data,
+// including the keep-alives sent by Twitter, is closed and reconnected after the stall
+// timeout instead.
+type deadline struct {
+	Dial   int `json:"dial"`
+	TLS    int `json:"tls"`
+	Header int `json:"header"`
+	Stall  int `json:"stall"`
+}
+type stalled struct {
+	net.Conn
+	d time.Duration
+}
+
+func (c *stalled) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.d))
+	return c.Conn.Read(b)
+}
+func (d deadline) client(p func(*http.Request) (*url.URL, error)) *http.Client {
+	var (
+		n = &net.Dialer{Timeout: time.Duration(d.Dial) * time.Second, KeepAlive: time.Second * 30}
+		s = time.Duration(d.Stall) * time.Second
+	)
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: p,
+			DialContext: func(x context.Context, w, a string) (net.Conn, error) {
+				c, err := n.DialContext(x, w, a)
+				if err != nil || s <= 0 {
+					return c, err
+				}
+				return &stalled{Conn: c, d: s}, nil
+			},
+			IdleConnTimeout:       time.Second * 90,
+			TLSHandshakeTimeout:   time.Duration(d.TLS) * time.Second,
+			ResponseHeaderTimeout: time.Duration(d.Header) * time.Second,
+		},
+	}
+}
+
+// Rotate replaces the Twitter credentials used by the Scoreboard. The new credentials are
+// verified and a new stream is started before the current stream is stopped, so the
+// ticker keeps running. This can also restart a stream that was disconnected because
+// the old credentials were revoked. This function returns an error if Twitter was not
+// enabled when the Scoreboard was created.
+func (s *Scoreboard) Rotate(a *Credentials) error {
+	if s.rotate == nil {
+		return &errval{s: "Twitter is not enabled"}
+	}
+	if a == nil || !a.usable() {
+		return &errval{s: "both Twitter consumer keys and both or none of the access keys are required"}
+	}
+	// Cluster nodes that are not the leader only keep the credentials, which are used
+	// once the node becomes the leader.
+	if s.cluster != nil && !s.cluster.leading() {
+		s.swap.Lock()
+		s.auth = *a
+		s.swap.Unlock()
+		s.log.with("twitter").Info("Saved the rotated Twitter credentials for when this node is the cluster leader.")
+		return nil
+	}
+	f, err := connect(s.dial, a, s.filter, s.streamer())
+	if err != nil {
+		return err
+	}
+	select {
+	case s.rotate <- f:
+	default:
+		f.Stop()
+		return &errval{s: "a Twitter credential rotation is already pending"}
+	}
+	s.swap.Lock()
+	s.auth = *a
+	s.swap.Unlock()
+	s.keys.set(*a)
+	s.log.with("twitter").Info("Rotated the Twitter credentials!")
+	return nil
+}
+
+// PauseTwitter stops sending Tweets to the displays and exec commands without closing
+// the stream, such as during an award ceremony. Tweets received while paused
+// are kept, up to a limit, and are sent once the ticker is resumed. This function
+// returns an error if Twitter was not enabled when the Scoreboard was created.
+func (s *Scoreboard) PauseTwitter() error {
+	if s.rotate == nil {
+		return &errval{s: "Twitter is not enabled"}
+	}
+	if atomic.SwapUint32(&s.stats.paused, 1) == 0 {
+		s.log.with("twitter").Info("Paused the Twitter ticker.")
+	}
+	return nil
+}
+
+// ResumeTwitter sends the Tweets kept while the ticker was paused and starts sending
+// new Tweets again. This function returns an error if Twitter was not enabled when the
+// Scoreboard was created.
+func (s *Scoreboard) ResumeTwitter() error {
+	if s.rotate == nil {
+		return &errval{s: "Twitter is not enabled"}
+	}
+	if atomic.SwapUint32(&s.stats.paused, 0) == 1 {
+		s.log.with("twitter").Info("Resumed the Twitter ticker.")
+	}
+	select {
+	case s.resume <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// elected is called by the cluster when this node becomes or stops being the leader,
+// which starts or stops the Twitter stream.
+func (s *Scoreboard) elected(_ bool) {
+	select {
+	case s.handoff <- struct{}{}:
+	default:
+	}
+}
+
+// handover starts the Twitter stream if this node is the cluster leader and does not
+// have a stream, or stops the stream if this node is no longer the leader. The stream
+// and its message channel are returned, which are nil if the stream is stopped.
+func (s *Scoreboard) handover(f Stream, r <-chan interface{}, l *journal) (Stream, <-chan interface{}) {
+	if !s.cluster.leading() {
+		if f == nil {
+			return nil, nil
+		}
+		f.Stop()
+		atomic.StoreUint32(&s.stats.stream, 0)
+		s.source("twitter", "read by the cluster leader")
+		l.Info("Stopped the Twitter stream, another node is the cluster leader.")
+		return nil, nil
+	}
+	if f != nil {
+		return f, r
+	}
+	s.swap.RLock()
+	a := s.auth
+	s.swap.RUnlock()
+	v, err := connect(s.dial, &a, s.filter, s.streamer())
+	if err != nil {
+		l.Error("Unable to start the Twitter stream as the cluster leader: %s!", err.Error())
+		s.degrade("twitter", time.Now())
+		s.source("twitter", "disconnected, unable to start the stream")
+		return nil, nil
+	}
+	atomic.StoreUint32(&s.stats.stream, 1)
+	s.degrade("twitter", time.Time{})
+	s.source("twitter", "connected")
+	l.Info("Started the Twitter stream as the cluster leader.")
+	return v, v.Messages()
+}
+
+// connect starts a stream with the credentials, using the Dialer instead of the Twitter
+// API if it is not nil. Credentials without access keys use app-only auth with the
+// filtered stream instead.
+func connect(d Dialer, a *Credentials, f filter, c *http.Client) (Stream, error) {
+	if d != nil {
+		return d(*a, c)
+	}
+	if a.app() {
+		return filtered(a, f, c)
+	}
+	y := twitter.NewClient(
+		oauth1.NewConfig(a.ConsumerKey, a.ConsumerSecret).Client(
+			context.WithValue(context.Background(), oauth1.HTTPClient, c),
+			oauth1.NewToken(a.AccessKey, a.AccessSecret),
+		),
+	)
+	if _, _, err := y.Accounts.VerifyCredentials(nil); err != nil {
+		return nil, &errval{s: "cannot authenticate to Twitter", e: err}
+	}
+	v, err := y.Streams.Filter(
+		&twitter.StreamFilterParams{
+			Track:         f.Keywords,
+			Language:      f.Language,
+			StallWarnings: twitter.Bool(true),
+		},
+	)
+	if err != nil {
+		return nil, &errval{s: "unable to start Twitter filter", e: err}
+	}
+	return account{v}, nil
+}
+
+// reject returns the name of the filter rule that removes the Tweet and the user, word
+// or language it matched, or an empty string if the Tweet passes the user and word
+// filters. The keyword and language filters are applied by Twitter, and the language
+// filter is also checked here if language detection is enabled.
+func (f filter) reject(t *twitter.Tweet) (string, string) {
+	if t.User == nil {
+		return "no_user", ""
+	}
+	if len(f.OnlyUsers) > 0 && !named(f.OnlyUsers, t.User.ScreenName) {
+		return "only_users", t.User.ScreenName
+	}
+	if named(f.BlockedUsers, t.User.ScreenName) {
+		return "blocked_users", t.User.ScreenName
+	}
+	v := strings.ToLower(t.Text)
+	if t.RetweetedStatus != nil {
+		v += " " + strings.ToLower(t.RetweetedStatus.Text)
+	}
+	if f.Detect > 0 && !f.language(t.Lang, v) {
+		return "language", t.Lang
+	}
+	if w := blocked(v, f.BlockedWords); len(w) > 0 {
+		return "banned_words", w
+	}
+	return "", ""
+}
+func named(l []string, n string) bool {
+	for i := range l {
+		if strings.EqualFold(strings.TrimPrefix(l[i], "@"), n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+)
+
+// validate checks the config without starting the Scoreboard and returns every problem
+// that was found. If check is true, the sources are requested and the Twitter keys
+// are checked.
+func (c config) validate(check bool) []string {
+	v := c.copy()
+	if err := v.verify(); err != nil {
+		return []string{err.Error()}
+	}
+	var r []string
+	if h, p, err := net.SplitHostPort(v.Listen); err != nil {
+		r = append(r, `listen address "`+v.Listen+`" is not valid: `+err.Error())
+	} else if _, err = net.LookupPort("tcp", p); err != nil {
+		r = append(r, `listen address "`+v.Listen+`" port is not valid: `+err.Error())
+	} else if len(h) > 0 && net.ParseIP(h) == nil {
+		if _, err = net.LookupHost(h); err != nil {
+			r = append(r, `listen address "`+v.Listen+`" host cannot be resolved: `+err.Error())
+		}
+	}
+	switch {
+	case len(v.Cert) > 0 && len(v.Key) == 0:
+		r = append(r, "a TLS certificate requires a key")
+	case len(v.Key) > 0 && len(v.Cert) == 0:
+		r = append(r, "a TLS key requires a certificate")
+	case len(v.Cert) > 0:
+		if _, err := tls.LoadX509KeyPair(v.Cert, v.Key); err != nil {
+			r = append(r, "cannot load the TLS certificate and key: "+err.Error())
+		}
+	}
+	if len(v.Directory) > 0 {
+		if i, err := os.Stat(filepath.Join(v.Directory, "public")); err != nil || !i.IsDir() {
+			r = append(r, `public directory "`+filepath.Join(v.Directory, "public")+`" does not exist`)
+		}
+	}
+	r = append(r, v.Twitter.validate()...)
+	for i := range v.Webhooks {
+		if u, err := url.Parse(v.Webhooks[i].URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			r = append(r, `webhook URL "`+v.Webhooks[i].URL+`" is not a valid HTTP URL`)
+		}
+	}
+	for i := range v.Exec {
+		if _, err := exec.LookPath(v.Exec[i].Command); err != nil {
+			r = append(r, `exec command "`+v.Exec[i].Command+`" cannot be found`)
+		}
+	}
+	if len(v.Script.File) > 0 {
+		if _, _, err := compile(v.Script.File); err != nil {
+			r = append(r, `script "`+v.Script.File+`" is not valid: `+err.Error())
+		}
+	}
+	var (
+		t = time.Duration(v.Timeout) * time.Second
+		m = map[string]*game.Manager{}
+	)
+	if g, err := game.New(v.Source.Type, v.Source.raw, v.Assets, time.Duration(v.Source.interval(v.Tick))*time.Second, t, logx.NOP); err != nil {
+		r = append(r, `source "`+v.Source.Type+`" is not valid: `+err.Error())
+	} else if err = g.Proxy(v.proxy(v.Source)); err != nil {
+		r = append(r, "source proxy is not valid: "+err.Error())
+	} else {
+		m[""] = g
+	}
+	for i := range v.Games {
+		g, err := game.New(v.Games[i].Source.Type, v.Games[i].Source.raw, v.Assets, time.Duration(v.Games[i].Source.interval(v.Games[i].Tick))*time.Second, t, logx.NOP)
+		if err != nil {
+			r = append(r, `game "`+v.Games[i].Name+`" source "`+v.Games[i].Source.Type+`" is not valid: `+err.Error())
+			continue
+		}
+		if err = g.Proxy(v.proxy(v.Games[i].Source)); err != nil {
+			r = append(r, `game "`+v.Games[i].Name+`" source proxy is not valid: `+err.Error())
+			continue
+		}
+		m[v.Games[i].Name] = g
+	}
+	if !check {
+		return r
+	}
+	for n, g := range m {
+		x, f := context.WithTimeout(context.Background(), t)
+		if err := g.Check(x); err != nil {
+			if len(n) == 0 {
+				r = append(r, "cannot reach the source: "+err.Error())
+			} else {
+				r = append(r, `cannot reach the source of game "`+n+`": `+err.Error())
+			}
+		}
+		f()
+	}
+	if p, err := game.Proxy(v.Proxy, v.NoProxy); err == nil && v.twitter && v.Twitter.Credentials.app() {
+		x, f := context.WithTimeout(context.Background(), t)
+		if _, err := token(x, &v.Twitter.Credentials, v.Twitter.Timeouts.client(p)); err != nil {
+			r = append(r, "cannot authenticate to Twitter: "+err.Error())
+		}
+		f()
+	} else if err == nil && v.twitter {
+		y := twitter.NewClient(
+			oauth1.NewConfig(v.Twitter.Credentials.ConsumerKey, v.Twitter.Credentials.ConsumerSecret).Client(
+				context.WithValue(context.Background(), oauth1.HTTPClient, v.Twitter.Timeouts.client(p)),
+				oauth1.NewToken(v.Twitter.Credentials.AccessKey, v.Twitter.Credentials.AccessSecret),
+			),
+		)
+		if _, _, err := y.Accounts.VerifyCredentials(nil); err != nil {
+			r = append(r, "cannot authenticate to Twitter: "+err.Error())
+		}
+	}
+	return r
+}
+
+// validate checks the Twitter keys and filter. Partly set keys are a problem, as they
+// silently disable Twitter.
+func (t tweets) validate() []string {
+	var r []string
+	n := 0
+	for _, k := range [...]string{t.Credentials.AccessKey, t.Credentials.AccessSecret, t.Credentials.ConsumerKey, t.Credentials.ConsumerSecret} {
+		if len(k) > 0 {
+			n++
+		}
+	}
+	if n > 0 && !t.Credentials.usable() {
+		r = append(r, "twitter auth requires both consumer keys and both or none of the access keys, Twitter will be disabled")
+	}
+	if len(t.Filter.Keywords) > 400 {
+		r = append(r, "twitter filter has "+strconv.Itoa(len(t.Filter.Keywords))+" keywords, more than the limit of 400")
+	}
+	for _, k := range t.Filter.Keywords {
+		if k = strings.TrimSpace(k); len(k) == 0 || len(k) > 60 {
+			r = append(r, `twitter filter keyword "`+k+`" must be between 1 and 60 characters`)
+		}
+	}
+	for _, l := range t.Filter.Language {
+		if len(l) < 2 || len(l) > 8 || strings.Trim(strings.ToLower(l), "abcdefghijklmnopqrstuvwxyz-") != "" {
+			r = append(r, `twitter filter language "`+l+`" is not a valid language code`)
+		}
+	}
+	for _, l := range [...][]string{t.Filter.OnlyUsers, t.Filter.BlockedUsers} {
+		for _, u := range l {
+			if v := strings.TrimPrefix(u, "@"); len(v) == 0 || len(v) > 15 || strings.Trim(strings.ToLower(v), "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+				r = append(r, `twitter filter user "`+u+`" is not a valid user name`)
+			}
+		}
+	}
+	for _, w := range t.Filter.BlockedWords {
+		if len(strings.TrimSpace(w)) == 0 {
+			r = append(r, "twitter filter banned words cannot be empty")
+			break
+		}
+	}
+	return r
+}
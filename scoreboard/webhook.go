@@ -0,0 +1,196 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/PurpleSec/logx"
+	"github.com/PvJScorebot/scorebot-scoreboard/scoreboard/game"
+)
+
+const (
+	hookQueue    = 128
+	hookAttempts = 3
+)
+
+// hook is a webhook that is sent the changes in its events list. The Template, if set,
+// is a Go template that writes the request body from the change in place of the change
+// JSON, so a webhook can post directly to chat services.
+type hook struct {
+	URL      string            `json:"url"`
+	Secret   string            `json:"secret,omitempty"`
+	Template string            `json:"template,omitempty"`
+	Events   []string          `json:"events,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+type delivery struct {
+	body []byte
+	kind string
+}
+type webhook struct {
+	log      logx.Log
+	queue    chan delivery
+	client   *http.Client
+	events   map[game.Kind]struct{}
+	headers  map[string]string
+	template *template.Template
+	url      string
+	secret   []byte
+}
+
+func (h hook) verify() error {
+	if len(h.URL) == 0 {
+		return &errval{s: "webhook URL cannot be empty"}
+	}
+	for i := range h.Events {
+		if _, ok := game.ParseKind(h.Events[i]); !ok {
+			return &errval{s: `webhook "` + h.URL + `" event type "` + h.Events[i] + `" is not valid`}
+		}
+	}
+	if len(h.Template) > 0 {
+		if _, err := phrase(h.URL, h.Template, game.Change{}); err != nil {
+			return &errval{s: `webhook "` + h.URL + `" template is not valid`, e: err}
+		}
+	}
+	return nil
+}
+func (w *webhook) send(c game.Change) {
+	if w.events != nil {
+		if _, ok := w.events[c.Kind]; !ok {
+			return
+		}
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if w.template != nil {
+		b, err = word(w.template, c)
+	} else {
+		b, err = json.Marshal(c)
+	}
+	if err != nil {
+		w.log.Error(`Unable to create webhook payload for "%s": %s!`, w.url, err.Error())
+		return
+	}
+	select {
+	case w.queue <- delivery{body: b, kind: c.Kind.String()}:
+	default:
+		w.log.Warning(`Webhook "%s" queue is full, dropping "%s" event!`, w.url, c.Kind.String())
+	}
+}
+func (s *Scoreboard) dispatch(c game.Change) {
+	for i := range s.hooks {
+		s.hooks[i].send(c)
+	}
+}
+func (w *webhook) start(x context.Context) {
+	for {
+		select {
+		case <-x.Done():
+			return
+		case d := <-w.queue:
+			w.deliver(x, d)
+		}
+	}
+}
+func (w *webhook) deliver(x context.Context, d delivery) {
+	for i := 0; i < hookAttempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(time.Second << uint(i-1))
+			select {
+			case <-x.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+		c, err := w.post(x, d)
+		if err == nil {
+			w.log.Trace(`Delivered "%s" event to webhook "%s".`, d.kind, w.url)
+			return
+		}
+		if c > 0 && c < 500 && c != http.StatusTooManyRequests {
+			w.log.Error(`Webhook "%s" rejected "%s" event: %s!`, w.url, d.kind, err.Error())
+			return
+		}
+		w.log.Warning(`Webhook "%s" delivery attempt %d failed: %s!`, w.url, i+1, err.Error())
+	}
+	w.log.Error(`Webhook "%s" delivery of "%s" event failed after %d attempts!`, w.url, d.kind, hookAttempts)
+}
+func newWebhook(h hook, c *http.Client, l logx.Log) *webhook {
+	w := &webhook{
+		log:     l,
+		url:     h.URL,
+		queue:   make(chan delivery, hookQueue),
+		client:  c,
+		headers: h.Headers,
+	}
+	if len(h.Secret) > 0 {
+		w.secret = []byte(h.Secret)
+	}
+	if len(h.Template) > 0 {
+		// The template was checked when the config was loaded.
+		w.template, _ = phrase(h.URL, h.Template, nil)
+	}
+	if len(h.Events) > 0 {
+		w.events = make(map[game.Kind]struct{}, len(h.Events))
+		for i := range h.Events {
+			k, _ := game.ParseKind(h.Events[i])
+			w.events[k] = struct{}{}
+		}
+	}
+	return w
+}
+func (w *webhook) post(x context.Context, d delivery) (int, error) {
+	r, err := http.NewRequestWithContext(x, http.MethodPost, w.url, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, err
+	}
+	// The headers are set after the content type, so a webhook with a template that
+	// is not JSON can set its own.
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		r.Header.Set(k, v)
+	}
+	r.Header.Set("User-Agent", "Scorebot-Scoreboard")
+	r.Header.Set("X-Scoreboard-Event", d.kind)
+	if len(w.secret) > 0 {
+		m := hmac.New(sha256.New, w.secret)
+		m.Write(d.body)
+		r.Header.Set("X-Scoreboard-Signature", "sha256="+hex.EncodeToString(m.Sum(nil)))
+	}
+	o, err := w.client.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	o.Body.Close()
+	if o.StatusCode >= 300 {
+		return o.StatusCode, &errval{s: "status code " + strconv.Itoa(o.StatusCode) + " returned"}
+	}
+	return o.StatusCode, nil
+}
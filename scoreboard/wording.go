@@ -0,0 +1,70 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// wordings are the functions that outbound message templates can use. The "json"
+// function quotes a value so it can be placed in a JSON payload, such as
+// "{"content": {{json .Text}}}".
+var wordings = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"pad": func(n int, s string) string {
+		if c := utf8.RuneCountInString(s); c < n {
+			return s + strings.Repeat(" ", n-c)
+		}
+		return s
+	},
+}
+
+// phrase parses the outbound message template with the supplied name. If the example
+// data is not nil, the template is run once with it, so errors such as unknown fields
+// are returned when the config is loaded instead of when the first message is sent.
+func phrase(n, v string, e interface{}) (*template.Template, error) {
+	t, err := template.New(n).Funcs(wordings).Option("missingkey=error").Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return t, nil
+	}
+	if _, err = word(t, e); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// word returns the output of the outbound message template with the supplied data.
+func word(t *template.Template, d interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, d); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,261 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PurpleSec/logx"
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// wordlistRefresh is how often word lists loaded from a URL are requested again.
+const wordlistRefresh = time.Minute * 5
+
+// wordlistMax is the largest word list that is loaded.
+const wordlistMax = 4 << 20
+
+// wordlist is the blocked words loaded from files or URLs, one list for each Tweet
+// language, or for every language with the "*" language. Files are loaded again when
+// they are changed and URLs are requested again every few minutes.
+type wordlist struct {
+	log     logx.Log
+	client  *http.Client
+	words   map[string][]string
+	sources map[string]string
+	stamps  map[string]string
+	lock    sync.RWMutex
+}
+
+func remote(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+func (f filter) verify() error {
+	if f.Detect < 0 || f.Detect > 1 {
+		return &errval{s: "twitter filter detect " + strconv.FormatFloat(f.Detect, 'f', -1, 64) + " must be between zero and one"}
+	}
+	for k, v := range f.Wordlists {
+		if len(k) == 0 || len(v) == 0 {
+			return &errval{s: "twitter wordlists need a language and a file or URL"}
+		}
+		if remote(v) {
+			continue
+		}
+		if _, err := os.Stat(v); err != nil {
+			return &errval{s: `wordlist file "` + v + `" cannot be read`, e: err}
+		}
+	}
+	return nil
+}
+
+// blocked returns the first of the words that is in the lowercase text, or an empty
+// string if none are. Words that start or end with a letter or number only match at
+// the start or end of a word in the text, so "ass" does not block "class".
+func blocked(v string, l []string) string {
+	for i := range l {
+		w := strings.ToLower(strings.TrimSpace(l[i]))
+		if len(w) == 0 {
+			continue
+		}
+		for n := 0; ; {
+			x := strings.Index(v[n:], w)
+			if x < 0 {
+				break
+			}
+			x += n
+			if bounded(v, w, x) {
+				return w
+			}
+			_, k := utf8.DecodeRuneInString(v[x:])
+			n = x + k
+		}
+	}
+	return ""
+}
+func bounded(v, w string, x int) bool {
+	if r, _ := utf8.DecodeRuneInString(w); wordy(r) && x > 0 {
+		if p, _ := utf8.DecodeLastRuneInString(v[:x]); wordy(p) {
+			return false
+		}
+	}
+	if r, _ := utf8.DecodeLastRuneInString(w); wordy(r) && x+len(w) < len(v) {
+		if p, _ := utf8.DecodeRuneInString(v[x+len(w):]); wordy(p) {
+			return false
+		}
+	}
+	return true
+}
+func wordy(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// words returns the words in the list, one on each line. Empty lines and lines that
+// start with "#" are skipped, so hashtags need a "\" before them, such as "\#tag".
+func words(b []byte) []string {
+	var (
+		r []string
+		s = bufio.NewScanner(bytes.NewReader(b))
+	)
+	for s.Scan() {
+		v := strings.TrimSpace(s.Text())
+		if len(v) == 0 || v[0] == '#' {
+			continue
+		}
+		r = append(r, strings.ToLower(strings.TrimPrefix(v, "\\")))
+	}
+	return r
+}
+func newWordlist(l map[string]string, c *http.Client, g logx.Log) (*wordlist, error) {
+	w := &wordlist{
+		log:     g,
+		client:  c,
+		words:   make(map[string][]string, len(l)),
+		sources: l,
+		stamps:  make(map[string]string, len(l)),
+	}
+	for k, v := range l {
+		if err := w.load(context.Background(), k, v); err != nil {
+			// A list from a URL that cannot be requested is requested again later, so
+			// the Scoreboard can start while the other service is down.
+			if !remote(v) {
+				return nil, &errval{s: `unable to load wordlist "` + v + `"`, e: err}
+			}
+			g.Error(`Unable to load wordlist "%s", it will be requested again later: %s!`, v, err.Error())
+		}
+	}
+	return w, nil
+}
+
+// load reads the list of the language. Lists from a URL are only replaced if they have
+// changed since they were last requested.
+func (w *wordlist) load(x context.Context, k, v string) error {
+	var (
+		b   []byte
+		err error
+	)
+	if !remote(v) {
+		if b, err = os.ReadFile(v); err != nil {
+			return err
+		}
+	} else if b, err = w.fetch(x, v); err != nil || b == nil {
+		return err
+	}
+	l := words(b)
+	w.lock.Lock()
+	w.words[strings.ToLower(k)] = l
+	w.lock.Unlock()
+	w.log.Debug(`Loaded %d words for language "%s" from wordlist "%s".`, len(l), k, v)
+	return nil
+}
+func (w *wordlist) fetch(x context.Context, v string) ([]byte, error) {
+	r, err := http.NewRequestWithContext(x, http.MethodGet, v, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := w.stamps[v]; ok {
+		r.Header.Set("If-None-Match", t)
+	}
+	o, err := w.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer o.Body.Close()
+	switch o.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, &errval{s: "wordlist request returned " + o.Status}
+	}
+	b, err := io.ReadAll(io.LimitReader(o.Body, wordlistMax))
+	if err != nil {
+		return nil, err
+	}
+	w.stamps[v] = o.Header.Get("ETag")
+	return b, nil
+}
+func (w *wordlist) start(x context.Context) {
+	var (
+		t = time.NewTicker(watchInterval)
+		u = time.Now()
+		m = make(map[string]time.Time, len(w.sources))
+	)
+	defer t.Stop()
+	for _, v := range w.sources {
+		if i, err := os.Stat(v); err == nil && !remote(v) {
+			m[v] = i.ModTime()
+		}
+	}
+	for {
+		select {
+		case <-x.Done():
+			return
+		case <-t.C:
+		}
+		r := time.Since(u) >= wordlistRefresh
+		if r {
+			u = time.Now()
+		}
+		for k, v := range w.sources {
+			if remote(v) {
+				if !r {
+					continue
+				}
+				if err := w.load(x, k, v); err != nil {
+					w.log.Error(`Unable to request wordlist "%s", keeping the current words: %s!`, v, err.Error())
+				}
+				continue
+			}
+			i, err := os.Stat(v)
+			if err != nil || i.ModTime().Equal(m[v]) {
+				continue
+			}
+			m[v] = i.ModTime()
+			if err = w.load(x, k, v); err != nil {
+				w.log.Error(`Unable to reload wordlist "%s", keeping the current words: %s!`, v, err.Error())
+				continue
+			}
+			w.log.Info(`Wordlist "%s" was changed and reloaded.`, v)
+		}
+	}
+}
+
+// match returns the word of the list of its language or the list for every language
+// that the Tweet contains, or an empty string if the Tweet contains none of them.
+func (w *wordlist) match(t *twitter.Tweet) string {
+	v := strings.ToLower(t.Text)
+	if t.RetweetedStatus != nil {
+		v += " " + strings.ToLower(t.RetweetedStatus.Text)
+	}
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if r := blocked(v, w.words["*"]); len(r) > 0 || len(t.Lang) == 0 {
+		return r
+	}
+	return blocked(v, w.words[strings.ToLower(t.Lang)])
+}
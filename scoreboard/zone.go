@@ -0,0 +1,62 @@
+// Copyright(C) 2020 - 2023 iDigitalFlame
+//
+// This program is free software: you can redistribute it and / or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.If not, see <https://www.gnu.org/licenses/>.
+//
+
+package scoreboard
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	// The time zone database is built in so time zones can be used on hosts and
+	// containers that do not have one.
+	_ "time/tzdata"
+)
+
+// zone returns the time zone with the IANA name. The "Local" zone is not allowed, as
+// it is the time zone of the server, which is what the display time zone replaces.
+func zone(n string) (*time.Location, error) {
+	if len(n) == 0 || strings.EqualFold(n, "utc") {
+		return time.UTC, nil
+	}
+	if strings.EqualFold(n, "local") {
+		return nil, &errval{s: `time zone "` + n + `" is not valid, a named time zone is required`}
+	}
+	l, err := time.LoadLocation(n)
+	if err != nil {
+		return nil, &errval{s: `time zone "` + n + `" is not valid`, e: err}
+	}
+	return l, nil
+}
+
+// timezone returns the time zone to show the times of the request in, which is the "tz"
+// query value, if it is a valid time zone, or the configured display time zone.
+func (s *Scoreboard) timezone(r *http.Request) *time.Location {
+	if n := r.URL.Query().Get("tz"); len(n) > 0 {
+		if l, err := zone(n); err == nil {
+			return l
+		}
+	}
+	return s.local()
+}
+
+// local returns the configured display time zone.
+func (s *Scoreboard) local() *time.Location {
+	s.swap.RLock()
+	l := s.zone
+	s.swap.RUnlock()
+	return l
+}